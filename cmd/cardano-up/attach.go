@@ -0,0 +1,130 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var attachFlags = struct {
+	container  string
+	detachKeys string
+}{}
+
+func attachCommand() *cobra.Command {
+	attachCmd := &cobra.Command{
+		Use:   "attach <package>",
+		Short: "Attach to the console of a running container for an installed package",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one package may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			svc, err := pm.AttachService(args[0], attachFlags.container)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			detached, err := runAttach(svc)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if detached {
+				slog.Info(
+					fmt.Sprintf("Detached from container %s", svc.ContainerName),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+			} else {
+				slog.Info(
+					fmt.Sprintf("Container %s has stopped", svc.ContainerName),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+			}
+		},
+	}
+	attachCmd.Flags().
+		StringVarP(&attachFlags.container, "container", "c", "", "container in the package to attach to, for packages with more than one container")
+	attachCmd.Flags().
+		StringVar(&attachFlags.detachKeys, "detach-keys", pkgmgr.DefaultDetachKeys, "key sequence to detach from the container, such as ctrl-p,ctrl-q")
+	return attachCmd
+}
+
+// runAttach attaches to the container, putting the terminal in raw mode for containers with a TTY
+// so that keystrokes are passed through as-is. The terminal state is restored before returning
+func runAttach(svc *pkgmgr.DockerService) (bool, error) {
+	tty, err := svc.Tty()
+	if err != nil {
+		return false, err
+	}
+	detachKeys := attachFlags.detachKeys
+	if detachKeys == "" {
+		detachKeys = pkgmgr.DefaultDetachKeys
+	}
+	opts := pkgmgr.AttachOptions{
+		DetachKeys: detachKeys,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}
+	stdinFd := int(os.Stdin.Fd())
+	if tty && term.IsTerminal(stdinFd) && term.IsTerminal(int(os.Stdout.Fd())) {
+		resize := make(chan pkgmgr.TerminalSize, 1)
+		stopResize := watchTerminalSize(int(os.Stdout.Fd()), resize)
+		defer stopResize()
+		opts.Resize = resize
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return false, err
+		}
+		defer func() {
+			_ = term.Restore(stdinFd, oldState)
+		}()
+	}
+	fmt.Fprintf(
+		os.Stderr,
+		"Attached to container %s, press %s to detach\r\n",
+		svc.ContainerName,
+		opts.DetachKeys,
+	)
+	return svc.Attach(opts)
+}
+
+// sendTerminalSize sends the current size of the terminal, if it can be determined. A previous size
+// that hasn't been applied yet is replaced, so that sending never blocks
+func sendTerminalSize(fd int, resize chan pkgmgr.TerminalSize) {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return
+	}
+	select {
+	case <-resize:
+	default:
+	}
+	resize <- pkgmgr.TerminalSize{Width: uint(width), Height: uint(height)}
+}
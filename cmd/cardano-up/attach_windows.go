@@ -0,0 +1,28 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package main
+
+import (
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+)
+
+// watchTerminalSize sends the size of the terminal. Windows has no signal for terminal size
+// changes, so later changes aren't sent
+func watchTerminalSize(fd int, resize chan pkgmgr.TerminalSize) func() {
+	sendTerminalSize(fd, resize)
+	return func() {}
+}
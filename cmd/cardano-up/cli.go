@@ -0,0 +1,85 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func cliCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cli [args...]",
+		Short: "Run cardano-cli against the node in the active context",
+		Long:  "Run cardano-cli in the container of the installed node package for the active context, with the node socket path and network set via the CARDANO_NODE_SOCKET_PATH and CARDANO_NODE_NETWORK_ID env vars",
+		// All args and flags are passed through to cardano-cli
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			exitCode, err := runCli(pm, args)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+		},
+	}
+}
+
+// runCli runs cardano-cli, allocating a TTY when running interactively in a terminal. The
+// terminal state is restored before returning
+func runCli(pm *pkgmgr.PackageManager, args []string) (int, error) {
+	opts, restore, err := terminalCliOptions()
+	if err != nil {
+		return 0, err
+	}
+	defer restore()
+	return pm.Cli(args, opts)
+}
+
+// terminalCliOptions returns the options for running a command in a container with the standard
+// streams, allocating a TTY when running interactively in a terminal. The returned function
+// restores the terminal state
+func terminalCliOptions() (pkgmgr.CliOptions, func(), error) {
+	opts := pkgmgr.CliOptions{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	restore := func() {}
+	stdinFd := int(os.Stdin.Fd())
+	stdinTerminal := term.IsTerminal(stdinFd)
+	if stdinTerminal && term.IsTerminal(int(os.Stdout.Fd())) {
+		// Pass keystrokes through to the TTY as-is
+		opts.Tty = true
+		opts.Stdin = os.Stdin
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return pkgmgr.CliOptions{}, nil, err
+		}
+		restore = func() {
+			_ = term.Restore(stdinFd, oldState)
+		}
+	} else if !stdinTerminal {
+		// Pass through piped input
+		opts.Stdin = os.Stdin
+	}
+	return opts, restore, nil
+}
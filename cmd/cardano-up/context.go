@@ -19,16 +19,33 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/blinklabs-io/cardano-up/internal/table"
 	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
 var contextFlags = struct {
-	description string
-	network     string
-	force       bool
+	description   string
+	network       string
+	networkMagic  uint32
+	networkConfig string
+	dockerHost    string
+	remoteDataDir string
+	dataRoot      string
+	containerUser string
+	force         bool
+	envFile       bool
+	envHook       string
+	envWait       bool
+	envTimeout    time.Duration
+	k8sOutput     string
+	k8sNamespace  string
+	k8sStorage    string
 }{}
 
 func contextCommand() *cobra.Command {
@@ -40,8 +57,11 @@ func contextCommand() *cobra.Command {
 		contextListCommand(),
 		contextSelectCommand(),
 		contextCreateCommand(),
+		contextUpdateCommand(),
+		contextEditCommand(),
 		contextDeleteCommand(),
 		contextEnvCommand(),
+		contextExportK8sCommand(),
 	)
 
 	return contextCommand
@@ -52,40 +72,53 @@ func contextListCommand() *cobra.Command {
 		Use:   "list",
 		Short: "List available contexts",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
 			activeContext, _ := pm.ActiveContext()
 			contexts := pm.Contexts()
 			slog.Info("Contexts (* is active):\n")
-			slog.Info(
-				fmt.Sprintf(
-					"  %-15s %-15s %s",
-					"Name",
-					"Network",
-					"Description",
-				),
+			tbl := newTable("", "Name", "Network", "Description")
+			tbl.SetColumnColor(
+				0,
+				func(value string) table.Color {
+					return table.ColorGreen
+				},
 			)
 			var tmpContextNames []string
 			for contextName := range contexts {
 				tmpContextNames = append(tmpContextNames, contextName)
 			}
 			sort.Strings(tmpContextNames)
-			//for contextName, context := range contexts {
+			var rowAttrs [][]any
 			for _, contextName := range tmpContextNames {
 				context := contexts[contextName]
-				activeMarker := " "
+				activeMarker := ""
 				if contextName == activeContext {
 					activeMarker = "*"
 				}
-				slog.Info(
-					fmt.Sprintf(
-						"%s %-15s %-15s %s",
-						activeMarker,
-						contextName,
-						context.Network,
-						context.Description,
-					),
+				description := context.Description
+				network := context.Network
+				if context.CustomNetwork {
+					network += " (custom)"
+				}
+				if context.DockerHost != "" {
+					description = strings.TrimSpace(
+						fmt.Sprintf("%s (Docker host: %s)", description, context.DockerHost),
+					)
+				}
+				tbl.AddRow(activeMarker, contextName, network, description)
+				rowAttrs = append(
+					rowAttrs,
+					[]any{
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("name", contextName),
+						slog.String("network", context.Network),
+						slog.Bool("customNetwork", context.CustomNetwork),
+						slog.String("dockerHost", context.DockerHost),
+						slog.Bool("active", contextName == activeContext),
+					},
 				)
 			}
+			logTable(tbl, rowAttrs)
 		},
 	}
 }
@@ -104,7 +137,7 @@ func contextSelectCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
 			if err := pm.SetActiveContext(args[0]); err != nil {
 				slog.Error(fmt.Sprintf("failed to set active context: %s", err))
 				os.Exit(1)
@@ -114,6 +147,7 @@ func contextSelectCommand() *cobra.Command {
 					"Selected context %q",
 					args[0],
 				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
 			)
 		},
 	}
@@ -133,11 +167,17 @@ func contextCreateCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
 			tmpContextName := args[0]
 			tmpContext := pkgmgr.Context{
-				Description: contextFlags.description,
-				Network:     contextFlags.network,
+				Description:      contextFlags.description,
+				Network:          contextFlags.network,
+				NetworkMagic:     contextFlags.networkMagic,
+				NetworkConfigDir: contextFlags.networkConfig,
+				DockerHost:       contextFlags.dockerHost,
+				RemoteDataDir:    contextFlags.remoteDataDir,
+				DataRoot:         contextDataRoot(),
+				ContainerUser:    contextFlags.containerUser,
 			}
 			if err := pm.AddContext(tmpContextName, tmpContext); err != nil {
 				slog.Error(fmt.Sprintf("failed to add context: %s", err))
@@ -149,9 +189,92 @@ func contextCreateCommand() *cobra.Command {
 		StringVarP(&contextFlags.description, "description", "d", "", "specifies description for context")
 	cmd.Flags().
 		StringVarP(&contextFlags.network, "network", "n", "", "specifies network for context. if not specified, it's set automatically on the first package install")
+	cmd.Flags().
+		Uint32Var(&contextFlags.networkMagic, "network-magic", 0, "specifies the network magic for a custom network, such as a private testnet or devnet")
+	cmd.Flags().
+		StringVar(&contextFlags.networkConfig, "network-config", "", "specifies a dir with the config and genesis files for a custom network, which are copied into the context")
+	addContextDockerHostFlags(cmd)
 	return cmd
 }
 
+func contextUpdateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update <context name>",
+		Short: "Update an existing context",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no context name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one context name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			tmpContext, ok := pm.Contexts()[args[0]]
+			if !ok {
+				slog.Error(pkgmgr.ErrContextNotExist.Error())
+				os.Exit(1)
+			}
+			// Only update the values for flags that were provided
+			if cmd.Flags().Changed("description") {
+				tmpContext.Description = contextFlags.description
+			}
+			if cmd.Flags().Changed("docker-host") {
+				tmpContext.DockerHost = contextFlags.dockerHost
+			}
+			if cmd.Flags().Changed("remote-data-dir") {
+				tmpContext.RemoteDataDir = contextFlags.remoteDataDir
+			}
+			if cmd.Flags().Changed("data-root") {
+				tmpContext.DataRoot = contextDataRoot()
+			}
+			if cmd.Flags().Changed("container-user") {
+				tmpContext.ContainerUser = contextFlags.containerUser
+			}
+			if err := pm.UpdateContext(args[0], tmpContext); err != nil {
+				slog.Error(fmt.Sprintf("failed to update context: %s", err))
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Updated context %q",
+					args[0],
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+	cmd.Flags().
+		StringVarP(&contextFlags.description, "description", "d", "", "specifies description for context")
+	addContextDockerHostFlags(cmd)
+	return cmd
+}
+
+func addContextDockerHostFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		StringVar(&contextFlags.dockerHost, "docker-host", "", "specifies the Docker host for context, such as ssh://user@host for a remote host. if not specified, DOCKER_HOST or the local Docker socket is used")
+	cmd.Flags().
+		StringVar(&contextFlags.remoteDataDir, "remote-data-dir", "", "specifies the absolute path on a remote (ssh://) Docker host for package data used in bind mounts. if not specified, named volumes are used")
+	cmd.Flags().
+		StringVar(&contextFlags.dataRoot, "data-root", "", "specifies the dir that package data dirs are created in for the context, such as on a larger disk. if not specified, the cardano-up data dir is used")
+	cmd.Flags().
+		StringVar(&contextFlags.containerUser, "container-user", "", "specifies the user that containers run as in the Docker --user format (user, uid, user:group, or uid:gid), or 'image' for the image's default user. if not specified, the local user is used")
+}
+
+// contextDataRoot returns the absolute path for the --data-root flag, if provided
+func contextDataRoot() string {
+	if contextFlags.dataRoot == "" {
+		return ""
+	}
+	ret, err := filepath.Abs(contextFlags.dataRoot)
+	if err != nil {
+		return contextFlags.dataRoot
+	}
+	return ret
+}
+
 func contextDeleteCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "delete <context name>",
@@ -166,26 +289,19 @@ func contextDeleteCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			// Store original context name
-			origContextName, _ := pm.ActiveContext()
+			pm := createPackageManager(cmd.Context())
 			// Make sure we're not deleting the active context
-			if args[0] == origContextName {
+			if activeContextName, _ := pm.ActiveContext(); args[0] == activeContextName {
 				slog.Error(pkgmgr.ErrContextNoDeleteActive.Error())
 				os.Exit(1)
 			}
-			// Temporarily switch to selected context
-			if err := pm.SetActiveContext(args[0]); err != nil {
-				slog.Error(err.Error())
+			if _, ok := pm.Contexts()[args[0]]; !ok {
+				slog.Error(pkgmgr.ErrContextNotExist.Error())
 				os.Exit(1)
 			}
-			installedPackages := pm.InstalledPackages()
+			installedPackages := pm.InstalledPackagesInContext(args[0])
 			if len(installedPackages) > 0 {
 				if !contextFlags.force {
-					// Switch back to original context
-					if err := pm.SetActiveContext(origContextName); err != nil {
-						slog.Warn(err.Error())
-					}
 					slog.Error(
 						"cannot delete context with packages installed. Uninstall packages or run with -f/--force",
 					)
@@ -193,16 +309,11 @@ func contextDeleteCommand() *cobra.Command {
 				}
 				for _, installedPkg := range installedPackages {
 					// Uninstall package
-					if err := pm.Uninstall(installedPkg.Package.Name, false, true); err != nil {
+					if err := pm.UninstallInContext(args[0], []string{installedPkg.InstanceName()}, false, false, true); err != nil {
 						slog.Warn(err.Error())
 					}
 				}
 			}
-			// Switch back to original context
-			if err := pm.SetActiveContext(origContextName); err != nil {
-				slog.Error(err.Error())
-				os.Exit(1)
-			}
 			if err := pm.DeleteContext(args[0]); err != nil {
 				slog.Error(fmt.Sprintf("failed to delete context: %s", err))
 				os.Exit(1)
@@ -212,6 +323,7 @@ func contextDeleteCommand() *cobra.Command {
 					"Deleted context %q",
 					args[0],
 				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
 			)
 		},
 	}
@@ -225,7 +337,32 @@ func contextEnvCommand() *cobra.Command {
 		Use:   "env",
 		Short: "Generate environment vars for current context",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
+			if contextFlags.envFile {
+				slog.Info(
+					pm.ContextEnvFile(),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			if contextFlags.envHook != "" {
+				hook, err := contextEnvHook(
+					contextFlags.envHook,
+					pm.ActiveEnvFile(),
+				)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				slog.Info(
+					strings.TrimSuffix(hook, "\n"),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			if contextFlags.envWait {
+				waitForOutputs(pm)
+			}
 			contextEnv := pm.ContextEnv()
 			var tmpKeys []string
 			for k := range contextEnv {
@@ -239,9 +376,114 @@ func contextEnvCommand() *cobra.Command {
 						key,
 						contextEnv[key],
 					),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("key", key),
+					slog.String("value", contextEnv[key]),
+				)
+			}
+			// Put the binaries for the packages in the current context first in PATH, so that
+			// the shell keeps running them when another context is selected
+			binDir := pm.ContextBinDir()
+			slog.Info(
+				fmt.Sprintf("export PATH=%s:\"$PATH\"", shellQuote(binDir)),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("key", "PATH"),
+				slog.String("value", binDir),
+			)
+		},
+	}
+	cmd.Flags().
+		BoolVar(&contextFlags.envFile, "file", false, "output the path to the env file for the current context")
+	cmd.Flags().
+		StringVar(&contextFlags.envHook, "hook", "", "output a shell hook (bash, zsh, fish) that keeps the env vars for the active context exported")
+	cmd.Flags().
+		BoolVar(&contextFlags.envWait, "wait", false, "wait for the outputs with a readiness check to become ready before outputting the env vars")
+	cmd.Flags().
+		DurationVar(&contextFlags.envTimeout, "timeout", 0, "time to wait for the outputs with --wait before giving up (defaults to waiting indefinitely)")
+	return cmd
+}
+
+// waitForOutputs waits for the outputs with a readiness check in the active context, and logs the
+// outputs that are still pending whenever they change
+func waitForOutputs(pm *pkgmgr.PackageManager) {
+	var lastPending string
+	err := pm.WaitForOutputs(
+		contextFlags.envTimeout,
+		func(statuses []pkgmgr.OutputStatus) {
+			var pending []string
+			for _, status := range statuses {
+				if status.Error != nil {
+					pending = append(pending, status.Name)
+				}
+			}
+			if len(pending) == 0 || strings.Join(pending, ", ") == lastPending {
+				return
+			}
+			lastPending = strings.Join(pending, ", ")
+			slog.Debug("Waiting for outputs to become ready: " + lastPending)
+		},
+	)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func contextExportK8sCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-k8s [context name]",
+		Short: "Export installed packages in a context as Kubernetes manifests",
+		Long: `Export installed packages in a context as Kubernetes manifests
+
+The generated manifests are a starting point for running the packages on a
+cluster and should be reviewed before applying them. Secret values are not
+exported. The current context is used if none is specified.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("only one context name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			var contextName string
+			if len(args) > 0 {
+				contextName = args[0]
+			}
+			manifests, err := pm.ExportKubernetes(
+				contextName,
+				pkgmgr.KubernetesExportOptions{
+					Namespace:   contextFlags.k8sNamespace,
+					StorageSize: contextFlags.k8sStorage,
+				},
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if contextFlags.k8sOutput != "" {
+				if err := os.WriteFile(contextFlags.k8sOutput, manifests, 0o600); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				slog.Info(
+					fmt.Sprintf("Wrote Kubernetes manifests to %s", contextFlags.k8sOutput),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("path", contextFlags.k8sOutput),
 				)
+				return
 			}
+			slog.Info(
+				strings.TrimSuffix(string(manifests), "\n"),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
 		},
 	}
+	cmd.Flags().
+		StringVarP(&contextFlags.k8sOutput, "output", "o", "", "write the manifests to the specified file instead of stdout")
+	cmd.Flags().
+		StringVar(&contextFlags.k8sNamespace, "namespace", "", "namespace for the generated objects (defaults to cardano-up-<context>)")
+	cmd.Flags().
+		StringVar(&contextFlags.k8sStorage, "storage-size", "", "storage requested for each generated volume claim (defaults to 10Gi)")
 	return cmd
 }
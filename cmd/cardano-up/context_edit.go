@@ -0,0 +1,153 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+const contextEditHeader = `# Edit context %q and save the file to apply the changes, or leave it unchanged to cancel.
+# The network can't be changed once set, and the Docker host and data root can't be changed
+# while packages are installed in the context.
+`
+
+func contextEditCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "edit <context name>",
+		Short: "Edit an existing context in a text editor",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no context name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one context name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			tmpContext, ok := pm.Contexts()[args[0]]
+			if !ok {
+				slog.Error(pkgmgr.ErrContextNotExist.Error())
+				os.Exit(1)
+			}
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				slog.Error("editing a context requires a terminal, use 'context update' instead")
+				os.Exit(1)
+			}
+			content, err := contextEditContent(args[0], tmpContext)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			editedContent, err := editContent(content)
+			if err != nil {
+				slog.Error(fmt.Sprintf("failed to edit context: %s", err))
+				os.Exit(1)
+			}
+			if bytes.Equal(editedContent, content) {
+				slog.Info(fmt.Sprintf("Context %q was not changed", args[0]))
+				return
+			}
+			editedContext, err := parseContextEditContent(editedContent)
+			if err != nil {
+				slog.Error(fmt.Sprintf("failed to parse edited context: %s", err))
+				os.Exit(1)
+			}
+			if err := pm.UpdateContext(args[0], editedContext); err != nil {
+				slog.Error(fmt.Sprintf("failed to update context: %s", err))
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Updated context %q",
+					args[0],
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+}
+
+// contextEditContent returns the YAML for a context to edit, with a header explaining how to edit it
+func contextEditContent(name string, context pkgmgr.Context) ([]byte, error) {
+	contextYaml, err := yaml.Marshal(context)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf(contextEditHeader, name)), contextYaml...), nil
+}
+
+// parseContextEditContent parses an edited context. Unknown fields are rejected, to catch typos
+func parseContextEditContent(content []byte) (pkgmgr.Context, error) {
+	var ret pkgmgr.Context
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&ret); err != nil {
+		return pkgmgr.Context{}, err
+	}
+	return ret, nil
+}
+
+// editContent opens content in the user's editor and returns the edited content
+func editContent(content []byte) ([]byte, error) {
+	tmpFile, err := os.CreateTemp("", "cardano-up-context-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return nil, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, err
+	}
+	editorCmd := strings.Fields(editorCommand())
+	editor := exec.Command(editorCmd[0], append(editorCmd[1:], tmpFile.Name())...)
+	editor.Stdin = os.Stdin
+	editor.Stdout = os.Stdout
+	editor.Stderr = os.Stderr
+	if err := editor.Run(); err != nil {
+		return nil, fmt.Errorf("editor %q failed: %w", editorCmd[0], err)
+	}
+	return os.ReadFile(tmpFile.Name())
+}
+
+// editorCommand returns the editor from the VISUAL or EDITOR env vars, or a default editor for the
+// platform
+func editorCommand() string {
+	for _, envVar := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(envVar)); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
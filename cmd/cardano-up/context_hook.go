@@ -0,0 +1,78 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The hook function compares the content of the active env file against what was last loaded
+// on each prompt, and unsets/exports vars when it changes
+const bashZshHookFunc = `_cardano_up_hook() {
+  local env_content line
+  env_content="$(cat %[1]s 2>/dev/null)"
+  if [ "$env_content" != "${_CARDANO_UP_ENV-}" ]; then
+    while IFS= read -r line; do
+      [ -n "$line" ] && unset "${line%%%%=*}"
+    done <<< "${_CARDANO_UP_ENV-}"
+    while IFS= read -r line; do
+      [ -n "$line" ] && export "$line"
+    done <<< "$env_content"
+    _CARDANO_UP_ENV="$env_content"
+  fi
+}
+`
+
+const bashHookRegister = `if [[ ";${PROMPT_COMMAND[*]:-};" != *";_cardano_up_hook;"* ]]; then
+  PROMPT_COMMAND="_cardano_up_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshHookRegister = `autoload -Uz add-zsh-hook
+add-zsh-hook precmd _cardano_up_hook
+`
+
+const fishHook = `function _cardano_up_hook --on-event fish_prompt
+    set -l env_content (cat %[1]s 2>/dev/null | string collect)
+    if test "$env_content" != "$_CARDANO_UP_ENV"
+        for line in (string split \n -- "$_CARDANO_UP_ENV")
+            test -n "$line"; and set -e (string split -m 1 = -- $line)[1]
+        end
+        for line in (string split \n -- "$env_content")
+            test -n "$line"; and set -gx (string split -m 1 = -- $line)
+        end
+        set -g _CARDANO_UP_ENV "$env_content"
+    end
+end
+`
+
+func contextEnvHook(shell string, envFile string) (string, error) {
+	quotedEnvFile := shellQuote(envFile)
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(bashZshHookFunc, quotedEnvFile) + bashHookRegister, nil
+	case "zsh":
+		return fmt.Sprintf(bashZshHookFunc, quotedEnvFile) + zshHookRegister, nil
+	case "fish":
+		return fmt.Sprintf(fishHook, quotedEnvFile), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q", shell)
+	}
+}
+
+func shellQuote(val string) string {
+	return `'` + strings.ReplaceAll(val, `'`, `'\''`) + `'`
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var cpFlags = struct {
+	container string
+}{}
+
+func cpCommand() *cobra.Command {
+	cpCmd := &cobra.Command{
+		Use:   "cp <package>:<path> <local path> | <local path> <package>:<path>",
+		Short: "Copy files between a package container and the local filesystem",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("a source and destination must be provided")
+			}
+			_, _, srcPkg := parseCopyArg(args[0])
+			_, _, destPkg := parseCopyArg(args[1])
+			if srcPkg == destPkg {
+				return errors.New(
+					"exactly one of the source and destination must be a package path in the <package>:<path> format",
+				)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			srcPkgName, srcPath, srcPkg := parseCopyArg(args[0])
+			destPkgName, destPath, _ := parseCopyArg(args[1])
+			var err error
+			if srcPkg {
+				err = pm.CopyFromContainer(srcPkgName, cpFlags.container, srcPath, destPath)
+			} else {
+				err = pm.CopyToContainer(destPkgName, cpFlags.container, srcPath, destPath)
+			}
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Copied %s to %s", args[0], args[1]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+	cpCmd.Flags().
+		StringVarP(&cpFlags.container, "container", "c", "", "container in the package to copy to or from, for packages with more than one container")
+	return cpCmd
+}
+
+// parseCopyArg splits a cp argument into the package name and path, and returns whether it refers
+// to a package. Local paths containing a ':' must include a '/' before it, such as './a:b', the same
+// as with 'docker cp'. Windows drive letters aren't mistaken for package names
+func parseCopyArg(arg string) (string, string, bool) {
+	pkgName, pkgPath, ok := strings.Cut(arg, ":")
+	if !ok || len(pkgName) < 2 || strings.ContainsAny(pkgName, `/\`) {
+		return "", arg, false
+	}
+	return pkgName, pkgPath, true
+}
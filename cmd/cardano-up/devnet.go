@@ -0,0 +1,113 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var devnetFlags = struct {
+	networkMagic uint32
+	image        string
+	slotLength   time.Duration
+	epochLength  int
+}{}
+
+func devnetCommand() *cobra.Command {
+	devnetCmd := &cobra.Command{
+		Use:   "devnet",
+		Short: "Manage local devnets",
+	}
+	devnetCmd.AddCommand(
+		devnetCreateCommand(),
+		devnetResetCommand(),
+	)
+	return devnetCmd
+}
+
+func devnetCreateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create [context name]",
+		Short: "Create a local single-node devnet",
+		Long:  "Create a local single-node devnet with generated genesis files and keys in a new context (defaults to \"devnet\"), which is made active",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("only one context name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			devnetCfg := pkgmgr.DevnetConfig{
+				NetworkMagic: devnetFlags.networkMagic,
+				Image:        devnetFlags.image,
+				SlotLength:   devnetFlags.slotLength,
+				EpochLength:  devnetFlags.epochLength,
+			}
+			if len(args) > 0 {
+				devnetCfg.ContextName = args[0]
+			}
+			if err := pm.CreateDevnet(devnetCfg); err != nil {
+				slog.Error(fmt.Sprintf("failed to create devnet: %s", err))
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().
+		Uint32Var(&devnetFlags.networkMagic, "network-magic", 0, "network magic for the devnet (defaults to 42)")
+	cmd.Flags().
+		StringVar(&devnetFlags.image, "image", "", "cardano-node image used to generate the genesis files and run the node")
+	cmd.Flags().
+		DurationVar(&devnetFlags.slotLength, "slot-length", 0, "length of each slot (defaults to 100ms)")
+	cmd.Flags().
+		IntVar(&devnetFlags.epochLength, "epoch-length", 0, "number of slots in each epoch (defaults to 500)")
+	return cmd
+}
+
+func devnetResetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reset [context name]",
+		Short: "Wipe a devnet and restart it from slot 0",
+		Long:  "Wipe the chain for a devnet and restart it from slot 0, keeping the genesis files and keys. Defaults to the active context",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("only one context name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			contextName, _ := pm.CurrentContext()
+			if len(args) > 0 {
+				contextName = args[0]
+			}
+			if err := pm.ResetDevnet(contextName); err != nil {
+				slog.Error(fmt.Sprintf("failed to reset devnet: %s", err))
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Reset devnet in context %q", contextName),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+}
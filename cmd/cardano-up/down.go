@@ -11,15 +11,19 @@ func downCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "down",
 		Short: "Stops all Docker containers",
-		Long:  `Stops all running Docker containers for installed packages in the current context.`,
+		Long:  `Stops all running Docker containers for installed packages in the current context. Packages are stopped concurrently, after the packages that depend on them.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			pm := createPackageManager()
-			if err := pm.Down(); err != nil {
+			pm := createPackageManager(cmd.Context())
+			results, err := pm.Down(upDownFlags.timeout)
+			printServiceResults(results)
+			if err != nil {
 				slog.Error(err.Error())
 				os.Exit(1)
 			}
 			return nil
 		},
 	}
+	cmd.Flags().
+		DurationVar(&upDownFlags.timeout, "timeout", 0, "maximum time to wait for all packages to stop (defaults to no limit)")
 	return cmd
 }
@@ -0,0 +1,106 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var downgradeFlags = struct {
+	force bool
+	yes   bool
+}{}
+
+func downgradeCommand() *cobra.Command {
+	downgradeCmd := &cobra.Command{
+		Use:   "downgrade <package> <version>",
+		Short: "Downgrade a package to an older version",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("a package and version must be provided")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			plan, err := pm.DowngradePlan(args[0], args[1])
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			w := cmd.ErrOrStderr()
+			fmt.Fprintf(
+				w,
+				"Package %s will be downgraded (%s => %s)\n",
+				plan.Installed.InstanceName(),
+				plan.Installed.Package.Version,
+				plan.Target.Version,
+			)
+			for _, dep := range plan.Dependencies {
+				fmt.Fprintf(w, "  %s (= %s) [dependency]\n", dep.Name, dep.Version)
+			}
+			fmt.Fprintln(w)
+			interactive := term.IsTerminal(int(os.Stdin.Fd()))
+			reader := bufio.NewReader(cmd.InOrStdin())
+			force := downgradeFlags.force
+			if plan.DataIncompatible() && !force {
+				slog.Warn(
+					fmt.Sprintf(
+						"the data for version %s uses data schema version %d, but version %s uses %d and may not be able to read it",
+						plan.Installed.Package.Version,
+						plan.Installed.Package.DataSchemaVersion,
+						plan.Target.Version,
+						plan.Target.DataSchemaVersion,
+					),
+				)
+				if interactive {
+					force, err = promptYesNo(w, reader, "Downgrade anyway", false)
+					if err != nil {
+						slog.Error(err.Error())
+						os.Exit(1)
+					}
+					if !force {
+						return
+					}
+				}
+			} else if !downgradeFlags.yes && interactive {
+				confirmed, err := promptYesNo(w, reader, "Continue", false)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if !confirmed {
+					return
+				}
+			}
+			if err := pm.Downgrade(args[0], args[1], force); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	downgradeCmd.Flags().
+		BoolVarP(&downgradeFlags.force, "force", "f", false, "downgrade even if the older version may not be able to read the package data")
+	downgradeCmd.Flags().
+		BoolVarP(&downgradeFlags.yes, "yes", "y", false, "don't prompt for confirmation")
+	return downgradeCmd
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var eventsFlags = struct {
+	follow bool
+	since  string
+	json   bool
+}{}
+
+func eventsCommand() *cobra.Command {
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show container events for installed packages",
+		Long:  "Show Docker container start, stop, die, and oom events for installed packages in all contexts",
+		Run: func(cmd *cobra.Command, args []string) {
+			since, err := parseSince(eventsFlags.since)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			pm := createPackageManager(cmd.Context())
+			err = pm.ContainerEvents(
+				pkgmgr.ContainerEventActions,
+				since,
+				eventsFlags.follow,
+				printContainerEvent,
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	eventsCmd.Flags().
+		BoolVarP(&eventsFlags.follow, "follow", "f", false, "follow new events")
+	eventsCmd.Flags().
+		StringVar(&eventsFlags.since, "since", "24h", "show events since a duration ago (e.g. 30m) or an RFC3339 timestamp")
+	eventsCmd.Flags().
+		BoolVar(&eventsFlags.json, "json", false, "output events as JSON, one per line")
+	return eventsCmd
+}
+
+func printContainerEvent(evt pkgmgr.ContainerEvent) {
+	if eventsFlags.json {
+		evtJson, err := json.Marshal(evt)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		slog.Info(
+			string(evtJson),
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+		)
+		return
+	}
+	msg := fmt.Sprintf(
+		"%s  %-12s %s (= %s) %s: %s",
+		evt.Time.Local().Format(time.RFC3339),
+		fmt.Sprintf("[%s]", evt.Context),
+		evt.Package,
+		evt.Version,
+		evt.Container,
+		evt.Action,
+	)
+	if evt.ExitCode != "" {
+		msg += fmt.Sprintf(" (exit code %s)", evt.ExitCode)
+	}
+	slog.Info(
+		msg,
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+		slog.String("action", evt.Action),
+		slog.String("package", evt.Package),
+		slog.String("context", evt.Context),
+		slog.String("container", evt.Container),
+	)
+}
+
+// parseSince parses a duration before now or an RFC3339 timestamp. An empty value returns the
+// zero time
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if tmpDuration, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-tmpDuration), nil
+	}
+	tmpTime, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"invalid value for --since, expected a duration or RFC3339 timestamp: %s",
+			since,
+		)
+	}
+	return tmpTime, nil
+}
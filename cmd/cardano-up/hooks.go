@@ -0,0 +1,79 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// hookFlags are shared by the commands that run package hook scripts
+var hookFlags = struct {
+	yes     bool
+	sandbox bool
+	timeout time.Duration
+}{}
+
+func addHookFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		BoolVarP(&hookFlags.yes, "yes", "y", false, "run package hook scripts without prompting for approval")
+	cmd.Flags().
+		BoolVar(&hookFlags.sandbox, "sandbox-hooks", false, "run package hook scripts in a throwaway container rather than the host shell")
+	cmd.Flags().
+		DurationVar(&hookFlags.timeout, "hook-timeout", 0, "time to wait for a package hook script to finish before killing it (defaults to 10m)")
+}
+
+// approveHookScript shows a hook script and prompts for approval to run it. Hook scripts aren't
+// approved when stdin isn't a terminal
+func approveHookScript(script pkgmgr.HookScript) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, nil
+	}
+	fmt.Fprintf(
+		os.Stderr,
+		"Package %s from registry %s wants to run %s on this host:\n\n%s\n\n",
+		script.Package,
+		script.Registry,
+		script.Hook,
+		indentScript(script.Script),
+	)
+	return promptYesNo(
+		os.Stderr,
+		bufio.NewReader(os.Stdin),
+		"Run this script",
+		false,
+	)
+}
+
+// indentScript indents each line of a script for display
+func indentScript(script string) string {
+	return indentLines(script, "    ")
+}
+
+// indentLines adds a prefix to each line of text
+func indentLines(text string, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var importContainerFlags = struct {
+	pkg string
+}{}
+
+func importContainerCommand() *cobra.Command {
+	importContainerCmd := &cobra.Command{
+		Use:   "import-container <container name>",
+		Short: "Take over management of an existing Docker container as an installed package",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no container name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one container name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			installedPkg, err := pm.ImportContainer(args[0], importContainerFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Imported container %s as package %s (= %s) in context %q",
+					args[0],
+					installedPkg.InstanceName(),
+					installedPkg.Package.Version,
+					installedPkg.Context,
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+	importContainerCmd.Flags().
+		StringVarP(&importContainerFlags.pkg, "package", "p", "", "package to record the container as, with an optional version constraint (required)")
+	_ = importContainerCmd.MarkFlagRequired("package")
+	return importContainerCmd
+}
@@ -37,7 +37,7 @@ func infoCommand() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
 			if err := pm.Info(args[0]); err != nil {
 				slog.Error(err.Error())
 				os.Exit(1)
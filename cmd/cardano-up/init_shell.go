@@ -0,0 +1,113 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var initShellFlags = struct {
+	shell string
+	yes   bool
+}{}
+
+func initShellCommand() *cobra.Command {
+	initShellCmd := &cobra.Command{
+		Use:   "init-shell",
+		Short: "Add the bin dir for installed packages to PATH in your shell rc file",
+		Long:  "Check whether the dir that the binaries for installed packages are linked into is in PATH, and offer to add it to the rc file for your shell. Running it again doesn't add the dir twice",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			setup, err := pm.ShellPathSetup(initShellFlags.shell)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if setup.Configured {
+				slog.Info(
+					fmt.Sprintf("%s already adds %s to PATH", setup.RcFile, setup.BinDir),
+				)
+				if !setup.InPath {
+					slog.Info(
+						"Start a new shell, or run the following to update the current shell:\n\n    " + setup.Line + "\n",
+					)
+				}
+				return
+			}
+			if setup.InPath {
+				slog.Info(
+					fmt.Sprintf(
+						"%s is in PATH for the current shell, but isn't added by %s",
+						setup.BinDir,
+						setup.RcFile,
+					),
+				)
+			}
+			w := cmd.ErrOrStderr()
+			fmt.Fprintf(
+				w,
+				"The following line will be added to %s for %s:\n\n    %s\n\n",
+				setup.RcFile,
+				setup.Shell,
+				setup.Line,
+			)
+			if !initShellFlags.yes {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					slog.Info("Not changing " + setup.RcFile + ", use --yes to add the line")
+					return
+				}
+				confirmed, err := promptYesNo(
+					w,
+					bufio.NewReader(cmd.InOrStdin()),
+					"Add "+setup.BinDir+" to PATH",
+					true,
+				)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if !confirmed {
+					return
+				}
+			}
+			if err := pm.AddShellPath(setup); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Added %s to PATH in %s. Start a new shell, or run the following to update the current shell:\n\n    %s\n",
+					setup.BinDir,
+					setup.RcFile,
+					setup.Line,
+				),
+			)
+		},
+	}
+	initShellCmd.Flags().
+		StringVar(&initShellFlags.shell, "shell", "", fmt.Sprintf("shell to set up (%s). defaults to your login shell from the SHELL env var", strings.Join(pkgmgr.ShellNames(), ", ")))
+	initShellCmd.Flags().
+		BoolVarP(&initShellFlags.yes, "yes", "y", false, "add the line without prompting for confirmation")
+	return initShellCmd
+}
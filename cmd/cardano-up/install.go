@@ -15,12 +15,18 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 const (
@@ -29,19 +35,50 @@ const (
 )
 
 var installFlags = struct {
-	network string
+	network         string
+	file            string
+	instance        string
+	defaults        bool
+	adopt           bool
+	binds           []string
+	env             []string
+	configProfile   string
+	ignoreDiskSpace bool
+	skipTests       bool
 }{}
 
 func installCommand() *cobra.Command {
 	installCmd := &cobra.Command{
 		Use:   "install",
-		Short: "Install package",
+		Short: "Install packages",
 		Args: func(cmd *cobra.Command, args []string) error {
+			if planFlags.planFile != "" {
+				return checkPlanArgs(args)
+			}
+			if installFlags.file != "" {
+				if len(args) > 0 {
+					return errors.New(
+						"a package cannot be specified when using --file",
+					)
+				}
+				return nil
+			}
 			if len(args) == 0 {
 				return errors.New("no package provided")
 			}
 			if len(args) > 1 {
-				return errors.New("only one package may be specified at a time")
+				if installFlags.instance != "" {
+					return errors.New(
+						"only one package may be specified when using --as",
+					)
+				}
+				for _, arg := range args {
+					if isLocalPackagePath(arg) {
+						return errors.New(
+							"a local package must be installed on its own",
+						)
+					}
+				}
 			}
 			return nil
 		},
@@ -49,12 +86,50 @@ func installCommand() *cobra.Command {
 	}
 	installCmd.Flags().
 		StringVarP(&installFlags.network, "network", "n", "", fmt.Sprintf("specifies network for package (defaults to %q for empty context)", defaultNetwork))
+	installCmd.Flags().
+		StringVarP(&installFlags.file, "file", "f", "", "install package from a local package file or directory instead of the registry")
+	installCmd.Flags().
+		StringVar(&installFlags.instance, "as", "", "install an additional instance of the package with the given instance name")
+	installCmd.Flags().
+		BoolVar(&installFlags.defaults, "defaults", false, "install the default members of a meta-package without prompting")
+	installCmd.Flags().
+		BoolVar(&installFlags.adopt, "adopt", false, "adopt existing containers with the expected names if they match the package, rather than failing")
+	installCmd.Flags().
+		StringArrayVar(&installFlags.binds, "bind", nil, "bind mount in HOST:CONTAINER[:OPTIONS] format, replacing the package bind mount for the same container path. this is kept on upgrade (can be repeated)")
+	installCmd.Flags().
+		StringArrayVar(&installFlags.env, "env", nil, "env var in KEY=VALUE format for the package containers, overriding the package env var with the same name. this is kept on upgrade (can be repeated)")
+	installCmd.Flags().
+		StringVar(&installFlags.configProfile, "config-profile", "", fmt.Sprintf("built-in config profile for node settings such as tracing, ledger snapshots, and P2P (%s). this is kept on upgrade (defaults to %q)", strings.Join(pkgmgr.ConfigProfileNames(), ", "), pkgmgr.ConfigProfileDefault))
+	installCmd.Flags().
+		BoolVar(&installFlags.ignoreDiskSpace, "ignore-disk-space", false, "install even when there isn't enough free disk space for the package data or images")
+	installCmd.Flags().
+		BoolVar(&installFlags.skipTests, "skip-tests", false, "don't run the package tests after installing")
+	addHookFlags(installCmd)
+	addPlanFlags(installCmd)
 	return installCmd
 }
 
+// isLocalPackagePath returns whether the install argument refers to a package file or directory on disk
+func isLocalPackagePath(arg string) bool {
+	if arg == "." || strings.ContainsRune(arg, '/') ||
+		strings.ContainsRune(arg, filepath.Separator) {
+		return true
+	}
+	ext := filepath.Ext(arg)
+	return ext == ".yaml" || ext == ".yml"
+}
+
 func installCommandRun(cmd *cobra.Command, args []string) {
-	pm := createPackageManager()
-	activeContextName, activeContext := pm.ActiveContext()
+	pm := createPackageManager(cmd.Context())
+	if planFlags.planFile != "" {
+		applyPlanFile(pm, pkgmgr.PlanCommandInstall)
+		return
+	}
+	activeContextName, activeContext := pm.CurrentContext()
+	if planFlags.dryRun {
+		installDryRun(cmd, pm, args)
+		return
+	}
 	// Update context network if specified
 	if installFlags.network != "" {
 		activeContext.Network = installFlags.network
@@ -85,8 +160,159 @@ func installCommandRun(cmd *cobra.Command, args []string) {
 		)
 	}
 	// Install requested package
-	if err := pm.Install(args[0]); err != nil {
+	if installFlags.file != "" {
+		if err := pm.InstallLocal(installFlags.file, installFlags.instance); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if isLocalPackagePath(args[0]) {
+		if err := pm.InstallLocal(args[0], installFlags.instance); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	var pkgSpecs []string
+	for _, arg := range args {
+		pkgSpec, err := selectGroupMembers(cmd, pm, arg)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		pkgSpecs = append(pkgSpecs, pkgSpec)
+	}
+	if installFlags.instance != "" {
+		if err := pm.InstallInstance(pkgSpecs[0], installFlags.instance); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	// Multiple packages are resolved together, so that shared dependencies are only installed once
+	if err := pm.Install(pkgSpecs...); err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
+
+// installDryRun shows what installing the packages will do. The context isn't changed, so the
+// context network must already be set
+func installDryRun(cmd *cobra.Command, pm *pkgmgr.PackageManager, args []string) {
+	_, activeContext := pm.CurrentContext()
+	if installFlags.network != "" && installFlags.network != activeContext.Network {
+		slog.Error(
+			"--network can't change the context network with --dry-run, set it with 'context update' first",
+		)
+		os.Exit(1)
+	}
+	req := pkgmgr.PlanRequest{
+		Instance:      installFlags.instance,
+		Binds:         installFlags.binds,
+		Env:           installFlags.env,
+		ConfigProfile: installFlags.configProfile,
+	}
+	if installFlags.file != "" {
+		req.Path = installFlags.file
+	} else if isLocalPackagePath(args[0]) {
+		req.Path = args[0]
+	} else {
+		for _, arg := range args {
+			pkgSpec, err := selectGroupMembers(cmd, pm, arg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			req.Packages = append(req.Packages, pkgSpec)
+		}
+	}
+	showPlan(cmd, pm, pkgmgr.PlanCommandInstall, req)
+}
+
+// selectGroupMembers prompts for the optional members of a meta-package when running in a
+// terminal, and returns the package spec with the options for the selected members. Options that
+// are already specified in the package spec skip the prompts
+func selectGroupMembers(
+	cmd *cobra.Command,
+	pm *pkgmgr.PackageManager,
+	pkgSpec string,
+) (string, error) {
+	if installFlags.defaults || strings.Contains(pkgSpec, "[") ||
+		!term.IsTerminal(int(os.Stdin.Fd())) {
+		return pkgSpec, nil
+	}
+	pkg, err := pm.AvailablePackage(pkgSpec)
+	if err != nil {
+		return "", err
+	}
+	groupOpts := pkg.GroupOptions()
+	if len(groupOpts) == 0 {
+		return pkgSpec, nil
+	}
+	fmt.Fprintf(
+		cmd.ErrOrStderr(),
+		"Package %s has optional members\n",
+		pkg.Name,
+	)
+	reader := bufio.NewReader(cmd.InOrStdin())
+	var optFlags []string
+	for _, opt := range groupOpts {
+		var deps []string
+		for _, dep := range opt.Dependencies {
+			deps = append(deps, dep.String())
+		}
+		prompt := fmt.Sprintf("Install %s", strings.Join(deps, ", "))
+		if opt.Description != "" {
+			prompt += fmt.Sprintf(" (%s)", opt.Description)
+		}
+		// Only boolean options can install additional packages
+		defaultVal, _ := opt.Default.(bool)
+		selected, err := promptYesNo(cmd.ErrOrStderr(), reader, prompt, defaultVal)
+		if err != nil {
+			return "", err
+		}
+		if selected {
+			optFlags = append(optFlags, opt.Name)
+		} else {
+			optFlags = append(optFlags, "-"+opt.Name)
+		}
+	}
+	// Options go between the package name and any version spec
+	optsSpec := "[" + strings.Join(optFlags, ",") + "]"
+	if idx := strings.IndexAny(pkgSpec, ` <>=~!`); idx > 0 {
+		return pkgSpec[:idx] + optsSpec + pkgSpec[idx:], nil
+	}
+	return pkgSpec + optsSpec, nil
+}
+
+// promptYesNo asks a yes/no question, returning the default for an empty answer
+func promptYesNo(
+	w io.Writer,
+	reader *bufio.Reader,
+	prompt string,
+	defaultVal bool,
+) (bool, error) {
+	choices := "[y/N]"
+	if defaultVal {
+		choices = "[Y/n]"
+	}
+	for {
+		fmt.Fprintf(w, "%s? %s ", prompt, choices)
+		answer, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return defaultVal, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return defaultVal, nil
+		}
+	}
+}
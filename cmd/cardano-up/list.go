@@ -15,55 +15,116 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
+	"strings"
 
+	"github.com/blinklabs-io/cardano-up/internal/table"
 	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
 var listFlags = struct {
-	all bool
+	all              bool
+	installedMarkers bool
+	tags             []string
+	anyTag           bool
+	manifest         bool
+	verify           string
 }{}
 
 func listAvailableCommand() *cobra.Command {
-	return &cobra.Command{
+	listAvailableCmd := &cobra.Command{
 		Use:   "list-available",
 		Short: "List available packages",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			packages := pm.AvailablePackages()
+			pm := createPackageManager(cmd.Context())
+			statuses := pm.AvailablePackageStatuses()
 			slog.Info("Available packages:\n")
-			slog.Info(
-				fmt.Sprintf(
-					"%-20s %-12s %s",
-					"Name",
-					"Version",
-					"Description",
-				),
-			)
-			for _, tmpPackage := range packages {
-				slog.Info(
-					fmt.Sprintf(
-						"%-20s %-12s %s",
-						tmpPackage.Name,
-						tmpPackage.Version,
-						tmpPackage.Description,
-					),
+			var tbl *table.Table
+			if listFlags.installedMarkers {
+				tbl = newTable("Name", "Version", "Status", "Description")
+				tbl.SetColumnColor(
+					2,
+					func(value string) table.Color {
+						if value == "upgrade" {
+							return table.ColorYellow
+						}
+						return table.ColorGreen
+					},
+				)
+			} else {
+				tbl = newTable("Name", "Version", "Description")
+			}
+			var listPkgs []pkgmgr.Package
+			var rowAttrs [][]any
+			for _, status := range statuses {
+				tmpPackage := status.Package
+				if !tmpPackage.MatchesTags(listFlags.tags, listFlags.anyTag) {
+					continue
+				}
+				description := tmpPackage.Description
+				if tmpPackage.IsDeprecated() {
+					description = "[deprecated] " + description
+				}
+				attrs := []any{
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("name", tmpPackage.Name),
+					slog.String("version", tmpPackage.Version),
+				}
+				if listFlags.installedMarkers {
+					var statusOutput string
+					if status.Installed() {
+						statusOutput = "installed"
+					} else if status.IsUpgrade() {
+						statusOutput = "upgrade"
+					}
+					tbl.AddRow(tmpPackage.Name, tmpPackage.Version, statusOutput, description)
+					attrs = append(
+						attrs,
+						slog.Bool("installed", status.Installed()),
+						slog.Bool("upgrade", status.IsUpgrade()),
+					)
+				} else {
+					tbl.AddRow(tmpPackage.Name, tmpPackage.Version, description)
+				}
+				listPkgs = append(listPkgs, tmpPackage)
+				rowAttrs = append(
+					rowAttrs,
+					append(attrs, slog.Bool("deprecated", tmpPackage.IsDeprecated())),
 				)
+			}
+			// Each package is followed by its dependencies, so the table is output a line at a time
+			lines := tbl.Lines()
+			slog.Info(lines[0])
+			for idx, line := range lines[1:] {
+				slog.Info(line, rowAttrs[idx]...)
+				tmpPackage := listPkgs[idx]
 				if len(tmpPackage.Dependencies) > 0 {
-					tmpOutput := "    Requires: "
-					for idx, dep := range tmpPackage.Dependencies {
-						tmpOutput += dep
-						if idx < len(tmpPackage.Dependencies)-1 {
-							tmpOutput += ` | `
-						}
+					var deps []string
+					for _, dep := range tmpPackage.Dependencies {
+						deps = append(deps, dep.String())
 					}
-					slog.Info(tmpOutput)
+					slog.Info(
+						"    Requires: "+strings.Join(deps, " | "),
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("name", tmpPackage.Name),
+						slog.String("version", tmpPackage.Version),
+						slog.Any("dependencies", deps),
+					)
 				}
 			}
 		},
 	}
+	listAvailableCmd.Flags().
+		BoolVar(&listFlags.installedMarkers, "installed-markers", false, "mark packages installed in the active context and newer versions of them")
+	listAvailableCmd.Flags().
+		StringSliceVar(&listFlags.tags, "tag", nil, "only list packages with the specified tag (can be specified multiple times)")
+	listAvailableCmd.Flags().
+		BoolVar(&listFlags.anyTag, "any-tag", false, "list packages with any of the specified tags, rather than all of them")
+	return listAvailableCmd
 }
 
 func listCommand() *cobra.Command {
@@ -71,43 +132,191 @@ func listCommand() *cobra.Command {
 		Use:   "list",
 		Short: "List installed packages",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			activeContextName, _ := pm.ActiveContext()
-			var packages []pkgmgr.InstalledPackage
+			pm := createPackageManager(cmd.Context())
+			if listFlags.manifest {
+				listManifest(pm)
+				return
+			}
+			if listFlags.verify != "" {
+				verifyManifest(pm, listFlags.verify)
+				return
+			}
+			activeContextName, _ := pm.CurrentContext()
+			statuses := pm.InstalledPackageStatuses(listFlags.all)
 			if listFlags.all {
-				packages = pm.InstalledPackagesAllContexts()
 				slog.Info("Installed packages (all contexts):\n")
 			} else {
-				packages = pm.InstalledPackages()
 				slog.Info(fmt.Sprintf("Installed packages (from context %q):\n", activeContextName))
 			}
-			if len(packages) > 0 {
-				slog.Info(
-					fmt.Sprintf(
-						"%-20s %-12s %-15s %s",
-						"Name",
-						"Version",
-						"Context",
-						"Description",
-					),
+			if len(statuses) > 0 {
+				tbl := newTable("Name", "Version", "Context", "Status", "Description")
+				tbl.SetColumnColor(
+					3,
+					func(value string) table.Color {
+						return table.ColorYellow
+					},
 				)
-				for _, tmpPackage := range packages {
-					slog.Info(
-						fmt.Sprintf(
-							"%-20s %-12s %-15s %s",
-							tmpPackage.Package.Name,
-							tmpPackage.Package.Version,
-							tmpPackage.Context,
-							tmpPackage.Package.Description,
-						),
+				var rowAttrs [][]any
+				hasPendingNotes := false
+				for _, status := range statuses {
+					tmpPackage := status.Installed
+					var statusOutput string
+					if status.UpgradeAvailable() {
+						statusOutput = fmt.Sprintf("upgrade available (%s)", status.LatestVersion)
+					}
+					pendingNotes := len(tmpPackage.PendingNotes())
+					if pendingNotes > 0 {
+						hasPendingNotes = true
+						if statusOutput != "" {
+							statusOutput += ", "
+						}
+						statusOutput += fmt.Sprintf("%d action item(s)", pendingNotes)
+					}
+					tbl.AddRow(
+						tmpPackage.InstanceName(),
+						tmpPackage.Package.Version,
+						tmpPackage.Context,
+						statusOutput,
+						tmpPackage.Package.Description,
+					)
+					rowAttrs = append(
+						rowAttrs,
+						[]any{
+							pkgmgr.EventAttr(pkgmgr.EventResult),
+							slog.String("name", tmpPackage.InstanceName()),
+							slog.String("version", tmpPackage.Package.Version),
+							slog.String("context", tmpPackage.Context),
+							slog.String("latestVersion", status.LatestVersion),
+							slog.Bool("upgradeAvailable", status.UpgradeAvailable()),
+							slog.Int("pendingNotes", pendingNotes),
+						},
+					)
+				}
+				logTable(tbl, rowAttrs)
+				if hasPendingNotes {
+					slog.Warn(
+						"some packages have unacknowledged action items, see 'cardano-up notes'",
 					)
 				}
 			} else {
-				slog.Info(`No packages installed`)
+				slog.Info(
+					`No packages installed`,
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
 			}
 		},
 	}
 	listCmd.Flags().
 		BoolVarP(&listFlags.all, "all", "A", false, "show packages from all contexts (defaults to only active context)")
+	listCmd.Flags().
+		BoolVar(&listFlags.manifest, "manifest", false, "output a JSON manifest of the installed packages, including image digests and file hashes, for auditing")
+	listCmd.Flags().
+		StringVar(&listFlags.verify, "verify", "", "verify the installed packages against a manifest file from --manifest")
+	listCmd.MarkFlagsMutuallyExclusive("manifest", "verify")
 	return listCmd
 }
+
+func listManifest(pm *pkgmgr.PackageManager) {
+	manifest, err := pm.InstalledManifest(listFlags.all)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	slog.Info(
+		string(manifestJson),
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+	)
+}
+
+func verifyManifest(pm *pkgmgr.PackageManager, manifestPath string) {
+	manifestJson, err := os.ReadFile(manifestPath)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	var manifest pkgmgr.InstalledManifest
+	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+		slog.Error(fmt.Sprintf("failed to parse manifest %s: %s", manifestPath, err))
+		os.Exit(1)
+	}
+	mismatches, err := pm.VerifyManifest(manifest)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if len(mismatches) == 0 {
+		slog.Info(
+			"Installed packages match the manifest",
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+		)
+		return
+	}
+	for _, mismatch := range mismatches {
+		slog.Info(
+			mismatch,
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+			slog.String("mismatch", mismatch),
+		)
+	}
+	slog.Error(
+		fmt.Sprintf(
+			"installed packages do not match the manifest (%d differences)",
+			len(mismatches),
+		),
+	)
+	os.Exit(1)
+}
+
+func outdatedCommand() *cobra.Command {
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "List installed packages with upgrades available",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			statuses := pm.OutdatedPackages(listFlags.all)
+			if len(statuses) == 0 {
+				slog.Info(
+					"All installed packages are up to date",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			tbl := newTable("Name", "Installed", "Latest", "Context")
+			tbl.SetColumnColor(
+				2,
+				func(value string) table.Color {
+					return table.ColorGreen
+				},
+			)
+			var rowAttrs [][]any
+			for _, status := range statuses {
+				tbl.AddRow(
+					status.Installed.InstanceName(),
+					status.Installed.Package.Version,
+					status.LatestVersion,
+					status.Installed.Context,
+				)
+				rowAttrs = append(
+					rowAttrs,
+					[]any{
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("name", status.Installed.InstanceName()),
+						slog.String("version", status.Installed.Package.Version),
+						slog.String("latestVersion", status.LatestVersion),
+						slog.String("context", status.Installed.Context),
+					},
+				)
+			}
+			logTable(tbl, rowAttrs)
+			slog.Info("\nUse 'cardano-up upgrade <package>' to upgrade a package")
+		},
+	}
+	outdatedCmd.Flags().
+		BoolVarP(&listFlags.all, "all", "A", false, "show packages from all contexts (defaults to only active context)")
+	return outdatedCmd
+}
@@ -19,30 +19,48 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
 var logsFlags = struct {
-	follow bool
-	tail   string
+	follow     bool
+	tail       string
+	timestamps bool
+	since      string
+	until      string
+	grep       string
 }{}
 
 func logsCommand() *cobra.Command {
 	logsCmd := &cobra.Command{
-		Use:   "logs",
-		Short: "Show logs for an installed package",
+		Use:   "logs [package]",
+		Short: "Show logs for an installed package, or all packages in the context",
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
-				return errors.New("no package provided")
-			}
 			if len(args) > 1 {
 				return errors.New("only one package may be specified at a time")
 			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			if err := pm.Logs(args[0], logsFlags.follow, logsFlags.tail, os.Stdout, os.Stderr); err != nil {
+			pm := createPackageManager(cmd.Context())
+			opts := pkgmgr.LogsOptions{
+				Follow:     logsFlags.follow,
+				Tail:       logsFlags.tail,
+				Timestamps: logsFlags.timestamps,
+				Since:      logsFlags.since,
+				Until:      logsFlags.until,
+				Grep:       logsFlags.grep,
+			}
+			// Show the logs for all services in the context when no package is specified
+			if len(args) == 0 {
+				if err := pm.ContextLogs(opts, os.Stdout, os.Stderr); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				return
+			}
+			if err := pm.Logs(args[0], opts, os.Stdout, os.Stderr); err != nil {
 				slog.Error(err.Error())
 				os.Exit(1)
 			}
@@ -52,5 +70,28 @@ func logsCommand() *cobra.Command {
 		StringVarP(&logsFlags.tail, "tail", "n", "", "display at most X lines from the end of the log")
 	logsCmd.Flags().
 		BoolVarP(&logsFlags.follow, "follow", "f", false, "follow log output")
+	logsCmd.Flags().
+		BoolVarP(&logsFlags.timestamps, "timestamps", "t", false, "show timestamps")
+	logsCmd.Flags().
+		StringVar(&logsFlags.since, "since", "", "show logs since a timestamp (e.g. 2024-06-01T12:00:00Z) or relative duration (e.g. 1h)")
+	logsCmd.Flags().
+		StringVar(&logsFlags.until, "until", "", "show logs before a timestamp (e.g. 2024-06-01T12:00:00Z) or relative duration (e.g. 30m)")
+	logsCmd.Flags().
+		StringVar(&logsFlags.grep, "grep", "", "only show log lines matching a regular expression")
 	return logsCmd
 }
+
+func collectLogsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "collect-logs",
+		Short: "Stream container logs for installed packages to rotating files",
+		Long:  "Stream logs for containers of installed packages in all contexts with log persistence enabled to rotating files, picking up new containers as they're started",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.CollectContainerLogs(); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -15,25 +15,44 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/blinklabs-io/cardano-up/internal/consolelog"
+	"github.com/blinklabs-io/cardano-up/internal/table"
 	"github.com/blinklabs-io/cardano-up/pkgmgr"
 
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 const (
 	programName = "cardano-up"
 )
 
-func main() {
-	globalFlags := struct {
-		debug bool
-	}{}
+var globalFlags = struct {
+	debug        bool
+	quiet        bool
+	jsonLog      bool
+	noColor      bool
+	stopTimeout  time.Duration
+	wait         bool
+	requiredTags []string
+	profile      string
+	context      string
+	offline      bool
+}{}
 
+func main() {
 	rootCmd := &cobra.Command{
 		Use: programName,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
@@ -43,47 +62,179 @@ func main() {
 				logLevel = slog.LevelDebug
 			}
 			logger := slog.New(
-				consolelog.NewHandler(os.Stdout, &slog.HandlerOptions{
-					Level: logLevel,
+				consolelog.NewHandler(os.Stdout, &consolelog.HandlerOptions{
+					Level:   logLevel,
+					Quiet:   globalFlags.quiet,
+					Json:    globalFlags.jsonLog,
+					NoColor: noColor(),
 				}),
 			)
 			slog.SetDefault(logger)
+			startTelemetry(cmd)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			submitTelemetry()
 		},
 	}
 
 	// Global flags
 	rootCmd.PersistentFlags().
 		BoolVarP(&globalFlags.debug, "debug", "D", false, "enable debug logging")
+	rootCmd.PersistentFlags().
+		BoolVarP(&globalFlags.quiet, "quiet", "q", false, "only output results, warnings, and errors")
+	rootCmd.PersistentFlags().
+		BoolVar(&globalFlags.jsonLog, "json-log", false, "output structured JSON log lines with event types")
+	rootCmd.PersistentFlags().
+		BoolVar(&globalFlags.noColor, "no-color", false, "disable colored output")
+	rootCmd.PersistentFlags().
+		DurationVar(&globalFlags.stopTimeout, "stop-timeout", 0, "time to wait for containers to stop before killing them, for packages that don't specify their own (defaults to 60s)")
+	rootCmd.PersistentFlags().
+		BoolVar(&globalFlags.wait, "wait", false, "wait for another cardano-up operation in progress to finish, rather than failing")
+	rootCmd.PersistentFlags().
+		StringSliceVar(&globalFlags.requiredTags, "required-tags", nil, "tags that packages must have to be available, overriding the defaults for this platform (docker, OS, and architecture)")
+	rootCmd.PersistentFlags().
+		StringVar(&globalFlags.profile, "profile", "", "use a separate named installation with its own config, cache, data, and bin dirs")
+	rootCmd.PersistentFlags().
+		StringVar(&globalFlags.context, "context", "", "run the command against the specified context, rather than the active context")
+	rootCmd.PersistentFlags().
+		BoolVar(&globalFlags.offline, "offline", false, "never access the network, and only use the cached package registry")
 
 	// Add subcommands
 	rootCmd.AddCommand(
+		attachCommand(),
+		cliCommand(),
 		contextCommand(),
+		devnetCommand(),
 		versionCommand(),
 		listCommand(),
 		listAvailableCommand(),
+		outdatedCommand(),
 		logsCommand(),
+		collectLogsCommand(),
+		cpCommand(),
 		infoCommand(),
 		installCommand(),
+		importContainerCommand(),
+		initShellCommand(),
 		uninstallCommand(),
 		upCommand(),
 		downCommand(),
+		downgradeCommand(),
+		eventsCommand(),
+		monitorCommand(),
+		topologyCommand(),
+		nettestCommand(),
+		notesCommand(),
+		portsCommand(),
+		postgresCommand(),
+		secretCommand(),
+		setEnvCommand(),
+		spoCommand(),
+		telemetryCommand(),
+		testCommand(),
 		updateCommand(),
 		upgradeCommand(),
 		validateCommand(),
+		verifyCommand(),
+		walletCommand(),
+		watchCommand(),
+		whyCommand(),
+		xCommand(),
+		schemaCommand(),
+		packageCommand(),
+	)
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
 	)
+	defer stop()
 
-	if err := rootCmd.Execute(); err != nil {
+	// The context is cancelled when the program receives SIGINT or SIGTERM, and is available to
+	// subcommands via cmd.Context()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		// NOTE: we purposely don't display the error, since cobra will have already displayed it
+		stop()
 		os.Exit(1)
 	}
 }
 
-func createPackageManager() *pkgmgr.PackageManager {
-	cfg, err := pkgmgr.NewDefaultConfig()
+// offlineMode returns whether network access is disabled via the OFFLINE env var or the
+// --offline flag
+func offlineMode() (bool, error) {
+	if globalFlags.offline {
+		return true, nil
+	}
+	if offline, ok := os.LookupEnv("OFFLINE"); ok {
+		tmpOffline, err := strconv.ParseBool(offline)
+		if err != nil {
+			return false, fmt.Errorf("invalid value for OFFLINE: %s", err)
+		}
+		return tmpOffline, nil
+	}
+	return false, nil
+}
+
+func createPackageManager(ctx context.Context) *pkgmgr.PackageManager {
+	cfg, err := pkgmgr.NewProfileConfig(globalFlags.profile)
 	if err != nil {
 		slog.Error(fmt.Sprintf("failed to create package manager: %s", err))
 		os.Exit(1)
 	}
+	cfg.Context = ctx
+	if globalFlags.stopTimeout > 0 {
+		cfg.StopTimeout = globalFlags.stopTimeout
+	}
+	cfg.WaitForLock = globalFlags.wait
+	cfg.Color = useColor()
+	// These are only set by the install command
+	cfg.AdoptContainers = installFlags.adopt
+	cfg.BindOverrides = installFlags.binds
+	cfg.EnvOverrides = installFlags.env
+	cfg.ConfigProfile = installFlags.configProfile
+	cfg.IgnoreDiskSpace = installFlags.ignoreDiskSpace
+	// This is only set by the upgrade command
+	cfg.UpgradeHealthTimeout = upgradeFlags.healthTimeout
+	// This is set by the install and upgrade commands
+	cfg.SkipTests = installFlags.skipTests || upgradeFlags.skipTests
+	// These are only set by the commands that run hook scripts
+	cfg.Hooks.TrustAll = hookFlags.yes
+	cfg.Hooks.Sandbox = hookFlags.sandbox
+	cfg.Hooks.Approve = approveHookScript
+	// Allow trusting the hook scripts from registries and sandboxing them via env vars
+	if registries, ok := os.LookupEnv("TRUSTED_HOOK_REGISTRIES"); ok {
+		cfg.Hooks.TrustedRegistries = splitTags(registries)
+	}
+	if sandbox, ok := os.LookupEnv("HOOK_SANDBOX"); ok {
+		tmpSandbox, err := strconv.ParseBool(sandbox)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for HOOK_SANDBOX: %s", err))
+			os.Exit(1)
+		}
+		cfg.Hooks.Sandbox = cfg.Hooks.Sandbox || tmpSandbox
+	}
+	if image, ok := os.LookupEnv("HOOK_SANDBOX_IMAGE"); ok {
+		cfg.Hooks.SandboxImage = image
+	}
+	if timeout, ok := os.LookupEnv("HOOK_TIMEOUT"); ok {
+		tmpTimeout, err := time.ParseDuration(timeout)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for HOOK_TIMEOUT: %s", err))
+			os.Exit(1)
+		}
+		cfg.Hooks.Timeout = tmpTimeout
+	}
+	if hookFlags.timeout > 0 {
+		cfg.Hooks.Timeout = hookFlags.timeout
+	}
+	// Allow overriding the tags required for available packages via env var or flag
+	if tags, ok := os.LookupEnv("REQUIRED_PACKAGE_TAGS"); ok {
+		cfg.RequiredPackageTags = splitTags(tags)
+	}
+	if globalFlags.requiredTags != nil {
+		cfg.RequiredPackageTags = splitTags(strings.Join(globalFlags.requiredTags, ","))
+	}
 	// Allow setting registry URL/dir via env var
 	if url, ok := os.LookupEnv("REGISTRY_URL"); ok {
 		cfg.RegistryUrl = url
@@ -91,10 +242,196 @@ func createPackageManager() *pkgmgr.PackageManager {
 	if dir, ok := os.LookupEnv("REGISTRY_DIR"); ok {
 		cfg.RegistryDir = dir
 	}
+	// Allow requiring a fresh registry rather than refreshing a stale one in the background
+	if strict, ok := os.LookupEnv("REGISTRY_STRICT_FRESHNESS"); ok {
+		tmpStrict, err := strconv.ParseBool(strict)
+		if err != nil {
+			slog.Error(
+				fmt.Sprintf("invalid value for REGISTRY_STRICT_FRESHNESS: %s", err),
+			)
+			os.Exit(1)
+		}
+		cfg.RegistryStrictFreshness = tmpStrict
+	}
+	cfg.RegistryRefresh = refreshRegistryBackground
+	cfg.Offline, err = offlineMode()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if keyFile, ok := os.LookupEnv("SECRETS_KEY_FILE"); ok {
+		cfg.SecretsKeyFile = keyFile
+	}
+	// Allow setting registry credentials via env vars
+	if username, ok := os.LookupEnv("REGISTRY_USERNAME"); ok {
+		cfg.RegistryAuth.Username = username
+	}
+	if password, ok := os.LookupEnv("REGISTRY_PASSWORD"); ok {
+		cfg.RegistryAuth.Password = password
+	}
+	if token, ok := os.LookupEnv("REGISTRY_TOKEN"); ok {
+		cfg.RegistryAuth.Token = token
+	}
+	// Allow configuring HTTP client via env vars
+	if proxyUrl, ok := os.LookupEnv("HTTP_PROXY_URL"); ok {
+		cfg.Http.ProxyUrl = proxyUrl
+	}
+	if caBundle, ok := os.LookupEnv("HTTP_CA_BUNDLE"); ok {
+		cfg.Http.CaBundle = caBundle
+	}
+	if timeout, ok := os.LookupEnv("HTTP_TIMEOUT"); ok {
+		tmpTimeout, err := time.ParseDuration(timeout)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for HTTP_TIMEOUT: %s", err))
+			os.Exit(1)
+		}
+		cfg.Http.Timeout = tmpTimeout
+	}
+	if retries, ok := os.LookupEnv("HTTP_RETRIES"); ok {
+		tmpRetries, err := strconv.Atoi(retries)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for HTTP_RETRIES: %s", err))
+			os.Exit(1)
+		}
+		cfg.Http.Retries = tmpRetries
+	}
+	if backoff, ok := os.LookupEnv("HTTP_RETRY_BACKOFF"); ok {
+		tmpBackoff, err := time.ParseDuration(backoff)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for HTTP_RETRY_BACKOFF: %s", err))
+			os.Exit(1)
+		}
+		cfg.Http.RetryBackoff = tmpBackoff
+	}
+	// Allow configuring retries for Docker operations via env vars
+	if retries, ok := os.LookupEnv("DOCKER_RETRIES"); ok {
+		tmpRetries, err := strconv.Atoi(retries)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for DOCKER_RETRIES: %s", err))
+			os.Exit(1)
+		}
+		cfg.DockerRetry.Retries = tmpRetries
+	}
+	if backoff, ok := os.LookupEnv("DOCKER_RETRY_BACKOFF"); ok {
+		tmpBackoff, err := time.ParseDuration(backoff)
+		if err != nil {
+			slog.Error(fmt.Sprintf("invalid value for DOCKER_RETRY_BACKOFF: %s", err))
+			os.Exit(1)
+		}
+		cfg.DockerRetry.Backoff = tmpBackoff
+	}
+	// Allow configuring container log persistence via env vars
+	if persist, ok := os.LookupEnv("CONTAINER_LOGS_PERSIST"); ok {
+		tmpPersist, err := strconv.ParseBool(persist)
+		if err != nil {
+			slog.Error(
+				fmt.Sprintf("invalid value for CONTAINER_LOGS_PERSIST: %s", err),
+			)
+			os.Exit(1)
+		}
+		cfg.ContainerLogs.Persist = tmpPersist
+	}
+	if maxSize, ok := os.LookupEnv("CONTAINER_LOGS_MAX_SIZE"); ok {
+		tmpMaxSize, err := units.RAMInBytes(maxSize)
+		if err != nil {
+			slog.Error(
+				fmt.Sprintf("invalid value for CONTAINER_LOGS_MAX_SIZE: %s", err),
+			)
+			os.Exit(1)
+		}
+		cfg.ContainerLogs.MaxSize = tmpMaxSize
+	}
+	if maxFiles, ok := os.LookupEnv("CONTAINER_LOGS_MAX_FILES"); ok {
+		tmpMaxFiles, err := strconv.Atoi(maxFiles)
+		if err != nil {
+			slog.Error(
+				fmt.Sprintf("invalid value for CONTAINER_LOGS_MAX_FILES: %s", err),
+			)
+			os.Exit(1)
+		}
+		cfg.ContainerLogs.MaxFiles = tmpMaxFiles
+	}
+	if maxAge, ok := os.LookupEnv("CONTAINER_LOGS_MAX_AGE"); ok {
+		tmpMaxAge, err := time.ParseDuration(maxAge)
+		if err != nil {
+			slog.Error(
+				fmt.Sprintf("invalid value for CONTAINER_LOGS_MAX_AGE: %s", err),
+			)
+			os.Exit(1)
+		}
+		cfg.ContainerLogs.MaxAge = tmpMaxAge
+	}
 	pm, err := pkgmgr.NewPackageManager(cfg)
 	if err != nil {
 		slog.Error(fmt.Sprintf("failed to create package manager: %s", err))
 		os.Exit(1)
 	}
+	if globalFlags.context != "" {
+		pm, err = pm.ForContext(globalFlags.context)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to use context %q: %s", globalFlags.context, err))
+			os.Exit(1)
+		}
+	}
 	return pm
 }
+
+// noColor returns whether colored output is disabled via the --no-color flag or the NO_COLOR env var
+func noColor() bool {
+	return globalFlags.noColor || os.Getenv("NO_COLOR") != ""
+}
+
+// useColor returns whether to use colored table output, which is only done when writing to a
+// terminal
+func useColor() bool {
+	return !noColor() && !globalFlags.jsonLog && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// newTable returns a table for command output, with color enabled when supported
+func newTable(headers ...string) *table.Table {
+	ret := table.New(headers...)
+	ret.Color = useColor()
+	return ret
+}
+
+// logTable outputs a table a line at a time, with the attributes for each row logged along with
+// its line
+func logTable(tbl *table.Table, rowAttrs [][]any) {
+	lines := tbl.Lines()
+	slog.Info(lines[0])
+	for idx, line := range lines[1:] {
+		slog.Info(line, rowAttrs[idx]...)
+	}
+}
+
+// splitTags splits a comma-separated list of tags, ignoring empty values
+func splitTags(tags string) []string {
+	ret := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+// refreshRegistryBackground runs the update command in a separate process to refresh the stale
+// registry cache, so that it can finish after this process exits
+func refreshRegistryBackground() {
+	executable, err := os.Executable()
+	if err != nil {
+		slog.Debug(fmt.Sprintf("failed to refresh package registry: %s", err))
+		return
+	}
+	args := []string{"update", "--background"}
+	if globalFlags.profile != "" {
+		args = append(args, "--profile", globalFlags.profile)
+	}
+	cmd := exec.Command(executable, args...)
+	if err := cmd.Start(); err != nil {
+		slog.Debug(fmt.Sprintf("failed to refresh package registry: %s", err))
+		return
+	}
+	_ = cmd.Process.Release()
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var monitorFlags = struct {
+	hookCommand string
+	webhookUrl  string
+}{}
+
+func monitorCommand() *cobra.Command {
+	monitorCmd := &cobra.Command{
+		Use:   "monitor",
+		Short: "Monitor containers for installed packages and send alerts on failure",
+		Long:  "Watch containers for installed packages in all contexts and run the configured alert hooks when a container dies unexpectedly, runs out of memory, or becomes unhealthy",
+		Run: func(cmd *cobra.Command, args []string) {
+			monitorCfg := pkgmgr.MonitorConfig{
+				Command:    os.Getenv("MONITOR_HOOK_COMMAND"),
+				WebhookUrl: os.Getenv("MONITOR_WEBHOOK_URL"),
+			}
+			if cmd.Flags().Changed("hook-command") {
+				monitorCfg.Command = monitorFlags.hookCommand
+			}
+			if cmd.Flags().Changed("webhook-url") {
+				monitorCfg.WebhookUrl = monitorFlags.webhookUrl
+			}
+			if monitorCfg.Command == "" && monitorCfg.WebhookUrl == "" {
+				slog.Warn(
+					"no alert hooks configured, alerts will only be logged",
+				)
+			}
+			pm := createPackageManager(cmd.Context())
+			if err := pm.Monitor(monitorCfg); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	monitorCmd.Flags().
+		StringVar(&monitorFlags.hookCommand, "hook-command", "", "shell command to run for each alert (overrides MONITOR_HOOK_COMMAND)")
+	monitorCmd.Flags().
+		StringVar(&monitorFlags.webhookUrl, "webhook-url", "", "URL to POST a JSON payload to for each alert (overrides MONITOR_WEBHOOK_URL)")
+	return monitorCmd
+}
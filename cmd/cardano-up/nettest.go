@@ -0,0 +1,98 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var nettestFlags = struct {
+	port          uint
+	publicAddress string
+	ipChecker     string
+	checker       string
+	relays        []string
+	timeout       time.Duration
+}{}
+
+func nettestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "nettest",
+		Short: "Check that the node in the active context is reachable by peers",
+		Long:  "Check that the node in the active context accepts P2P connections locally and on its public address, and that its relays resolve and accept connections, reporting likely firewall and NAT problems",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			netTestCfg := pkgmgr.NetTestConfig{
+				Port:          nettestFlags.port,
+				PublicAddress: nettestFlags.publicAddress,
+				IpCheckerUrl:  nettestFlags.ipChecker,
+				CheckerUrl:    nettestFlags.checker,
+				Timeout:       nettestFlags.timeout,
+			}
+			for _, relay := range nettestFlags.relays {
+				peer, err := pkgmgr.NewTopologyPeer(relay)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				netTestCfg.Relays = append(netTestCfg.Relays, peer)
+			}
+			report, err := pm.NetTest(netTestCfg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			for _, check := range report.Checks {
+				status := "PASS"
+				if !check.Passed {
+					status = "FAIL"
+				}
+				slog.Info(
+					fmt.Sprintf("%s  %s (%s): %s", status, check.Name, check.Target, check.Message),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("check", check.Name),
+					slog.String("target", check.Target),
+					slog.Bool("passed", check.Passed),
+					slog.String("message", check.Message),
+				)
+			}
+			for _, problem := range report.Problems {
+				slog.Warn(problem)
+			}
+			if !report.Passed() {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().
+		UintVar(&nettestFlags.port, "port", 0, "host port for P2P connections to the node (defaults to the port published by the node container)")
+	cmd.Flags().
+		StringVar(&nettestFlags.publicAddress, "public-address", "", "public IP or hostname of the node (defaults to the IP reported by the IP checker)")
+	cmd.Flags().
+		StringVar(&nettestFlags.ipChecker, "ip-checker", pkgmgr.DefaultNetTestIpCheckerUrl, "URL that responds with the public IP of this host, or empty to skip the public address check")
+	cmd.Flags().
+		StringVar(&nettestFlags.checker, "checker-url", "", "URL of an external reachability checker, with {{ .Host }} and {{ .Port }} template vars, which reports the port as reachable with a 2xx response")
+	cmd.Flags().
+		StringSliceVar(&nettestFlags.relays, "relay", nil, "relay to check, in ADDRESS:PORT format, in addition to the managed topology peers (can be repeated)")
+	cmd.Flags().
+		DurationVar(&nettestFlags.timeout, "timeout", 10*time.Second, "timeout for each check")
+	return cmd
+}
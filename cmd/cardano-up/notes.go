@@ -0,0 +1,126 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var notesFlags = struct {
+	pending bool
+}{}
+
+func notesCommand() *cobra.Command {
+	notesCmd := &cobra.Command{
+		Use:   "notes [package...]",
+		Short: "Show the post-install notes and action items for installed packages",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			pkgNotes, err := pm.Notes(args...)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			found := false
+			for _, tmpNotes := range pkgNotes {
+				pkgName := tmpNotes.Package.InstanceName()
+				if notesFlags.pending && len(tmpNotes.Package.PendingNotes()) == 0 {
+					continue
+				}
+				found = true
+				slog.Info(fmt.Sprintf("Notes for package %s:\n", pkgName))
+				if tmpNotes.PostInstallNotes != "" && !notesFlags.pending {
+					slog.Info(
+						tmpNotes.PostInstallNotes+"\n",
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("package", pkgName),
+					)
+				}
+				for idx, note := range tmpNotes.Notes {
+					if notesFlags.pending && !note.Pending() {
+						continue
+					}
+					slog.Info(
+						fmt.Sprintf("%d. %s\n", idx+1, note.String()),
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("package", pkgName),
+						slog.Int("number", idx+1),
+						slog.String("message", note.Message),
+						slog.String("severity", note.Severity),
+						slog.Bool("requiresAction", note.RequiresAction),
+						slog.Bool("acknowledged", note.Acknowledged),
+					)
+				}
+			}
+			if !found {
+				slog.Info(
+					"No notes found",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+			}
+		},
+	}
+	notesCmd.Flags().
+		BoolVar(&notesFlags.pending, "pending", false, "only show action items that haven't been acknowledged")
+	notesCmd.AddCommand(
+		notesAckCommand(),
+	)
+	return notesCmd
+}
+
+func notesAckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ack <package> [<note number>...]",
+		Short: "Acknowledge action items for an installed package (defaults to all of them)",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package provided")
+			}
+			for _, arg := range args[1:] {
+				if _, err := strconv.Atoi(arg); err != nil {
+					return fmt.Errorf("invalid note number: %s", arg)
+				}
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var noteNums []int
+			for _, arg := range args[1:] {
+				// This was validated above
+				noteNum, _ := strconv.Atoi(arg)
+				noteNums = append(noteNums, noteNum)
+			}
+			pm := createPackageManager(cmd.Context())
+			count, err := pm.AcknowledgeNotes(args[0], noteNums...)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Acknowledged %d action item(s) for package %s", count, args[0]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", args[0]),
+				slog.Int("count", count),
+			)
+		},
+	}
+}
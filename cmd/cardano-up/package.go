@@ -0,0 +1,297 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var packageRenderFlags = struct {
+	context string
+	network string
+	opts    []string
+}{}
+
+var packageInitFlags = struct {
+	dir            string
+	version        string
+	description    string
+	image          string
+	port           int
+	nonInteractive bool
+}{}
+
+func packageCommand() *cobra.Command {
+	packageCommand := &cobra.Command{
+		Use:   "package",
+		Short: "Tools for package authors",
+	}
+	packageCommand.AddCommand(
+		packageInitCommand(),
+		packageRenderCommand(),
+	)
+	return packageCommand
+}
+
+func packageInitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init <name>",
+		Short: "Scaffold a new package directory",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one package name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			scaffold := pkgmgr.NewPackageScaffold(args[0])
+			// Apply values from flags
+			if cmd.Flags().Changed("version") {
+				scaffold.Version = packageInitFlags.version
+			}
+			if cmd.Flags().Changed("description") {
+				scaffold.Description = packageInitFlags.description
+			}
+			if cmd.Flags().Changed("image") {
+				scaffold.Image = packageInitFlags.image
+			}
+			if cmd.Flags().Changed("port") {
+				scaffold.Port = packageInitFlags.port
+			}
+			// Prompt for any values not provided via flags
+			if !packageInitFlags.nonInteractive && isTerminal(os.Stdin) {
+				if err := packageInitPrompt(cmd, &scaffold); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+			}
+			manifestPath, err := scaffold.Write(packageInitFlags.dir)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Created package %s (= %s) in %s",
+					scaffold.Name,
+					scaffold.Version,
+					manifestPath,
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", scaffold.Name),
+				slog.String("version", scaffold.Version),
+				slog.String("path", manifestPath),
+			)
+		},
+	}
+	cmd.Flags().
+		StringVarP(&packageInitFlags.dir, "dir", "d", ".", "parent directory to create the package directory in")
+	cmd.Flags().
+		StringVar(&packageInitFlags.version, "version", "", "package version")
+	cmd.Flags().
+		StringVar(&packageInitFlags.description, "description", "", "package description")
+	cmd.Flags().
+		StringVar(&packageInitFlags.image, "image", "", "Docker image for the package")
+	cmd.Flags().
+		IntVar(&packageInitFlags.port, "port", 0, "container port exposed by the package")
+	cmd.Flags().
+		BoolVarP(&packageInitFlags.nonInteractive, "yes", "y", false, "don't prompt, and use defaults for values not provided via flags")
+	return cmd
+}
+
+func packageRenderCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render <path>",
+		Short: "Render the templates in a package without installing it",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package path provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one package path may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pkgOpts, err := parsePackageOpts(packageRenderFlags.opts)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			pm := createPackageManager(cmd.Context())
+			rendered, err := pm.RenderPackage(
+				args[0],
+				packageRenderFlags.context,
+				packageRenderFlags.network,
+				pkgOpts,
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			contextDesc := fmt.Sprintf("context %q", rendered.Context)
+			if rendered.Simulated {
+				contextDesc = fmt.Sprintf(
+					"simulated context on network %q",
+					packageRenderFlags.network,
+				)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Rendered templates for package %s (= %s) in %s:\n",
+					rendered.Package.Name,
+					rendered.Package.Version,
+					contextDesc,
+				),
+			)
+			for _, tmpl := range rendered.Templates {
+				if tmpl.Error != nil {
+					slog.Error(
+						fmt.Sprintf("%s: %s", tmpl.Field, tmpl.Error),
+					)
+					continue
+				}
+				slog.Info(
+					fmt.Sprintf(
+						"%s:\n  %s",
+						tmpl.Field,
+						strings.ReplaceAll(
+							strings.TrimRight(tmpl.Value, "\n"),
+							"\n",
+							"\n  ",
+						),
+					),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("field", tmpl.Field),
+					slog.String("value", tmpl.Value),
+				)
+			}
+			if rendered.HasErrors() {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().
+		StringVarP(&packageRenderFlags.context, "context", "c", "", "render against an existing context instead of a simulated one")
+	cmd.Flags().
+		StringVarP(&packageRenderFlags.network, "network", "n", defaultNetwork, "network for the simulated context")
+	cmd.Flags().
+		StringArrayVarP(&packageRenderFlags.opts, "opt", "o", nil, "set a package option, as NAME, NAME=false, or NAME=VALUE (may be specified multiple times)")
+	return cmd
+}
+
+// parsePackageOpts parses package options in the format NAME or NAME=VALUE. Values are converted
+// to the option type by the package manager
+func parsePackageOpts(opts []string) (map[string]any, error) {
+	ret := make(map[string]any)
+	for _, opt := range opts {
+		optName, optVal, found := strings.Cut(opt, "=")
+		if optName == "" {
+			return nil, fmt.Errorf("invalid option: %s", opt)
+		}
+		if !found {
+			ret[optName] = true
+			continue
+		}
+		ret[optName] = optVal
+	}
+	return ret, nil
+}
+
+// packageInitPrompt interactively prompts for scaffold values that weren't
+// provided via flags
+func packageInitPrompt(
+	cmd *cobra.Command,
+	scaffold *pkgmgr.PackageScaffold,
+) error {
+	reader := bufio.NewReader(cmd.InOrStdin())
+	out := cmd.ErrOrStderr()
+	prompts := []struct {
+		flag  string
+		label string
+		value *string
+	}{
+		{"version", "Version", &scaffold.Version},
+		{"description", "Description", &scaffold.Description},
+		{"image", "Docker image", &scaffold.Image},
+	}
+	for _, p := range prompts {
+		if cmd.Flags().Changed(p.flag) {
+			continue
+		}
+		tmpVal, err := prompt(reader, out, p.label, *p.value)
+		if err != nil {
+			return err
+		}
+		*p.value = tmpVal
+	}
+	if !cmd.Flags().Changed("port") {
+		tmpPort, err := prompt(
+			reader,
+			out,
+			"Container port",
+			strconv.Itoa(scaffold.Port),
+		)
+		if err != nil {
+			return err
+		}
+		scaffold.Port, err = strconv.Atoi(tmpPort)
+		if err != nil {
+			return fmt.Errorf("invalid port: %s", tmpPort)
+		}
+	}
+	return nil
+}
+
+// prompt asks for a value, returning the default if no value is entered
+func prompt(
+	reader *bufio.Reader,
+	out io.Writer,
+	label string,
+	defaultVal string,
+) (string, error) {
+	fmt.Fprintf(out, "%s [%s]: ", label, defaultVal)
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultVal, nil
+	}
+	return line, nil
+}
+
+// isTerminal returns whether the file is a terminal (character device)
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
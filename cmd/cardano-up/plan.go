@@ -0,0 +1,171 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+const (
+	planOutputText = "text"
+	planOutputJson = "json"
+)
+
+// planFlags are shared by the commands that support dry runs and plan files
+var planFlags = struct {
+	dryRun   bool
+	output   string
+	planFile string
+}{}
+
+func addPlanFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		BoolVar(&planFlags.dryRun, "dry-run", false, "show what the command will do without making any changes")
+	cmd.Flags().
+		StringVar(&planFlags.output, "output", planOutputText, "output format for --dry-run (text or json)")
+	cmd.Flags().
+		StringVar(&planFlags.planFile, "plan-file", "", "apply a plan from --dry-run --output json, failing if it no longer matches what the command will do")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "plan-file")
+}
+
+// checkPlanArgs checks the command args when applying a plan file, which already has the packages
+func checkPlanArgs(args []string) error {
+	if len(args) > 0 {
+		return errors.New("packages cannot be specified when using --plan-file")
+	}
+	return nil
+}
+
+// showPlan outputs what running the command with the request will do
+func showPlan(
+	cmd *cobra.Command,
+	pm *pkgmgr.PackageManager,
+	command string,
+	req pkgmgr.PlanRequest,
+) {
+	if planFlags.output != planOutputText && planFlags.output != planOutputJson {
+		slog.Error(
+			fmt.Sprintf(
+				"unsupported output format %q, expected %q or %q",
+				planFlags.output,
+				planOutputText,
+				planOutputJson,
+			),
+		)
+		os.Exit(1)
+	}
+	plan, err := pm.Plan(command, req)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if planFlags.output == planOutputText {
+		printPlan(cmd.OutOrStdout(), plan)
+		return
+	}
+	planJson, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	slog.Info(
+		string(planJson),
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+	)
+}
+
+// applyPlanFile applies a plan created by a dry run of the same command
+func applyPlanFile(pm *pkgmgr.PackageManager, command string) {
+	planJson, err := os.ReadFile(planFlags.planFile)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	var plan pkgmgr.Plan
+	if err := json.Unmarshal(planJson, &plan); err != nil {
+		slog.Error(fmt.Sprintf("failed to parse plan %s: %s", planFlags.planFile, err))
+		os.Exit(1)
+	}
+	if plan.Command != command {
+		slog.Error(
+			fmt.Sprintf(
+				"plan %s is for the %s command, not %s",
+				planFlags.planFile,
+				plan.Command,
+				command,
+			),
+		)
+		os.Exit(1)
+	}
+	if err := pm.ApplyPlan(plan); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// printPlan writes a summary of the changes in a plan
+func printPlan(w io.Writer, plan pkgmgr.Plan) {
+	if len(plan.Actions) == 0 {
+		fmt.Fprintf(w, "Nothing to %s in context %q\n", plan.Command, plan.Context)
+		return
+	}
+	fmt.Fprintf(w, "The following changes will be made in context %q:\n", plan.Context)
+	for _, action := range plan.Actions {
+		fmt.Fprintf(w, "\n  %s", action.String())
+		if action.Dependency {
+			if action.Action == pkgmgr.PlanActionUninstall {
+				fmt.Fprint(w, " [dependent]")
+			} else {
+				fmt.Fprint(w, " [dependency]")
+			}
+		}
+		fmt.Fprintln(w)
+		for _, image := range action.Images {
+			var imageStatus string
+			switch {
+			case action.Action == pkgmgr.PlanActionUninstall:
+				imageStatus = "remove"
+			case image.Present:
+				imageStatus = "present"
+			case image.DownloadSize > 0:
+				imageStatus = pkgmgr.FormatBytes(image.DownloadSize) + " download"
+			default:
+				imageStatus = "download size unknown"
+			}
+			fmt.Fprintf(w, "    image: %s (%s)\n", image.Image, imageStatus)
+		}
+		if len(action.Ports) > 0 {
+			fmt.Fprintf(w, "    ports: %s\n", strings.Join(action.Ports, ", "))
+		}
+	}
+	if plan.DownloadSize > 0 || plan.DiskSpace > 0 {
+		fmt.Fprintln(w)
+	}
+	if plan.DownloadSize > 0 {
+		fmt.Fprintf(w, "Estimated download size: %s\n", pkgmgr.FormatBytes(plan.DownloadSize))
+	}
+	if plan.DiskSpace > 0 {
+		fmt.Fprintf(w, "Required disk space: %s\n", pkgmgr.FormatBytes(plan.DiskSpace))
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/internal/table"
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var portsFlags = struct {
+	firewall string
+}{}
+
+func portsCommand() *cobra.Command {
+	portsCmd := &cobra.Command{
+		Use:   "ports",
+		Short: "List the host ports claimed by installed packages",
+		Long: `List the host ports claimed by installed packages in all contexts, along with the package and
+container that each belongs to. Ports that are claimed by more than one package, or that are still
+allocated to a package that isn't installed, are shown as conflicts. Ports that need to be reachable
+from other hosts, such as for node P2P connections, are marked as public, and firewall rules that
+allow them can be generated with --firewall.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			ports := pm.HostPorts()
+			if portsFlags.firewall != "" {
+				rules, err := pkgmgr.FirewallRules(ports, portsFlags.firewall)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if len(rules) == 0 {
+					slog.Info("No public ports to allow")
+					return
+				}
+				for _, rule := range rules {
+					slog.Info(
+						rule,
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("firewall", portsFlags.firewall),
+					)
+				}
+				return
+			}
+			if len(ports) == 0 {
+				slog.Info("No host ports are claimed by installed packages")
+				return
+			}
+			tbl := newTable("Port", "Context", "Package", "Container", "Public", "Conflicts")
+			tbl.SetColumnColor(
+				5,
+				func(value string) table.Color {
+					return table.ColorRed
+				},
+			)
+			var rowAttrs [][]any
+			hasConflicts := false
+			for _, port := range ports {
+				container := port.Container
+				if container != "" {
+					container += ":" + strconv.Itoa(port.ContainerPort)
+				}
+				var public string
+				if port.Public {
+					public = "yes"
+				}
+				if len(port.Conflicts) > 0 {
+					hasConflicts = true
+				}
+				tbl.AddRow(
+					fmt.Sprintf("%d/%s", port.Port, port.Protocol),
+					port.Context,
+					port.Package,
+					container,
+					public,
+					strings.Join(port.Conflicts, ", "),
+				)
+				rowAttrs = append(
+					rowAttrs,
+					[]any{
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.Int("port", port.Port),
+						slog.String("protocol", port.Protocol),
+						slog.String("context", port.Context),
+						slog.String("package", port.Package),
+						slog.String("container", port.Container),
+						slog.Int("containerPort", port.ContainerPort),
+						slog.Bool("public", port.Public),
+						slog.Any("conflicts", port.Conflicts),
+					},
+				)
+			}
+			logTable(tbl, rowAttrs)
+			if hasConflicts {
+				slog.Warn(
+					"some host ports have conflicts, reinstall or uninstall the affected packages to resolve them",
+				)
+			}
+		},
+	}
+	portsCmd.Flags().
+		StringVar(&portsFlags.firewall, "firewall", "", "output rules that allow the public ports for the specified firewall (ufw, firewalld, or iptables)")
+	return portsCmd
+}
@@ -0,0 +1,279 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var postgresFlags = struct {
+	pkg   string
+	force bool
+}{}
+
+func postgresCommand() *cobra.Command {
+	postgresCommand := &cobra.Command{
+		Use:   "postgres",
+		Short: "Manage the PostgreSQL database of an installed database package, such as cardano-db-sync",
+	}
+	postgresCommand.PersistentFlags().
+		StringVarP(&postgresFlags.pkg, "package", "p", "", "installed database package to use (defaults to the only database package)")
+	postgresCommand.AddCommand(
+		postgresPsqlCommand(),
+		postgresSyncCommand(),
+		postgresSnapshotCommand(),
+	)
+	return postgresCommand
+}
+
+func postgresPsqlCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "psql [-- args...]",
+		Short: "Run psql against the database of the package",
+		Long:  "Run psql in the database container of the package, connected to the package database. Args after -- are passed through to psql",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			opts, restore, err := terminalCliOptions()
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			exitCode, err := pm.Psql(postgresFlags.pkg, args, opts)
+			restore()
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+		},
+	}
+}
+
+func postgresSyncCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Show the sync progress of a cardano-db-sync database compared to the node tip",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			status, err := pm.DatabaseSyncStatus(postgresFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			attrs := []any{
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", status.Package.InstanceName()),
+				slog.Uint64("block", status.Block),
+				slog.Uint64("slot", status.Slot),
+			}
+			if status.NodeError != nil {
+				slog.Info(
+					fmt.Sprintf(
+						"Database is at block %d (slot %d), the node tip is unavailable: %s",
+						status.Block,
+						status.Slot,
+						status.NodeError,
+					),
+					attrs...,
+				)
+				return
+			}
+			attrs = append(
+				attrs,
+				slog.Uint64("tipBlock", status.TipBlock),
+				slog.Uint64("tipSlot", status.TipSlot),
+				slog.Float64("syncProgress", status.Progress()),
+			)
+			slog.Info(
+				fmt.Sprintf(
+					"Database is at block %d of %d (%.2f%%, %d blocks behind the node)",
+					status.Block,
+					status.TipBlock,
+					status.Progress(),
+					status.BlocksBehind(),
+				),
+				attrs...,
+			)
+		},
+	}
+}
+
+func postgresSnapshotCommand() *cobra.Command {
+	snapshotCommand := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage snapshots of the database of the package for faster restores",
+	}
+	snapshotCommand.AddCommand(
+		postgresSnapshotCreateCommand(),
+		postgresSnapshotListCommand(),
+		postgresSnapshotRestoreCommand(),
+		postgresSnapshotDeleteCommand(),
+	)
+	return snapshotCommand
+}
+
+func postgresSnapshotCreateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a snapshot of the database with pg_dump (defaults to a name based on the current time)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+			pm := createPackageManager(cmd.Context())
+			snapshot, err := pm.CreateDatabaseSnapshot(postgresFlags.pkg, name)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Created snapshot %s (%s)",
+					snapshot.Name,
+					pkgmgr.FormatBytes(uint64(snapshot.Size)),
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("name", snapshot.Name),
+				slog.String("path", snapshot.Path),
+				slog.Int64("size", snapshot.Size),
+			)
+		},
+	}
+}
+
+func postgresSnapshotListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the snapshots of the database",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			snapshots, err := pm.DatabaseSnapshots(postgresFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(snapshots) == 0 {
+				slog.Info(
+					"No snapshots found",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			tbl := newTable("Name", "Created", "Version", "Block", "Size")
+			var rowAttrs [][]any
+			for _, snapshot := range snapshots {
+				block := ""
+				if snapshot.Block > 0 {
+					block = strconv.FormatUint(snapshot.Block, 10)
+				}
+				tbl.AddRow(
+					snapshot.Name,
+					snapshot.Created.Local().Format(time.DateTime),
+					snapshot.PackageVersion,
+					block,
+					pkgmgr.FormatBytes(uint64(snapshot.Size)),
+				)
+				rowAttrs = append(
+					rowAttrs,
+					[]any{
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("name", snapshot.Name),
+						slog.Time("created", snapshot.Created),
+						slog.String("version", snapshot.PackageVersion),
+						slog.Uint64("block", snapshot.Block),
+						slog.Int64("size", snapshot.Size),
+					},
+				)
+			}
+			logTable(tbl, rowAttrs)
+		},
+	}
+}
+
+func postgresSnapshotRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Restore a snapshot into the database with pg_restore, replacing its contents",
+		Long:  "Restore a snapshot into the database with pg_restore, replacing its contents. The other containers for the package are stopped while restoring and started again afterward",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no snapshot name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one snapshot name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.RestoreDatabaseSnapshot(
+				postgresFlags.pkg,
+				args[0],
+				postgresFlags.force,
+			); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Restored snapshot %s", args[0]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("name", args[0]),
+			)
+		},
+	}
+	cmd.Flags().
+		BoolVarP(&postgresFlags.force, "force", "f", false, "restore even if the snapshot was created with a different package version")
+	return cmd
+}
+
+func postgresSnapshotDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a snapshot of the database",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no snapshot name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one snapshot name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.DeleteDatabaseSnapshot(postgresFlags.pkg, args[0]); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Deleted snapshot %s", args[0]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("name", args[0]),
+			)
+		},
+	}
+}
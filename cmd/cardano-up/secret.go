@@ -0,0 +1,155 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func secretCommand() *cobra.Command {
+	secretCommand := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage secrets provided to packages",
+	}
+	secretCommand.AddCommand(
+		secretSetCommand(),
+		secretListCommand(),
+		secretDeleteCommand(),
+	)
+	return secretCommand
+}
+
+func secretSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <name>",
+		Short: "Set a secret, reading the value from stdin",
+		Args:  secretNameArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			value, err := readSecretValue(cmd, args[0])
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if value == "" {
+				slog.Error("secret value cannot be empty")
+				os.Exit(1)
+			}
+			pm := createPackageManager(cmd.Context())
+			if err := pm.SetSecret(args[0], value); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Set secret %s", args[0]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("name", args[0]),
+			)
+		},
+	}
+}
+
+func secretListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the names of stored secrets",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			names, err := pm.SecretNames()
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(names) == 0 {
+				slog.Info(
+					"No secrets set",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			secretPkgs := pm.SecretPackages()
+			slog.Info(fmt.Sprintf("%-30s %s", "Name", "Used by"))
+			for _, name := range names {
+				slog.Info(
+					fmt.Sprintf(
+						"%-30s %s",
+						name,
+						strings.Join(secretPkgs[name], ", "),
+					),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("name", name),
+					slog.Any("packages", secretPkgs[name]),
+				)
+			}
+		},
+	}
+}
+
+func secretDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a secret",
+		Args:  secretNameArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.DeleteSecret(args[0]); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Deleted secret %s", args[0]),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("name", args[0]),
+			)
+		},
+	}
+}
+
+func secretNameArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no secret name provided")
+	}
+	if len(args) > 1 {
+		return errors.New("only one secret name may be specified")
+	}
+	return nil
+}
+
+// readSecretValue reads a secret value from stdin. When stdin is a terminal, the user is
+// prompted and the input is not echoed
+func readSecretValue(cmd *cobra.Command, name string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Value for secret %s: ", name)
+	value, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var setEnvFlags = struct {
+	unset []string
+}{}
+
+func setEnvCommand() *cobra.Command {
+	setEnvCmd := &cobra.Command{
+		Use:   "set-env <package> [KEY=VALUE...]",
+		Short: "Set env vars for the containers of an installed package",
+		Long: `Set env vars for the containers of an installed package, overriding or adding to the env
+vars from the package. The containers are recreated to apply the changes, and the env vars are kept
+on upgrade. The current env vars are shown when no changes are provided.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package provided")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			pkgName := args[0]
+			if len(args) == 1 && len(setEnvFlags.unset) == 0 {
+				showPackageEnv(pm, pkgName)
+				return
+			}
+			if err := pm.SetPackageEnv(pkgName, args[1:], setEnvFlags.unset); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Updated env vars for package %s and recreated its containers", pkgName),
+			)
+		},
+	}
+	setEnvCmd.Flags().
+		StringArrayVar(&setEnvFlags.unset, "unset", nil, "remove the env var override with the given name (can be repeated)")
+	return setEnvCmd
+}
+
+func showPackageEnv(pm *pkgmgr.PackageManager, pkgName string) {
+	activeContextName, _ := pm.CurrentContext()
+	for _, installedPkg := range pm.InstalledPackages() {
+		if installedPkg.InstanceName() != pkgName {
+			continue
+		}
+		if len(installedPkg.Env) == 0 {
+			slog.Info(fmt.Sprintf("No env vars set for package %s", pkgName))
+			return
+		}
+		for _, env := range installedPkg.Env {
+			slog.Info(
+				env,
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", pkgName),
+			)
+		}
+		return
+	}
+	slog.Error(pkgmgr.NewPackageNotInstalledError(pkgName, activeContextName).Error())
+	os.Exit(1)
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var spoFlags = struct {
+	pkg            string
+	warnDays       int
+	check          bool
+	coldSigningKey string
+	counter        string
+	kesPeriod      uint64
+}{}
+
+func spoCommand() *cobra.Command {
+	spoCommand := &cobra.Command{
+		Use:   "spo",
+		Short: "Manage KES keys and operational certificates for a block producer",
+	}
+	spoCommand.PersistentFlags().
+		StringVarP(&spoFlags.pkg, "package", "p", "", "installed block producer package to manage the keys for (defaults to the only block producer package)")
+	spoCommand.AddCommand(
+		spoStatusCommand(),
+		spoIssueCommand(
+			"rotate-kes",
+			"Generate a new KES key pair and issue an operational certificate for it",
+			true,
+		),
+		spoIssueCommand(
+			"issue-opcert",
+			"Issue a new operational certificate for the current KES key",
+			false,
+		),
+		spoImportCommand(),
+	)
+	return spoCommand
+}
+
+func spoStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the operational certificate status and KES key expiry",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			status, err := pm.SPOStatus(spoFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			showSPOKeyStatus(status)
+			if status.ExpiresWithin(time.Duration(spoFlags.warnDays) * 24 * time.Hour) {
+				warnKESExpiry(status)
+				if spoFlags.check {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	cmd.Flags().
+		IntVar(&spoFlags.warnDays, "warn-days", 14, "warn when the KES key expires within this many days")
+	cmd.Flags().
+		BoolVar(&spoFlags.check, "check", false, "exit with a non-zero status when the KES key expires within the warning period, for use in scheduled checks")
+	return cmd
+}
+
+func spoIssueCommand(use string, short string, rotateKES bool) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			opts := pkgmgr.SPOIssueOptions{
+				ColdSigningKey: spoFlags.coldSigningKey,
+				OpCertCounter:  spoFlags.counter,
+			}
+			if cmd.Flags().Changed("kes-period") {
+				opts.KESPeriod = &spoFlags.kesPeriod
+			}
+			var status pkgmgr.SPOKeyStatus
+			var err error
+			if rotateKES {
+				status, err = pm.RotateKES(spoFlags.pkg, opts)
+			} else {
+				status, err = pm.IssueOpCert(spoFlags.pkg, opts)
+			}
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Issued operational certificate for package %s",
+					status.Package.InstanceName(),
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+			showSPOKeyStatus(status)
+		},
+	}
+	cmd.Flags().
+		StringVar(&spoFlags.coldSigningKey, "cold-signing-key", "", "path to the pool cold signing key")
+	cmd.Flags().
+		StringVar(&spoFlags.counter, "counter", "", "path to the operational certificate issue counter for the cold key, which is updated")
+	cmd.Flags().
+		Uint64Var(&spoFlags.kesPeriod, "kes-period", 0, "KES period that the certificate starts at (defaults to the current KES period from the node)")
+	_ = cmd.MarkFlagRequired("cold-signing-key")
+	_ = cmd.MarkFlagRequired("counter")
+	return cmd
+}
+
+func spoImportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <file>...",
+		Short: "Copy key files, such as the VRF signing key, into the block producer keys dir",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no key files provided")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.ImportSPOKeys(spoFlags.pkg, args); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Imported %d key file(s)", len(args)),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+}
+
+func showSPOKeyStatus(status pkgmgr.SPOKeyStatus) {
+	slog.Info(
+		fmt.Sprintf(
+			"Operational certificate for package %s: counter %d, KES periods %d to %d (current %d), expires %s",
+			status.Package.InstanceName(),
+			status.OpCertCounter,
+			status.OpCertKESPeriod,
+			status.ExpiryKESPeriod-1,
+			status.CurrentKESPeriod,
+			status.Expires.Local().Format(time.RFC1123),
+		),
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+		slog.String("package", status.Package.InstanceName()),
+		slog.Uint64("opCertCounter", status.OpCertCounter),
+		slog.Uint64("opCertKesPeriod", status.OpCertKESPeriod),
+		slog.Uint64("currentKesPeriod", status.CurrentKESPeriod),
+		slog.Uint64("expiryKesPeriod", status.ExpiryKESPeriod),
+		slog.Time("expires", status.Expires),
+	)
+}
+
+func warnKESExpiry(status pkgmgr.SPOKeyStatus) {
+	if status.ExpiresWithin(0) {
+		slog.Warn(
+			"KES key has expired, rotate it with 'cardano-up spo rotate-kes' to resume producing blocks",
+		)
+		return
+	}
+	slog.Warn(
+		fmt.Sprintf(
+			"KES key expires in %d day(s), rotate it soon with 'cardano-up spo rotate-kes'",
+			int(time.Until(status.Expires).Hours()/24),
+		),
+	)
+}
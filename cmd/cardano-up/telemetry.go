@@ -0,0 +1,334 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/internal/version"
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var telemetryFlags = struct {
+	url string
+}{}
+
+func telemetryCommand() *cobra.Command {
+	telemetryCommand := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Manage opt-in anonymous usage stats",
+		Long:  "Manage opt-in anonymous usage stats. When enabled, cardano-up counts the commands that are run, the categories of errors that occur, and the registry packages that fail to install, and can submit these counts to help the maintainers find what fails most. No package options, paths, hostnames or error messages are recorded. Telemetry is disabled by default",
+	}
+	telemetryCommand.AddCommand(
+		telemetryStatusCommand(),
+		telemetryOnCommand(),
+		telemetryOffCommand(),
+		telemetrySubmitCommand(),
+	)
+	return telemetryCommand
+}
+
+func telemetryStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether telemetry is enabled and the usage stats that haven't been submitted",
+		Run: func(cmd *cobra.Command, args []string) {
+			status, err := newTelemetry().Status()
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			enabled := status.Enabled && !status.DisabledByEnv
+			attrs := []any{
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.Bool("enabled", enabled),
+				slog.String("url", status.Url),
+			}
+			switch {
+			case status.DisabledByEnv:
+				slog.Info("Telemetry is disabled via the DO_NOT_TRACK env var", attrs...)
+				return
+			case !status.Enabled:
+				slog.Info("Telemetry is disabled", attrs...)
+				return
+			case status.Url == "":
+				slog.Info(
+					"Telemetry is enabled, usage stats are only kept locally",
+					attrs...,
+				)
+			default:
+				slog.Info(
+					fmt.Sprintf("Telemetry is enabled, usage stats are submitted to %s", status.Url),
+					attrs...,
+				)
+			}
+			if !status.LastSubmitted.IsZero() {
+				slog.Info(
+					fmt.Sprintf(
+						"Usage stats were last submitted at %s",
+						status.LastSubmitted.Local().Format(time.DateTime),
+					),
+				)
+			}
+			showTelemetryStats(status.Stats)
+		},
+	}
+}
+
+func telemetryOnCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "on",
+		Short: "Enable collecting anonymous usage stats",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := newTelemetry().Enable(telemetryFlags.url); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				"Telemetry enabled, thank you for helping improve cardano-up",
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.Bool("enabled", true),
+			)
+		},
+	}
+	cmd.Flags().
+		StringVar(&telemetryFlags.url, "url", "", "https URL to submit usage stats to (usage stats are only kept locally without one)")
+	return cmd
+}
+
+func telemetryOffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "off",
+		Short: "Disable collecting usage stats and remove the usage stats that haven't been submitted",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := newTelemetry().Disable(); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				"Telemetry disabled",
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.Bool("enabled", false),
+			)
+		},
+	}
+}
+
+func telemetrySubmitCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "submit",
+		Short: "Submit the collected usage stats now, rather than waiting for the weekly submission",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := newTelemetry().Submit(telemetryVersion()); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				"Usage stats submitted",
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+}
+
+func showTelemetryStats(stats pkgmgr.TelemetryStats) {
+	if len(stats.Commands) == 0 {
+		slog.Info(
+			"No usage stats collected yet",
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+		)
+		return
+	}
+	slog.Info(
+		fmt.Sprintf(
+			"Usage stats collected since %s:",
+			stats.Since.Local().Format(time.DateTime),
+		),
+	)
+	tbl := newTable("Command", "Runs", "Failures")
+	var rowAttrs [][]any
+	for _, command := range sortedKeys(stats.Commands) {
+		cmdStats := stats.Commands[command]
+		tbl.AddRow(
+			command,
+			strconv.FormatUint(cmdStats.Count, 10),
+			strconv.FormatUint(cmdStats.Failures, 10),
+		)
+		rowAttrs = append(
+			rowAttrs,
+			[]any{
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("command", command),
+				slog.Uint64("count", cmdStats.Count),
+				slog.Uint64("failures", cmdStats.Failures),
+			},
+		)
+	}
+	logTable(tbl, rowAttrs)
+	for _, category := range sortedKeys(stats.Errors) {
+		slog.Info(
+			fmt.Sprintf("Errors (%s): %d", category, stats.Errors[category]),
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+			slog.String("errorCategory", category),
+			slog.Uint64("count", stats.Errors[category]),
+		)
+	}
+	for _, pkgName := range sortedKeys(stats.PackageFailures) {
+		slog.Info(
+			fmt.Sprintf("Package failures (%s): %d", pkgName, stats.PackageFailures[pkgName]),
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+			slog.String("package", pkgName),
+			slog.Uint64("count", stats.PackageFailures[pkgName]),
+		)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// newTelemetry returns the telemetry for the selected profile. This doesn't need the package
+// manager, so that commands that fail to create one are still counted
+func newTelemetry() *pkgmgr.Telemetry {
+	telemetry, err := telemetryForProfile()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	return telemetry
+}
+
+// telemetryVersion returns the version reported with usage stats
+func telemetryVersion() string {
+	if version.Version == "" {
+		return "devel"
+	}
+	return version.Version
+}
+
+// telemetryCommandName returns the name of a command for usage stats, without the program name
+// and args, such as "context create"
+func telemetryCommandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), programName+" ")
+}
+
+// startTelemetry counts the run of a command and records the first error logged as a failure of
+// the command, if telemetry is enabled. The telemetry command itself and shell completion aren't
+// counted
+func startTelemetry(cmd *cobra.Command) {
+	command := telemetryCommandName(cmd)
+	if cmd == cmd.Root() || cmd.Hidden || strings.HasPrefix(cmd.Name(), "__") ||
+		strings.HasPrefix(command, "telemetry") || strings.HasPrefix(command, "completion") {
+		return
+	}
+	// Background registry refreshes are started by another command rather than the user
+	if command == "update" && updateFlags.background {
+		return
+	}
+	telemetry, err := telemetryForProfile()
+	if err != nil {
+		return
+	}
+	status, err := telemetry.Status()
+	if err != nil || !status.Enabled || status.DisabledByEnv {
+		return
+	}
+	telemetry.RecordCommand(command)
+	slog.SetDefault(
+		slog.New(
+			&telemetryHandler{
+				Handler:   slog.Default().Handler(),
+				telemetry: telemetry,
+				command:   command,
+				once:      &sync.Once{},
+			},
+		),
+	)
+}
+
+// submitTelemetry submits the collected usage stats when they're due, if telemetry is enabled
+func submitTelemetry() {
+	telemetry, err := telemetryForProfile()
+	if err != nil {
+		return
+	}
+	telemetry.SubmitIfDue(telemetryVersion())
+}
+
+func telemetryForProfile() (*pkgmgr.Telemetry, error) {
+	cfg, err := pkgmgr.NewProfileConfig(globalFlags.profile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Logger = slog.Default()
+	// Usage stats aren't submitted in offline mode
+	cfg.Offline, err = offlineMode()
+	if err != nil {
+		return nil, err
+	}
+	return pkgmgr.NewTelemetry(cfg), nil
+}
+
+// telemetryHandler records the first error logged as a failure of the command being run, since
+// commands exit as soon as they log an error
+type telemetryHandler struct {
+	slog.Handler
+	telemetry *pkgmgr.Telemetry
+	command   string
+	once      *sync.Once
+}
+
+func (h *telemetryHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		h.once.Do(
+			func() {
+				h.telemetry.RecordFailure(h.command, r.Message)
+			},
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *telemetryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &telemetryHandler{
+		Handler:   h.Handler.WithAttrs(attrs),
+		telemetry: h.telemetry,
+		command:   h.command,
+		once:      h.once,
+	}
+}
+
+func (h *telemetryHandler) WithGroup(name string) slog.Handler {
+	return &telemetryHandler{
+		Handler:   h.Handler.WithGroup(name),
+		telemetry: h.telemetry,
+		command:   h.command,
+		once:      h.once,
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+)
+
+func TestTelemetryOffline(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	defer server.Close()
+	t.Setenv(pkgmgr.HomeEnvVar, t.TempDir())
+	t.Setenv("DO_NOT_TRACK", "")
+	// The OFFLINE env var is restored after the test
+	t.Setenv("OFFLINE", "")
+	if err := os.Unsetenv("OFFLINE"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	telemetry, err := telemetryForProfile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := telemetry.Enable(server.URL); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	telemetry.RecordCommand("install")
+	testDefs := []struct {
+		flag bool
+		env  string
+	}{
+		{flag: true},
+		{env: "true"},
+	}
+	for _, testDef := range testDefs {
+		globalFlags.offline = testDef.flag
+		if testDef.env != "" {
+			if err := os.Setenv("OFFLINE", testDef.env); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		telemetry, err := telemetryForProfile()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := telemetry.Submit(telemetryVersion()); !errors.Is(err, pkgmgr.ErrOffline) {
+			t.Fatalf("did not get expected error in offline mode: %v", err)
+		}
+	}
+	globalFlags.offline = false
+	if requests.Load() > 0 {
+		t.Fatalf("usage stats were submitted in offline mode")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+func testCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "test [package ...]",
+		Short: "Run the tests for installed packages",
+		Long:  "Run the smoke tests declared by the specified installed packages in the active context, or by all installed packages in the active context, to check that they work",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			results, err := pm.TestPackages(args...)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(results) == 0 {
+				slog.Info("No package tests to run")
+				return
+			}
+			failed := false
+			for _, result := range results {
+				status := "PASS"
+				if !result.Passed {
+					failed = true
+					status = "FAIL"
+				}
+				msg := fmt.Sprintf("%s  %s/%s", status, result.Package, result.Name)
+				if !result.Passed {
+					msg += ": " + result.Message
+				}
+				slog.Info(
+					msg,
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("package", result.Package),
+					slog.String("test", result.Name),
+					slog.Bool("passed", result.Passed),
+					slog.String("message", result.Message),
+				)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var topologyFlags = struct {
+	pkg string
+}{}
+
+func topologyCommand() *cobra.Command {
+	topologyCommand := &cobra.Command{
+		Use:   "topology",
+		Short: "Manage the cardano-node topology for an installed package",
+	}
+	topologyCommand.PersistentFlags().
+		StringVarP(&topologyFlags.pkg, "package", "p", "", "installed package to manage the topology for (defaults to the only package with a topology file)")
+	topologyCommand.AddCommand(
+		topologyShowCommand(),
+		topologyAddPeerCommand(),
+		topologyRemovePeerCommand(),
+		topologyP2PCommand("enable-p2p", "Use the P2P topology format", true),
+		topologyP2PCommand("disable-p2p", "Use the legacy (non-P2P) topology format", false),
+	)
+	return topologyCommand
+}
+
+func topologyShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show the managed topology",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			installedPkg, topology, err := pm.Topology(topologyFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			p2pStatus := "disabled"
+			if topology.P2P {
+				p2pStatus = "enabled"
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Topology for package %s (P2P %s):\n",
+					installedPkg.InstanceName(),
+					p2pStatus,
+				),
+			)
+			if len(topology.Peers) == 0 {
+				slog.Info(
+					"No peers added",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			for _, peer := range topology.Peers {
+				slog.Info(
+					peer.String(),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("address", peer.Address),
+					slog.Uint64("port", uint64(peer.Port)),
+				)
+			}
+		},
+	}
+}
+
+func topologyAddPeerCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add-peer <address:port>...",
+		Short: "Add upstream peers to the topology",
+		Args:  topologyPeerArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			for _, arg := range args {
+				peer, err := pkgmgr.NewTopologyPeer(arg)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if err := pm.AddTopologyPeer(topologyFlags.pkg, peer); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				slog.Info(
+					fmt.Sprintf("Added topology peer %s", peer.String()),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+			}
+		},
+	}
+}
+
+func topologyRemovePeerCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove-peer <address:port>...",
+		Short: "Remove upstream peers from the topology",
+		Args:  topologyPeerArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			for _, arg := range args {
+				peer, err := pkgmgr.NewTopologyPeer(arg)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if err := pm.RemoveTopologyPeer(topologyFlags.pkg, peer); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				slog.Info(
+					fmt.Sprintf("Removed topology peer %s", peer.String()),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+			}
+		},
+	}
+}
+
+func topologyP2PCommand(use string, short string, enabled bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			if err := pm.SetTopologyP2P(topologyFlags.pkg, enabled); err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			p2pStatus := "disabled"
+			if enabled {
+				p2pStatus = "enabled"
+			}
+			slog.Info(
+				fmt.Sprintf("P2P topology %s", p2pStatus),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
+		},
+	}
+}
+
+func topologyPeerArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no peer provided")
+	}
+	return nil
+}
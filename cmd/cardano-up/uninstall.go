@@ -15,40 +15,147 @@
 package main
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var uninstallFlags = struct {
-	keepData bool
+	keepData   bool
+	keepImages bool
+	cascade    bool
 }{}
 
 func uninstallCommand() *cobra.Command {
 	uninstallCmd := &cobra.Command{
 		Use:   "uninstall",
-		Short: "Uninstall package",
+		Short: "Uninstall packages",
 		Args: func(cmd *cobra.Command, args []string) error {
+			if planFlags.planFile != "" {
+				return checkPlanArgs(args)
+			}
 			if len(args) == 0 {
 				return errors.New("no package provided")
 			}
-			if len(args) > 1 {
-				return errors.New("only one package may be specified at a time")
-			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			// Uninstall package
-			if err := pm.Uninstall(args[0], uninstallFlags.keepData, false); err != nil {
+			pm := createPackageManager(cmd.Context())
+			if planFlags.planFile != "" {
+				applyPlanFile(pm, pkgmgr.PlanCommandUninstall)
+				return
+			}
+			if planFlags.dryRun {
+				showPlan(
+					cmd,
+					pm,
+					pkgmgr.PlanCommandUninstall,
+					pkgmgr.PlanRequest{
+						Packages:   args,
+						KeepData:   uninstallFlags.keepData,
+						KeepImages: uninstallFlags.keepImages,
+						Cascade:    uninstallFlags.cascade,
+					},
+				)
+				return
+			}
+			plan, err := pm.UninstallPlan(
+				args,
+				uninstallFlags.keepData,
+				uninstallFlags.keepImages,
+				uninstallFlags.cascade,
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			printUninstallPlan(cmd.ErrOrStderr(), plan)
+			if len(plan.Broken) > 0 {
+				slog.Error(
+					"uninstalling would break the dependent packages listed above, use --cascade to also uninstall them",
+				)
+				os.Exit(1)
+			}
+			if !hookFlags.yes {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					slog.Error(
+						"not uninstalling without confirmation, use --yes to uninstall without prompting",
+					)
+					os.Exit(1)
+				}
+				confirmed, err := promptYesNo(
+					cmd.ErrOrStderr(),
+					bufio.NewReader(cmd.InOrStdin()),
+					"Continue",
+					false,
+				)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				if !confirmed {
+					return
+				}
+			}
+			// Uninstall packages, with dependent packages first
+			if err := pm.Uninstall(
+				plan.PackageSpecs(),
+				uninstallFlags.keepData,
+				uninstallFlags.keepImages,
+				false,
+			); err != nil {
 				slog.Error(err.Error())
 				os.Exit(1)
 			}
 		},
 	}
 	uninstallCmd.Flags().
-		BoolVarP(&uninstallFlags.keepData, "keep-data", "k", false, "don't cleanup package data")
+		BoolVarP(&uninstallFlags.keepData, "keep-data", "k", false, "don't cleanup package data, cache, and logs dirs or volumes")
+	uninstallCmd.Flags().
+		BoolVar(&uninstallFlags.keepImages, "keep-images", false, "don't remove package Docker images")
+	uninstallCmd.Flags().
+		BoolVar(&uninstallFlags.cascade, "cascade", false, "also uninstall the installed packages that depend on the specified packages")
+	addHookFlags(uninstallCmd)
+	addPlanFlags(uninstallCmd)
+	uninstallCmd.Flags().Lookup("yes").Usage = "don't prompt for confirmation or for approval of package hook scripts"
 	return uninstallCmd
 }
+
+// printUninstallPlan writes a summary of what uninstalling packages will remove
+func printUninstallPlan(w io.Writer, plan pkgmgr.UninstallPlan) {
+	fmt.Fprintln(w, "The following packages will be uninstalled:")
+	for _, pkg := range plan.Packages {
+		fmt.Fprintf(w, "\n  %s (= %s)", pkg.Package.InstanceName(), pkg.Package.Package.Version)
+		if pkg.Dependent {
+			fmt.Fprint(w, " [dependent]")
+		}
+		fmt.Fprintln(w)
+		if len(pkg.Containers) > 0 {
+			fmt.Fprintf(w, "    containers: %s\n", strings.Join(pkg.Containers, ", "))
+		}
+		if len(pkg.Images) > 0 {
+			fmt.Fprintf(w, "    images:     %s\n", strings.Join(pkg.Images, ", "))
+		}
+		for _, dir := range pkg.Dirs {
+			fmt.Fprintf(w, "    data:       %s (%s)\n", dir.Path, pkgmgr.FormatBytes(dir.Size))
+		}
+	}
+	if dataSize := plan.DataSize(); dataSize > 0 {
+		fmt.Fprintf(w, "\n%s of package data will be deleted\n", pkgmgr.FormatBytes(dataSize))
+	}
+	if len(plan.Broken) > 0 {
+		fmt.Fprintln(w, "\nThe following installed packages depend on them and would break:")
+		for _, pkg := range plan.Broken {
+			fmt.Fprintf(w, "  %s (= %s)\n", pkg.InstanceName(), pkg.Package.Version)
+		}
+	}
+	fmt.Fprintln(w)
+}
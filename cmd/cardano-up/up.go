@@ -1,19 +1,27 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
+	"github.com/blinklabs-io/cardano-up/internal/table"
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
+var upDownFlags = struct {
+	timeout time.Duration
+}{}
+
 func upCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "up",
 		Short: "Starts all Docker containers",
-		Long:  `Starts all stopped Docker containers for installed packages in the current context.`,
+		Long:  `Starts all stopped Docker containers for installed packages in the current context. Packages are started concurrently, after the packages that they depend on.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			pm := createPackageManager()
+			pm := createPackageManager(cmd.Context())
 			installedPackages := pm.InstalledPackages()
 			if len(installedPackages) == 0 {
 				slog.Warn(
@@ -21,7 +29,9 @@ func upCommand() *cobra.Command {
 				)
 				installCommandRun(cmd, []string{"cardano-node"})
 			} else {
-				if err := pm.Up(); err != nil {
+				results, err := pm.Up(upDownFlags.timeout)
+				printServiceResults(results)
+				if err != nil {
 					slog.Error(err.Error())
 					os.Exit(1)
 				}
@@ -29,5 +39,51 @@ func upCommand() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().
+		DurationVar(&upDownFlags.timeout, "timeout", 0, "maximum time to wait for all packages to start (defaults to no limit)")
 	return cmd
 }
+
+// printServiceResults outputs a summary of starting or stopping the services for each package
+func printServiceResults(results []pkgmgr.ServiceResult) {
+	if len(results) == 0 {
+		return
+	}
+	tbl := newTable("Package", "Version", "Duration", "Result")
+	tbl.SetColumnColor(
+		3,
+		func(value string) table.Color {
+			if value == "ok" {
+				return table.ColorGreen
+			}
+			return table.ColorRed
+		},
+	)
+	var rowAttrs [][]any
+	for _, result := range results {
+		resultOutput := "ok"
+		var errOutput string
+		if result.Error != nil {
+			errOutput = result.Error.Error()
+			resultOutput = "failed: " + errOutput
+		}
+		tbl.AddRow(
+			result.Package,
+			result.Version,
+			result.Duration.Round(time.Millisecond).String(),
+			resultOutput,
+		)
+		rowAttrs = append(
+			rowAttrs,
+			[]any{
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", result.Package),
+				slog.String("version", result.Version),
+				slog.Duration("duration", result.Duration),
+				slog.String("error", errOutput),
+			},
+		)
+	}
+	slog.Info(fmt.Sprintf("\nSummary (%d packages):\n", len(results)))
+	logTable(tbl, rowAttrs)
+}
@@ -15,23 +15,102 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
+var updateFlags = struct {
+	background bool
+}{}
+
 func updateCommand() *cobra.Command {
 	updateCmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update the package registry cache",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			if err := pm.UpdatePackages(); err != nil {
+			pm := createPackageManager(cmd.Context())
+			// Refresh the stale registry cache for another command, keeping the changes to
+			// show on the next update
+			if updateFlags.background {
+				if err := pm.RefreshRegistry(); err != nil {
+					slog.Debug(
+						fmt.Sprintf("failed to refresh package registry: %s", err),
+					)
+					os.Exit(1)
+				}
+				return
+			}
+			changes, err := pm.UpdatePackages()
+			if err != nil {
 				slog.Error(err.Error())
 				os.Exit(1)
 			}
+			if changes.Initial {
+				slog.Info(
+					"Fetched package registry",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			if len(changes.Packages) == 0 {
+				slog.Info(
+					"No changes to available packages",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			slog.Info("Changes to available packages:")
+			for _, change := range changes.Packages {
+				slog.Info(
+					"  "+registryChangeString(change),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("name", change.Name),
+					slog.Bool("new", change.New),
+					slog.Bool("removed", change.Removed),
+					slog.Any("addedVersions", change.AddedVersions),
+					slog.Any("removedVersions", change.RemovedVersions),
+				)
+			}
 		},
 	}
+	updateCmd.Flags().
+		BoolVar(&updateFlags.background, "background", false, "refresh the registry cache in the background")
+	_ = updateCmd.Flags().MarkHidden("background")
 	return updateCmd
 }
+
+func registryChangeString(change pkgmgr.RegistryPackageChange) string {
+	if change.New {
+		return fmt.Sprintf(
+			"%s: new package (%s)",
+			change.Name,
+			strings.Join(change.AddedVersions, ", "),
+		)
+	}
+	if change.Removed {
+		return fmt.Sprintf(
+			"%s: removed (%s)",
+			change.Name,
+			strings.Join(change.RemovedVersions, ", "),
+		)
+	}
+	var tmpChanges []string
+	if len(change.AddedVersions) > 0 {
+		tmpChanges = append(
+			tmpChanges,
+			"new versions "+strings.Join(change.AddedVersions, ", "),
+		)
+	}
+	if len(change.RemovedVersions) > 0 {
+		tmpChanges = append(
+			tmpChanges,
+			"removed versions "+strings.Join(change.RemovedVersions, ", "),
+		)
+	}
+	return fmt.Sprintf("%s: %s", change.Name, strings.Join(tmpChanges, "; "))
+}
@@ -15,34 +15,179 @@
 package main
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
+var upgradeFlags = struct {
+	migrate       bool
+	healthTimeout time.Duration
+	skipTests     bool
+}{}
+
 func upgradeCommand() *cobra.Command {
 	upgradeCmd := &cobra.Command{
 		Use:   "upgrade",
-		Short: "Upgrade package",
+		Short: "Upgrade packages",
 		Args: func(cmd *cobra.Command, args []string) error {
+			if planFlags.planFile != "" {
+				return checkPlanArgs(args)
+			}
 			if len(args) == 0 {
 				return errors.New("no package provided")
 			}
-			if len(args) > 1 {
-				return errors.New("only one package may be specified at a time")
-			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := createPackageManager()
-			// Upgrade requested package
-			if err := pm.Upgrade(args[0]); err != nil {
-				slog.Error(err.Error())
-				os.Exit(1)
+			pm := createPackageManager(cmd.Context())
+			if planFlags.planFile != "" {
+				applyPlanFile(pm, pkgmgr.PlanCommandUpgrade)
+				return
+			}
+			// Migrations of superseded packages aren't included in the plan
+			if planFlags.dryRun {
+				showPlan(
+					cmd,
+					pm,
+					pkgmgr.PlanCommandUpgrade,
+					pkgmgr.PlanRequest{Packages: args},
+				)
+				return
+			}
+			reader := bufio.NewReader(cmd.InOrStdin())
+			var upgradePkgs []string
+			var migratePkgs []string
+			for _, arg := range args {
+				superseded, ok := pm.SupersededPackage(arg)
+				if !ok {
+					upgradePkgs = append(upgradePkgs, arg)
+					continue
+				}
+				slog.Warn(
+					fmt.Sprintf(
+						"package %s has been superseded by %s",
+						arg,
+						superseded.SupersededBy,
+					),
+				)
+				migrate := upgradeFlags.migrate
+				if !migrate && term.IsTerminal(int(os.Stdin.Fd())) {
+					var err error
+					migrate, err = promptYesNo(
+						cmd.ErrOrStderr(),
+						reader,
+						fmt.Sprintf("Migrate %s to %s", arg, superseded.SupersededBy),
+						false,
+					)
+					if err != nil {
+						slog.Error(err.Error())
+						os.Exit(1)
+					}
+				}
+				if migrate {
+					migratePkgs = append(migratePkgs, arg)
+					continue
+				}
+				// Upgrade to the latest version of the superseded package if there is one
+				if superseded.Latest.Version == superseded.Installed.Package.Version {
+					slog.Info(
+						fmt.Sprintf(
+							"Not upgrading package %s, use --migrate to migrate it to %s",
+							arg,
+							superseded.SupersededBy,
+						),
+					)
+					continue
+				}
+				upgradePkgs = append(upgradePkgs, arg)
+			}
+			// Show what will be upgraded and confirm
+			if len(upgradePkgs) > 0 {
+				changes, err := pm.UpgradeChanges(upgradePkgs...)
+				if err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+				printUpgradeChanges(cmd.ErrOrStderr(), changes)
+				if !hookFlags.yes && term.IsTerminal(int(os.Stdin.Fd())) {
+					confirmed, err := promptYesNo(
+						cmd.ErrOrStderr(),
+						reader,
+						"Continue with upgrade",
+						false,
+					)
+					if err != nil {
+						slog.Error(err.Error())
+						os.Exit(1)
+					}
+					if !confirmed {
+						upgradePkgs = nil
+					}
+				}
+			}
+			// Upgrade requested packages
+			if len(upgradePkgs) > 0 {
+				if err := pm.Upgrade(upgradePkgs...); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
+			}
+			// Migrate superseded packages
+			for _, pkgName := range migratePkgs {
+				if err := pm.Migrate(pkgName); err != nil {
+					slog.Error(err.Error())
+					os.Exit(1)
+				}
 			}
 		},
 	}
+	upgradeCmd.Flags().
+		BoolVar(&upgradeFlags.migrate, "migrate", false, "migrate packages that have been superseded to the package that replaces them without prompting")
+	upgradeCmd.Flags().
+		DurationVar(&upgradeFlags.healthTimeout, "health-timeout", 0, "time to wait for the new version of a stateful package to become healthy before keeping the old version (defaults to 5m)")
+	upgradeCmd.Flags().
+		BoolVar(&upgradeFlags.skipTests, "skip-tests", false, "don't run the package tests after upgrading")
+	addHookFlags(upgradeCmd)
+	addPlanFlags(upgradeCmd)
+	upgradeCmd.Flags().Lookup("yes").Usage = "don't prompt for confirmation or for approval of package hook scripts"
 	return upgradeCmd
 }
+
+// printUpgradeChanges writes the packages that will be upgraded, along with the changelog for the
+// versions between the installed and new versions
+func printUpgradeChanges(w io.Writer, changes []pkgmgr.UpgradeChange) {
+	fmt.Fprintln(w, "The following packages will be upgraded:")
+	for _, change := range changes {
+		if change.InstalledVersion == "" {
+			fmt.Fprintf(w, "\n  %s (= %s) [dependency]\n", change.Package, change.Version)
+		} else {
+			fmt.Fprintf(
+				w,
+				"\n  %s (%s => %s)\n",
+				change.Package,
+				change.InstalledVersion,
+				change.Version,
+			)
+		}
+		if change.ReleaseNotesUrl != "" {
+			fmt.Fprintf(w, "    Release notes: %s\n", change.ReleaseNotesUrl)
+		}
+		if len(change.Migrations) > 0 {
+			fmt.Fprintf(w, "    Data migrations: %s\n", strings.Join(change.Migrations, ", "))
+		}
+		for _, entry := range change.Changelog {
+			fmt.Fprintf(w, "\n    %s:\n%s\n", entry.Version, indentLines(entry.Changelog, "      "))
+		}
+	}
+	fmt.Fprintln(w)
+}
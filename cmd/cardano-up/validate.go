@@ -47,13 +47,14 @@ func validateCommand() *cobra.Command {
 				slog.Error(err.Error())
 				os.Exit(1)
 			}
-			cfg, err := pkgmgr.NewDefaultConfig()
+			cfg, err := pkgmgr.NewProfileConfig(globalFlags.profile)
 			if err != nil {
 				slog.Error(
 					fmt.Sprintf("failed to create package manager: %s", err),
 				)
 				os.Exit(1)
 			}
+			cfg.Context = cmd.Context()
 			// Point at provided registry dir
 			cfg.RegistryDir = absPackagesDir
 			pm, err := pkgmgr.NewPackageManager(cfg)
@@ -73,7 +74,10 @@ func validateCommand() *cobra.Command {
 				slog.Error("problems were found")
 				os.Exit(1)
 			}
-			slog.Info("No problems found!")
+			slog.Info(
+				"No problems found!",
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+			)
 		},
 	}
 	return validateCmd
@@ -0,0 +1,95 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var verifyFlags = struct {
+	all    bool
+	repair bool
+}{}
+
+func verifyCommand() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check installed packages for drift from their containers and files",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			drifts, err := pm.Verify(verifyFlags.all, verifyFlags.repair)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(drifts) == 0 {
+				slog.Info(
+					"Installed packages match their containers and files",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			unresolved := 0
+			for _, drift := range drifts {
+				var statusOutput string
+				if drift.Repaired {
+					statusOutput = " (repaired)"
+				} else if drift.RepairError != nil {
+					statusOutput = fmt.Sprintf(" (repair failed: %s)", drift.RepairError)
+				} else if !drift.Repairable() {
+					statusOutput = " (cannot be repaired automatically)"
+				}
+				if !drift.Repaired {
+					unresolved++
+				}
+				slog.Info(
+					fmt.Sprintf(
+						"%s (context %q): %s%s",
+						drift.Package.InstanceName(),
+						drift.Package.Context,
+						drift.Description,
+						statusOutput,
+					),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("name", drift.Package.InstanceName()),
+					slog.String("context", drift.Package.Context),
+					slog.String("drift", drift.Description),
+					slog.Bool("repairable", drift.Repairable()),
+					slog.Bool("repaired", drift.Repaired),
+				)
+			}
+			if unresolved == 0 {
+				return
+			}
+			if !verifyFlags.repair {
+				slog.Info("\nUse 'cardano-up verify --repair' to reconcile")
+			}
+			slog.Error(
+				fmt.Sprintf("found %d unresolved differences", unresolved),
+			)
+			os.Exit(1)
+		},
+	}
+	verifyCmd.Flags().
+		BoolVarP(&verifyFlags.all, "all", "A", false, "check packages from all contexts (defaults to only active context)")
+	verifyCmd.Flags().
+		BoolVar(&verifyFlags.repair, "repair", false, "recreate containers, rewrite files, and relink binaries to match the installed packages")
+	return verifyCmd
+}
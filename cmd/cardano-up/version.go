@@ -19,6 +19,7 @@ import (
 	"log/slog"
 
 	"github.com/blinklabs-io/cardano-up/internal/version"
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
 	"github.com/spf13/cobra"
 )
 
@@ -29,6 +30,7 @@ func versionCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			slog.Info(
 				fmt.Sprintf("%s %s", programName, version.GetVersionString()),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
 			)
 		},
 	}
@@ -0,0 +1,312 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var walletFlags = struct {
+	pkg            string
+	timeout        time.Duration
+	mnemonicFile   string
+	passphraseFile string
+}{}
+
+func walletCommand() *cobra.Command {
+	walletCommand := &cobra.Command{
+		Use:   "wallet",
+		Short: "Manage wallets for an installed wallet package",
+	}
+	walletCommand.PersistentFlags().
+		StringVarP(&walletFlags.pkg, "package", "p", "", "installed wallet package to use (defaults to the only wallet package)")
+	walletCommand.AddCommand(
+		walletInfoCommand(),
+		walletStatusCommand(),
+		walletWaitCommand(),
+		walletListCommand(),
+		walletCreateCommand(),
+	)
+	return walletCommand
+}
+
+func walletInfoCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "info",
+		Short: "Show the wallet API URL and the outputs of the wallet package",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			status, err := pm.WalletStatus(walletFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf("Wallet API URL: %s", status.Url),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", status.Package.InstanceName()),
+				slog.String("url", status.Url),
+			)
+			outputs := status.Package.Outputs
+			var tmpKeys []string
+			for k := range outputs {
+				tmpKeys = append(tmpKeys, k)
+			}
+			sort.Strings(tmpKeys)
+			for _, key := range tmpKeys {
+				slog.Info(
+					fmt.Sprintf("%s=%s", key, outputs[key]),
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+					slog.String("key", key),
+					slog.String("value", outputs[key]),
+				)
+			}
+			showWalletStatus(status)
+		},
+	}
+}
+
+func walletStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the wallet API is ready",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			status, err := pm.WalletStatus(walletFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			showWalletStatus(status)
+			if !status.Ready() {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func walletWaitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait",
+		Short: "Wait for the wallet API to respond and catch up with the node",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			status, err := pm.WaitForWallet(
+				walletFlags.pkg,
+				walletFlags.timeout,
+				func(status pkgmgr.WalletStatus) {
+					if !status.Ready() {
+						showWalletStatus(status)
+					}
+				},
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			showWalletStatus(status)
+		},
+	}
+	cmd.Flags().
+		DurationVar(&walletFlags.timeout, "timeout", 0, "time to wait for the wallet API before giving up (defaults to waiting indefinitely)")
+	return cmd
+}
+
+func walletListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the wallets managed by the wallet API",
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			wallets, err := pm.Wallets(walletFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(wallets) == 0 {
+				slog.Info(
+					"No wallets found",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"%-40s %-20s %-12s %s",
+					"ID",
+					"Name",
+					"Status",
+					"Balance (ADA)",
+				),
+			)
+			for _, wallet := range wallets {
+				showWallet(wallet)
+			}
+		},
+	}
+}
+
+func walletCreateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create or restore a wallet from a recovery phrase",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no wallet name provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one wallet name may be specified")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// Only one of the values can be read from stdin when it isn't a terminal
+			if !term.IsTerminal(int(os.Stdin.Fd())) &&
+				walletFlags.mnemonicFile == "" && walletFlags.passphraseFile == "" {
+				slog.Error(
+					"--mnemonic-file or --passphrase-file must be provided when stdin is not a terminal",
+				)
+				os.Exit(1)
+			}
+			mnemonic, err := readWalletValue(cmd, walletFlags.mnemonicFile, "Recovery phrase")
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			passphrase, err := readWalletValue(cmd, walletFlags.passphraseFile, "Passphrase")
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			pm := createPackageManager(cmd.Context())
+			wallet, err := pm.CreateWallet(
+				walletFlags.pkg,
+				pkgmgr.WalletCreateOptions{
+					Name:       args[0],
+					Mnemonic:   strings.Fields(mnemonic),
+					Passphrase: passphrase,
+				},
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				fmt.Sprintf(
+					"Created wallet %s with ID %s, which is being restored from the chain",
+					wallet.Name,
+					wallet.Id,
+				),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("id", wallet.Id),
+				slog.String("name", wallet.Name),
+			)
+		},
+	}
+	cmd.Flags().
+		StringVar(&walletFlags.mnemonicFile, "mnemonic-file", "", "path to a file with the recovery phrase (defaults to prompting for it)")
+	cmd.Flags().
+		StringVar(&walletFlags.passphraseFile, "passphrase-file", "", "path to a file with the spending passphrase (defaults to prompting for it)")
+	return cmd
+}
+
+func showWalletStatus(status pkgmgr.WalletStatus) {
+	attrs := []any{
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+		slog.String("package", status.Package.InstanceName()),
+		slog.String("url", status.Url),
+		slog.Bool("ready", status.Ready()),
+		slog.String("syncStatus", status.SyncStatus),
+		slog.Float64("syncProgress", status.SyncProgress),
+	}
+	switch {
+	case status.Error != nil:
+		slog.Info(
+			fmt.Sprintf("Wallet API is not responding: %s", status.Error),
+			attrs...,
+		)
+	case status.Ready():
+		slog.Info("Wallet API is ready", attrs...)
+	default:
+		slog.Info(
+			fmt.Sprintf(
+				"Wallet API is %s (%.2f%%)",
+				status.SyncStatus,
+				status.SyncProgress,
+			),
+			attrs...,
+		)
+	}
+}
+
+func showWallet(wallet pkgmgr.Wallet) {
+	status := wallet.SyncStatus
+	if wallet.SyncStatus != "ready" {
+		status = fmt.Sprintf("%s %.0f%%", wallet.SyncStatus, wallet.SyncProgress)
+	}
+	slog.Info(
+		fmt.Sprintf(
+			"%-40s %-20s %-12s %d.%06d",
+			wallet.Id,
+			wallet.Name,
+			status,
+			wallet.Balance/1_000_000,
+			wallet.Balance%1_000_000,
+		),
+		pkgmgr.EventAttr(pkgmgr.EventResult),
+		slog.String("id", wallet.Id),
+		slog.String("name", wallet.Name),
+		slog.String("status", wallet.SyncStatus),
+		slog.Uint64("balance", wallet.Balance),
+		slog.Uint64("availableBalance", wallet.AvailableBalance),
+	)
+}
+
+// readWalletValue reads a value from the provided file, or prompts for it without echoing the
+// input. Input from stdin is read in full when stdin isn't a terminal
+func readWalletValue(cmd *cobra.Command, path string, prompt string) (string, error) {
+	if path != "" {
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s: ", prompt)
+	value, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
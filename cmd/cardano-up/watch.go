@@ -0,0 +1,141 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+var watchFlags = struct {
+	maxRestarts   int
+	restartWindow time.Duration
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	since         string
+	pkg           string
+}{}
+
+func watchCommand() *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Restart containers for installed packages that exit unexpectedly",
+		Long:  "Watch containers for installed packages in all contexts and restart containers that exit unexpectedly, with an increasing delay between restarts and a limit on the number of restarts. Incidents are recorded to a history that can be shown with 'watch history'",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			err := pm.Watch(
+				pkgmgr.WatchConfig{
+					MaxRestarts:   watchFlags.maxRestarts,
+					RestartWindow: watchFlags.restartWindow,
+					Backoff:       watchFlags.backoff,
+					MaxBackoff:    watchFlags.maxBackoff,
+				},
+			)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	watchCmd.Flags().
+		IntVar(&watchFlags.maxRestarts, "max-restarts", 5, "maximum number of restarts of a container within the restart window, after which it's left stopped")
+	watchCmd.Flags().
+		DurationVar(&watchFlags.restartWindow, "restart-window", time.Hour, "period that the maximum number of restarts applies to")
+	watchCmd.Flags().
+		DurationVar(&watchFlags.backoff, "backoff", 10*time.Second, "delay before the first restart of a container, which doubles for each further restart")
+	watchCmd.Flags().
+		DurationVar(&watchFlags.maxBackoff, "max-backoff", 5*time.Minute, "maximum delay before restarting a container")
+	watchCmd.AddCommand(watchHistoryCommand())
+	return watchCmd
+}
+
+func watchHistoryCommand() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the incidents handled by the watchdog",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since, err := parseSince(watchFlags.since)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			pm := createPackageManager(cmd.Context())
+			incidents, err := pm.WatchHistory(since, watchFlags.pkg)
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if len(incidents) == 0 {
+				slog.Info(
+					"No incidents recorded",
+					pkgmgr.EventAttr(pkgmgr.EventResult),
+				)
+				return
+			}
+			tbl := newTable("Time", "Context", "Package", "Container", "Exit Code", "Action")
+			var rowAttrs [][]any
+			for _, incident := range incidents {
+				action := incident.Action
+				switch incident.Action {
+				case pkgmgr.WatchActionRestarted:
+					action = fmt.Sprintf(
+						"%s after %s (attempt %d)",
+						action,
+						incident.Backoff,
+						incident.Attempt,
+					)
+				case pkgmgr.WatchActionRestartFailed:
+					action = fmt.Sprintf("%s: %s", action, incident.Error)
+				}
+				tbl.AddRow(
+					incident.Time.Local().Format(time.RFC3339),
+					incident.Context,
+					fmt.Sprintf("%s (= %s)", incident.Package, incident.Version),
+					incident.Container,
+					incident.ExitCode,
+					action,
+				)
+				rowAttrs = append(
+					rowAttrs,
+					[]any{
+						pkgmgr.EventAttr(pkgmgr.EventResult),
+						slog.String("time", incident.Time.UTC().Format(time.RFC3339)),
+						slog.String("action", incident.Action),
+						slog.String("package", incident.Package),
+						slog.String("version", incident.Version),
+						slog.String("context", incident.Context),
+						slog.String("container", incident.Container),
+						slog.String("exitCode", incident.ExitCode),
+						slog.Int("attempt", incident.Attempt),
+						slog.String("error", incident.Error),
+					},
+				)
+			}
+			logTable(tbl, rowAttrs)
+		},
+	}
+	historyCmd.Flags().
+		StringVar(&watchFlags.since, "since", "", "show incidents since a duration ago (e.g. 24h) or an RFC3339 timestamp")
+	historyCmd.Flags().
+		StringVarP(&watchFlags.pkg, "package", "p", "", "only show incidents for the specified package")
+	return historyCmd
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+func whyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "why <package>",
+		Short: "Explain why a package is installed",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("no package provided")
+			}
+			if len(args) > 1 {
+				return errors.New("only one package may be specified at a time")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			pm := createPackageManager(cmd.Context())
+			reason, err := pm.Why(args[0])
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			slog.Info(
+				whyOutput(reason),
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", reason.Package.InstanceName()),
+				slog.Bool("explicit", reason.Package.Explicit),
+				slog.Bool("unneeded", reason.Unneeded()),
+			)
+		},
+	}
+}
+
+func whyOutput(reason pkgmgr.PackageReason) string {
+	ret := fmt.Sprintf(
+		"%s (= %s) ",
+		reason.Package.InstanceName(),
+		reason.Package.Package.Version,
+	)
+	if reason.Package.Explicit {
+		ret += "was installed explicitly"
+	} else {
+		ret += "was installed as a dependency"
+	}
+	if len(reason.Dependents) == 0 {
+		ret += "\nNo installed packages depend on it"
+		if reason.Unneeded() {
+			ret += ", so it can be uninstalled"
+		}
+		return ret
+	}
+	ret += "\nRequired by:"
+	for _, dependent := range reason.Dependents {
+		ret += fmt.Sprintf(
+			"\n  %s (= %s)",
+			dependent.InstanceName(),
+			dependent.Package.Version,
+		)
+		if !dependent.Explicit {
+			ret += " [dependency]"
+		}
+	}
+	return ret
+}
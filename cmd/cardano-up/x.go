@@ -0,0 +1,130 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/blinklabs-io/cardano-up/pkgmgr"
+	"github.com/spf13/cobra"
+)
+
+func xCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "x [package [command [args...]]]",
+		Short: "Run a command provided by an installed package",
+		Long:  "Run a command provided by an installed package in the active context, with any args passed through to it. Without a command, the commands provided by the installed packages are listed",
+		// All args and flags after the command are passed through to it
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+				_ = cmd.Help()
+				return
+			}
+			pm := createPackageManager(cmd.Context())
+			if len(args) < 2 {
+				var pkgName string
+				if len(args) > 0 {
+					pkgName = args[0]
+				}
+				listCliCommands(pm, pkgName)
+				return
+			}
+			exitCode, err := runCliCommand(pm, args[0], args[1], args[2:])
+			if err != nil {
+				slog.Error(err.Error())
+				os.Exit(1)
+			}
+			if exitCode != 0 {
+				os.Exit(exitCode)
+			}
+		},
+	}
+}
+
+func listCliCommands(pm *pkgmgr.PackageManager, pkgName string) {
+	cliCommands, err := pm.CliCommands(pkgName)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if len(cliCommands) == 0 {
+		slog.Info(
+			"No package commands found",
+			pkgmgr.EventAttr(pkgmgr.EventResult),
+		)
+		return
+	}
+	tbl := newTable("Package", "Command", "Description")
+	var rowAttrs [][]any
+	for _, cliCommand := range cliCommands {
+		description := cliCommand.Description
+		if cliCommand.Host {
+			description = fmt.Sprintf("%s (runs on this host)", description)
+		}
+		tbl.AddRow(cliCommand.Package, cliCommand.Name, description)
+		rowAttrs = append(
+			rowAttrs,
+			[]any{
+				pkgmgr.EventAttr(pkgmgr.EventResult),
+				slog.String("package", cliCommand.Package),
+				slog.String("command", cliCommand.Name),
+				slog.String("description", cliCommand.Description),
+				slog.Bool("host", cliCommand.Host),
+			},
+		)
+	}
+	logTable(tbl, rowAttrs)
+}
+
+// runCliCommand runs a package command. Commands that run in a container get a TTY when running
+// interactively in a terminal, and commands that run on the host use the terminal directly
+func runCliCommand(
+	pm *pkgmgr.PackageManager,
+	pkgName string,
+	name string,
+	args []string,
+) (int, error) {
+	cliCommands, err := pm.CliCommands(pkgName)
+	if err != nil {
+		return 0, err
+	}
+	host := false
+	for _, cliCommand := range cliCommands {
+		if cliCommand.Name == name {
+			host = cliCommand.Host
+		}
+	}
+	if host {
+		return pm.RunCliCommand(
+			pkgName,
+			name,
+			args,
+			pkgmgr.CliOptions{
+				Stdin:  os.Stdin,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			},
+		)
+	}
+	opts, restore, err := terminalCliOptions()
+	if err != nil {
+		return 0, err
+	}
+	defer restore()
+	return pm.RunCliCommand(pkgName, name, args, opts)
+}
@@ -27,21 +27,48 @@ const (
 	colorBrightMagenta = "95"
 )
 
+const (
+	// EventKey is the attribute key used to identify the event type for a log message
+	EventKey = "event"
+	// defaultEvent is the event type used in JSON output for messages without an explicit event
+	defaultEvent = "log"
+)
+
+type HandlerOptions struct {
+	Level slog.Leveler
+	// Quiet suppresses INFO and DEBUG messages that don't have an event type
+	Quiet bool
+	// Json outputs messages as structured JSON lines
+	Json bool
+	// NoColor disables colored level tags
+	NoColor bool
+}
+
 type Handler struct {
-	h   slog.Handler
-	out io.Writer
+	h     slog.Handler
+	out   io.Writer
+	opts  HandlerOptions
+	attrs []slog.Attr
 }
 
-func NewHandler(out io.Writer, opts *slog.HandlerOptions) *Handler {
+func NewHandler(out io.Writer, opts *HandlerOptions) *Handler {
 	if opts == nil {
-		opts = &slog.HandlerOptions{}
+		opts = &HandlerOptions{}
 	}
-	return &Handler{
-		out: out,
-		h: slog.NewTextHandler(out, &slog.HandlerOptions{
+	ret := &Handler{
+		out:  out,
+		opts: *opts,
+	}
+	if opts.Json {
+		ret.h = slog.NewJSONHandler(out, &slog.HandlerOptions{
+			Level: opts.Level,
+		})
+	} else {
+		ret.h = slog.NewTextHandler(out, &slog.HandlerOptions{
 			Level: opts.Level,
-		}),
+		})
 	}
+	return ret
 }
 
 func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
@@ -49,25 +76,47 @@ func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
 }
 
 func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &Handler{h: h.h.WithAttrs(attrs)}
+	tmpAttrs := append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	return &Handler{
+		h:     h.h.WithAttrs(attrs),
+		out:   h.out,
+		opts:  h.opts,
+		attrs: tmpAttrs,
+	}
 }
 
 func (h *Handler) WithGroup(name string) slog.Handler {
-	return &Handler{h: h.h.WithGroup(name)}
+	return &Handler{
+		h:     h.h.WithGroup(name),
+		out:   h.out,
+		opts:  h.opts,
+		attrs: h.attrs,
+	}
 }
 
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	event := h.event(r)
+	if h.opts.Quiet && r.Level < slog.LevelWarn && event == "" {
+		return nil
+	}
+	if h.opts.Json {
+		if event == "" {
+			r = r.Clone()
+			r.AddAttrs(slog.String(EventKey, defaultEvent))
+		}
+		return h.h.Handle(ctx, r)
+	}
 	var levelTag string
 	switch r.Level {
 	case slog.LevelDebug:
-		levelTag = fmt.Sprintf("\033[%smDEBUG:\033[0m ", colorBrightMagenta)
+		levelTag = h.levelTag("DEBUG:", colorBrightMagenta)
 	case slog.LevelInfo:
 		// No tag for INFO
 		levelTag = ""
 	case slog.LevelWarn:
-		levelTag = fmt.Sprintf("\033[%smWARNING:\033[0m ", colorBrightYellow)
+		levelTag = h.levelTag("WARNING:", colorBrightYellow)
 	case slog.LevelError:
-		levelTag = fmt.Sprintf("\033[%smERROR:\033[0m ", colorBrightRed)
+		levelTag = h.levelTag("ERROR:", colorBrightRed)
 	}
 	msg := levelTag + r.Message + "\n"
 	if _, err := h.out.Write([]byte(msg)); err != nil {
@@ -75,3 +124,28 @@ func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
 	}
 	return nil
 }
+
+// event returns the event type for the record, if any
+func (h *Handler) event(r slog.Record) string {
+	var ret string
+	for _, attr := range h.attrs {
+		if attr.Key == EventKey {
+			ret = attr.Value.String()
+		}
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == EventKey {
+			ret = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+func (h *Handler) levelTag(tag string, color string) string {
+	if h.opts.NoColor {
+		return tag + " "
+	}
+	return fmt.Sprintf("\033[%sm%s\033[0m ", color, tag)
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package table renders aligned text tables for command output
+package table
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Color is an ANSI SGR color code
+type Color string
+
+const (
+	ColorNone    Color = ""
+	ColorBold    Color = "1"
+	ColorRed     Color = "31"
+	ColorGreen   Color = "32"
+	ColorYellow  Color = "33"
+	ColorBlue    Color = "34"
+	ColorMagenta Color = "35"
+	ColorCyan    Color = "36"
+)
+
+// columnSeparator is the space between columns
+const columnSeparator = "  "
+
+// Table is a text table with columns sized to fit their widest value. The last column isn't padded,
+// so long descriptions don't leave trailing whitespace
+type Table struct {
+	// Color enables colored output. This should only be enabled when writing to a terminal
+	Color bool
+	// Indent is added to the start of each line
+	Indent  string
+	headers []string
+	rows    [][]string
+	colors  map[int]func(string) Color
+}
+
+// New returns a table with the provided column headers
+func New(headers ...string) *Table {
+	return &Table{
+		headers: headers,
+		colors:  make(map[int]func(string) Color),
+	}
+}
+
+// AddRow adds a row to the table. Missing values are left empty, and extra values are ignored
+func (t *Table) AddRow(values ...string) {
+	row := make([]string, len(t.headers))
+	copy(row, values)
+	t.rows = append(t.rows, row)
+}
+
+// SetColumnColor sets a function that returns the color for values in a column
+func (t *Table) SetColumnColor(column int, colorFunc func(value string) Color) {
+	t.colors[column] = colorFunc
+}
+
+// Len returns the number of rows in the table
+func (t *Table) Len() int {
+	return len(t.rows)
+}
+
+// Lines returns the rendered header line followed by a line for each row
+func (t *Table) Lines() []string {
+	widths := make([]int, len(t.headers))
+	for _, row := range append([][]string{t.headers}, t.rows...) {
+		for idx, value := range row {
+			widths[idx] = max(widths[idx], utf8.RuneCountInString(value))
+		}
+	}
+	ret := make([]string, 0, len(t.rows)+1)
+	ret = append(ret, t.renderLine(t.headers, widths, true))
+	for _, row := range t.rows {
+		ret = append(ret, t.renderLine(row, widths, false))
+	}
+	return ret
+}
+
+// String returns the rendered table, without a trailing newline
+func (t *Table) String() string {
+	return strings.Join(t.Lines(), "\n")
+}
+
+func (t *Table) renderLine(values []string, widths []int, header bool) string {
+	line := t.Indent
+	for idx, value := range values {
+		color := ColorNone
+		if header {
+			color = ColorBold
+		} else if colorFunc, ok := t.colors[idx]; ok {
+			color = colorFunc(value)
+		}
+		line += t.colorize(value, color)
+		if idx < len(values)-1 {
+			line += strings.Repeat(" ", widths[idx]-utf8.RuneCountInString(value))
+			line += columnSeparator
+		}
+	}
+	return strings.TrimRight(line, " ")
+}
+
+func (t *Table) colorize(value string, color Color) string {
+	if !t.Color {
+		return value
+	}
+	return Colorize(value, color)
+}
+
+// Colorize returns the value wrapped in the escape codes for a color
+func Colorize(value string, color Color) string {
+	if color == ColorNone || value == "" {
+		return value
+	}
+	return fmt.Sprintf("\033[%sm%s\033[0m", color, value)
+}
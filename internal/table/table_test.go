@@ -0,0 +1,71 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableLines(t *testing.T) {
+	tbl := New("Name", "Version", "Description")
+	tbl.AddRow("cardano-node-with-a-long-name", "10.1.4", "Cardano node")
+	tbl.AddRow("mithril-client", "0.9.9")
+	expected := []string{
+		"Name                           Version  Description",
+		"cardano-node-with-a-long-name  10.1.4   Cardano node",
+		"mithril-client                 0.9.9",
+	}
+	if lines := tbl.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("did not get expected lines\n  got: %q\n  expected: %q", lines, expected)
+	}
+	if tbl.Len() != 2 {
+		t.Fatalf("did not get expected number of rows: %d", tbl.Len())
+	}
+}
+
+func TestTableColor(t *testing.T) {
+	tbl := New("", "Name", "Status")
+	tbl.Indent = "  "
+	tbl.SetColumnColor(
+		2,
+		func(value string) Color {
+			if value == "RUNNING" {
+				return ColorGreen
+			}
+			return ColorRed
+		},
+	)
+	tbl.AddRow("*", "foo", "RUNNING")
+	tbl.AddRow("", "foobar", "NOT RUNNING")
+	// Colors are only added when enabled
+	expected := []string{
+		"     Name    Status",
+		"  *  foo     RUNNING",
+		"     foobar  NOT RUNNING",
+	}
+	if lines := tbl.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("did not get expected lines\n  got: %q\n  expected: %q", lines, expected)
+	}
+	tbl.Color = true
+	expected = []string{
+		"     \033[1mName\033[0m    \033[1mStatus\033[0m",
+		"  *  foo     \033[32mRUNNING\033[0m",
+		"     foobar  \033[31mNOT RUNNING\033[0m",
+	}
+	if lines := tbl.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("did not get expected lines\n  got: %q\n  expected: %q", lines, expected)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// DefaultDetachKeys is the key sequence to detach from a container, the same as for
+	// 'docker attach'
+	DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+	// detachCtrlKeys are the keys that can be combined with ctrl in a detach key sequence
+	detachCtrlKeys = `abcdefghijklmnopqrstuvwxyz@[\]^_`
+)
+
+// AttachOptions controls attaching to a container with DockerService.Attach
+type AttachOptions struct {
+	// DetachKeys is the key sequence to detach from the container in the Docker format (e.g.
+	// ctrl-p,ctrl-q), or empty to use DefaultDetachKeys
+	DetachKeys string
+	// Stdin is forwarded to containers that keep their stdin open
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Resize receives the size of the local terminal whenever it changes, which is applied to
+	// containers with a TTY
+	Resize <-chan TerminalSize
+}
+
+// TerminalSize is the size of a terminal in characters
+type TerminalSize struct {
+	Width  uint
+	Height uint
+}
+
+// AttachService returns the service for the container of an installed package in the active context
+// to attach to. The container name is the name from the package, and is required for packages with
+// more than one container. The container must be running
+func (p *PackageManager) AttachService(
+	pkgName string,
+	containerName string,
+) (*DockerService, error) {
+	svc, err := p.packageService(pkgName, containerName)
+	if err != nil {
+		return nil, err
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return nil, err
+	}
+	if !running {
+		return nil, NewContainerNotRunningError(svc.ContainerName)
+	}
+	return svc, nil
+}
+
+// Tty returns whether the container has a TTY, in which case the local terminal should be put in
+// raw mode while attached
+func (d *DockerService) Tty() (bool, error) {
+	container, err := d.inspect()
+	if err != nil {
+		return false, err
+	}
+	return container.Config.Tty, nil
+}
+
+// Attach attaches to the stdio of the container until the container stops or the detach key
+// sequence is entered. Output from before attaching isn't shown. It returns true if we detached
+// from the container while it was still running
+func (d *DockerService) Attach(opts AttachOptions) (bool, error) {
+	detachKeys := opts.DetachKeys
+	if detachKeys == "" {
+		detachKeys = DefaultDetachKeys
+	}
+	if err := validateDetachKeys(detachKeys); err != nil {
+		return false, err
+	}
+	tmpContainer, err := d.inspect()
+	if err != nil {
+		return false, err
+	}
+	stdin := opts.Stdin
+	if stdin != nil && !tmpContainer.Config.OpenStdin {
+		d.logger.Warn(
+			fmt.Sprintf(
+				"container %s doesn't keep its stdin open, so input won't be sent to it",
+				d.ContainerName,
+			),
+		)
+		stdin = nil
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return false, err
+	}
+	attachResp, err := client.ContainerAttach(
+		d.getContext(),
+		d.ContainerId,
+		container.AttachOptions{
+			Stream:     true,
+			Stdin:      stdin != nil,
+			Stdout:     true,
+			Stderr:     true,
+			DetachKeys: detachKeys,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	defer attachResp.Close()
+	if tmpContainer.Config.Tty && opts.Resize != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case size := <-opts.Resize:
+					if err := client.ContainerResize(
+						d.getContext(),
+						d.ContainerId,
+						container.ResizeOptions{
+							Width:  size.Width,
+							Height: size.Height,
+						},
+					); err != nil {
+						d.logger.Debug(
+							fmt.Sprintf(
+								"failed to resize TTY for container %s: %s",
+								d.ContainerName,
+								err,
+							),
+						)
+					}
+				}
+			}
+		}()
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(attachResp.Conn, stdin)
+			_ = attachResp.CloseWrite()
+		}()
+	}
+	// The Docker daemon ends the stream when the detach keys are entered or the container stops
+	if tmpContainer.Config.Tty {
+		_, err = io.Copy(opts.Stdout, attachResp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(opts.Stdout, opts.Stderr, attachResp.Reader)
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return d.Running()
+}
+
+// validateDetachKeys checks a detach key sequence in the Docker format, which is a comma-separated
+// list of single characters and ctrl-<key> combinations
+func validateDetachKeys(keys string) error {
+	for _, key := range strings.Split(keys, ",") {
+		if ctrlKey, ok := strings.CutPrefix(key, "ctrl-"); ok {
+			if len(ctrlKey) != 1 || !strings.ContainsAny(ctrlKey, detachCtrlKeys) {
+				return NewInvalidDetachKeysError(keys)
+			}
+			continue
+		}
+		if len(key) != 1 {
+			return NewInvalidDetachKeysError(keys)
+		}
+	}
+	return nil
+}
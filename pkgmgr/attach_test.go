@@ -0,0 +1,104 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"testing"
+)
+
+func TestValidateDetachKeys(t *testing.T) {
+	testDefs := []struct {
+		Keys  string
+		Error bool
+	}{
+		{Keys: "ctrl-p,ctrl-q"},
+		{Keys: "ctrl-@"},
+		{Keys: "ctrl-x,q"},
+		{Keys: "ctrl-", Error: true},
+		{Keys: "ctrl-P", Error: true},
+		{Keys: "ctrl-pq", Error: true},
+		{Keys: "ctrl-p,", Error: true},
+		{Keys: "esc", Error: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateDetachKeys(testDef.Keys)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for %q", testDef.Keys)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", testDef.Keys, err)
+		}
+	}
+}
+
+func TestSelectPackageService(t *testing.T) {
+	prefix := "db-sync-1.0.0-default-"
+	services := []*DockerService{
+		{ContainerName: prefix + "postgres"},
+		{ContainerName: prefix + "db-sync"},
+	}
+	testDefs := []struct {
+		Services      []*DockerService
+		ContainerName string
+		Expected      string
+		Error         bool
+	}{
+		{
+			Services:      services,
+			ContainerName: "db-sync",
+			Expected:      prefix + "db-sync",
+		},
+		{
+			Services: services[:1],
+			Expected: prefix + "postgres",
+		},
+		{
+			Services: services,
+			Error:    true,
+		},
+		{
+			Services:      services,
+			ContainerName: "kupo",
+			Error:         true,
+		},
+	}
+	for _, testDef := range testDefs {
+		svc, err := selectPackageService(
+			testDef.Services,
+			prefix,
+			"db-sync",
+			testDef.ContainerName,
+		)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for container %q", testDef.ContainerName)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if svc.ContainerName != testDef.Expected {
+			t.Fatalf(
+				"did not get expected service: got %s, expected %s",
+				svc.ContainerName,
+				testDef.Expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// bindMountOptions are the options that Docker accepts for a bind mount or volume
+var bindMountOptions = map[string]bool{
+	"ro":         true,
+	"rw":         true,
+	"z":          true,
+	"Z":          true,
+	"shared":     true,
+	"rshared":    true,
+	"slave":      true,
+	"rslave":     true,
+	"private":    true,
+	"rprivate":   true,
+	"nocopy":     true,
+	"consistent": true,
+	"cached":     true,
+	"delegated":  true,
+}
+
+// splitBind splits a bind mount in the Docker -v flag format into the host side and the container
+// side, which includes any mount options. The container path is always absolute, which allows
+// for Windows host paths containing a drive letter
+func splitBind(bind string) (string, string, bool) {
+	idx := strings.LastIndex(bind, ":/")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return bind[:idx], bind[idx+1:], true
+}
+
+// bindContainerPath returns the container path for a bind mount in the Docker -v flag format
+func bindContainerPath(bind string) string {
+	_, containerPart, ok := splitBind(bind)
+	if !ok {
+		return ""
+	}
+	return strings.SplitN(containerPart, ":", 2)[0]
+}
+
+// validateBind checks a rendered bind mount in the Docker -v flag format, which is either an
+// anonymous volume (a container path) or a host path or volume name, a container path, and
+// optional mount options separated by colons
+func validateBind(bind string) error {
+	hostPart, containerPart, ok := splitBind(bind)
+	if !ok {
+		if path.IsAbs(bind) && !strings.Contains(bind, ":") {
+			// Anonymous volume
+			return nil
+		}
+		return errors.New(
+			"expected <host path>:<container path>[:<options>], with an absolute container path",
+		)
+	}
+	if !filepath.IsAbs(hostPart) {
+		reVolume := regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+		if !reVolume.Match([]byte(hostPart)) {
+			return fmt.Errorf(
+				"host path %q must be an absolute path or a volume name",
+				hostPart,
+			)
+		}
+	}
+	containerParts := strings.Split(containerPart, ":")
+	if len(containerParts) > 2 {
+		return fmt.Errorf(
+			"container side %q has too many colons, expected <container path>[:<options>]",
+			containerPart,
+		)
+	}
+	if len(containerParts) == 2 {
+		for _, opt := range strings.Split(containerParts[1], ",") {
+			if !bindMountOptions[opt] {
+				return fmt.Errorf("unknown mount option %q", opt)
+			}
+		}
+	}
+	return nil
+}
+
+// validateBindOverride checks that a bind override uses an absolute path on both sides
+func validateBindOverride(bind string) error {
+	hostPath, _, ok := splitBind(bind)
+	if !ok {
+		return NewInvalidBindOverrideError(bind)
+	}
+	if !filepath.IsAbs(hostPath) || !path.IsAbs(bindContainerPath(bind)) {
+		return NewInvalidBindOverrideError(bind)
+	}
+	return nil
+}
+
+// resolveBindOverrides returns the bind overrides for each container in the package, keyed by
+// the container name in the install step. An override applies to every container with a bind
+// mount for the same container path. Overrides that don't match any bind mount are added to the
+// container for packages with only one container. The template in the provided config must
+// include the package template vars
+func (p Package) resolveBindOverrides(
+	cfg Config,
+	pkgName string,
+	overrides []string,
+) (map[string][]string, error) {
+	if len(overrides) == 0 {
+		return nil, nil
+	}
+	// Gather the container paths for the bind mounts in each container
+	containerPaths := make(map[string][]string)
+	var containerNames []string
+	for _, installStep := range p.InstallSteps {
+		if installStep.Docker == nil || installStep.Docker.PullOnly {
+			continue
+		}
+		containerNames = append(containerNames, installStep.Docker.ContainerName)
+		extraVars := containerTemplateVars(
+			fmt.Sprintf("%s-%s", pkgName, installStep.Docker.ContainerName),
+		)
+		for _, bind := range installStep.Docker.Binds {
+			tmpBind, err := cfg.Template.Render(bind, extraVars)
+			if err != nil {
+				return nil, err
+			}
+			containerPaths[installStep.Docker.ContainerName] = append(
+				containerPaths[installStep.Docker.ContainerName],
+				bindContainerPath(tmpBind),
+			)
+		}
+	}
+	ret := make(map[string][]string)
+	for _, override := range overrides {
+		overridePath := bindContainerPath(override)
+		foundMatch := false
+		for _, containerName := range containerNames {
+			for _, containerPath := range containerPaths[containerName] {
+				if containerPath == overridePath {
+					ret[containerName] = append(ret[containerName], override)
+					foundMatch = true
+					break
+				}
+			}
+		}
+		if foundMatch {
+			continue
+		}
+		if len(containerNames) != 1 {
+			return nil, NewBindOverrideNoMatchError(override, p.instanceName())
+		}
+		ret[containerNames[0]] = append(ret[containerNames[0]], override)
+	}
+	return ret, nil
+}
+
+// applyBindOverrides replaces the bind mounts for the same container path as an override and
+// adds the remaining overrides
+func applyBindOverrides(binds []string, overrides []string) []string {
+	if len(overrides) == 0 {
+		return binds
+	}
+	ret := make([]string, 0, len(binds)+len(overrides))
+	usedOverrides := make(map[string]bool)
+	for _, bind := range binds {
+		tmpBind := bind
+		for _, override := range overrides {
+			if bindContainerPath(override) == bindContainerPath(bind) {
+				tmpBind = override
+				usedOverrides[override] = true
+				break
+			}
+		}
+		ret = append(ret, tmpBind)
+	}
+	for _, override := range overrides {
+		if !usedOverrides[override] {
+			ret = append(ret, override)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateBind(t *testing.T) {
+	testDefs := []struct {
+		bind    string
+		wantErr bool
+	}{
+		{bind: "/mnt/db:/data/db"},
+		{bind: "/mnt/db:/data/db:ro"},
+		{bind: "/mnt/db:/data/db:ro,z"},
+		{bind: "db-volume:/data/db"},
+		{bind: "/data/db"},
+		{bind: "relative/db:/data/db", wantErr: true},
+		{bind: ":/data/db", wantErr: true},
+		{bind: "/mnt/db:data/db", wantErr: true},
+		{bind: "/mnt/db:/data/db:ro:z", wantErr: true},
+		{bind: "/mnt/db:/data/db:readonly", wantErr: true},
+		{bind: "data/db", wantErr: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateBind(testDef.bind)
+		if testDef.wantErr && err == nil {
+			t.Fatalf("did not get expected error for %q", testDef.bind)
+		}
+		if !testDef.wantErr && err != nil {
+			t.Fatalf("unexpected error for %q: %s", testDef.bind, err)
+		}
+	}
+}
+
+func TestValidateBindOverride(t *testing.T) {
+	testDefs := []struct {
+		bind    string
+		wantErr bool
+	}{
+		{bind: "/mnt/db:/data/db"},
+		{bind: "/mnt/db:/data/db:ro"},
+		{bind: "relative/db:/data/db", wantErr: true},
+		{bind: "/mnt/db:data/db", wantErr: true},
+		{bind: "/mnt/db", wantErr: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateBindOverride(testDef.bind)
+		if testDef.wantErr && err == nil {
+			t.Fatalf("did not get expected error for %q", testDef.bind)
+		}
+		if !testDef.wantErr && err != nil {
+			t.Fatalf("unexpected error for %q: %s", testDef.bind, err)
+		}
+	}
+}
+
+func TestResolveBindOverrides(t *testing.T) {
+	pkg := Package{
+		Name:    "node",
+		Version: "1.0.0",
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "node",
+					Binds: []string{
+						"{{ .Paths.DataDir }}/db:/data/db",
+						"{{ .Paths.DataDir }}/config:/config:ro",
+					},
+				},
+			},
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "exporter",
+					Binds:         []string{"{{ .Paths.DataDir }}/config:/config:ro"},
+				},
+			},
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "image",
+					PullOnly:      true,
+				},
+			},
+		},
+	}
+	cfg := Config{
+		Template: NewTemplate(
+			map[string]any{"Paths": map[string]string{"DataDir": "/data/node"}},
+		),
+	}
+	overrides, err := pkg.resolveBindOverrides(
+		cfg,
+		"node-1.0.0-default",
+		[]string{"/mnt/db:/data/db", "/etc/node:/config:ro"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string][]string{
+		"node":     {"/mnt/db:/data/db", "/etc/node:/config:ro"},
+		"exporter": {"/etc/node:/config:ro"},
+	}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Fatalf("did not get expected overrides: got %v, expected %v", overrides, expected)
+	}
+	// Overrides for other container paths can't be added to a package with multiple containers
+	if _, err := pkg.resolveBindOverrides(
+		cfg,
+		"node-1.0.0-default",
+		[]string{"/mnt/extra:/extra"},
+	); err == nil {
+		t.Fatalf("did not get expected error for unmatched bind override")
+	}
+	pkg.InstallSteps = pkg.InstallSteps[:1]
+	overrides, err = pkg.resolveBindOverrides(
+		cfg,
+		"node-1.0.0-default",
+		[]string{"/mnt/extra:/extra"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(overrides["node"], []string{"/mnt/extra:/extra"}) {
+		t.Fatalf("did not get expected overrides: got %v", overrides)
+	}
+}
+
+func TestApplyBindOverrides(t *testing.T) {
+	binds := []string{
+		"/data/node/db:/data/db",
+		"/data/node/config:/config:ro",
+	}
+	got := applyBindOverrides(
+		binds,
+		[]string{"/mnt/extra:/extra", `C:\cardano\db:/data/db`},
+	)
+	expected := []string{
+		`C:\cardano\db:/data/db`,
+		"/data/node/config:/config:ro",
+		"/mnt/extra:/extra",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("did not get expected binds: got %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// defaultUpgradeHealthTimeout is the amount of time to wait for the new version of a stateful
+	// package to become healthy when no timeout is configured
+	defaultUpgradeHealthTimeout = 5 * time.Minute
+
+	// upgradeHealthInterval is the amount of time between health checks of the new version of a
+	// stateful package
+	upgradeHealthInterval = 2 * time.Second
+
+	// upgradeSettleTime is the amount of time that a container without a Docker health check
+	// must stay running before it's considered healthy
+	upgradeSettleTime = 15 * time.Second
+
+	// upgradeOldPortsOwnerSuffix is added to the port registry owner to hold the host ports of
+	// the old version of a stateful package while the new version is installed alongside it
+	upgradeOldPortsOwnerSuffix = "#old"
+)
+
+// containerHealth is the state of a container that's checked when upgrading a stateful package
+type containerHealth struct {
+	Name      string
+	Running   bool
+	ExitCode  int
+	StartedAt time.Time
+	// Health is the status of the Docker health check, or empty if there isn't one
+	Health string
+}
+
+// healthy returns whether the container is healthy. An error is returned for a container that
+// has stopped or failed its health check, since waiting longer won't help
+func (c containerHealth) healthy(now time.Time, settleTime time.Duration) (bool, error) {
+	if !c.Running {
+		return false, NewContainerUnhealthyError(
+			c.Name,
+			fmt.Sprintf("exited with status %d", c.ExitCode),
+		)
+	}
+	switch c.Health {
+	case "healthy":
+		return true, nil
+	case "unhealthy":
+		return false, NewContainerUnhealthyError(c.Name, "health check failed")
+	case "":
+		return now.Sub(c.StartedAt) >= settleTime, nil
+	}
+	// The health check hasn't finished yet
+	return false, nil
+}
+
+// useBlueGreenUpgrade returns whether a package is upgraded by installing the new version
+// alongside the old one
+func (p *PackageManager) useBlueGreenUpgrade(upgradePkg ResolverUpgradeSet, cfg Config) bool {
+	if !upgradePkg.Upgrade.Stateful || upgradePkg.Installed.IsEmpty() {
+		return false
+	}
+	if remote, err := cfg.remoteHost(); err != nil || remote != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf(
+				"upgrading stateful package %s in place, since its data is on a remote Docker host",
+				upgradePkg.Installed.InstanceName(),
+			),
+		)
+		return false
+	}
+	return true
+}
+
+// upgradeBlueGreen upgrades a stateful package by installing the new version alongside the old
+// one with a copy of the old package data, which any migrations are run against. The old version
+// is only removed once the containers for the new version are healthy, and is left running if
+// anything fails
+func (p *PackageManager) upgradeBlueGreen(
+	upgradePkg ResolverUpgradeSet,
+	installCfg Config,
+	context string,
+	opts map[string]any,
+) (string, []InstalledPackageNote, map[string]string, error) {
+	oldPkg := upgradePkg.Installed.Package
+	newPkg := upgradePkg.Upgrade
+	oldPkgName := fmt.Sprintf("%s-%s-%s", oldPkg.instanceName(), oldPkg.Version, context)
+	newPkgName := fmt.Sprintf("%s-%s-%s", newPkg.instanceName(), newPkg.Version, context)
+	// Copy the package data for the new version, so that the old version can keep using its own
+	oldDataDir := installCfg.packageDataDir(oldPkgName)
+	newDataDir := installCfg.packageDataDir(newPkgName)
+	if _, err := os.Stat(newDataDir); err == nil {
+		return "", nil, nil, NewUpgradeDataDirExistsError(newDataDir)
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf("Copying package data from %s to %s", oldDataDir, newDataDir),
+	)
+	if err := copyDir(oldDataDir, newDataDir); err != nil {
+		p.removeUpgradeDirs(installCfg, newPkgName)
+		return "", nil, nil, fmt.Errorf("failed to copy package data: %w", err)
+	}
+	// Hold the host ports of the old version under another owner, so that the new version is
+	// allocated different host ports while both are running
+	owner := portOwner(newPkg, context)
+	oldOwner := owner + upgradeOldPortsOwnerSuffix
+	p.state.Ports.move(owner, oldOwner)
+	restoreOld := func() {
+		p.state.Ports.Release(owner)
+		p.state.Ports.move(oldOwner, owner)
+		p.removeUpgradeDirs(installCfg, newPkgName)
+		// The migrated copy of the package data was removed, so the migrations run again
+		p.clearMigrations(newPkg, context)
+		p.config.Logger.Warn(
+			fmt.Sprintf(
+				"keeping package %s (= %s) after failed upgrade",
+				upgradePkg.Installed.InstanceName(),
+				oldPkg.Version,
+			),
+		)
+	}
+	// Migrate the copy of the package data
+	if err := p.runMigrations(upgradePkg, installCfg, context); err != nil {
+		restoreOld()
+		return "", nil, nil, err
+	}
+	// Install the new version. The install steps are rolled back on failure
+	notes, pkgNotes, outputs, err := newPkg.install(installCfg, context, opts, false)
+	if err != nil {
+		restoreOld()
+		return "", nil, nil, err
+	}
+	if err := p.waitHealthy(installCfg, newPkg, context); err != nil {
+		newPkg.rollbackInstallSteps(installCfg, newPkgName, newPkg.InstallSteps)
+		restoreOld()
+		return "", nil, nil, err
+	}
+	// Remove the old version now that the new one is healthy
+	if err := p.deactivatePackage(p.config, oldPkg, context); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to deactivate package: %s", err),
+		)
+	}
+	if err := p.uninstallPackage(upgradePkg.Installed, true, true, false); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to remove old package version: %s", err),
+		)
+	}
+	p.state.Ports.Release(oldOwner)
+	return notes, pkgNotes, outputs, nil
+}
+
+// waitHealthy waits for the containers of an installed package to become healthy. Containers with
+// a Docker health check must report healthy, and containers without one must stay running for
+// upgradeSettleTime
+func (p *PackageManager) waitHealthy(cfg Config, pkg Package, context string) error {
+	timeout := cfg.UpgradeHealthTimeout
+	if timeout <= 0 {
+		timeout = defaultUpgradeHealthTimeout
+	}
+	pkgName := fmt.Sprintf("%s-%s-%s", pkg.instanceName(), pkg.Version, context)
+	svcs, err := pkg.services(cfg, context)
+	if err != nil {
+		return err
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf("Waiting for containers for package %s to become healthy", pkgName),
+	)
+	deadline := time.Now().Add(timeout)
+	for {
+		allHealthy := true
+		for _, svc := range svcs {
+			state, err := svc.healthState()
+			if err != nil {
+				return err
+			}
+			healthy, err := state.healthy(time.Now(), upgradeSettleTime)
+			if err != nil {
+				return err
+			}
+			if !healthy {
+				allHealthy = false
+			}
+		}
+		if allHealthy {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return NewUpgradeHealthTimeoutError(pkgName, timeout)
+		}
+		select {
+		case <-cfg.ctx().Done():
+			return cfg.ctx().Err()
+		case <-time.After(upgradeHealthInterval):
+		}
+	}
+}
+
+// removeUpgradeDirs removes the data and cache dirs created for the new version of a package after
+// a failed upgrade
+func (p *PackageManager) removeUpgradeDirs(cfg Config, pkgName string) {
+	for _, tmpDir := range []string{
+		cfg.packageDataDir(pkgName),
+		filepath.Join(cfg.CacheDir, pkgName),
+	} {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			p.config.Logger.Warn(
+				fmt.Sprintf("failed to remove directory %q: %s", tmpDir, err),
+			)
+		}
+	}
+}
+
+// copyDir copies a dir recursively, keeping file modes and symlinks. Other special files, such as
+// sockets, are skipped. A missing source dir results in an empty destination dir
+func copyDir(srcDir string, destDir string) error {
+	if _, err := os.Stat(srcDir); errors.Is(err, fs.ErrNotExist) {
+		return os.MkdirAll(destDir, fs.ModePerm)
+	}
+	return filepath.WalkDir(
+		srcDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			destPath := filepath.Join(destDir, relPath)
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			switch {
+			case d.IsDir():
+				return os.MkdirAll(destPath, info.Mode().Perm())
+			case d.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				return os.Symlink(target, destPath)
+			case d.Type().IsRegular():
+				return copyFile(path, destPath, info.Mode().Perm())
+			}
+			return nil
+		},
+	)
+}
+
+func copyFile(srcPath string, destPath string, mode fs.FileMode) (retErr error) {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	destFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = errors.Join(retErr, destFile.Close())
+	}()
+	_, err = io.Copy(destFile, srcFile)
+	return err
+}
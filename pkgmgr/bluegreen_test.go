@@ -0,0 +1,123 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContainerHealthHealthy(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testDefs := []struct {
+		State   containerHealth
+		Healthy bool
+		Error   bool
+	}{
+		{
+			State:   containerHealth{Running: true, Health: "healthy", StartedAt: now},
+			Healthy: true,
+		},
+		{
+			State: containerHealth{Running: true, Health: "starting", StartedAt: now},
+		},
+		{
+			State: containerHealth{Running: true, Health: "unhealthy", StartedAt: now},
+			Error: true,
+		},
+		{
+			State: containerHealth{Running: false, ExitCode: 1, StartedAt: now},
+			Error: true,
+		},
+		{
+			// Containers without a health check must stay running for the settle time
+			State: containerHealth{Running: true, StartedAt: now.Add(-5 * time.Second)},
+		},
+		{
+			State:   containerHealth{Running: true, StartedAt: now.Add(-time.Minute)},
+			Healthy: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		healthy, err := testDef.State.healthy(now, upgradeSettleTime)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for container state: %#v", testDef.State)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if healthy != testDef.Healthy {
+			t.Fatalf(
+				"did not get expected result for container state %#v: got %v",
+				testDef.State,
+				healthy,
+			)
+		}
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	destDir := filepath.Join(tmpDir, "dest")
+	if err := os.MkdirAll(filepath.Join(srcDir, "db", "immutable"), fs.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(
+		filepath.Join(srcDir, "db", "immutable", "00000.chunk"),
+		[]byte("chunk"),
+		0o600,
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink("db/immutable", filepath.Join(srcDir, "immutable")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := copyDir(srcDir, destDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(destDir, "immutable", "00000.chunk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "chunk" {
+		t.Fatalf("did not get expected file content: %q", content)
+	}
+	stat, err := os.Stat(filepath.Join(destDir, "db", "immutable", "00000.chunk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stat.Mode().Perm() != 0o600 {
+		t.Fatalf("did not get expected file mode: %s", stat.Mode())
+	}
+	target, err := os.Readlink(filepath.Join(destDir, "immutable"))
+	if err != nil || target != "db/immutable" {
+		t.Fatalf("did not get expected symlink: %q: %v", target, err)
+	}
+	// A missing source dir results in an empty dir
+	emptyDir := filepath.Join(tmpDir, "empty")
+	if err := copyDir(filepath.Join(tmpDir, "missing"), emptyDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(emptyDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+func (p Package) validateChangelog() error {
+	if p.ReleaseNotesUrl == "" {
+		return nil
+	}
+	tmpUrl, err := url.Parse(p.ReleaseNotesUrl)
+	if err != nil || (tmpUrl.Scheme != "http" && tmpUrl.Scheme != "https") ||
+		tmpUrl.Host == "" {
+		return fmt.Errorf("invalid release notes URL: %s", p.ReleaseNotesUrl)
+	}
+	return nil
+}
+
+// UpgradeChange describes a package that will be upgraded, or installed as a new dependency
+type UpgradeChange struct {
+	// Package is the instance name of the package
+	Package string
+	// InstalledVersion is the installed version of the package, or empty for a new dependency
+	InstalledVersion string
+	Version          string
+	// Changelog has the changelog of each available version after the installed version, up to
+	// and including the new version, in version order
+	Changelog []ChangelogEntry
+	// ReleaseNotesUrl is the release notes URL for the new version
+	ReleaseNotesUrl string
+	// Migrations are the names of the data migrations that will run, in order
+	Migrations []string
+}
+
+// ChangelogEntry is the changelog for a single version of a package
+type ChangelogEntry struct {
+	Version   string
+	Changelog string
+}
+
+// UpgradeChanges returns the packages that upgrading the specified packages in the active context
+// will upgrade or install, along with the changelog for each
+func (p *PackageManager) UpgradeChanges(pkgs ...string) ([]UpgradeChange, error) {
+	activeContextName, _ := p.CurrentContext()
+	availablePkgs := p.availablePackagesWithLocal()
+	resolver, err := NewResolver(
+		p.InstalledPackages(),
+		availablePkgs,
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	upgradePkgs, err := resolver.Upgrade(pkgs...)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]UpgradeChange, 0, len(upgradePkgs))
+	for _, upgradePkg := range upgradePkgs {
+		change := UpgradeChange{
+			Package:         upgradePkg.Upgrade.instanceName(),
+			Version:         upgradePkg.Upgrade.Version,
+			ReleaseNotesUrl: upgradePkg.Upgrade.ReleaseNotesUrl,
+		}
+		if !upgradePkg.Installed.IsEmpty() {
+			change.InstalledVersion = upgradePkg.Installed.Package.Version
+			change.Changelog = changelogBetween(
+				availablePkgs,
+				upgradePkg.Upgrade.Name,
+				change.InstalledVersion,
+				change.Version,
+			)
+			for _, migration := range upgradePkg.Upgrade.pendingMigrations(change.InstalledVersion) {
+				change.Migrations = append(change.Migrations, migration.Name)
+			}
+		}
+		ret = append(ret, change)
+	}
+	return ret, nil
+}
+
+// changelogBetween returns the changelogs of the available versions of a package after the
+// installed version, up to and including the target version, in version order
+func changelogBetween(
+	pkgs []Package,
+	pkgName string,
+	installedVersion string,
+	targetVersion string,
+) []ChangelogEntry {
+	var ret []ChangelogEntry
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if pkg.Name != pkgName || pkg.Changelog == "" || seen[pkg.Version] {
+			continue
+		}
+		if !versionNewer(pkg.Version, installedVersion) ||
+			versionNewer(pkg.Version, targetVersion) {
+			continue
+		}
+		seen[pkg.Version] = true
+		ret = append(
+			ret,
+			ChangelogEntry{
+				Version:   pkg.Version,
+				Changelog: pkg.Changelog,
+			},
+		)
+	}
+	sort.Slice(
+		ret,
+		func(i, j int) bool {
+			return versionNewer(ret[j].Version, ret[i].Version)
+		},
+	)
+	return ret
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageValidateChangelog(t *testing.T) {
+	testDefs := []struct {
+		Package Package
+		Error   bool
+	}{
+		{Package: Package{}},
+		{Package: Package{ReleaseNotesUrl: "https://example.com/releases/1.0.0"}},
+		{Package: Package{ReleaseNotesUrl: "example.com/releases/1.0.0"}, Error: true},
+		{Package: Package{ReleaseNotesUrl: "ftp://example.com/releases"}, Error: true},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.Package.validateChangelog()
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for package: %#v", testDef.Package)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestUpgradeChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.availablePackages = []Package{
+		{Name: "node", Version: "1.0.0", Changelog: "Initial release"},
+		{Name: "node", Version: "1.2.0", Changelog: "Faster sync"},
+		{
+			Name:            "node",
+			Version:         "1.10.0",
+			Changelog:       "Hard fork support",
+			ReleaseNotesUrl: "https://example.com/node/1.10.0",
+			Dependencies:    []PackageDependency{{Name: "mithril"}},
+		},
+		{Name: "node", Version: "1.1.0"},
+		{Name: "mithril", Version: "1.0.0", Changelog: "Initial release"},
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	changes, err := pm.UpgradeChanges("node")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []UpgradeChange{
+		{
+			Package:          "node",
+			InstalledVersion: "1.0.0",
+			Version:          "1.10.0",
+			Changelog: []ChangelogEntry{
+				{Version: "1.2.0", Changelog: "Faster sync"},
+				{Version: "1.10.0", Changelog: "Hard fork support"},
+			},
+			ReleaseNotesUrl: "https://example.com/node/1.10.0",
+		},
+		{
+			// New dependencies don't have a changelog
+			Package: "mithril",
+			Version: "1.0.0",
+		},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("did not get expected changes\n  got: %#v\n  expected: %#v", changes, expected)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// nodeSocketName is the name of the socket declared by the node package
+	nodeSocketName = "node"
+
+	cardanoCliCommand = "cardano-cli"
+)
+
+// CliOptions controls running cardano-cli with Cli
+type CliOptions struct {
+	// Tty allocates a pseudo-terminal for the command
+	Tty    bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Cli runs cardano-cli with the provided args in the container that creates the node socket for
+// the active context. The socket path and network are provided via the CARDANO_NODE_SOCKET_PATH
+// and CARDANO_NODE_NETWORK_ID env vars, so they don't need to be passed as flags. The exit code
+// of cardano-cli is returned
+func (p *PackageManager) Cli(args []string, opts CliOptions) (int, error) {
+	activeContextName, activeContext := p.CurrentContext()
+	svc, socket, err := p.nodeService(activeContextName)
+	if err != nil {
+		return 0, err
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return 0, err
+	}
+	if !running {
+		return 0, NewContainerNotRunningError(svc.ContainerName)
+	}
+	return svc.Exec(
+		append([]string{cardanoCliCommand}, args...),
+		cliEnv(activeContext, socket),
+		opts.Tty,
+		opts.Stdin,
+		opts.Stdout,
+		opts.Stderr,
+	)
+}
+
+// nodeService returns the service for the container that creates the node socket, which is
+// provided by the primary instance of a package installed in the context
+func (p *PackageManager) nodeService(context string) (*DockerService, PackageSocket, error) {
+	for _, installedPkg := range p.InstalledPackages() {
+		if installedPkg.Instance != "" {
+			continue
+		}
+		for _, socket := range installedPkg.Package.Sockets {
+			if socket.Name != nodeSocketName {
+				continue
+			}
+			pkgName := fmt.Sprintf(
+				"%s-%s-%s",
+				installedPkg.Package.instanceName(),
+				installedPkg.Package.Version,
+				context,
+			)
+			for _, installStep := range installedPkg.Package.InstallSteps {
+				if installStep.Docker == nil || !installStep.Docker.usesSocket(nodeSocketName) {
+					continue
+				}
+				svc, err := newDockerService(
+					p.config,
+					fmt.Sprintf("%s-%s", pkgName, installStep.Docker.ContainerName),
+				)
+				if err != nil {
+					return nil, PackageSocket{}, err
+				}
+				return svc, socket, nil
+			}
+		}
+	}
+	return nil, PackageSocket{}, NewNodeNotInstalledError(context)
+}
+
+// cliEnv returns the env vars for running cardano-cli against the node socket for the context
+func cliEnv(context Context, socket PackageSocket) []string {
+	ret := []string{
+		"CARDANO_NODE_SOCKET_PATH=" + socket.ContainerPath,
+	}
+	if context.Network == "mainnet" {
+		ret = append(ret, "CARDANO_NODE_NETWORK_ID=mainnet")
+	} else if context.NetworkMagic != 0 {
+		ret = append(
+			ret,
+			"CARDANO_NODE_NETWORK_ID="+strconv.FormatUint(uint64(context.NetworkMagic), 10),
+		)
+	}
+	return ret
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cliCommandNameRe matches valid names for package CLI commands
+var cliCommandNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// PackageCliCommand declares a command provided by a package, which can be run with
+// cardano-up x <package> <command> once the package is installed
+type PackageCliCommand struct {
+	Name        string `yaml:"name" jsonschema:"required"`
+	Description string `yaml:"description,omitempty"`
+	// Exec is the command to run, with each element evaluated as a template. Any args provided
+	// when running the command are appended
+	Exec []string `yaml:"exec" jsonschema:"required"`
+	// ContainerName is the container to run the command in. The command runs on the host when
+	// this isn't specified
+	ContainerName string `yaml:"containerName,omitempty"`
+	// Env is the env vars for the command, with each value evaluated as a template
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+func (c PackageCliCommand) validate(pkg Package) error {
+	if !cliCommandNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid CLI command name: %q", c.Name)
+	}
+	if len(c.Exec) == 0 || c.Exec[0] == "" {
+		return fmt.Errorf("CLI command %s must specify a command to run", c.Name)
+	}
+	if c.ContainerName != "" && !pkg.declaresContainer(c.ContainerName) {
+		return fmt.Errorf(
+			"container %q for CLI command %s does not match any docker install step",
+			c.ContainerName,
+			c.Name,
+		)
+	}
+	return nil
+}
+
+// CliCommand is a command provided by an installed package
+type CliCommand struct {
+	// Package is the instance name of the package
+	Package     string
+	Name        string
+	Description string
+	// Host is set for commands that run on the host rather than in a package container
+	Host bool
+}
+
+// CliCommands returns the commands provided by the installed packages in the active context, or
+// only by the specified package, sorted by package and command name
+func (p *PackageManager) CliCommands(pkgName string) ([]CliCommand, error) {
+	var installedPkgs []InstalledPackage
+	if pkgName != "" {
+		installedPkg, err := p.cliCommandPackage(pkgName)
+		if err != nil {
+			return nil, err
+		}
+		installedPkgs = append(installedPkgs, installedPkg)
+	} else {
+		installedPkgs = p.InstalledPackages()
+	}
+	var ret []CliCommand
+	for _, installedPkg := range installedPkgs {
+		for _, cliCommand := range installedPkg.Package.CliCommands {
+			ret = append(
+				ret,
+				CliCommand{
+					Package:     installedPkg.InstanceName(),
+					Name:        cliCommand.Name,
+					Description: cliCommand.Description,
+					Host:        cliCommand.ContainerName == "",
+				},
+			)
+		}
+	}
+	sort.Slice(
+		ret,
+		func(i, j int) bool {
+			if ret[i].Package != ret[j].Package {
+				return ret[i].Package < ret[j].Package
+			}
+			return ret[i].Name < ret[j].Name
+		},
+	)
+	return ret, nil
+}
+
+// RunCliCommand runs a command provided by an installed package in the active context, with the
+// provided args appended. Commands that run on the host from registries that aren't trusted need
+// approval, in the same way as hook scripts. The exit code of the command is returned
+func (p *PackageManager) RunCliCommand(
+	pkgName string,
+	name string,
+	args []string,
+	opts CliOptions,
+) (int, error) {
+	installedPkg, err := p.cliCommandPackage(pkgName)
+	if err != nil {
+		return 0, err
+	}
+	var cliCommand *PackageCliCommand
+	var names []string
+	for idx, tmpCommand := range installedPkg.Package.CliCommands {
+		if tmpCommand.Name == name {
+			cliCommand = &installedPkg.Package.CliCommands[idx]
+		}
+		names = append(names, tmpCommand.Name)
+	}
+	if cliCommand == nil {
+		return 0, NewCliCommandNotFoundError(pkgName, name, names)
+	}
+	cmd, env, err := p.renderCliCommand(installedPkg, *cliCommand)
+	if err != nil {
+		return 0, err
+	}
+	cmd = append(cmd, args...)
+	if cliCommand.ContainerName == "" {
+		return p.runHostCliCommand(installedPkg, name, cmd, env, opts)
+	}
+	svc, err := p.packageService(pkgName, cliCommand.ContainerName)
+	if err != nil {
+		return 0, err
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return 0, err
+	}
+	if !running {
+		return 0, NewContainerNotRunningError(svc.ContainerName)
+	}
+	return svc.Exec(cmd, env, opts.Tty, opts.Stdin, opts.Stdout, opts.Stderr)
+}
+
+// cliCommandPackage returns the installed package with the provided name in the active context
+func (p *PackageManager) cliCommandPackage(pkgName string) (InstalledPackage, error) {
+	for _, installedPkg := range p.InstalledPackages() {
+		if installedPkg.InstanceName() == pkgName {
+			return installedPkg, nil
+		}
+	}
+	activeContextName, _ := p.CurrentContext()
+	return InstalledPackage{}, NewPackageNotInstalledError(pkgName, activeContextName)
+}
+
+// renderCliCommand renders the command and env vars for a package CLI command with the template
+// vars for the installed package
+func (p *PackageManager) renderCliCommand(
+	installedPkg InstalledPackage,
+	cliCommand PackageCliCommand,
+) ([]string, []string, error) {
+	tmpl := p.installedPackageTemplate(installedPkg)
+	cmd := make([]string, 0, len(cliCommand.Exec))
+	for _, value := range cliCommand.Exec {
+		rendered, err := tmpl.Render(value, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"failed to render CLI command %s: %w",
+				cliCommand.Name,
+				err,
+			)
+		}
+		cmd = append(cmd, rendered)
+	}
+	var envKeys []string
+	for key := range cliCommand.Env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	env := make([]string, 0, len(envKeys))
+	for _, key := range envKeys {
+		rendered, err := tmpl.Render(cliCommand.Env[key], nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"failed to render env var %s for CLI command %s: %w",
+				key,
+				cliCommand.Name,
+				err,
+			)
+		}
+		env = append(env, key+"="+rendered)
+	}
+	return cmd, env, nil
+}
+
+// runHostCliCommand runs a package CLI command on the host and returns its exit code
+func (p *PackageManager) runHostCliCommand(
+	installedPkg InstalledPackage,
+	name string,
+	cmd []string,
+	env []string,
+	opts CliOptions,
+) (int, error) {
+	pkg := installedPkg.Package
+	pkg.origin = installedPkg.Origin
+	if !pkg.hookTrusted(p.config) {
+		script := HookScript{
+			Package:  installedPkg.InstanceName(),
+			Hook:     "CLI command " + name,
+			Script:   strings.Join(cmd, " "),
+			Registry: p.config.registrySource(),
+		}
+		approved := false
+		if p.config.Hooks.Approve != nil {
+			var err error
+			approved, err = p.config.Hooks.Approve(script)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if !approved {
+			return 0, NewCliCommandNotApprovedError(name, installedPkg.InstanceName())
+		}
+	}
+	hostCmd := exec.CommandContext(p.config.ctx(), cmd[0], cmd[1:]...)
+	hostCmd.Env = append(os.Environ(), env...)
+	hostCmd.Stdin = opts.Stdin
+	hostCmd.Stdout = opts.Stdout
+	hostCmd.Stderr = opts.Stderr
+	err := hostCmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
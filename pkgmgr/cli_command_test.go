@@ -0,0 +1,179 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageCliCommandValidate(t *testing.T) {
+	pkg := Package{
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "ogmios",
+					Image:         "cardanosolutions/ogmios:v6.11.0",
+				},
+			},
+		},
+	}
+	testDefs := []struct {
+		cliCommand PackageCliCommand
+		valid      bool
+	}{
+		{
+			cliCommand: PackageCliCommand{
+				Name:          "health",
+				Exec:          []string{"curl", "-s", "http://localhost:1337/health"},
+				ContainerName: "ogmios",
+			},
+			valid: true,
+		},
+		{
+			cliCommand: PackageCliCommand{
+				Name: "open-dashboard",
+				Exec: []string{"xdg-open", "http://localhost:{{ freePort 1337 }}"},
+			},
+			valid: true,
+		},
+		{
+			cliCommand: PackageCliCommand{
+				Name: "Health",
+				Exec: []string{"curl"},
+			},
+		},
+		{
+			cliCommand: PackageCliCommand{
+				Name: "health",
+			},
+		},
+		{
+			cliCommand: PackageCliCommand{
+				Name: "health",
+				Exec: []string{""},
+			},
+		},
+		{
+			cliCommand: PackageCliCommand{
+				Name:          "health",
+				Exec:          []string{"curl"},
+				ContainerName: "missing",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.cliCommand.validate(pkg)
+		if testDef.valid && err != nil {
+			t.Fatalf("unexpected error for %+v: %s", testDef.cliCommand, err)
+		}
+		if !testDef.valid && err == nil {
+			t.Fatalf("did not get expected error for %+v", testDef.cliCommand)
+		}
+	}
+}
+
+func TestCliCommands(t *testing.T) {
+	ogmiosPkg := Package{
+		Name:    "ogmios",
+		Version: "6.11.0",
+		CliCommands: []PackageCliCommand{
+			{Name: "health", Description: "Show health", ContainerName: "ogmios"},
+			{Name: "dashboard", Description: "Open the dashboard"},
+		},
+	}
+	pm := &PackageManager{
+		state: &State{
+			ActiveContext: "mainnet",
+			InstalledPackages: []InstalledPackage{
+				{Package: ogmiosPkg, Context: "preview"},
+				{Package: ogmiosPkg, Context: "mainnet"},
+				{Package: Package{Name: "cardano-node", Version: "10.1.4"}, Context: "mainnet"},
+			},
+		},
+	}
+	cliCommands, err := pm.CliCommands("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []CliCommand{
+		{Package: "ogmios", Name: "dashboard", Description: "Open the dashboard", Host: true},
+		{Package: "ogmios", Name: "health", Description: "Show health"},
+	}
+	if !reflect.DeepEqual(cliCommands, expected) {
+		t.Fatalf("did not get expected CLI commands: %+v", cliCommands)
+	}
+	cliCommands, err = pm.CliCommands("cardano-node")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cliCommands) != 0 {
+		t.Fatalf("got unexpected CLI commands: %+v", cliCommands)
+	}
+	if _, err := pm.CliCommands("missing"); err == nil {
+		t.Fatalf("did not get expected error for package that isn't installed")
+	}
+	if _, err := pm.RunCliCommand("ogmios", "missing", nil, CliOptions{}); err == nil {
+		t.Fatalf("did not get expected error for unknown CLI command")
+	}
+}
+
+func TestRenderCliCommand(t *testing.T) {
+	installedPkg := InstalledPackage{
+		Package: Package{
+			Name:    "ogmios",
+			Version: "6.11.0",
+		},
+		Context: "mainnet",
+	}
+	pm := &PackageManager{
+		config: Config{
+			Template: NewTemplate(nil),
+		},
+		state: &State{
+			Contexts: map[string]Context{
+				"mainnet": {Network: "mainnet"},
+			},
+			Ports: PortRegistry{
+				"mainnet/ogmios": {1337: 31337},
+			},
+		},
+	}
+	cmd, env, err := pm.renderCliCommand(
+		installedPkg,
+		PackageCliCommand{
+			Name: "health",
+			Exec: []string{
+				"curl",
+				"http://localhost:{{ freePort 1337 }}/health",
+			},
+			Env: map[string]string{
+				"PACKAGE": "{{ .Package.ShortName }}",
+				"NETWORK": "{{ .Context.Network }}",
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedCmd := []string{"curl", "http://localhost:31337/health"}
+	if !reflect.DeepEqual(cmd, expectedCmd) {
+		t.Fatalf("did not get expected command: %v", cmd)
+	}
+	expectedEnv := []string{"NETWORK=mainnet", "PACKAGE=ogmios"}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Fatalf("did not get expected env: %v", env)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCliEnv(t *testing.T) {
+	socket := PackageSocket{
+		Name:          "node",
+		ContainerPath: "/ipc/node.socket",
+	}
+	testDefs := []struct {
+		context  Context
+		expected []string
+	}{
+		{
+			context: Context{Network: "mainnet", NetworkMagic: 764824073},
+			expected: []string{
+				"CARDANO_NODE_SOCKET_PATH=/ipc/node.socket",
+				"CARDANO_NODE_NETWORK_ID=mainnet",
+			},
+		},
+		{
+			context: Context{Network: "preview", NetworkMagic: 2},
+			expected: []string{
+				"CARDANO_NODE_SOCKET_PATH=/ipc/node.socket",
+				"CARDANO_NODE_NETWORK_ID=2",
+			},
+		},
+		{
+			context: Context{},
+			expected: []string{
+				"CARDANO_NODE_SOCKET_PATH=/ipc/node.socket",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		env := cliEnv(testDef.context, socket)
+		if !reflect.DeepEqual(env, testDef.expected) {
+			t.Fatalf(
+				"did not get expected env for network %q: got %v, expected %v",
+				testDef.context.Network,
+				env,
+				testDef.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// composeDefaultNetwork is the name of the network that Compose services are connected to when
+// they don't specify any networks
+const composeDefaultNetwork = "default"
+
+// PackageInstallStepCompose manages the services from a Compose file as containers. Each service
+// is managed the same as a docker install step with the service name as the container name
+type PackageInstallStepCompose struct {
+	// Source is the path to the Compose file, relative to the package manifest dir. It's loaded
+	// into Content along with the package
+	Source string `yaml:"source,omitempty"`
+	// Content is the inline content of the Compose file
+	Content string `yaml:"content,omitempty"`
+}
+
+func (p *PackageInstallStepCompose) validate(cfg Config) error {
+	if p.Content == "" {
+		return fmt.Errorf("compose file source or content must be provided")
+	}
+	// Templated Compose files are checked when rendered
+	if strings.Contains(p.Content, "{{") {
+		return nil
+	}
+	_, err := p.dockerSteps(cfg, "validate")
+	return err
+}
+
+// loadSource loads the content of the Compose file from the source file, relative to the package
+// manifest at the provided path
+func (p *PackageInstallStepCompose) loadSource(packagePath string) error {
+	if p.Source == "" {
+		return nil
+	}
+	content, err := os.ReadFile(
+		filepath.Join(filepath.Dir(packagePath), p.Source),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load compose file: %w", err)
+	}
+	p.Content = string(content)
+	return nil
+}
+
+// loadComposeSources loads the content of the Compose files with a source file for the package,
+// so that they're available when the package is installed, including after the package manifest
+// is no longer available
+func (p Package) loadComposeSources() error {
+	for _, installStep := range p.InstallSteps {
+		if installStep.Compose == nil {
+			continue
+		}
+		if err := installStep.Compose.loadSource(p.filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containerSteps returns the docker install steps for the package, including those for the
+// services in Compose files. Compose files that can't be loaded are logged and skipped
+func (p Package) containerSteps(cfg Config, pkgName string) []*PackageInstallStepDocker {
+	var ret []*PackageInstallStepDocker
+	for _, installStep := range p.InstallSteps {
+		if installStep.Docker != nil {
+			ret = append(ret, installStep.Docker)
+		}
+		if installStep.Compose != nil {
+			steps, err := installStep.Compose.dockerSteps(cfg, pkgName)
+			if err != nil {
+				cfg.Logger.Warn(
+					fmt.Sprintf(
+						"failed to load compose file for package %s: %s",
+						pkgName,
+						err,
+					),
+				)
+				continue
+			}
+			ret = append(ret, steps...)
+		}
+	}
+	return ret
+}
+
+// declaresContainer returns whether a docker install step of the package creates the container
+// with the provided name. Containers for Compose services aren't known until install, so any name
+// is accepted for packages with compose install steps
+func (p Package) declaresContainer(containerName string) bool {
+	for _, installStep := range p.InstallSteps {
+		if installStep.Compose != nil {
+			return true
+		}
+		if installStep.Docker != nil && installStep.Docker.ContainerName == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// composeNetworkName returns the name of the Docker network for the services in a Compose file
+func composeNetworkName(pkgName string) string {
+	return pkgName
+}
+
+// install creates and starts the containers for the services in the Compose file. The field is the
+// path to the install step in the package manifest, which is used in errors for invalid values
+func (p *PackageInstallStepCompose) install(cfg Config, pkgName string, field string) error {
+	steps, err := p.dockerSteps(cfg, pkgName)
+	if err != nil {
+		return err
+	}
+	networkName := composeNetworkName(pkgName)
+	if _, err := createDockerNetwork(
+		cfg.ctx(),
+		cfg.DockerHost,
+		networkName,
+		"",
+		"",
+	); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err := step.install(
+			cfg,
+			pkgName,
+			fmt.Sprintf("%s.services.%s", field, step.ContainerName),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstall removes the containers for the services in reverse dependency order, followed by the
+// network for the services
+func (p *PackageInstallStepCompose) uninstall(
+	cfg Config,
+	pkgName string,
+	logsDir string,
+	keepImage bool,
+) error {
+	steps, err := p.dockerSteps(cfg, pkgName)
+	if err != nil {
+		return err
+	}
+	for idx := len(steps) - 1; idx >= 0; idx-- {
+		if err := steps[idx].uninstall(cfg, pkgName, logsDir, keepImage); err != nil {
+			return err
+		}
+	}
+	networkName := composeNetworkName(pkgName)
+	connected, err := removeDockerNetwork(cfg.ctx(), cfg.DockerHost, networkName)
+	if err != nil {
+		return err
+	}
+	if len(connected) > 0 {
+		cfg.Logger.Warn(
+			fmt.Sprintf(
+				"keeping network %s, which still has containers connected: %s",
+				networkName,
+				strings.Join(connected, ", "),
+			),
+		)
+	}
+	return nil
+}
+
+// load renders the Compose file and loads it. Relative paths are resolved against the package
+// data dir
+func (p *PackageInstallStepCompose) load(cfg Config, pkgName string) (*types.Project, error) {
+	content, err := cfg.Template.Render(p.Content, nil)
+	if err != nil {
+		return nil, err
+	}
+	project, err := loader.LoadWithContext(
+		cfg.ctx(),
+		types.ConfigDetails{
+			WorkingDir: cfg.packageDataDir(pkgName),
+			ConfigFiles: []types.ConfigFile{
+				{
+					Filename: "compose.yaml",
+					Content:  []byte(content),
+				},
+			},
+			Environment: types.Mapping{},
+		},
+		func(o *loader.Options) {
+			o.SetProjectName(loader.NormalizeProjectName(pkgName), true)
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compose file: %w", err)
+	}
+	return project, nil
+}
+
+// dockerSteps returns a docker install step for each service in the Compose file, ordered so that
+// services come after the services that they depend on
+func (p *PackageInstallStepCompose) dockerSteps(
+	cfg Config,
+	pkgName string,
+) ([]*PackageInstallStepDocker, error) {
+	project, err := p.load(cfg, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*PackageInstallStepDocker
+	added := make(map[string]bool)
+	var addService func(name string) error
+	addService = func(name string) error {
+		if added[name] {
+			return nil
+		}
+		added[name] = true
+		service, ok := project.Services[name]
+		if !ok {
+			return fmt.Errorf("compose service %s not found", name)
+		}
+		var dependencies []string
+		for dependency := range service.DependsOn {
+			dependencies = append(dependencies, dependency)
+		}
+		sort.Strings(dependencies)
+		for _, dependency := range dependencies {
+			if err := addService(dependency); err != nil {
+				return err
+			}
+		}
+		step, err := composeServiceStep(cfg, pkgName, project, service)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, step)
+		return nil
+	}
+	serviceNames := project.ServiceNames()
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		if err := addService(name); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// composeServiceStep converts a Compose service into a docker install step. Named volumes are
+// stored in the package data dir, the same as bind mounts in the package data dir for docker
+// install steps, and services can reach each other by service name
+func composeServiceStep(
+	cfg Config,
+	pkgName string,
+	project *types.Project,
+	service types.ServiceConfig,
+) (*PackageInstallStepDocker, error) {
+	if service.Image == "" {
+		return nil, fmt.Errorf("compose service %s must specify an image", service.Name)
+	}
+	if service.NetworkMode != "" {
+		return nil, fmt.Errorf(
+			"compose service %s: network_mode is not supported",
+			service.Name,
+		)
+	}
+	for networkName := range service.Networks {
+		if networkName != composeDefaultNetwork {
+			return nil, fmt.Errorf(
+				"compose service %s: networks other than the default network are not supported",
+				service.Name,
+			)
+		}
+	}
+	ret := &PackageInstallStepDocker{
+		ContainerName:  service.Name,
+		Image:          service.Image,
+		Env:            map[string]string{},
+		Command:        service.Entrypoint,
+		Args:           service.Command,
+		Devices:        service.Devices,
+		StopSignal:     service.StopSignal,
+		Platform:       service.Platform,
+		User:           service.User,
+		Dns:            service.DNS,
+		CapAdd:         service.CapAdd,
+		CapDrop:        service.CapDrop,
+		ReadOnly:       service.ReadOnly,
+		Tmpfs:          service.Tmpfs,
+		Interactive:    service.Tty || service.StdinOpen,
+		rendered:       true,
+		dockerNetworks: []string{composeNetworkName(pkgName)},
+		networkAliases: []string{service.Name},
+	}
+	// Services run as the default user for the image unless they specify a user, the same as
+	// with Docker Compose
+	if ret.User == "" {
+		ret.User = containerUserImage
+	}
+	for k, v := range service.Environment {
+		// Variables without a value are taken from the environment, which isn't available
+		if v != nil {
+			ret.Env[k] = *v
+		}
+	}
+	for _, port := range service.Ports {
+		tmpPort := strconv.FormatUint(uint64(port.Target), 10)
+		if port.Published != "" {
+			tmpPort = port.Published + ":" + tmpPort
+			if port.HostIP != "" {
+				tmpPort = port.HostIP + ":" + tmpPort
+			}
+		}
+		if port.Protocol != "" && port.Protocol != "tcp" {
+			tmpPort += "/" + port.Protocol
+		}
+		ret.Ports = append(ret.Ports, tmpPort)
+	}
+	for _, volume := range service.Volumes {
+		bindSource := volume.Source
+		switch volume.Type {
+		case types.VolumeTypeBind:
+		case types.VolumeTypeVolume:
+			// Named volumes are stored in the package data dir, unless they're external
+			if bindSource != "" && !project.Volumes[bindSource].External {
+				bindSource = filepath.Join(cfg.packageDataDir(pkgName), bindSource)
+			}
+		case types.VolumeTypeTmpfs:
+			ret.Tmpfs = append(ret.Tmpfs, composeTmpfs(volume))
+			continue
+		default:
+			return nil, fmt.Errorf(
+				"compose service %s: %s volumes are not supported",
+				service.Name,
+				volume.Type,
+			)
+		}
+		tmpBind := volume.Target
+		if bindSource != "" {
+			tmpBind = bindSource + ":" + tmpBind
+		}
+		if volume.ReadOnly {
+			tmpBind += ":ro"
+		}
+		ret.Binds = append(ret.Binds, tmpBind)
+	}
+	if service.StopGracePeriod != nil {
+		stopTimeout := int(time.Duration(*service.StopGracePeriod).Seconds())
+		ret.StopTimeout = &stopTimeout
+	}
+	for host, ips := range service.ExtraHosts {
+		for _, ip := range ips {
+			ret.ExtraHosts = append(ret.ExtraHosts, host+":"+ip)
+		}
+	}
+	sort.Strings(ret.ExtraHosts)
+	if len(service.Sysctls) > 0 {
+		ret.Sysctls = map[string]string(service.Sysctls)
+	}
+	for name, ulimit := range service.Ulimits {
+		if ulimit.Single != 0 {
+			ret.Ulimits = append(ret.Ulimits, fmt.Sprintf("%s=%d", name, ulimit.Single))
+			continue
+		}
+		ret.Ulimits = append(
+			ret.Ulimits,
+			fmt.Sprintf("%s=%d:%d", name, ulimit.Soft, ulimit.Hard),
+		)
+	}
+	sort.Strings(ret.Ulimits)
+	if service.ShmSize > 0 {
+		ret.ShmSize = strconv.FormatInt(int64(service.ShmSize), 10)
+	}
+	if err := ret.validate(cfg); err != nil {
+		return nil, fmt.Errorf("compose service %s: %w", service.Name, err)
+	}
+	return ret, nil
+}
+
+// composeTmpfs converts a tmpfs volume from a Compose file to the Docker --tmpfs flag format
+func composeTmpfs(volume types.ServiceVolumeConfig) string {
+	var opts []string
+	if volume.Tmpfs != nil {
+		if volume.Tmpfs.Size > 0 {
+			opts = append(opts, fmt.Sprintf("size=%d", volume.Tmpfs.Size))
+		}
+		if volume.Tmpfs.Mode > 0 {
+			opts = append(opts, fmt.Sprintf("mode=%o", volume.Tmpfs.Mode))
+		}
+	}
+	if volume.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	if len(opts) == 0 {
+		return volume.Target
+	}
+	return volume.Target + ":" + strings.Join(opts, ",")
+}
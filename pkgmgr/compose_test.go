@@ -0,0 +1,228 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackageInstallStepComposeDockerSteps(t *testing.T) {
+	cfg := Config{
+		DataDir:  "/data",
+		Template: NewTemplate(map[string]any{"Image": "postgres:16"}),
+	}
+	step := PackageInstallStepCompose{
+		Content: `
+services:
+  db-sync:
+    image: example/db-sync
+    depends_on:
+      - postgres
+    command: ["--config", "/config/db-sync.yaml"]
+    environment:
+      POSTGRES_HOST: postgres
+    ports:
+      - "127.0.0.1:8080:8080"
+    volumes:
+      - db-sync-data:/var/lib/db-sync
+      - ./config:/config:ro
+      - type: tmpfs
+        target: /scratch
+        tmpfs:
+          size: 1048576
+    tmpfs:
+      - /tmp
+    stdin_open: true
+    tty: true
+  postgres:
+    image: {{ .Image }}
+    user: "999"
+    ports:
+      - "5432/udp"
+    volumes:
+      - postgres-data:/var/lib/postgresql/data
+      - external-data:/external
+volumes:
+  db-sync-data:
+  postgres-data:
+  external-data:
+    external: true
+`,
+	}
+	steps, err := step.dockerSteps(cfg, "foo-1.0.0-default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("did not get expected number of steps: %d", len(steps))
+	}
+	// Dependencies come first
+	postgres, dbSync := steps[0], steps[1]
+	if postgres.ContainerName != "postgres" || dbSync.ContainerName != "db-sync" {
+		t.Fatalf(
+			"did not get expected step order: %s, %s",
+			postgres.ContainerName,
+			dbSync.ContainerName,
+		)
+	}
+	if postgres.Image != "postgres:16" || postgres.User != "999" {
+		t.Fatalf("did not get expected postgres step: %#v", postgres)
+	}
+	expectedBinds := []string{
+		"/data/foo-1.0.0-default/postgres-data:/var/lib/postgresql/data",
+		"external-data:/external",
+	}
+	if !reflect.DeepEqual(postgres.Binds, expectedBinds) {
+		t.Fatalf(
+			"did not get expected binds\n  got: %v\n  expected: %v",
+			postgres.Binds,
+			expectedBinds,
+		)
+	}
+	if !reflect.DeepEqual(postgres.Ports, []string{"5432/udp"}) {
+		t.Fatalf("did not get expected ports: %v", postgres.Ports)
+	}
+	if dbSync.User != containerUserImage {
+		t.Fatalf("did not get expected user: %s", dbSync.User)
+	}
+	expectedArgs := []string{"--config", "/config/db-sync.yaml"}
+	if !reflect.DeepEqual(dbSync.Args, expectedArgs) {
+		t.Fatalf("did not get expected args: %v", dbSync.Args)
+	}
+	if dbSync.Env["POSTGRES_HOST"] != "postgres" {
+		t.Fatalf("did not get expected env: %v", dbSync.Env)
+	}
+	if !reflect.DeepEqual(dbSync.Ports, []string{"127.0.0.1:8080:8080"}) {
+		t.Fatalf("did not get expected ports: %v", dbSync.Ports)
+	}
+	expectedBinds = []string{
+		"/data/foo-1.0.0-default/db-sync-data:/var/lib/db-sync",
+		"/data/foo-1.0.0-default/config:/config:ro",
+	}
+	if !reflect.DeepEqual(dbSync.Binds, expectedBinds) {
+		t.Fatalf(
+			"did not get expected binds\n  got: %v\n  expected: %v",
+			dbSync.Binds,
+			expectedBinds,
+		)
+	}
+	expectedTmpfs := []string{"/tmp", "/scratch:size=1048576"}
+	if !reflect.DeepEqual(dbSync.Tmpfs, expectedTmpfs) {
+		t.Fatalf(
+			"did not get expected tmpfs mounts\n  got: %v\n  expected: %v",
+			dbSync.Tmpfs,
+			expectedTmpfs,
+		)
+	}
+	if !dbSync.Interactive || postgres.Interactive {
+		t.Fatalf(
+			"did not get expected interactive flags: db-sync %t, postgres %t",
+			dbSync.Interactive,
+			postgres.Interactive,
+		)
+	}
+	// Services are rendered as-is and can reach each other by service name
+	svc, err := dbSync.render(cfg, "foo-1.0.0-default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if svc.ContainerName != "foo-1.0.0-default-db-sync" ||
+		!reflect.DeepEqual(svc.Networks, []string{"foo-1.0.0-default"}) ||
+		!reflect.DeepEqual(svc.networkAliases, []string{"db-sync"}) {
+		t.Fatalf("did not get expected service: %#v", svc)
+	}
+}
+
+func TestPackageInstallStepComposeValidate(t *testing.T) {
+	testDefs := []struct {
+		Content string
+		Error   bool
+	}{
+		{
+			Content: "services:\n  foo:\n    image: example/foo\n",
+		},
+		{
+			// Templated content is checked when rendered
+			Content: "services:\n  foo:\n    image: {{ .Image }}\n",
+		},
+		{
+			Content: "",
+			Error:   true,
+		},
+		{
+			Content: "services:\n  foo:\n    build: .\n",
+			Error:   true,
+		},
+		{
+			Content: "services:\n  foo:\n    image: example/foo\n    network_mode: host\n",
+			Error:   true,
+		},
+		{
+			Content: "services:\n  foo:\n    image: example/foo\n    networks:\n      - other\nnetworks:\n  other:\n",
+			Error:   true,
+		},
+		{
+			Content: "services:\n  foo:\n    image: example/foo\n    volumes:\n      - type: tmpfs\n        target: /tmp\n",
+		},
+		{
+			Content: "services:\n  foo:\n    image: example/foo\n    volumes:\n      - type: npipe\n        source: foo\n        target: /foo\n",
+			Error:   true,
+		},
+	}
+	cfg := Config{
+		DataDir:  "/data",
+		Template: NewTemplate(nil),
+	}
+	for _, testDef := range testDefs {
+		step := PackageInstallStepCompose{Content: testDef.Content}
+		err := step.validate(cfg)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for compose file:\n%s", testDef.Content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestPackageInstallStepComposeLoadSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "services:\n  foo:\n    image: example/foo\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "compose.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg := Package{
+		InstallSteps: []PackageInstallStep{
+			{Compose: &PackageInstallStepCompose{Source: "compose.yaml"}},
+		},
+		filePath: filepath.Join(tmpDir, "package.yaml"),
+	}
+	if err := pkg.loadComposeSources(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pkg.InstallSteps[0].Compose.Content != content {
+		t.Fatalf("did not get expected content: %s", pkg.InstallSteps[0].Compose.Content)
+	}
+	pkg.InstallSteps[0].Compose.Source = "missing.yaml"
+	if err := pkg.loadComposeSources(); err == nil {
+		t.Fatalf("did not get expected error")
+	}
+}
@@ -15,14 +15,28 @@
 package pkgmgr
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"time"
+)
+
+const (
+	// HomeEnvVar is the env var for a home dir that contains all of the cardano-up dirs, rather
+	// than using the default user dirs
+	HomeEnvVar = "CARDANO_UP_HOME"
+
+	// profilesDirName is the dir in the home dir that contains the home dir for each profile
+	profilesDirName = "profiles"
 )
 
 type Config struct {
+	// Context is used for cancellation of long-running operations. It defaults to context.Background()
+	Context             context.Context
 	BinDir              string
 	CacheDir            string
 	ConfigDir           string
@@ -33,6 +47,119 @@ type Config struct {
 	RequiredPackageTags []string
 	RegistryUrl         string
 	RegistryDir         string
+	RegistryAuth        RegistryAuth
+	Http                HttpConfig
+	Hooks               HookConfig
+	// RegistryStrictFreshness fetches the registry before using it when the cache is stale,
+	// rather than using the stale cache while it's refreshed in the background
+	RegistryStrictFreshness bool
+	// RegistryRefresh is called to refresh the stale registry cache in the background, such as by
+	// calling RefreshRegistry in a separate process. The cache is refreshed in a goroutine when
+	// not set, which won't complete if the process exits first
+	RegistryRefresh func()
+	// Offline disables network access. The registry is only loaded from the existing cache, and
+	// fetching it, submitting usage stats and looking up image download sizes are skipped
+	Offline bool
+	// StopTimeout is the default amount of time to wait for a container to stop before killing
+	// it, for packages that don't specify their own
+	StopTimeout time.Duration
+	// ContainerLogs controls persisting container logs to files, for packages that don't
+	// specify their own settings
+	ContainerLogs ContainerLogsConfig
+	// DockerHost is the Docker host URL used for packages, in the DOCKER_HOST format. It's set
+	// from the active context, and DOCKER_HOST or the default local socket is used when empty
+	DockerHost string
+	// RemoteDataDir is the dir on a remote (SSH) Docker host that local data dir paths used in
+	// container bind mounts are translated to. It's set from the active context
+	RemoteDataDir string
+	// ContainerUser is the user that containers run as, for install steps that don't specify
+	// their own. It's set from the active context, and the local user is used when empty
+	ContainerUser string
+	// PackageDataDir is the dir that package data dirs are created in. It's set from the data root
+	// of the active context, and DataDir is used when empty
+	PackageDataDir string
+	// BindOverrides are bind mounts in the Docker -v flag format that replace the package bind
+	// mounts for the same container path, for the packages explicitly requested for install
+	BindOverrides []string
+	// EnvOverrides are env vars in KEY=VALUE format that override or add to the env vars of the
+	// containers, for the packages explicitly requested for install
+	EnvOverrides []string
+	// ConfigProfile is the built-in config profile for the requested packages when installing.
+	// The default profile is used when empty
+	ConfigProfile string
+	// SecretsKeyFile is the path to the key used to encrypt stored secrets. It defaults to a
+	// file in the data dir, and must not be inside the config dir
+	SecretsKeyFile string
+	// DockerRetry controls retrying image pulls and Docker API calls that fail with transient
+	// errors
+	DockerRetry RetryConfig
+	// WaitForLock waits for other cardano-up processes to finish their operations, rather than
+	// failing with ErrOperationInProgress
+	WaitForLock bool
+	// AdoptContainers takes over existing containers with the names expected by a package being
+	// installed, if they match the package, rather than failing with ErrContainerAlreadyExists
+	AdoptContainers bool
+	// IgnoreDiskSpace installs packages even when the data dir or Docker filesystem doesn't have
+	// the free space that they require
+	IgnoreDiskSpace bool
+	// UpgradeHealthTimeout is the amount of time to wait for the new version of a stateful package
+	// to become healthy before falling back to the old version. It defaults to 5 minutes
+	UpgradeHealthTimeout time.Duration
+	// SkipTests skips running the package tests after packages are installed or upgraded
+	SkipTests bool
+	// Color enables colored table output, such as in package info. This should only be enabled
+	// when the output is a terminal
+	Color bool
+	// secrets holds the secret values available to the package being installed
+	secrets map[string]string
+	// sockets holds the sockets available to the package being installed
+	sockets map[string]socketMount
+	// bindOverrides holds the bind overrides for the package being installed
+	bindOverrides []string
+	// containerBindOverrides holds the bind overrides for each container in the package being
+	// installed, keyed by the container name in the install step
+	containerBindOverrides map[string][]string
+	// envOverrides holds the env overrides for the containers of the package being installed
+	envOverrides []string
+	// contextName is the context for the package being installed or uninstalled
+	contextName string
+	// hookResults collects the results of the hook scripts run for the package being installed
+	hookResults *[]HookResult
+	// sharedNetworks is the networks declared by the package that are also used by other
+	// installed packages, which are kept when uninstalling it
+	sharedNetworks map[string]bool
+	// otherVersionInstalled is set when another version of the package being uninstalled is
+	// still installed, which keeps the logs dir and networks shared with it
+	otherVersionInstalled bool
+}
+
+// ctx returns the configured context or a background context if none was provided
+func (c Config) ctx() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
+}
+
+// packageDataDir returns the data dir for the package with the given full name
+func (c Config) packageDataDir(pkgName string) string {
+	if c.PackageDataDir != "" {
+		return filepath.Join(c.PackageDataDir, pkgName)
+	}
+	return filepath.Join(c.DataDir, pkgName)
+}
+
+// RegistryAuth holds credentials used when fetching the package registry from RegistryUrl.
+// A bearer token takes precedence over a username/password. If neither is provided,
+// credentials are looked up in the user's netrc file
+type RegistryAuth struct {
+	Username string
+	Password string
+	Token    string
+}
+
+func (a RegistryAuth) IsEmpty() bool {
+	return a.Username == "" && a.Password == "" && a.Token == ""
 }
 
 func NewDefaultConfig() (Config, error) {
@@ -80,6 +207,78 @@ func NewDefaultConfig() (Config, error) {
 			runtime.GOARCH,
 		},
 		RegistryUrl: "https://github.com/blinklabs-io/cardano-up-packages/archive/refs/heads/main.zip",
+		Http: HttpConfig{
+			Timeout:      defaultHttpTimeout,
+			Retries:      defaultHttpRetries,
+			RetryBackoff: defaultHttpRetryBackoff,
+		},
+		DockerRetry: RetryConfig{
+			Retries: defaultDockerRetries,
+			Backoff: defaultDockerRetryBackoff,
+		},
+		ContainerLogs: ContainerLogsConfig{
+			MaxSize:  defaultContainerLogsMaxSize,
+			MaxFiles: defaultContainerLogsMaxFiles,
+		},
+	}
+	if homeDir := os.Getenv(HomeEnvVar); homeDir != "" {
+		ret.setHomeDir(homeDir)
+	}
+	return ret, nil
+}
+
+// NewProfileConfig returns the default config for a named profile. Each profile has its own home
+// dir containing all of its dirs, so that it doesn't share any state with the default installation
+// or other profiles. The profile home dirs are in the home dir from the CARDANO_UP_HOME env var, if
+// set, or in the user data dir. The default config is returned for an empty profile name
+func NewProfileConfig(profile string) (Config, error) {
+	if profile == "" {
+		return NewDefaultConfig()
+	}
+	if err := validateProfileName(profile); err != nil {
+		return Config{}, err
+	}
+	ret, err := NewDefaultConfig()
+	if err != nil {
+		return Config{}, err
+	}
+	profilesDir, err := profilesDir()
+	if err != nil {
+		return Config{}, err
 	}
+	ret.setHomeDir(filepath.Join(profilesDir, profile))
 	return ret, nil
 }
+
+// setHomeDir puts all of the cardano-up dirs in the given home dir
+func (c *Config) setHomeDir(homeDir string) {
+	c.BinDir = filepath.Join(homeDir, "bin")
+	c.CacheDir = filepath.Join(homeDir, "cache")
+	c.ConfigDir = filepath.Join(homeDir, "config")
+	c.DataDir = filepath.Join(homeDir, "data")
+}
+
+// profilesDir returns the dir containing the home dir for each profile
+func profilesDir() (string, error) {
+	if homeDir := os.Getenv(HomeEnvVar); homeDir != "" {
+		return filepath.Join(homeDir, profilesDirName), nil
+	}
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf(
+			"could not determine user home directory: %s",
+			err,
+		)
+	}
+	// This is next to the default data dir rather than in it, since context dirs are created in
+	// the data dir
+	return filepath.Join(userHomeDir, ".local/share/cardano-up-profiles"), nil
+}
+
+func validateProfileName(profile string) error {
+	reName := regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+	if !reName.Match([]byte(profile)) {
+		return NewInvalidProfileNameError(profile)
+	}
+	return nil
+}
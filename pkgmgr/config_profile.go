@@ -0,0 +1,127 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"sort"
+)
+
+// Built-in config profiles
+const (
+	ConfigProfileMinimal = "minimal"
+	ConfigProfileDefault = "default"
+	ConfigProfileSpo     = "spo"
+)
+
+// ConfigProfile is a built-in set of node config settings that can be selected when installing a
+// package. The settings are available to package templates as .Profile
+type ConfigProfile struct {
+	Name string
+	// MinSeverity is the minimum severity of the node log messages
+	MinSeverity string
+	// TraceMempool enables tracing of the mempool, which adds overhead but is useful for block
+	// producers
+	TraceMempool bool
+	// SnapshotInterval is the number of seconds between ledger snapshots
+	SnapshotInterval int
+	// NumOfDiskSnapshots is the number of ledger snapshots that are kept
+	NumOfDiskSnapshots int
+	// PeerSharing enables sharing peers with other nodes, which should be disabled for block
+	// producers
+	PeerSharing                    bool
+	TargetNumberOfKnownPeers       int
+	TargetNumberOfEstablishedPeers int
+	TargetNumberOfActivePeers      int
+}
+
+// configProfiles are the built-in config profiles
+var configProfiles = map[string]ConfigProfile{
+	// minimal reduces logging, disk I/O, and connections for low-resource hosts
+	ConfigProfileMinimal: {
+		Name:                           ConfigProfileMinimal,
+		MinSeverity:                    "Warning",
+		SnapshotInterval:               7200,
+		NumOfDiskSnapshots:             1,
+		PeerSharing:                    true,
+		TargetNumberOfKnownPeers:       50,
+		TargetNumberOfEstablishedPeers: 20,
+		TargetNumberOfActivePeers:      10,
+	},
+	// default matches the settings of the upstream node configs for relays
+	ConfigProfileDefault: {
+		Name:                           ConfigProfileDefault,
+		MinSeverity:                    "Info",
+		SnapshotInterval:               4320,
+		NumOfDiskSnapshots:             2,
+		PeerSharing:                    true,
+		TargetNumberOfKnownPeers:       150,
+		TargetNumberOfEstablishedPeers: 40,
+		TargetNumberOfActivePeers:      20,
+	},
+	// spo is for block producers, which trace the mempool, take ledger snapshots more often for
+	// faster restarts, and don't share peers
+	ConfigProfileSpo: {
+		Name:                           ConfigProfileSpo,
+		MinSeverity:                    "Info",
+		TraceMempool:                   true,
+		SnapshotInterval:               2160,
+		NumOfDiskSnapshots:             2,
+		TargetNumberOfKnownPeers:       150,
+		TargetNumberOfEstablishedPeers: 40,
+		TargetNumberOfActivePeers:      20,
+	},
+}
+
+// ConfigProfileNames returns the names of the built-in config profiles, in alphabetical order
+func ConfigProfileNames() []string {
+	ret := make([]string, 0, len(configProfiles))
+	for name := range configProfiles {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// validateConfigProfile checks that a config profile name is a built-in profile. An empty name
+// uses the default profile
+func validateConfigProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := configProfiles[name]; !ok {
+		return NewUnknownConfigProfileError(name, ConfigProfileNames())
+	}
+	return nil
+}
+
+// configProfileTemplateVars returns the template vars for the config profile with the specified
+// name, or for the default profile when the name is empty or unknown
+func configProfileTemplateVars(name string) map[string]any {
+	profile, ok := configProfiles[name]
+	if !ok {
+		profile = configProfiles[ConfigProfileDefault]
+	}
+	return map[string]any{
+		"Name":                           profile.Name,
+		"MinSeverity":                    profile.MinSeverity,
+		"TraceMempool":                   profile.TraceMempool,
+		"SnapshotInterval":               profile.SnapshotInterval,
+		"NumOfDiskSnapshots":             profile.NumOfDiskSnapshots,
+		"PeerSharing":                    profile.PeerSharing,
+		"TargetNumberOfKnownPeers":       profile.TargetNumberOfKnownPeers,
+		"TargetNumberOfEstablishedPeers": profile.TargetNumberOfEstablishedPeers,
+		"TargetNumberOfActivePeers":      profile.TargetNumberOfActivePeers,
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestValidateConfigProfile(t *testing.T) {
+	testDefs := []struct {
+		profile     string
+		expectError bool
+	}{
+		{profile: ""},
+		{profile: ConfigProfileMinimal},
+		{profile: ConfigProfileDefault},
+		{profile: ConfigProfileSpo},
+		{profile: "relay", expectError: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateConfigProfile(testDef.profile)
+		if testDef.expectError && err == nil {
+			t.Fatalf("did not get expected error for profile %q", testDef.profile)
+		}
+		if !testDef.expectError && err != nil {
+			t.Fatalf("unexpected error for profile %q: %s", testDef.profile, err)
+		}
+	}
+}
+
+func TestPackageTemplateVarsConfigProfile(t *testing.T) {
+	testDefs := []struct {
+		profile  string
+		expected string
+	}{
+		{profile: "", expected: "default Info false 4320 true"},
+		{profile: ConfigProfileMinimal, expected: "minimal Warning false 7200 true"},
+		{profile: ConfigProfileSpo, expected: "spo Info true 2160 false"},
+	}
+	for _, testDef := range testDefs {
+		pkg := Package{Name: "cardano-node", Version: "1.0.0", configProfile: testDef.profile}
+		tmpl := NewTemplate(nil).WithVars(pkg.templateVars(Config{}, "default", nil))
+		rendered, err := tmpl.Render(
+			"{{ .Profile.Name }} {{ .Profile.MinSeverity }} {{ .Profile.TraceMempool }} {{ .Profile.SnapshotInterval }} {{ .Profile.PeerSharing }}",
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rendered != testDef.expected {
+			t.Fatalf(
+				"did not get expected profile vars for %q: got %q, expected %q",
+				testDef.profile,
+				rendered,
+				testDef.expected,
+			)
+		}
+	}
+}
+
+func TestResolverUpgradeConfigProfile(t *testing.T) {
+	resolver, err := NewResolver(
+		[]InstalledPackage{
+			{
+				Package: Package{
+					Name:          "cardano-node",
+					Version:       "1.0.0",
+					configProfile: ConfigProfileSpo,
+				},
+				ConfigProfile: ConfigProfileSpo,
+				InstalledTime: time.Now(),
+			},
+		},
+		[]Package{
+			{Name: "cardano-node", Version: "1.0.0"},
+			{Name: "cardano-node", Version: "1.1.0"},
+		},
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	upgradeSets, err := resolver.Upgrade("cardano-node")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(upgradeSets) != 1 || upgradeSets[0].Upgrade.configProfile != ConfigProfileSpo {
+		t.Fatalf("did not get expected upgrade sets: %#v", upgradeSets)
+	}
+}
@@ -30,6 +30,7 @@ func TestNewDefaultConfig(t *testing.T) {
 			"HOME":            testHome,
 			"XDG_CONFIG_HOME": "",
 			"XDG_CACHE_HOME":  "",
+			"CARDANO_UP_HOME": "",
 		},
 	)
 	defer func() {
@@ -78,6 +79,7 @@ func TestNewDefaultConfigXdgConfigCacheEnvVars(t *testing.T) {
 			"HOME":            testHome,
 			"XDG_CONFIG_HOME": testXdgConfigHome,
 			"XDG_CACHE_HOME":  testXdgCacheHome,
+			"CARDANO_UP_HOME": "",
 		},
 	)
 	defer func() {
@@ -113,6 +115,7 @@ func TestNewDefaultConfigEmptyHome(t *testing.T) {
 			"HOME":            "",
 			"XDG_CONFIG_HOME": "",
 			"XDG_CACHE_HOME":  "",
+			"CARDANO_UP_HOME": "",
 		},
 	)
 	defer func() {
@@ -132,6 +135,96 @@ func TestNewDefaultConfigEmptyHome(t *testing.T) {
 	}
 }
 
+func TestNewDefaultConfigHomeEnvVar(t *testing.T) {
+	testHome := "/path/to/cardano-up-home"
+	origEnvVars := setEnvVars(
+		map[string]string{
+			"HOME":            "/path/to/user/home",
+			"CARDANO_UP_HOME": testHome,
+		},
+	)
+	defer func() {
+		setEnvVars(origEnvVars)
+	}()
+	cfg, err := pkgmgr.NewDefaultConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedDirs := map[string]string{
+		cfg.BinDir:    filepath.Join(testHome, "bin"),
+		cfg.CacheDir:  filepath.Join(testHome, "cache"),
+		cfg.ConfigDir: filepath.Join(testHome, "config"),
+		cfg.DataDir:   filepath.Join(testHome, "data"),
+	}
+	for dir, expectedDir := range expectedDirs {
+		if dir != expectedDir {
+			t.Fatalf("did not get expected dir, got %q, expected %q", dir, expectedDir)
+		}
+	}
+}
+
+func TestNewProfileConfig(t *testing.T) {
+	testDefs := []struct {
+		cardanoUpHome   string
+		profile         string
+		expectedHomeDir string
+		expectedErr     string
+	}{
+		{
+			profile:         "work",
+			expectedHomeDir: "/path/to/user/home/.local/share/cardano-up-profiles/work",
+		},
+		{
+			cardanoUpHome:   "/path/to/cardano-up-home",
+			profile:         "client-a",
+			expectedHomeDir: "/path/to/cardano-up-home/profiles/client-a",
+		},
+		{
+			profile:     "../work",
+			expectedErr: "invalid profile name: ../work",
+		},
+		{
+			profile:     ".work",
+			expectedErr: "invalid profile name: .work",
+		},
+	}
+	for _, testDef := range testDefs {
+		origEnvVars := setEnvVars(
+			map[string]string{
+				"HOME":            "/path/to/user/home",
+				"CARDANO_UP_HOME": testDef.cardanoUpHome,
+			},
+		)
+		cfg, err := pkgmgr.NewProfileConfig(testDef.profile)
+		setEnvVars(origEnvVars)
+		if testDef.expectedErr != "" {
+			if err == nil || err.Error() != testDef.expectedErr {
+				t.Fatalf(
+					"did not get expected error for profile %q, got %v, expected %q",
+					testDef.profile,
+					err,
+					testDef.expectedErr,
+				)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cfg.ConfigDir != filepath.Join(testDef.expectedHomeDir, "config") ||
+			cfg.CacheDir != filepath.Join(testDef.expectedHomeDir, "cache") ||
+			cfg.DataDir != filepath.Join(testDef.expectedHomeDir, "data") ||
+			cfg.BinDir != filepath.Join(testDef.expectedHomeDir, "bin") {
+			t.Fatalf(
+				"did not get expected dirs for profile %q in home dir %q: %#v",
+				testDef.profile,
+				testDef.expectedHomeDir,
+				cfg,
+			)
+		}
+	}
+}
+
 func setEnvVars(envVars map[string]string) map[string]string {
 	origVars := map[string]string{}
 	for k, v := range envVars {
@@ -0,0 +1,154 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ContainerEventActions are the Docker container event actions reported by ContainerEvents
+var ContainerEventActions = []string{
+	"start",
+	"stop",
+	"die",
+	"oom",
+}
+
+// ContainerEvent is a Docker event for a container managed by cardano-up
+type ContainerEvent struct {
+	Time          time.Time `json:"time"`
+	Action        string    `json:"action"`
+	Package       string    `json:"package"`
+	Version       string    `json:"version"`
+	Context       string    `json:"context"`
+	Container     string    `json:"container"`
+	ContainerName string    `json:"containerName"`
+	ExitCode      string    `json:"exitCode,omitempty"`
+	// Signal is the signal number sent to the container, for kill events
+	Signal string `json:"signal,omitempty"`
+	// stopSignal is the configured stop signal for the container, if any
+	stopSignal string
+}
+
+// ContainerEvents reports Docker events with the specified actions for containers of installed
+// packages in all contexts using the active Docker host to the provided handler. Events since the
+// provided time are included, unless it's zero. If follow is true, new events are reported until
+// the config context is cancelled, including for containers of packages installed or upgraded
+// after this is called
+func (p *PackageManager) ContainerEvents(
+	actions []string,
+	since time.Time,
+	follow bool,
+	handler func(ContainerEvent),
+) error {
+	containers := p.managedContainers()
+	if len(containers) == 0 && !follow {
+		return ErrNoManagedContainers
+	}
+	var containerNames []string
+	var until time.Time
+	// Container names include the package version, so events aren't filtered on the current
+	// container names when following
+	if !follow {
+		for containerName := range containers {
+			containerNames = append(containerNames, containerName)
+		}
+		until = time.Now()
+	}
+	ctx := p.config.ctx()
+	msgChan, errChan, err := dockerContainerEvents(
+		ctx,
+		p.config.DockerHost,
+		containerNames,
+		actions,
+		since,
+		until,
+	)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg := <-msgChan:
+			containerName := msg.Actor.Attributes["name"]
+			evt, ok := containers[containerName]
+			if !ok && follow {
+				// Reload the state to pick up packages installed since we started
+				if err := p.reloadState(); err != nil {
+					p.config.Logger.Warn(
+						fmt.Sprintf("failed to reload state: %s", err),
+					)
+					continue
+				}
+				containers = p.managedContainers()
+				evt, ok = containers[containerName]
+			}
+			if !ok {
+				continue
+			}
+			evt.Time = time.Unix(0, msg.TimeNano)
+			evt.Action = string(msg.Action)
+			evt.ExitCode = msg.Actor.Attributes["exitCode"]
+			evt.Signal = msg.Actor.Attributes["signal"]
+			handler(evt)
+		case err := <-errChan:
+			if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// managedContainers returns the container names for installed packages in all contexts using the
+// active Docker host, mapped to a partially populated event with the package details
+func (p *PackageManager) managedContainers() map[string]ContainerEvent {
+	ret := make(map[string]ContainerEvent)
+	for _, installedPkg := range p.InstalledPackagesAllContexts() {
+		if !p.usesActiveDockerHost(installedPkg.Context) {
+			continue
+		}
+		pkg := installedPkg.Package
+		pkgName := fmt.Sprintf(
+			"%s-%s-%s",
+			installedPkg.InstanceName(),
+			pkg.Version,
+			installedPkg.Context,
+		)
+		for _, installStep := range pkg.InstallSteps {
+			if installStep.Docker == nil || installStep.Docker.PullOnly {
+				continue
+			}
+			containerName := fmt.Sprintf(
+				"%s-%s",
+				pkgName,
+				installStep.Docker.ContainerName,
+			)
+			ret[containerName] = ContainerEvent{
+				Package:       installedPkg.InstanceName(),
+				Version:       pkg.Version,
+				Context:       installedPkg.Context,
+				Container:     installStep.Docker.ContainerName,
+				ContainerName: containerName,
+				stopSignal:    installStep.Docker.StopSignal,
+			}
+		}
+	}
+	return ret
+}
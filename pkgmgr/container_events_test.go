@@ -0,0 +1,77 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManagedContainers(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "foo",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "node",
+							Image:         "foo",
+						},
+					},
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "image",
+							Image:         "bar",
+							PullOnly:      true,
+						},
+					},
+				},
+			},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+	}
+	expected := map[string]ContainerEvent{
+		"foo-1.0.0-default-node": {
+			Package:       "foo",
+			Version:       "1.0.0",
+			Context:       "default",
+			Container:     "node",
+			ContainerName: "foo-1.0.0-default-node",
+		},
+	}
+	if containers := pm.managedContainers(); !reflect.DeepEqual(containers, expected) {
+		t.Fatalf(
+			"did not get expected containers\n  got: %#v\n  expected: %#v",
+			containers,
+			expected,
+		)
+	}
+}
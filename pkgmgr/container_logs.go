@@ -0,0 +1,612 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+const (
+	containerLogsDirName = "logs"
+
+	defaultContainerLogsMaxSize  = 10 * 1024 * 1024
+	defaultContainerLogsMaxFiles = 5
+
+	// containerLogsPositionInterval is how often the log position is saved while collecting logs
+	containerLogsPositionInterval = 5 * time.Second
+	// containerLogsPruneInterval is how often rotated log files are checked against the max age
+	// while collecting logs
+	containerLogsPruneInterval = time.Hour
+)
+
+// ContainerLogsConfig controls persisting container logs to files on disk, so
+// that they survive the container being removed and recreated
+type ContainerLogsConfig struct {
+	// Persist enables persisting container logs
+	Persist bool
+	// MaxSize is the size in bytes at which the log file is rotated
+	MaxSize int64
+	// MaxFiles is the number of rotated log files to keep
+	MaxFiles int
+	// MaxAge is the age at which rotated log files are removed. Zero means no limit
+	MaxAge time.Duration
+}
+
+// PackageInstallStepDockerLogs overrides the global container logs config for a docker install step
+type PackageInstallStepDockerLogs struct {
+	Persist  *bool  `yaml:"persist,omitempty"`
+	MaxSize  string `yaml:"maxSize,omitempty"`
+	MaxFiles int    `yaml:"maxFiles,omitempty"`
+	MaxAge   string `yaml:"maxAge,omitempty"`
+}
+
+func (p *PackageInstallStepDockerLogs) validate() error {
+	if p == nil {
+		return nil
+	}
+	_, err := p.apply(ContainerLogsConfig{})
+	return err
+}
+
+// apply returns the provided container logs config with any overrides from the install step applied
+func (p *PackageInstallStepDockerLogs) apply(
+	cfg ContainerLogsConfig,
+) (ContainerLogsConfig, error) {
+	if p == nil {
+		return cfg, nil
+	}
+	if p.Persist != nil {
+		cfg.Persist = *p.Persist
+	}
+	if p.MaxSize != "" {
+		maxSize, err := units.RAMInBytes(p.MaxSize)
+		if err != nil || maxSize <= 0 {
+			return cfg, fmt.Errorf("invalid docker logs max size: %s", p.MaxSize)
+		}
+		cfg.MaxSize = maxSize
+	}
+	if p.MaxFiles < 0 {
+		return cfg, fmt.Errorf("docker logs max files cannot be negative")
+	}
+	if p.MaxFiles > 0 {
+		cfg.MaxFiles = p.MaxFiles
+	}
+	if p.MaxAge != "" {
+		maxAge, err := time.ParseDuration(p.MaxAge)
+		if err != nil || maxAge < 0 {
+			return cfg, fmt.Errorf("invalid docker logs max age: %s", p.MaxAge)
+		}
+		cfg.MaxAge = maxAge
+	}
+	return cfg, nil
+}
+
+// containerLogsDir returns the directory for persisted container logs for a package. This lives
+// in the context dir so that it's not tied to a particular package version
+func containerLogsDir(cfg Config, context string, pkgShortName string) string {
+	return filepath.Join(
+		cfg.DataDir,
+		context,
+		containerLogsDirName,
+		pkgShortName,
+	)
+}
+
+// persistContainerLogs writes the logs for a container to a rotating log file. Only log lines
+// newer than the last line previously written to the log file are written, so that logs can be
+// collected repeatedly for the same container. If follow is true, new logs are written until the
+// container stops or the context is cancelled
+func persistContainerLogs(
+	cfg ContainerLogsConfig,
+	svc *DockerService,
+	logPath string,
+	follow bool,
+) error {
+	if err := os.MkdirAll(filepath.Dir(logPath), fs.ModePerm); err != nil {
+		return err
+	}
+	rw, err := newRotatingFileWriter(
+		logPath,
+		cfg.MaxSize,
+		cfg.MaxFiles,
+		cfg.MaxAge,
+	)
+	if err != nil {
+		return err
+	}
+	w := newLogLineWriter(rw, logPath)
+	var since time.Time
+	if !w.last.IsZero() {
+		since = w.last
+	}
+	var logsErr error
+	if follow {
+		logsErr = svc.FollowLogs(since, w)
+	} else {
+		logsErr = svc.collectLogs(false, since, w)
+	}
+	if err := w.Close(); err != nil && logsErr == nil {
+		logsErr = err
+	}
+	return logsErr
+}
+
+// logGrepWriter is an io.Writer that only writes the complete log lines matching a regular
+// expression. Flush must be called to write a matching partial line at the end of the logs
+type logGrepWriter struct {
+	w   io.Writer
+	re  *regexp.Regexp
+	buf []byte
+}
+
+func newLogGrepWriter(w io.Writer, re *regexp.Regexp) *logGrepWriter {
+	return &logGrepWriter{
+		w:  w,
+		re: re,
+	}
+}
+
+func (l *logGrepWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		idx := bytes.IndexByte(l.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		if err := l.writeLine(l.buf[:idx+1]); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any remaining partial line, if it matches
+func (l *logGrepWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.writeLine(l.buf)
+	l.buf = nil
+	return err
+}
+
+func (l *logGrepWriter) writeLine(line []byte) error {
+	if !l.re.Match(bytes.TrimRight(line, "\r\n")) {
+		return nil
+	}
+	_, err := l.w.Write(line)
+	return err
+}
+
+// logLineWriter is an io.WriteCloser that writes complete log lines with a leading timestamp
+// to a rotating log file. Lines that aren't newer than the last line written are skipped, and
+// the timestamp of the last line written is saved in a position file next to the log file
+type logLineWriter struct {
+	w        *rotatingFileWriter
+	posPath  string
+	last     time.Time
+	lastSave time.Time
+	buf      []byte
+}
+
+func newLogLineWriter(w *rotatingFileWriter, logPath string) *logLineWriter {
+	ret := &logLineWriter{
+		w:       w,
+		posPath: logPath + ".pos",
+	}
+	if content, err := os.ReadFile(ret.posPath); err == nil {
+		if last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content))); err == nil {
+			ret.last = last
+		}
+	}
+	return ret
+}
+
+func (l *logLineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		idx := bytes.IndexByte(l.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := l.buf[:idx+1]
+		if err := l.writeLine(line); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[idx+1:]
+	}
+	// Periodically save the position, so that a concurrent or later collection for the same
+	// container doesn't repeat lines
+	if time.Since(l.lastSave) > containerLogsPositionInterval {
+		if err := l.savePosition(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (l *logLineWriter) writeLine(line []byte) error {
+	// Docker prefixes each line with an RFC3339 timestamp when timestamps are requested
+	if tsEnd := bytes.IndexByte(line, ' '); tsEnd > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, string(line[:tsEnd])); err == nil {
+			if !ts.After(l.last) {
+				return nil
+			}
+			l.last = ts
+		}
+	}
+	_, err := l.w.Write(line)
+	return err
+}
+
+func (l *logLineWriter) savePosition() error {
+	l.lastSave = time.Now()
+	if l.last.IsZero() {
+		return nil
+	}
+	return os.WriteFile(
+		l.posPath,
+		[]byte(l.last.Format(time.RFC3339Nano)+"\n"),
+		0o644,
+	)
+}
+
+// Close writes any remaining partial line, saves the position, and closes the log file
+func (l *logLineWriter) Close() error {
+	if len(l.buf) > 0 {
+		if err := l.writeLine(append(l.buf, '\n')); err != nil {
+			l.w.Close()
+			return err
+		}
+		l.buf = nil
+	}
+	if err := l.savePosition(); err != nil {
+		l.w.Close()
+		return err
+	}
+	return l.w.Close()
+}
+
+// rotatingFileWriter is an io.WriteCloser that appends to a file, rotating it once it reaches
+// the max size. Rotated files are named with a numeric suffix, with .1 being the most recent.
+// Rotated files older than the max age are removed when the file is opened or rotated, and
+// periodically while writing
+type rotatingFileWriter struct {
+	path      string
+	maxSize   int64
+	maxFiles  int
+	maxAge    time.Duration
+	file      *os.File
+	size      int64
+	lastPrune time.Time
+}
+
+func newRotatingFileWriter(
+	path string,
+	maxSize int64,
+	maxFiles int,
+	maxAge time.Duration,
+) (*rotatingFileWriter, error) {
+	w := &rotatingFileWriter{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		maxAge:   maxAge,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if err := w.prune(); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingFileWriter) open() error {
+	f, err := os.OpenFile(
+		w.path,
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0o644,
+	)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = stat.Size()
+	return nil
+}
+
+func (w *rotatingFileWriter) Write(p []byte) (int, error) {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	} else if w.maxAge > 0 && time.Since(w.lastPrune) > containerLogsPruneInterval {
+		if err := w.prune(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current log file and removes any rotated files that are too old
+func (w *rotatingFileWriter) Close() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return w.prune()
+}
+
+func (w *rotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxFiles > 0 {
+		// Shift existing rotated files, dropping the oldest
+		for idx := w.maxFiles - 1; idx > 0; idx-- {
+			if err := os.Rename(w.rotatedPath(idx), w.rotatedPath(idx+1)); err != nil &&
+				!errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(w.path, w.rotatedPath(1)); err != nil {
+			return err
+		}
+	} else {
+		// No rotated files are kept
+		if err := os.Remove(w.path); err != nil {
+			return err
+		}
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	return w.prune()
+}
+
+// prune removes rotated files beyond the max file count or older than the max age. All rotated
+// files are checked, since there may be gaps in the numbering from previous pruning by age
+func (w *rotatingFileWriter) prune() error {
+	w.lastPrune = time.Now()
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return err
+	}
+	for _, rotatedPath := range matches {
+		idx, err := strconv.Atoi(strings.TrimPrefix(rotatedPath, w.path+"."))
+		if err != nil || idx < 1 {
+			// Not a rotated file, such as the position file
+			continue
+		}
+		stat, err := os.Stat(rotatedPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		tooOld := w.maxAge > 0 && time.Since(stat.ModTime()) > w.maxAge
+		if idx > w.maxFiles || tooOld {
+			if err := os.Remove(rotatedPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *rotatingFileWriter) rotatedPath(idx int) string {
+	return fmt.Sprintf("%s.%d", w.path, idx)
+}
+
+// containerLogTarget is a container for an installed package with log persistence enabled
+type containerLogTarget struct {
+	containerName string
+	logPath       string
+	cfg           ContainerLogsConfig
+}
+
+// containerLogTargets returns the containers for installed packages in all contexts using the
+// active Docker host that have log persistence enabled, keyed on container name
+func (p *PackageManager) containerLogTargets() map[string]containerLogTarget {
+	ret := make(map[string]containerLogTarget)
+	for _, installedPkg := range p.InstalledPackagesAllContexts() {
+		if !p.usesActiveDockerHost(installedPkg.Context) {
+			continue
+		}
+		pkg := installedPkg.Package
+		pkgName := fmt.Sprintf(
+			"%s-%s-%s",
+			installedPkg.InstanceName(),
+			pkg.Version,
+			installedPkg.Context,
+		)
+		logsDir := containerLogsDir(
+			p.config,
+			installedPkg.Context,
+			installedPkg.InstanceName(),
+		)
+		for _, installStep := range pkg.InstallSteps {
+			if installStep.Docker == nil || installStep.Docker.PullOnly {
+				continue
+			}
+			logsCfg, err := installStep.Docker.Logs.apply(p.config.ContainerLogs)
+			if err != nil || !logsCfg.Persist {
+				continue
+			}
+			containerName := fmt.Sprintf(
+				"%s-%s",
+				pkgName,
+				installStep.Docker.ContainerName,
+			)
+			ret[containerName] = containerLogTarget{
+				containerName: containerName,
+				logPath: filepath.Join(
+					logsDir,
+					installStep.Docker.ContainerName+".log",
+				),
+				cfg: logsCfg,
+			}
+		}
+	}
+	return ret
+}
+
+// CollectContainerLogs streams logs for containers of installed packages in all contexts using the
+// active Docker host with log persistence enabled to rotating log files. Containers that are
+// started later, such as after an install or upgrade, are picked up automatically. It runs until
+// the config context is cancelled
+func (p *PackageManager) CollectContainerLogs() error {
+	ctx := p.config.ctx()
+	// Subscribe to start events before following existing containers, so that we don't miss any
+	msgChan, errChan, err := dockerContainerEvents(
+		ctx,
+		p.config.DockerHost,
+		nil,
+		[]string{"start"},
+		time.Now(),
+		time.Time{},
+	)
+	if err != nil {
+		return err
+	}
+	c := &logCollector{
+		pm:        p,
+		following: make(map[string]bool),
+	}
+	targets := p.containerLogTargets()
+	if len(targets) == 0 {
+		p.config.Logger.Info(
+			"No containers with log persistence enabled, waiting for new containers",
+		)
+	}
+	for _, target := range targets {
+		c.follow(target)
+	}
+	for {
+		select {
+		case msg := <-msgChan:
+			containerName := msg.Actor.Attributes["name"]
+			target, ok := c.target(containerName)
+			if !ok {
+				continue
+			}
+			c.follow(target)
+		case err := <-errChan:
+			c.wg.Wait()
+			if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+type logCollector struct {
+	pm        *PackageManager
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	following map[string]bool
+}
+
+// target returns the log target for a container. The state is reloaded if the container isn't
+// known, since it may belong to a package that was installed after the collector was started
+func (c *logCollector) target(containerName string) (containerLogTarget, bool) {
+	if target, ok := c.pm.containerLogTargets()[containerName]; ok {
+		return target, true
+	}
+	if err := c.pm.reloadState(); err != nil {
+		c.pm.config.Logger.Warn(
+			fmt.Sprintf("failed to reload state: %s", err),
+		)
+		return containerLogTarget{}, false
+	}
+	target, ok := c.pm.containerLogTargets()[containerName]
+	return target, ok
+}
+
+// follow starts streaming logs for the target container in the background, if not already
+func (c *logCollector) follow(target containerLogTarget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.following[target.containerName] {
+		return
+	}
+	cfg := c.pm.config
+	svc, err := newDockerService(cfg, target.containerName)
+	if err != nil {
+		if !errors.Is(err, ErrContainerNotExists) {
+			cfg.Logger.Warn(
+				fmt.Sprintf(
+					"failed to collect logs for container %s: %s",
+					target.containerName,
+					err,
+				),
+			)
+		}
+		return
+	}
+	if running, _ := svc.Running(); !running {
+		return
+	}
+	c.following[target.containerName] = true
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		cfg.Logger.Info(
+			fmt.Sprintf(
+				"Collecting logs for container %s to %s",
+				target.containerName,
+				target.logPath,
+			),
+		)
+		if err := persistContainerLogs(target.cfg, svc, target.logPath, true); err != nil &&
+			!errors.Is(err, context.Canceled) {
+			cfg.Logger.Warn(
+				fmt.Sprintf(
+					"failed to collect logs for container %s: %s",
+					target.containerName,
+					err,
+				),
+			)
+		}
+		c.mu.Lock()
+		delete(c.following, target.containerName)
+		c.mu.Unlock()
+	}()
+}
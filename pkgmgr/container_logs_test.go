@@ -0,0 +1,213 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileWriter(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	// Write enough lines to rotate several times
+	for i := 0; i < 3; i++ {
+		w, err := newRotatingFileWriter(logPath, 10, 2, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for j := 0; j < 2; j++ {
+			if _, err := w.Write([]byte("0123456\n")); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	for _, path := range []string{logPath, logPath + ".1", logPath + ".2"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "0123456\n" {
+			t.Fatalf("did not get expected content in %s: %q", path, content)
+		}
+	}
+	if _, err := os.Stat(logPath + ".3"); err == nil {
+		t.Fatalf("rotated log file beyond max files was not removed")
+	}
+	// Rotated files older than the max age should be removed on close
+	oldTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(logPath+".2", oldTime, oldTime); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w, err := newRotatingFileWriter(logPath, 10, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(logPath + ".2"); err == nil {
+		t.Fatalf("rotated log file beyond max age was not removed")
+	}
+	if _, err := os.Stat(logPath + ".1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestPackageInstallStepDockerLogsApply(t *testing.T) {
+	persist := true
+	baseCfg := ContainerLogsConfig{
+		MaxSize:  defaultContainerLogsMaxSize,
+		MaxFiles: defaultContainerLogsMaxFiles,
+	}
+	stepLogs := &PackageInstallStepDockerLogs{
+		Persist:  &persist,
+		MaxSize:  "1m",
+		MaxFiles: 3,
+		MaxAge:   "24h",
+	}
+	logsCfg, err := stepLogs.apply(baseCfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := ContainerLogsConfig{
+		Persist:  true,
+		MaxSize:  1024 * 1024,
+		MaxFiles: 3,
+		MaxAge:   24 * time.Hour,
+	}
+	if logsCfg != expected {
+		t.Fatalf(
+			"did not get expected config\n  got: %#v\n  expected: %#v",
+			logsCfg,
+			expected,
+		)
+	}
+	// A nil override should return the base config
+	var nilLogs *PackageInstallStepDockerLogs
+	if logsCfg, err := nilLogs.apply(baseCfg); err != nil || logsCfg != baseCfg {
+		t.Fatalf("did not get expected base config: %#v", logsCfg)
+	}
+	for _, badLogs := range []PackageInstallStepDockerLogs{
+		{MaxSize: "lots"},
+		{MaxFiles: -1},
+		{MaxAge: "forever"},
+	} {
+		if err := badLogs.validate(); err == nil {
+			t.Fatalf("did not get expected error for: %#v", badLogs)
+		}
+	}
+}
+
+func TestRotatingFileWriterPruneGaps(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	// Leave a gap in the rotated file numbering, like after pruning by age
+	for _, suffix := range []string{".1", ".3", ".4", ".pos"} {
+		if err := os.WriteFile(logPath+suffix, []byte("foo\n"), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	w, err := newRotatingFileWriter(logPath, 10, 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, suffix := range []string{".3", ".4"} {
+		if _, err := os.Stat(logPath + suffix); err == nil {
+			t.Fatalf("rotated log file %s beyond max files was not removed", suffix)
+		}
+	}
+	for _, suffix := range []string{".1", ".pos"} {
+		if _, err := os.Stat(logPath + suffix); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestLogLineWriter(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	writeLogs := func(chunks ...string) {
+		rw, err := newRotatingFileWriter(logPath, 0, 0, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		w := newLogLineWriter(rw, logPath)
+		for _, chunk := range chunks {
+			if _, err := w.Write([]byte(chunk)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	writeLogs(
+		"2024-01-01T00:00:01.000000000Z first\n2024-01-01T00:00:02.",
+		"000000000Z second\n",
+	)
+	// Lines already written should be skipped when collecting again
+	writeLogs(
+		"2024-01-01T00:00:02.000000000Z second\n",
+		"2024-01-01T00:00:03.000000000Z third",
+	)
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "2024-01-01T00:00:01.000000000Z first\n2024-01-01T00:00:02.000000000Z second\n2024-01-01T00:00:03.000000000Z third\n"
+	if string(content) != expected {
+		t.Fatalf("did not get expected log content\n  got: %q\n  expected: %q", content, expected)
+	}
+	pos, err := os.ReadFile(logPath + ".pos")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(pos) != "2024-01-01T00:00:03Z\n" {
+		t.Fatalf("did not get expected log position: %q", pos)
+	}
+}
+
+func TestLogGrepWriter(t *testing.T) {
+	var output bytes.Buffer
+	w := newLogGrepWriter(&output, regexp.MustCompile(`(?i)peer`))
+	for _, chunk := range []string{
+		"[Info] Connected to peer 1.2.3.4\n[Info] Chain ",
+		"extended\n[Warning] Lost PEER 5.6.7.8\r\n",
+		"[Error] peer",
+	} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "[Info] Connected to peer 1.2.3.4\n[Warning] Lost PEER 5.6.7.8\r\n[Error] peer"
+	if output.String() != expected {
+		t.Fatalf(
+			"did not get expected output\n  got: %q\n  expected: %q",
+			output.String(),
+			expected,
+		)
+	}
+}
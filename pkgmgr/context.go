@@ -14,8 +14,25 @@
 
 package pkgmgr
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/docker/docker/client"
+)
+
 const (
 	defaultContextName = "default"
+
+	// networkConfigDirName is the dir in the context dir that the config and genesis files for a
+	// custom network are copied to
+	networkConfigDirName = "network"
 )
 
 var defaultContext = Context{
@@ -26,4 +43,138 @@ type Context struct {
 	Description  string `yaml:"description"`
 	Network      string `yaml:"network"`
 	NetworkMagic uint32 `yaml:"networkMagic"`
+	// DockerHost is the Docker host URL used for packages in the context, in the DOCKER_HOST
+	// format. An ssh://[user@]host[:port] URL manages the Docker engine on a remote host
+	DockerHost string `yaml:"dockerHost,omitempty"`
+	// RemoteDataDir is the dir on a remote Docker host used for package data mounted into
+	// containers. If not set, bind mounts from the data dir are replaced with named volumes
+	RemoteDataDir string `yaml:"remoteDataDir,omitempty"`
+	// CustomNetwork is set for contexts using a network that isn't known to cardano-up, such as
+	// a private testnet or devnet. The network magic must be provided for these
+	CustomNetwork bool `yaml:"customNetwork,omitempty"`
+	// NetworkConfigDir is the dir containing the config and genesis files for a custom network.
+	// When setting the network, the files in the provided dir are copied into the context dir and
+	// this is updated to point to the copies
+	NetworkConfigDir string `yaml:"networkConfigDir,omitempty"`
+	// DataRoot is the dir that package data dirs are created in for packages in the context, in
+	// place of the data dir. This allows putting large databases on a different disk
+	DataRoot string `yaml:"dataRoot,omitempty"`
+	// ContainerUser is the user that containers run as for packages in the context, in the Docker
+	// --user flag format, or "image" for the default user for the image. Install steps that
+	// specify a user override this
+	ContainerUser string `yaml:"containerUser,omitempty"`
+	// Devnet is set for contexts created for a local devnet by 'cardano-up devnet create'
+	Devnet bool `yaml:"devnet,omitempty"`
+}
+
+// templateVars returns the values for the Context template variable
+func (c Context) templateVars(name string) map[string]any {
+	return map[string]any{
+		"Name":             name,
+		"Network":          c.Network,
+		"NetworkMagic":     c.NetworkMagic,
+		"CustomNetwork":    c.CustomNetwork,
+		"NetworkConfigDir": c.NetworkConfigDir,
+	}
+}
+
+// validateCustomNetwork checks the network name and magic for a custom network
+func (c Context) validateCustomNetwork() error {
+	reName := regexp.MustCompile(`^[-_.a-zA-Z0-9]+$`)
+	if !reName.Match([]byte(c.Network)) {
+		return NewInvalidNetworkNameError(c.Network)
+	}
+	if c.NetworkMagic == 0 {
+		return NewUnknownNetworkError(c.Network)
+	}
+	return nil
+}
+
+// importNetworkConfig copies the files in the provided dir into the network config dir for the
+// context, and returns the path to the copies
+func importNetworkConfig(cfg Config, contextName string, srcDir string) (string, error) {
+	destDir := filepath.Join(cfg.DataDir, contextName, networkConfigDirName)
+	// The files may have been generated in place, such as for a devnet
+	if filepath.Clean(srcDir) == destDir {
+		return destDir, nil
+	}
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return "", NewNetworkConfigDirError(srcDir, err)
+	}
+	if err := os.MkdirAll(destDir, fs.ModePerm); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyNetworkConfigFile(
+			filepath.Join(srcDir, entry.Name()),
+			filepath.Join(destDir, entry.Name()),
+		); err != nil {
+			return "", err
+		}
+	}
+	return destDir, nil
+}
+
+func copyNetworkConfigFile(srcPath string, destPath string) (retErr error) {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	destFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = errors.Join(retErr, destFile.Close())
+	}()
+	if _, err := io.Copy(destFile, srcFile); err != nil {
+		return fmt.Errorf("failed to copy network config file %s: %w", srcPath, err)
+	}
+	return nil
+}
+
+// validateDataRoot checks the data root for a context
+func (c Context) validateDataRoot() error {
+	if c.DataRoot == "" {
+		return nil
+	}
+	if !filepath.IsAbs(c.DataRoot) {
+		return NewInvalidDataRootError(c.DataRoot)
+	}
+	// Package data on a remote Docker host is placed using the remote data dir instead
+	if isSshDockerHost(c.DockerHost) {
+		return ErrDataRootSshHost
+	}
+	return nil
+}
+
+// validateDockerHost checks the Docker host and remote data dir for a context
+func (c Context) validateDockerHost() error {
+	if c.DockerHost == "" {
+		if c.RemoteDataDir != "" {
+			return ErrRemoteDataDirNoSshHost
+		}
+		return nil
+	}
+	if isSshDockerHost(c.DockerHost) {
+		if _, err := parseSshHost(c.DockerHost); err != nil {
+			return err
+		}
+		if c.RemoteDataDir != "" && !path.IsAbs(c.RemoteDataDir) {
+			return NewInvalidRemoteDataDirError(c.RemoteDataDir)
+		}
+		return nil
+	}
+	if c.RemoteDataDir != "" {
+		return ErrRemoteDataDirNoSshHost
+	}
+	if _, err := client.ParseHostURL(c.DockerHost); err != nil {
+		return NewInvalidDockerHostError(c.DockerHost, err.Error())
+	}
+	return nil
 }
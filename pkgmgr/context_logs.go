@@ -0,0 +1,188 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/blinklabs-io/cardano-up/internal/table"
+)
+
+// contextLogsColors are the colors used for the line prefixes of each service, in turn
+var contextLogsColors = []table.Color{
+	table.ColorCyan,
+	table.ColorYellow,
+	table.ColorGreen,
+	table.ColorMagenta,
+	table.ColorBlue,
+}
+
+// contextLogsSource is a service whose logs are included in the context logs
+type contextLogsSource struct {
+	prefix string
+	svc    *DockerService
+}
+
+// ContextLogs outputs the logs from the services of all installed packages in the active context
+// concurrently, like 'docker compose logs'. Each line is prefixed with the package and service
+// name. When following the logs, this returns once all services stop or the context is cancelled
+func (p *PackageManager) ContextLogs(
+	opts LogsOptions,
+	stdoutWriter io.Writer,
+	stderrWriter io.Writer,
+) error {
+	activeContextName, _ := p.CurrentContext()
+	grepRegexp, err := opts.grepRegexp()
+	if err != nil {
+		return err
+	}
+	var sources []contextLogsSource
+	for _, installedPkg := range p.InstalledPackages() {
+		services, err := installedPkg.Package.services(p.config, activeContextName)
+		if err != nil {
+			return err
+		}
+		pkgName := fmt.Sprintf(
+			"%s-%s-%s",
+			installedPkg.InstanceName(),
+			installedPkg.Package.Version,
+			activeContextName,
+		)
+		for _, svc := range services {
+			sources = append(
+				sources,
+				contextLogsSource{
+					prefix: installedPkg.InstanceName() + "/" +
+						strings.TrimPrefix(svc.ContainerName, pkgName+"-"),
+					svc: svc,
+				},
+			)
+		}
+	}
+	if len(sources) == 0 {
+		return NewNoContextServicesFoundError(activeContextName)
+	}
+	// Line up the log lines by padding the prefixes to the same width
+	prefixWidth := 0
+	for _, source := range sources {
+		prefixWidth = max(prefixWidth, utf8.RuneCountInString(source.prefix))
+	}
+	var outputMutex sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(sources))
+	for idx, source := range sources {
+		prefix := source.prefix + strings.Repeat(
+			" ",
+			prefixWidth-utf8.RuneCountInString(source.prefix),
+		)
+		if p.config.Color {
+			prefix = table.Colorize(prefix, contextLogsColors[idx%len(contextLogsColors)])
+		}
+		prefix += " | "
+		wg.Add(1)
+		go func(idx int, svc *DockerService) {
+			defer wg.Done()
+			stdoutPrefix := newLogPrefixWriter(stdoutWriter, prefix, &outputMutex)
+			stderrPrefix := newLogPrefixWriter(stderrWriter, prefix, &outputMutex)
+			var svcStdout, svcStderr io.Writer = stdoutPrefix, stderrPrefix
+			var stdoutGrep, stderrGrep *logGrepWriter
+			if grepRegexp != nil {
+				stdoutGrep = newLogGrepWriter(stdoutPrefix, grepRegexp)
+				stderrGrep = newLogGrepWriter(stderrPrefix, grepRegexp)
+				svcStdout, svcStderr = stdoutGrep, stderrGrep
+			}
+			errs[idx] = svc.Logs(opts, svcStdout, svcStderr)
+			if grepRegexp != nil {
+				_ = stdoutGrep.Flush()
+				_ = stderrGrep.Flush()
+			}
+			_ = stdoutPrefix.Flush()
+			_ = stderrPrefix.Flush()
+		}(idx, source.svc)
+	}
+	wg.Wait()
+	for idx, err := range errs {
+		// Following the logs is stopped by cancelling the context
+		if errors.Is(err, context.Canceled) {
+			errs[idx] = nil
+		} else if err != nil {
+			errs[idx] = fmt.Errorf("%s: %w", sources[idx].prefix, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logPrefixWriter is an io.Writer that writes complete lines with a prefix. Writers for
+// different sources can share a mutex, so that their lines aren't interleaved. Flush must be
+// called to write a partial line at the end of the logs
+type logPrefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func newLogPrefixWriter(w io.Writer, prefix string, mu *sync.Mutex) *logPrefixWriter {
+	return &logPrefixWriter{
+		w:      w,
+		prefix: prefix,
+		mu:     mu,
+	}
+}
+
+func (l *logPrefixWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	idx := bytes.LastIndexByte(l.buf, '\n')
+	if idx < 0 {
+		return len(p), nil
+	}
+	if err := l.writeLines(l.buf[:idx+1]); err != nil {
+		return 0, err
+	}
+	l.buf = l.buf[idx+1:]
+	return len(p), nil
+}
+
+// Flush writes any remaining partial line
+func (l *logPrefixWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.writeLines(append(l.buf, '\n'))
+	l.buf = nil
+	return err
+}
+
+func (l *logPrefixWriter) writeLines(lines []byte) error {
+	var output bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		output.WriteString(l.prefix)
+		output.Write(line)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(output.Bytes())
+	return err
+}
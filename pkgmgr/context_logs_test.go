@@ -0,0 +1,82 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestLogPrefixWriter(t *testing.T) {
+	var output bytes.Buffer
+	var mu sync.Mutex
+	nodeWriter := newLogPrefixWriter(&output, "cardano-node/cardano-node | ", &mu)
+	dbSyncWriter := newLogPrefixWriter(&output, "cardano-db-sync/postgres  | ", &mu)
+	for _, write := range []struct {
+		w     *logPrefixWriter
+		chunk string
+	}{
+		{nodeWriter, "Chain extended\nConnected "},
+		{dbSyncWriter, "database system is ready\n"},
+		{nodeWriter, "to peer\nLost "},
+		{dbSyncWriter, "checkpoint starting\ncheckpoint complete\n"},
+	} {
+		if _, err := write.w.Write([]byte(write.chunk)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := nodeWriter.Flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "cardano-node/cardano-node | Chain extended\n" +
+		"cardano-db-sync/postgres  | database system is ready\n" +
+		"cardano-node/cardano-node | Connected to peer\n" +
+		"cardano-db-sync/postgres  | checkpoint starting\n" +
+		"cardano-db-sync/postgres  | checkpoint complete\n" +
+		"cardano-node/cardano-node | Lost \n"
+	if output.String() != expected {
+		t.Fatalf(
+			"did not get expected output\n  got: %q\n  expected: %q",
+			output.String(),
+			expected,
+		)
+	}
+}
+
+func TestContextLogsNoServices(t *testing.T) {
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: t.TempDir(),
+			DataDir:   t.TempDir(),
+			CacheDir:  t.TempDir(),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = pm.ContextLogs(LogsOptions{}, io.Discard, io.Discard)
+	if err == nil || err.Error() != NewNoContextServicesFoundError("default").Error() {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	// The grep pattern is checked first
+	if err := pm.ContextLogs(LogsOptions{Grep: "("}, io.Discard, io.Discard); err == nil {
+		t.Fatalf("did not get expected error for invalid grep pattern")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddContextCustomNetwork(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srcDir := filepath.Join(tmpDir, "devnet")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "shelley-genesis.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Custom networks require a network magic
+	if err := pm.AddContext("dev", Context{Network: "devnet"}); err == nil {
+		t.Fatalf("did not get expected error for custom network without magic")
+	}
+	// Known networks can't use a different network magic
+	if err := pm.AddContext("bad", Context{Network: "preview", NetworkMagic: 3}); err == nil {
+		t.Fatalf("did not get expected error for known network with wrong magic")
+	}
+	if err := pm.AddContext(
+		"dev2",
+		Context{
+			Network:          "devnet",
+			NetworkMagic:     42,
+			NetworkConfigDir: srcDir,
+		},
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	devContext := pm.Contexts()["dev2"]
+	if !devContext.CustomNetwork || devContext.NetworkMagic != 42 {
+		t.Fatalf("did not get expected custom network for context: %#v", devContext)
+	}
+	expectedDir := filepath.Join(cfg.DataDir, "dev2", networkConfigDirName)
+	if devContext.NetworkConfigDir != expectedDir {
+		t.Fatalf(
+			"did not get expected network config dir: got %s, expected %s",
+			devContext.NetworkConfigDir,
+			expectedDir,
+		)
+	}
+	if _, err := os.Stat(filepath.Join(expectedDir, "shelley-genesis.json")); err != nil {
+		t.Fatalf("network config file was not copied: %s", err)
+	}
+	// The network can't be changed once set
+	devContext.NetworkMagic = 43
+	if err := pm.UpdateContext("dev2", devContext); err != ErrContextNoChangeNetwork {
+		t.Fatalf("did not get expected error when changing network magic: %v", err)
+	}
+}
+
+func TestUpdateContextDataRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.AddContext("bad", Context{DataRoot: "relative/dir"}); err == nil {
+		t.Fatalf("did not get expected error for relative data root")
+	}
+	dataRoot := filepath.Join(tmpDir, "bigdisk")
+	if err := pm.AddContext(
+		"ssh",
+		Context{DockerHost: "ssh://node.example.com", DataRoot: dataRoot},
+	); err != ErrDataRootSshHost {
+		t.Fatalf("did not get expected error for data root with ssh Docker host: %v", err)
+	}
+	if err := pm.AddContext("big", Context{DataRoot: dataRoot}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.SetActiveContext("big"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedDir := filepath.Join(dataRoot, "foo-1.0.0-big")
+	if pkgDataDir := pm.config.packageDataDir("foo-1.0.0-big"); pkgDataDir != expectedDir {
+		t.Fatalf(
+			"did not get expected package data dir: got %s, expected %s",
+			pkgDataDir,
+			expectedDir,
+		)
+	}
+	// The data root can't be changed with packages installed
+	pm.state.InstalledPackages = append(
+		pm.state.InstalledPackages,
+		InstalledPackage{
+			Package: Package{Name: "foo", Version: "1.0.0"},
+			Context: "big",
+		},
+	)
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.UpdateContext("big", Context{}); err != ErrContextNoChangeDataRoot {
+		t.Fatalf("did not get expected error when changing data root: %v", err)
+	}
+}
+
+func TestContextContainerUser(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.AddContext("bad", Context{ContainerUser: "1000:1000:1000"}); err == nil {
+		t.Fatalf("did not get expected error for invalid container user")
+	}
+	if err := pm.AddContext("root", Context{ContainerUser: "root"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.SetActiveContext("root"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pm.config.ContainerUser != "root" {
+		t.Fatalf("did not get expected container user: got %q", pm.config.ContainerUser)
+	}
+}
+
+func TestForContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.AddContext("other", Context{Network: "preview"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{Package: Package{Name: "foo", Version: "1.0.0"}, Context: "default"},
+		{Package: Package{Name: "bar", Version: "1.0.0"}, Context: "other"},
+	}
+	if _, err := pm.ForContext("missing"); err != ErrContextNotExist {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	otherPm, err := pm.ForContext("other")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Operations apply to the other context, without changing the active context
+	if contextName, context := otherPm.CurrentContext(); contextName != "other" ||
+		context.Network != "preview" {
+		t.Fatalf("did not get expected current context: %s", contextName)
+	}
+	if contextName, _ := otherPm.ActiveContext(); contextName != "default" {
+		t.Fatalf("did not get expected active context: %s", contextName)
+	}
+	installedPkgs := otherPm.InstalledPackages()
+	if len(installedPkgs) != 1 || installedPkgs[0].Package.Name != "bar" {
+		t.Fatalf("did not get expected installed packages: %#v", installedPkgs)
+	}
+	installedPkgs = pm.InstalledPackagesInContext("other")
+	if len(installedPkgs) != 1 || installedPkgs[0].Package.Name != "bar" {
+		t.Fatalf("did not get expected installed packages: %#v", installedPkgs)
+	}
+	// Template vars reflect the other context
+	network, err := otherPm.config.Template.Render("{{ .Context.Network }}", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if network != "preview" {
+		t.Fatalf("did not get expected network: %s", network)
+	}
+	if contextName, _ := pm.CurrentContext(); contextName != "default" {
+		t.Fatalf("did not get expected current context: %s", contextName)
+	}
+}
+
+func TestActivatePackageContextBinDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		BinDir:    filepath.Join(tmpDir, "bin"),
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg := Package{
+		Name:    "tool",
+		Version: "1.0.0",
+		InstallSteps: []PackageInstallStep{
+			{
+				File: &PackageInstallStepFile{
+					Filename: "tool",
+					Content:  "#!/bin/sh",
+					Binary:   true,
+				},
+			},
+		},
+	}
+	activeBinPath := filepath.Join(cfg.BinDir, "tool")
+	testDefs := []struct {
+		context        string
+		linkedBinDir   bool
+		contextBinPath string
+	}{
+		{
+			context:        "default",
+			linkedBinDir:   true,
+			contextBinPath: filepath.Join(cfg.DataDir, "default", "bin", "tool"),
+		},
+		{
+			context:        "other",
+			linkedBinDir:   false,
+			contextBinPath: filepath.Join(cfg.DataDir, "other", "bin", "tool"),
+		},
+	}
+	for _, testDef := range testDefs {
+		if err := pm.activatePackage(pm.config, pkg, testDef.context); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := os.Lstat(testDef.contextBinPath); err != nil {
+			t.Fatalf("binary not linked into context bin dir: %s", err)
+		}
+		_, err := os.Lstat(activeBinPath)
+		if (err == nil) != testDef.linkedBinDir {
+			t.Fatalf(
+				"did not get expected BinDir link for context %s: got %v, expected %v",
+				testDef.context,
+				err == nil,
+				testDef.linkedBinDir,
+			)
+		}
+		if err := pm.deactivatePackage(pm.config, pkg, testDef.context); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, binPath := range []string{testDef.contextBinPath, activeBinPath} {
+			if _, err := os.Lstat(binPath); err == nil {
+				t.Fatalf("binary %s still linked after deactivating", binPath)
+			}
+		}
+	}
+}
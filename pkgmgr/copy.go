@@ -0,0 +1,265 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+// CopyFromContainer copies a file or dir from a container of an installed package in the active
+// context to a local path, the same as 'docker cp'. A file or dir is copied into the local path if
+// it's an existing dir, and otherwise is copied to the local path. The container name is the name
+// from the package, and is required for packages with more than one container. The container
+// doesn't need to be running
+func (p *PackageManager) CopyFromContainer(
+	pkgName string,
+	containerName string,
+	containerPath string,
+	localPath string,
+) error {
+	if !path.IsAbs(containerPath) {
+		return NewInvalidContainerPathError(containerPath)
+	}
+	svc, err := p.packageService(pkgName, containerName)
+	if err != nil {
+		return err
+	}
+	return svc.copyFrom(containerPath, localPath)
+}
+
+// CopyToContainer copies a local file or dir to a container of an installed package in the active
+// context, the same as 'docker cp'. A file or dir is copied into the container path if it's an
+// existing dir, and otherwise is copied to the container path. Copied files keep the ownership of
+// the local files, which matches the user that package containers run as by default
+func (p *PackageManager) CopyToContainer(
+	pkgName string,
+	containerName string,
+	localPath string,
+	containerPath string,
+) error {
+	if !path.IsAbs(containerPath) {
+		return NewInvalidContainerPathError(containerPath)
+	}
+	svc, err := p.packageService(pkgName, containerName)
+	if err != nil {
+		return err
+	}
+	return svc.copyTo(localPath, containerPath)
+}
+
+// copyFrom copies a file or dir from the container to a local path
+func (d *DockerService) copyFrom(containerPath string, localPath string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	var content io.ReadCloser
+	var stat container.PathStat
+	if err := d.retry(
+		"copying from container "+d.ContainerName,
+		func() error {
+			var err error
+			content, stat, err = client.CopyFromContainer(
+				d.getContext(),
+				d.ContainerId,
+				containerPath,
+			)
+			return err
+		},
+	); err != nil {
+		return err
+	}
+	defer content.Close()
+	destPath := localPath
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		destPath = filepath.Join(localPath, stat.Name)
+	}
+	d.logger.Debug(
+		fmt.Sprintf("copying %s:%s to %s", d.ContainerName, containerPath, destPath),
+	)
+	return extractTar(content, stat.Name, destPath)
+}
+
+// copyTo copies a local file or dir to the container
+func (d *DockerService) copyTo(localPath string, containerPath string) error {
+	localInfo, err := os.Lstat(localPath)
+	if err != nil {
+		return err
+	}
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	containerPath = path.Clean(containerPath)
+	destDir, destName := path.Split(containerPath)
+	stat, err := client.ContainerStatPath(d.getContext(), d.ContainerId, containerPath)
+	if err == nil {
+		if stat.Mode.IsDir() {
+			destDir, destName = containerPath, filepath.Base(localPath)
+		} else if localInfo.IsDir() {
+			return NewCopyDirToFileError(containerPath)
+		}
+	} else if !errdefs.IsNotFound(err) {
+		return err
+	}
+	d.logger.Debug(
+		fmt.Sprintf(
+			"copying %s to %s:%s",
+			localPath,
+			d.ContainerName,
+			path.Join(destDir, destName),
+		),
+	)
+	// The content is streamed to the Docker daemon as a tar archive
+	tarReader, tarWriter := io.Pipe()
+	go func() {
+		_ = tarWriter.CloseWithError(tarPath(tarWriter, localPath, destName))
+	}()
+	err = client.CopyToContainer(
+		d.getContext(),
+		d.ContainerId,
+		destDir,
+		tarReader,
+		container.CopyToContainerOptions{
+			CopyUIDGID: true,
+		},
+	)
+	// Stop writing the archive if the copy failed
+	_ = tarReader.CloseWithError(errors.New("copy to container finished"))
+	return err
+}
+
+// tarPath writes a tar archive of a local file or dir, with the file or dir renamed to the root
+// name. Symlinks are archived as-is and other special files are skipped
+func tarPath(w io.Writer, localPath string, rootName string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(
+		localPath,
+		func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			var linkTarget string
+			switch {
+			case d.Type()&fs.ModeSymlink != 0:
+				linkTarget, err = os.Readlink(filePath)
+				if err != nil {
+					return err
+				}
+			case !d.IsDir() && !d.Type().IsRegular():
+				return nil
+			}
+			hdr, err := tar.FileInfoHeader(info, linkTarget)
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(localPath, filePath)
+			if err != nil {
+				return err
+			}
+			hdr.Name = path.Join(rootName, filepath.ToSlash(relPath))
+			if d.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			tmpFile, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer tmpFile.Close()
+			_, err = io.Copy(tw, tmpFile)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts a tar archive of a file or dir with the provided root name to the destination
+// path, which replaces the root name. Entries outside of the root are rejected, and special files
+// other than symlinks are skipped
+func extractTar(r io.Reader, rootName string, destPath string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entryName := path.Clean(hdr.Name)
+		var relPath string
+		if entryName != rootName {
+			var ok bool
+			relPath, ok = strings.CutPrefix(entryName, rootName+"/")
+			if !ok || !filepath.IsLocal(relPath) {
+				return NewInvalidArchiveEntryError(hdr.Name)
+			}
+		}
+		target := filepath.Join(destPath, filepath.FromSlash(relPath))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractTarFile(tr, target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractTarFile(r io.Reader, target string, mode fs.FileMode) (retErr error) {
+	tmpFile, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = errors.Join(retErr, tmpFile.Close())
+	}()
+	_, err = io.Copy(tmpFile, r)
+	return err
+}
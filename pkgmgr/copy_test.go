@@ -0,0 +1,108 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarPathExtractTar(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "config")
+	if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "config.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "sub", "topology.json"), []byte("[]"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink("config.json", filepath.Join(srcDir, "link.json")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Copy the dir, renaming it
+	var buf bytes.Buffer
+	if err := tarPath(&buf, srcDir, "node-config"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	destDir := filepath.Join(t.TempDir(), "copied")
+	if err := extractTar(&buf, "node-config", destDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(destDir, "sub", "topology.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "[]" {
+		t.Fatalf("did not get expected content: %q", content)
+	}
+	info, err := os.Stat(filepath.Join(destDir, "config.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("did not get expected mode: %s", info.Mode())
+	}
+	linkTarget, err := os.Readlink(filepath.Join(destDir, "link.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if linkTarget != "config.json" {
+		t.Fatalf("did not get expected symlink target: %s", linkTarget)
+	}
+	// Copy a single file over an existing file
+	buf.Reset()
+	if err := tarPath(&buf, filepath.Join(srcDir, "sub", "topology.json"), "topology.json"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	destFile := filepath.Join(destDir, "config.json")
+	if err := extractTar(&buf, "topology.json", destFile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err = os.ReadFile(destFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "[]" {
+		t.Fatalf("did not get expected content: %q", content)
+	}
+}
+
+func TestExtractTarInvalidEntry(t *testing.T) {
+	for _, entryName := range []string{"config/../../evil", "other/file"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(
+			&tar.Header{
+				Name:     entryName,
+				Typeflag: tar.TypeReg,
+				Mode:     0o644,
+			},
+		); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		destDir := t.TempDir()
+		if err := extractTar(&buf, "config", filepath.Join(destDir, "config")); err == nil {
+			t.Fatalf("did not get expected error for entry %q", entryName)
+		}
+	}
+}
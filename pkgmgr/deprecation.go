@@ -0,0 +1,182 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eolDateFormat is the format for package end-of-life dates
+const eolDateFormat = "2006-01-02"
+
+func (p Package) validateDeprecation() error {
+	if p.SupersededBy != "" && p.SupersededBy == p.Name {
+		return fmt.Errorf("package cannot be superseded by itself")
+	}
+	if p.EolDate != "" {
+		if _, err := time.Parse(eolDateFormat, p.EolDate); err != nil {
+			return fmt.Errorf(
+				"invalid end-of-life date %q, expected YYYY-MM-DD format",
+				p.EolDate,
+			)
+		}
+	}
+	return nil
+}
+
+// IsDeprecated returns whether the package is marked as deprecated or has reached its
+// end-of-life date
+func (p Package) IsDeprecated() bool {
+	return p.isDeprecated(time.Now())
+}
+
+func (p Package) isDeprecated(now time.Time) bool {
+	if p.Deprecated {
+		return true
+	}
+	eolDate, err := time.Parse(eolDateFormat, p.EolDate)
+	if err != nil {
+		return false
+	}
+	return !now.Before(eolDate)
+}
+
+// DeprecationWarning returns a warning for a package that is deprecated or has an end-of-life
+// date, or empty otherwise
+func (p Package) DeprecationWarning() string {
+	return p.deprecationWarning(time.Now())
+}
+
+func (p Package) deprecationWarning(now time.Time) string {
+	var reasons []string
+	if p.Deprecated {
+		reasons = append(reasons, "is deprecated")
+	}
+	if eolDate, err := time.Parse(eolDateFormat, p.EolDate); err == nil {
+		if now.Before(eolDate) {
+			reasons = append(reasons, "reaches end of life on "+p.EolDate)
+		} else {
+			reasons = append(reasons, "reached end of life on "+p.EolDate)
+		}
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	ret := fmt.Sprintf(
+		"package %s (= %s) %s",
+		p.Name,
+		p.Version,
+		strings.Join(reasons, " and "),
+	)
+	if p.SupersededBy != "" {
+		ret += fmt.Sprintf(", use %s instead", p.SupersededBy)
+	}
+	return ret
+}
+
+// SupersededPackage is an installed package whose latest available version has been superseded by
+// another package
+type SupersededPackage struct {
+	Installed InstalledPackage
+	// Latest is the latest available version of the installed package
+	Latest Package
+	// SupersededBy is the name of the package that replaces the installed package
+	SupersededBy string
+}
+
+// SupersededPackage returns the installed package in the active context if its latest available
+// version has been superseded by another package
+func (p *PackageManager) SupersededPackage(pkgName string) (SupersededPackage, bool) {
+	for _, installedPkg := range p.InstalledPackages() {
+		if installedPkg.InstanceName() != pkgName {
+			continue
+		}
+		latestPkg := latestPackage(p.availablePackagesWithLocal(), installedPkg.Package.Name)
+		if latestPkg.SupersededBy == "" {
+			return SupersededPackage{}, false
+		}
+		return SupersededPackage{
+			Installed:    installedPkg,
+			Latest:       latestPkg,
+			SupersededBy: latestPkg.SupersededBy,
+		}, true
+	}
+	return SupersededPackage{}, false
+}
+
+// Migrate replaces an installed package in the active context with the package that supersedes
+// it. The data for the old package is kept, so that it can be moved over or removed manually
+func (p *PackageManager) Migrate(pkgName string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	superseded, ok := p.SupersededPackage(pkgName)
+	if !ok {
+		if _, err := p.installedPackagesByName([]string{pkgName}); err != nil {
+			return err
+		}
+		return NewPackageNotSupersededError(pkgName)
+	}
+	// Make sure that the new package is available before removing the old one
+	if _, err := p.AvailablePackage(superseded.SupersededBy); err != nil {
+		return err
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf(
+			"Migrating package %s to %s",
+			pkgName,
+			superseded.SupersededBy,
+		),
+	)
+	if err := p.Uninstall([]string{pkgName}, true, true, false); err != nil {
+		return err
+	}
+	if err := p.installPackages(
+		p.availablePackagesWithLocal(),
+		superseded.Installed.Instance,
+		superseded.SupersededBy,
+	); err != nil {
+		if errors.Is(err, ErrPackageTestsFailed) {
+			return err
+		}
+		return fmt.Errorf(
+			"failed to install %s after uninstalling %s, whose data was kept: %w",
+			superseded.SupersededBy,
+			pkgName,
+			err,
+		)
+	}
+	return nil
+}
+
+// latestPackage returns the newest version of the named package, or an empty package if there are
+// no versions of the package
+func latestPackage(pkgs []Package, pkgName string) Package {
+	var ret Package
+	for _, pkg := range pkgs {
+		if pkg.Name != pkgName {
+			continue
+		}
+		if ret.Version == "" || versionNewer(pkg.Version, ret.Version) {
+			ret = pkg
+		}
+	}
+	return ret
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackageValidateDeprecation(t *testing.T) {
+	testDefs := []struct {
+		Package Package
+		Error   bool
+	}{
+		{Package: Package{Name: "foo"}},
+		{Package: Package{Name: "foo", Deprecated: true, SupersededBy: "bar"}},
+		{Package: Package{Name: "foo", EolDate: "2025-06-30"}},
+		{Package: Package{Name: "foo", SupersededBy: "foo"}, Error: true},
+		{Package: Package{Name: "foo", EolDate: "06/30/2025"}, Error: true},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.Package.validateDeprecation()
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for package: %#v", testDef.Package)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestPackageDeprecationWarning(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testDefs := []struct {
+		Package    Package
+		Deprecated bool
+		Expected   string
+	}{
+		{
+			Package: Package{Name: "foo", Version: "1.0.0"},
+		},
+		{
+			Package:    Package{Name: "foo", Version: "1.0.0", Deprecated: true},
+			Deprecated: true,
+			Expected:   "package foo (= 1.0.0) is deprecated",
+		},
+		{
+			Package:  Package{Name: "foo", Version: "1.0.0", EolDate: "2025-06-30"},
+			Expected: "package foo (= 1.0.0) reaches end of life on 2025-06-30",
+		},
+		{
+			Package: Package{
+				Name:         "foo",
+				Version:      "1.0.0",
+				Deprecated:   true,
+				SupersededBy: "bar",
+				EolDate:      "2024-12-31",
+			},
+			Deprecated: true,
+			Expected:   "package foo (= 1.0.0) is deprecated and reached end of life on 2024-12-31, use bar instead",
+		},
+		{
+			// Packages past their end-of-life date are deprecated
+			Package:    Package{Name: "foo", Version: "1.0.0", EolDate: "2025-01-01"},
+			Deprecated: true,
+			Expected:   "package foo (= 1.0.0) reached end of life on 2025-01-01",
+		},
+	}
+	for _, testDef := range testDefs {
+		if ret := testDef.Package.isDeprecated(now); ret != testDef.Deprecated {
+			t.Fatalf(
+				"did not get expected deprecation for package %#v: got %v",
+				testDef.Package,
+				ret,
+			)
+		}
+		if ret := testDef.Package.deprecationWarning(now); ret != testDef.Expected {
+			t.Fatalf(
+				"did not get expected warning: got %q, expected %q",
+				ret,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestSupersededPackage(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.availablePackages = []Package{
+		{Name: "old", Version: "1.0.0"},
+		{Name: "old", Version: "1.1.0", Deprecated: true, SupersededBy: "new"},
+		{Name: "new", Version: "2.0.0"},
+		{Name: "other", Version: "1.0.0", Deprecated: true},
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{Name: "old", Version: "1.0.0"},
+			Context: activeContextName,
+		},
+		{
+			Package: Package{Name: "other", Version: "1.0.0"},
+			Context: activeContextName,
+		},
+	}
+	superseded, ok := pm.SupersededPackage("old")
+	if !ok {
+		t.Fatalf("did not find superseded package")
+	}
+	if superseded.SupersededBy != "new" || superseded.Latest.Version != "1.1.0" {
+		t.Fatalf("did not get expected superseded package: %#v", superseded)
+	}
+	// Deprecated packages without a replacement aren't superseded
+	if _, ok := pm.SupersededPackage("other"); ok {
+		t.Fatalf("did not expect package to be superseded")
+	}
+	if _, ok := pm.SupersededPackage("new"); ok {
+		t.Fatalf("did not expect uninstalled package to be superseded")
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDevnetContextName  = "devnet"
+	defaultDevnetNetworkMagic = 42
+	defaultDevnetImage        = "ghcr.io/blinklabs-io/cardano-node:10.1.4"
+	defaultDevnetSlotLength   = 100 * time.Millisecond
+	defaultDevnetEpochLength  = 500
+
+	// devnetNetworkName is the network name used for devnet contexts
+	devnetNetworkName = "devnet"
+	// devnetPackageName is the name of the built-in package that runs the devnet node
+	devnetPackageName = "devnet"
+	// devnetSecurityParam is the security parameter (k) for the devnet. This is kept low so that
+	// short epochs are still valid
+	devnetSecurityParam = 10
+	// devnetSocketPath is the path to the node socket inside the devnet container
+	devnetSocketPath = "/ipc/node.socket"
+)
+
+// devnetNodeConfig is the node config for a devnet, with all hard forks at epoch 0 so that the
+// chain starts in the latest era
+var devnetNodeConfig = map[string]any{
+	"Protocol":                     "Cardano",
+	"RequiresNetworkMagic":         "RequiresMagic",
+	"ByronGenesisFile":             "byron-genesis.json",
+	"ShelleyGenesisFile":           "shelley-genesis.json",
+	"AlonzoGenesisFile":            "alonzo-genesis.json",
+	"ConwayGenesisFile":            "conway-genesis.json",
+	"ExperimentalHardForksEnabled": true,
+	"ExperimentalProtocolsEnabled": true,
+	"TestShelleyHardForkAtEpoch":   0,
+	"TestAllegraHardForkAtEpoch":   0,
+	"TestMaryHardForkAtEpoch":      0,
+	"TestAlonzoHardForkAtEpoch":    0,
+	"TestBabbageHardForkAtEpoch":   0,
+	"TestConwayHardForkAtEpoch":    0,
+	"EnableP2P":                    true,
+	"PeerSharing":                  false,
+	"TurnOnLogging":                true,
+	"TurnOnLogMetrics":             false,
+	"minSeverity":                  "Info",
+	"setupBackends":                []string{"KatipBK"},
+	"defaultBackends":              []string{"KatipBK"},
+	"setupScribes": []map[string]any{
+		{
+			"scKind":     "StdoutSK",
+			"scName":     "stdout",
+			"scFormat":   "ScText",
+			"scRotation": nil,
+		},
+	},
+	"defaultScribes": [][]string{{"StdoutSK", "stdout"}},
+	"options":        map[string]any{},
+}
+
+// devnetTopology is the node topology for a devnet, which has no peers
+var devnetTopology = map[string]any{
+	"localRoots":         []any{},
+	"publicRoots":        []any{},
+	"useLedgerAfterSlot": -1,
+}
+
+// DevnetConfig controls creating a local devnet with CreateDevnet
+type DevnetConfig struct {
+	// ContextName is the name of the context created for the devnet (defaults to "devnet")
+	ContextName string
+	// NetworkMagic is the network magic for the devnet (defaults to 42)
+	NetworkMagic uint32
+	// Image is the cardano-node image used to generate the genesis files and keys, and to run
+	// the node
+	Image string
+	// SlotLength is the length of each slot (defaults to 100ms)
+	SlotLength time.Duration
+	// EpochLength is the number of slots in each epoch (defaults to 500)
+	EpochLength int
+}
+
+// CreateDevnet provisions a local single-node devnet. The genesis files and keys are generated
+// with cardano-cli, and a context with a custom network is created for the devnet and made
+// active. The node runs as a built-in package installed in the context, which provides the node
+// socket for other packages and 'cardano-up cli'
+func (p *PackageManager) CreateDevnet(devnetCfg DevnetConfig) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if devnetCfg.ContextName == "" {
+		devnetCfg.ContextName = defaultDevnetContextName
+	}
+	if devnetCfg.NetworkMagic == 0 {
+		devnetCfg.NetworkMagic = defaultDevnetNetworkMagic
+	}
+	if devnetCfg.Image == "" {
+		devnetCfg.Image = defaultDevnetImage
+	}
+	if devnetCfg.SlotLength <= 0 {
+		devnetCfg.SlotLength = defaultDevnetSlotLength
+	}
+	if devnetCfg.EpochLength <= 0 {
+		devnetCfg.EpochLength = defaultDevnetEpochLength
+	}
+	// Each epoch must be long enough for the chain to settle
+	if devnetCfg.EpochLength < 10*devnetSecurityParam {
+		return NewDevnetEpochLengthError(10 * devnetSecurityParam)
+	}
+	if _, ok := p.state.Contexts[devnetCfg.ContextName]; ok {
+		return ErrContextAlreadyExists
+	}
+	// Generate the genesis files and keys into a clean dir
+	networkDir := filepath.Join(
+		p.config.DataDir,
+		devnetCfg.ContextName,
+		networkConfigDirName,
+	)
+	if err := os.RemoveAll(networkDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(networkDir, fs.ModePerm); err != nil {
+		return err
+	}
+	p.config.Logger.Info("Generating devnet genesis files and keys")
+	if err := p.generateDevnetGenesis(devnetCfg, networkDir); err != nil {
+		return err
+	}
+	if err := updateDevnetGenesis(networkDir, devnetCfg); err != nil {
+		return err
+	}
+	if err := setDevnetStartTime(networkDir, time.Now()); err != nil {
+		return err
+	}
+	if err := writeDevnetNodeConfig(networkDir); err != nil {
+		return err
+	}
+	// Create and switch to the devnet context
+	if err := p.AddContext(
+		devnetCfg.ContextName,
+		Context{
+			Description:      "Local devnet",
+			Network:          devnetNetworkName,
+			NetworkMagic:     devnetCfg.NetworkMagic,
+			NetworkConfigDir: networkDir,
+			Devnet:           true,
+		},
+	); err != nil {
+		return err
+	}
+	if err := p.SetActiveContext(devnetCfg.ContextName); err != nil {
+		return err
+	}
+	// Install the devnet node
+	devnetPkg := devnetPackage(devnetCfg.Image)
+	return p.installPackages([]Package{devnetPkg}, "", devnetPkg.Name)
+}
+
+// ResetDevnet wipes the chain for a devnet and restarts it from slot 0. The genesis files and
+// keys are kept, with the start time updated to the current time
+func (p *PackageManager) ResetDevnet(contextName string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	devnetContext, ok := p.state.Contexts[contextName]
+	if !ok {
+		return ErrContextNotExist
+	}
+	if !devnetContext.Devnet {
+		return NewNotDevnetError(contextName)
+	}
+	var devnetPkg InstalledPackage
+	foundPackage := false
+	for _, installedPkg := range p.state.InstalledPackages {
+		if installedPkg.Context == contextName &&
+			installedPkg.Package.Name == devnetPackageName {
+			devnetPkg = installedPkg
+			foundPackage = true
+			break
+		}
+	}
+	if !foundPackage {
+		return NewPackageNotInstalledError(devnetPackageName, contextName)
+	}
+	cfg := p.config
+	cfg.DockerHost = devnetContext.DockerHost
+	services, err := devnetPkg.Package.services(cfg, contextName)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if err := svc.Stop(); err != nil {
+			return err
+		}
+	}
+	// Remove the chain data for the node
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		devnetPkg.Package.instanceName(),
+		devnetPkg.Package.Version,
+		contextName,
+	)
+	dbDir := filepath.Join(p.config.packageDataDir(pkgName), "db")
+	if err := os.RemoveAll(dbDir); err != nil {
+		return err
+	}
+	if err := setDevnetStartTime(devnetContext.NetworkConfigDir, time.Now()); err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if err := svc.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateDevnetGenesis runs cardano-cli in a container to generate the genesis files and keys
+// for a devnet with a single stake pool
+func (p *PackageManager) generateDevnetGenesis(devnetCfg DevnetConfig, networkDir string) error {
+	svc := DockerService{
+		logger:        p.config.Logger,
+		ctx:           p.config.ctx(),
+		retryCfg:      p.config.DockerRetry,
+		oneShot:       true,
+		ContainerName: fmt.Sprintf("cardano-up-devnet-genesis-%s", devnetCfg.ContextName),
+		Image:         devnetCfg.Image,
+		Command:       []string{"cardano-cli"},
+		Args: []string{
+			"conway", "genesis", "create-testnet-data",
+			"--testnet-magic", strconv.FormatUint(uint64(devnetCfg.NetworkMagic), 10),
+			"--pools", "1",
+			"--stake-delegators", "1",
+			"--utxo-keys", "1",
+			"--out-dir", "/network",
+		},
+		Binds: []string{
+			networkDir + ":/network",
+		},
+	}
+	exitCode, output, err := svc.runOneShot()
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return NewDevnetGenesisError(exitCode, output)
+	}
+	// The node refuses to use keys that are readable by others
+	return filepath.WalkDir(
+		networkDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && strings.HasSuffix(path, ".skey") {
+				return os.Chmod(path, 0o600)
+			}
+			return nil
+		},
+	)
+}
+
+// devnetPackage returns the built-in package that runs the devnet node as the block producer for
+// the single stake pool
+func devnetPackage(image string) Package {
+	return Package{
+		SpecVersion: PackageSpecVersion,
+		Name:        devnetPackageName,
+		Version:     "1.0.0",
+		Description: "Local single-node Cardano devnet",
+		Sockets: []PackageSocket{
+			{
+				Name:          nodeSocketName,
+				Description:   "Cardano Node UNIX socket",
+				ContainerPath: devnetSocketPath,
+				Env:           "CARDANO_NODE_SOCKET_PATH",
+			},
+		},
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "cardano-node",
+					Image:         image,
+					Command:       []string{"cardano-node"},
+					Args: []string{
+						"run",
+						"--config", "/network/config.json",
+						"--topology", "/network/topology.json",
+						"--database-path", "/data/db",
+						"--socket-path", devnetSocketPath,
+						"--shelley-kes-key", "/network/pools-keys/pool1/kes.skey",
+						"--shelley-vrf-key", "/network/pools-keys/pool1/vrf.skey",
+						"--shelley-operational-certificate", "/network/pools-keys/pool1/opcert.cert",
+						"--host-addr", "0.0.0.0",
+						"--port", "3001",
+					},
+					Binds: []string{
+						"{{ .Context.NetworkConfigDir }}:/network",
+						"{{ .Paths.DataDir }}:/data",
+					},
+					Sockets: []string{nodeSocketName},
+				},
+			},
+		},
+		PostInstallNotes: "The devnet is running. Query it with 'cardano-up cli query tip', and " +
+			"find the funded UTxO keys in {{ .Context.NetworkConfigDir }}/utxo-keys. " +
+			"Run 'cardano-up devnet reset' to restart the chain from slot 0.",
+	}
+}
+
+// updateDevnetGenesis sets the slot and epoch lengths in the generated genesis files, and makes
+// every slot a leader slot for the single stake pool
+func updateDevnetGenesis(networkDir string, devnetCfg DevnetConfig) error {
+	if err := updateGenesisFile(
+		filepath.Join(networkDir, "shelley-genesis.json"),
+		func(genesis map[string]any) {
+			genesis["slotLength"] = json.Number(
+				strconv.FormatFloat(devnetCfg.SlotLength.Seconds(), 'f', -1, 64),
+			)
+			genesis["epochLength"] = devnetCfg.EpochLength
+			genesis["activeSlotsCoeff"] = 1
+			genesis["securityParam"] = devnetSecurityParam
+		},
+	); err != nil {
+		return err
+	}
+	return updateGenesisFile(
+		filepath.Join(networkDir, "byron-genesis.json"),
+		func(genesis map[string]any) {
+			protocolConsts, ok := genesis["protocolConsts"].(map[string]any)
+			if !ok {
+				protocolConsts = map[string]any{}
+				genesis["protocolConsts"] = protocolConsts
+			}
+			protocolConsts["k"] = devnetSecurityParam
+		},
+	)
+}
+
+// setDevnetStartTime sets the start time of the chain in the genesis files
+func setDevnetStartTime(networkDir string, startTime time.Time) error {
+	startTime = startTime.UTC().Truncate(time.Second)
+	if err := updateGenesisFile(
+		filepath.Join(networkDir, "shelley-genesis.json"),
+		func(genesis map[string]any) {
+			genesis["systemStart"] = startTime.Format(time.RFC3339)
+		},
+	); err != nil {
+		return err
+	}
+	return updateGenesisFile(
+		filepath.Join(networkDir, "byron-genesis.json"),
+		func(genesis map[string]any) {
+			genesis["startTime"] = startTime.Unix()
+		},
+	)
+}
+
+// updateGenesisFile applies changes to a genesis file. Numbers are preserved as-is, since
+// genesis files contain values too large to be represented exactly as floats
+func updateGenesisFile(path string, update func(map[string]any)) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return NewDevnetGenesisMissingError(path)
+		}
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var genesis map[string]any
+	if err := dec.Decode(&genesis); err != nil {
+		return fmt.Errorf("failed to parse genesis file %s: %w", path, err)
+	}
+	update(genesis)
+	content, err = json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// writeDevnetNodeConfig writes the node config and topology files for a devnet
+func writeDevnetNodeConfig(networkDir string) error {
+	files := map[string]map[string]any{
+		"config.json":   devnetNodeConfig,
+		"topology.json": devnetTopology,
+	}
+	for filename, content := range files {
+		data, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(networkDir, filename), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
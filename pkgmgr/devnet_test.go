@@ -0,0 +1,134 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevnetGenesis(t *testing.T) {
+	networkDir := t.TempDir()
+	genesisFiles := map[string]string{
+		"shelley-genesis.json": `{"maxLovelaceSupply": 45000000000000000, "slotLength": 1, "epochLength": 432000, "activeSlotsCoeff": 0.05, "securityParam": 2160, "systemStart": "2020-01-01T00:00:00Z"}`,
+		"byron-genesis.json":   `{"protocolConsts": {"k": 2160, "protocolMagic": 42}, "startTime": 0}`,
+	}
+	for filename, content := range genesisFiles {
+		if err := os.WriteFile(filepath.Join(networkDir, filename), []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	devnetCfg := DevnetConfig{
+		SlotLength:  100 * time.Millisecond,
+		EpochLength: 500,
+	}
+	if err := updateDevnetGenesis(networkDir, devnetCfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	startTime := time.Date(2024, 6, 1, 12, 30, 15, 500, time.UTC)
+	if err := setDevnetStartTime(networkDir, startTime); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(networkDir, "shelley-genesis.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Large numbers must not be converted to floats
+	if !strings.Contains(string(content), `"maxLovelaceSupply": 45000000000000000`) {
+		t.Fatalf("large number was not preserved in genesis: %s", content)
+	}
+	var shelley map[string]any
+	if err := json.Unmarshal(content, &shelley); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedShelley := map[string]any{
+		"slotLength":       0.1,
+		"epochLength":      float64(500),
+		"activeSlotsCoeff": float64(1),
+		"securityParam":    float64(devnetSecurityParam),
+		"systemStart":      "2024-06-01T12:30:15Z",
+	}
+	for key, expected := range expectedShelley {
+		if shelley[key] != expected {
+			t.Fatalf(
+				"did not get expected value for %s: got %v, expected %v",
+				key,
+				shelley[key],
+				expected,
+			)
+		}
+	}
+	content, err = os.ReadFile(filepath.Join(networkDir, "byron-genesis.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var byron struct {
+		ProtocolConsts struct {
+			K             int `json:"k"`
+			ProtocolMagic int `json:"protocolMagic"`
+		} `json:"protocolConsts"`
+		StartTime int64 `json:"startTime"`
+	}
+	if err := json.Unmarshal(content, &byron); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if byron.ProtocolConsts.K != devnetSecurityParam || byron.ProtocolConsts.ProtocolMagic != 42 {
+		t.Fatalf("did not get expected byron protocol consts: %+v", byron.ProtocolConsts)
+	}
+	if byron.StartTime != startTime.Unix() {
+		t.Fatalf(
+			"did not get expected byron start time: got %d, expected %d",
+			byron.StartTime,
+			startTime.Unix(),
+		)
+	}
+	// Missing genesis files are an error
+	if err := updateDevnetGenesis(t.TempDir(), devnetCfg); err == nil {
+		t.Fatalf("did not get expected error for missing genesis file: %v", err)
+	}
+}
+
+func TestCreateDevnetValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.CreateDevnet(DevnetConfig{EpochLength: 10}); err == nil {
+		t.Fatalf("did not get expected error for short epoch length")
+	}
+	if err := pm.CreateDevnet(DevnetConfig{ContextName: "default"}); !errors.Is(
+		err,
+		ErrContextAlreadyExists,
+	) {
+		t.Fatalf("did not get expected error for existing context: %v", err)
+	}
+	if err := pm.ResetDevnet("default"); err == nil {
+		t.Fatalf("did not get expected error resetting non-devnet context")
+	}
+}
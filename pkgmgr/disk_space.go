@@ -0,0 +1,131 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// minDiskSpace returns the free disk space in bytes that the package requires for its data, or 0
+// if it doesn't declare any
+func (p Package) minDiskSpace() (uint64, error) {
+	if p.MinDiskSpace == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(p.MinDiskSpace)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid min disk space: %s", p.MinDiskSpace)
+	}
+	return uint64(size), nil
+}
+
+// checkInstallDiskSpace shows the estimated download size of the images and the disk space
+// required by the packages to install, and fails before anything is installed if the data dir or
+// Docker filesystem doesn't have enough free space
+func (p *PackageManager) checkInstallDiskSpace(installPkgs []ResolverInstallSet) error {
+	images := newPlanImages(p.config)
+	actions, err := p.planInstallSets(installPkgs, p.config.BindOverrides, images)
+	if err != nil {
+		return err
+	}
+	downloadSize := images.downloadSize()
+	var diskSpace uint64
+	for _, action := range actions {
+		diskSpace += action.DiskSpace
+	}
+	var sizes []string
+	if downloadSize > 0 {
+		sizes = append(sizes, "estimated image download size "+FormatBytes(downloadSize))
+	}
+	if diskSpace > 0 {
+		sizes = append(sizes, "required disk space "+FormatBytes(diskSpace))
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf("Disk usage: %s", strings.Join(sizes, ", ")),
+	)
+	if p.config.IgnoreDiskSpace {
+		return nil
+	}
+	// The package data and images are on the Docker host when it's remote
+	if !isLocalDockerHost(p.config.DockerHost) {
+		return nil
+	}
+	if diskSpace > 0 {
+		if err := checkDiskFree(p.config.packageDataDir(""), diskSpace); err != nil {
+			return err
+		}
+	}
+	if downloadSize > 0 {
+		dockerRootDir := p.dockerRootDir()
+		if dockerRootDir == "" {
+			return nil
+		}
+		if err := checkDiskFree(dockerRootDir, downloadSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dockerRootDir returns the dir where the Docker host stores images, or an empty string if it
+// can't be determined or isn't on this machine, such as with Docker Desktop
+func (p *PackageManager) dockerRootDir() string {
+	client, err := NewDockerClientForHost(p.config.DockerHost)
+	if err != nil {
+		return ""
+	}
+	defer client.Close()
+	info, err := client.Info(p.config.ctx())
+	if err != nil {
+		p.config.Logger.Debug(fmt.Sprintf("failed to get Docker info: %s", err))
+		return ""
+	}
+	if info.DockerRootDir == "" || info.OperatingSystem == "Docker Desktop" {
+		return ""
+	}
+	if _, err := os.Stat(info.DockerRootDir); err != nil {
+		return ""
+	}
+	return info.DockerRootDir
+}
+
+// checkDiskFree checks that the filesystem containing the path has at least the required free
+// space. Failures to get the free space are ignored
+func checkDiskFree(path string, required uint64) error {
+	free, err := diskFree(path)
+	if err != nil {
+		return nil
+	}
+	if free < required {
+		return NewInsufficientDiskSpaceError(path, required, free)
+	}
+	return nil
+}
+
+// isLocalDockerHost returns whether the Docker host runs on this machine
+func isLocalDockerHost(dockerHost string) bool {
+	if dockerHost == "" {
+		dockerHost = os.Getenv("DOCKER_HOST")
+	}
+	return dockerHost == "" || strings.HasPrefix(dockerHost, "unix://") ||
+		strings.HasPrefix(dockerHost, "npipe://")
+}
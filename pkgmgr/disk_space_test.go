@@ -0,0 +1,99 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPackageMinDiskSpace(t *testing.T) {
+	testDefs := []struct {
+		minDiskSpace  string
+		expectedSize  uint64
+		expectedError bool
+	}{
+		{
+			minDiskSpace: "",
+			expectedSize: 0,
+		},
+		{
+			minDiskSpace: "200g",
+			expectedSize: 200 * 1024 * 1024 * 1024,
+		},
+		{
+			minDiskSpace: "512MB",
+			expectedSize: 512 * 1024 * 1024,
+		},
+		{
+			minDiskSpace:  "lots",
+			expectedError: true,
+		},
+		{
+			minDiskSpace:  "0",
+			expectedError: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		pkg := Package{Name: "node", Version: "1.0.0", MinDiskSpace: testDef.minDiskSpace}
+		size, err := pkg.minDiskSpace()
+		if testDef.expectedError {
+			if err == nil {
+				t.Fatalf("did not get expected error for %q", testDef.minDiskSpace)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if size != testDef.expectedSize {
+			t.Fatalf(
+				"did not get expected size for %q: got %d, expected %d",
+				testDef.minDiskSpace,
+				size,
+				testDef.expectedSize,
+			)
+		}
+	}
+}
+
+func TestCheckDiskFree(t *testing.T) {
+	tmpDir := t.TempDir()
+	// The nearest existing parent is used for a path that doesn't exist yet
+	if err := checkDiskFree(tmpDir+"/data/pkg", 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := checkDiskFree(tmpDir, math.MaxUint64); err == nil {
+		t.Fatalf("did not get expected error")
+	}
+}
+
+func TestIsLocalDockerHost(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	testDefs := []struct {
+		dockerHost string
+		expected   bool
+	}{
+		{dockerHost: "", expected: true},
+		{dockerHost: "unix:///var/run/docker.sock", expected: true},
+		{dockerHost: "ssh://node@bp1.example.com", expected: false},
+		{dockerHost: "tcp://10.0.0.5:2376", expected: false},
+	}
+	for _, testDef := range testDefs {
+		if isLocalDockerHost(testDef.dockerHost) != testDef.expected {
+			t.Fatalf("did not get expected result for %q", testDef.dockerHost)
+		}
+	}
+}
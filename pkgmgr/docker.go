@@ -16,23 +16,35 @@ package pkgmgr
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 const (
@@ -47,11 +59,33 @@ about how to install Docker.
 If Docker is already installed but the socket is not in a standard location, you can use the DOCKER_HOST environment
 variable to point to it.
 `
+
+	// defaultStopTimeout is the number of seconds to wait for a container to stop before killing it
+	defaultStopTimeout = 60
+
+	// containerUserImage is the container user that runs the container as the default user for the
+	// image, rather than the local user
+	containerUserImage = "image"
+
+	// dockerPingTimeout is how long to wait for the Docker daemon to respond when checking whether
+	// it's available
+	dockerPingTimeout = 5 * time.Second
 )
 
 type DockerService struct {
-	client        *client.Client
-	logger        *slog.Logger
+	client *client.Client
+	logger *slog.Logger
+	ctx    context.Context
+	// host is the Docker host URL, or empty to use DOCKER_HOST or the default local socket
+	host string
+	// user is the user and group for the container, which defaults to the current local user.
+	// containerUserImage uses the default user for the image
+	user string
+	// retryCfg controls retrying Docker API calls that fail with transient errors
+	retryCfg RetryConfig
+	// oneShot disables restarting the container when it exits, for containers that run a
+	// command to completion
+	oneShot       bool
 	ContainerId   string
 	ContainerName string
 	Image         string
@@ -60,23 +94,113 @@ type DockerService struct {
 	Args          []string
 	Binds         []string
 	Ports         []string
+	StopSignal    string
+	StopTimeout   *int
+	Devices       []string
+	Gpus          string
+	// Platform is the image platform in the os/arch[/variant] format, or empty to use the
+	// native platform of the Docker host
+	Platform string
+	// Networks lists the Docker networks that the container is connected to, rather than the
+	// default bridge network
+	Networks []string
+	// Runtime holds extra runtime options for the container
+	Runtime DockerRuntimeOptions
+	// Interactive allocates a TTY for the container and keeps its stdin open
+	Interactive bool
+	// networkAliases lists extra names for the container on its networks
+	networkAliases []string
+}
+
+// dockerHostGateway is the special extra host IP that Docker resolves to the IP of the host
+const dockerHostGateway = "host-gateway"
+
+// DockerRuntimeOptions holds extra runtime options for a container, which map to the Docker
+// host config
+type DockerRuntimeOptions struct {
+	// ExtraHosts are entries to add to /etc/hosts in the Docker --add-host flag format
+	ExtraHosts []string
+	Dns        []string
+	Sysctls    map[string]string
+	// Ulimits are resource limits in the Docker --ulimit flag format
+	Ulimits []string
+	CapAdd  []string
+	CapDrop []string
+	// ShmSize is the size of /dev/shm (e.g. 256m), or empty to use the Docker default
+	ShmSize  string
+	ReadOnly bool
+	// Tmpfs are tmpfs mounts in the Docker --tmpfs flag format (CONTAINER_PATH[:OPTIONS])
+	Tmpfs []string
 }
 
 func NewDockerServiceFromContainerName(
 	containerName string,
 	logger *slog.Logger,
+) (*DockerService, error) {
+	return NewDockerServiceFromContainerNameContext(
+		context.Background(),
+		containerName,
+		logger,
+	)
+}
+
+// NewDockerServiceFromContainerNameContext is like NewDockerServiceFromContainerName, but
+// Docker operations for the returned service use the provided context for cancellation
+func NewDockerServiceFromContainerNameContext(
+	ctx context.Context,
+	containerName string,
+	logger *slog.Logger,
+) (*DockerService, error) {
+	return dockerServiceFromContainerName(
+		ctx,
+		"",
+		RetryConfig{},
+		containerName,
+		logger,
+	)
+}
+
+// newDockerService returns the service for an existing container, using the Docker host and
+// context from the config
+func newDockerService(cfg Config, containerName string) (*DockerService, error) {
+	return dockerServiceFromContainerName(
+		cfg.ctx(),
+		cfg.DockerHost,
+		cfg.DockerRetry,
+		containerName,
+		cfg.Logger,
+	)
+}
+
+func dockerServiceFromContainerName(
+	ctx context.Context,
+	dockerHost string,
+	retryCfg RetryConfig,
+	containerName string,
+	logger *slog.Logger,
 ) (*DockerService, error) {
 	ret := &DockerService{
-		logger: logger,
+		logger:   logger,
+		ctx:      ctx,
+		host:     dockerHost,
+		retryCfg: retryCfg,
 	}
 	client, err := ret.getClient()
 	if err != nil {
 		return nil, err
 	}
-	tmpContainers, err := client.ContainerList(
-		context.Background(),
-		container.ListOptions{
-			All: true,
+	var tmpContainers []types.Container
+	err = ret.retry(
+		"listing containers",
+		func() error {
+			var err error
+			tmpContainers, err = client.ContainerList(
+				ret.getContext(),
+				container.ListOptions{
+					All: true,
+				},
+			)
+			return err
 		},
 	)
 	if err != nil {
@@ -105,6 +229,27 @@ func (d *DockerService) Running() (bool, error) {
 	return container.State.Running, nil
 }
 
+// healthState returns the state of the container, including the status of its Docker health
+// check if it has one
+func (d *DockerService) healthState() (containerHealth, error) {
+	container, err := d.inspect()
+	if err != nil {
+		return containerHealth{}, err
+	}
+	ret := containerHealth{
+		Name:     d.ContainerName,
+		Running:  container.State.Running,
+		ExitCode: container.State.ExitCode,
+	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, container.State.StartedAt); err == nil {
+		ret.StartedAt = startedAt
+	}
+	if container.State.Health != nil {
+		ret.Health = container.State.Health.Status
+	}
+	return ret, nil
+}
+
 func (d *DockerService) Start() error {
 	running, err := d.Running()
 	if err != nil {
@@ -116,10 +261,15 @@ func (d *DockerService) Start() error {
 			return err
 		}
 		d.logger.Debug(fmt.Sprintf("starting container %s", d.ContainerName))
-		if err := client.ContainerStart(
-			context.Background(),
-			d.ContainerId,
-			container.StartOptions{},
+		if err := d.retry(
+			"starting container "+d.ContainerName,
+			func() error {
+				return client.ContainerStart(
+					d.getContext(),
+					d.ContainerId,
+					container.StartOptions{},
+				)
+			},
 		); err != nil {
 			return err
 		}
@@ -138,12 +288,21 @@ func (d *DockerService) Stop() error {
 			return err
 		}
 		d.logger.Debug(fmt.Sprintf("stopping container %s", d.ContainerName))
-		stopTimeout := 60
-		if err := client.ContainerStop(
-			context.Background(),
-			d.ContainerId,
-			container.StopOptions{
-				Timeout: &stopTimeout,
+		stopTimeout := defaultStopTimeout
+		if d.StopTimeout != nil {
+			stopTimeout = *d.StopTimeout
+		}
+		if err := d.retry(
+			"stopping container "+d.ContainerName,
+			func() error {
+				return client.ContainerStop(
+					d.getContext(),
+					d.ContainerId,
+					container.StopOptions{
+						Signal:  d.StopSignal,
+						Timeout: &stopTimeout,
+					},
+				)
 			},
 		); err != nil {
 			return err
@@ -181,33 +340,82 @@ func (d *DockerService) Create() error {
 		exposePorts[port] = struct{}{}
 	}
 
+	// Convert devices
+	tmpDevices, err := parseDeviceMappings(d.Devices)
+	if err != nil {
+		return err
+	}
+	tmpDeviceRequests, err := parseGpuRequest(d.Gpus)
+	if err != nil {
+		return err
+	}
+	tmpPlatform, err := parsePlatform(d.Platform)
+	if err != nil {
+		return err
+	}
+
 	// Set the desired user ID and group ID
-	userID := os.Getuid()
-	groupID := os.Getgid()
-	userAndGroup := fmt.Sprintf("%d:%d", userID, groupID)
+	userAndGroup := d.user
+	switch userAndGroup {
+	case "":
+		userAndGroup = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	case containerUserImage:
+		userAndGroup = ""
+	}
+	restartPolicy := container.RestartPolicy{
+		Name: container.RestartPolicyUnlessStopped,
+	}
+	if d.oneShot {
+		restartPolicy.Name = container.RestartPolicyDisabled
+	}
+	tmpHostConfig, err := d.Runtime.hostConfig()
+	if err != nil {
+		return err
+	}
+	tmpHostConfig.RestartPolicy = restartPolicy
+	tmpHostConfig.Binds = d.Binds[:]
+	tmpHostConfig.PortBindings = tmpPorts
+	tmpHostConfig.Resources.Devices = tmpDevices
+	tmpHostConfig.Resources.DeviceRequests = tmpDeviceRequests
+	var tmpNetworkingConfig *network.NetworkingConfig
+	if len(d.Networks) > 0 {
+		// Only one network can be provided when creating the container with older Docker
+		// versions, so the container is connected to the others afterward
+		tmpHostConfig.NetworkMode = container.NetworkMode(d.Networks[0])
+		tmpNetworkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				d.Networks[0]: {Aliases: d.networkAliases},
+			},
+		}
+	}
 	// Create container
 	d.logger.Debug(fmt.Sprintf("creating container %s", d.ContainerName))
-	resp, err := client.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Hostname:     d.ContainerName,
-			Image:        d.Image,
-			Entrypoint:   d.Command,
-			Cmd:          d.Args,
-			Env:          tmpEnv[:],
-			User:         userAndGroup,
-			ExposedPorts: exposePorts,
+	resp, err := d.createContainer(
+		func() (container.CreateResponse, error) {
+			return client.ContainerCreate(
+				d.getContext(),
+				&container.Config{
+					Hostname:     d.ContainerName,
+					Image:        d.Image,
+					Entrypoint:   d.Command,
+					Cmd:          d.Args,
+					Env:          tmpEnv[:],
+					User:         userAndGroup,
+					ExposedPorts: exposePorts,
+					StopSignal:   d.StopSignal,
+					StopTimeout:  d.StopTimeout,
+					Tty:          d.Interactive,
+					OpenStdin:    d.Interactive,
+				},
+				tmpHostConfig,
+				tmpNetworkingConfig,
+				tmpPlatform,
+				d.ContainerName,
+			)
 		},
-		&container.HostConfig{
-			RestartPolicy: container.RestartPolicy{
-				Name: container.RestartPolicyUnlessStopped,
-			},
-			Binds:        d.Binds[:],
-			PortBindings: tmpPorts,
+		func() (types.ContainerJSON, error) {
+			return client.ContainerInspect(d.getContext(), d.ContainerName)
 		},
-		nil,
-		nil,
-		d.ContainerName,
 	)
 	if err != nil {
 		return err
@@ -216,9 +424,66 @@ func (d *DockerService) Create() error {
 	for _, warning := range resp.Warnings {
 		d.logger.Warn(warning)
 	}
+	for idx, networkName := range d.Networks {
+		if idx == 0 {
+			// Connected when creating the container
+			continue
+		}
+		err := d.retry(
+			"connecting container "+d.ContainerName+" to network "+networkName,
+			func() error {
+				return client.NetworkConnect(
+					d.getContext(),
+					networkName,
+					d.ContainerId,
+					&network.EndpointSettings{Aliases: d.networkAliases},
+				)
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// createContainer creates a container, retrying on transient errors. Creating a container isn't
+// idempotent, so when a retried attempt conflicts with an existing container that has the same
+// name and image, that container is used, since an earlier attempt created it even though its
+// response was lost
+func (d *DockerService) createContainer(
+	create func() (container.CreateResponse, error),
+	inspect func() (types.ContainerJSON, error),
+) (container.CreateResponse, error) {
+	var resp container.CreateResponse
+	var attempts int
+	err := d.retry(
+		"creating container "+d.ContainerName,
+		func() error {
+			attempts++
+			var err error
+			resp, err = create()
+			if err == nil || attempts == 1 || !errdefs.IsConflict(err) {
+				return err
+			}
+			existing, inspectErr := inspect()
+			if inspectErr != nil || existing.ContainerJSONBase == nil ||
+				existing.Config == nil || existing.Config.Image != d.Image {
+				return err
+			}
+			d.logger.Debug(
+				fmt.Sprintf(
+					"using container %s created by an earlier attempt",
+					d.ContainerName,
+				),
+			)
+			resp = container.CreateResponse{ID: existing.ID}
+			return nil
+		},
+	)
+	return resp, err
+}
+
 func (d *DockerService) Remove() error {
 	running, err := d.Running()
 	if err != nil {
@@ -232,19 +497,50 @@ func (d *DockerService) Remove() error {
 		return err
 	}
 	d.logger.Debug(fmt.Sprintf("removing container %s", d.ContainerName))
-	if err := client.ContainerRemove(
-		context.Background(),
-		d.ContainerId,
-		container.RemoveOptions{},
+	if err := d.retry(
+		"removing container "+d.ContainerName,
+		func() error {
+			return client.ContainerRemove(
+				d.getContext(),
+				d.ContainerId,
+				container.RemoveOptions{},
+			)
+		},
 	); err != nil {
 		return err
 	}
 	return nil
 }
 
+// LogsOptions controls which container logs are output
+type LogsOptions struct {
+	Follow bool
+	// Tail is the number of lines to show from the end of the logs, or "all"
+	Tail string
+	// Timestamps prefixes each line with its timestamp
+	Timestamps bool
+	// Since and Until limit the logs to a time range. Each is a duration relative to the current
+	// time (e.g. 1h) or a timestamp (e.g. 2024-06-01T12:00:00Z), as accepted by Docker
+	Since string
+	Until string
+	// Grep only outputs lines matching the regular expression
+	Grep string
+}
+
+// grepRegexp returns the compiled grep pattern, or nil if there isn't one
+func (o LogsOptions) grepRegexp() (*regexp.Regexp, error) {
+	if o.Grep == "" {
+		return nil, nil
+	}
+	ret, err := regexp.Compile(o.Grep)
+	if err != nil {
+		return nil, NewInvalidGrepPatternError(o.Grep, err)
+	}
+	return ret, nil
+}
+
 func (d *DockerService) Logs(
-	follow bool,
-	tail string,
+	opts LogsOptions,
 	stdoutWriter io.Writer,
 	stderrWriter io.Writer,
 ) error {
@@ -253,11 +549,14 @@ func (d *DockerService) Logs(
 		return err
 	}
 	logsOut, err := client.ContainerLogs(
-		context.Background(),
+		d.getContext(),
 		d.ContainerName,
 		container.LogsOptions{
-			Follow:     follow,
-			Tail:       tail,
+			Follow:     opts.Follow,
+			Tail:       opts.Tail,
+			Timestamps: opts.Timestamps,
+			Since:      opts.Since,
+			Until:      opts.Until,
 			ShowStdout: true,
 			ShowStderr: true,
 		},
@@ -274,15 +573,212 @@ func (d *DockerService) Logs(
 	return nil
 }
 
+// Wait waits for the container to exit and returns its exit code
+func (d *DockerService) Wait() (int64, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return 0, err
+	}
+	waitCh, errCh := client.ContainerWait(
+		d.getContext(),
+		d.ContainerId,
+		container.WaitConditionNotRunning,
+	)
+	select {
+	case resp := <-waitCh:
+		if resp.Error != nil {
+			return 0, errors.New(resp.Error.Message)
+		}
+		return resp.StatusCode, nil
+	case err := <-errCh:
+		return 0, err
+	}
+}
+
+// runOneShot creates and starts a one-shot container, waits for it to exit, and removes it. The
+// exit code is returned, along with the last lines of output if the command failed
+func (d *DockerService) runOneShot() (int64, string, error) {
+	if err := d.Create(); err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err := d.Remove(); err != nil {
+			d.logger.Warn(
+				fmt.Sprintf("failed to remove container %s: %s", d.ContainerName, err),
+			)
+		}
+	}()
+	if err := d.Start(); err != nil {
+		return 0, "", err
+	}
+	exitCode, err := d.Wait()
+	if err != nil {
+		return 0, "", err
+	}
+	if exitCode != 0 {
+		var output bytes.Buffer
+		_ = d.Logs(LogsOptions{Tail: "20"}, &output, &output)
+		return exitCode, strings.TrimSpace(output.String()), nil
+	}
+	return 0, "", nil
+}
+
+// Exec runs a command in the container and returns its exit code. Input is read from stdin if
+// provided. When tty is set, a pseudo-terminal is allocated and all output is written to stdout
+func (d *DockerService) Exec(
+	cmd []string,
+	env []string,
+	tty bool,
+	stdin io.Reader,
+	stdoutWriter io.Writer,
+	stderrWriter io.Writer,
+) (int, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return 0, err
+	}
+	execResp, err := client.ContainerExecCreate(
+		d.getContext(),
+		d.ContainerName,
+		container.ExecOptions{
+			Cmd:          cmd,
+			Env:          env,
+			Tty:          tty,
+			AttachStdin:  stdin != nil,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	attachResp, err := client.ContainerExecAttach(
+		d.getContext(),
+		execResp.ID,
+		container.ExecAttachOptions{
+			Tty: tty,
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer attachResp.Close()
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(attachResp.Conn, stdin)
+			_ = attachResp.CloseWrite()
+		}()
+	}
+	if tty {
+		_, err = io.Copy(stdoutWriter, attachResp.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdoutWriter, stderrWriter, attachResp.Reader)
+	}
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	execInspect, err := client.ContainerExecInspect(d.getContext(), execResp.ID)
+	if err != nil {
+		return 0, err
+	}
+	return execInspect.ExitCode, nil
+}
+
+// CollectLogs writes all logs for the container, with timestamps, to the provided writer
+func (d *DockerService) CollectLogs(w io.Writer) error {
+	return d.collectLogs(false, time.Time{}, w)
+}
+
+// FollowLogs writes logs for the container since the provided time, with timestamps, to the
+// provided writer. New logs are written until the container stops or the context is cancelled
+func (d *DockerService) FollowLogs(since time.Time, w io.Writer) error {
+	return d.collectLogs(true, since, w)
+}
+
+func (d *DockerService) collectLogs(follow bool, since time.Time, w io.Writer) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	opts := container.LogsOptions{
+		Follow:     follow,
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	}
+	if !since.IsZero() {
+		opts.Since = since.Format(time.RFC3339Nano)
+	}
+	logsOut, err := client.ContainerLogs(
+		d.getContext(),
+		d.ContainerName,
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+	defer logsOut.Close()
+	if _, err := stdcopy.StdCopy(w, w, logsOut); err != nil {
+		if err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullImage pulls the image, retrying if the pull fails with a transient error. Layers that were
+// already downloaded are reused by the Docker engine when retrying
 func (d *DockerService) pullImage() error {
+	if err := d.retry(
+		"pulling image "+d.Image,
+		d.pullImageOnce,
+	); err != nil {
+		return err
+	}
+	d.checkImagePlatform()
+	return nil
+}
+
+// checkImagePlatform warns when the image doesn't match the architecture of the Docker host, since
+// the container then runs under emulation, which can be much slower
+func (d *DockerService) checkImagePlatform() {
+	client, err := d.getClient()
+	if err != nil {
+		return
+	}
+	imageInfo, _, err := client.ImageInspectWithRaw(d.getContext(), d.Image)
+	if err != nil {
+		d.logger.Debug(fmt.Sprintf("failed to inspect image %s: %s", d.Image, err))
+		return
+	}
+	version, err := client.ServerVersion(d.getContext())
+	if err != nil {
+		d.logger.Debug(fmt.Sprintf("failed to get Docker server version: %s", err))
+		return
+	}
+	warning := imageEmulationWarning(
+		d.Image,
+		imageInfo.Architecture,
+		version.Arch,
+		d.Platform != "",
+		d.host == "" && isARMMac(),
+	)
+	if warning != "" {
+		d.logger.Warn(warning)
+	}
+}
+
+func (d *DockerService) pullImageOnce() error {
 	client, err := d.getClient()
 	if err != nil {
 		return err
 	}
 	out, err := client.ImagePull(
-		context.Background(),
+		d.getContext(),
 		d.Image,
-		image.PullOptions{},
+		image.PullOptions{
+			Platform: d.Platform,
+		},
 	)
 	if err != nil {
 		return err
@@ -295,6 +791,7 @@ func (d *DockerService) pullImage() error {
 			Status         string         `json:"status"`
 			ProgressDetail map[string]any `json:"progressDetail"`
 			Id             string         `json:"id"`
+			Error          string         `json:"error"`
 		}
 		line := scanner.Text()
 		if err := json.Unmarshal([]byte(line), &tmpStatus); err != nil {
@@ -305,6 +802,10 @@ func (d *DockerService) pullImage() error {
 				),
 			)
 		}
+		// Errors during the pull are reported in the stream rather than from the API call
+		if tmpStatus.Error != "" {
+			return NewImagePullError(d.Image, tmpStatus.Error)
+		}
 		// Skip progress update lines
 		if len(tmpStatus.ProgressDetail) > 0 {
 			continue
@@ -327,14 +828,41 @@ func (d *DockerService) pullImage() error {
 	return nil
 }
 
+// rename changes the name of the container
+func (d *DockerService) rename(newName string) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+	d.logger.Debug(fmt.Sprintf("renaming container %s to %s", d.ContainerName, newName))
+	if err := d.retry(
+		"renaming container "+d.ContainerName,
+		func() error {
+			return client.ContainerRename(d.getContext(), d.ContainerId, newName)
+		},
+	); err != nil {
+		return err
+	}
+	d.ContainerName = newName
+	return nil
+}
+
 func (d *DockerService) inspect() (types.ContainerJSON, error) {
 	client, err := d.getClient()
 	if err != nil {
 		return types.ContainerJSON{}, err
 	}
-	container, err := client.ContainerInspect(
-		context.Background(),
-		d.ContainerId,
+	var container types.ContainerJSON
+	err = d.retry(
+		"inspecting container "+d.ContainerName,
+		func() error {
+			var err error
+			container, err = client.ContainerInspect(
+				d.getContext(),
+				d.ContainerId,
+			)
+			return err
+		},
 	)
 	if err != nil {
 		return types.ContainerJSON{}, err
@@ -357,6 +885,8 @@ func (d *DockerService) refresh() error {
 			d.Env[envVarName] = envVarValue
 		}
 	}
+	d.StopSignal = container.Config.StopSignal
+	d.StopTimeout = container.Config.StopTimeout
 	d.Command = container.Config.Entrypoint[:]
 	d.Args = container.Config.Cmd[:]
 	var tmpBinds []string
@@ -394,9 +924,139 @@ func (d *DockerService) refresh() error {
 	return nil
 }
 
+// mismatches compares the container with the expected image, port mappings, and bind mounts, and
+// returns a description of each difference
+func (d *DockerService) mismatches(
+	image string,
+	ports []string,
+	binds []string,
+) ([]string, error) {
+	container, err := d.inspect()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	if container.Config.Image != image {
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"image is %q, expected %q",
+				container.Config.Image,
+				image,
+			),
+		)
+	}
+	// Compare port mappings
+	_, expectedPorts, err := nat.ParsePortSpecs(ports)
+	if err != nil {
+		return nil, err
+	}
+	actualPorts := container.HostConfig.PortBindings
+	portMappings := func(bindings []nat.PortBinding) string {
+		var tmpMappings []string
+		for _, binding := range bindings {
+			hostIp := binding.HostIP
+			if hostIp == "" {
+				hostIp = "0.0.0.0"
+			}
+			tmpMappings = append(
+				tmpMappings,
+				fmt.Sprintf("%s:%s", hostIp, binding.HostPort),
+			)
+		}
+		sort.Strings(tmpMappings)
+		return strings.Join(tmpMappings, ",")
+	}
+	for port, bindings := range expectedPorts {
+		actualBindings, ok := actualPorts[port]
+		if !ok {
+			ret = append(ret, fmt.Sprintf("port %s is not published", port))
+			continue
+		}
+		if portMappings(actualBindings) != portMappings(bindings) {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"port %s is published on %s, expected %s",
+					port,
+					portMappings(actualBindings),
+					portMappings(bindings),
+				),
+			)
+		}
+	}
+	for port := range actualPorts {
+		if _, ok := expectedPorts[port]; !ok {
+			ret = append(ret, fmt.Sprintf("unexpected published port %s", port))
+		}
+	}
+	// Compare bind mounts and volumes
+	expectedDests := make(map[string]bool)
+	for _, bind := range binds {
+		bindParts := strings.Split(bind, ":")
+		dest := bindParts[0]
+		source := ""
+		if len(bindParts) > 1 {
+			source, dest = bindParts[0], bindParts[1]
+		}
+		expectedDests[dest] = true
+		found := false
+		for _, mount := range container.Mounts {
+			if mount.Destination != dest {
+				continue
+			}
+			found = true
+			// Anonymous volumes can have any source
+			if source == "" {
+				break
+			}
+			actualSource := mount.Source
+			if mount.Type == "volume" {
+				actualSource = mount.Name
+			}
+			if actualSource != source {
+				ret = append(
+					ret,
+					fmt.Sprintf(
+						"mount %s uses %q, expected %q",
+						dest,
+						actualSource,
+						source,
+					),
+				)
+			}
+			break
+		}
+		if !found {
+			ret = append(ret, fmt.Sprintf("mount %s is missing", dest))
+		}
+	}
+	for _, mount := range container.Mounts {
+		if mount.Type == "bind" && !expectedDests[mount.Destination] {
+			ret = append(
+				ret,
+				fmt.Sprintf("unexpected bind mount %s", mount.Destination),
+			)
+		}
+	}
+	return ret, nil
+}
+
+// retry runs a Docker operation, retrying if it fails with a transient error
+func (d *DockerService) retry(desc string, op func() error) error {
+	return retryOperation(d.getContext(), d.logger, d.retryCfg, desc, op)
+}
+
+func (d *DockerService) getContext() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
 func (d *DockerService) getClient() (*client.Client, error) {
 	if d.client == nil {
-		tmpClient, err := NewDockerClient()
+		tmpClient, err := NewDockerClientForHost(d.host)
 		if err != nil {
 			return nil, err
 		}
@@ -406,12 +1066,37 @@ func (d *DockerService) getClient() (*client.Client, error) {
 }
 
 func NewDockerClient() (*client.Client, error) {
+	return NewDockerClientForHost("")
+}
+
+// NewDockerClientForHost returns a Docker client for the specified Docker host URL, in the same
+// format as the DOCKER_HOST env var. An ssh://[user@]host[:port] URL connects to the Docker
+// engine on a remote host using the system ssh client. If no host is specified, DOCKER_HOST or
+// the default local socket is used
+func NewDockerClientForHost(dockerHost string) (*client.Client, error) {
+	if dockerHost == "" {
+		dockerHost = os.Getenv("DOCKER_HOST")
+	}
+	if isSshDockerHost(dockerHost) {
+		tmpSshHost, err := parseSshHost(dockerHost)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewClientWithOpts(
+			client.WithVersionFromEnv(),
+			client.WithAPIVersionNegotiation(),
+			// The host is only used for the HTTP requests, since the dialer makes the connection
+			client.WithHost("http://docker.example.com"),
+			client.WithDialContext(tmpSshHost.dialDocker),
+		)
+	}
 	clientOpts := []client.Opt{
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
 	}
-	// Determine Docker socket path if env override isn't set
-	if _, ok := os.LookupEnv("DOCKER_HOST"); !ok {
+	if dockerHost != "" {
+		clientOpts = append(clientOpts, client.WithHost(dockerHost))
+	} else {
 		// Determine fallback path for socket on Docker Desktop for Mac
 		userHomeDir, err := os.UserHomeDir()
 		if err != nil {
@@ -448,20 +1133,605 @@ func NewDockerClient() (*client.Client, error) {
 	return tmpClient, nil
 }
 
+// parseDeviceMappings converts device specs in the Docker --device flag format
+// (host path, optional container path, optional cgroup permissions) into device mappings
+func parseDeviceMappings(devices []string) ([]container.DeviceMapping, error) {
+	var ret []container.DeviceMapping
+	for _, device := range devices {
+		deviceParts := strings.Split(device, ":")
+		tmpDevice := container.DeviceMapping{
+			PathOnHost:        deviceParts[0],
+			PathInContainer:   deviceParts[0],
+			CgroupPermissions: "rwm",
+		}
+		switch len(deviceParts) {
+		case 1:
+		case 2:
+			if isDevicePermissions(deviceParts[1]) {
+				tmpDevice.CgroupPermissions = deviceParts[1]
+			} else {
+				tmpDevice.PathInContainer = deviceParts[1]
+			}
+		case 3:
+			if !isDevicePermissions(deviceParts[2]) {
+				return nil, NewInvalidDeviceError(device)
+			}
+			tmpDevice.PathInContainer = deviceParts[1]
+			tmpDevice.CgroupPermissions = deviceParts[2]
+		default:
+			return nil, NewInvalidDeviceError(device)
+		}
+		if tmpDevice.PathOnHost == "" || tmpDevice.PathInContainer == "" {
+			return nil, NewInvalidDeviceError(device)
+		}
+		ret = append(ret, tmpDevice)
+	}
+	return ret, nil
+}
+
+func isDevicePermissions(val string) bool {
+	if val == "" {
+		return false
+	}
+	for _, c := range val {
+		if c != 'r' && c != 'w' && c != 'm' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGpuRequest converts a GPU spec in the Docker --gpus flag format ("all", a count, or
+// "device=<id>[,<id>...]") into device requests
+func parseGpuRequest(gpus string) ([]container.DeviceRequest, error) {
+	if gpus == "" {
+		return nil, nil
+	}
+	tmpRequest := container.DeviceRequest{
+		Capabilities: [][]string{{"gpu"}},
+	}
+	if gpus == "all" {
+		tmpRequest.Count = -1
+	} else if deviceIds, ok := strings.CutPrefix(gpus, "device="); ok {
+		for _, deviceId := range strings.Split(deviceIds, ",") {
+			if deviceId == "" {
+				return nil, NewInvalidGpusError(gpus)
+			}
+			tmpRequest.DeviceIDs = append(tmpRequest.DeviceIDs, deviceId)
+		}
+	} else {
+		count, err := strconv.Atoi(gpus)
+		if err != nil || count <= 0 {
+			return nil, NewInvalidGpusError(gpus)
+		}
+		tmpRequest.Count = count
+	}
+	return []container.DeviceRequest{tmpRequest}, nil
+}
+
+// empty returns whether no runtime options are set
+func (o DockerRuntimeOptions) empty() bool {
+	return len(o.ExtraHosts) == 0 &&
+		len(o.Dns) == 0 &&
+		len(o.Sysctls) == 0 &&
+		len(o.Ulimits) == 0 &&
+		len(o.CapAdd) == 0 &&
+		len(o.CapDrop) == 0 &&
+		o.ShmSize == "" &&
+		!o.ReadOnly &&
+		len(o.Tmpfs) == 0
+}
+
+// validate checks the runtime options without creating a host config
+func (o DockerRuntimeOptions) validate() error {
+	_, err := o.hostConfig()
+	return err
+}
+
+// hostConfig converts the runtime options into a Docker host config
+func (o DockerRuntimeOptions) hostConfig() (*container.HostConfig, error) {
+	ret := &container.HostConfig{
+		ExtraHosts:     o.ExtraHosts,
+		DNS:            o.Dns,
+		Sysctls:        o.Sysctls,
+		CapAdd:         o.CapAdd,
+		CapDrop:        o.CapDrop,
+		ReadonlyRootfs: o.ReadOnly,
+	}
+	for _, extraHost := range o.ExtraHosts {
+		hostname, ip, ok := strings.Cut(extraHost, ":")
+		if !ok || hostname == "" ||
+			(ip != dockerHostGateway && net.ParseIP(ip) == nil) {
+			return nil, NewInvalidExtraHostError(extraHost)
+		}
+	}
+	for _, dnsServer := range o.Dns {
+		if net.ParseIP(dnsServer) == nil {
+			return nil, NewInvalidDnsServerError(dnsServer)
+		}
+	}
+	for name := range o.Sysctls {
+		if name == "" || strings.ContainsAny(name, " \t=") {
+			return nil, NewInvalidSysctlError(name)
+		}
+	}
+	for _, capability := range append(append([]string{}, o.CapAdd...), o.CapDrop...) {
+		if capability == "" || strings.ContainsAny(capability, " \t") {
+			return nil, NewInvalidCapabilityError(capability)
+		}
+	}
+	for _, ulimit := range o.Ulimits {
+		tmpUlimit, err := units.ParseUlimit(ulimit)
+		if err != nil {
+			return nil, NewInvalidUlimitError(ulimit, err)
+		}
+		ret.Ulimits = append(ret.Ulimits, tmpUlimit)
+	}
+	if o.ShmSize != "" {
+		shmSize, err := units.RAMInBytes(o.ShmSize)
+		if err != nil || shmSize <= 0 {
+			return nil, NewInvalidShmSizeError(o.ShmSize)
+		}
+		ret.ShmSize = shmSize
+	}
+	for _, tmpfs := range o.Tmpfs {
+		containerPath, opts, _ := strings.Cut(tmpfs, ":")
+		if !strings.HasPrefix(containerPath, "/") {
+			return nil, NewInvalidTmpfsError(tmpfs)
+		}
+		if ret.Tmpfs == nil {
+			ret.Tmpfs = make(map[string]string)
+		}
+		ret.Tmpfs[containerPath] = opts
+	}
+	return ret, nil
+}
+
+// parsePlatform converts a platform in the os/arch[/variant] format (e.g. linux/arm64/v8). An
+// empty platform returns nil, which uses the native platform of the Docker host
+func parsePlatform(platform string) (*ocispec.Platform, error) {
+	if platform == "" {
+		return nil, nil
+	}
+	platformParts := strings.Split(platform, "/")
+	if len(platformParts) < 2 || len(platformParts) > 3 {
+		return nil, NewInvalidPlatformError(platform)
+	}
+	for _, platformPart := range platformParts {
+		if platformPart == "" {
+			return nil, NewInvalidPlatformError(platform)
+		}
+	}
+	ret := &ocispec.Platform{
+		OS:           platformParts[0],
+		Architecture: platformParts[1],
+	}
+	if len(platformParts) == 3 {
+		ret.Variant = platformParts[2]
+	}
+	return ret, nil
+}
+
+// checkImageAvailable checks that an image exists in its registry and provides a variant for the
+// platform, or the platform of the Docker host when none is specified, before anything is created
+// for a package. Other failures, such as the registry being unreachable, are logged and ignored,
+// since pulling the image will report them
+func checkImageAvailable(
+	ctx context.Context,
+	logger *slog.Logger,
+	dockerHost string,
+	imageName string,
+	platform string,
+) error {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return err
+	}
+	inspect, err := client.DistributionInspect(ctx, imageName, "")
+	if err != nil {
+		if errdefs.IsNotFound(err) || errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err) {
+			return NewImageNotFoundError(imageName, err)
+		}
+		logger.Debug(fmt.Sprintf("failed to check image %s in registry: %s", imageName, err))
+		return nil
+	}
+	targetPlatform, err := parsePlatform(platform)
+	if err != nil {
+		return err
+	}
+	if targetPlatform == nil {
+		version, err := client.ServerVersion(ctx)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("failed to get Docker server version: %s", err))
+			return nil
+		}
+		targetPlatform = &ocispec.Platform{
+			OS:           version.Os,
+			Architecture: version.Arch,
+		}
+	}
+	if !imageHasPlatform(inspect.Descriptor.MediaType, inspect.Platforms, *targetPlatform) {
+		return NewImagePlatformNotFoundError(
+			imageName,
+			platformString(*targetPlatform),
+			platformStrings(inspect.Platforms),
+		)
+	}
+	return nil
+}
+
+// imageHasPlatform returns whether an image with the given manifest media type and platforms
+// provides a variant for the target platform. Only multi-platform images are checked, since Docker
+// runs a single-platform image under emulation on other platforms. The variant is only compared
+// when the target platform specifies one
+func imageHasPlatform(
+	mediaType string,
+	platforms []ocispec.Platform,
+	target ocispec.Platform,
+) bool {
+	if mediaType != ocispec.MediaTypeImageIndex &&
+		mediaType != dockerManifestListMediaType {
+		return true
+	}
+	for _, platform := range platforms {
+		if platform.OS != target.OS || platform.Architecture != target.Architecture {
+			continue
+		}
+		if target.Variant != "" && platform.Variant != target.Variant {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func platformString(platform ocispec.Platform) string {
+	ret := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		ret += "/" + platform.Variant
+	}
+	return ret
+}
+
+// platformStrings returns the distinct platforms in OS/arch[/variant] format, skipping entries
+// such as attestation manifests that don't have a platform
+func platformStrings(platforms []ocispec.Platform) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, platform := range platforms {
+		if platform.OS == "" || platform.OS == "unknown" {
+			continue
+		}
+		tmpPlatform := platformString(platform)
+		if seen[tmpPlatform] {
+			continue
+		}
+		seen[tmpPlatform] = true
+		ret = append(ret, tmpPlatform)
+	}
+	return ret
+}
+
+// imageEmulationWarning returns a warning when the image architecture doesn't match the Docker
+// host architecture, or an empty string if it does or either is unknown
+func imageEmulationWarning(
+	imageName string,
+	imageArch string,
+	hostArch string,
+	platformSelected bool,
+	armMac bool,
+) string {
+	if imageArch == "" || hostArch == "" || imageArch == hostArch {
+		return ""
+	}
+	ret := fmt.Sprintf(
+		"image %s is built for %s and will run under emulation on the %s Docker host, which can be much slower",
+		imageName,
+		imageArch,
+		hostArch,
+	)
+	if !platformSelected {
+		ret += fmt.Sprintf(". The image does not provide a native %s variant", hostArch)
+	}
+	if armMac {
+		ret += ". On Apple Silicon, enabling Rosetta in the Docker Desktop settings improves performance"
+	}
+	return ret
+}
+
+// CheckDockerGpuSupport checks whether the Docker daemon has a GPU-capable runtime available
+func CheckDockerGpuSupport(ctx context.Context) error {
+	return checkDockerGpuSupport(ctx, "")
+}
+
+func checkDockerGpuSupport(ctx context.Context, dockerHost string) error {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return err
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := info.Runtimes["nvidia"]; ok {
+		return nil
+	}
+	if info.DefaultRuntime == "nvidia" {
+		return nil
+	}
+	return ErrDockerNoGpuSupport
+}
+
+// validateContainerUser checks a container user in the Docker --user flag format (user, uid,
+// user:group, or uid:gid), or containerUserImage
+func validateContainerUser(user string) error {
+	if user == "" || user == containerUserImage {
+		return nil
+	}
+	userParts := strings.Split(user, ":")
+	if len(userParts) > 2 {
+		return NewInvalidContainerUserError(user)
+	}
+	for _, userPart := range userParts {
+		if userPart == "" || strings.ContainsAny(userPart, " \t\n/") {
+			return NewInvalidContainerUserError(user)
+		}
+	}
+	return nil
+}
+
+// checkDockerUsernsRemap returns whether the Docker daemon has user namespace remapping enabled,
+// where container users are mapped to different users on the host
+func checkDockerUsernsRemap(ctx context.Context, dockerHost string) (bool, error) {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return false, err
+	}
+	info, err := client.Info(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, securityOption := range info.SecurityOptions {
+		if securityOption == "name=userns" || strings.HasPrefix(securityOption, "name=userns,") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func CheckDockerConnectivity() error {
-	if _, err := NewDockerClient(); err != nil {
+	return checkDockerConnectivity("")
+}
+
+func checkDockerConnectivity(dockerHost string) error {
+	if _, err := NewDockerClientForHost(dockerHost); err != nil {
+		if dockerHost != "" {
+			return fmt.Errorf(
+				"could not contact Docker daemon at %s: %s",
+				dockerHost,
+				err,
+			)
+		}
 		return errors.New(dockerInstallError)
 	}
 	return nil
 }
 
+// checkDockerAvailable returns an error if the Docker daemon for the specified Docker host can't
+// be reached within dockerPingTimeout
+func checkDockerAvailable(ctx context.Context, dockerHost string) error {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	pingCtx, cancel := context.WithTimeout(ctx, dockerPingTimeout)
+	defer cancel()
+	_, err = client.Ping(pingCtx)
+	return err
+}
+
+// DockerContainerEvents subscribes to Docker events with the specified actions for the specified
+// containers. A zero since or until time means no lower or upper bound, respectively. When an upper
+// bound is provided, the error channel receives io.EOF once all matching events have been sent
+func DockerContainerEvents(
+	ctx context.Context,
+	containerNames []string,
+	actions []string,
+	since time.Time,
+	until time.Time,
+) (<-chan events.Message, <-chan error, error) {
+	return dockerContainerEvents(ctx, "", containerNames, actions, since, until)
+}
+
+func dockerContainerEvents(
+	ctx context.Context,
+	dockerHost string,
+	containerNames []string,
+	actions []string,
+	since time.Time,
+	until time.Time,
+) (<-chan events.Message, <-chan error, error) {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return nil, nil, err
+	}
+	filterArgs := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+	)
+	for _, containerName := range containerNames {
+		filterArgs.Add("container", containerName)
+	}
+	for _, action := range actions {
+		filterArgs.Add("event", action)
+	}
+	opts := events.ListOptions{
+		Filters: filterArgs,
+	}
+	if !since.IsZero() {
+		opts.Since = strconv.FormatInt(since.Unix(), 10)
+	}
+	if !until.IsZero() {
+		opts.Until = strconv.FormatInt(until.Unix(), 10)
+	}
+	msgChan, errChan := client.Events(ctx, opts)
+	return msgChan, errChan, nil
+}
+
+// createDockerVolume creates a named volume with the specified labels, if it doesn't already exist
+func createDockerVolume(
+	ctx context.Context,
+	dockerHost string,
+	volumeName string,
+	labels map[string]string,
+) error {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return err
+	}
+	_, err = client.VolumeCreate(
+		ctx,
+		volume.CreateOptions{
+			Name:   volumeName,
+			Labels: labels,
+		},
+	)
+	return err
+}
+
+// removeDockerVolumes removes the named volumes with the specified label value
+func removeDockerVolumes(
+	ctx context.Context,
+	dockerHost string,
+	label string,
+	value string,
+) ([]string, error) {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.VolumeList(
+		ctx,
+		volume.ListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("label", label+"="+value),
+			),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, tmpVolume := range resp.Volumes {
+		if err := client.VolumeRemove(ctx, tmpVolume.Name, false); err != nil {
+			return ret, err
+		}
+		ret = append(ret, tmpVolume.Name)
+	}
+	return ret, nil
+}
+
+// dockerNetworkExists returns whether the named network exists
+func dockerNetworkExists(
+	ctx context.Context,
+	dockerHost string,
+	networkName string,
+) (bool, error) {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return false, err
+	}
+	if _, err := client.NetworkInspect(ctx, networkName, network.InspectOptions{}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// createDockerNetwork creates a network with the specified driver and subnet, which may be empty
+// to use the Docker defaults. It returns false if the network already exists
+func createDockerNetwork(
+	ctx context.Context,
+	dockerHost string,
+	networkName string,
+	driver string,
+	subnet string,
+) (bool, error) {
+	exists, err := dockerNetworkExists(ctx, dockerHost, networkName)
+	if err != nil || exists {
+		return false, err
+	}
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return false, err
+	}
+	createOpts := network.CreateOptions{
+		Driver: driver,
+	}
+	if subnet != "" {
+		createOpts.IPAM = &network.IPAM{
+			Config: []network.IPAMConfig{
+				{Subnet: subnet},
+			},
+		}
+	}
+	if _, err := client.NetworkCreate(ctx, networkName, createOpts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeDockerNetwork removes a network, unless it still has containers connected. It returns the
+// names of the connected containers when the network is kept. Networks that don't exist are ignored
+func removeDockerNetwork(
+	ctx context.Context,
+	dockerHost string,
+	networkName string,
+) ([]string, error) {
+	client, err := NewDockerClientForHost(dockerHost)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.NetworkInspect(ctx, networkName, network.InspectOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(resp.Containers) > 0 {
+		var ret []string
+		for _, endpoint := range resp.Containers {
+			ret = append(ret, endpoint.Name)
+		}
+		sort.Strings(ret)
+		return ret, nil
+	}
+	if err := client.NetworkRemove(ctx, resp.ID); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 func RemoveDockerImage(imageName string) error {
-	client, err := NewDockerClient()
+	return RemoveDockerImageContext(context.Background(), imageName)
+}
+
+// RemoveDockerImageContext is like RemoveDockerImage, but uses the provided context for
+// cancellation
+func RemoveDockerImageContext(ctx context.Context, imageName string) error {
+	return removeDockerImage(ctx, "", imageName)
+}
+
+func removeDockerImage(ctx context.Context, dockerHost string, imageName string) error {
+	client, err := NewDockerClientForHost(dockerHost)
 	if err != nil {
 		return err
 	}
 	_, err = client.ImageRemove(
-		context.Background(),
+		ctx,
 		imageName,
 		image.RemoveOptions{},
 	)
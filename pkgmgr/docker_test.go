@@ -0,0 +1,480 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParseDeviceMappings(t *testing.T) {
+	testDefs := []struct {
+		Device   string
+		Expected container.DeviceMapping
+		Error    bool
+	}{
+		{
+			Device: "/dev/foo",
+			Expected: container.DeviceMapping{
+				PathOnHost:        "/dev/foo",
+				PathInContainer:   "/dev/foo",
+				CgroupPermissions: "rwm",
+			},
+		},
+		{
+			Device: "/dev/foo:/dev/bar",
+			Expected: container.DeviceMapping{
+				PathOnHost:        "/dev/foo",
+				PathInContainer:   "/dev/bar",
+				CgroupPermissions: "rwm",
+			},
+		},
+		{
+			Device: "/dev/foo:r",
+			Expected: container.DeviceMapping{
+				PathOnHost:        "/dev/foo",
+				PathInContainer:   "/dev/foo",
+				CgroupPermissions: "r",
+			},
+		},
+		{
+			Device: "/dev/foo:/dev/bar:rw",
+			Expected: container.DeviceMapping{
+				PathOnHost:        "/dev/foo",
+				PathInContainer:   "/dev/bar",
+				CgroupPermissions: "rw",
+			},
+		},
+		{
+			Device: "/dev/foo:/dev/bar:xyz",
+			Error:  true,
+		},
+		{
+			Device: "/dev/foo:/dev/bar:rw:extra",
+			Error:  true,
+		},
+	}
+	for _, testDef := range testDefs {
+		devices, err := parseDeviceMappings([]string{testDef.Device})
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for device %q", testDef.Device)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(devices[0], testDef.Expected) {
+			t.Fatalf(
+				"did not get expected device mapping\n  got: %#v\n  expected: %#v",
+				devices[0],
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestParseGpuRequest(t *testing.T) {
+	testDefs := []struct {
+		Gpus     string
+		Expected container.DeviceRequest
+		Error    bool
+	}{
+		{
+			Gpus: "all",
+			Expected: container.DeviceRequest{
+				Count:        -1,
+				Capabilities: [][]string{{"gpu"}},
+			},
+		},
+		{
+			Gpus: "2",
+			Expected: container.DeviceRequest{
+				Count:        2,
+				Capabilities: [][]string{{"gpu"}},
+			},
+		},
+		{
+			Gpus: "device=0,2",
+			Expected: container.DeviceRequest{
+				DeviceIDs:    []string{"0", "2"},
+				Capabilities: [][]string{{"gpu"}},
+			},
+		},
+		{
+			Gpus:  "foo",
+			Error: true,
+		},
+		{
+			Gpus:  "0",
+			Error: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		requests, err := parseGpuRequest(testDef.Gpus)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for GPUs %q", testDef.Gpus)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(requests[0], testDef.Expected) {
+			t.Fatalf(
+				"did not get expected device request\n  got: %#v\n  expected: %#v",
+				requests[0],
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestDockerRuntimeOptionsHostConfig(t *testing.T) {
+	testDefs := []struct {
+		Options  DockerRuntimeOptions
+		Expected *container.HostConfig
+		Error    bool
+	}{
+		{
+			Options:  DockerRuntimeOptions{},
+			Expected: &container.HostConfig{},
+		},
+		{
+			Options: DockerRuntimeOptions{
+				ExtraHosts: []string{"relay:10.0.0.1", "host.docker.internal:host-gateway"},
+				Dns:        []string{"1.1.1.1", "2606:4700:4700::1111"},
+				Sysctls:    map[string]string{"net.core.somaxconn": "1024"},
+				Ulimits:    []string{"nofile=65536", "memlock=-1:-1"},
+				CapAdd:     []string{"SYS_NICE"},
+				CapDrop:    []string{"ALL"},
+				ShmSize:    "256m",
+				ReadOnly:   true,
+			},
+			Expected: &container.HostConfig{
+				ExtraHosts: []string{"relay:10.0.0.1", "host.docker.internal:host-gateway"},
+				DNS:        []string{"1.1.1.1", "2606:4700:4700::1111"},
+				Sysctls:    map[string]string{"net.core.somaxconn": "1024"},
+				CapAdd:     []string{"SYS_NICE"},
+				CapDrop:    []string{"ALL"},
+				Resources: container.Resources{
+					Ulimits: []*container.Ulimit{
+						{Name: "nofile", Soft: 65536, Hard: 65536},
+						{Name: "memlock", Soft: -1, Hard: -1},
+					},
+				},
+				ShmSize:        256 * 1024 * 1024,
+				ReadonlyRootfs: true,
+			},
+		},
+		{
+			Options: DockerRuntimeOptions{
+				Tmpfs: []string{"/tmp", "/scratch:size=64m,mode=1777"},
+			},
+			Expected: &container.HostConfig{
+				Tmpfs: map[string]string{
+					"/tmp":     "",
+					"/scratch": "size=64m,mode=1777",
+				},
+			},
+		},
+		{
+			Options: DockerRuntimeOptions{ExtraHosts: []string{"relay"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{ExtraHosts: []string{"relay:not-an-ip"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Dns: []string{"dns.example.com"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Sysctls: map[string]string{"": "1"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{CapAdd: []string{""}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Ulimits: []string{"nofile"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Ulimits: []string{"nofile=2048:1024"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Ulimits: []string{"foo=1"}},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{ShmSize: "lots"},
+			Error:   true,
+		},
+		{
+			Options: DockerRuntimeOptions{Tmpfs: []string{"tmp:size=64m"}},
+			Error:   true,
+		},
+	}
+	for _, testDef := range testDefs {
+		hostConfig, err := testDef.Options.hostConfig()
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for options %#v", testDef.Options)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(hostConfig, testDef.Expected) {
+			t.Fatalf(
+				"did not get expected host config\n  got: %#v\n  expected: %#v",
+				hostConfig,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	testDefs := []struct {
+		Platform string
+		Expected *ocispec.Platform
+		Error    bool
+	}{
+		{
+			Platform: "",
+		},
+		{
+			Platform: "linux/amd64",
+			Expected: &ocispec.Platform{
+				OS:           "linux",
+				Architecture: "amd64",
+			},
+		},
+		{
+			Platform: "linux/arm64/v8",
+			Expected: &ocispec.Platform{
+				OS:           "linux",
+				Architecture: "arm64",
+				Variant:      "v8",
+			},
+		},
+		{
+			Platform: "amd64",
+			Error:    true,
+		},
+		{
+			Platform: "linux/",
+			Error:    true,
+		},
+		{
+			Platform: "linux/arm/v7/foo",
+			Error:    true,
+		},
+	}
+	for _, testDef := range testDefs {
+		platform, err := parsePlatform(testDef.Platform)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for platform %q", testDef.Platform)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(platform, testDef.Expected) {
+			t.Fatalf(
+				"did not get expected platform\n  got: %#v\n  expected: %#v",
+				platform,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestImageEmulationWarning(t *testing.T) {
+	if warning := imageEmulationWarning("foo", "arm64", "arm64", false, true); warning != "" {
+		t.Fatalf("got unexpected warning for native image: %s", warning)
+	}
+	if warning := imageEmulationWarning("foo", "", "arm64", false, false); warning != "" {
+		t.Fatalf("got unexpected warning for unknown image architecture: %s", warning)
+	}
+	warning := imageEmulationWarning("foo", "amd64", "arm64", false, true)
+	if !strings.Contains(warning, "emulation") ||
+		!strings.Contains(warning, "native arm64 variant") ||
+		!strings.Contains(warning, "Rosetta") {
+		t.Fatalf("did not get expected warning: %s", warning)
+	}
+	warning = imageEmulationWarning("foo", "amd64", "arm64", true, false)
+	if strings.Contains(warning, "native arm64 variant") || strings.Contains(warning, "Rosetta") {
+		t.Fatalf("did not get expected warning: %s", warning)
+	}
+}
+
+func TestImageHasPlatform(t *testing.T) {
+	platforms := []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "unknown", Architecture: "unknown"},
+	}
+	testDefs := []struct {
+		mediaType string
+		target    ocispec.Platform
+		expected  bool
+	}{
+		{
+			mediaType: ocispec.MediaTypeImageIndex,
+			target:    ocispec.Platform{OS: "linux", Architecture: "amd64"},
+			expected:  true,
+		},
+		{
+			mediaType: "application/vnd.docker.distribution.manifest.list.v2+json",
+			target:    ocispec.Platform{OS: "linux", Architecture: "arm64"},
+			expected:  true,
+		},
+		{
+			mediaType: ocispec.MediaTypeImageIndex,
+			target:    ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"},
+		},
+		{
+			mediaType: ocispec.MediaTypeImageIndex,
+			target:    ocispec.Platform{OS: "linux", Architecture: "riscv64"},
+		},
+		{
+			// Single-platform images run under emulation
+			mediaType: ocispec.MediaTypeImageManifest,
+			target:    ocispec.Platform{OS: "linux", Architecture: "riscv64"},
+			expected:  true,
+		},
+	}
+	for _, testDef := range testDefs {
+		if got := imageHasPlatform(testDef.mediaType, platforms, testDef.target); got != testDef.expected {
+			t.Fatalf(
+				"did not get expected result for %s with %s: got %v, expected %v",
+				platformString(testDef.target),
+				testDef.mediaType,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+	expectedPlatforms := []string{"linux/amd64", "linux/arm64/v8"}
+	if got := platformStrings(platforms); !reflect.DeepEqual(got, expectedPlatforms) {
+		t.Fatalf("did not get expected platforms: got %v, expected %v", got, expectedPlatforms)
+	}
+}
+
+func TestValidateContainerUser(t *testing.T) {
+	testDefs := []struct {
+		User  string
+		Error bool
+	}{
+		{User: ""},
+		{User: "image"},
+		{User: "root"},
+		{User: "999"},
+		{User: "postgres:postgres"},
+		{User: "1000:1000"},
+		{User: "1000:", Error: true},
+		{User: ":1000", Error: true},
+		{User: "1000:1000:1000", Error: true},
+		{User: "some user", Error: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateContainerUser(testDef.User)
+		if testDef.Error && err == nil {
+			t.Fatalf("did not get expected error for user %q", testDef.User)
+		}
+		if !testDef.Error && err != nil {
+			t.Fatalf("unexpected error for user %q: %s", testDef.User, err)
+		}
+	}
+}
+
+func TestDockerServiceCreateContainerRetry(t *testing.T) {
+	svc := &DockerService{
+		ContainerName: "foo",
+		Image:         "example/foo:1.0.0",
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		retryCfg:      RetryConfig{Retries: 2, Backoff: time.Millisecond},
+	}
+	conflictErr := errdefs.Conflict(errors.New(`container name "/foo" is already in use`))
+	existing := func(image string) func() (types.ContainerJSON, error) {
+		return func() (types.ContainerJSON, error) {
+			return types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{ID: "abc123"},
+				Config:            &container.Config{Image: image},
+			}, nil
+		}
+	}
+	testDefs := []struct {
+		errs     []error
+		image    string
+		expected string
+		fail     bool
+	}{
+		// The container created by an attempt whose response was lost is used
+		{errs: []error{io.ErrUnexpectedEOF, conflictErr}, image: svc.Image, expected: "abc123"},
+		// A container with the same name that was already there isn't used
+		{errs: []error{conflictErr}, image: svc.Image, fail: true},
+		// A container with another image isn't used
+		{errs: []error{io.ErrUnexpectedEOF, conflictErr}, image: "example/bar", fail: true},
+	}
+	for _, testDef := range testDefs {
+		var attempts int
+		resp, err := svc.createContainer(
+			func() (container.CreateResponse, error) {
+				err := testDef.errs[attempts]
+				attempts++
+				return container.CreateResponse{}, err
+			},
+			existing(testDef.image),
+		)
+		if testDef.fail {
+			if !errdefs.IsConflict(err) {
+				t.Fatalf("did not get expected conflict error: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if resp.ID != testDef.expected {
+			t.Fatalf(
+				"did not get expected container ID: got %q, expected %q",
+				resp.ID,
+				testDef.expected,
+			)
+		}
+	}
+}
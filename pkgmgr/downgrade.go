@@ -0,0 +1,105 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+// DowngradePlan describes moving an installed package to an older version
+type DowngradePlan struct {
+	Installed InstalledPackage
+	Target    Package
+	// Dependencies are the dependencies of the older version that will be installed
+	Dependencies []Package
+}
+
+// DataIncompatible returns whether the data of the installed version uses a newer data schema
+// version than the older version supports. Packages that don't declare a data schema version are
+// assumed to be compatible
+func (d DowngradePlan) DataIncompatible() bool {
+	return d.Installed.Package.DataSchemaVersion > 0 && d.Target.DataSchemaVersion > 0 &&
+		d.Installed.Package.DataSchemaVersion > d.Target.DataSchemaVersion
+}
+
+// DowngradePlan returns what moving an installed package in the active context to an older
+// version will do
+func (p *PackageManager) DowngradePlan(pkgName string, version string) (DowngradePlan, error) {
+	activeContextName, _ := p.CurrentContext()
+	downgradePkgs, err := p.resolveDowngrade(activeContextName, pkgName, version)
+	if err != nil {
+		return DowngradePlan{}, err
+	}
+	return newDowngradePlan(downgradePkgs), nil
+}
+
+// Downgrade moves an installed package in the active context to an older available version. This
+// fails when the data of the installed version uses a newer data schema version than the older
+// version unless force is set
+func (p *PackageManager) Downgrade(pkgName string, version string, force bool) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	downgradePkgs, err := p.resolveDowngrade(activeContextName, pkgName, version)
+	if err != nil {
+		return err
+	}
+	plan := newDowngradePlan(downgradePkgs)
+	if plan.DataIncompatible() {
+		if !force {
+			return NewDowngradeDataIncompatibleError(
+				pkgName,
+				plan.Installed.Package.DataSchemaVersion,
+				plan.Target.DataSchemaVersion,
+			)
+		}
+		p.config.Logger.Warn(
+			"downgrading package with data from a newer data schema version, which the older version may not be able to read",
+		)
+	}
+	return p.upgradePackages(activeContextName, downgradePkgs, "downgraded/installed")
+}
+
+func (p *PackageManager) resolveDowngrade(
+	activeContextName string,
+	pkgName string,
+	version string,
+) ([]ResolverUpgradeSet, error) {
+	resolver, err := NewResolver(
+		p.InstalledPackages(),
+		p.availablePackagesWithLocal(),
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.Downgrade(pkgName, version)
+}
+
+// newDowngradePlan returns the plan for the resolved downgrade, where the downgraded package comes
+// after any dependencies
+func newDowngradePlan(downgradePkgs []ResolverUpgradeSet) DowngradePlan {
+	var ret DowngradePlan
+	for idx, downgradePkg := range downgradePkgs {
+		if idx == len(downgradePkgs)-1 {
+			ret.Installed = downgradePkg.Installed
+			ret.Target = downgradePkg.Upgrade
+			continue
+		}
+		ret.Dependencies = append(ret.Dependencies, downgradePkg.Upgrade)
+	}
+	return ret
+}
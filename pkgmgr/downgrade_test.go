@@ -0,0 +1,96 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDowngradePlanDataIncompatible(t *testing.T) {
+	testDefs := []struct {
+		InstalledSchema int
+		TargetSchema    int
+		Incompatible    bool
+	}{
+		{},
+		{InstalledSchema: 2, TargetSchema: 2},
+		{InstalledSchema: 1, TargetSchema: 2},
+		{InstalledSchema: 3, TargetSchema: 2, Incompatible: true},
+		// Packages without a data schema version are assumed to be compatible
+		{InstalledSchema: 3},
+		{TargetSchema: 2},
+	}
+	for _, testDef := range testDefs {
+		plan := DowngradePlan{
+			Installed: InstalledPackage{
+				Package: Package{DataSchemaVersion: testDef.InstalledSchema},
+			},
+			Target: Package{DataSchemaVersion: testDef.TargetSchema},
+		}
+		if ret := plan.DataIncompatible(); ret != testDef.Incompatible {
+			t.Fatalf(
+				"did not get expected result for data schema versions %d => %d: got %v",
+				testDef.InstalledSchema,
+				testDef.TargetSchema,
+				ret,
+			)
+		}
+	}
+}
+
+func TestDowngradeDataIncompatible(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.availablePackages = []Package{
+		{Name: "node", Version: "1.1.0", DataSchemaVersion: 1},
+		{Name: "node", Version: "1.2.0", DataSchemaVersion: 2},
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.2.0", DataSchemaVersion: 2},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plan, err := pm.DowngradePlan("node", "1.1.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if plan.Target.Version != "1.1.0" || len(plan.Dependencies) > 0 || !plan.DataIncompatible() {
+		t.Fatalf("did not get expected downgrade plan: %#v", plan)
+	}
+	err = pm.Downgrade("node", "1.1.0", false)
+	if err == nil || !strings.Contains(err.Error(), "data schema version") {
+		t.Fatalf("did not get expected data schema error: %v", err)
+	}
+}
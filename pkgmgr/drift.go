@@ -0,0 +1,492 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackageDrift is a difference between the recorded state of an installed package and the actual
+// state of its containers, files, and binary symlinks
+type PackageDrift struct {
+	Package     InstalledPackage
+	Description string
+	// Repaired is set when the drift was repaired
+	Repaired bool
+	// RepairError is the error from repairing the drift, if that failed
+	RepairError error
+	// repair reconciles the actual state with the recorded state, or is nil if the drift can't
+	// be repaired automatically
+	repair func() error
+}
+
+// Repairable returns whether the drift can be repaired automatically
+func (d PackageDrift) Repairable() bool {
+	return d.repair != nil
+}
+
+// Verify compares the installed packages in the active context, or in all contexts, with the
+// actual Docker and filesystem state, and returns each difference. With repair, containers are
+// recreated, files are rewritten, and binary symlinks are relinked to match the recorded state
+func (p *PackageManager) Verify(allContexts bool, repair bool) ([]PackageDrift, error) {
+	if repair {
+		unlock, err := p.lock()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	installedPkgs := p.InstalledPackages()
+	if allContexts {
+		installedPkgs = p.InstalledPackagesAllContexts()
+	}
+	var ret []PackageDrift
+	for _, installedPkg := range installedPkgs {
+		drifts, err := p.packageDrift(installedPkg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, drifts...)
+	}
+	if !repair {
+		return ret, nil
+	}
+	for idx, drift := range ret {
+		if drift.repair == nil {
+			continue
+		}
+		if err := drift.repair(); err != nil {
+			ret[idx].RepairError = err
+			continue
+		}
+		ret[idx].Repaired = true
+	}
+	return ret, nil
+}
+
+// installedPackageConfig returns a copy of the config for rendering the install steps of an
+// installed package, along with the full package name used for its containers and data dir
+func (p *PackageManager) installedPackageConfig(
+	installedPkg InstalledPackage,
+) (Config, string, error) {
+	cfg, err := p.installConfig(
+		installedPkg.Package,
+		installedPkg.Context,
+		installedPkg.Binds,
+		installedPkg.Env,
+	)
+	if err != nil {
+		return Config{}, "", err
+	}
+	cfg.Template = p.installedPackageTemplate(installedPkg).WithVars(
+		socketTemplateVars(cfg.sockets),
+	)
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		installedPkg.InstanceName(),
+		installedPkg.Package.Version,
+		installedPkg.Context,
+	)
+	containerBindOverrides, err := installedPkg.Package.resolveBindOverrides(
+		cfg,
+		pkgName,
+		installedPkg.Binds,
+	)
+	if err != nil {
+		return Config{}, "", err
+	}
+	cfg.containerBindOverrides = containerBindOverrides
+	return cfg, pkgName, nil
+}
+
+// installedPackagePath returns the path to the manifest for an installed package, which is needed
+// for file install steps with a source file, or an empty string if it's no longer available
+func (p *PackageManager) installedPackagePath(installedPkg InstalledPackage) string {
+	for _, pkg := range p.availablePackagesWithLocal() {
+		if pkg.Name == installedPkg.Package.Name &&
+			pkg.Version == installedPkg.Package.Version {
+			return pkg.filePath
+		}
+	}
+	return ""
+}
+
+func (p *PackageManager) packageDrift(installedPkg InstalledPackage) ([]PackageDrift, error) {
+	cfg, pkgName, err := p.installedPackageConfig(installedPkg)
+	if err != nil {
+		return nil, err
+	}
+	activeContextName, _ := p.ActiveContext()
+	// Binaries are only linked for the primary instance of a package, into the bin dir for its
+	// context and also into BinDir for the active context
+	var binDirs []string
+	if installedPkg.Instance == "" {
+		if installedPkg.Context == activeContextName {
+			binDirs = append(binDirs, cfg.BinDir)
+		}
+		binDirs = append(binDirs, contextBinDir(cfg, installedPkg.Context))
+	}
+	var packagePath string
+	var ret []PackageDrift
+	addDrift := func(description string, repair func() error) {
+		ret = append(
+			ret,
+			PackageDrift{
+				Package:     installedPkg,
+				Description: description,
+				repair:      repair,
+			},
+		)
+	}
+	for stepIdx, installStep := range installedPkg.Package.InstallSteps {
+		if installStep.Condition != "" {
+			ok, err := cfg.Template.EvaluateCondition(installStep.Condition, nil)
+			if err != nil {
+				return nil, NewInstallStepConditionError(installStep.Condition, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		stepField := fmt.Sprintf("installSteps[%d]", stepIdx)
+		var dockerSteps []*PackageInstallStepDocker
+		dockerStepFields := make(map[*PackageInstallStepDocker]string)
+		if installStep.Docker != nil {
+			dockerSteps = append(dockerSteps, installStep.Docker)
+			dockerStepFields[installStep.Docker] = stepField + ".docker"
+		}
+		if installStep.Compose != nil {
+			// The network is checked first, so that it's repaired before the containers
+			description, repair, err := installStep.Compose.networkDrift(cfg, pkgName)
+			if err != nil {
+				return nil, err
+			}
+			if description != "" {
+				addDrift(description, repair)
+			}
+			composeSteps, err := installStep.Compose.dockerSteps(cfg, pkgName)
+			if err != nil {
+				return nil, err
+			}
+			for _, composeStep := range composeSteps {
+				dockerStepFields[composeStep] = fmt.Sprintf(
+					"%s.compose.services.%s",
+					stepField,
+					composeStep.ContainerName,
+				)
+			}
+			dockerSteps = append(dockerSteps, composeSteps...)
+		}
+		for _, dockerStep := range dockerSteps {
+			if dockerStep.PullOnly {
+				continue
+			}
+			description, repair, err := dockerStep.drift(
+				cfg,
+				pkgName,
+				dockerStepFields[dockerStep],
+				containerLogsDir(cfg, installedPkg.Context, installedPkg.InstanceName()),
+			)
+			if err != nil {
+				return nil, err
+			}
+			if description != "" {
+				addDrift(description, repair)
+			}
+		}
+		if installStep.Network != nil {
+			description, repair, err := installStep.Network.drift(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if description != "" {
+				addDrift(description, repair)
+			}
+		}
+		if installStep.File != nil {
+			// Look up the package manifest only when needed, since it may load the registry
+			if (installStep.File.Source != "" || installStep.File.SourceDir != "") &&
+				packagePath == "" {
+				packagePath = p.installedPackagePath(installedPkg)
+			}
+			items, err := installStep.File.items(cfg.Template)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				itemCfg := cfg
+				itemCfg.Template = item.tmpl
+				driftFunc := item.step.drift
+				if item.step.isDir() {
+					driftFunc = item.step.dirDrift
+				}
+				description, repair, err := driftFunc(itemCfg, pkgName, packagePath)
+				if err != nil {
+					return nil, err
+				}
+				if description != "" {
+					addDrift(description, repair)
+				}
+				if !item.step.Binary {
+					continue
+				}
+				for _, binDir := range binDirs {
+					binCfg := itemCfg
+					binCfg.BinDir = binDir
+					description, repair, err := item.step.binaryDrift(binCfg, pkgName)
+					if err != nil {
+						return nil, err
+					}
+					if description != "" {
+						addDrift(description, repair)
+					}
+				}
+			}
+		}
+	}
+	return ret, nil
+}
+
+// drift compares the container for the install step with the rendered install step. Containers
+// that are missing or don't match are repaired by recreating them
+func (p *PackageInstallStepDocker) drift(
+	cfg Config,
+	pkgName string,
+	field string,
+	logsDir string,
+) (string, func() error, error) {
+	svc, err := p.render(cfg, pkgName)
+	if err != nil {
+		return "", nil, err
+	}
+	existing, err := newDockerService(cfg, svc.ContainerName)
+	if err != nil {
+		if err == ErrContainerNotExists {
+			repair := func() error {
+				return p.install(cfg, pkgName, field)
+			}
+			return fmt.Sprintf("container %s is missing", svc.ContainerName), repair, nil
+		}
+		return "", nil, err
+	}
+	mismatches, err := p.mismatches(cfg, pkgName, existing, svc)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(mismatches) > 0 {
+		repair := func() error {
+			return p.replaceContainer(cfg, pkgName, field, logsDir, existing)
+		}
+		description := fmt.Sprintf(
+			"container %s does not match the package: %s",
+			svc.ContainerName,
+			strings.Join(mismatches, "; "),
+		)
+		return description, repair, nil
+	}
+	return "", nil, nil
+}
+
+// replaceContainer stops and removes the existing container for the install step, keeping its logs
+// when a logs dir is provided, and creates it again from the install step
+func (p *PackageInstallStepDocker) replaceContainer(
+	cfg Config,
+	pkgName string,
+	field string,
+	logsDir string,
+	existing *DockerService,
+) error {
+	applyStopTimeoutDefault(cfg, existing)
+	if running, _ := existing.Running(); running {
+		if err := existing.Stop(); err != nil {
+			return err
+		}
+	}
+	if logsDir != "" {
+		p.persistLogs(cfg, existing, logsDir)
+	}
+	if err := existing.Remove(); err != nil {
+		return err
+	}
+	return p.install(cfg, pkgName, field)
+}
+
+// recreate creates the container for the install step again, such as to apply changed env
+// overrides. A missing container is created, and a container that was stopped is stopped again
+// once it's recreated
+func (p *PackageInstallStepDocker) recreate(
+	cfg Config,
+	pkgName string,
+	field string,
+	logsDir string,
+) error {
+	containerName := fmt.Sprintf("%s-%s", pkgName, p.ContainerName)
+	existing, err := newDockerService(cfg, containerName)
+	if err != nil {
+		if err == ErrContainerNotExists {
+			return p.install(cfg, pkgName, field)
+		}
+		return err
+	}
+	running, err := existing.Running()
+	if err != nil {
+		return err
+	}
+	if err := p.replaceContainer(cfg, pkgName, field, logsDir, existing); err != nil {
+		return err
+	}
+	if running {
+		return nil
+	}
+	svc, err := newDockerService(cfg, containerName)
+	if err != nil {
+		return err
+	}
+	applyStopTimeoutDefault(cfg, svc)
+	return svc.Stop()
+}
+
+// drift checks that the network for the install step exists. Missing networks are repaired by
+// recreating them
+func (p *PackageInstallStepNetwork) drift(cfg Config) (string, func() error, error) {
+	networkName := dockerNetworkName(cfg.contextName, p.Name)
+	exists, err := dockerNetworkExists(cfg.ctx(), cfg.DockerHost, networkName)
+	if err != nil {
+		return "", nil, err
+	}
+	if !exists {
+		repair := func() error {
+			return p.install(cfg)
+		}
+		return fmt.Sprintf("network %s is missing", networkName), repair, nil
+	}
+	return "", nil, nil
+}
+
+// networkDrift checks that the network for the Compose services exists. A missing network is
+// repaired by recreating it
+func (p *PackageInstallStepCompose) networkDrift(
+	cfg Config,
+	pkgName string,
+) (string, func() error, error) {
+	networkName := composeNetworkName(pkgName)
+	exists, err := dockerNetworkExists(cfg.ctx(), cfg.DockerHost, networkName)
+	if err != nil {
+		return "", nil, err
+	}
+	if !exists {
+		repair := func() error {
+			_, err := createDockerNetwork(cfg.ctx(), cfg.DockerHost, networkName, "", "")
+			return err
+		}
+		return fmt.Sprintf("network %s is missing", networkName), repair, nil
+	}
+	return "", nil, nil
+}
+
+// drift compares the file for the install step with the rendered content. The content of files
+// with a source file can only be checked when the package manifest is available
+func (p *PackageInstallStepFile) drift(
+	cfg Config,
+	pkgName string,
+	packagePath string,
+) (string, func() error, error) {
+	filename, err := cfg.Template.Render(p.Filename, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	filePath := filepath.Join(cfg.packageDataDir(pkgName), filename)
+	var repair func() error
+	var expectedContent string
+	contentKnown := p.Source == "" || packagePath != ""
+	if contentKnown {
+		expectedContent = p.Content
+		if p.Source != "" {
+			sourcePath, err := fileStepSourcePath(cfg, packagePath, p.Source)
+			if err != nil {
+				return "", nil, err
+			}
+			sourceContent, err := os.ReadFile(sourcePath)
+			if err != nil {
+				return "", nil, err
+			}
+			expectedContent = string(sourceContent)
+		}
+		expectedContent, err = cfg.Template.Render(expectedContent, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		repair = func() error {
+			return p.install(cfg, pkgName, packagePath)
+		}
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("file %s is missing", filePath), repair, nil
+		}
+		return "", nil, err
+	}
+	if contentKnown && string(content) != expectedContent {
+		return fmt.Sprintf("file %s has been modified", filePath), repair, nil
+	}
+	return "", nil, nil
+}
+
+// binaryDrift checks the symlink for a binary file install step. Missing or changed symlinks are
+// repaired by relinking them, but other files at the symlink path are left alone
+func (p *PackageInstallStepFile) binaryDrift(
+	cfg Config,
+	pkgName string,
+) (string, func() error, error) {
+	filename, err := cfg.Template.Render(p.Filename, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	binPath := filepath.Join(cfg.BinDir, filename)
+	expectedTarget := filepath.Join(cfg.packageDataDir(pkgName), filename)
+	repair := func() error {
+		return p.activate(cfg, pkgName)
+	}
+	stat, err := os.Lstat(binPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("binary symlink %s is missing", binPath), repair, nil
+		}
+		return "", nil, err
+	}
+	if (stat.Mode() & fs.ModeSymlink) == 0 {
+		return fmt.Sprintf("binary %s is not a symlink", binPath), nil, nil
+	}
+	target, err := os.Readlink(binPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if target != expectedTarget {
+		description := fmt.Sprintf(
+			"binary symlink %s points to %s, expected %s",
+			binPath,
+			target,
+			expectedTarget,
+		)
+		return description, repair, nil
+	}
+	return "", nil, nil
+}
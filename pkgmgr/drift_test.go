@@ -0,0 +1,133 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		BinDir:    filepath.Join(tmpDir, "bin"),
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "tool",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						File: &PackageInstallStepFile{
+							Filename: "config.json",
+							Content:  `{"name": "{{ .Package.ShortName }}"}`,
+						},
+					},
+					{
+						File: &PackageInstallStepFile{
+							Filename: "tool",
+							Content:  "#!/bin/sh",
+							Binary:   true,
+						},
+					},
+				},
+			},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+	}
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkgDataDir := filepath.Join(cfg.DataDir, "tool-1.0.0-default")
+	configPath := filepath.Join(pkgDataDir, "config.json")
+	binPath := filepath.Join(cfg.BinDir, "tool")
+	contextBinPath := filepath.Join(cfg.DataDir, "default", "bin", "tool")
+	// Nothing has been installed yet
+	drifts, err := pm.Verify(false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedDrifts := []string{
+		"file " + configPath + " is missing",
+		"file " + filepath.Join(pkgDataDir, "tool") + " is missing",
+		"binary symlink " + binPath + " is missing",
+		"binary symlink " + contextBinPath + " is missing",
+	}
+	if len(drifts) != len(expectedDrifts) {
+		t.Fatalf("did not get expected drifts: %#v", drifts)
+	}
+	for idx, drift := range drifts {
+		if drift.Description != expectedDrifts[idx] || !drift.Repairable() {
+			t.Fatalf(
+				"did not get expected drift: got %q, expected %q",
+				drift.Description,
+				expectedDrifts[idx],
+			)
+		}
+	}
+	// Repair everything
+	drifts, err = pm.Verify(false, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, drift := range drifts {
+		if !drift.Repaired {
+			t.Fatalf("drift was not repaired: %s: %v", drift.Description, drift.RepairError)
+		}
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != `{"name": "tool"}` {
+		t.Fatalf("did not get expected file content: %s", content)
+	}
+	if drifts, err := pm.Verify(false, false); err != nil || len(drifts) != 0 {
+		t.Fatalf("got unexpected drifts after repair: %#v (err: %v)", drifts, err)
+	}
+	// Edit the file and replace the symlink with a regular file
+	if err := os.WriteFile(configPath, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Remove(binPath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	drifts, err = pm.Verify(false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(drifts) != 2 ||
+		drifts[0].Description != "file "+configPath+" has been modified" ||
+		drifts[1].Description != "binary "+binPath+" is not a symlink" ||
+		drifts[1].Repairable() {
+		t.Fatalf("did not get expected drifts: %#v", drifts)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	contextEnvFilename = "context.env"
+	activeEnvFilename  = "active.env"
+	envFileSuffix      = ".env"
+	contextBinDirname  = "bin"
+)
+
+// activeEnvFilePath returns the path to the env file that always reflects the active context
+func activeEnvFilePath(cfg Config) string {
+	return filepath.Join(
+		cfg.DataDir,
+		activeEnvFilename,
+	)
+}
+
+// contextEnvFilePath returns the path to the combined env file for the given context
+func contextEnvFilePath(cfg Config, context string) string {
+	return filepath.Join(
+		cfg.DataDir,
+		context,
+		contextEnvFilename,
+	)
+}
+
+// contextBinDir returns the dir with the binaries for the packages in the given context, which is
+// added to PATH by context env
+func contextBinDir(cfg Config, context string) string {
+	return filepath.Join(
+		cfg.DataDir,
+		context,
+		contextBinDirname,
+	)
+}
+
+// packageEnvFilePath returns the path to the env file for the given package in the given context
+func packageEnvFilePath(cfg Config, context string, pkgName string) string {
+	return filepath.Join(
+		cfg.DataDir,
+		context,
+		pkgName+envFileSuffix,
+	)
+}
+
+// formatEnvFile generates env file content from the provided env vars with the keys in sorted order
+func formatEnvFile(env map[string]string) string {
+	var tmpKeys []string
+	for k := range env {
+		tmpKeys = append(tmpKeys, k)
+	}
+	sort.Strings(tmpKeys)
+	var sb strings.Builder
+	for _, key := range tmpKeys {
+		sb.WriteString(
+			fmt.Sprintf(
+				"%s=%s\n",
+				key,
+				env[key],
+			),
+		)
+	}
+	return sb.String()
+}
+
+func writeEnvFile(path string, env map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), fs.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(formatEnvFile(env)), 0o644)
+}
+
+func removeEnvFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
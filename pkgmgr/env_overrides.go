@@ -0,0 +1,153 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envNameRegexp matches the env var names accepted for env overrides
+var envNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateEnvOverride checks that an env override uses the KEY=VALUE format with a valid name
+func validateEnvOverride(env string) error {
+	name, _, ok := strings.Cut(env, "=")
+	if !ok || !envNameRegexp.MatchString(name) {
+		return NewInvalidEnvOverrideError(env)
+	}
+	return nil
+}
+
+// envOverridesMap returns the env overrides in KEY=VALUE format as a map, where later overrides
+// for the same name win
+func envOverridesMap(envOverrides []string) map[string]string {
+	ret := make(map[string]string, len(envOverrides))
+	for _, env := range envOverrides {
+		name, val, _ := strings.Cut(env, "=")
+		ret[name] = val
+	}
+	return ret
+}
+
+// mergeEnvOverrides returns the env overrides with the names in unset removed and the overrides
+// in set added or replaced, sorted by name
+func mergeEnvOverrides(envOverrides []string, set []string, unset []string) []string {
+	tmpEnv := envOverridesMap(envOverrides)
+	for _, name := range unset {
+		delete(tmpEnv, name)
+	}
+	for name, val := range envOverridesMap(set) {
+		tmpEnv[name] = val
+	}
+	ret := make([]string, 0, len(tmpEnv))
+	for name, val := range tmpEnv {
+		ret = append(ret, name+"="+val)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SetPackageEnv sets and unsets env var overrides for the containers of an installed package in the
+// active context, and recreates the containers to apply them. Env overrides are in KEY=VALUE
+// format, and are kept on upgrade. Containers that were stopped are left stopped
+func (p *PackageManager) SetPackageEnv(pkgName string, set []string, unset []string) error {
+	for _, env := range set {
+		if err := validateEnvOverride(env); err != nil {
+			return err
+		}
+	}
+	for _, name := range unset {
+		if !envNameRegexp.MatchString(name) {
+			return NewInvalidEnvOverrideError(name)
+		}
+	}
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	for idx, installedPkg := range p.state.InstalledPackages {
+		if installedPkg.Context != activeContextName || installedPkg.InstanceName() != pkgName {
+			continue
+		}
+		installedPkg.Env = mergeEnvOverrides(installedPkg.Env, set, unset)
+		p.state.InstalledPackages[idx] = installedPkg
+		if err := p.state.Save(); err != nil {
+			return err
+		}
+		return p.recreatePackageContainers(installedPkg)
+	}
+	return NewPackageNotInstalledError(pkgName, activeContextName)
+}
+
+// recreatePackageContainers recreates the containers for an installed package from its install
+// steps, such as to apply changed env overrides. Containers that were stopped are left stopped
+func (p *PackageManager) recreatePackageContainers(installedPkg InstalledPackage) error {
+	cfg, pkgName, err := p.installedPackageConfig(installedPkg)
+	if err != nil {
+		return err
+	}
+	logsDir := containerLogsDir(cfg, installedPkg.Context, installedPkg.InstanceName())
+	for stepIdx, installStep := range installedPkg.Package.InstallSteps {
+		if installStep.Condition != "" {
+			ok, err := cfg.Template.EvaluateCondition(installStep.Condition, nil)
+			if err != nil {
+				return NewInstallStepConditionError(installStep.Condition, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		stepField := fmt.Sprintf("installSteps[%d]", stepIdx)
+		var dockerSteps []*PackageInstallStepDocker
+		dockerStepFields := make(map[*PackageInstallStepDocker]string)
+		if installStep.Docker != nil {
+			dockerSteps = append(dockerSteps, installStep.Docker)
+			dockerStepFields[installStep.Docker] = stepField + ".docker"
+		}
+		if installStep.Compose != nil {
+			composeSteps, err := installStep.Compose.dockerSteps(cfg, pkgName)
+			if err != nil {
+				return err
+			}
+			for _, composeStep := range composeSteps {
+				dockerStepFields[composeStep] = fmt.Sprintf(
+					"%s.compose.services.%s",
+					stepField,
+					composeStep.ContainerName,
+				)
+			}
+			dockerSteps = append(dockerSteps, composeSteps...)
+		}
+		for _, dockerStep := range dockerSteps {
+			if dockerStep.PullOnly {
+				continue
+			}
+			if err := dockerStep.recreate(
+				cfg,
+				pkgName,
+				dockerStepFields[dockerStep],
+				logsDir,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateEnvOverride(t *testing.T) {
+	testDefs := []struct {
+		env     string
+		invalid bool
+	}{
+		{env: "FOO=bar"},
+		{env: "FOO_BAR=bar=baz"},
+		{env: "_FOO="},
+		{env: "FOO", invalid: true},
+		{env: "=bar", invalid: true},
+		{env: "1FOO=bar", invalid: true},
+		{env: "FOO-BAR=baz", invalid: true},
+	}
+	for _, testDef := range testDefs {
+		err := validateEnvOverride(testDef.env)
+		if testDef.invalid && err == nil {
+			t.Fatalf("did not get expected error for env override %q", testDef.env)
+		}
+		if !testDef.invalid && err != nil {
+			t.Fatalf("unexpected error for env override %q: %s", testDef.env, err)
+		}
+	}
+}
+
+func TestMergeEnvOverrides(t *testing.T) {
+	res := mergeEnvOverrides(
+		[]string{"FOO=1", "BAR=2", "BAZ=3"},
+		[]string{"QUX=4", "FOO=5"},
+		[]string{"BAR"},
+	)
+	expected := []string{"BAZ=3", "FOO=5", "QUX=4"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("did not get expected env overrides: got %v, expected %v", res, expected)
+	}
+}
+
+func TestPackageInstallStepDockerRenderEnvOverrides(t *testing.T) {
+	cfg := Config{
+		Template:     NewTemplate(nil),
+		envOverrides: []string{"LOG_LEVEL=debug", "EXTRA=1"},
+	}
+	step := PackageInstallStepDocker{
+		ContainerName: "bar",
+		Image:         "example/foo:1.2.3",
+		Env:           map[string]string{"LOG_LEVEL": "info", "NETWORK": "preview"},
+	}
+	svc, err := step.render(cfg, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]string{"LOG_LEVEL": "debug", "NETWORK": "preview", "EXTRA": "1"}
+	if !reflect.DeepEqual(svc.Env, expected) {
+		t.Fatalf("did not get expected env: got %v, expected %v", svc.Env, expected)
+	}
+}
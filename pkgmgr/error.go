@@ -17,6 +17,8 @@ package pkgmgr
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // ErrOperationFailed is a placeholder error for operations that directly log errors.
@@ -47,6 +49,26 @@ var ErrContextNoChangeNetwork = errors.New(
 	"cannot change the configured network for a context",
 )
 
+// ErrContextNoChangeDockerHost is returned when changing the Docker host for a context with packages installed
+var ErrContextNoChangeDockerHost = errors.New(
+	"cannot change the Docker host for a context with packages installed",
+)
+
+// ErrContextNoChangeDataRoot is returned when changing the data root for a context with packages installed
+var ErrContextNoChangeDataRoot = errors.New(
+	"cannot change the data root for a context with packages installed",
+)
+
+// ErrDataRootSshHost is returned when a data root is set for a context with an SSH Docker host
+var ErrDataRootSshHost = errors.New(
+	"a data root cannot be used with an ssh:// Docker host, use a remote data dir instead",
+)
+
+// ErrRemoteDataDirNoSshHost is returned when a remote data dir is set for a context without an SSH Docker host
+var ErrRemoteDataDirNoSshHost = errors.New(
+	"a remote data dir can only be used with an ssh:// Docker host",
+)
+
 // ErrContextInstallNoNetwork is returned when performing an install with no network specified on the active context
 var ErrContextInstallNoNetwork = errors.New("no network specified for context")
 
@@ -56,22 +78,199 @@ var ErrContextNoDeleteActive = errors.New("cannot delete active context")
 // ErrContainerAlreadyExists is returned when creating a new container with a name that is already in use
 var ErrContainerAlreadyExists = errors.New("specified container already exists")
 
+func NewContainerMismatchError(containerName string, mismatches []string) error {
+	return fmt.Errorf(
+		"existing container %s does not match the package and cannot be adopted: %s",
+		containerName,
+		strings.Join(mismatches, "; "),
+	)
+}
+
+func NewSocketNotFoundError(socketName string, pkgName string) error {
+	return fmt.Errorf(
+		"socket %s used by package %s is not declared by the package or an installed package",
+		socketName,
+		pkgName,
+	)
+}
+
 // ErrContainerNotExists is returned when querying a container by name that doesn't exist
 var ErrContainerNotExists = errors.New("specified container does not exist")
 
 // ErrNoRegistryConfigured is returned when no registry is configured
 var ErrNoRegistryConfigured = errors.New("no package registry is configured")
 
+// ErrOffline is returned when network access is needed while offline mode is enabled
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+// ErrRegistryNotCached is returned when loading the package registry from its URL in offline mode
+// before it has been fetched
+var ErrRegistryNotCached = errors.New(
+	"the package registry has not been fetched yet and can't be fetched in offline mode",
+)
+
+// ErrDockerNoGpuSupport is returned when a package requests GPUs and the Docker daemon has no GPU-capable runtime
+var ErrDockerNoGpuSupport = errors.New(
+	"GPUs were requested but the Docker daemon does not have a GPU-capable runtime (such as the NVIDIA Container Toolkit) configured",
+)
+
+// ErrPackageSpecVersionUnsupported is returned when loading a package that requires a newer version of cardano-up
+var ErrPackageSpecVersionUnsupported = errors.New(
+	"unsupported package spec version",
+)
+
+// ErrPackageTestsFailed is returned when the tests for packages that were installed or upgraded fail. The packages
+// are left installed
+var ErrPackageTestsFailed = errors.New(
+	"packages were installed, but tests failed",
+)
+
+// ErrNoBlockProducerPackages is returned when managing SPO keys and no installed packages in the active context declare a block producer
+var ErrNoBlockProducerPackages = errors.New(
+	"no installed packages in the active context declare a block producer",
+)
+
+// ErrSPORemoteDockerHost is returned when managing SPO keys in a context with a remote Docker host
+var ErrSPORemoteDockerHost = errors.New(
+	"SPO keys can only be managed in contexts using the local Docker host",
+)
+
+// ErrNodeTipUnknown is returned when the node doesn't report the slot for its tip, such as before it has synced
+var ErrNodeTipUnknown = errors.New(
+	"the node did not report the current slot, please wait for it to sync or provide the KES period",
+)
+
+// ErrNoWalletPackages is returned when managing wallets and no installed packages in the active context declare a wallet
+var ErrNoWalletPackages = errors.New(
+	"no installed packages in the active context declare a wallet",
+)
+
+// ErrNoDatabasePackages is returned when managing databases and no installed packages in the active context declare a database
+var ErrNoDatabasePackages = errors.New(
+	"no installed packages in the active context declare a database",
+)
+
+// ErrNodeTipNotSynced is returned when the node doesn't report the block and slot for its tip, such as before it has synced
+var ErrNodeTipNotSynced = errors.New(
+	"the node did not report its tip, please wait for it to sync",
+)
+
+// ErrTelemetryDisabled is returned when submitting usage stats and telemetry isn't enabled
+var ErrTelemetryDisabled = errors.New(
+	"telemetry is not enabled, enable it with 'cardano-up telemetry on'",
+)
+
+// ErrTelemetryNoUrl is returned when submitting usage stats and no telemetry URL is configured
+var ErrTelemetryNoUrl = errors.New(
+	"no telemetry URL is configured, usage stats are only kept locally",
+)
+
+// ErrNodePortUnknown is returned when the P2P port of the node can't be determined from the ports published by its container
+var ErrNodePortUnknown = errors.New(
+	"unable to determine the P2P port of the node, please specify it",
+)
+
+// ErrNoTopologyPackages is returned when managing the topology and no installed packages in the active context declare a topology file
+var ErrNoTopologyPackages = errors.New(
+	"no installed packages in the active context declare a topology file",
+)
+
+// ErrSecretsDecryptFailed is returned when the stored secrets can't be decrypted with the secrets key
+var ErrSecretsDecryptFailed = errors.New(
+	"failed to decrypt stored secrets, the secrets key may not match",
+)
+
+// ErrNoManagedContainers is returned when there are no containers for installed packages
+var ErrNoManagedContainers = errors.New(
+	"no containers found for installed packages",
+)
+
+// ErrOperationInProgress is returned when another cardano-up process holds the operation lock
+var ErrOperationInProgress = errors.New(
+	"another cardano-up operation is in progress, try again later or use --wait",
+)
+
 // ErrValidationFailed is returned when loading the package registry while doing package validation when a package failed to load
 var ErrValidationFailed = errors.New("validation failed")
 
+// ErrServiceDependencyCycle is returned when the installed packages depend on each other, so there's
+// no order to start or stop them in
+var ErrServiceDependencyCycle = errors.New(
+	"installed packages have a dependency cycle",
+)
+
 func NewUnknownNetworkError(networkName string) error {
 	return fmt.Errorf(
-		"unknown network %q",
+		"unknown network %q, a network magic must be provided for custom networks",
+		networkName,
+	)
+}
+
+func NewInvalidNetworkNameError(networkName string) error {
+	return fmt.Errorf(
+		"invalid network name %q",
+		networkName,
+	)
+}
+
+func NewNetworkMagicMismatchError(networkName string, networkMagic uint32) error {
+	return fmt.Errorf(
+		"network magic for network %q must be %d",
 		networkName,
+		networkMagic,
 	)
 }
 
+func NewNetworkConfigKnownNetworkError(networkName string) error {
+	return fmt.Errorf(
+		"network config files can only be provided for custom networks, not %q",
+		networkName,
+	)
+}
+
+func NewNetworkConfigDirError(dir string, err error) error {
+	return fmt.Errorf(
+		"failed to read network config dir %s: %w",
+		dir,
+		err,
+	)
+}
+
+func NewNotDevnetError(contextName string) error {
+	return fmt.Errorf(
+		"context %q is not a devnet created with 'cardano-up devnet create'",
+		contextName,
+	)
+}
+
+func NewDevnetEpochLengthError(minEpochLength int) error {
+	return fmt.Errorf(
+		"devnet epoch length must be at least %d slots",
+		minEpochLength,
+	)
+}
+
+func NewDevnetGenesisError(exitCode int64, output string) error {
+	return fmt.Errorf(
+		"failed to generate devnet genesis files (exit code %d): %s",
+		exitCode,
+		output,
+	)
+}
+
+func NewDevnetGenesisMissingError(path string) error {
+	return fmt.Errorf(
+		"devnet genesis file %s was not generated",
+		path,
+	)
+}
+
+// ErrCustomNetworkNoName is returned when a network magic or config files are provided for a
+// context without a network name
+var ErrCustomNetworkNoName = errors.New(
+	"a network name must be provided along with a network magic or network config files",
+)
+
 func NewResolverPackageAlreadyInstalledError(pkgName string) error {
 	return fmt.Errorf(
 		"the package %q is already installed in the current context\n\nYou can use 'cardano-up context create' to create an empty context to install another instance of the package",
@@ -86,6 +285,18 @@ func NewResolverNoAvailablePackageDependencyError(depSpec string) error {
 	)
 }
 
+func NewResolverDuplicatePackageError(pkgName string) error {
+	return fmt.Errorf("the package %q was specified more than once", pkgName)
+}
+
+func NewResolverDependencyOptionConflictError(pkgName string, optName string) error {
+	return fmt.Errorf(
+		"conflicting values for option %q of package %q from the requested packages and their dependencies",
+		optName,
+		pkgName,
+	)
+}
+
 func NewResolverNoAvailablePackage(pkgSpec string) error {
 	return fmt.Errorf(
 		"no available package found: %s",
@@ -106,6 +317,20 @@ func NewResolverInstalledPackageNoMatchVersionSpecError(
 	)
 }
 
+func NewNodeNotInstalledError(context string) error {
+	return fmt.Errorf(
+		"no package providing the node socket is installed in context %q",
+		context,
+	)
+}
+
+func NewContainerNotRunningError(containerName string) error {
+	return fmt.Errorf(
+		"container %s is not running, start it with 'cardano-up up'",
+		containerName,
+	)
+}
+
 func NewPackageNotInstalledError(pkgName string, context string) error {
 	return fmt.Errorf(
 		"package %q is not installed in context %q",
@@ -114,6 +339,15 @@ func NewPackageNotInstalledError(pkgName string, context string) error {
 	)
 }
 
+func NewPackageVersionAmbiguousError(pkgName string, versions []string) error {
+	return fmt.Errorf(
+		"package %q has more than one version installed (%s), specify one with \"%s = <version>\"",
+		pkgName,
+		strings.Join(versions, ", "),
+		pkgName,
+	)
+}
+
 func NewPackageUninstallWouldBreakDepsError(
 	uninstallPkgName string,
 	uninstallPkgVersion string,
@@ -136,6 +370,60 @@ func NewNoPackageAvailableForUpgradeError(pkgSpec string) error {
 	)
 }
 
+func NewUpgradeToOlderVersionError(
+	pkgName string,
+	installedVersion string,
+	targetVersion string,
+) error {
+	return fmt.Errorf(
+		"package %s (= %s) would be moved to older version %s, use 'downgrade' instead",
+		pkgName,
+		installedVersion,
+		targetVersion,
+	)
+}
+
+func NewPackageNotOlderVersionError(
+	pkgName string,
+	installedVersion string,
+	targetVersion string,
+) error {
+	return fmt.Errorf(
+		"version %s is not older than the installed version %s of package %s",
+		targetVersion,
+		installedVersion,
+		pkgName,
+	)
+}
+
+func NewPackageDowngradeWouldBreakDepsError(
+	pkgName string,
+	targetVersion string,
+	dependentPkgName string,
+	dependentPkgVersion string,
+) error {
+	return fmt.Errorf(
+		`downgrade of package %s to version %s would break dependencies for package "%s = %s"`,
+		pkgName,
+		targetVersion,
+		dependentPkgName,
+		dependentPkgVersion,
+	)
+}
+
+func NewDowngradeDataIncompatibleError(
+	pkgName string,
+	installedSchema int,
+	targetSchema int,
+) error {
+	return fmt.Errorf(
+		"package %s data schema version %d is newer than version %d used by the older version, use --force to downgrade anyway",
+		pkgName,
+		installedSchema,
+		targetSchema,
+	)
+}
+
 func NewInstallStepConditionError(condition string, err error) error {
 	return fmt.Errorf(
 		"failure evaluating install step condition %q: %s",
@@ -144,9 +432,876 @@ func NewInstallStepConditionError(condition string, err error) error {
 	)
 }
 
+func NewDependencyConditionError(depSpec string, condition string, err error) error {
+	return fmt.Errorf(
+		"failure evaluating condition %q for dependency %q: %s",
+		condition,
+		depSpec,
+		err,
+	)
+}
+
 func NewNoServicesFoundError(pkgName string) error {
 	return fmt.Errorf(
 		"no services found for package %q",
 		pkgName,
 	)
 }
+
+func NewNoContextServicesFoundError(context string) error {
+	return fmt.Errorf(
+		"no services found for installed packages in context %q",
+		context,
+	)
+}
+
+func NewInvalidPortError(port int) error {
+	return fmt.Errorf(
+		"invalid port: %d",
+		port,
+	)
+}
+
+func NewNoFreePortError(port int) error {
+	return fmt.Errorf(
+		"could not find a free host port at or above %d",
+		port,
+	)
+}
+
+func NewRegistryAuthFailedError(registryUrl string, status string) error {
+	return fmt.Errorf(
+		"authentication failed fetching package registry %s: %s",
+		registryUrl,
+		status,
+	)
+}
+
+func NewRegistryFetchFailedError(registryUrl string, status string) error {
+	return fmt.Errorf(
+		"failed to fetch package registry %s: %s",
+		registryUrl,
+		status,
+	)
+}
+
+func NewHttpCertificateError(err error) error {
+	return fmt.Errorf(
+		"TLS certificate verification failed: %s\n\nIf you are behind a proxy that performs TLS interception, you can provide its CA certificate with the HTTP_CA_BUNDLE env var",
+		err,
+	)
+}
+
+func NewInvalidDeviceError(device string) error {
+	return fmt.Errorf(
+		"invalid device specification: %s",
+		device,
+	)
+}
+
+func NewInvalidGpusError(gpus string) error {
+	return fmt.Errorf(
+		"invalid GPU specification: %s",
+		gpus,
+	)
+}
+
+func NewInvalidContainerUserError(user string) error {
+	return fmt.Errorf(
+		"invalid container user, expected user, uid, user:group, uid:gid, or %q: %s",
+		containerUserImage,
+		user,
+	)
+}
+
+func NewInvalidPlatformError(platform string) error {
+	return fmt.Errorf(
+		"invalid platform specification, expected os/arch[/variant]: %s",
+		platform,
+	)
+}
+
+func NewInvalidExtraHostError(extraHost string) error {
+	return fmt.Errorf(
+		"invalid extra host, expected host:ip or host:%s: %s",
+		dockerHostGateway,
+		extraHost,
+	)
+}
+
+func NewInvalidDnsServerError(dnsServer string) error {
+	return fmt.Errorf(
+		"invalid DNS server, expected an IP address: %s",
+		dnsServer,
+	)
+}
+
+func NewInvalidSysctlError(name string) error {
+	return fmt.Errorf(
+		"invalid sysctl name: %q",
+		name,
+	)
+}
+
+func NewInvalidCapabilityError(capability string) error {
+	return fmt.Errorf(
+		"invalid capability: %q",
+		capability,
+	)
+}
+
+func NewInvalidUlimitError(ulimit string, err error) error {
+	return fmt.Errorf(
+		"invalid ulimit specification %s: %w",
+		ulimit,
+		err,
+	)
+}
+
+func NewInvalidShmSizeError(shmSize string) error {
+	return fmt.Errorf(
+		"invalid shm size: %s",
+		shmSize,
+	)
+}
+
+func NewInvalidGrepPatternError(pattern string, err error) error {
+	return fmt.Errorf(
+		"invalid grep pattern %q: %w",
+		pattern,
+		err,
+	)
+}
+
+func NewInvalidTmpfsError(tmpfs string) error {
+	return fmt.Errorf(
+		"invalid tmpfs mount, container path must be absolute: %s",
+		tmpfs,
+	)
+}
+
+func NewDeviceNotFoundError(device string) error {
+	return fmt.Errorf(
+		"device not found on host: %s",
+		device,
+	)
+}
+
+func NewPackageSpecVersionUnsupportedError(specVersion int) error {
+	return fmt.Errorf(
+		"%w %d (maximum supported is %d), please upgrade cardano-up",
+		ErrPackageSpecVersionUnsupported,
+		specVersion,
+		PackageSpecVersion,
+	)
+}
+
+func NewPackageSpecVersionInvalidError(specVersion int) error {
+	return fmt.Errorf(
+		"invalid package spec version: %d",
+		specVersion,
+	)
+}
+
+func NewPackageSpecVersionNoConverterError(specVersion int) error {
+	return fmt.Errorf(
+		"no converter available for package spec version %d",
+		specVersion,
+	)
+}
+
+func NewNoLocalPackagesError(path string) error {
+	return fmt.Errorf(
+		"no packages found in %s",
+		path,
+	)
+}
+
+func NewLocalPackageAmbiguousError(path string, pkgNames []string) error {
+	return fmt.Errorf(
+		"multiple packages found in %s, please specify a single package file: %s",
+		path,
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewPackageDirNotEmptyError(dir string) error {
+	return fmt.Errorf(
+		"package directory %s already exists and is not empty",
+		dir,
+	)
+}
+
+func NewPackageOptionUnknownError(pkgName string, optName string) error {
+	return fmt.Errorf(
+		"package %s has no option %q",
+		pkgName,
+		optName,
+	)
+}
+
+func NewInvalidInstanceNameError(instance string) error {
+	return fmt.Errorf(
+		"invalid package instance name: %s",
+		instance,
+	)
+}
+
+func NewInstanceNameConflictError(instanceName string) error {
+	return fmt.Errorf(
+		"the name %q is used by both a package and an additional instance of another package, please choose a different instance name",
+		instanceName,
+	)
+}
+
+func NewInvalidTopologyPeerError(peer string) error {
+	return fmt.Errorf(
+		"invalid topology peer %q, expected ADDRESS:PORT",
+		peer,
+	)
+}
+
+func NewTopologyPeerExistsError(peer string) error {
+	return fmt.Errorf(
+		"topology peer %s already exists",
+		peer,
+	)
+}
+
+func NewTopologyPeerNotFoundError(peer string) error {
+	return fmt.Errorf(
+		"topology peer %s not found",
+		peer,
+	)
+}
+
+func NewPackageNoTopologyError(pkgName string) error {
+	return fmt.Errorf(
+		"package %s does not declare a topology file",
+		pkgName,
+	)
+}
+
+func NewTopologyPackageAmbiguousError(pkgNames []string) error {
+	return fmt.Errorf(
+		"multiple installed packages declare a topology file, please specify one: %s",
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewInvalidSecretNameError(name string) error {
+	return fmt.Errorf(
+		"invalid secret name: %s",
+		name,
+	)
+}
+
+func NewInvalidInstallStepValueError(
+	pkgName string,
+	field string,
+	value string,
+	err error,
+) error {
+	return fmt.Errorf(
+		"invalid value %q for %s in package %s: %w",
+		value,
+		field,
+		pkgName,
+		err,
+	)
+}
+
+func NewInvalidProfileNameError(profile string) error {
+	return fmt.Errorf(
+		"invalid profile name: %s",
+		profile,
+	)
+}
+
+func NewSecretNotFoundError(name string) error {
+	return fmt.Errorf(
+		"secret %s is not set",
+		name,
+	)
+}
+
+func NewSecretNotSetError(name string, pkgName string) error {
+	return fmt.Errorf(
+		"package %s requires secret %s, set it with 'cardano-up secret set %s'",
+		pkgName,
+		name,
+		name,
+	)
+}
+
+func NewSecretsKeyMissingError(keyPath string) error {
+	return fmt.Errorf(
+		"secrets key %s does not exist",
+		keyPath,
+	)
+}
+
+func NewSecretsKeyInvalidError(keyPath string) error {
+	return fmt.Errorf(
+		"secrets key %s is not valid",
+		keyPath,
+	)
+}
+
+func NewSecretsKeyInConfigDirError(keyPath string) error {
+	return fmt.Errorf(
+		"secrets key %s must not be stored in the config dir alongside the encrypted secrets, move it elsewhere and set SECRETS_KEY_FILE",
+		keyPath,
+	)
+}
+
+func NewInvalidDockerHostError(dockerHost string, reason string) error {
+	return fmt.Errorf(
+		"invalid Docker host %q: %s",
+		dockerHost,
+		reason,
+	)
+}
+
+func NewInvalidBindOverrideError(bind string) error {
+	return fmt.Errorf(
+		"invalid bind mount %q: expected an absolute host path and container path in the format host:/container[:options]",
+		bind,
+	)
+}
+
+func NewBindOverrideNoMatchError(bind string, pkgName string) error {
+	return fmt.Errorf(
+		"bind mount %q does not match the container path of a bind mount in package %s, which must have a single container to add it to",
+		bind,
+		pkgName,
+	)
+}
+
+func NewInvalidEnvOverrideError(env string) error {
+	return fmt.Errorf(
+		"invalid env var %q: expected KEY=VALUE, with a name made of letters, digits, and underscores",
+		env,
+	)
+}
+
+func NewInvalidDataRootError(dataRoot string) error {
+	return fmt.Errorf("data root must be an absolute path: %s", dataRoot)
+}
+
+func NewInvalidRemoteDataDirError(remoteDataDir string) error {
+	return fmt.Errorf(
+		"remote data dir %q must be an absolute path",
+		remoteDataDir,
+	)
+}
+
+func NewSshCommandError(destination string, err error, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return fmt.Errorf(
+			"ssh command on %s failed: %s",
+			destination,
+			err,
+		)
+	}
+	return fmt.Errorf(
+		"ssh command on %s failed: %s: %s",
+		destination,
+		err,
+		stderr,
+	)
+}
+
+func NewNoPackagesInstalledError(context string) error {
+	return fmt.Errorf(
+		"no packages are installed in context %q",
+		context,
+	)
+}
+
+func NewInvalidPortSpecError(port string) error {
+	return fmt.Errorf(
+		"invalid port spec: %s",
+		port,
+	)
+}
+
+func NewRetriesExhaustedError(desc string, errs []error) error {
+	attemptErrs := make([]error, 0, len(errs))
+	for idx, err := range errs {
+		attemptErrs = append(
+			attemptErrs,
+			fmt.Errorf("attempt %d: %w", idx+1, err),
+		)
+	}
+	return fmt.Errorf(
+		"%s failed after %d attempts:\n%w",
+		desc,
+		len(errs),
+		errors.Join(attemptErrs...),
+	)
+}
+
+func NewImagePullError(imageName string, msg string) error {
+	return fmt.Errorf(
+		"failed to pull image %s: %s",
+		imageName,
+		msg,
+	)
+}
+
+func NewImageNotFoundError(imageName string, err error) error {
+	return fmt.Errorf(
+		"image %s was not found in its registry, or access was denied: %w",
+		imageName,
+		err,
+	)
+}
+
+func NewImagePlatformNotFoundError(
+	imageName string,
+	platform string,
+	availablePlatforms []string,
+) error {
+	return fmt.Errorf(
+		"image %s does not provide a variant for platform %s (available: %s)",
+		imageName,
+		platform,
+		strings.Join(availablePlatforms, ", "),
+	)
+}
+
+func NewPackageNotBlockProducerError(pkgName string) error {
+	return fmt.Errorf(
+		"package %s does not declare a block producer",
+		pkgName,
+	)
+}
+
+func NewBlockProducerPackageAmbiguousError(pkgNames []string) error {
+	return fmt.Errorf(
+		"multiple installed packages declare a block producer, please specify one: %s",
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewSPOKeyNotFoundError(filename string, keysDir string) error {
+	return fmt.Errorf(
+		"%s not found in keys dir %s",
+		filename,
+		keysDir,
+	)
+}
+
+func NewSPOCliError(exitCode int64, output string) error {
+	return fmt.Errorf(
+		"cardano-cli failed (exit code %d): %s",
+		exitCode,
+		output,
+	)
+}
+
+func NewPackageNotWalletError(pkgName string) error {
+	return fmt.Errorf(
+		"package %s does not declare a wallet",
+		pkgName,
+	)
+}
+
+func NewWalletPackageAmbiguousError(pkgNames []string) error {
+	return fmt.Errorf(
+		"multiple installed packages declare a wallet, please specify one: %s",
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewWalletNotReadyError(pkgName string, timeout time.Duration) error {
+	return fmt.Errorf(
+		"wallet API for package %s was not ready after %s",
+		pkgName,
+		timeout,
+	)
+}
+
+// ErrOutputReadyCheckInvalid is returned for an output readiness check that doesn't specify exactly
+// one of http, tcp, or socket
+var ErrOutputReadyCheckInvalid = errors.New(
+	"output readiness check must specify exactly one of http, tcp, or socket",
+)
+
+func NewOutputsNotReadyError(outputs []string, timeout time.Duration) error {
+	return fmt.Errorf(
+		"outputs were not ready after %s: %s",
+		timeout,
+		strings.Join(outputs, ", "),
+	)
+}
+
+func NewWalletApiError(code string, message string) error {
+	if code == "" {
+		return fmt.Errorf("wallet API request failed: %s", message)
+	}
+	return fmt.Errorf(
+		"wallet API request failed: %s (%s)",
+		message,
+		code,
+	)
+}
+
+func NewNoteNotFoundError(pkgName string, noteNum int) error {
+	return fmt.Errorf(
+		"package %s does not have a note %d",
+		pkgName,
+		noteNum,
+	)
+}
+
+func NewNoteNotActionError(pkgName string, noteNum int) error {
+	return fmt.Errorf(
+		"note %d for package %s does not require action",
+		noteNum,
+		pkgName,
+	)
+}
+
+func NewPackageNotSupersededError(pkgName string) error {
+	return fmt.Errorf(
+		"package %s has not been superseded by another package",
+		pkgName,
+	)
+}
+
+func NewHookNotApprovedError(hook string, pkgName string) error {
+	return fmt.Errorf(
+		"%s for package %s was not approved, use --yes or trust the registry to run it without approval",
+		hook,
+		pkgName,
+	)
+}
+
+func NewHookTimeoutError(hook string, pkgName string, timeout time.Duration) error {
+	return fmt.Errorf(
+		"%s for package %s did not finish within %s",
+		hook,
+		pkgName,
+		timeout,
+	)
+}
+
+func NewMigrationFailedError(name string, pkgName string, err error) error {
+	return fmt.Errorf(
+		"migration %s for package %s failed: %w",
+		name,
+		pkgName,
+		err,
+	)
+}
+
+func NewContainerUnhealthyError(containerName string, reason string) error {
+	return fmt.Errorf(
+		"container %s is not healthy: %s",
+		containerName,
+		reason,
+	)
+}
+
+func NewUpgradeHealthTimeoutError(pkgName string, timeout time.Duration) error {
+	return fmt.Errorf(
+		"containers for package %s were not healthy after %s",
+		pkgName,
+		timeout,
+	)
+}
+
+func NewUpgradeDataDirExistsError(dataDir string) error {
+	return fmt.Errorf(
+		"data dir %s for the new package version already exists, remove it to upgrade",
+		dataDir,
+	)
+}
+
+func NewInvalidPageError(offset int, limit int) error {
+	return fmt.Errorf(
+		"invalid page: offset (%d) and limit (%d) cannot be negative",
+		offset,
+		limit,
+	)
+}
+
+func NewPlanCommandUnknownError(command string) error {
+	return fmt.Errorf(
+		"unknown plan command %q",
+		command,
+	)
+}
+
+func NewPlanVersionError(version int) error {
+	return fmt.Errorf(
+		"unsupported plan version %d (expected %d)",
+		version,
+		PlanVersion,
+	)
+}
+
+func NewPlanContextMismatchError(planContext string, activeContext string) error {
+	return fmt.Errorf(
+		"plan was created for context %q, but the active context is %q",
+		planContext,
+		activeContext,
+	)
+}
+
+func NewPlanOutdatedError(reason string) error {
+	return fmt.Errorf(
+		"plan no longer matches what the command will do (%s), create a new plan",
+		reason,
+	)
+}
+
+func NewPlanUninstallBreaksError(pkgNames []string) error {
+	return fmt.Errorf(
+		"uninstalling would break the dependent packages %s, use --cascade to also uninstall them",
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewInsufficientDiskSpaceError(path string, required uint64, free uint64) error {
+	return fmt.Errorf(
+		"not enough free disk space for %s: %s required, %s available (use --ignore-disk-space to install anyway)",
+		path,
+		FormatBytes(required),
+		FormatBytes(free),
+	)
+}
+
+func NewServiceDependencyFailedError(pkgName string) error {
+	return fmt.Errorf(
+		"skipped because dependency %s failed",
+		pkgName,
+	)
+}
+
+func NewServicesFailedError(failed int, total int) error {
+	return fmt.Errorf(
+		"%d of %d packages failed",
+		failed,
+		total,
+	)
+}
+
+func NewImportContainerNotFoundError(containerName string) error {
+	return fmt.Errorf(
+		"container %s does not exist",
+		containerName,
+	)
+}
+
+func NewImportDependenciesNotInstalledError(pkgName string, deps []string) error {
+	return fmt.Errorf(
+		"package %s depends on packages that are not installed, install them first: %s",
+		pkgName,
+		strings.Join(deps, ", "),
+	)
+}
+
+func NewImportContainerCountError(pkgName string, count int) error {
+	return fmt.Errorf(
+		"package %s has %d containers, only packages with a single container can be imported",
+		pkgName,
+		count,
+	)
+}
+
+func NewPackageContainerError(pkgName string, containerName string, containerNames []string) error {
+	if containerName == "" {
+		return fmt.Errorf(
+			"package %s has more than one container, specify one of: %s",
+			pkgName,
+			strings.Join(containerNames, ", "),
+		)
+	}
+	return fmt.Errorf(
+		"package %s has no container %q, specify one of: %s",
+		pkgName,
+		containerName,
+		strings.Join(containerNames, ", "),
+	)
+}
+
+func NewInvalidDetachKeysError(keys string) error {
+	return fmt.Errorf(
+		"invalid detach keys %q: expected a comma-separated list of single characters and ctrl-<key> combinations",
+		keys,
+	)
+}
+
+func NewInvalidContainerPathError(containerPath string) error {
+	return fmt.Errorf(
+		"invalid container path %q: the path must be absolute",
+		containerPath,
+	)
+}
+
+func NewCopyDirToFileError(containerPath string) error {
+	return fmt.Errorf(
+		"cannot copy a directory to %s, which is a file in the container",
+		containerPath,
+	)
+}
+
+func NewInvalidArchiveEntryError(name string) error {
+	return fmt.Errorf(
+		"invalid entry %q in archive from container",
+		name,
+	)
+}
+
+func NewPackageNotDatabaseError(pkgName string) error {
+	return fmt.Errorf(
+		"package %s does not declare a database",
+		pkgName,
+	)
+}
+
+func NewDatabasePackageAmbiguousError(pkgNames []string) error {
+	return fmt.Errorf(
+		"multiple installed packages declare a database, please specify one: %s",
+		strings.Join(pkgNames, ", "),
+	)
+}
+
+func NewDatabaseNotDbSyncError(pkgName string) error {
+	return fmt.Errorf(
+		"the database for package %s does not use the cardano-db-sync schema",
+		pkgName,
+	)
+}
+
+func NewDatabaseCommandError(command string, exitCode int, output string) error {
+	return fmt.Errorf(
+		"%s failed (exit code %d): %s",
+		command,
+		exitCode,
+		output,
+	)
+}
+
+func NewInvalidDatabaseSnapshotNameError(name string) error {
+	return fmt.Errorf(
+		"invalid snapshot name %q: names can only contain letters, numbers, '.', '_' and '-'",
+		name,
+	)
+}
+
+func NewDatabaseSnapshotExistsError(name string) error {
+	return fmt.Errorf(
+		"snapshot %s already exists",
+		name,
+	)
+}
+
+func NewDatabaseSnapshotNotFoundError(name string) error {
+	return fmt.Errorf(
+		"snapshot %s not found",
+		name,
+	)
+}
+
+func NewDatabaseSnapshotVersionError(name string, snapshotVersion string, version string) error {
+	return fmt.Errorf(
+		"snapshot %s was created with package version %s, not the installed version %s, use --force to restore it anyway",
+		name,
+		snapshotVersion,
+		version,
+	)
+}
+
+func NewCliCommandNotFoundError(pkgName string, name string, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf(
+			"package %s does not provide any CLI commands",
+			pkgName,
+		)
+	}
+	return fmt.Errorf(
+		"package %s does not provide CLI command %q, available commands: %s",
+		pkgName,
+		name,
+		strings.Join(names, ", "),
+	)
+}
+
+func NewCliCommandNotApprovedError(name string, pkgName string) error {
+	return fmt.Errorf(
+		"CLI command %s for package %s was not approved, trust the package registry to run it",
+		name,
+		pkgName,
+	)
+}
+
+func NewUnknownFirewallError(firewall string, firewalls []string) error {
+	return fmt.Errorf(
+		"unknown firewall %q, supported firewalls: %s",
+		firewall,
+		strings.Join(firewalls, ", "),
+	)
+}
+
+func NewUnknownConfigProfileError(profile string, profiles []string) error {
+	return fmt.Errorf(
+		"unknown config profile %q, available profiles: %s",
+		profile,
+		strings.Join(profiles, ", "),
+	)
+}
+
+func NewTelemetrySubmitError(status string) error {
+	return fmt.Errorf(
+		"failed to submit usage stats: server returned %s",
+		status,
+	)
+}
+
+func NewInstallStepTypeExistsError(key string) error {
+	return fmt.Errorf(
+		"install step type %q already exists",
+		key,
+	)
+}
+
+func NewUnknownInstallStepTypeError(key string, keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("unknown install step type %q", key)
+	}
+	return fmt.Errorf(
+		"unknown install step type %q, registered install step types: %s",
+		key,
+		strings.Join(keys, ", "),
+	)
+}
+
+func NewPackageOptionInvalidValueError(pkgName string, optName string, err error) error {
+	return fmt.Errorf(
+		"invalid value for option %q of package %s: %w",
+		optName,
+		pkgName,
+		err,
+	)
+}
+
+func NewPackageTestsFailedError(tests []string) error {
+	return fmt.Errorf(
+		"%w: %s",
+		ErrPackageTestsFailed,
+		strings.Join(tests, ", "),
+	)
+}
+
+func NewUnsupportedShellError(shell string) error {
+	return fmt.Errorf(
+		"unsupported shell %q, supported shells: %s",
+		shell,
+		strings.Join(ShellNames(), ", "),
+	)
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"log/slog"
+)
+
+// EventAttrKey is the log attribute key used to identify the event type for machine-readable output
+const EventAttrKey = "event"
+
+// Event types attached to log messages
+const (
+	EventResult             = "result"
+	EventPackageInstalled   = "package_installed"
+	EventPackageUpgraded    = "package_upgraded"
+	EventPackageUninstalled = "package_uninstalled"
+	EventPackageNotes       = "package_notes"
+	EventPackageInfo        = "package_info"
+	EventContainerAlert     = "container_alert"
+	EventWatchIncident      = "watch_incident"
+	EventHookOutput         = "hook_output"
+)
+
+// EventAttr returns a log attribute identifying the event type
+func EventAttr(event string) slog.Attr {
+	return slog.String(EventAttrKey, event)
+}
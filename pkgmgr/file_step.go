@@ -0,0 +1,588 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	fileArchiveFormatTarGz = "tar.gz"
+	fileArchiveFormatZip   = "zip"
+)
+
+// isDir returns whether the file install step installs a dir, either copied from a source dir or
+// extracted from an archive
+func (p *PackageInstallStepFile) isDir() bool {
+	return p.SourceDir != "" || p.Extract
+}
+
+// validateDir checks the options for a file install step that installs a dir
+func (p *PackageInstallStepFile) validateDir() error {
+	if p.SourceDir != "" && p.Extract {
+		return errors.New("file sourceDir cannot be used with extract")
+	}
+	if p.SourceDir != "" && (p.Source != "" || p.Content != "") {
+		return errors.New("file sourceDir cannot be used with source or content")
+	}
+	if p.Extract {
+		if p.Source == "" {
+			return errors.New("file extract requires an archive source")
+		}
+		if p.Content != "" {
+			return errors.New("file extract cannot be used with content")
+		}
+		// Templated sources are checked when extracted
+		if !strings.Contains(p.Source, "{{") {
+			if _, err := fileArchiveFormat(p.Source); err != nil {
+				return err
+			}
+		}
+	}
+	if p.Binary {
+		return errors.New("file binary cannot be used with sourceDir or extract")
+	}
+	// Templated filenames are checked when rendered
+	if !strings.Contains(p.Filename, "{{") {
+		if err := validateFileStepDir(p.Filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFileStepDir checks that the dir for a file install step is inside the package data dir,
+// since the whole dir is removed on uninstall
+func validateFileStepDir(dir string) error {
+	if !filepath.IsLocal(dir) || filepath.Clean(dir) == "." {
+		return fmt.Errorf("file filename %q must be a dir inside the package data dir", dir)
+	}
+	return nil
+}
+
+// fileStepItem is a file install step for a single item of Foreach, along with the template to
+// render it with
+type fileStepItem struct {
+	tmpl *Template
+	step *PackageInstallStepFile
+}
+
+// items returns the install step for each item of Foreach, with the item available to templates
+// as .Item. Items are rendered as templates, and items that render as empty or as a duplicate are
+// skipped, which allows items to depend on options. An install step without Foreach is returned
+// as is
+func (p *PackageInstallStepFile) items(tmpl *Template) ([]fileStepItem, error) {
+	if len(p.Foreach) == 0 {
+		return []fileStepItem{{tmpl: tmpl, step: p}}, nil
+	}
+	ret := make([]fileStepItem, 0, len(p.Foreach))
+	seen := make(map[string]bool)
+	for _, item := range p.Foreach {
+		tmpItem, err := tmpl.Render(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		tmpItem = strings.TrimSpace(tmpItem)
+		if tmpItem == "" || seen[tmpItem] {
+			continue
+		}
+		seen[tmpItem] = true
+		itemStep := *p
+		itemStep.Foreach = nil
+		ret = append(
+			ret,
+			fileStepItem{
+				tmpl: tmpl.WithVars(map[string]any{"Item": tmpItem}),
+				step: &itemStep,
+			},
+		)
+	}
+	return ret, nil
+}
+
+// forEach calls the function with the install step for each item of Foreach
+func (p *PackageInstallStepFile) forEach(
+	cfg Config,
+	fn func(Config, *PackageInstallStepFile) error,
+) error {
+	items, err := p.items(cfg.Template)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		itemCfg := cfg
+		itemCfg.Template = item.tmpl
+		if err := fn(itemCfg, item.step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileStepSourcePath returns the path of a source file or dir for a file install step, which is
+// rendered as a template and is relative to the package manifest
+func fileStepSourcePath(cfg Config, packagePath string, source string) (string, error) {
+	tmpSource, err := cfg.Template.Render(source, nil)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(packagePath), tmpSource), nil
+}
+
+// installDir copies the source dir or extracts the archive source to the dir for the install step.
+// The source dir name and the files in it are rendered as templates, while files from an archive
+// are left as is.
+// File modes are kept from the source, unless the install step has a mode
+func (p *PackageInstallStepFile) installDir(
+	cfg Config,
+	dirPath string,
+	packagePath string,
+) error {
+	source := p.SourceDir
+	if p.Extract {
+		source = p.Source
+	}
+	sourcePath, err := fileStepSourcePath(cfg, packagePath, source)
+	if err != nil {
+		return err
+	}
+	if p.Extract {
+		if err := extractFileArchive(sourcePath, dirPath); err != nil {
+			return err
+		}
+	} else {
+		if err := p.copySourceDir(cfg, sourcePath, dirPath); err != nil {
+			return err
+		}
+	}
+	if p.Mode > 0 {
+		if err := chmodFiles(dirPath, p.Mode); err != nil {
+			return err
+		}
+	}
+	cfg.Logger.Debug(fmt.Sprintf("wrote dir %s from %s", dirPath, sourcePath))
+	// Copy the files to a remote Docker host, so that they're available to bind mounts there
+	remote, err := cfg.remoteHost()
+	if err != nil {
+		return err
+	}
+	if remote == nil {
+		return nil
+	}
+	return filepath.WalkDir(
+		dirPath,
+		func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			remoteFilePath, ok := remotePath(cfg, filePath)
+			if !ok {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := remote.copyFile(cfg.ctx(), filePath, remoteFilePath, info.Mode()); err != nil {
+				return err
+			}
+			cfg.Logger.Debug(
+				fmt.Sprintf(
+					"copied file %s to %s on remote host",
+					filePath,
+					remoteFilePath,
+				),
+			)
+			return nil
+		},
+	)
+}
+
+// copySourceDir copies a source dir from the package, rendering each file as a template. Symlinks
+// and other special files are skipped
+func (p *PackageInstallStepFile) copySourceDir(
+	cfg Config,
+	sourceDir string,
+	destDir string,
+) error {
+	return filepath.WalkDir(
+		sourceDir,
+		func(srcPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(sourceDir, srcPath)
+			if err != nil {
+				return err
+			}
+			destPath := filepath.Join(destDir, relPath)
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return os.MkdirAll(destPath, info.Mode().Perm())
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			content, err := renderSourceFile(cfg, srcPath)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(destPath, []byte(content), info.Mode().Perm())
+		},
+	)
+}
+
+// renderSourceFile reads a source file from a package and renders it as a template
+func renderSourceFile(cfg Config, sourcePath string) (string, error) {
+	content, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Template.Render(string(content), nil)
+}
+
+// installedFilenames returns the filenames of the files installed by the install step, relative to
+// the package data dir. The rendered filename is returned as is for a dir that doesn't exist
+func (p *PackageInstallStepFile) installedFilenames(
+	tmpl *Template,
+	pkgDataDir string,
+) ([]string, error) {
+	if len(p.Foreach) > 0 {
+		items, err := p.items(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		var ret []string
+		for _, item := range items {
+			filenames, err := item.step.installedFilenames(item.tmpl, pkgDataDir)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, filenames...)
+		}
+		return ret, nil
+	}
+	filename, err := tmpl.Render(p.Filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isDir() {
+		return []string{filename}, nil
+	}
+	dirPath := filepath.Join(pkgDataDir, filename)
+	if _, err := os.Stat(dirPath); errors.Is(err, fs.ErrNotExist) {
+		return []string{filename}, nil
+	}
+	var ret []string
+	err = filepath.WalkDir(
+		dirPath,
+		func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			relPath, err := filepath.Rel(pkgDataDir, filePath)
+			if err != nil {
+				return err
+			}
+			ret = append(ret, relPath)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// dirDrift compares the dir for the install step with the source dir. Only missing dirs are
+// detected for archives, since the extracted files may be changed by the package
+func (p *PackageInstallStepFile) dirDrift(
+	cfg Config,
+	pkgName string,
+	packagePath string,
+) (string, func() error, error) {
+	filename, err := cfg.Template.Render(p.Filename, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	dirPath := filepath.Join(cfg.packageDataDir(pkgName), filename)
+	var repair func() error
+	if packagePath != "" {
+		repair = func() error {
+			return p.install(cfg, pkgName, packagePath)
+		}
+	}
+	if _, err := os.Stat(dirPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("dir %s is missing", dirPath), repair, nil
+		}
+		return "", nil, err
+	}
+	if p.SourceDir == "" || packagePath == "" {
+		return "", nil, nil
+	}
+	sourceDir, err := fileStepSourcePath(cfg, packagePath, p.SourceDir)
+	if err != nil {
+		return "", nil, err
+	}
+	var description string
+	err = filepath.WalkDir(
+		sourceDir,
+		func(srcPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			relPath, err := filepath.Rel(sourceDir, srcPath)
+			if err != nil {
+				return err
+			}
+			filePath := filepath.Join(dirPath, relPath)
+			expectedContent, err := renderSourceFile(cfg, srcPath)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					description = fmt.Sprintf("file %s is missing", filePath)
+					return fs.SkipAll
+				}
+				return err
+			}
+			if string(content) != expectedContent {
+				description = fmt.Sprintf("file %s has been modified", filePath)
+				return fs.SkipAll
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	if description != "" {
+		return description, repair, nil
+	}
+	return "", nil, nil
+}
+
+// fileArchiveFormat returns the format of an archive source for a file install step from its
+// file extension
+func fileArchiveFormat(source string) (string, error) {
+	lowerSource := strings.ToLower(source)
+	switch {
+	case strings.HasSuffix(lowerSource, ".tar.gz"), strings.HasSuffix(lowerSource, ".tgz"):
+		return fileArchiveFormatTarGz, nil
+	case strings.HasSuffix(lowerSource, ".zip"):
+		return fileArchiveFormatZip, nil
+	}
+	return "", fmt.Errorf(
+		"unsupported archive %q for file extract, expected .tar.gz, .tgz or .zip",
+		source,
+	)
+}
+
+// extractFileArchive extracts a tar.gz or zip archive to the destination dir, keeping file modes.
+// Entries and symlinks that point outside of the destination dir are rejected, and other special
+// files are skipped
+func extractFileArchive(archivePath string, destDir string) error {
+	format, err := fileArchiveFormat(archivePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, fs.ModePerm); err != nil {
+		return err
+	}
+	if format == fileArchiveFormatZip {
+		return extractZipArchive(archivePath, destDir)
+	}
+	return extractTarGzArchive(archivePath, destDir)
+}
+
+func extractTarGzArchive(archivePath string, destDir string) error {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+	gzReader, err := gzip.NewReader(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+	tr := tar.NewReader(gzReader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := archiveEntryPath(destDir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractArchiveFile(tr, target, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := extractArchiveSymlink(hdr.Name, hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractZipArchive(archivePath string, destDir string) error {
+	zipReader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	for _, zipFile := range zipReader.File {
+		target, err := archiveEntryPath(destDir, zipFile.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		mode := zipFile.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()); err != nil {
+				return err
+			}
+		case mode&fs.ModeSymlink != 0:
+			linkname, err := readZipFile(zipFile)
+			if err != nil {
+				return err
+			}
+			if err := extractArchiveSymlink(zipFile.Name, string(linkname), target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			zf, err := zipFile.Open()
+			if err != nil {
+				return err
+			}
+			err = extractArchiveFile(zf, target, mode.Perm())
+			zf.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readZipFile(zipFile *zip.File) ([]byte, error) {
+	zf, err := zipFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer zf.Close()
+	return io.ReadAll(zf)
+}
+
+// archiveEntryPath returns the path in the destination dir for an archive entry, or an empty path
+// for the root of the archive
+func archiveEntryPath(destDir string, name string) (string, error) {
+	entryName := path.Clean(strings.TrimPrefix(name, "./"))
+	if entryName == "." {
+		return "", nil
+	}
+	relPath := filepath.FromSlash(entryName)
+	if !filepath.IsLocal(relPath) {
+		return "", NewInvalidArchiveEntryError(name)
+	}
+	return filepath.Join(destDir, relPath), nil
+}
+
+// extractArchiveFile writes a file from an archive, creating the parent dir if the archive has no
+// entry for it
+func extractArchiveFile(r io.Reader, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), fs.ModePerm); err != nil {
+		return err
+	}
+	// Remove any existing file first, so that a symlink from a previous install isn't followed
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return extractTarFile(r, target, mode)
+}
+
+// extractArchiveSymlink creates a symlink from an archive. Only relative symlinks to paths inside
+// the archive are allowed
+func extractArchiveSymlink(name string, linkname string, target string) error {
+	linkPath := path.Join(path.Dir(path.Clean(name)), linkname)
+	if path.IsAbs(linkname) || !filepath.IsLocal(filepath.FromSlash(linkPath)) {
+		return NewInvalidArchiveEntryError(name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), fs.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(linkname, target)
+}
+
+// chmodFiles sets the mode of the regular files in a dir
+func chmodFiles(dir string, mode fs.FileMode) error {
+	return filepath.WalkDir(
+		dir,
+		func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return os.Chmod(filePath, mode)
+		},
+	)
+}
@@ -0,0 +1,353 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPackageInstallStepFileValidateDir(t *testing.T) {
+	testDefs := []struct {
+		step    PackageInstallStepFile
+		wantErr bool
+	}{
+		{
+			step: PackageInstallStepFile{Filename: "config", SourceDir: "config"},
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename: "config",
+				Source:   "config.tar.gz",
+				Extract:  true,
+			},
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename:  "config",
+				SourceDir: "config",
+				Content:   "foo",
+			},
+			wantErr: true,
+		},
+		{
+			step:    PackageInstallStepFile{Filename: "config", Extract: true},
+			wantErr: true,
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename: "config",
+				Source:   "config.rar",
+				Extract:  true,
+			},
+			wantErr: true,
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename:  "config",
+				SourceDir: "config",
+				Binary:    true,
+			},
+			wantErr: true,
+		},
+		{
+			step:    PackageInstallStepFile{Filename: ".", SourceDir: "config"},
+			wantErr: true,
+		},
+		{
+			step:    PackageInstallStepFile{Filename: "../config", SourceDir: "config"},
+			wantErr: true,
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename: "config.json",
+				Content:  "{}",
+				Foreach:  []string{"preview", "preprod"},
+			},
+			wantErr: true,
+		},
+		{
+			step: PackageInstallStepFile{
+				Filename: "config-{{ .Item }}.json",
+				Content:  "{}",
+				Foreach:  []string{"preview", " "},
+			},
+			wantErr: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.step.validate(Config{})
+		if testDef.wantErr && err == nil {
+			t.Fatalf("did not get expected error for step: %#v", testDef.step)
+		}
+		if !testDef.wantErr && err != nil {
+			t.Fatalf("unexpected error for step %#v: %s", testDef.step, err)
+		}
+	}
+}
+
+func TestPackageInstallStepFileSourceDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgDir := filepath.Join(tmpDir, "pkg")
+	sourceDir := filepath.Join(pkgDir, "config", "preview")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "genesis"), fs.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for filename, content := range map[string]string{
+		"config.json":          `{"network": "{{ .Package.Name }}"}`,
+		"genesis/shelley.json": "{}",
+	} {
+		if err := os.WriteFile(filepath.Join(sourceDir, filename), []byte(content), 0o600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(sourceDir, "genesis", "shelley.json"), 0o640); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg := Config{
+		DataDir: filepath.Join(tmpDir, "data"),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template: NewTemplate(
+			map[string]any{
+				"Package": map[string]any{"Name": "foo"},
+				"Network": "preview",
+			},
+		),
+	}
+	step := PackageInstallStepFile{
+		Filename:  "config",
+		SourceDir: "config/{{ .Network }}",
+	}
+	packagePath := filepath.Join(pkgDir, "foo.yaml")
+	if err := step.install(cfg, "foo-1.0.0-default", packagePath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	destDir := filepath.Join(cfg.DataDir, "foo-1.0.0-default", "config")
+	content, err := os.ReadFile(filepath.Join(destDir, "config.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != `{"network": "foo"}` {
+		t.Fatalf("did not get expected rendered content: %s", content)
+	}
+	if runtime.GOOS != "windows" {
+		stat, err := os.Stat(filepath.Join(destDir, "genesis", "shelley.json"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stat.Mode().Perm() != 0o640 {
+			t.Fatalf("did not keep file mode: got %o, expected 640", stat.Mode().Perm())
+		}
+	}
+	description, _, err := step.dirDrift(cfg, "foo-1.0.0-default", packagePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if description != "" {
+		t.Fatalf("unexpected drift: %s", description)
+	}
+	if err := os.WriteFile(filepath.Join(destDir, "config.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	description, _, err = step.dirDrift(cfg, "foo-1.0.0-default", packagePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if description == "" {
+		t.Fatalf("did not get expected drift for modified file")
+	}
+	if err := step.uninstall(cfg, "foo-1.0.0-default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(destDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("dir was not removed on uninstall: %v", err)
+	}
+}
+
+func TestExtractFileArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	// tar.gz
+	var tarGzBuf bytes.Buffer
+	gzWriter := gzip.NewWriter(&tarGzBuf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, hdr := range []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0o750, Size: 4},
+		{Name: "bin/tool-link", Typeflag: tar.TypeSymlink, Linkname: "tool"},
+	} {
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tarWriter.Write([]byte("tool")); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+	tarGzPath := filepath.Join(tmpDir, "files.tar.gz")
+	if err := os.WriteFile(tarGzPath, tarGzBuf.Bytes(), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tarGzDest := filepath.Join(tmpDir, "tar-gz")
+	if err := extractFileArchive(tarGzPath, tarGzDest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(tarGzDest, "bin", "tool-link"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "tool" {
+		t.Fatalf("did not get expected content: %s", content)
+	}
+	if runtime.GOOS != "windows" {
+		stat, err := os.Stat(filepath.Join(tarGzDest, "bin", "tool"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stat.Mode().Perm() != 0o750 {
+			t.Fatalf("did not keep file mode: got %o, expected 750", stat.Mode().Perm())
+		}
+	}
+	// zip
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	fw, err := zipWriter.Create("genesis/byron.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := fw.Write([]byte("{}")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zipWriter.Close()
+	zipPath := filepath.Join(tmpDir, "files.zip")
+	if err := os.WriteFile(zipPath, zipBuf.Bytes(), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zipDest := filepath.Join(tmpDir, "zip")
+	if err := extractFileArchive(zipPath, zipDest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(zipDest, "genesis", "byron.json")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestExtractFileArchiveInvalidEntry(t *testing.T) {
+	testDefs := []*tar.Header{
+		{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "/abs", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+	}
+	for _, hdr := range testDefs {
+		tmpDir := t.TempDir()
+		var buf bytes.Buffer
+		gzWriter := gzip.NewWriter(&buf)
+		tarWriter := tar.NewWriter(gzWriter)
+		if err := tarWriter.WriteHeader(hdr); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		tarWriter.Close()
+		gzWriter.Close()
+		archivePath := filepath.Join(tmpDir, "files.tgz")
+		if err := os.WriteFile(archivePath, buf.Bytes(), 0o600); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		err := extractFileArchive(archivePath, filepath.Join(tmpDir, "dest"))
+		if err == nil {
+			t.Fatalf("did not get expected error for entry %s", hdr.Name)
+		}
+	}
+}
+
+func TestPackageInstallStepFileForeach(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgDir := filepath.Join(tmpDir, "pkg")
+	for _, network := range []string{"preview", "preprod"} {
+		sourceDir := filepath.Join(pkgDir, "config", network)
+		if err := os.MkdirAll(sourceDir, fs.ModePerm); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := os.WriteFile(
+			filepath.Join(sourceDir, "config.json"),
+			[]byte(`{"network": "{{ .Item }}"}`),
+			0o600,
+		); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	cfg := Config{
+		DataDir: filepath.Join(tmpDir, "data"),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template: NewTemplate(
+			map[string]any{
+				"Network":  "preview",
+				"Testnets": false,
+			},
+		),
+	}
+	step := PackageInstallStepFile{
+		Filename: "config-{{ .Item }}.json",
+		Source:   "config/{{ .Item }}/config.json",
+		Foreach: []string{
+			"{{ .Network }}",
+			"preview",
+			"{{ if .Testnets }}preprod{{ end }}",
+		},
+	}
+	if err := step.validate(cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	packagePath := filepath.Join(pkgDir, "foo.yaml")
+	if err := step.install(cfg, "foo-1.0.0-default", packagePath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkgDataDir := filepath.Join(cfg.DataDir, "foo-1.0.0-default")
+	filenames, err := step.installedFilenames(cfg.Template, pkgDataDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(filenames) != 1 || filenames[0] != "config-preview.json" {
+		t.Fatalf("did not get expected filenames: %v", filenames)
+	}
+	content, err := os.ReadFile(filepath.Join(pkgDataDir, "config-preview.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != `{"network": "preview"}` {
+		t.Fatalf("did not get expected rendered content: %s", content)
+	}
+	if _, err := os.Stat(filepath.Join(pkgDataDir, "config-preprod.json")); err == nil {
+		t.Fatalf("unexpected file for skipped item")
+	}
+	if err := step.uninstall(cfg, "foo-1.0.0-default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(pkgDataDir, "config-preview.json")); err == nil {
+		t.Fatalf("file was not removed on uninstall")
+	}
+}
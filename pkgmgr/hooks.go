@@ -0,0 +1,457 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the package hook scripts
+const (
+	HookPreInstall    = "preInstallScript"
+	HookPostInstall   = "postInstallScript"
+	HookPreUninstall  = "preUninstallScript"
+	HookPostUninstall = "postUninstallScript"
+)
+
+// hookEvents maps the hook script fields to the lifecycle event provided to the script in
+// CARDANO_UP_EVENT
+var hookEvents = map[string]string{
+	HookPreInstall:    "pre-install",
+	HookPostInstall:   "post-install",
+	HookPreUninstall:  "pre-uninstall",
+	HookPostUninstall: "post-uninstall",
+}
+
+const (
+	// defaultHookSandboxImage is the image used to run sandboxed hook scripts when none is
+	// configured
+	defaultHookSandboxImage = "alpine:3"
+
+	// defaultHookTimeout is the amount of time a hook script can run before it's killed when no
+	// timeout is configured
+	defaultHookTimeout = 10 * time.Minute
+
+	// hookWaitDelay is the amount of time to wait for the output of a hook script to be closed
+	// after it exits or is killed
+	hookWaitDelay = 10 * time.Second
+
+	// hookLogFilename is the name of the file in the package logs dir that hook script output is
+	// written to
+	hookLogFilename = "hooks.log"
+)
+
+// HookConfig controls running the pre/post install and uninstall scripts of packages
+type HookConfig struct {
+	// Approve is called with the rendered script before running a hook script from a registry
+	// that isn't trusted, and the hook fails with an error if it returns false. Hook scripts from
+	// registries that aren't trusted aren't run when this isn't set
+	Approve func(HookScript) (bool, error)
+	// TrustAll runs all hook scripts without approval
+	TrustAll bool
+	// TrustedRegistries lists the registry URLs and dirs whose hook scripts run without approval
+	TrustedRegistries []string
+	// Sandbox runs hook scripts in a throwaway container rather than the host shell. Only the
+	// package data, cache, and context dirs are available to the script, at the same paths as on
+	// the host
+	Sandbox bool
+	// SandboxImage is the image used for sandboxed hook scripts, which must provide /bin/sh. It
+	// defaults to alpine
+	SandboxImage string
+	// Timeout is the amount of time a hook script can run before it's killed. It defaults to 10
+	// minutes
+	Timeout time.Duration
+}
+
+// HookScript is a rendered hook script that's about to run
+type HookScript struct {
+	// Package is the full name of the package, including the version and context
+	Package string
+	// Hook is the name of the hook script field, such as preInstallScript
+	Hook string
+	// Script is the rendered script
+	Script string
+	// Registry is the registry URL or dir that the package came from
+	Registry string
+}
+
+func (p Package) runHookScript(cfg Config, pkgName string, hook string, hookScript string) error {
+	renderedScript, err := cfg.Template.Render(hookScript, nil)
+	if err != nil {
+		return fmt.Errorf("failed to render hook script template: %s", err)
+	}
+	return p.runHookCommand(
+		cfg,
+		pkgName,
+		hookCommand{
+			hook:   hook,
+			args:   []string{"/bin/sh", "-c", renderedScript},
+			script: renderedScript,
+			env:    p.hookEnv(cfg, pkgName, hook),
+			dirs:   hookDirs(cfg, pkgName),
+		},
+	)
+}
+
+// hookCommand is a rendered hook script or command that's about to run
+type hookCommand struct {
+	hook string
+	// args is the command to run, which is /bin/sh -c <script> for hook scripts
+	args []string
+	// script is shown when asking for approval
+	script string
+	env    map[string]string
+	// dirs are the host dirs that are available to the command when it's sandboxed
+	dirs []string
+}
+
+// runHookCommand runs a rendered hook script or command once it's trusted or approved
+func (p Package) runHookCommand(cfg Config, pkgName string, hookCmd hookCommand) error {
+	var err error
+	if !p.hookTrusted(cfg) {
+		script := HookScript{
+			Package:  pkgName,
+			Hook:     hookCmd.hook,
+			Script:   hookCmd.script,
+			Registry: cfg.registrySource(),
+		}
+		approved := false
+		if cfg.Hooks.Approve != nil {
+			approved, err = cfg.Hooks.Approve(script)
+			if err != nil {
+				return err
+			}
+		}
+		if !approved {
+			return NewHookNotApprovedError(hookCmd.hook, pkgName)
+		}
+	}
+	timeout := cfg.Hooks.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(cfg.ctx(), timeout)
+	defer cancel()
+	output := newHookOutput(cfg, p.instanceName(), hookCmd.hook)
+	startTime := time.Now()
+	var exitCode int
+	if cfg.Hooks.Sandbox {
+		exitCode, err = p.runHookScriptSandbox(cfg, ctx, pkgName, hookCmd, output)
+	} else {
+		exitCode, err = runHookScriptHost(ctx, hookCmd, output)
+	}
+	output.Close()
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if cfg.hookResults != nil {
+		*cfg.hookResults = append(
+			*cfg.hookResults,
+			HookResult{
+				Hook:     hookCmd.hook,
+				Time:     startTime,
+				Duration: time.Since(startTime),
+				ExitCode: exitCode,
+				TimedOut: timedOut,
+			},
+		)
+	}
+	if timedOut {
+		return NewHookTimeoutError(hookCmd.hook, pkgName, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %s", hookCmd.hook, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("run %s exited with error: exit status %d", hookCmd.hook, exitCode)
+	}
+	return nil
+}
+
+// hookDirs returns the package dirs that are available to sandboxed hook scripts
+func hookDirs(cfg Config, pkgName string) []string {
+	return []string{
+		filepath.Join(cfg.DataDir, cfg.contextName),
+		cfg.packageDataDir(pkgName),
+		filepath.Join(cfg.CacheDir, pkgName),
+	}
+}
+
+// hookEnv returns the env vars provided to a hook script, which describe the package and the
+// lifecycle event so that the same script can be used by different packages
+func (p Package) hookEnv(cfg Config, pkgName string, hook string) map[string]string {
+	var network, networkMagic string
+	if cfg.Template != nil {
+		if contextVars, ok := cfg.Template.baseVars["Context"].(map[string]any); ok {
+			network = fmt.Sprint(contextVars["Network"])
+			networkMagic = fmt.Sprint(contextVars["NetworkMagic"])
+		}
+	}
+	return map[string]string{
+		"CARDANO_UP_EVENT":         hookEvents[hook],
+		"CARDANO_UP_PACKAGE":       p.instanceName(),
+		"CARDANO_UP_PACKAGE_NAME":  pkgName,
+		"CARDANO_UP_VERSION":       p.Version,
+		"CARDANO_UP_CONTEXT":       cfg.contextName,
+		"CARDANO_UP_NETWORK":       network,
+		"CARDANO_UP_NETWORK_MAGIC": networkMagic,
+		"CARDANO_UP_DATA_DIR":      cfg.packageDataDir(pkgName),
+		"CARDANO_UP_CACHE_DIR":     filepath.Join(cfg.CacheDir, pkgName),
+		"CARDANO_UP_CONTEXT_DIR":   filepath.Join(cfg.DataDir, cfg.contextName),
+	}
+}
+
+// runHookScriptHost runs a rendered hook script or command on the host and returns its exit code
+func runHookScriptHost(
+	ctx context.Context,
+	hookCmd hookCommand,
+	output *hookOutput,
+) (int, error) {
+	cmd := exec.CommandContext(ctx, hookCmd.args[0], hookCmd.args[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range hookCmd.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = output.stdout
+	cmd.Stderr = output.stderr
+	killProcessGroup(cmd)
+	// Don't wait forever for background processes started by the script that keep its output open
+	cmd.WaitDelay = hookWaitDelay
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// runHookScriptSandbox runs a rendered hook script or command in a throwaway container with the
+// local Docker daemon, since hook scripts work with the local package dirs even when the context
+// uses a remote Docker host. It returns the exit code of the script
+func (p Package) runHookScriptSandbox(
+	cfg Config,
+	ctx context.Context,
+	pkgName string,
+	hookCmd hookCommand,
+	output *hookOutput,
+) (int, error) {
+	image := cfg.Hooks.SandboxImage
+	if image == "" {
+		image = defaultHookSandboxImage
+	}
+	svc := DockerService{
+		logger:        cfg.Logger,
+		ctx:           cfg.ctx(),
+		retryCfg:      cfg.DockerRetry,
+		oneShot:       true,
+		ContainerName: "cardano-up-hook-" + pkgName,
+		Image:         image,
+		Command:       hookCmd.args[:1],
+		Args:          hookCmd.args[1:],
+		Env:           hookCmd.env,
+	}
+	// Mount the package dirs that exist at the same paths, so that paths in the rendered script
+	// work as-is
+	for _, tmpDir := range hookCmd.dirs {
+		if _, err := os.Stat(tmpDir); err != nil {
+			continue
+		}
+		svc.Binds = append(svc.Binds, tmpDir+":"+tmpDir)
+	}
+	if err := svc.Create(); err != nil {
+		return -1, fmt.Errorf("failed to create hook script container: %s", err)
+	}
+	defer func() {
+		// The container is removed even if the script timed out
+		svc.ctx = cfg.ctx()
+		if err := svc.Remove(); err != nil {
+			cfg.Logger.Warn(
+				fmt.Sprintf("failed to remove container %s: %s", svc.ContainerName, err),
+			)
+		}
+	}()
+	if err := svc.Start(); err != nil {
+		return -1, err
+	}
+	svc.ctx = ctx
+	exitCode, err := svc.Wait()
+	svc.ctx = cfg.ctx()
+	if logsErr := svc.Logs(LogsOptions{Tail: "all"}, output.stdout, output.stderr); logsErr != nil {
+		cfg.Logger.Warn(fmt.Sprintf("failed to get hook script output: %s", logsErr))
+	}
+	if err != nil {
+		return -1, err
+	}
+	return int(exitCode), nil
+}
+
+// hookTrusted returns whether the hook scripts for the package can run without approval. Local
+// packages are always trusted, since they come from the user's own files
+func (p Package) hookTrusted(cfg Config) bool {
+	if cfg.Hooks.TrustAll || p.origin != "" {
+		return true
+	}
+	registry := strings.TrimSuffix(cfg.registrySource(), "/")
+	for _, tmpRegistry := range cfg.Hooks.TrustedRegistries {
+		if strings.TrimSuffix(tmpRegistry, "/") == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// registrySource returns the registry dir or URL that packages are loaded from
+func (c Config) registrySource() string {
+	if c.RegistryDir != "" {
+		return c.RegistryDir
+	}
+	return c.RegistryUrl
+}
+
+// HookResult records a run of a hook script for an installed package
+type HookResult struct {
+	Hook     string
+	Time     time.Time
+	Duration time.Duration
+	// ExitCode is the exit code of the script, or -1 if it was killed or couldn't be run
+	ExitCode int
+	TimedOut bool
+}
+
+// hookOutput sends the output of a hook script to the logger and the package hook log file, with
+// each line prefixed with the package and hook names
+type hookOutput struct {
+	sync.Mutex
+	cfg     Config
+	pkgName string
+	hook    string
+	file    *rotatingFileWriter
+	stdout  *hookLineWriter
+	stderr  *hookLineWriter
+}
+
+func newHookOutput(cfg Config, pkgShortName string, hook string) *hookOutput {
+	ret := &hookOutput{
+		cfg:     cfg,
+		pkgName: pkgShortName,
+		hook:    hook,
+	}
+	ret.stdout = &hookLineWriter{output: ret, stream: "stdout"}
+	ret.stderr = &hookLineWriter{output: ret, stream: "stderr"}
+	logsDir := containerLogsDir(cfg, cfg.contextName, pkgShortName)
+	// The logs dir has already been removed by the time the post-uninstall script runs, unless the
+	// package data is kept
+	if hook == HookPostUninstall {
+		if _, err := os.Stat(logsDir); err != nil {
+			return ret
+		}
+	}
+	if err := os.MkdirAll(logsDir, fs.ModePerm); err != nil {
+		cfg.Logger.Warn(fmt.Sprintf("failed to create hook log dir: %s", err))
+		return ret
+	}
+	maxSize := cfg.ContainerLogs.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultContainerLogsMaxSize
+	}
+	maxFiles := cfg.ContainerLogs.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultContainerLogsMaxFiles
+	}
+	file, err := newRotatingFileWriter(
+		filepath.Join(logsDir, hookLogFilename),
+		maxSize,
+		maxFiles,
+		cfg.ContainerLogs.MaxAge,
+	)
+	if err != nil {
+		cfg.Logger.Warn(fmt.Sprintf("failed to open hook log file: %s", err))
+		return ret
+	}
+	ret.file = file
+	return ret
+}
+
+func (o *hookOutput) writeLine(stream string, line string) {
+	o.Lock()
+	defer o.Unlock()
+	o.cfg.Logger.Info(
+		fmt.Sprintf("[%s %s] %s", o.pkgName, o.hook, line),
+		EventAttr(EventHookOutput),
+		slog.String("package", o.pkgName),
+		slog.String("hook", o.hook),
+		slog.String("stream", stream),
+	)
+	if o.file != nil {
+		fmt.Fprintf(
+			o.file,
+			"%s [%s %s] %s\n",
+			time.Now().Format(time.RFC3339),
+			o.hook,
+			stream,
+			line,
+		)
+	}
+}
+
+// Close writes any remaining partial lines and closes the hook log file
+func (o *hookOutput) Close() {
+	o.stdout.flush()
+	o.stderr.flush()
+	if o.file != nil {
+		if err := o.file.Close(); err != nil {
+			o.cfg.Logger.Warn(fmt.Sprintf("failed to close hook log file: %s", err))
+		}
+	}
+}
+
+// hookLineWriter splits the output of a hook script stream into lines
+type hookLineWriter struct {
+	output *hookOutput
+	stream string
+	buf    []byte
+}
+
+func (w *hookLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.output.writeLine(w.stream, strings.TrimRight(string(w.buf[:idx]), "\r"))
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (w *hookLineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.output.writeLine(w.stream, strings.TrimRight(string(w.buf), "\r"))
+		w.buf = nil
+	}
+}
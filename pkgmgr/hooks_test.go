@@ -0,0 +1,219 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackageHookTrusted(t *testing.T) {
+	testDefs := []struct {
+		Package Package
+		Hooks   HookConfig
+		Trusted bool
+	}{
+		{
+			Package: Package{},
+		},
+		{
+			Package: Package{origin: "/path/to/package"},
+			Trusted: true,
+		},
+		{
+			Package: Package{},
+			Hooks:   HookConfig{TrustAll: true},
+			Trusted: true,
+		},
+		{
+			Package: Package{},
+			Hooks: HookConfig{
+				TrustedRegistries: []string{"https://registry.example.com/packages.zip/"},
+			},
+			Trusted: true,
+		},
+		{
+			Package: Package{},
+			Hooks: HookConfig{
+				TrustedRegistries: []string{"https://other.example.com/packages.zip"},
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		cfg := Config{
+			RegistryUrl: "https://registry.example.com/packages.zip",
+			Hooks:       testDef.Hooks,
+		}
+		if ret := testDef.Package.hookTrusted(cfg); ret != testDef.Trusted {
+			t.Fatalf(
+				"did not get expected result for package %#v with hook config %#v: got %v",
+				testDef.Package,
+				testDef.Hooks,
+				ret,
+			)
+		}
+	}
+}
+
+func TestPackageRunHookScriptApproval(t *testing.T) {
+	tmpDir := t.TempDir()
+	outFile := filepath.Join(tmpDir, "hook.out")
+	var approvedScript HookScript
+	approve := false
+	cfg := Config{
+		DataDir:     tmpDir,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		RegistryUrl: "https://registry.example.com/packages.zip",
+		Template:    NewTemplate(map[string]any{"OutFile": outFile}),
+		Hooks: HookConfig{
+			Approve: func(script HookScript) (bool, error) {
+				approvedScript = script
+				return approve, nil
+			},
+		},
+	}
+	pkg := Package{Name: "foo", Version: "1.0.0"}
+	script := "echo ran > {{ .OutFile }}"
+	if err := pkg.runHookScript(cfg, "foo-1.0.0-default", HookPreInstall, script); err == nil {
+		t.Fatalf("did not get expected error for hook script that wasn't approved")
+	}
+	if _, err := os.Stat(outFile); err == nil {
+		t.Fatalf("hook script ran without approval")
+	}
+	expectedScript := HookScript{
+		Package:  "foo-1.0.0-default",
+		Hook:     HookPreInstall,
+		Script:   "echo ran > " + outFile,
+		Registry: cfg.RegistryUrl,
+	}
+	if approvedScript != expectedScript {
+		t.Fatalf(
+			"did not get expected hook script\n  got: %#v\n  expected: %#v",
+			approvedScript,
+			expectedScript,
+		)
+	}
+	approve = true
+	if err := pkg.runHookScript(cfg, "foo-1.0.0-default", HookPreInstall, script); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(outFile); err != nil {
+		t.Fatalf("hook script did not run: %s", err)
+	}
+	// Hook scripts aren't run without a way to approve them
+	cfg.Hooks.Approve = nil
+	if err := pkg.runHookScript(cfg, "foo-1.0.0-default", HookPostInstall, script); err == nil {
+		t.Fatalf("did not get expected error for hook script without approval")
+	}
+}
+
+func TestPackageRunHookScriptOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	var logBuf bytes.Buffer
+	var hookResults []HookResult
+	cfg := Config{
+		DataDir:     tmpDir,
+		Logger:      slog.New(slog.NewTextHandler(&logBuf, nil)),
+		Template:    NewTemplate(nil),
+		Hooks:       HookConfig{TrustAll: true},
+		contextName: "default",
+		hookResults: &hookResults,
+	}
+	pkg := Package{Name: "foo", Version: "1.0.0"}
+	err := pkg.runHookScript(
+		cfg,
+		"foo-1.0.0-default",
+		HookPostInstall,
+		"echo out; echo err >&2; exit 3",
+	)
+	if err == nil {
+		t.Fatalf("did not get expected error for failed hook script")
+	}
+	if len(hookResults) != 1 || hookResults[0].ExitCode != 3 || hookResults[0].TimedOut {
+		t.Fatalf("did not get expected hook results: %#v", hookResults)
+	}
+	logOutput := logBuf.String()
+	for _, expected := range []string{"[foo postInstallScript] out", "[foo postInstallScript] err"} {
+		if !strings.Contains(logOutput, expected) {
+			t.Fatalf("did not find %q in log output: %s", expected, logOutput)
+		}
+	}
+	logFile, err := os.ReadFile(
+		filepath.Join(containerLogsDir(cfg, "default", "foo"), hookLogFilename),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, expected := range []string{"[postInstallScript stdout] out", "[postInstallScript stderr] err"} {
+		if !strings.Contains(string(logFile), expected) {
+			t.Fatalf("did not find %q in hook log file: %s", expected, logFile)
+		}
+	}
+	// Hook scripts that run too long are killed
+	cfg.Hooks.Timeout = 100 * time.Millisecond
+	startTime := time.Now()
+	err = pkg.runHookScript(cfg, "foo-1.0.0-default", HookPostInstall, "sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "did not finish") {
+		t.Fatalf("did not get expected timeout error: %v", err)
+	}
+	if time.Since(startTime) > 3*time.Second {
+		t.Fatalf("hook script was not killed after timeout")
+	}
+	if len(hookResults) != 2 || !hookResults[1].TimedOut {
+		t.Fatalf("did not get expected hook results: %#v", hookResults)
+	}
+}
+
+func TestPackageRunHookScriptEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	var logBuf bytes.Buffer
+	cfg := Config{
+		CacheDir: filepath.Join(tmpDir, "cache"),
+		DataDir:  filepath.Join(tmpDir, "data"),
+		Logger:   slog.New(slog.NewTextHandler(&logBuf, nil)),
+		Template: NewTemplate(
+			map[string]any{
+				"Context": Context{Network: "preview", NetworkMagic: 2}.templateVars("default"),
+			},
+		),
+		Hooks:       HookConfig{TrustAll: true},
+		contextName: "default",
+	}
+	pkg := Package{Name: "foo", Version: "1.0.0"}
+	err := pkg.runHookScript(
+		cfg,
+		"foo-1.0.0-default",
+		HookPreUninstall,
+		`echo "$CARDANO_UP_EVENT $CARDANO_UP_PACKAGE $CARDANO_UP_VERSION $CARDANO_UP_CONTEXT $CARDANO_UP_NETWORK $CARDANO_UP_NETWORK_MAGIC"; echo "$CARDANO_UP_DATA_DIR"`,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logOutput := logBuf.String()
+	for _, expected := range []string{
+		"pre-uninstall foo 1.0.0 default preview 2",
+		filepath.Join(cfg.DataDir, "foo-1.0.0-default"),
+	} {
+		if !strings.Contains(logOutput, expected) {
+			t.Fatalf("did not find %q in log output: %s", expected, logOutput)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Firewalls that FirewallRules can generate rules for
+const (
+	FirewallUfw       = "ufw"
+	FirewallFirewalld = "firewalld"
+	FirewallIptables  = "iptables"
+)
+
+// firewallTypes are the supported firewalls for generating rules to allow public ports
+var firewallTypes = []string{FirewallUfw, FirewallFirewalld, FirewallIptables}
+
+// HostPort is a host port claimed by an installed package, either allocated with freePort or
+// published by one of its containers
+type HostPort struct {
+	Port     int
+	Protocol string
+	Context  string
+	// Package is the instance name of the package that the port is claimed by
+	Package string
+	// Container is the short name of the container that publishes the port, or empty if the port
+	// is allocated but not published by any container
+	Container     string
+	ContainerPort int
+	// Public is whether the port needs to be reachable from other hosts, such as for node P2P
+	// connections
+	Public bool
+	// Conflicts describes problems with the port, such as being claimed by more than one package
+	Conflicts []string
+}
+
+// Owner returns the context and package instance name that the port is claimed by
+func (h HostPort) Owner() string {
+	if h.Context == "" {
+		return h.Package
+	}
+	return h.Context + "/" + h.Package
+}
+
+// HostPorts returns the host ports claimed by the installed packages in all contexts, sorted by
+// port. Ports that are claimed by more than one package, or that are still allocated to a package
+// that isn't installed, are reported as conflicts
+func (p *PackageManager) HostPorts() []HostPort {
+	var ret []HostPort
+	// Ports published by the containers of each installed package
+	ownerPorts := make(map[string][]HostPort)
+	for _, installedPkg := range p.state.InstalledPackages {
+		owner := portOwner(installedPkg.Package, installedPkg.Context)
+		ownerPorts[owner] = p.publishedPorts(installedPkg)
+		ret = append(ret, ownerPorts[owner]...)
+	}
+	// Ports allocated with freePort that aren't published by a container
+	for owner, allocatedPorts := range p.state.Ports {
+		published, installed := ownerPorts[owner]
+		for _, hostPort := range allocatedPorts {
+			if hostPortsContain(published, hostPort) {
+				continue
+			}
+			tmpPort := HostPort{
+				Port:     hostPort,
+				Protocol: "tcp",
+				Package:  owner,
+			}
+			if idx := strings.LastIndex(owner, "/"); idx >= 0 {
+				tmpPort.Context = owner[:idx]
+				tmpPort.Package = owner[idx+1:]
+			}
+			if !installed {
+				tmpPort.Conflicts = append(
+					tmpPort.Conflicts,
+					"allocated to a package that isn't installed",
+				)
+			}
+			ret = append(ret, tmpPort)
+		}
+	}
+	addHostPortConflicts(ret)
+	sort.SliceStable(
+		ret,
+		func(i, j int) bool {
+			if ret[i].Port != ret[j].Port {
+				return ret[i].Port < ret[j].Port
+			}
+			return ret[i].Owner() < ret[j].Owner()
+		},
+	)
+	return ret
+}
+
+// publishedPorts returns the host ports published by the containers of an installed package,
+// from the port mappings in its install steps. Ports that can't be rendered are skipped
+func (p *PackageManager) publishedPorts(installedPkg InstalledPackage) []HostPort {
+	var ret []HostPort
+	cfg := p.config
+	cfg.Template = p.installedPackageTemplate(installedPkg)
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		installedPkg.InstanceName(),
+		installedPkg.Package.Version,
+		installedPkg.Context,
+	)
+	providesNodeSocket := false
+	for _, socket := range installedPkg.Package.Sockets {
+		if socket.Name == nodeSocketName {
+			providesNodeSocket = true
+		}
+	}
+	for _, step := range installedPkg.Package.containerSteps(cfg, pkgName) {
+		if step.PullOnly {
+			continue
+		}
+		containerName := fmt.Sprintf("%s-%s", pkgName, step.ContainerName)
+		for _, port := range step.Ports {
+			tmpPort := port
+			if !step.rendered {
+				var err error
+				tmpPort, err = cfg.Template.Render(port, containerTemplateVars(containerName))
+				if err != nil {
+					p.config.Logger.Debug(
+						fmt.Sprintf("failed to render port %q for %s: %s", port, pkgName, err),
+					)
+					continue
+				}
+			}
+			tmpPort, protocol, ok := strings.Cut(tmpPort, "/")
+			if !ok {
+				protocol = "tcp"
+			}
+			containerPortStr, hostPortStr := parsePortMapping(tmpPort)
+			hostPort, err := strconv.Atoi(hostPortStr)
+			if err != nil {
+				continue
+			}
+			containerPort, err := strconv.Atoi(containerPortStr)
+			if err != nil {
+				continue
+			}
+			ret = append(
+				ret,
+				HostPort{
+					Port:          hostPort,
+					Protocol:      protocol,
+					Context:       installedPkg.Context,
+					Package:       installedPkg.InstanceName(),
+					Container:     step.ContainerName,
+					ContainerPort: containerPort,
+					Public: providesNodeSocket && step.usesSocket(nodeSocketName) &&
+						containerPort == nodeP2PContainerPort,
+				},
+			)
+		}
+	}
+	return ret
+}
+
+func hostPortsContain(ports []HostPort, port int) bool {
+	for _, tmpPort := range ports {
+		if tmpPort.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// addHostPortConflicts adds a conflict to each port with the same port number and protocol as a
+// port claimed by another package
+func addHostPortConflicts(ports []HostPort) {
+	for i := range ports {
+		for j := range ports {
+			if ports[i].Port != ports[j].Port || ports[i].Protocol != ports[j].Protocol ||
+				ports[i].Owner() == ports[j].Owner() {
+				continue
+			}
+			ports[i].Conflicts = append(
+				ports[i].Conflicts,
+				"also claimed by "+ports[j].Owner(),
+			)
+		}
+	}
+}
+
+// FirewallRules returns the commands for the specified firewall that allow incoming connections to
+// the public ports, such as for node P2P connections. Supported firewalls are ufw, firewalld, and
+// iptables
+func FirewallRules(ports []HostPort, firewall string) ([]string, error) {
+	supported := false
+	for _, tmpFirewall := range firewallTypes {
+		if tmpFirewall == firewall {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, NewUnknownFirewallError(firewall, firewallTypes)
+	}
+	var ret []string
+	seen := make(map[string]bool)
+	for _, port := range ports {
+		if !port.Public {
+			continue
+		}
+		portProto := fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		if seen[portProto] {
+			continue
+		}
+		seen[portProto] = true
+		switch firewall {
+		case FirewallUfw:
+			ret = append(
+				ret,
+				fmt.Sprintf("ufw allow %s comment 'cardano-up %s'", portProto, port.Owner()),
+			)
+		case FirewallFirewalld:
+			ret = append(ret, "firewall-cmd --permanent --add-port="+portProto)
+		case FirewallIptables:
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"iptables -A INPUT -p %s --dport %d -j ACCEPT",
+					port.Protocol,
+					port.Port,
+				),
+			)
+		}
+	}
+	if firewall == FirewallFirewalld && len(ret) > 0 {
+		ret = append(ret, "firewall-cmd --reload")
+	}
+	return ret, nil
+}
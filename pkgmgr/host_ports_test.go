@@ -0,0 +1,176 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHostPorts(t *testing.T) {
+	tmpDir := t.TempDir()
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: filepath.Join(tmpDir, "config"),
+			DataDir:   filepath.Join(tmpDir, "data"),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "cardano-node",
+				Version: "1.0.0",
+				Sockets: []PackageSocket{{Name: nodeSocketName}},
+				InstallSteps: []PackageInstallStep{
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "node",
+							Sockets:       []string{nodeSocketName},
+							Ports: []string{
+								"0.0.0.0:{{ freePort 3001 }}:3001",
+								"12798",
+							},
+						},
+					},
+				},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:    "ogmios",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "ogmios",
+							Ports:         []string{"12798:1337/udp"},
+						},
+					},
+				},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	pm.state.Ports = PortRegistry{
+		activeContextName + "/cardano-node": {3001: 3002},
+		activeContextName + "/kupo":         {1442: 1442},
+	}
+	expected := []HostPort{
+		{
+			Port:      1442,
+			Protocol:  "tcp",
+			Context:   activeContextName,
+			Package:   "kupo",
+			Conflicts: []string{"allocated to a package that isn't installed"},
+		},
+		{
+			Port:          3002,
+			Protocol:      "tcp",
+			Context:       activeContextName,
+			Package:       "cardano-node",
+			Container:     "node",
+			ContainerPort: 3001,
+			Public:        true,
+		},
+		{
+			Port:          12798,
+			Protocol:      "tcp",
+			Context:       activeContextName,
+			Package:       "cardano-node",
+			Container:     "node",
+			ContainerPort: 12798,
+		},
+		{
+			Port:          12798,
+			Protocol:      "udp",
+			Context:       activeContextName,
+			Package:       "ogmios",
+			Container:     "ogmios",
+			ContainerPort: 1337,
+		},
+	}
+	ports := pm.HostPorts()
+	if !reflect.DeepEqual(ports, expected) {
+		t.Fatalf(
+			"did not get expected host ports:\n  got:      %#v\n  expected: %#v",
+			ports,
+			expected,
+		)
+	}
+	// The same port and protocol for different packages is a conflict
+	pm.state.InstalledPackages[1].Package.InstallSteps[0].Docker.Ports = []string{"12798:1337"}
+	ports = pm.HostPorts()
+	expectedConflict := "also claimed by " + activeContextName + "/ogmios"
+	if len(ports[2].Conflicts) != 1 || ports[2].Conflicts[0] != expectedConflict {
+		t.Fatalf("did not get expected conflicts: got %v", ports[2].Conflicts)
+	}
+}
+
+func TestFirewallRules(t *testing.T) {
+	ports := []HostPort{
+		{Port: 3002, Protocol: "tcp", Context: "preview", Package: "cardano-node", Public: true},
+		{Port: 12798, Protocol: "tcp", Context: "preview", Package: "cardano-node"},
+	}
+	testDefs := []struct {
+		firewall string
+		expected []string
+	}{
+		{
+			firewall: FirewallUfw,
+			expected: []string{"ufw allow 3002/tcp comment 'cardano-up preview/cardano-node'"},
+		},
+		{
+			firewall: FirewallFirewalld,
+			expected: []string{
+				"firewall-cmd --permanent --add-port=3002/tcp",
+				"firewall-cmd --reload",
+			},
+		},
+		{
+			firewall: FirewallIptables,
+			expected: []string{"iptables -A INPUT -p tcp --dport 3002 -j ACCEPT"},
+		},
+	}
+	for _, testDef := range testDefs {
+		rules, err := FirewallRules(ports, testDef.firewall)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(rules, testDef.expected) {
+			t.Fatalf(
+				"did not get expected rules for %s: got %v, expected %v",
+				testDef.firewall,
+				rules,
+				testDef.expected,
+			)
+		}
+	}
+	if _, err := FirewallRules(nil, "pf"); err == nil {
+		t.Fatalf("did not get expected error for unknown firewall")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	defaultHttpTimeout      = 5 * time.Minute
+	defaultHttpRetries      = 3
+	defaultHttpRetryBackoff = 1 * time.Second
+)
+
+// HttpConfig holds settings for the HTTP client used for registry fetches and file downloads
+type HttpConfig struct {
+	// ProxyUrl overrides the proxy from the standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY env vars
+	ProxyUrl string
+	// CaBundle is the path to a PEM file with extra CA certificates to trust
+	CaBundle string
+	// Timeout is the overall timeout for a single request
+	Timeout time.Duration
+	// Retries is the number of times to retry a failed request
+	Retries int
+	// RetryBackoff is the initial delay between retries, which doubles on each attempt
+	RetryBackoff time.Duration
+}
+
+func newHttpClient(cfg HttpConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(cfg.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %s", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	if cfg.CaBundle != "" {
+		caData, err := os.ReadFile(cfg.CaBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %s", err)
+		}
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf(
+				"no certificates found in CA bundle %s",
+				cfg.CaBundle,
+			)
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    certPool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultHttpTimeout
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// httpDo performs the request using a client built from the provided config, retrying with
+// exponential backoff on network errors and server-side (5xx) failures. If every attempt fails
+// with a network error, the returned error includes the error from each attempt
+func httpDo(cfg Config, req *http.Request) (*http.Response, error) {
+	client, err := newHttpClient(cfg.Http)
+	if err != nil {
+		return nil, err
+	}
+	retries := cfg.Http.Retries
+	if retries < 0 {
+		retries = 0
+	}
+	backoff := cfg.Http.RetryBackoff
+	if backoff == 0 {
+		backoff = defaultHttpRetryBackoff
+	}
+	var resp *http.Response
+	var errs []error
+	for attempt := 0; ; attempt++ {
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if err != nil {
+			// Don't bother retrying on certificate errors
+			if certErr := httpCertError(err); certErr != nil {
+				return nil, certErr
+			}
+			errs = append(errs, err)
+		} else {
+			errs = append(errs, fmt.Errorf("server returned %s", resp.Status))
+		}
+		if attempt >= retries {
+			break
+		}
+		if err != nil {
+			cfg.Logger.Debug(
+				fmt.Sprintf(
+					"request to %s failed, retrying in %s: %s",
+					req.URL,
+					backoff,
+					err,
+				),
+			)
+		} else {
+			cfg.Logger.Debug(
+				fmt.Sprintf(
+					"request to %s returned %s, retrying in %s",
+					req.URL,
+					resp.Status,
+					backoff,
+				),
+			)
+			resp.Body.Close()
+		}
+		// Wait for the backoff, giving up early if the request is cancelled
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		// Rewind the request body for the next attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+	if err != nil {
+		if len(errs) > 1 {
+			return nil, NewRetriesExhaustedError(
+				fmt.Sprintf("request to %s", req.URL),
+				errs,
+			)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// httpCertError returns a more helpful error when a request fails due to certificate validation
+func httpCertError(err error) error {
+	var unknownAuthErr x509.UnknownAuthorityError
+	var certInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &certInvalidErr) ||
+		errors.As(err, &hostnameErr) {
+		return NewHttpCertificateError(err)
+	}
+	return nil
+}
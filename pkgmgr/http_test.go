@@ -0,0 +1,91 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpDoRetry(t *testing.T) {
+	var requestCount int
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestCount++
+			if requestCount < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer server.Close()
+	cfg := Config{
+		Logger: slog.Default(),
+		Http: HttpConfig{
+			Retries:      2,
+			RetryBackoff: time.Millisecond,
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp, err := httpDo(cfg, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("did not get expected status: got %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	if requestCount != 3 {
+		t.Fatalf("did not get expected request count: got %d, expected %d", requestCount, 3)
+	}
+}
+
+func TestHttpDoRetryCancel(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	)
+	defer server.Close()
+	cfg := Config{
+		Logger: slog.Default(),
+		Http: HttpConfig{
+			Retries:      5,
+			RetryBackoff: time.Minute,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	start := time.Now()
+	if _, err := httpDo(cfg, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("retry backoff did not stop when the request was cancelled")
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// maxManifestSize is the maximum size of an image manifest or index read from a registry
+	maxManifestSize = 4 * 1024 * 1024
+
+	dockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// imageDownloadSize returns the compressed size of the layers and config of an image for the
+// given platform, as reported by its registry. Only anonymous access to the registry is supported
+func imageDownloadSize(cfg Config, imageName string, platform ocispec.Platform) (uint64, error) {
+	if cfg.Offline {
+		return 0, ErrOffline
+	}
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return 0, err
+	}
+	named = reference.TagNameOnly(named)
+	manifestRef := ""
+	if digested, ok := named.(reference.Digested); ok {
+		manifestRef = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		manifestRef = tagged.Tag()
+	}
+	registry := &imageRegistry{
+		cfg:  cfg,
+		host: reference.Domain(named),
+		repo: reference.Path(named),
+	}
+	manifest, err := registry.manifest(manifestRef)
+	if err != nil {
+		return 0, err
+	}
+	if manifest.MediaType == ocispec.MediaTypeImageIndex ||
+		manifest.MediaType == dockerManifestListMediaType {
+		platformDigest := ""
+		var platforms []ocispec.Platform
+		for _, tmpManifest := range manifest.Manifests {
+			if tmpManifest.Platform == nil {
+				continue
+			}
+			platforms = append(platforms, *tmpManifest.Platform)
+			if platformDigest == "" && imageHasPlatform(
+				manifest.MediaType,
+				[]ocispec.Platform{*tmpManifest.Platform},
+				platform,
+			) {
+				platformDigest = tmpManifest.Digest.String()
+			}
+		}
+		if platformDigest == "" {
+			return 0, NewImagePlatformNotFoundError(
+				imageName,
+				platformString(platform),
+				platformStrings(platforms),
+			)
+		}
+		manifest, err = registry.manifest(platformDigest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	ret := uint64(0)
+	if manifest.Config.Size > 0 {
+		ret += uint64(manifest.Config.Size)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.Size > 0 {
+			ret += uint64(layer.Size)
+		}
+	}
+	return ret, nil
+}
+
+// registryManifest holds the fields of an image manifest or index that are needed to determine
+// the image size
+type registryManifest struct {
+	MediaType string               `json:"mediaType"`
+	Manifests []ocispec.Descriptor `json:"manifests"`
+	Config    ocispec.Descriptor   `json:"config"`
+	Layers    []ocispec.Descriptor `json:"layers"`
+}
+
+// imageRegistry fetches manifests for a repository from an image registry using the registry
+// HTTP API, with an anonymous bearer token when the registry requires one
+type imageRegistry struct {
+	cfg   Config
+	host  string
+	repo  string
+	token string
+}
+
+func (r *imageRegistry) baseUrl() string {
+	host := r.host
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	// Docker allows plain HTTP for registries on the local host
+	scheme := "https"
+	hostname := strings.Split(host, ":")[0]
+	if hostname == "localhost" || hostname == "127.0.0.1" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
+
+func (r *imageRegistry) manifest(ref string) (registryManifest, error) {
+	manifestUrl := fmt.Sprintf("%s/v2/%s/manifests/%s", r.baseUrl(), r.repo, ref)
+	resp, err := r.get(manifestUrl)
+	if err != nil {
+		return registryManifest{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		if err := r.authenticate(resp.Header.Get("Www-Authenticate")); err != nil {
+			return registryManifest{}, err
+		}
+		resp.Body.Close()
+		resp, err = r.get(manifestUrl)
+		if err != nil {
+			return registryManifest{}, err
+		}
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return registryManifest{}, fmt.Errorf(
+			"failed to fetch manifest %s for %s/%s: %s",
+			ref,
+			r.host,
+			r.repo,
+			resp.Status,
+		)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return registryManifest{}, err
+	}
+	var ret registryManifest
+	if err := json.Unmarshal(body, &ret); err != nil {
+		return registryManifest{}, err
+	}
+	// The media type may only be provided in the response header
+	if ret.MediaType == "" {
+		ret.MediaType = strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+	}
+	return ret, nil
+}
+
+func (r *imageRegistry) get(reqUrl string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.cfg.ctx(), http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(
+		"Accept",
+		strings.Join(
+			[]string{
+				ocispec.MediaTypeImageIndex,
+				ocispec.MediaTypeImageManifest,
+				dockerManifestListMediaType,
+				dockerManifestMediaType,
+			},
+			", ",
+		),
+	)
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return httpDo(r.cfg, req)
+}
+
+// authenticate gets an anonymous bearer token for pulling from the repository, using the
+// challenge from the registry
+func (r *imageRegistry) authenticate(challenge string) error {
+	params, ok := parseBearerChallenge(challenge)
+	if !ok || params["realm"] == "" {
+		return errors.New("registry requires unsupported authentication")
+	}
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil {
+		return err
+	}
+	query := tokenUrl.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.repo)
+	}
+	query.Set("scope", scope)
+	tokenUrl.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(r.cfg.ctx(), http.MethodGet, tokenUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpDo(r.cfg, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+	var tmpToken struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize))
+	if err := decoder.Decode(&tmpToken); err != nil {
+		return err
+	}
+	r.token = tmpToken.Token
+	if r.token == "" {
+		r.token = tmpToken.AccessToken
+	}
+	if r.token == "" {
+		return errors.New("registry did not return a token")
+	}
+	return nil
+}
+
+// parseBearerChallenge parses the parameters from a WWW-Authenticate header value for bearer
+// authentication, such as `Bearer realm="https://auth.example.com/token",service="example"`
+func parseBearerChallenge(challenge string) (map[string]string, bool) {
+	scheme, paramsStr, ok := strings.Cut(strings.TrimSpace(challenge), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, false
+	}
+	ret := make(map[string]string)
+	for paramsStr != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(paramsStr, " ,"), "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			endIdx := strings.Index(rest[1:], `"`)
+			if endIdx < 0 {
+				return nil, false
+			}
+			val = rest[1 : endIdx+1]
+			rest = rest[endIdx+2:]
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		ret[strings.ToLower(strings.TrimSpace(key))] = val
+		paramsStr = rest
+	}
+	return ret, true
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newTestRegistry returns a registry that serves a multi-platform image, which requires a bearer
+// token from the registry's token endpoint
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				if r.URL.Query().Get("scope") != "repository:example/node:pull" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, `{"token": "test-token"}`)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.Header().Set(
+					"Www-Authenticate",
+					fmt.Sprintf(
+						`Bearer realm="%s/token",service="test",scope="repository:example/node:pull"`,
+						server.URL,
+					),
+				)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.URL.Path {
+			case "/v2/example/node/manifests/1.0.0":
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+				fmt.Fprint(
+					w,
+					`{"manifests": [
+						{"digest": "sha256:aaaa", "platform": {"os": "linux", "architecture": "amd64"}},
+						{"digest": "sha256:bbbb", "platform": {"os": "linux", "architecture": "arm64"}}
+					]}`,
+				)
+			case "/v2/example/node/manifests/sha256:aaaa":
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+				fmt.Fprint(
+					w,
+					`{"config": {"size": 100}, "layers": [{"size": 1000}, {"size": 2000}]}`,
+				)
+			case "/v2/example/node/manifests/sha256:bbbb":
+				w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+				fmt.Fprint(w, `{"config": {"size": 200}, "layers": [{"size": 4000}]}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+	)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestImageDownloadSize(t *testing.T) {
+	server := newTestRegistry(t)
+	registryHost := strings.TrimPrefix(server.URL, "http://")
+	cfg := Config{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	testDefs := []struct {
+		image         string
+		platform      ocispec.Platform
+		expectedSize  uint64
+		expectedError bool
+	}{
+		{
+			image:        registryHost + "/example/node:1.0.0",
+			platform:     ocispec.Platform{OS: "linux", Architecture: "amd64"},
+			expectedSize: 3100,
+		},
+		{
+			image:        registryHost + "/example/node:1.0.0",
+			platform:     ocispec.Platform{OS: "linux", Architecture: "arm64"},
+			expectedSize: 4200,
+		},
+		{
+			image:         registryHost + "/example/node:1.0.0",
+			platform:      ocispec.Platform{OS: "linux", Architecture: "riscv64"},
+			expectedError: true,
+		},
+		{
+			image:         registryHost + "/example/node:2.0.0",
+			platform:      ocispec.Platform{OS: "linux", Architecture: "amd64"},
+			expectedError: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		size, err := imageDownloadSize(cfg, testDef.image, testDef.platform)
+		if testDef.expectedError {
+			if err == nil {
+				t.Fatalf("did not get expected error for %s", platformString(testDef.platform))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if size != testDef.expectedSize {
+			t.Fatalf(
+				"did not get expected size for %s: got %d, expected %d",
+				platformString(testDef.platform),
+				size,
+				testDef.expectedSize,
+			)
+		}
+	}
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+	params, ok := parseBearerChallenge(
+		`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"`,
+	)
+	if !ok {
+		t.Fatalf("failed to parse challenge")
+	}
+	if params["realm"] != "https://auth.docker.io/token" ||
+		params["service"] != "registry.docker.io" ||
+		params["scope"] != "repository:library/ubuntu:pull" {
+		t.Fatalf("did not get expected params: %#v", params)
+	}
+	if _, ok := parseBearerChallenge(`Basic realm="registry"`); ok {
+		t.Fatalf("did not expect basic challenge to be parsed")
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ImportContainer records an existing container, such as one created by hand with 'docker run', as
+// an installed package in the active context, so that it can be managed like any other package.
+// The package must have a single container, which the existing container is renamed to match.
+// Differences between the container and the package, such as the image or bind mounts, are logged
+// as warnings. When no version is specified for the package, the version with an image matching
+// the container is used if there is one. The other install steps of the package are not run
+func (p *PackageManager) ImportContainer(
+	containerName string,
+	pkg string,
+) (InstalledPackage, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	existing, err := newDockerService(p.config, containerName)
+	if err != nil {
+		if err == ErrContainerNotExists {
+			return InstalledPackage{}, NewImportContainerNotFoundError(containerName)
+		}
+		return InstalledPackage{}, err
+	}
+	availablePkgs := p.availablePackagesWithLocal()
+	pkg = p.importPackageSpec(availablePkgs, activeContextName, pkg, existing.Image)
+	installPkgs, err := p.resolveInstall(availablePkgs, "", pkg)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	installPkg := installPkgs[len(installPkgs)-1]
+	if len(installPkgs) > 1 {
+		var deps []string
+		for _, depPkg := range installPkgs[:len(installPkgs)-1] {
+			deps = append(deps, depPkg.Install.instanceName())
+		}
+		return InstalledPackage{}, NewImportDependenciesNotInstalledError(
+			installPkg.Install.instanceName(),
+			deps,
+		)
+	}
+	pkgOpts, err := installPkg.Install.resolveOpts(installPkg.Options)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	cfg, err := p.installConfig(installPkg.Install, activeContextName, nil, nil)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	cfg.Template = cfg.Template.WithVars(
+		installPkg.Install.templateVars(cfg, activeContextName, pkgOpts),
+	)
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		installPkg.Install.instanceName(),
+		installPkg.Install.Version,
+		activeContextName,
+	)
+	step, err := installPkg.Install.importStep(cfg, pkgName)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	// Keep the host ports that the container already uses, rather than allocating new ones
+	p.state.Ports.claim(
+		portOwner(installPkg.Install, activeContextName),
+		containerHostPorts(existing.Ports),
+	)
+	svc, err := step.render(cfg, pkgName)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	mismatches, err := step.mismatches(cfg, pkgName, existing, svc)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	for _, mismatch := range mismatches {
+		p.config.Logger.Warn(
+			fmt.Sprintf(
+				"container %s differs from package %s: %s",
+				containerName,
+				installPkg.Install.instanceName(),
+				mismatch,
+			),
+		)
+	}
+	if existing.ContainerName != svc.ContainerName {
+		if _, err := newDockerService(cfg, svc.ContainerName); err == nil {
+			return InstalledPackage{}, fmt.Errorf(
+				"%w: %s",
+				ErrContainerAlreadyExists,
+				svc.ContainerName,
+			)
+		} else if err != ErrContainerNotExists {
+			return InstalledPackage{}, err
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf(
+				"Renaming container %s to %s",
+				existing.ContainerName,
+				svc.ContainerName,
+			),
+		)
+		if err := existing.rename(svc.ContainerName); err != nil {
+			return InstalledPackage{}, err
+		}
+	}
+	for _, tmpDir := range []string{
+		filepath.Join(cfg.CacheDir, pkgName),
+		filepath.Join(cfg.DataDir, activeContextName),
+		cfg.packageDataDir(pkgName),
+	} {
+		if err := os.MkdirAll(tmpDir, fs.ModePerm); err != nil {
+			return InstalledPackage{}, err
+		}
+	}
+	// Render the outputs and notes as for an install
+	portVars, err := installPkg.Install.portTemplateVars(cfg, pkgName, activeContextName)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	cfg.Template = cfg.Template.WithVars(portVars)
+	outputs, err := installPkg.Install.renderOutputs(cfg, activeContextName)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	var notes string
+	if installPkg.Install.PostInstallNotes != "" {
+		notes, err = cfg.Template.Render(installPkg.Install.PostInstallNotes, nil)
+		if err != nil {
+			return InstalledPackage{}, err
+		}
+	}
+	pkgNotes, err := installPkg.Install.renderNotes(cfg)
+	if err != nil {
+		return InstalledPackage{}, err
+	}
+	installedPkg := NewInstalledPackage(
+		installPkg.Install,
+		activeContextName,
+		notes,
+		outputs,
+		pkgOpts,
+	)
+	installedPkg.Notes = pkgNotes
+	installedPkg.Explicit = true
+	p.state.InstalledPackages = append(p.state.InstalledPackages, installedPkg)
+	if err := p.state.Save(); err != nil {
+		return InstalledPackage{}, err
+	}
+	if err := p.activatePackage(p.config, installPkg.Install, activeContextName); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to activate package: %s", err),
+		)
+	}
+	if err := p.refreshEnvFiles(activeContextName); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to update env files: %s", err),
+		)
+	}
+	if tmpNotes := notesOutput(notes, pkgNotes); tmpNotes != "" {
+		p.config.Logger.Info(
+			fmt.Sprintf(
+				"\nPost-install notes for %s (= %s):\n\n%s\n",
+				installPkg.Install.instanceName(),
+				installPkg.Install.Version,
+				tmpNotes,
+			),
+			EventAttr(EventPackageNotes),
+		)
+	}
+	return installedPkg, nil
+}
+
+// importPackageSpec returns the package spec to import a container as. A spec without a version
+// gets the newest available version of the package whose image matches the container image, if
+// any, and is otherwise returned as-is so that the latest version is used
+func (p *PackageManager) importPackageSpec(
+	availablePkgs []Package,
+	context string,
+	pkg string,
+	image string,
+) string {
+	resolver := &Resolver{}
+	pkgName, pkgVersionSpec, _ := resolver.splitPackage(pkg)
+	if pkgVersionSpec != "" {
+		return pkg
+	}
+	var matchingPkgs []Package
+	for _, availablePkg := range availablePkgs {
+		if availablePkg.Name != pkgName {
+			continue
+		}
+		tmpl := p.config.Template.WithVars(
+			availablePkg.templateVars(p.config, context, availablePkg.defaultOpts()),
+		)
+		tmpPkgName := fmt.Sprintf(
+			"%s-%s-%s",
+			availablePkg.instanceName(),
+			availablePkg.Version,
+			context,
+		)
+		for _, step := range availablePkg.containerSteps(p.config, tmpPkgName) {
+			if step.PullOnly {
+				continue
+			}
+			tmpImage, err := tmpl.Render(step.Image, nil)
+			if err != nil || tmpImage != image {
+				continue
+			}
+			matchingPkgs = append(matchingPkgs, availablePkg)
+			break
+		}
+	}
+	latestPkg, err := resolver.latestPackage(matchingPkgs, nil)
+	if err != nil || latestPkg.Version == "" {
+		return pkg
+	}
+	p.config.Logger.Debug(
+		fmt.Sprintf(
+			"using version %s of package %s, which matches container image %s",
+			latestPkg.Version,
+			pkgName,
+			image,
+		),
+	)
+	return fmt.Sprintf("%s = %s", pkg, latestPkg.Version)
+}
+
+// importStep returns the install step for the single container of the package
+func (p Package) importStep(cfg Config, pkgName string) (*PackageInstallStepDocker, error) {
+	var ret []*PackageInstallStepDocker
+	for _, step := range p.containerSteps(cfg, pkgName) {
+		if !step.PullOnly {
+			ret = append(ret, step)
+		}
+	}
+	if len(ret) != 1 {
+		return nil, NewImportContainerCountError(p.instanceName(), len(ret))
+	}
+	return ret[0], nil
+}
+
+// containerHostPorts returns the host port for each published container port, from port mappings
+// in the Docker -p flag format. The container port is used as the requested port for the package,
+// which matches packages that default to publishing the same port on the host
+func containerHostPorts(ports []string) map[int]int {
+	ret := make(map[int]int)
+	for _, port := range ports {
+		containerPort, hostPort := parsePortMapping(port)
+		tmpContainerPort, err := strconv.Atoi(containerPort)
+		if err != nil {
+			continue
+		}
+		tmpHostPort, err := strconv.Atoi(hostPort)
+		if err != nil {
+			continue
+		}
+		ret[tmpContainerPort] = tmpHostPort
+	}
+	return ret
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestContainerHostPorts(t *testing.T) {
+	testDefs := []struct {
+		Ports    []string
+		Expected map[int]int
+	}{
+		{
+			Ports:    nil,
+			Expected: map[int]int{},
+		},
+		{
+			Ports:    []string{"0.0.0.0:3001:3001", "0.0.0.0:13798:12798"},
+			Expected: map[int]int{3001: 3001, 12798: 13798},
+		},
+		{
+			Ports:    []string{"0.0.0.0::3001"},
+			Expected: map[int]int{},
+		},
+	}
+	for _, testDef := range testDefs {
+		hostPorts := containerHostPorts(testDef.Ports)
+		if !reflect.DeepEqual(hostPorts, testDef.Expected) {
+			t.Fatalf(
+				"did not get expected host ports for %v\n  got: %v\n  expected: %v",
+				testDef.Ports,
+				hostPorts,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestImportStep(t *testing.T) {
+	cfg := Config{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	testDefs := []struct {
+		InstallSteps []PackageInstallStep
+		Expected     string
+		Error        bool
+	}{
+		{
+			InstallSteps: []PackageInstallStep{
+				{Docker: &PackageInstallStepDocker{ContainerName: "node"}},
+				{File: &PackageInstallStepFile{Filename: "config.json"}},
+			},
+			Expected: "node",
+		},
+		{
+			InstallSteps: []PackageInstallStep{
+				{Docker: &PackageInstallStepDocker{ContainerName: "cli", PullOnly: true}},
+				{Docker: &PackageInstallStepDocker{ContainerName: "node"}},
+			},
+			Expected: "node",
+		},
+		{
+			InstallSteps: []PackageInstallStep{
+				{Docker: &PackageInstallStepDocker{ContainerName: "node"}},
+				{Docker: &PackageInstallStepDocker{ContainerName: "db"}},
+			},
+			Error: true,
+		},
+		{
+			InstallSteps: []PackageInstallStep{
+				{File: &PackageInstallStepFile{Filename: "config.json"}},
+			},
+			Error: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		pkg := Package{Name: "test", InstallSteps: testDef.InstallSteps}
+		step, err := pkg.importStep(cfg, "test-1.0.0-default")
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if step.ContainerName != testDef.Expected {
+			t.Fatalf(
+				"did not get expected step: got %s, expected %s",
+				step.ContainerName,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestImportPackageSpec(t *testing.T) {
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: t.TempDir(),
+			DataDir:   t.TempDir(),
+			CacheDir:  t.TempDir(),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var availablePkgs []Package
+	for _, version := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		availablePkgs = append(
+			availablePkgs,
+			Package{
+				Name:    "cardano-node",
+				Version: version,
+				InstallSteps: []PackageInstallStep{
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "cardano-node",
+							Image:         "ghcr.io/blinklabs-io/cardano-node:{{ .Package.Version }}",
+						},
+					},
+				},
+			},
+		)
+	}
+	testDefs := []struct {
+		Pkg      string
+		Image    string
+		Expected string
+	}{
+		{
+			Pkg:      "cardano-node",
+			Image:    "ghcr.io/blinklabs-io/cardano-node:1.1.0",
+			Expected: "cardano-node = 1.1.0",
+		},
+		{
+			Pkg:      "cardano-node",
+			Image:    "ghcr.io/blinklabs-io/cardano-node:3.0.0",
+			Expected: "cardano-node",
+		},
+		{
+			Pkg:      "cardano-node < 2.0.0",
+			Image:    "ghcr.io/blinklabs-io/cardano-node:2.0.0",
+			Expected: "cardano-node < 2.0.0",
+		},
+		{
+			Pkg:      "cardano-node[mithril]",
+			Image:    "ghcr.io/blinklabs-io/cardano-node:1.0.0",
+			Expected: "cardano-node[mithril] = 1.0.0",
+		},
+	}
+	for _, testDef := range testDefs {
+		pkgSpec := pm.importPackageSpec(availablePkgs, "default", testDef.Pkg, testDef.Image)
+		if pkgSpec != testDef.Expected {
+			t.Fatalf(
+				"did not get expected package spec for %s with image %s: got %q, expected %q",
+				testDef.Pkg,
+				testDef.Image,
+				pkgSpec,
+				testDef.Expected,
+			)
+		}
+	}
+}
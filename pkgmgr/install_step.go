@@ -0,0 +1,145 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InstallStep is an install step type provided by an application that embeds the package manager.
+// Install step types are registered with RegisterInstallStep, and are used in package manifests by
+// the key they're registered with
+type InstallStep interface {
+	// Validate checks the install step when the package is validated
+	Validate(cfg Config) error
+	// Install creates the resources managed by the install step
+	Install(env InstallStepEnv) error
+	// Uninstall removes the resources managed by the install step. This is also used to roll back a
+	// failed install, so it shouldn't fail for resources that were never created
+	Uninstall(env InstallStepEnv) error
+	// Activate is called when the package is activated, such as when its context is selected
+	Activate(env InstallStepEnv) error
+	// Deactivate is called when the package is deactivated
+	Deactivate(env InstallStepEnv) error
+}
+
+// InstallStepFactory returns a new install step, which the install step from the package manifest
+// is decoded into
+type InstallStepFactory func() InstallStep
+
+// InstallStepEnv describes the package that an install step is run for
+type InstallStepEnv struct {
+	Config Config
+	// PackageName is the full name of the package, in the form <name>-<version>-<context>
+	PackageName string
+	// DataDir is the data dir for the package
+	DataDir string
+	// CacheDir is the cache dir for the package
+	CacheDir string
+}
+
+var (
+	installStepTypes      = make(map[string]InstallStepFactory)
+	installStepTypesMutex sync.RWMutex
+	installStepTypeRe     = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+)
+
+// RegisterInstallStep registers an install step type, which is used by package manifests with the
+// given key in an install step. The key can't be one of the built-in install step types
+func RegisterInstallStep(key string, factory InstallStepFactory) error {
+	if !installStepTypeRe.MatchString(key) {
+		return fmt.Errorf("invalid install step type: %q", key)
+	}
+	if factory == nil {
+		return fmt.Errorf("no factory provided for install step type: %s", key)
+	}
+	installStepTypesMutex.Lock()
+	defer installStepTypesMutex.Unlock()
+	if _, ok := installStepTypes[key]; ok || builtinInstallStepKeys()[key] {
+		return NewInstallStepTypeExistsError(key)
+	}
+	installStepTypes[key] = factory
+	return nil
+}
+
+// registeredInstallStepKeys returns the keys for the registered install step types, sorted by name
+func registeredInstallStepKeys() []string {
+	installStepTypesMutex.RLock()
+	defer installStepTypesMutex.RUnlock()
+	ret := make([]string, 0, len(installStepTypes))
+	for key := range installStepTypes {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// builtinInstallStepKeys returns the keys used by the fields of PackageInstallStep
+func builtinInstallStepKeys() map[string]bool {
+	ret := make(map[string]bool)
+	stepType := reflect.TypeOf(PackageInstallStep{})
+	for i := 0; i < stepType.NumField(); i++ {
+		name := strings.Split(stepType.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			ret[name] = true
+		}
+	}
+	return ret
+}
+
+// customStep returns the registered install step type used by an install step, if any
+func (s PackageInstallStep) customStep() (InstallStep, error) {
+	for key, node := range s.Custom {
+		installStepTypesMutex.RLock()
+		factory, ok := installStepTypes[key]
+		installStepTypesMutex.RUnlock()
+		if !ok {
+			return nil, NewUnknownInstallStepTypeError(key, registeredInstallStepKeys())
+		}
+		ret := factory()
+		if err := node.Decode(ret); err != nil {
+			return nil, fmt.Errorf("install step %s: %w", key, err)
+		}
+		return ret, nil
+	}
+	return nil, nil
+}
+
+// installStepEnv returns the env for running a registered install step type for a package
+func installStepEnv(cfg Config, pkgName string) InstallStepEnv {
+	return InstallStepEnv{
+		Config:      cfg,
+		PackageName: pkgName,
+		DataDir:     cfg.packageDataDir(pkgName),
+		CacheDir:    filepath.Join(cfg.CacheDir, pkgName),
+	}
+}
+
+// jsonSchema describes the built-in install step types along with the registered ones, which
+// accept anything since their format isn't known
+func (s PackageInstallStep) jsonSchema() *JSONSchema {
+	type rawPackageInstallStep PackageInstallStep
+	ret := schemaForType(reflect.TypeOf(rawPackageInstallStep{}))
+	for _, key := range registeredInstallStepKeys() {
+		ret.Properties[key] = &JSONSchema{}
+	}
+	return ret
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testInstallStep records the calls made to it
+type testInstallStep struct {
+	Message string `yaml:"message"`
+	calls   *[]string
+}
+
+func (s *testInstallStep) Validate(cfg Config) error {
+	if s.Message == "" {
+		return errors.New("message cannot be empty")
+	}
+	return nil
+}
+
+func (s *testInstallStep) Install(env InstallStepEnv) error {
+	*s.calls = append(*s.calls, "install "+s.Message+" "+env.PackageName)
+	return nil
+}
+
+func (s *testInstallStep) Uninstall(env InstallStepEnv) error {
+	*s.calls = append(*s.calls, "uninstall "+s.Message+" "+env.PackageName)
+	return nil
+}
+
+func (s *testInstallStep) Activate(env InstallStepEnv) error {
+	*s.calls = append(*s.calls, "activate "+s.Message)
+	return nil
+}
+
+func (s *testInstallStep) Deactivate(env InstallStepEnv) error {
+	*s.calls = append(*s.calls, "deactivate "+s.Message)
+	return nil
+}
+
+func TestRegisterInstallStep(t *testing.T) {
+	var calls []string
+	factory := func() InstallStep {
+		return &testInstallStep{calls: &calls}
+	}
+	if err := RegisterInstallStep("testGreeting", factory); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, key := range []string{"testGreeting", "docker", "condition", "Bad-Key", ""} {
+		if err := RegisterInstallStep(key, factory); err == nil {
+			t.Fatalf("did not get expected error registering install step type %q", key)
+		}
+	}
+	pkg, err := NewPackageFromReader(
+		strings.NewReader(
+			"name: foo\nversion: 1.0.0\ninstallSteps:\n  - testGreeting:\n      message: hello\n",
+		),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tmpDir := t.TempDir()
+	cfg := Config{
+		BinDir:   filepath.Join(tmpDir, "bin"),
+		CacheDir: filepath.Join(tmpDir, "cache"),
+		DataDir:  filepath.Join(tmpDir, "data"),
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pkg.filePath = "foo/foo-1.0.0.yaml"
+	if err := pkg.validate(cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The install step must survive being saved in the state
+	content, err := yaml.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var savedPkg Package
+	if err := yaml.Unmarshal(content, &savedPkg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	startedSteps, err := savedPkg.installSteps(cfg, "foo-1.0.0-default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := savedPkg.activate(cfg, "default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := savedPkg.deactivate(cfg, "default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	savedPkg.rollbackInstallSteps(cfg, "foo-1.0.0-default", startedSteps)
+	expectedCalls := []string{
+		"install hello foo-1.0.0-default",
+		"activate hello",
+		"deactivate hello",
+		"uninstall hello foo-1.0.0-default",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expectedCalls, "\n") {
+		t.Fatalf("did not get expected calls: got %#v, expected %#v", calls, expectedCalls)
+	}
+	if _, ok := PackageSchema().Properties["installSteps"].Items.Properties["testGreeting"]; !ok {
+		t.Fatalf("registered install step type missing from package schema")
+	}
+}
+
+func TestUnknownInstallStepType(t *testing.T) {
+	pkg, err := NewPackageFromReader(
+		strings.NewReader("name: foo\nversion: 1.0.0\ninstallSteps:\n  - dockr:\n      image: foo\n"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg := Config{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pkg.filePath = "foo/foo-1.0.0.yaml"
+	err = pkg.validate(cfg)
+	if err == nil || !strings.Contains(err.Error(), `unknown install step type "dockr"`) {
+		t.Fatalf("did not get expected error, got: %v", err)
+	}
+}
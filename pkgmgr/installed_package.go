@@ -15,7 +15,10 @@
 package pkgmgr
 
 import (
+	"fmt"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type InstalledPackage struct {
@@ -23,8 +26,29 @@ type InstalledPackage struct {
 	InstalledTime    time.Time
 	Context          string
 	PostInstallNotes string
-	Options          map[string]bool
+	Options          map[string]any
 	Outputs          map[string]string
+	// Notes are the rendered structured notes for the package, which record whether the notes
+	// that require action have been acknowledged
+	Notes []InstalledPackageNote
+	// Origin is the local path the package was installed from, if not installed from the registry
+	Origin string
+	// Instance is the instance name for additional installs of the package in a context
+	Instance string
+	// Binds are the user-provided bind mounts that replace the package bind mounts for the same
+	// container path. These are carried over on upgrade
+	Binds []string
+	// Env are the user-provided env vars in KEY=VALUE format that override or add to the env vars
+	// of the package containers. These are carried over on upgrade
+	Env []string
+	// ConfigProfile is the built-in config profile selected when the package was installed, which
+	// is carried over on upgrade. The default profile is used when empty
+	ConfigProfile string
+	// Hooks records the results of the hook scripts run when the package was installed
+	Hooks []HookResult
+	// Explicit is set for packages that were requested by the user, rather than installed as a
+	// dependency of another package
+	Explicit bool
 }
 
 func NewInstalledPackage(
@@ -32,7 +56,7 @@ func NewInstalledPackage(
 	context string,
 	postInstallNotes string,
 	outputs map[string]string,
-	options map[string]bool,
+	options map[string]any,
 ) InstalledPackage {
 	return InstalledPackage{
 		Package:          pkg,
@@ -41,9 +65,64 @@ func NewInstalledPackage(
 		PostInstallNotes: postInstallNotes,
 		Options:          options,
 		Outputs:          outputs,
+		Origin:           pkg.origin,
+		Instance:         pkg.instance,
 	}
 }
 
+// UnmarshalYAML treats packages installed before the explicit flag was recorded as explicitly
+// installed, so that they're never reported as leftover dependencies
+func (i *InstalledPackage) UnmarshalYAML(value *yaml.Node) error {
+	type rawInstalledPackage InstalledPackage
+	var tmpPkg rawInstalledPackage
+	if err := value.Decode(&tmpPkg); err != nil {
+		return err
+	}
+	*i = InstalledPackage(tmpPkg)
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx < len(value.Content); idx += 2 {
+		if value.Content[idx].Value == "explicit" {
+			return nil
+		}
+	}
+	i.Explicit = true
+	return nil
+}
+
+// InstanceName returns the name used to refer to the installed package, which includes the
+// instance name suffix for additional instances of a package in a context
+func (i InstalledPackage) InstanceName() string {
+	return packageInstanceName(i.Package.Name, i.Instance)
+}
+
 func (i InstalledPackage) IsEmpty() bool {
 	return i.InstalledTime.IsZero()
 }
+
+// Spec returns the package spec that selects exactly this installed package when more than one
+// version of it is tracked, such as "cardano-node = 10.1.4"
+func (i InstalledPackage) Spec() string {
+	return fmt.Sprintf("%s = %s", i.InstanceName(), i.Package.Version)
+}
+
+// otherVersionInstalled returns whether another version of an installed package is tracked in the
+// same context, which can happen after a partially failed upgrade. Versions in removing, keyed by
+// their spec, are ignored
+func otherVersionInstalled(
+	installedPkgs []InstalledPackage,
+	pkg InstalledPackage,
+	removing map[string]bool,
+) bool {
+	for _, installedPkg := range installedPkgs {
+		if installedPkg.Context != pkg.Context ||
+			installedPkg.InstanceName() != pkg.InstanceName() ||
+			installedPkg.Package.Version == pkg.Package.Version ||
+			removing[installedPkg.Spec()] {
+			continue
+		}
+		return true
+	}
+	return false
+}
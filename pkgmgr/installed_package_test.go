@@ -0,0 +1,59 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestInstalledPackageUnmarshalYAMLExplicit(t *testing.T) {
+	testDefs := []struct {
+		content  string
+		expected bool
+	}{
+		{
+			content:  "package:\n  name: foo\n  version: 1.0.0\ncontext: default\nexplicit: false\n",
+			expected: false,
+		},
+		{
+			content:  "package:\n  name: foo\n  version: 1.0.0\ncontext: default\nexplicit: true\n",
+			expected: true,
+		},
+		{
+			// Packages installed before the explicit flag was recorded
+			content:  "package:\n  name: foo\n  version: 1.0.0\ncontext: default\n",
+			expected: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		var installedPkg InstalledPackage
+		if err := yaml.Unmarshal([]byte(testDef.content), &installedPkg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if installedPkg.Package.Name != "foo" || installedPkg.Context != "default" {
+			t.Fatalf("did not get expected package: %#v", installedPkg)
+		}
+		if installedPkg.Explicit != testDef.expected {
+			t.Fatalf(
+				"did not get expected explicit flag for:\n%s\ngot %v, expected %v",
+				testDef.content,
+				installedPkg.Explicit,
+				testDef.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,813 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// k8sDefaultStorageSize is the storage requested for generated volume claims
+	k8sDefaultStorageSize = "10Gi"
+
+	// k8sManagedByLabel marks the generated objects
+	k8sManagedByLabel = "app.kubernetes.io/managed-by"
+	k8sInstanceLabel  = "app.kubernetes.io/instance"
+	k8sNameLabel      = "app.kubernetes.io/name"
+	k8sComponentLabel = "app.kubernetes.io/component"
+
+	// k8sContextVolumeName is the volume used for binds from the shared context dir
+	k8sContextVolumeName = "context-data"
+)
+
+// KubernetesExportOptions controls the generated Kubernetes manifests
+type KubernetesExportOptions struct {
+	// Namespace for the generated objects. It defaults to a name based on the context
+	Namespace string
+	// StorageSize is the storage requested for each generated volume claim
+	StorageSize string
+}
+
+type k8sObject struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Spec       any               `yaml:"spec,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type k8sMetadata struct {
+	Name      string            `yaml:"name,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+type k8sWorkloadSpec struct {
+	Replicas             int              `yaml:"replicas"`
+	ServiceName          string           `yaml:"serviceName,omitempty"`
+	Selector             k8sLabelSelector `yaml:"selector"`
+	Template             k8sPodTemplate   `yaml:"template"`
+	VolumeClaimTemplates []k8sClaim       `yaml:"volumeClaimTemplates,omitempty"`
+}
+
+type k8sLabelSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type k8sPodTemplate struct {
+	Metadata k8sMetadata `yaml:"metadata"`
+	Spec     k8sPodSpec  `yaml:"spec"`
+}
+
+type k8sPodSpec struct {
+	TerminationGracePeriodSeconds *int           `yaml:"terminationGracePeriodSeconds,omitempty"`
+	Containers                    []k8sContainer `yaml:"containers"`
+	Volumes                       []k8sVolume    `yaml:"volumes,omitempty"`
+}
+
+type k8sContainer struct {
+	Name         string              `yaml:"name"`
+	Image        string              `yaml:"image"`
+	Command      []string            `yaml:"command,omitempty"`
+	Args         []string            `yaml:"args,omitempty"`
+	Env          []k8sEnvVar         `yaml:"env,omitempty"`
+	Ports        []k8sContainerPort  `yaml:"ports,omitempty"`
+	VolumeMounts []k8sVolumeMount    `yaml:"volumeMounts,omitempty"`
+	Resources    *k8sResourceRequest `yaml:"resources,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name      string           `yaml:"name"`
+	Value     string           `yaml:"value,omitempty"`
+	ValueFrom *k8sEnvVarSource `yaml:"valueFrom,omitempty"`
+}
+
+type k8sEnvVarSource struct {
+	SecretKeyRef k8sKeySelector `yaml:"secretKeyRef"`
+}
+
+type k8sKeySelector struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type k8sContainerPort struct {
+	Name          string `yaml:"name"`
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	SubPath   string `yaml:"subPath,omitempty"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type k8sVolume struct {
+	Name                  string                 `yaml:"name"`
+	PersistentVolumeClaim *k8sClaimVolumeSource  `yaml:"persistentVolumeClaim,omitempty"`
+	ConfigMap             *k8sConfigMapReference `yaml:"configMap,omitempty"`
+	HostPath              *k8sHostPath           `yaml:"hostPath,omitempty"`
+}
+
+type k8sClaimVolumeSource struct {
+	ClaimName string `yaml:"claimName"`
+}
+
+type k8sConfigMapReference struct {
+	Name string `yaml:"name"`
+}
+
+type k8sHostPath struct {
+	Path string `yaml:"path"`
+}
+
+type k8sClaim struct {
+	Metadata k8sMetadata  `yaml:"metadata"`
+	Spec     k8sClaimSpec `yaml:"spec"`
+}
+
+type k8sClaimSpec struct {
+	AccessModes []string           `yaml:"accessModes"`
+	Resources   k8sResourceRequest `yaml:"resources"`
+}
+
+type k8sResourceRequest struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+// k8sExport accumulates the generated objects for a context
+type k8sExport struct {
+	cfg           Config
+	opts          KubernetesExportOptions
+	contextName   string
+	objects       []k8sObject
+	notes         []string
+	contextVolume bool
+}
+
+// ExportKubernetes renders the installed packages in the specified context into Kubernetes
+// manifests, as a starting point for running them on a cluster. Each container becomes a
+// Deployment, or a StatefulSet with volume claim templates when it uses package data, along with
+// a Service for its ports and a ConfigMap for files from file install steps. Secret values are
+// never exported, and containers reference a Secret that must be created separately
+func (p *PackageManager) ExportKubernetes(
+	contextName string,
+	opts KubernetesExportOptions,
+) ([]byte, error) {
+	if contextName == "" {
+		contextName, _ = p.CurrentContext()
+	}
+	if _, ok := p.state.Contexts[contextName]; !ok {
+		return nil, ErrContextNotExist
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = k8sName("cardano-up-" + contextName)
+	}
+	if opts.StorageSize == "" {
+		opts.StorageSize = k8sDefaultStorageSize
+	}
+	e := &k8sExport{
+		cfg:         p.config,
+		opts:        opts,
+		contextName: contextName,
+	}
+	e.objects = append(
+		e.objects,
+		k8sObject{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Metadata: k8sMetadata{
+				Name: opts.Namespace,
+			},
+		},
+	)
+	var installedPkgs []InstalledPackage
+	for _, installedPkg := range p.state.InstalledPackages {
+		if installedPkg.Context == contextName {
+			installedPkgs = append(installedPkgs, installedPkg)
+		}
+	}
+	if len(installedPkgs) == 0 {
+		return nil, NewNoPackagesInstalledError(contextName)
+	}
+	sort.Slice(
+		installedPkgs,
+		func(i, j int) bool {
+			return installedPkgs[i].InstanceName() < installedPkgs[j].InstanceName()
+		},
+	)
+	for _, installedPkg := range installedPkgs {
+		if err := e.addPackage(p.installedPackageTemplate(installedPkg), installedPkg); err != nil {
+			return nil, err
+		}
+	}
+	if e.contextVolume {
+		e.objects = append(
+			e.objects,
+			k8sObject{
+				APIVersion: "v1",
+				Kind:       "PersistentVolumeClaim",
+				Metadata: k8sMetadata{
+					Name:      k8sContextVolumeName,
+					Namespace: opts.Namespace,
+					Labels:    map[string]string{k8sManagedByLabel: "cardano-up"},
+				},
+				Spec: e.claimSpec("ReadWriteMany"),
+			},
+		)
+	}
+	return e.marshal()
+}
+
+// installedPackageTemplate returns the template for rendering an installed package. Host ports
+// use the existing allocations for the package, and no new ports are allocated
+func (p *PackageManager) installedPackageTemplate(installedPkg InstalledPackage) *Template {
+	tmplContext := p.state.Contexts[installedPkg.Context]
+	tmplEnv := make(map[string]string)
+	for _, tmpPkg := range p.state.InstalledPackages {
+		if tmpPkg.Context != installedPkg.Context {
+			continue
+		}
+		for k, v := range tmpPkg.Outputs {
+			tmplEnv[k] = v
+		}
+	}
+	ports := p.state.Ports.clone()
+	owner := portOwner(installedPkg.Package, installedPkg.Context)
+	return p.config.Template.WithVars(
+		map[string]any{
+			"Context": tmplContext.templateVars(installedPkg.Context),
+			"Env":     tmplEnv,
+		},
+	).WithVars(
+		installedPkg.Package.templateVars(
+			p.config,
+			installedPkg.Context,
+			installedPkg.Options,
+		),
+	).WithFuncs(
+		template.FuncMap{
+			"freePort": func(port int) (int, error) {
+				return ports.Allocate(owner, port)
+			},
+		},
+	)
+}
+
+// k8sFile is a file from a file install step, exported to a ConfigMap
+type k8sFile struct {
+	localPath string
+	key       string
+}
+
+func (e *k8sExport) addPackage(tmpl *Template, installedPkg InstalledPackage) error {
+	pkg := installedPkg.Package
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		installedPkg.InstanceName(),
+		pkg.Version,
+		installedPkg.Context,
+	)
+	pkgDataDir := e.cfg.packageDataDir(pkgName)
+	configMapName := k8sName(installedPkg.InstanceName() + "-files")
+	configMapData := make(map[string]string)
+	var files []k8sFile
+	var steps []*PackageInstallStepDocker
+	for _, installStep := range pkg.InstallSteps {
+		if installStep.Condition != "" {
+			ok, err := tmpl.EvaluateCondition(installStep.Condition, nil)
+			if err != nil {
+				return NewInstallStepConditionError(installStep.Condition, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if installStep.File != nil {
+			// Binary files are wrappers for running commands locally
+			if installStep.File.Binary {
+				continue
+			}
+			filenames, err := installStep.File.installedFilenames(tmpl, pkgDataDir)
+			if err != nil {
+				return err
+			}
+			for _, filename := range filenames {
+				localPath := filepath.Join(pkgDataDir, filename)
+				// Use the installed file, since it has already been rendered
+				content, err := os.ReadFile(localPath)
+				if err != nil {
+					e.notes = append(
+						e.notes,
+						fmt.Sprintf(
+							"file %s for package %s was not found and was skipped",
+							localPath,
+							installedPkg.InstanceName(),
+						),
+					)
+					continue
+				}
+				key := k8sConfigMapKey(filename)
+				configMapData[key] = string(content)
+				files = append(files, k8sFile{localPath: localPath, key: key})
+			}
+		}
+		if installStep.Docker != nil && !installStep.Docker.PullOnly {
+			steps = append(steps, installStep.Docker)
+		}
+		if installStep.Compose != nil {
+			e.notes = append(
+				e.notes,
+				fmt.Sprintf(
+					"compose services for package %s are not exported",
+					installedPkg.InstanceName(),
+				),
+			)
+		}
+	}
+	for _, step := range steps {
+		if err := e.addContainer(
+			tmpl,
+			installedPkg,
+			pkgName,
+			step,
+			configMapName,
+			files,
+		); err != nil {
+			return err
+		}
+	}
+	if len(configMapData) > 0 {
+		e.objects = append(
+			e.objects,
+			k8sObject{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Metadata: k8sMetadata{
+					Name:      configMapName,
+					Namespace: e.opts.Namespace,
+					Labels:    e.labels(installedPkg, ""),
+				},
+				Data: configMapData,
+			},
+		)
+	}
+	if len(pkg.Secrets) > 0 {
+		var secretNames []string
+		for _, secret := range pkg.Secrets {
+			secretNames = append(secretNames, secret.Name)
+		}
+		e.notes = append(
+			e.notes,
+			fmt.Sprintf(
+				"create the Secret %s with the keys %s for package %s",
+				k8sName(installedPkg.InstanceName()+"-secrets"),
+				strings.Join(secretNames, ", "),
+				installedPkg.InstanceName(),
+			),
+		)
+	}
+	return nil
+}
+
+func (e *k8sExport) addContainer(
+	tmpl *Template,
+	installedPkg InstalledPackage,
+	pkgName string,
+	step *PackageInstallStepDocker,
+	configMapName string,
+	files []k8sFile,
+) error {
+	containerName := fmt.Sprintf("%s-%s", pkgName, step.ContainerName)
+	extraVars := containerTemplateVars(containerName)
+	render := func(val string) (string, error) {
+		return tmpl.Render(val, extraVars)
+	}
+	name := k8sName(installedPkg.InstanceName() + "-" + step.ContainerName)
+	labels := e.labels(installedPkg, step.ContainerName)
+	image, err := render(step.Image)
+	if err != nil {
+		return err
+	}
+	container := k8sContainer{
+		Name:  k8sName(step.ContainerName),
+		Image: image,
+	}
+	for _, cmd := range step.Command {
+		tmpCmd, err := render(cmd)
+		if err != nil {
+			return err
+		}
+		container.Command = append(container.Command, tmpCmd)
+	}
+	for _, arg := range step.Args {
+		tmpArg, err := render(arg)
+		if err != nil {
+			return err
+		}
+		container.Args = append(container.Args, tmpArg)
+	}
+	// Env vars in sorted order for consistent output
+	var envKeys []string
+	for k := range step.Env {
+		envKeys = append(envKeys, k)
+	}
+	sort.Strings(envKeys)
+	for _, k := range envKeys {
+		val, err := render(step.Env[k])
+		if err != nil {
+			return err
+		}
+		container.Env = append(container.Env, k8sEnvVar{Name: k, Value: val})
+	}
+	var secretEnvKeys []string
+	for k := range step.SecretEnv {
+		secretEnvKeys = append(secretEnvKeys, k)
+	}
+	sort.Strings(secretEnvKeys)
+	for _, k := range secretEnvKeys {
+		container.Env = append(
+			container.Env,
+			k8sEnvVar{
+				Name: k,
+				ValueFrom: &k8sEnvVarSource{
+					SecretKeyRef: k8sKeySelector{
+						Name: k8sName(installedPkg.InstanceName() + "-secrets"),
+						Key:  step.SecretEnv[k],
+					},
+				},
+			},
+		)
+	}
+	// Ports
+	var servicePorts []k8sServicePort
+	for _, port := range step.Ports {
+		tmpPort, err := render(port)
+		if err != nil {
+			return err
+		}
+		containerPort, protocol, err := k8sParsePort(tmpPort)
+		if err != nil {
+			return err
+		}
+		portName := fmt.Sprintf("%s-%d", strings.ToLower(protocol), containerPort)
+		container.Ports = append(
+			container.Ports,
+			k8sContainerPort{
+				Name:          portName,
+				ContainerPort: containerPort,
+				Protocol:      protocol,
+			},
+		)
+		servicePorts = append(
+			servicePorts,
+			k8sServicePort{
+				Name:       portName,
+				Port:       containerPort,
+				TargetPort: containerPort,
+				Protocol:   protocol,
+			},
+		)
+	}
+	// Volumes
+	podSpec := k8sPodSpec{}
+	var claims []k8sClaim
+	volumeNames := make(map[string]bool)
+	for _, bind := range step.Binds {
+		tmpBind, err := render(bind)
+		if err != nil {
+			return err
+		}
+		mount, volume, claim := e.bindVolume(installedPkg, pkgName, tmpBind)
+		if mount.Name == "" {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+		if volumeNames[mount.Name] {
+			continue
+		}
+		volumeNames[mount.Name] = true
+		if volume != nil {
+			podSpec.Volumes = append(podSpec.Volumes, *volume)
+		}
+		if claim != nil {
+			claims = append(claims, *claim)
+		}
+		// Mount files from file install steps inside the bind from the ConfigMap
+		hostPath, containerPath, _ := strings.Cut(tmpBind, ":")
+		containerPath, _, _ = strings.Cut(containerPath, ":")
+		for _, file := range files {
+			relPath, err := filepath.Rel(hostPath, file.localPath)
+			if err != nil || relPath == ".." ||
+				strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if !volumeNames[configMapName] {
+				volumeNames[configMapName] = true
+				podSpec.Volumes = append(
+					podSpec.Volumes,
+					k8sVolume{
+						Name:      configMapName,
+						ConfigMap: &k8sConfigMapReference{Name: configMapName},
+					},
+				)
+			}
+			container.VolumeMounts = append(
+				container.VolumeMounts,
+				k8sVolumeMount{
+					Name:      configMapName,
+					MountPath: path.Join(containerPath, filepath.ToSlash(relPath)),
+					SubPath:   file.key,
+					ReadOnly:  true,
+				},
+			)
+		}
+	}
+	if len(step.Devices) > 0 {
+		e.notes = append(
+			e.notes,
+			fmt.Sprintf(
+				"devices for container %s are not exported and need a device plugin",
+				name,
+			),
+		)
+	}
+	if len(step.Networks) > 0 {
+		e.notes = append(
+			e.notes,
+			fmt.Sprintf(
+				"networks for container %s are not exported, since pods share a flat network",
+				name,
+			),
+		)
+	}
+	if !step.runtimeOptions().empty() {
+		e.notes = append(
+			e.notes,
+			fmt.Sprintf(
+				"runtime options (extra hosts, DNS, sysctls, ulimits, capabilities, shm size, read-only) for container %s are not exported",
+				name,
+			),
+		)
+	}
+	if step.Gpus != "" {
+		gpuCount := "1"
+		if count, err := strconv.Atoi(step.Gpus); err == nil {
+			gpuCount = strconv.Itoa(count)
+		}
+		container.Resources = &k8sResourceRequest{
+			Limits: map[string]string{"nvidia.com/gpu": gpuCount},
+		}
+	}
+	stopTimeout := defaultStopTimeout
+	if step.StopTimeout != nil {
+		stopTimeout = *step.StopTimeout
+	} else if e.cfg.StopTimeout > 0 {
+		stopTimeout = int(e.cfg.StopTimeout.Seconds())
+	}
+	podSpec.TerminationGracePeriodSeconds = &stopTimeout
+	podSpec.Containers = []k8sContainer{container}
+	workloadSpec := k8sWorkloadSpec{
+		Replicas: 1,
+		Selector: k8sLabelSelector{MatchLabels: labels},
+		Template: k8sPodTemplate{
+			Metadata: k8sMetadata{Labels: labels},
+			Spec:     podSpec,
+		},
+		VolumeClaimTemplates: claims,
+	}
+	kind := "Deployment"
+	if len(claims) > 0 {
+		// Package data needs a stable volume per pod
+		kind = "StatefulSet"
+		workloadSpec.ServiceName = name
+	}
+	e.objects = append(
+		e.objects,
+		k8sObject{
+			APIVersion: "apps/v1",
+			Kind:       kind,
+			Metadata: k8sMetadata{
+				Name:      name,
+				Namespace: e.opts.Namespace,
+				Labels:    labels,
+			},
+			Spec: workloadSpec,
+		},
+	)
+	if len(servicePorts) > 0 {
+		e.objects = append(
+			e.objects,
+			k8sObject{
+				APIVersion: "v1",
+				Kind:       "Service",
+				Metadata: k8sMetadata{
+					Name:      name,
+					Namespace: e.opts.Namespace,
+					Labels:    labels,
+				},
+				Spec: k8sServiceSpec{
+					Selector: labels,
+					Ports:    servicePorts,
+				},
+			},
+		)
+	}
+	return nil
+}
+
+// bindVolume returns the volume mount for a bind in the Docker -v flag format, along with either
+// a pod volume or a volume claim template for the source
+func (e *k8sExport) bindVolume(
+	installedPkg InstalledPackage,
+	pkgName string,
+	bind string,
+) (k8sVolumeMount, *k8sVolume, *k8sClaim) {
+	bindParts := strings.Split(bind, ":")
+	if len(bindParts) < 2 {
+		// Anonymous volumes don't persist anything
+		return k8sVolumeMount{}, nil, nil
+	}
+	hostPath := bindParts[0]
+	mount := k8sVolumeMount{
+		MountPath: bindParts[1],
+	}
+	if len(bindParts) > 2 {
+		for _, opt := range strings.Split(bindParts[2], ",") {
+			if opt == "ro" {
+				mount.ReadOnly = true
+			}
+		}
+	}
+	newClaim := func(name string) *k8sClaim {
+		return &k8sClaim{
+			Metadata: k8sMetadata{Name: name},
+			Spec:     e.claimSpec("ReadWriteOnce"),
+		}
+	}
+	if !filepath.IsAbs(hostPath) {
+		// Named volume
+		mount.Name = k8sName(hostPath)
+		return mount, nil, newClaim(mount.Name)
+	}
+	relPath, isCache, ok := dataRelPath(e.cfg, hostPath)
+	if ok {
+		relParts := strings.SplitN(relPath, "/", 2)
+		switch {
+		case relParts[0] == pkgName:
+			prefix := "data"
+			if isCache {
+				prefix = "cache"
+			}
+			if len(relParts) > 1 {
+				mount.Name = k8sName(prefix + "-" + relParts[1])
+			} else {
+				mount.Name = prefix
+			}
+			return mount, nil, newClaim(mount.Name)
+		case !isCache && relParts[0] == e.contextName:
+			// The context dir is shared between packages
+			e.contextVolume = true
+			mount.Name = k8sContextVolumeName
+			if len(relParts) > 1 {
+				mount.SubPath = relParts[1]
+			}
+			return mount, &k8sVolume{
+				Name: k8sContextVolumeName,
+				PersistentVolumeClaim: &k8sClaimVolumeSource{
+					ClaimName: k8sContextVolumeName,
+				},
+			}, nil
+		}
+	}
+	// Other host paths can't be shared with the cluster, so they're left as host paths
+	mount.Name = k8sName("host-" + hostPath)
+	e.notes = append(
+		e.notes,
+		fmt.Sprintf(
+			"host path %s for package %s is exported as a hostPath volume",
+			hostPath,
+			installedPkg.InstanceName(),
+		),
+	)
+	return mount, &k8sVolume{
+		Name:     mount.Name,
+		HostPath: &k8sHostPath{Path: hostPath},
+	}, nil
+}
+
+func (e *k8sExport) claimSpec(accessMode string) k8sClaimSpec {
+	return k8sClaimSpec{
+		AccessModes: []string{accessMode},
+		Resources: k8sResourceRequest{
+			Requests: map[string]string{"storage": e.opts.StorageSize},
+		},
+	}
+}
+
+func (e *k8sExport) labels(installedPkg InstalledPackage, component string) map[string]string {
+	ret := map[string]string{
+		k8sManagedByLabel: "cardano-up",
+		k8sNameLabel:      k8sName(installedPkg.Package.Name),
+		k8sInstanceLabel:  k8sName(installedPkg.InstanceName()),
+	}
+	if component != "" {
+		ret[k8sComponentLabel] = k8sName(component)
+	}
+	return ret
+}
+
+func (e *k8sExport) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(
+		&buf,
+		"# Generated by cardano-up from context %q. Review before applying to a cluster\n",
+		e.contextName,
+	)
+	for _, note := range e.notes {
+		fmt.Fprintf(&buf, "# NOTE: %s\n", note)
+	}
+	for _, obj := range e.objects {
+		buf.WriteString("---\n")
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(obj); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// k8sParsePort returns the container port and protocol from a port spec in the Docker -p flag
+// format
+func k8sParsePort(port string) (int, string, error) {
+	protocol := "TCP"
+	if portSpec, portProto, ok := strings.Cut(port, "/"); ok {
+		port = portSpec
+		protocol = strings.ToUpper(portProto)
+	}
+	containerPort, _ := parsePortMapping(port)
+	ret, err := strconv.Atoi(containerPort)
+	if err != nil {
+		return 0, "", NewInvalidPortSpecError(port)
+	}
+	return ret, protocol, nil
+}
+
+// k8sName converts a value to a valid Kubernetes object name (RFC 1123 label)
+func k8sName(val string) string {
+	reInvalid := regexp.MustCompile(`[^a-z0-9-]+`)
+	ret := reInvalid.ReplaceAllString(strings.ToLower(val), "-")
+	ret = strings.Trim(ret, "-")
+	if len(ret) > 63 {
+		ret = strings.TrimRight(ret[:63], "-")
+	}
+	return ret
+}
+
+// k8sConfigMapKey converts a file path to a valid ConfigMap key
+func k8sConfigMapKey(filename string) string {
+	reInvalid := regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+	return reInvalid.ReplaceAllString(filepath.ToSlash(filename), "_")
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportKubernetes(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "node",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						File: &PackageInstallStepFile{
+							Filename: "config/config.json",
+							Content:  "{}",
+						},
+					},
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "node",
+							Image:         "node:{{ .Package.Version }}",
+							Env: map[string]string{
+								"NETWORK": "{{ .Context.Network }}",
+							},
+							SecretEnv: map[string]string{
+								"API_KEY": "api-key",
+							},
+							Binds: []string{
+								"{{ .Paths.DataDir }}/config:/config:ro",
+								"{{ .Paths.DataDir }}/db:/db",
+								"{{ .Paths.ContextDir }}/ipc:/ipc",
+							},
+							Ports: []string{
+								"3001",
+								"12798/udp",
+							},
+						},
+					},
+				},
+				Secrets: []PackageSecret{
+					{Name: "api-key"},
+				},
+			},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:    "other",
+				Version: "1.0.0",
+			},
+			Context:       "other",
+			InstalledTime: time.Now(),
+		},
+	}
+	configPath := filepath.Join(cfg.DataDir, "node-1.0.0-default", "config", "config.json")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(configPath, []byte(`{"foo": "bar"}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	manifests, err := pm.ExportKubernetes("default", KubernetesExportOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(string(manifests), "# NOTE: create the Secret node-secrets with the keys api-key") {
+		t.Fatalf("did not get expected secret note:\n%s", manifests)
+	}
+	objects := make(map[string]map[string]any)
+	decoder := yaml.NewDecoder(bytes.NewReader(manifests))
+	for {
+		var obj map[string]any
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			t.Fatalf("unexpected error: %s", err)
+		}
+		metadata := obj["metadata"].(map[string]any)
+		objects[obj["kind"].(string)+"/"+metadata["name"].(string)] = obj
+	}
+	for _, key := range []string{
+		"Namespace/cardano-up-default",
+		"StatefulSet/node-node",
+		"Service/node-node",
+		"ConfigMap/node-files",
+		"PersistentVolumeClaim/context-data",
+	} {
+		if _, ok := objects[key]; !ok {
+			t.Fatalf("did not find expected object %s:\n%s", key, manifests)
+		}
+	}
+	if len(objects) != 5 {
+		t.Fatalf("did not get expected number of objects: %d\n%s", len(objects), manifests)
+	}
+	configMap := objects["ConfigMap/node-files"]["data"].(map[string]any)
+	if configMap["config_config.json"] != `{"foo": "bar"}` {
+		t.Fatalf("did not get expected ConfigMap data: %#v", configMap)
+	}
+	manifestsStr := string(manifests)
+	for _, expected := range []string{
+		"image: node:1.0.0",
+		"name: node-secrets",
+		"key: api-key",
+		"protocol: UDP",
+		"containerPort: 12798",
+		"mountPath: /config/config.json",
+		"subPath: config_config.json",
+		"subPath: ipc",
+		"name: data-db",
+		"storage: 10Gi",
+	} {
+		if !strings.Contains(manifestsStr, expected) {
+			t.Fatalf("did not find %q in manifests:\n%s", expected, manifests)
+		}
+	}
+	// Secret values must never be exported
+	if strings.Contains(manifestsStr, "kind: Secret\n") {
+		t.Fatalf("manifests should not contain a Secret:\n%s", manifests)
+	}
+	if _, err := pm.ExportKubernetes("missing", KubernetesExportOptions{}); err != ErrContextNotExist {
+		t.Fatalf("did not get expected error for unknown context: %v", err)
+	}
+}
+
+func TestK8sName(t *testing.T) {
+	testDefs := []struct {
+		input    string
+		expected string
+	}{
+		{"cardano-node", "cardano-node"},
+		{"Cardano_Node", "cardano-node"},
+		{"/var/lib/foo", "var-lib-foo"},
+		{strings.Repeat("a", 62) + "-b", strings.Repeat("a", 62)},
+	}
+	for _, testDef := range testDefs {
+		if got := k8sName(testDef.input); got != testDef.expected {
+			t.Fatalf(
+				"did not get expected name for %q: got %q, expected %q",
+				testDef.input,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/hashicorp/go-version"
+)
+
+type LintSeverity string
+
+const (
+	LintSeverityError   LintSeverity = "error"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityInfo    LintSeverity = "info"
+)
+
+// LintFinding is a single problem found while linting a package
+type LintFinding struct {
+	Severity LintSeverity
+	// Field is the path to the offending field in the package manifest, if any
+	Field   string
+	Message string
+}
+
+func (f LintFinding) String() string {
+	if f.Field == "" {
+		return f.Message
+	}
+	return fmt.Sprintf("%s: %s", f.Field, f.Message)
+}
+
+// lintTemplateVars contains the template variables available to packages and
+// their known keys. A nil value means that any key is allowed
+var lintTemplateVars = map[string][]string{
+	"Context": {"Name", "Network", "NetworkMagic", "CustomNetwork", "NetworkConfigDir"},
+	"Env":     nil,
+	"Package": {"Name", "ShortName", "Instance", "Version", "Options"},
+	"Paths":   {"CacheDir", "ContextDir", "DataDir"},
+	"Ports":   nil,
+	"Profile": {
+		"Name",
+		"MinSeverity",
+		"TraceMempool",
+		"SnapshotInterval",
+		"NumOfDiskSnapshots",
+		"PeerSharing",
+		"TargetNumberOfKnownPeers",
+		"TargetNumberOfEstablishedPeers",
+		"TargetNumberOfActivePeers",
+	},
+	"Sockets": nil,
+	"System": {
+		"OS",
+		"Arch",
+		"CPUs",
+		"ARMMac",
+		"MemoryMB",
+		"DiskFreeMB",
+		"DockerVersion",
+	},
+}
+
+// lint checks the package for problems. The available packages are used to
+// check dependencies
+func (p Package) lint(cfg Config, availablePkgs []Package) []LintFinding {
+	var ret []LintFinding
+	addFinding := func(severity LintSeverity, field string, msg string, args ...any) {
+		ret = append(
+			ret,
+			LintFinding{
+				Severity: severity,
+				Field:    field,
+				Message:  fmt.Sprintf(msg, args...),
+			},
+		)
+	}
+	// Render templates with dummy values
+	cfg.Template = p.lintTemplate(cfg)
+	// Basic validation
+	if err := p.validate(cfg); err != nil {
+		addFinding(LintSeverityError, "", "%s", err)
+	}
+	// Fields that require a newer spec version than declared
+	for _, problem := range p.specVersionProblems() {
+		addFinding(LintSeverityError, "specVersion", "%s", problem)
+	}
+	// Missing descriptions
+	if p.Description == "" {
+		addFinding(LintSeverityWarning, "description", "package has no description")
+	}
+	for idx, opt := range p.Options {
+		if opt.Description == "" {
+			addFinding(
+				LintSeverityWarning,
+				fmt.Sprintf("options[%d]", idx),
+				"option %q has no description",
+				opt.Name,
+			)
+		}
+	}
+	for idx, output := range p.Outputs {
+		if output.Description == "" {
+			addFinding(
+				LintSeverityWarning,
+				fmt.Sprintf("outputs[%d]", idx),
+				"output %q has no description",
+				output.Name,
+			)
+		}
+	}
+	for idx, secret := range p.Secrets {
+		if secret.Description == "" {
+			addFinding(
+				LintSeverityWarning,
+				fmt.Sprintf("secrets[%d]", idx),
+				"secret %q has no description",
+				secret.Name,
+			)
+		}
+	}
+	for idx, socket := range p.Sockets {
+		if socket.Description == "" {
+			addFinding(
+				LintSeverityWarning,
+				fmt.Sprintf("sockets[%d]", idx),
+				"socket %q has no description",
+				socket.Name,
+			)
+		}
+	}
+	// Templates
+	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, "lint")
+	for _, tmpl := range p.templates(pkgName) {
+		tree, err := cfg.Template.parse(tmpl.body)
+		if err != nil {
+			addFinding(LintSeverityError, tmpl.field, "template syntax error: %s", err)
+			continue
+		}
+		for _, ref := range templateFieldRefs(tree.Root) {
+			if msg := p.lintTemplateRef(ref, tmpl.containerName != ""); msg != "" {
+				addFinding(LintSeverityError, tmpl.field, "%s", msg)
+			}
+		}
+		if _, err := cfg.Template.Render(
+			tmpl.body,
+			containerTemplateVars(tmpl.containerName),
+		); err != nil {
+			addFinding(LintSeverityError, tmpl.field, "template render failed: %s", err)
+		}
+	}
+	// Duplicate host ports
+	hostPorts := make(map[string]string)
+	for stepIdx, installStep := range p.InstallSteps {
+		if installStep.Docker == nil {
+			continue
+		}
+		for portIdx, port := range installStep.Docker.Ports {
+			field := fmt.Sprintf("installSteps[%d].docker.ports[%d]", stepIdx, portIdx)
+			tmpPort, err := cfg.Template.Render(
+				port,
+				containerTemplateVars(
+					fmt.Sprintf("%s-%s", pkgName, installStep.Docker.ContainerName),
+				),
+			)
+			if err != nil {
+				// This will have already been reported above
+				continue
+			}
+			hostPort := lintHostPort(tmpPort)
+			if hostPort == "" {
+				continue
+			}
+			if otherField, ok := hostPorts[hostPort]; ok {
+				addFinding(
+					LintSeverityError,
+					field,
+					"host port %s is also used by %s",
+					hostPort,
+					otherField,
+				)
+				continue
+			}
+			hostPorts[hostPort] = field
+		}
+	}
+	// Dangling file sources
+	for stepIdx, installStep := range p.InstallSteps {
+		if installStep.File == nil || p.filePath == "" {
+			continue
+		}
+		for _, source := range []struct {
+			field string
+			kind  string
+			path  string
+		}{
+			{"source", "source file", installStep.File.Source},
+			{"sourceDir", "source dir", installStep.File.SourceDir},
+		} {
+			// Templated sources depend on the context and options
+			if source.path == "" || strings.Contains(source.path, "{{") {
+				continue
+			}
+			sourcePath := filepath.Join(
+				filepath.Dir(p.filePath),
+				source.path,
+			)
+			if _, err := os.Stat(sourcePath); err != nil {
+				field := fmt.Sprintf("installSteps[%d].file.%s", stepIdx, source.field)
+				if errors.Is(err, fs.ErrNotExist) {
+					addFinding(
+						LintSeverityError,
+						field,
+						"%s %q does not exist",
+						source.kind,
+						source.path,
+					)
+				} else {
+					addFinding(
+						LintSeverityError,
+						field,
+						"failed to access %s %q: %s",
+						source.kind,
+						source.path,
+						err,
+					)
+				}
+			}
+		}
+	}
+	// Dependencies, including those for options
+	type lintDep struct {
+		field string
+		dep   string
+	}
+	var deps []lintDep
+	for idx, dep := range p.Dependencies {
+		deps = append(deps, lintDep{fmt.Sprintf("dependencies[%d]", idx), dep.Name})
+	}
+	for optIdx, opt := range p.Options {
+		for idx, dep := range opt.Dependencies {
+			deps = append(
+				deps,
+				lintDep{fmt.Sprintf("options[%d].dependencies[%d]", optIdx, idx), dep.Name},
+			)
+		}
+	}
+	resolver := &Resolver{}
+	for _, tmpDep := range deps {
+		field, dep := tmpDep.field, tmpDep.dep
+		depName, depVersionSpec, depOpts := resolver.splitPackage(dep)
+		var depPkgs []Package
+		for _, availablePkg := range availablePkgs {
+			if availablePkg.Name == depName {
+				depPkgs = append(depPkgs, availablePkg)
+			}
+		}
+		if len(depPkgs) == 0 {
+			addFinding(
+				LintSeverityError,
+				field,
+				"dependency references unknown package %q",
+				depName,
+			)
+			continue
+		}
+		if depVersionSpec != "" {
+			constraints, err := version.NewConstraint(depVersionSpec)
+			if err != nil {
+				addFinding(
+					LintSeverityError,
+					field,
+					"invalid version constraint %q: %s",
+					depVersionSpec,
+					err,
+				)
+				continue
+			}
+			foundMatch := false
+			for _, depPkg := range depPkgs {
+				depPkgVer, err := version.NewVersion(depPkg.Version)
+				if err != nil {
+					continue
+				}
+				if constraints.Check(depPkgVer) {
+					foundMatch = true
+					break
+				}
+			}
+			if !foundMatch {
+				addFinding(
+					LintSeverityWarning,
+					field,
+					"no available version of %q matches %q",
+					depName,
+					depVersionSpec,
+				)
+			}
+		}
+		for opt, optVal := range depOpts {
+			foundOpt := false
+			var optErr error
+			for _, depPkg := range depPkgs {
+				for _, depPkgOpt := range depPkg.Options {
+					if depPkgOpt.Name == opt {
+						foundOpt = true
+						if _, err := depPkgOpt.parseValue(optVal); err != nil {
+							optErr = err
+						}
+					}
+				}
+			}
+			if !foundOpt {
+				addFinding(LintSeverityError, field, "package %q has no option %q", depName, opt)
+			} else if optErr != nil {
+				addFinding(
+					LintSeverityError,
+					field,
+					"invalid value for option %q of package %q: %s",
+					opt,
+					depName,
+					optErr,
+				)
+			}
+		}
+	}
+	// Sockets used by containers must be declared by the package or another available package
+	for stepIdx, installStep := range p.InstallSteps {
+		if installStep.Docker == nil {
+			continue
+		}
+		for socketIdx, socketName := range installStep.Docker.Sockets {
+			foundSocket := false
+			for _, tmpPkg := range append([]Package{p}, availablePkgs...) {
+				for _, socket := range tmpPkg.Sockets {
+					if socket.Name == socketName {
+						foundSocket = true
+					}
+				}
+			}
+			if !foundSocket {
+				addFinding(
+					LintSeverityError,
+					fmt.Sprintf("installSteps[%d].docker.sockets[%d]", stepIdx, socketIdx),
+					"socket %q is not declared by any package",
+					socketName,
+				)
+			}
+		}
+	}
+	return ret
+}
+
+// lintTemplate returns a template with dummy values for all of the variables
+// available to packages
+func (p Package) lintTemplate(cfg Config) *Template {
+	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, "lint")
+	ret := cfg.Template.WithVars(
+		map[string]any{
+			"Context": map[string]any{
+				"Name":             "lint",
+				"Network":          "preview",
+				"NetworkMagic":     uint32(2),
+				"CustomNetwork":    false,
+				"NetworkConfigDir": "",
+			},
+			"Env": map[string]string{},
+			"Package": map[string]any{
+				"Name":      pkgName,
+				"ShortName": p.Name,
+				"Instance":  "",
+				"Version":   p.Version,
+				"Options":   p.defaultOpts(),
+			},
+			"Paths": map[string]string{
+				"CacheDir":   filepath.Join("/cache", pkgName),
+				"ContextDir": filepath.Join("/data", "lint"),
+				"DataDir":    filepath.Join("/data", pkgName),
+			},
+			"Ports":   map[string]map[string]string{},
+			"Profile": configProfileTemplateVars(ConfigProfileDefault),
+			"System": map[string]any{
+				"OS":            runtime.GOOS,
+				"Arch":          runtime.GOARCH,
+				"CPUs":          4,
+				"ARMMac":        false,
+				"MemoryMB":      uint64(16384),
+				"DiskFreeMB":    uint64(512000),
+				"DockerVersion": "27.4.1",
+			},
+		},
+	).WithVars(socketTemplateVars(p.socketMounts(Config{DataDir: "/data"}, "lint")))
+	return ret.WithFuncs(
+		template.FuncMap{
+			"freePort": func(port int) (int, error) {
+				return port, nil
+			},
+		},
+	)
+}
+
+// lintTemplateRef checks a template variable reference and returns a message
+// describing the problem, if any
+func (p Package) lintTemplateRef(ref []string, container bool) string {
+	refName := "." + strings.Join(ref, ".")
+	if ref[0] == "Container" {
+		if !container {
+			return fmt.Sprintf(
+				"template variable %s is only available in docker install steps",
+				refName,
+			)
+		}
+		if len(ref) > 1 && ref[1] != "Name" {
+			return fmt.Sprintf("undeclared template variable %s", refName)
+		}
+		return ""
+	}
+	knownKeys, ok := lintTemplateVars[ref[0]]
+	if !ok {
+		return fmt.Sprintf("undeclared template variable %s", refName)
+	}
+	if len(ref) < 2 || knownKeys == nil {
+		return ""
+	}
+	foundKey := false
+	for _, key := range knownKeys {
+		if key == ref[1] {
+			foundKey = true
+			break
+		}
+	}
+	if !foundKey {
+		return fmt.Sprintf("undeclared template variable %s", refName)
+	}
+	// Check that referenced package options are declared
+	if ref[0] == "Package" && ref[1] == "Options" && len(ref) > 2 {
+		for _, opt := range p.Options {
+			if opt.Name == ref[2] {
+				return ""
+			}
+		}
+		return fmt.Sprintf("template references undeclared package option %q", ref[2])
+	}
+	return ""
+}
+
+// templateFieldRefs returns the variable references relative to the root
+// template data. References inside of range/with blocks are ignored, since the
+// meaning of dot changes
+func templateFieldRefs(node parse.Node) [][]string {
+	var ret [][]string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case nil:
+			return
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			ret = append(ret, n.Ident)
+		case *parse.VariableNode:
+			// References via $ are always relative to the root
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				ret = append(ret, n.Ident[1:])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(node)
+	return ret
+}
+
+// lintHostPort returns the host port (with the host IP, if any) and protocol from a
+// port spec in the Docker -p flag format. The same host port can be used for
+// different protocols, so the protocol is included to avoid false duplicates. An
+// empty string is returned when the host port is chosen by Docker
+func lintHostPort(port string) string {
+	proto := "tcp"
+	if portSpec, portProto, ok := strings.Cut(port, "/"); ok {
+		port = portSpec
+		proto = portProto
+	}
+	portParts := strings.Split(port, ":")
+	switch len(portParts) {
+	case 2:
+		return portParts[0] + "/" + proto
+	case 3:
+		if portParts[1] == "" {
+			return ""
+		}
+		return portParts[0] + ":" + portParts[1] + "/" + proto
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackageLint(t *testing.T) {
+	availablePkgs := []Package{
+		{
+			Name:    "dep",
+			Version: "1.0.0",
+			Options: []PackageOption{
+				{Name: "foo"},
+			},
+		},
+	}
+	testDefs := []struct {
+		yaml     string
+		findings []string
+	}{
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\ninstallSteps:\n  - docker:\n      containerName: foo\n      image: foo:{{ .Package.Version }}\n      ports:\n        - \"{{ freePort 3001 }}:3001\"",
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\noptions:\n  - name: bar\n    default: true",
+			findings: []string{
+				"warning: description: package has no description",
+				`warning: options[0]: option "bar" has no description`,
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\npostInstallNotes: \"{{ .Foo }} {{ .Package.Options.baz }} {{ .Container.Name }}\"",
+			findings: []string{
+				"error: postInstallNotes: undeclared template variable .Foo",
+				`error: postInstallNotes: template references undeclared package option "baz"`,
+				"error: postInstallNotes: template variable .Container.Name is only available in docker install steps",
+			},
+		},
+		{
+			yaml: "specVersion: 2\nname: foo\nversion: 1.2.3\ndescription: foo\ndependencies:\n  - name: dep\n    condition: .Package.Options.baz",
+			findings: []string{
+				`error: dependencies[0].condition: template references undeclared package option "baz"`,
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\ndependencies:\n  - name: dep\n    condition: eq .Context.Network \"mainnet\"",
+			findings: []string{
+				"error: specVersion: field dependencies[].condition requires specVersion 2 or newer",
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\npostInstallNotes: \"{{ range .Ports }}{{ .Foo }}{{ end }}{{ .Paths.Bad \"",
+			findings: []string{
+				"error: postInstallNotes: template syntax error: template: parse:1: unclosed action",
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\ninstallSteps:\n  - docker:\n      containerName: foo\n      image: foo\n      ports:\n        - \"3001:3001\"\n  - docker:\n      containerName: bar\n      image: bar\n      ports:\n        - \"3001:3002\"",
+			findings: []string{
+				"error: installSteps[1].docker.ports[0]: host port 3001/tcp is also used by installSteps[0].docker.ports[0]",
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\ninstallSteps:\n  - docker:\n      containerName: foo\n      image: foo\n      ports:\n        - \"3001:3001\"\n        - \"3001:3001/udp\"",
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\ndependencies:\n  - dep >= 2.0.0\n  - dep[bar]\n  - missing",
+			findings: []string{
+				`warning: dependencies[0]: no available version of "dep" matches ">= 2.0.0"`,
+				`error: dependencies[1]: package "dep" has no option "bar"`,
+				`error: dependencies[2]: dependency references unknown package "missing"`,
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndescription: foo\npostInstallNotes: \"{{ if lt .System.MemoryMB 8192 }}low memory{{ end }} {{ .System.Foo }}\"",
+			findings: []string{
+				"error: postInstallNotes: undeclared template variable .System.Foo",
+			},
+		},
+	}
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.Template = NewTemplate(nil)
+	for _, testDef := range testDefs {
+		pkg, err := NewPackageFromReader(strings.NewReader(testDef.yaml))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		pkg.filePath = filepath.Join(
+			pkg.Name,
+			pkg.Name+"-"+pkg.Version+".yaml",
+		)
+		var findings []string
+		for _, finding := range pkg.lint(cfg, availablePkgs) {
+			findings = append(
+				findings,
+				string(finding.Severity)+": "+finding.String(),
+			)
+		}
+		if !reflect.DeepEqual(findings, testDef.findings) {
+			t.Fatalf(
+				"did not get expected findings\n  got: %#v\n  expected: %#v",
+				findings,
+				testDef.findings,
+			)
+		}
+	}
+}
+
+func TestLintHostPort(t *testing.T) {
+	testDefs := map[string]string{
+		"3001":                "",
+		"3001:3001":           "3001/tcp",
+		"3001:3001/tcp":       "3001/tcp",
+		"3001:3001/udp":       "3001/udp",
+		"127.0.0.1:3001:3001": "127.0.0.1:3001/tcp",
+		"127.0.0.1::3001":     "",
+	}
+	for port, expected := range testDefs {
+		if hostPort := lintHostPort(port); hostPort != expected {
+			t.Fatalf(
+				"did not get expected host port for %q: got %q, expected %q",
+				port,
+				hostPort,
+				expected,
+			)
+		}
+	}
+}
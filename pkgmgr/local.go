@@ -0,0 +1,92 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// localPackages loads packages from a package file or a directory of package
+// files on disk. Each returned package records the path as its origin
+func localPackages(cfg Config, path string) ([]Package, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Package
+	if stat.IsDir() {
+		tmpCfg := cfg
+		tmpCfg.RegistryDir = absPath
+		tmpPkgs, err := registryPackagesDir(tmpCfg, false)
+		if err != nil {
+			return nil, err
+		}
+		ret = tmpPkgs
+	} else {
+		tmpPkg, err := NewPackageFromFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		// Record on-disk path for package file
+		// This is used for relative paths for external file references
+		tmpPkg.filePath = absPath
+		if err := tmpPkg.loadComposeSources(); err != nil {
+			return nil, err
+		}
+		ret = append(ret, tmpPkg)
+	}
+	for idx := range ret {
+		ret[idx].origin = absPath
+	}
+	return ret, nil
+}
+
+// localPackageNames returns the sorted unique names of the provided packages
+func localPackageNames(pkgs []Package) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if seen[pkg.Name] {
+			continue
+		}
+		seen[pkg.Name] = true
+		ret = append(ret, pkg.Name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// overlayPackages replaces any packages with the same name as the provided
+// local packages
+func overlayPackages(pkgs []Package, localPkgs []Package) []Package {
+	localNames := make(map[string]bool)
+	for _, localPkg := range localPkgs {
+		localNames[localPkg.Name] = true
+	}
+	var ret []Package
+	for _, pkg := range pkgs {
+		if localNames[pkg.Name] {
+			continue
+		}
+		ret = append(ret, pkg)
+	}
+	return append(ret, localPkgs...)
+}
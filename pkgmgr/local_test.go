@@ -0,0 +1,110 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocalPackages(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgDir := filepath.Join(tmpDir, "foo")
+	if err := os.MkdirAll(pkgDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, pkgVersion := range []string{"1.0.0", "1.1.0"} {
+		pkgFile := filepath.Join(pkgDir, "foo-"+pkgVersion+".yaml")
+		pkgYaml := "name: foo\nversion: " + pkgVersion + "\n"
+		if err := os.WriteFile(pkgFile, []byte(pkgYaml), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Load from directory
+	pkgs, err := localPackages(cfg, pkgDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf(
+			"did not get expected number of packages: got %d, expected 2",
+			len(pkgs),
+		)
+	}
+	for _, pkg := range pkgs {
+		if pkg.origin != pkgDir {
+			t.Fatalf(
+				"did not get expected origin: got %q, expected %q",
+				pkg.origin,
+				pkgDir,
+			)
+		}
+	}
+	// Load from file
+	pkgFile := filepath.Join(pkgDir, "foo-1.0.0.yaml")
+	pkgs, err = localPackages(cfg, pkgFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf(
+			"did not get expected number of packages: got %d, expected 1",
+			len(pkgs),
+		)
+	}
+	if pkgs[0].origin != pkgFile || pkgs[0].filePath != pkgFile {
+		t.Fatalf(
+			"did not get expected origin/path: got %q/%q, expected %q",
+			pkgs[0].origin,
+			pkgs[0].filePath,
+			pkgFile,
+		)
+	}
+	installedPkg := NewInstalledPackage(pkgs[0], "default", "", nil, nil)
+	if installedPkg.Origin != pkgFile {
+		t.Fatalf(
+			"did not get expected installed package origin: got %q, expected %q",
+			installedPkg.Origin,
+			pkgFile,
+		)
+	}
+}
+
+func TestOverlayPackages(t *testing.T) {
+	pkgs := []Package{
+		{Name: "foo", Version: "2.0.0"},
+		{Name: "bar", Version: "1.0.0"},
+	}
+	localPkgs := []Package{
+		{Name: "foo", Version: "0.1.0", origin: "/tmp/foo"},
+	}
+	expected := []Package{
+		{Name: "bar", Version: "1.0.0"},
+		{Name: "foo", Version: "0.1.0", origin: "/tmp/foo"},
+	}
+	if ret := overlayPackages(pkgs, localPkgs); !reflect.DeepEqual(ret, expected) {
+		t.Fatalf(
+			"did not get expected packages\n  got: %#v\n  expected: %#v",
+			ret,
+			expected,
+		)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockFilename = "cardano-up.lock"
+
+	// lockPollInterval is how often the lock is retried while waiting for another process
+	lockPollInterval = 500 * time.Millisecond
+)
+
+// lock acquires the advisory operation lock shared by all cardano-up processes using the same
+// config dir, and reloads the state so that changes made by other processes aren't overwritten.
+// Mutating operations hold the lock until they finish. The returned func releases the lock. If
+// the lock is already held by this package manager, it's left for the outer operation to release
+func (p *PackageManager) lock() (func(), error) {
+	if p.lockFile != nil {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(p.config.ConfigDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	lockPath := filepath.Join(p.config.ConfigDir, lockFilename)
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %s", err)
+	}
+	locked, err := tryLockFile(lockFile)
+	if err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to lock %s: %s", lockPath, err)
+	}
+	if !locked {
+		if !p.config.WaitForLock {
+			lockFile.Close()
+			return nil, ErrOperationInProgress
+		}
+		p.config.Logger.Info(
+			"Waiting for another cardano-up operation to finish...",
+		)
+		ctx := p.config.ctx()
+		ticker := time.NewTicker(lockPollInterval)
+		defer ticker.Stop()
+		for !locked {
+			select {
+			case <-ctx.Done():
+				lockFile.Close()
+				return nil, ctx.Err()
+			case <-ticker.C:
+			}
+			locked, err = tryLockFile(lockFile)
+			if err != nil {
+				lockFile.Close()
+				return nil, fmt.Errorf("failed to lock %s: %s", lockPath, err)
+			}
+		}
+	}
+	p.lockFile = lockFile
+	unlock := func() {
+		if err := unlockFile(lockFile); err != nil {
+			p.config.Logger.Warn(
+				fmt.Sprintf("failed to release lock: %s", err),
+			)
+		}
+		lockFile.Close()
+		p.lockFile = nil
+	}
+	// Pick up any changes made by other processes before we acquired the lock
+	if err := p.reloadState(); err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to load state: %s", err)
+	}
+	p.initDockerHost()
+	p.initTemplate()
+	return unlock, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOperationLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm1, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm2, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	unlock, err := pm1.lock()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The lock is reentrant for operations on the same package manager
+	if err := pm1.AddContext("foo", Context{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm2.AddContext("bar", Context{}); !errors.Is(err, ErrOperationInProgress) {
+		t.Fatalf("did not get expected error while lock is held: %v", err)
+	}
+	// Waiting for the lock stops when the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	pm2.config.Context = ctx
+	pm2.config.WaitForLock = true
+	if err := pm2.AddContext("bar", Context{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("did not get expected error waiting for lock: %v", err)
+	}
+	pm2.config.Context = context.Background()
+	go func() {
+		time.Sleep(2 * lockPollInterval)
+		unlock()
+	}()
+	if err := pm2.AddContext("bar", Context{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Changes made by the other process should be picked up when the lock is acquired
+	contexts := pm2.Contexts()
+	if _, ok := contexts["foo"]; !ok {
+		t.Fatalf("did not find context added by other package manager: %#v", contexts)
+	}
+	if _, ok := contexts["bar"]; !ok {
+		t.Fatalf("did not find added context: %#v", contexts)
+	}
+	if pm2.lockFile != nil {
+		t.Fatalf("lock was not released")
+	}
+}
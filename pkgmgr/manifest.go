@@ -0,0 +1,455 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InstalledManifest is a snapshot of the installed packages, including the images used by their
+// containers and hashes of their files, which can be kept for auditing and later verified against
+// the live system
+type InstalledManifest struct {
+	GeneratedTime time.Time                  `json:"generatedTime"`
+	Packages      []InstalledManifestPackage `json:"packages"`
+}
+
+type InstalledManifestPackage struct {
+	Name          string                       `json:"name"`
+	Instance      string                       `json:"instance,omitempty"`
+	Version       string                       `json:"version"`
+	Context       string                       `json:"context"`
+	InstalledTime time.Time                    `json:"installedTime"`
+	Options       map[string]any               `json:"options,omitempty"`
+	Origin        string                       `json:"origin,omitempty"`
+	Containers    []InstalledManifestContainer `json:"containers,omitempty"`
+	Files         []InstalledManifestFile      `json:"files,omitempty"`
+}
+
+// InstanceName returns the name used to refer to the installed package
+func (m InstalledManifestPackage) InstanceName() string {
+	return packageInstanceName(m.Name, m.Instance)
+}
+
+// InstalledManifestContainer is the image for a container of an installed package. Images that
+// are only pulled have no container name
+type InstalledManifestContainer struct {
+	Name  string `json:"name,omitempty"`
+	Image string `json:"image"`
+	// ImageId is the content-addressable ID of the image, which identifies it across retags
+	ImageId     string   `json:"imageId,omitempty"`
+	RepoDigests []string `json:"repoDigests,omitempty"`
+}
+
+type InstalledManifestFile struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	Sha256 string `json:"sha256"`
+}
+
+// InstalledManifest returns a manifest of the installed packages in the active context, or in
+// all contexts
+func (p *PackageManager) InstalledManifest(allContexts bool) (InstalledManifest, error) {
+	installedPkgs := p.InstalledPackages()
+	if allContexts {
+		installedPkgs = p.InstalledPackagesAllContexts()
+	}
+	ret := InstalledManifest{
+		GeneratedTime: time.Now(),
+		Packages:      []InstalledManifestPackage{},
+	}
+	for _, installedPkg := range installedPkgs {
+		tmpPkg, err := p.installedManifestPackage(installedPkg)
+		if err != nil {
+			return InstalledManifest{}, err
+		}
+		ret.Packages = append(ret.Packages, tmpPkg)
+	}
+	sort.Slice(
+		ret.Packages,
+		func(i, j int) bool {
+			if ret.Packages[i].Context != ret.Packages[j].Context {
+				return ret.Packages[i].Context < ret.Packages[j].Context
+			}
+			return ret.Packages[i].InstanceName() < ret.Packages[j].InstanceName()
+		},
+	)
+	return ret, nil
+}
+
+// VerifyManifest checks the installed packages against a manifest, and returns a description of
+// each difference. Only packages in the contexts included in the manifest are checked
+func (p *PackageManager) VerifyManifest(manifest InstalledManifest) ([]string, error) {
+	current, err := p.InstalledManifest(true)
+	if err != nil {
+		return nil, err
+	}
+	return manifestMismatches(manifest, current), nil
+}
+
+func (p *PackageManager) installedManifestPackage(
+	installedPkg InstalledPackage,
+) (InstalledManifestPackage, error) {
+	pkg := installedPkg.Package
+	ret := InstalledManifestPackage{
+		Name:          pkg.Name,
+		Instance:      installedPkg.Instance,
+		Version:       pkg.Version,
+		Context:       installedPkg.Context,
+		InstalledTime: installedPkg.InstalledTime,
+		Options:       installedPkg.Options,
+		Origin:        installedPkg.Origin,
+	}
+	tmpl := p.installedPackageTemplate(installedPkg)
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		installedPkg.InstanceName(),
+		pkg.Version,
+		installedPkg.Context,
+	)
+	pkgDataDir := p.config.packageDataDir(pkgName)
+	for _, installStep := range pkg.InstallSteps {
+		if installStep.Condition != "" {
+			ok, err := tmpl.EvaluateCondition(installStep.Condition, nil)
+			if err != nil {
+				return InstalledManifestPackage{}, NewInstallStepConditionError(
+					installStep.Condition,
+					err,
+				)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if installStep.Docker != nil {
+			tmpContainer, err := p.installedManifestContainer(
+				tmpl,
+				pkgName,
+				installStep.Docker,
+			)
+			if err != nil {
+				return InstalledManifestPackage{}, err
+			}
+			ret.Containers = append(ret.Containers, tmpContainer)
+		}
+		if installStep.File != nil {
+			filenames, err := installStep.File.installedFilenames(tmpl, pkgDataDir)
+			if err != nil {
+				return InstalledManifestPackage{}, err
+			}
+			for _, filename := range filenames {
+				tmpFile, err := installedManifestFile(filepath.Join(pkgDataDir, filename))
+				if err != nil {
+					return InstalledManifestPackage{}, err
+				}
+				ret.Files = append(ret.Files, tmpFile)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// installedManifestContainer returns the image used by the container for a Docker install step.
+// Containers and images that no longer exist are returned with only the image reference
+func (p *PackageManager) installedManifestContainer(
+	tmpl *Template,
+	pkgName string,
+	step *PackageInstallStepDocker,
+) (InstalledManifestContainer, error) {
+	containerName := fmt.Sprintf("%s-%s", pkgName, step.ContainerName)
+	image, err := tmpl.Render(step.Image, containerTemplateVars(containerName))
+	if err != nil {
+		return InstalledManifestContainer{}, err
+	}
+	ret := InstalledManifestContainer{
+		Image: image,
+	}
+	imageRef := image
+	if !step.PullOnly {
+		ret.Name = containerName
+		svc, err := newDockerService(p.config, containerName)
+		if err != nil {
+			if err == ErrContainerNotExists {
+				return ret, nil
+			}
+			return InstalledManifestContainer{}, err
+		}
+		container, err := svc.inspect()
+		if err != nil {
+			return InstalledManifestContainer{}, err
+		}
+		// Use the image that the container was created from, which may since have been retagged
+		imageRef = container.Image
+	}
+	client, err := NewDockerClientForHost(p.config.DockerHost)
+	if err != nil {
+		return InstalledManifestContainer{}, err
+	}
+	defer client.Close()
+	imageInfo, _, err := client.ImageInspectWithRaw(p.config.ctx(), imageRef)
+	if err != nil {
+		p.config.Logger.Debug(
+			fmt.Sprintf("failed to inspect image %s: %s", imageRef, err),
+		)
+		return ret, nil
+	}
+	ret.ImageId = imageInfo.ID
+	ret.RepoDigests = imageInfo.RepoDigests
+	sort.Strings(ret.RepoDigests)
+	return ret, nil
+}
+
+// installedManifestFile returns the mode and hash of a file. Files that no longer exist are
+// returned with only the path
+func installedManifestFile(path string) (InstalledManifestFile, error) {
+	ret := InstalledManifestFile{
+		Path: path,
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ret, nil
+		}
+		return InstalledManifestFile{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return InstalledManifestFile{}, err
+	}
+	hash := sha256.Sum256(content)
+	ret.Mode = fmt.Sprintf("%04o", stat.Mode().Perm())
+	ret.Sha256 = hex.EncodeToString(hash[:])
+	return ret, nil
+}
+
+// manifestMismatches compares the expected manifest with the current one, and returns a
+// description of each difference. Only packages in the contexts of the expected manifest are
+// compared
+func manifestMismatches(expected InstalledManifest, current InstalledManifest) []string {
+	var ret []string
+	manifestKey := func(pkg InstalledManifestPackage) string {
+		return pkg.Context + "/" + pkg.InstanceName()
+	}
+	currentPkgs := make(map[string]InstalledManifestPackage)
+	for _, pkg := range current.Packages {
+		currentPkgs[manifestKey(pkg)] = pkg
+	}
+	expectedContexts := make(map[string]bool)
+	expectedPkgs := make(map[string]bool)
+	for _, expectedPkg := range expected.Packages {
+		expectedContexts[expectedPkg.Context] = true
+		expectedPkgs[manifestKey(expectedPkg)] = true
+		currentPkg, ok := currentPkgs[manifestKey(expectedPkg)]
+		if !ok {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"package %s is not installed in context %q",
+					expectedPkg.InstanceName(),
+					expectedPkg.Context,
+				),
+			)
+			continue
+		}
+		for _, mismatch := range manifestPackageMismatches(expectedPkg, currentPkg) {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"package %s in context %q: %s",
+					expectedPkg.InstanceName(),
+					expectedPkg.Context,
+					mismatch,
+				),
+			)
+		}
+	}
+	for _, currentPkg := range current.Packages {
+		if !expectedContexts[currentPkg.Context] || expectedPkgs[manifestKey(currentPkg)] {
+			continue
+		}
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"package %s is installed in context %q but not in the manifest",
+				currentPkg.InstanceName(),
+				currentPkg.Context,
+			),
+		)
+	}
+	return ret
+}
+
+func manifestPackageMismatches(
+	expected InstalledManifestPackage,
+	current InstalledManifestPackage,
+) []string {
+	var ret []string
+	if current.Version != expected.Version {
+		ret = append(
+			ret,
+			fmt.Sprintf("version is %s, expected %s", current.Version, expected.Version),
+		)
+	}
+	if !current.InstalledTime.Equal(expected.InstalledTime) {
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"installed at %s, expected %s",
+				current.InstalledTime.Format(time.RFC3339),
+				expected.InstalledTime.Format(time.RFC3339),
+			),
+		)
+	}
+	if manifestOptionsString(current.Options) != manifestOptionsString(expected.Options) {
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"options are [%s], expected [%s]",
+				manifestOptionsString(current.Options),
+				manifestOptionsString(expected.Options),
+			),
+		)
+	}
+	if current.Origin != expected.Origin {
+		ret = append(
+			ret,
+			fmt.Sprintf("origin is %q, expected %q", current.Origin, expected.Origin),
+		)
+	}
+	// Compare containers by name, and pulled images by reference
+	containerKey := func(container InstalledManifestContainer) string {
+		if container.Name != "" {
+			return "container " + container.Name
+		}
+		return "image " + container.Image
+	}
+	currentContainers := make(map[string]InstalledManifestContainer)
+	for _, container := range current.Containers {
+		currentContainers[containerKey(container)] = container
+	}
+	expectedContainers := make(map[string]bool)
+	for _, expectedContainer := range expected.Containers {
+		key := containerKey(expectedContainer)
+		expectedContainers[key] = true
+		currentContainer, ok := currentContainers[key]
+		if !ok {
+			ret = append(ret, key+" is no longer part of the package")
+			continue
+		}
+		if currentContainer.Image != expectedContainer.Image {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"%s uses image %s, expected %s",
+					key,
+					currentContainer.Image,
+					expectedContainer.Image,
+				),
+			)
+		}
+		if expectedContainer.ImageId == "" {
+			continue
+		}
+		if currentContainer.ImageId == "" {
+			ret = append(ret, key+" is missing")
+		} else if currentContainer.ImageId != expectedContainer.ImageId {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"%s uses image ID %s, expected %s",
+					key,
+					currentContainer.ImageId,
+					expectedContainer.ImageId,
+				),
+			)
+		}
+	}
+	for _, currentContainer := range current.Containers {
+		if key := containerKey(currentContainer); !expectedContainers[key] {
+			ret = append(ret, key+" is not in the manifest")
+		}
+	}
+	// Compare files by path
+	currentFiles := make(map[string]InstalledManifestFile)
+	for _, file := range current.Files {
+		currentFiles[file.Path] = file
+	}
+	expectedFiles := make(map[string]bool)
+	for _, expectedFile := range expected.Files {
+		expectedFiles[expectedFile.Path] = true
+		currentFile, ok := currentFiles[expectedFile.Path]
+		if !ok {
+			ret = append(
+				ret,
+				fmt.Sprintf("file %s is no longer part of the package", expectedFile.Path),
+			)
+			continue
+		}
+		if expectedFile.Sha256 == "" {
+			continue
+		}
+		if currentFile.Sha256 == "" {
+			ret = append(ret, fmt.Sprintf("file %s is missing", expectedFile.Path))
+			continue
+		}
+		if currentFile.Sha256 != expectedFile.Sha256 {
+			ret = append(ret, fmt.Sprintf("file %s has been modified", expectedFile.Path))
+		}
+		if currentFile.Mode != expectedFile.Mode {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"file %s has mode %s, expected %s",
+					expectedFile.Path,
+					currentFile.Mode,
+					expectedFile.Mode,
+				),
+			)
+		}
+	}
+	for _, currentFile := range current.Files {
+		if !expectedFiles[currentFile.Path] {
+			ret = append(ret, fmt.Sprintf("file %s is not in the manifest", currentFile.Path))
+		}
+	}
+	return ret
+}
+
+// manifestOptionsString returns the enabled boolean options and the values of other options in
+// sorted order, for comparison
+func manifestOptionsString(opts map[string]any) string {
+	var ret []string
+	for opt, val := range opts {
+		switch v := val.(type) {
+		case bool:
+			if v {
+				ret = append(ret, opt)
+			}
+		default:
+			ret = append(ret, fmt.Sprintf("%s=%v", opt, v))
+		}
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
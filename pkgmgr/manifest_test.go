@@ -0,0 +1,168 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInstalledManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	installedTime := time.Now()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "tool",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						File: &PackageInstallStepFile{
+							Filename: "config-{{ .Package.ShortName }}.json",
+						},
+					},
+					{
+						Condition: "false",
+						File: &PackageInstallStepFile{
+							Filename: "skipped.json",
+						},
+					},
+				},
+			},
+			Context:       "default",
+			InstalledTime: installedTime,
+			Options:       map[string]any{"foo": true, "bar": false},
+		},
+	}
+	filePath := filepath.Join(cfg.DataDir, "tool-1.0.0-default", "config-tool.json")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filePath, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	manifest, err := pm.InstalledManifest(false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedFiles := []InstalledManifestFile{
+		{
+			Path:   filePath,
+			Mode:   "0644",
+			Sha256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+		},
+	}
+	if len(manifest.Packages) != 1 ||
+		!reflect.DeepEqual(manifest.Packages[0].Files, expectedFiles) {
+		t.Fatalf("did not get expected manifest: %#v", manifest)
+	}
+	mismatches, err := pm.VerifyManifest(manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("got unexpected mismatches: %v", mismatches)
+	}
+	if err := os.WriteFile(filePath, []byte("{\"foo\": 1}"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	mismatches, err = pm.VerifyManifest(manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedMismatches := []string{
+		`package tool in context "default": file ` + filePath + ` has been modified`,
+	}
+	if !reflect.DeepEqual(mismatches, expectedMismatches) {
+		t.Fatalf(
+			"did not get expected mismatches\n  got: %v\n  expected: %v",
+			mismatches,
+			expectedMismatches,
+		)
+	}
+}
+
+func TestManifestMismatches(t *testing.T) {
+	installedTime := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expected := InstalledManifest{
+		Packages: []InstalledManifestPackage{
+			{
+				Name:          "node",
+				Version:       "1.0.0",
+				Context:       "default",
+				InstalledTime: installedTime,
+				Options:       map[string]any{"mithril": true},
+				Containers: []InstalledManifestContainer{
+					{Name: "node-1.0.0-default-node", Image: "node:1.0.0", ImageId: "sha256:aaa"},
+					{Image: "tool:1.0.0", ImageId: "sha256:bbb"},
+				},
+				Files: []InstalledManifestFile{
+					{Path: "/data/config.json", Mode: "0644", Sha256: "abc"},
+				},
+			},
+			{Name: "gone", Version: "1.0.0", Context: "default", InstalledTime: installedTime},
+		},
+	}
+	current := InstalledManifest{
+		Packages: []InstalledManifestPackage{
+			{
+				Name:          "node",
+				Version:       "1.0.0",
+				Context:       "default",
+				InstalledTime: installedTime,
+				Options:       map[string]any{"mithril": true, "other": false},
+				Containers: []InstalledManifestContainer{
+					{Name: "node-1.0.0-default-node", Image: "node:1.0.0", ImageId: "sha256:ccc"},
+					{Image: "tool:1.0.0"},
+				},
+				Files: []InstalledManifestFile{
+					{Path: "/data/config.json", Mode: "0600", Sha256: "abc"},
+				},
+			},
+			{Name: "extra", Version: "1.0.0", Context: "default", InstalledTime: installedTime},
+			// Packages in other contexts are ignored
+			{Name: "other", Version: "1.0.0", Context: "other", InstalledTime: installedTime},
+		},
+	}
+	expectedMismatches := []string{
+		`package node in context "default": container node-1.0.0-default-node uses image ID sha256:ccc, expected sha256:aaa`,
+		`package node in context "default": image tool:1.0.0 is missing`,
+		`package node in context "default": file /data/config.json has mode 0600, expected 0644`,
+		`package gone is not installed in context "default"`,
+		`package extra is installed in context "default" but not in the manifest`,
+	}
+	mismatches := manifestMismatches(expected, current)
+	if !reflect.DeepEqual(mismatches, expectedMismatches) {
+		t.Fatalf(
+			"did not get expected mismatches\n  got: %v\n  expected: %v",
+			mismatches,
+			expectedMismatches,
+		)
+	}
+}
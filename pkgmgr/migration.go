@@ -0,0 +1,269 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// migrationsFilename is the file in the config dir with the progress of package data
+	// migrations for upgrades that haven't finished
+	migrationsFilename = "migrations.yaml"
+
+	// migrationEvent is provided to migrations in CARDANO_UP_EVENT
+	migrationEvent = "migrate"
+)
+
+// migrationNameRe matches valid names for package migrations
+var migrationNameRe = regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+
+// PackageMigration is a script or command that migrates the package data when upgrading from a
+// version older than Version to Version or newer. Migrations run in version order between
+// removing the old version and installing the new one
+type PackageMigration struct {
+	// Name identifies the migration when recording which migrations have finished
+	Name        string `yaml:"name" jsonschema:"required"`
+	Description string `yaml:"description,omitempty"`
+	// Version is the package version that first needs the migrated data
+	Version string `yaml:"version" jsonschema:"required"`
+	// Script is run with the host shell, the same as hook scripts
+	Script string `yaml:"script,omitempty"`
+	// Command is run without a shell, with each element evaluated as a template
+	Command []string `yaml:"command,omitempty"`
+}
+
+func (m PackageMigration) validate() error {
+	if !migrationNameRe.MatchString(m.Name) {
+		return fmt.Errorf("invalid migration name: %q", m.Name)
+	}
+	if _, err := version.NewVersion(m.Version); err != nil {
+		return fmt.Errorf("migration %s has malformed version: %s", m.Name, err)
+	}
+	if (m.Script == "") == (len(m.Command) == 0) {
+		return fmt.Errorf("migration %s must specify exactly one of script or command", m.Name)
+	}
+	if len(m.Command) > 0 && m.Command[0] == "" {
+		return fmt.Errorf("migration %s must specify a command to run", m.Name)
+	}
+	return nil
+}
+
+// validateMigrations checks the migrations of a package, which must have unique names and can't
+// be for a version newer than the package
+func (p Package) validateMigrations() error {
+	migrationNames := make(map[string]bool)
+	for _, migration := range p.Migrations {
+		if err := migration.validate(); err != nil {
+			return err
+		}
+		if migrationNames[migration.Name] {
+			return fmt.Errorf("duplicate migration: %s", migration.Name)
+		}
+		migrationNames[migration.Name] = true
+		if versionNewer(migration.Version, p.Version) {
+			return fmt.Errorf(
+				"migration %s is for version %s, which is newer than the package",
+				migration.Name,
+				migration.Version,
+			)
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations needed when upgrading the package from the specified
+// version, in version order. Migrations for the same version keep their order in the manifest
+func (p Package) pendingMigrations(fromVersion string) []PackageMigration {
+	var ret []PackageMigration
+	for _, migration := range p.Migrations {
+		if !versionNewer(migration.Version, fromVersion) ||
+			versionNewer(migration.Version, p.Version) {
+			continue
+		}
+		ret = append(ret, migration)
+	}
+	sort.SliceStable(
+		ret,
+		func(i, j int) bool {
+			return versionNewer(ret[j].Version, ret[i].Version)
+		},
+	)
+	return ret
+}
+
+// MigrationProgress records the migrations that have finished for an upgrade of a package, so
+// that an interrupted upgrade resumes with the next migration
+type MigrationProgress struct {
+	FromVersion string   `yaml:"fromVersion"`
+	Completed   []string `yaml:"completed"`
+}
+
+// MigrationRegistry holds the progress of package data migrations, keyed by the context and
+// instance name of the package
+type MigrationRegistry map[string]MigrationProgress
+
+func (s *State) loadMigrations() error {
+	if err := s.loadFile(migrationsFilename, &(s.Migrations)); err != nil {
+		return err
+	}
+	if s.Migrations == nil {
+		s.Migrations = make(MigrationRegistry)
+	}
+	return nil
+}
+
+// saveMigrations writes the migration progress. It's saved as soon as each migration finishes,
+// separately from the rest of the state, so that the progress survives an interrupted upgrade
+func (s *State) saveMigrations() error {
+	content, err := yaml.Marshal(&(s.Migrations))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.config.ConfigDir, os.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.config.ConfigDir, migrationsFilename), content)
+}
+
+// runMigrations runs the pending migrations for upgrading an installed package, skipping those
+// that finished during an earlier attempt at the same upgrade
+func (p *PackageManager) runMigrations(
+	upgradePkg ResolverUpgradeSet,
+	cfg Config,
+	context string,
+) error {
+	if upgradePkg.Installed.IsEmpty() {
+		return nil
+	}
+	oldPkg := upgradePkg.Installed.Package
+	newPkg := upgradePkg.Upgrade
+	migrations := newPkg.pendingMigrations(oldPkg.Version)
+	if len(migrations) == 0 {
+		return nil
+	}
+	owner := portOwner(newPkg, context)
+	progress := p.state.Migrations[owner]
+	if progress.FromVersion != oldPkg.Version {
+		progress = MigrationProgress{FromVersion: oldPkg.Version}
+	}
+	completed := make(map[string]bool)
+	for _, name := range progress.Completed {
+		completed[name] = true
+	}
+	oldPkgName := fmt.Sprintf("%s-%s-%s", oldPkg.instanceName(), oldPkg.Version, context)
+	newPkgName := fmt.Sprintf("%s-%s-%s", newPkg.instanceName(), newPkg.Version, context)
+	// The migrations can write to the dirs for the new version before it's installed
+	for _, tmpDir := range []string{
+		cfg.packageDataDir(newPkgName),
+		filepath.Join(cfg.CacheDir, newPkgName),
+	} {
+		if err := os.MkdirAll(tmpDir, fs.ModePerm); err != nil {
+			return err
+		}
+	}
+	cfg.Template = cfg.Template.WithVars(
+		newPkg.templateVars(cfg, context, upgradePkg.Installed.Options),
+	)
+	// The origin decides whether the migrations are trusted
+	newPkg.origin = upgradePkg.Installed.Origin
+	for _, migration := range migrations {
+		if completed[migration.Name] {
+			p.config.Logger.Info(
+				fmt.Sprintf(
+					"Skipping migration %s for package %s, which finished during an earlier upgrade",
+					migration.Name,
+					newPkgName,
+				),
+			)
+			continue
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf("Running migration %s for package %s", migration.Name, newPkgName),
+		)
+		err := newPkg.runMigration(cfg, newPkgName, oldPkgName, oldPkg.Version, migration)
+		if err != nil {
+			return NewMigrationFailedError(migration.Name, newPkgName, err)
+		}
+		progress.Completed = append(progress.Completed, migration.Name)
+		p.state.Migrations[owner] = progress
+		if err := p.state.saveMigrations(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearMigrations removes the recorded migration progress for a package once the upgrade has
+// finished, or when the migrated data has been discarded
+func (p *PackageManager) clearMigrations(pkg Package, context string) {
+	owner := portOwner(pkg, context)
+	if _, ok := p.state.Migrations[owner]; !ok {
+		return
+	}
+	delete(p.state.Migrations, owner)
+	if err := p.state.saveMigrations(); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to save migration progress: %s", err),
+		)
+	}
+}
+
+func (p Package) runMigration(
+	cfg Config,
+	pkgName string,
+	oldPkgName string,
+	fromVersion string,
+	migration PackageMigration,
+) error {
+	hook := "migration " + migration.Name
+	env := p.hookEnv(cfg, pkgName, hook)
+	env["CARDANO_UP_EVENT"] = migrationEvent
+	env["CARDANO_UP_MIGRATION"] = migration.Name
+	env["CARDANO_UP_FROM_VERSION"] = fromVersion
+	env["CARDANO_UP_FROM_DATA_DIR"] = cfg.packageDataDir(oldPkgName)
+	hookCmd := hookCommand{
+		hook: hook,
+		env:  env,
+		dirs: append(hookDirs(cfg, pkgName), cfg.packageDataDir(oldPkgName)),
+	}
+	if migration.Script != "" {
+		renderedScript, err := cfg.Template.Render(migration.Script, nil)
+		if err != nil {
+			return fmt.Errorf("failed to render migration script template: %s", err)
+		}
+		hookCmd.args = []string{"/bin/sh", "-c", renderedScript}
+		hookCmd.script = renderedScript
+	} else {
+		for _, arg := range migration.Command {
+			renderedArg, err := cfg.Template.Render(arg, nil)
+			if err != nil {
+				return fmt.Errorf("failed to render migration command template: %s", err)
+			}
+			hookCmd.args = append(hookCmd.args, renderedArg)
+		}
+		hookCmd.script = strings.Join(hookCmd.args, " ")
+	}
+	return p.runHookCommand(cfg, pkgName, hookCmd)
+}
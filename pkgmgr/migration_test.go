@@ -0,0 +1,193 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageValidateMigrations(t *testing.T) {
+	testDefs := []struct {
+		Migrations []PackageMigration
+		Valid      bool
+	}{
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-13", Version: "2.0.0", Script: "true"},
+				{Name: "config-format", Version: "1.5.0", Command: []string{"true"}},
+			},
+			Valid: true,
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "bad name", Version: "2.0.0", Script: "true"},
+			},
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-13", Version: "latest", Script: "true"},
+			},
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-13", Version: "2.0.0"},
+			},
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-13", Version: "2.0.0", Script: "true", Command: []string{"true"}},
+			},
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-13", Version: "2.0.0", Script: "true"},
+				{Name: "schema-13", Version: "1.5.0", Script: "true"},
+			},
+		},
+		{
+			Migrations: []PackageMigration{
+				{Name: "schema-14", Version: "2.1.0", Script: "true"},
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		pkg := Package{Name: "foo", Version: "2.0.0", Migrations: testDef.Migrations}
+		err := pkg.validateMigrations()
+		if testDef.Valid && err != nil {
+			t.Fatalf("unexpected error for migrations %#v: %s", testDef.Migrations, err)
+		}
+		if !testDef.Valid && err == nil {
+			t.Fatalf("did not get expected error for migrations %#v", testDef.Migrations)
+		}
+	}
+}
+
+func TestPackagePendingMigrations(t *testing.T) {
+	pkg := Package{
+		Name:    "foo",
+		Version: "3.0.0",
+		Migrations: []PackageMigration{
+			{Name: "c", Version: "3.0.0"},
+			{Name: "a", Version: "2.0.0"},
+			{Name: "old", Version: "1.0.0"},
+			{Name: "b", Version: "2.0.0"},
+		},
+	}
+	testDefs := []struct {
+		FromVersion string
+		Expected    []string
+	}{
+		{FromVersion: "1.0.0", Expected: []string{"a", "b", "c"}},
+		{FromVersion: "2.0.0", Expected: []string{"c"}},
+		{FromVersion: "3.0.0"},
+	}
+	for _, testDef := range testDefs {
+		var names []string
+		for _, migration := range pkg.pendingMigrations(testDef.FromVersion) {
+			names = append(names, migration.Name)
+		}
+		if !reflect.DeepEqual(names, testDef.Expected) {
+			t.Fatalf(
+				"did not get expected migrations from version %s: got %v, expected %v",
+				testDef.FromVersion,
+				names,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestRunMigrationsResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	markerFile := filepath.Join(tmpDir, "marker")
+	cfg := Config{
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(map[string]any{"Marker": markerFile}),
+		Hooks:     HookConfig{TrustAll: true},
+	}
+	pm := &PackageManager{
+		config: cfg,
+		state:  NewState(cfg),
+	}
+	installedPkg := InstalledPackage{
+		Package:       Package{Name: "foo", Version: "1.0.0"},
+		Context:       "default",
+		InstalledTime: time.Now(),
+	}
+	upgradePkg := ResolverUpgradeSet{
+		Installed: installedPkg,
+		Upgrade: Package{
+			Name:    "foo",
+			Version: "3.0.0",
+			Migrations: []PackageMigration{
+				{
+					Name:    "first",
+					Version: "2.0.0",
+					Script:  `echo "$CARDANO_UP_MIGRATION $CARDANO_UP_FROM_VERSION" >> "$CARDANO_UP_DATA_DIR/migrated"`,
+				},
+				{
+					Name:    "second",
+					Version: "3.0.0",
+					Command: []string{"test", "-f", "{{ .Marker }}"},
+				},
+			},
+		},
+	}
+	installCfg := cfg
+	installCfg.contextName = "default"
+	// The second migration fails until the marker file exists
+	if err := pm.runMigrations(upgradePkg, installCfg, "default"); err == nil {
+		t.Fatalf("did not get expected error for failed migration")
+	}
+	state := NewState(cfg)
+	if err := state.Load(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedProgress := MigrationProgress{FromVersion: "1.0.0", Completed: []string{"first"}}
+	if progress := state.Migrations["default/foo"]; !reflect.DeepEqual(progress, expectedProgress) {
+		t.Fatalf(
+			"did not get expected migration progress\n  got: %#v\n  expected: %#v",
+			progress,
+			expectedProgress,
+		)
+	}
+	// The next attempt resumes with the migration that failed
+	if err := os.WriteFile(markerFile, nil, 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.runMigrations(upgradePkg, installCfg, "default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(cfg.DataDir, "foo-3.0.0-default", "migrated"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != "first 1.0.0\n" {
+		t.Fatalf("did not get expected migration output: %q", content)
+	}
+	pm.clearMigrations(upgradePkg.Upgrade, "default")
+	if _, ok := pm.state.Migrations["default/foo"]; ok {
+		t.Fatalf("migration progress was not cleared")
+	}
+}
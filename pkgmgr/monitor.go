@@ -0,0 +1,258 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	monitorActionUnhealthy = "health_status: unhealthy"
+)
+
+// monitorEventActions are the Docker container event actions watched by the monitor. Kill and
+// start events are used to tell intentional stops apart from failures
+var monitorEventActions = []string{
+	"start",
+	"kill",
+	"die",
+	"oom",
+	"health_status",
+}
+
+// MonitorConfig holds the notification hooks triggered by the monitor
+type MonitorConfig struct {
+	// Command is a shell command to run for each alert. Details about the alert are provided
+	// via CARDANO_UP_ALERT_* env vars
+	Command string
+	// WebhookUrl is a URL to send a JSON POST request to for each alert
+	WebhookUrl string
+}
+
+// Monitor watches containers for installed packages and triggers the configured notification
+// hooks when a container dies unexpectedly, runs out of memory, or becomes unhealthy. It runs
+// until the config context is cancelled
+func (p *PackageManager) Monitor(monitorCfg MonitorConfig) error {
+	p.config.Logger.Info(
+		"Monitoring containers for installed packages",
+	)
+	m := &monitor{
+		pm:          p,
+		cfg:         monitorCfg,
+		pendingKill: make(map[string]bool),
+		pendingOom:  make(map[string]bool),
+	}
+	return p.ContainerEvents(
+		monitorEventActions,
+		time.Now(),
+		true,
+		m.handleEvent,
+	)
+}
+
+type monitor struct {
+	pm  *PackageManager
+	cfg MonitorConfig
+	// pendingKill tracks containers that were sent a stop signal, so that the resulting die event
+	// isn't treated as a failure
+	pendingKill map[string]bool
+	// pendingOom tracks containers that ran out of memory, so that the resulting die event isn't
+	// alerted on a second time
+	pendingOom map[string]bool
+}
+
+func (m *monitor) handleEvent(evt ContainerEvent) {
+	if m.shouldAlert(evt) {
+		m.alert(evt)
+	}
+}
+
+// shouldAlert returns whether an alert should be sent for the event, updating the tracked
+// container state as needed
+func (m *monitor) shouldAlert(evt ContainerEvent) bool {
+	switch evt.Action {
+	case "start":
+		delete(m.pendingKill, evt.ContainerName)
+		delete(m.pendingOom, evt.ContainerName)
+	case "kill":
+		// Other signals, such as SIGHUP to reload the topology, don't stop the container
+		if evt.isStopSignal() {
+			m.pendingKill[evt.ContainerName] = true
+		}
+	case "die":
+		if m.pendingKill[evt.ContainerName] {
+			delete(m.pendingKill, evt.ContainerName)
+			delete(m.pendingOom, evt.ContainerName)
+			m.pm.config.Logger.Debug(
+				fmt.Sprintf(
+					"ignoring intentional stop of container %s",
+					evt.ContainerName,
+				),
+			)
+			return false
+		}
+		if m.pendingOom[evt.ContainerName] {
+			delete(m.pendingOom, evt.ContainerName)
+			return false
+		}
+		return true
+	case "oom":
+		m.pendingOom[evt.ContainerName] = true
+		return true
+	case monitorActionUnhealthy:
+		return true
+	}
+	return false
+}
+
+// linuxSignalNumbers maps signal names to the numbers reported in Docker kill events. These are
+// the Linux signal numbers, since that's what containers run on
+var linuxSignalNumbers = map[string]string{
+	"SIGHUP":  "1",
+	"SIGINT":  "2",
+	"SIGQUIT": "3",
+	"SIGKILL": "9",
+	"SIGUSR1": "10",
+	"SIGUSR2": "12",
+	"SIGTERM": "15",
+}
+
+// isStopSignal returns whether a kill event is for a signal used to stop the container. This is
+// SIGTERM, SIGKILL, or the stop signal configured for the container
+func (e ContainerEvent) isStopSignal() bool {
+	switch e.Signal {
+	// Older Docker versions don't report the signal
+	case "", linuxSignalNumbers["SIGTERM"], linuxSignalNumbers["SIGKILL"]:
+		return true
+	}
+	if e.stopSignal == "" {
+		return false
+	}
+	stopSignal := strings.ToUpper(e.stopSignal)
+	if !strings.HasPrefix(stopSignal, "SIG") {
+		// Numeric signals are used as-is
+		if _, err := strconv.Atoi(stopSignal); err == nil {
+			return e.Signal == stopSignal
+		}
+		stopSignal = "SIG" + stopSignal
+	}
+	return e.Signal == linuxSignalNumbers[stopSignal]
+}
+
+func (m *monitor) alert(evt ContainerEvent) {
+	logger := m.pm.config.Logger
+	msg := fmt.Sprintf(
+		"container %s for package %s (= %s) in context %q: %s",
+		evt.Container,
+		evt.Package,
+		evt.Version,
+		evt.Context,
+		evt.Action,
+	)
+	if evt.ExitCode != "" {
+		msg += fmt.Sprintf(" (exit code %s)", evt.ExitCode)
+	}
+	logger.Warn(
+		msg,
+		EventAttr(EventContainerAlert),
+		slog.String("action", evt.Action),
+		slog.String("package", evt.Package),
+		slog.String("context", evt.Context),
+		slog.String("container", evt.Container),
+	)
+	if m.cfg.Command != "" {
+		if err := m.runCommand(evt); err != nil {
+			logger.Error(
+				fmt.Sprintf("alert command failed: %s", err),
+			)
+		}
+	}
+	if m.cfg.WebhookUrl != "" {
+		if err := m.sendWebhook(evt); err != nil {
+			logger.Error(
+				fmt.Sprintf("alert webhook failed: %s", err),
+			)
+		}
+	}
+}
+
+func (m *monitor) runCommand(evt ContainerEvent) error {
+	cmd := exec.CommandContext(
+		m.pm.config.ctx(),
+		"/bin/sh",
+		"-c",
+		m.cfg.Command,
+	)
+	cmd.Env = append(os.Environ(), evt.alertEnv()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (m *monitor) sendWebhook(evt ContainerEvent) error {
+	body, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		m.pm.config.ctx(),
+		http.MethodPost,
+		m.cfg.WebhookUrl,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpDo(m.pm.config, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// alertEnv returns the env vars provided to the alert command
+func (e ContainerEvent) alertEnv() []string {
+	vars := map[string]string{
+		"TIME":      e.Time.UTC().Format(time.RFC3339),
+		"ACTION":    e.Action,
+		"PACKAGE":   e.Package,
+		"VERSION":   e.Version,
+		"CONTEXT":   e.Context,
+		"CONTAINER": e.Container,
+		"EXIT_CODE": e.ExitCode,
+	}
+	var ret []string
+	for k, v := range vars {
+		ret = append(
+			ret,
+			fmt.Sprintf("CARDANO_UP_ALERT_%s=%s", k, strings.TrimSpace(v)),
+		)
+	}
+	return ret
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMonitorShouldAlert(t *testing.T) {
+	testDefs := []struct {
+		name       string
+		actions    []string
+		alerts     []bool
+		signals    []string
+		stopSignal string
+	}{
+		{
+			name:    "docker stop",
+			actions: []string{"kill", "die", "stop"},
+			alerts:  []bool{false, false, false},
+		},
+		{
+			name:    "crash",
+			actions: []string{"start", "die"},
+			alerts:  []bool{false, true},
+		},
+		{
+			name:    "out of memory",
+			actions: []string{"oom", "die"},
+			alerts:  []bool{true, false},
+		},
+		{
+			name:    "crash after out of memory and restart",
+			actions: []string{"oom", "die", "start", "die"},
+			alerts:  []bool{true, false, false, true},
+		},
+		{
+			name:    "crash after restart",
+			actions: []string{"kill", "die", "start", "die"},
+			alerts:  []bool{false, false, false, true},
+		},
+		{
+			name:    "reload signal then crash",
+			actions: []string{"kill", "die"},
+			signals: []string{"1", ""},
+			alerts:  []bool{false, true},
+		},
+		{
+			name:       "custom stop signal",
+			actions:    []string{"kill", "die"},
+			signals:    []string{"2", ""},
+			stopSignal: "SIGINT",
+			alerts:     []bool{false, false},
+		},
+		{
+			name:    "sigterm stop",
+			actions: []string{"kill", "die"},
+			signals: []string{"15", ""},
+			alerts:  []bool{false, false},
+		},
+		{
+			name:    "health status",
+			actions: []string{"health_status: healthy", monitorActionUnhealthy},
+			alerts:  []bool{false, true},
+		},
+	}
+	for _, testDef := range testDefs {
+		m := &monitor{
+			pm: &PackageManager{
+				config: Config{
+					Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				},
+			},
+			pendingKill: make(map[string]bool),
+			pendingOom:  make(map[string]bool),
+		}
+		for idx, action := range testDef.actions {
+			evt := ContainerEvent{
+				Action:        action,
+				ContainerName: "foo-1.0.0-default-foo",
+				stopSignal:    testDef.stopSignal,
+			}
+			if testDef.signals != nil {
+				evt.Signal = testDef.signals[idx]
+			}
+			alert := m.shouldAlert(evt)
+			if alert != testDef.alerts[idx] {
+				t.Fatalf(
+					"%s: did not get expected alert for event %d (%s): got %v, expected %v",
+					testDef.name,
+					idx,
+					action,
+					alert,
+					testDef.alerts[idx],
+				)
+			}
+		}
+	}
+}
+
+func TestMonitorSendWebhook(t *testing.T) {
+	var gotEvt ContainerEvent
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&gotEvt); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	defer server.Close()
+	m := &monitor{
+		pm: &PackageManager{
+			config: Config{
+				Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			},
+		},
+		cfg: MonitorConfig{
+			WebhookUrl: server.URL,
+		},
+	}
+	evt := ContainerEvent{
+		Action:    "die",
+		Package:   "foo",
+		Version:   "1.0.0",
+		Context:   "default",
+		Container: "foo",
+		ExitCode:  "137",
+	}
+	if err := m.sendWebhook(evt); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if gotEvt != evt {
+		t.Fatalf("did not get expected event: got %#v, expected %#v", gotEvt, evt)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcPath returns the path to the user's netrc file, honoring the NETRC env var
+func netrcPath() (string, error) {
+	if path, ok := os.LookupEnv("NETRC"); ok {
+		return path, nil
+	}
+	userHomeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userHomeDir, ".netrc"), nil
+}
+
+// netrcCredentials looks up the login and password for the given host in the user's netrc file.
+// A missing netrc file is not treated as an error
+func netrcCredentials(host string) (string, string, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return "", "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	defer f.Close()
+	login, password := parseNetrc(f, host)
+	return login, password, nil
+}
+
+// parseNetrc returns the login and password for the given host from netrc content. The
+// "default" entry is used when no matching "machine" entry is found
+func parseNetrc(r io.Reader, host string) (string, string) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", ""
+	}
+	var login, password string
+	var defLogin, defPassword string
+	var inMachine, inDefault, found bool
+	tokens := strings.Fields(string(data))
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if found {
+				return login, password
+			}
+			inDefault = false
+			inMachine = false
+			if i+1 < len(tokens) {
+				i++
+				if tokens[i] == host {
+					inMachine = true
+					found = true
+				}
+			}
+		case "default":
+			if found {
+				return login, password
+			}
+			inMachine = false
+			inDefault = true
+		case "login", "password":
+			if i+1 >= len(tokens) {
+				break
+			}
+			key := tokens[i]
+			i++
+			val := tokens[i]
+			if inMachine {
+				if key == "login" {
+					login = val
+				} else {
+					password = val
+				}
+			} else if inDefault {
+				if key == "login" {
+					defLogin = val
+				} else {
+					defPassword = val
+				}
+			}
+		case "account":
+			// Skip the value
+			i++
+		case "macdef":
+			// Macro definitions run until a blank line, which we can't detect after
+			// splitting into fields, so we stop processing here
+			if found {
+				return login, password
+			}
+			return defLogin, defPassword
+		}
+	}
+	if found {
+		return login, password
+	}
+	return defLogin, defPassword
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	testNetrc := `machine example.com
+  login foo
+  password bar
+
+machine registry.example.com login baz password qux
+
+default login anon password anonpass
+`
+	testDefs := []struct {
+		Host     string
+		Login    string
+		Password string
+	}{
+		{
+			Host:     "example.com",
+			Login:    "foo",
+			Password: "bar",
+		},
+		{
+			Host:     "registry.example.com",
+			Login:    "baz",
+			Password: "qux",
+		},
+		{
+			Host:     "other.example.com",
+			Login:    "anon",
+			Password: "anonpass",
+		},
+	}
+	for _, testDef := range testDefs {
+		login, password := parseNetrc(strings.NewReader(testNetrc), testDef.Host)
+		if login != testDef.Login || password != testDef.Password {
+			t.Fatalf(
+				"did not get expected credentials for host %q: got %q/%q, expected %q/%q",
+				testDef.Host,
+				login,
+				password,
+				testDef.Login,
+				testDef.Password,
+			)
+		}
+	}
+}
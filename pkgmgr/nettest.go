@@ -0,0 +1,456 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	ouroboros "github.com/blinklabs-io/gouroboros"
+)
+
+const (
+	// DefaultNetTestIpCheckerUrl is used to look up the public IP of the host. It responds with
+	// the IP of the client as plain text
+	DefaultNetTestIpCheckerUrl = "https://api.ipify.org"
+
+	defaultNetTestTimeout = 10 * time.Second
+
+	// nodeP2PContainerPort is the port that cardano-node listens on for P2P connections by
+	// convention, which is preferred when the node container publishes several ports
+	nodeP2PContainerPort = 3001
+)
+
+// NetTestConfig controls the checks run by NetTest
+type NetTestConfig struct {
+	// Port is the host port for P2P connections to the node. It's detected from the ports
+	// published by the node container if not provided
+	Port uint
+	// PublicAddress is the public IP or hostname of the node. It's looked up with IpCheckerUrl if
+	// not provided
+	PublicAddress string
+	// IpCheckerUrl is a URL that responds with the public IP of the client. The public address
+	// checks are skipped if neither this nor PublicAddress are provided
+	IpCheckerUrl string
+	// CheckerUrl is the URL of an external service that checks whether the node port is reachable
+	// from outside, which is used instead of connecting to the public address. It's evaluated as a
+	// template with the .Host and .Port vars, and a 2xx response means that the port is reachable
+	CheckerUrl string
+	// Relays are checked in addition to the managed topology peers in the active context
+	Relays []TopologyPeer
+	// Timeout is the timeout for each check
+	Timeout time.Duration
+}
+
+// NetTestCheck is the result of a single network check
+type NetTestCheck struct {
+	Name    string
+	Target  string
+	Passed  bool
+	Message string
+}
+
+// NetTestReport holds the results of the network checks, along with the likely causes of any
+// failures
+type NetTestReport struct {
+	Checks   []NetTestCheck
+	Problems []string
+}
+
+// Passed returns whether all checks passed
+func (r NetTestReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// netTestOutcome holds the errors from each check, which are used to diagnose problems. A nil
+// error means that the check passed or wasn't run
+type netTestOutcome struct {
+	networkMagic  uint32
+	port          uint
+	localErr      error
+	publicAddress string
+	publicIsLocal bool
+	publicRan     bool
+	publicErr     error
+	// checkerRan is set when the public address was checked with an external checker
+	checkerRan bool
+	relays     []netTestRelayOutcome
+}
+
+type netTestRelayOutcome struct {
+	relay        TopologyPeer
+	dnsErr       error
+	handshakeErr error
+}
+
+// NetTest checks whether the node in the active context accepts P2P connections, both locally and
+// on its public address, and whether the relays it's configured with resolve and accept
+// connections. Connections are checked with an Ouroboros handshake, which also verifies the
+// network magic
+func (p *PackageManager) NetTest(cfg NetTestConfig) (NetTestReport, error) {
+	activeContextName, activeContext := p.CurrentContext()
+	if activeContext.NetworkMagic == 0 {
+		return NetTestReport{}, ErrContextInstallNoNetwork
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultNetTestTimeout
+	}
+	outcome := netTestOutcome{
+		networkMagic: activeContext.NetworkMagic,
+		port:         cfg.Port,
+	}
+	if outcome.port == 0 {
+		svc, _, err := p.nodeService(activeContextName)
+		if err != nil {
+			return NetTestReport{}, err
+		}
+		port, err := nodeP2PPort(svc.Ports)
+		if err != nil {
+			return NetTestReport{}, err
+		}
+		outcome.port = port
+	}
+	portStr := strconv.FormatUint(uint64(outcome.port), 10)
+	var report NetTestReport
+	// Connect to the node on the Docker host
+	localAddress := net.JoinHostPort(dockerHostAddress(activeContext.DockerHost), portStr)
+	outcome.localErr = ouroborosHandshake(localAddress, outcome.networkMagic, cfg.Timeout)
+	report.addCheck("node handshake", localAddress, outcome.localErr)
+	// Connect to the node on its public address
+	outcome.publicAddress = cfg.PublicAddress
+	if outcome.publicAddress == "" && cfg.IpCheckerUrl != "" {
+		publicIp, err := p.lookupPublicIp(cfg.IpCheckerUrl, cfg.Timeout)
+		report.addCheck("public IP lookup", cfg.IpCheckerUrl, err)
+		outcome.publicAddress = publicIp
+	}
+	if outcome.publicAddress != "" {
+		// Use the external checker if provided, since connecting to our own public address
+		// doesn't work with some routers
+		publicAddress := net.JoinHostPort(outcome.publicAddress, portStr)
+		outcome.publicIsLocal = isLocalAddress(outcome.publicAddress)
+		outcome.publicRan = true
+		if cfg.CheckerUrl != "" {
+			outcome.checkerRan = true
+			outcome.publicErr = p.runReachabilityChecker(
+				cfg.CheckerUrl,
+				outcome.publicAddress,
+				outcome.port,
+				cfg.Timeout,
+			)
+			report.addCheck("external reachability", publicAddress, outcome.publicErr)
+		} else {
+			outcome.publicErr = ouroborosHandshake(
+				publicAddress,
+				outcome.networkMagic,
+				cfg.Timeout,
+			)
+			report.addCheck("public address handshake", publicAddress, outcome.publicErr)
+		}
+	}
+	// Check the relays
+	relays := append([]TopologyPeer{}, cfg.Relays...)
+	for _, installedPkg := range p.InstalledPackages() {
+		topology, ok := p.state.Topologies[portOwner(installedPkg.Package, activeContextName)]
+		if !ok {
+			continue
+		}
+		relays = append(relays, topology.Peers...)
+	}
+	for _, relay := range relays {
+		relayOutcome := netTestRelayOutcome{relay: relay}
+		if net.ParseIP(relay.Address) == nil {
+			relayOutcome.dnsErr = lookupHost(relay.Address, cfg.Timeout)
+			report.addCheck("relay DNS", relay.Address, relayOutcome.dnsErr)
+		}
+		if relayOutcome.dnsErr == nil {
+			relayOutcome.handshakeErr = ouroborosHandshake(
+				relay.String(),
+				outcome.networkMagic,
+				cfg.Timeout,
+			)
+			report.addCheck("relay handshake", relay.String(), relayOutcome.handshakeErr)
+		}
+		outcome.relays = append(outcome.relays, relayOutcome)
+	}
+	report.Problems = outcome.problems()
+	return report, nil
+}
+
+func (r *NetTestReport) addCheck(name string, target string, err error) {
+	check := NetTestCheck{
+		Name:    name,
+		Target:  target,
+		Passed:  err == nil,
+		Message: "OK",
+	}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// problems returns the likely causes of the failed checks
+func (o netTestOutcome) problems() []string {
+	var ret []string
+	switch {
+	case o.localErr != nil && errors.Is(o.localErr, syscall.ECONNREFUSED):
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"Nothing is listening on port %d. Check that the node is running and that its "+
+					"P2P port is published",
+				o.port,
+			),
+		)
+	case o.localErr != nil:
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"The node on port %d did not complete the handshake. Check that it's running "+
+					"and configured for network magic %d",
+				o.port,
+				o.networkMagic,
+			),
+		)
+	case o.publicRan && o.publicErr != nil:
+		if o.publicIsLocal {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"Port %d is not reachable on %s. Check the firewall on this host, along with "+
+						"any cloud provider firewall or security group",
+					o.port,
+					o.publicAddress,
+				),
+			)
+		} else {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"Port %d is not reachable on public address %s. This host is behind NAT, so "+
+						"the port must be forwarded to it on your router, and allowed by any "+
+						"firewall. If your ISP uses carrier-grade NAT, the node can't accept "+
+						"incoming connections",
+					o.port,
+					o.publicAddress,
+				),
+			)
+			if !o.checkerRan {
+				ret = append(
+					ret,
+					"Some routers don't allow connecting to their own public address (hairpin "+
+						"NAT), so use an external checker to confirm",
+				)
+			}
+		}
+	}
+	for _, relay := range o.relays {
+		if relay.dnsErr != nil {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"Relay %s does not resolve. Check the DNS records for the relay",
+					relay.relay.Address,
+				),
+			)
+		} else if relay.handshakeErr != nil {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"Relay %s is not reachable. Check that it's running, and that its firewall "+
+						"allows connections from this host",
+					relay.relay.String(),
+				),
+			)
+		}
+	}
+	return ret
+}
+
+// ouroborosHandshake connects to a node and performs a node-to-node handshake
+func ouroborosHandshake(address string, networkMagic uint32, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// The deadline aborts the handshake if the node doesn't respond
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	oConn, err := ouroboros.NewConnection(
+		ouroboros.WithConnection(conn),
+		ouroboros.WithNetworkMagic(networkMagic),
+		ouroboros.WithNodeToNode(true),
+		ouroboros.WithKeepAlive(false),
+	)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("connection closed during handshake")
+		}
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	return oConn.Close()
+}
+
+// lookupPublicIp returns the public IP of the host from a checker service
+func (p *PackageManager) lookupPublicIp(checkerUrl string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(p.config.ctx(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkerUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpDo(p.config, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	publicIp := strings.TrimSpace(string(body))
+	if net.ParseIP(publicIp) == nil {
+		return "", fmt.Errorf("unexpected response from IP checker: %q", publicIp)
+	}
+	return publicIp, nil
+}
+
+// runReachabilityChecker asks an external service whether the node port is reachable
+func (p *PackageManager) runReachabilityChecker(
+	checkerUrl string,
+	host string,
+	port uint,
+	timeout time.Duration,
+) error {
+	tmpUrl, err := p.config.Template.Render(
+		checkerUrl,
+		map[string]any{
+			"Host": url.QueryEscape(host),
+			"Port": port,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(p.config.ctx(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tmpUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpDo(p.config, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("checker reported the port as unreachable: %s", resp.Status)
+	}
+	return nil
+}
+
+// nodeP2PPort returns the host port for P2P connections from the ports published by the node
+// container, in the HOST_IP:HOST_PORT:CONTAINER_PORT format
+func nodeP2PPort(ports []string) (uint, error) {
+	var hostPorts []uint
+	for _, port := range ports {
+		portParts := strings.Split(strings.Split(port, "/")[0], ":")
+		if len(portParts) < 2 {
+			continue
+		}
+		hostPort, err := strconv.ParseUint(portParts[len(portParts)-2], 10, 16)
+		if err != nil {
+			continue
+		}
+		containerPort, err := strconv.ParseUint(portParts[len(portParts)-1], 10, 16)
+		if err != nil {
+			continue
+		}
+		if containerPort == nodeP2PContainerPort {
+			return uint(hostPort), nil
+		}
+		hostPorts = append(hostPorts, uint(hostPort))
+	}
+	if len(hostPorts) == 1 {
+		return hostPorts[0], nil
+	}
+	return 0, ErrNodePortUnknown
+}
+
+// dockerHostAddress returns the address of the host that runs the containers for a Docker host
+// URL. The local host is used for the default Docker host and Unix sockets
+func dockerHostAddress(dockerHost string) string {
+	if dockerHost != "" {
+		if tmpUrl, err := url.Parse(dockerHost); err == nil && tmpUrl.Hostname() != "" {
+			return tmpUrl.Hostname()
+		}
+	}
+	return "127.0.0.1"
+}
+
+// isLocalAddress returns whether the address is assigned to a network interface on this host
+func isLocalAddress(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		ips, err := net.LookupIP(address)
+		if err != nil || len(ips) == 0 {
+			return false
+		}
+		ip = ips[0]
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupHost checks that a hostname resolves to at least one address
+func lookupHost(host string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	ouroboros "github.com/blinklabs-io/gouroboros"
+)
+
+// startTestNode listens for connections and performs the server side of the handshake
+func startTestNode(t *testing.T, networkMagic uint32) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				oConn, err := ouroboros.NewConnection(
+					ouroboros.WithConnection(conn),
+					ouroboros.WithNetworkMagic(networkMagic),
+					ouroboros.WithNodeToNode(true),
+					ouroboros.WithServer(true),
+				)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+				oConn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestOuroborosHandshake(t *testing.T) {
+	address := startTestNode(t, 42)
+	if err := ouroborosHandshake(address, 42, 5*time.Second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The node rejects a different network magic
+	if err := ouroborosHandshake(address, 1, 5*time.Second); err == nil {
+		t.Fatalf("did not get expected error for mismatched network magic")
+	}
+	// Nodes that don't respond time out
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer listener.Close()
+	start := time.Now()
+	if err := ouroborosHandshake(listener.Addr().String(), 42, 200*time.Millisecond); err == nil {
+		t.Fatalf("did not get expected error for unresponsive node")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("handshake did not time out")
+	}
+}
+
+func TestNodeP2PPort(t *testing.T) {
+	testDefs := []struct {
+		ports        []string
+		expectedPort uint
+		expectedErr  error
+	}{
+		{
+			ports:        []string{"0.0.0.0:3001:3001"},
+			expectedPort: 3001,
+		},
+		{
+			ports:        []string{"0.0.0.0:12798:12798", "0.0.0.0:6000:3001"},
+			expectedPort: 6000,
+		},
+		{
+			ports:        []string{"0.0.0.0:6001:6000"},
+			expectedPort: 6001,
+		},
+		{
+			ports:       []string{"0.0.0.0:12798:12798", "0.0.0.0:6001:6000"},
+			expectedErr: ErrNodePortUnknown,
+		},
+		{
+			expectedErr: ErrNodePortUnknown,
+		},
+	}
+	for _, testDef := range testDefs {
+		port, err := nodeP2PPort(testDef.ports)
+		if testDef.expectedErr != nil {
+			if !errors.Is(err, testDef.expectedErr) {
+				t.Fatalf("did not get expected error for %v: got %v", testDef.ports, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %s", testDef.ports, err)
+		}
+		if port != testDef.expectedPort {
+			t.Fatalf(
+				"did not get expected port for %v: got %d, expected %d",
+				testDef.ports,
+				port,
+				testDef.expectedPort,
+			)
+		}
+	}
+}
+
+func TestDockerHostAddress(t *testing.T) {
+	testDefs := map[string]string{
+		"":                                  "127.0.0.1",
+		"unix:///var/run/docker.sock":       "127.0.0.1",
+		"ssh://cardano@node.example.com:22": "node.example.com",
+		"tcp://10.0.0.5:2376":               "10.0.0.5",
+	}
+	for dockerHost, expected := range testDefs {
+		if address := dockerHostAddress(dockerHost); address != expected {
+			t.Fatalf(
+				"did not get expected address for %q: got %s, expected %s",
+				dockerHost,
+				address,
+				expected,
+			)
+		}
+	}
+}
+
+func TestNetTestProblems(t *testing.T) {
+	testDefs := []struct {
+		outcome          netTestOutcome
+		expectedProblems []string
+	}{
+		{
+			outcome: netTestOutcome{port: 3001},
+		},
+		{
+			outcome: netTestOutcome{
+				port:     3001,
+				localErr: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+			},
+			expectedProblems: []string{"Nothing is listening on port 3001"},
+		},
+		{
+			outcome: netTestOutcome{
+				port:         3001,
+				networkMagic: 2,
+				localErr:     errors.New("handshake failed: refused"),
+			},
+			expectedProblems: []string{"network magic 2"},
+		},
+		{
+			outcome: netTestOutcome{
+				port:          3001,
+				publicAddress: "203.0.113.10",
+				publicIsLocal: true,
+				publicRan:     true,
+				publicErr:     errors.New("i/o timeout"),
+			},
+			expectedProblems: []string{"Check the firewall on this host"},
+		},
+		{
+			outcome: netTestOutcome{
+				port:          3001,
+				publicAddress: "203.0.113.10",
+				publicRan:     true,
+				publicErr:     errors.New("i/o timeout"),
+			},
+			expectedProblems: []string{"behind NAT", "hairpin NAT"},
+		},
+		{
+			outcome: netTestOutcome{
+				port:          3001,
+				publicAddress: "203.0.113.10",
+				publicRan:     true,
+				publicErr:     errors.New("checker reported the port as unreachable"),
+				checkerRan:    true,
+			},
+			expectedProblems: []string{"behind NAT"},
+		},
+		{
+			outcome: netTestOutcome{
+				port: 3001,
+				relays: []netTestRelayOutcome{
+					{
+						relay:  TopologyPeer{Address: "relay1.example.com", Port: 3001},
+						dnsErr: errors.New("no such host"),
+					},
+					{
+						relay:        TopologyPeer{Address: "203.0.113.11", Port: 3001},
+						handshakeErr: errors.New("i/o timeout"),
+					},
+					{
+						relay: TopologyPeer{Address: "203.0.113.12", Port: 3001},
+					},
+				},
+			},
+			expectedProblems: []string{
+				"Relay relay1.example.com does not resolve",
+				"Relay 203.0.113.11:3001 is not reachable",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		problems := testDef.outcome.problems()
+		if len(problems) != len(testDef.expectedProblems) {
+			t.Fatalf(
+				"did not get expected problems: got %v, expected %v",
+				problems,
+				testDef.expectedProblems,
+			)
+		}
+		for idx, expected := range testDef.expectedProblems {
+			if !strings.Contains(problems[idx], expected) {
+				t.Fatalf(
+					"did not get expected problem: got %q, expected it to contain %q",
+					problems[idx],
+					expected,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// networkNamePrefix is prepended to the context name and network name for Docker networks
+const networkNamePrefix = "cardano-up"
+
+// PackageInstallStepNetwork manages a Docker network that containers can join via the networks
+// field of docker install steps. Networks are scoped to the context, so packages installed in the
+// same context that declare or join a network with the same name share it
+type PackageInstallStepNetwork struct {
+	Name string `yaml:"name" jsonschema:"required"`
+	// Driver is the network driver, which defaults to bridge
+	Driver string `yaml:"driver,omitempty"`
+	// Subnet is the subnet for the network in CIDR format, rather than one allocated by Docker
+	Subnet string `yaml:"subnet,omitempty"`
+}
+
+func (p *PackageInstallStepNetwork) validate(cfg Config) error {
+	if err := validateNetworkName(p.Name); err != nil {
+		return err
+	}
+	if p.Subnet != "" {
+		if _, _, err := net.ParseCIDR(p.Subnet); err != nil {
+			return fmt.Errorf("invalid subnet for network %s: %s", p.Name, p.Subnet)
+		}
+	}
+	return nil
+}
+
+func validateNetworkName(name string) error {
+	reName := regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+	if !reName.Match([]byte(name)) {
+		return fmt.Errorf("invalid network name: %s", name)
+	}
+	return nil
+}
+
+// dockerNetworkName returns the name of the Docker network for a network in the context
+func dockerNetworkName(contextName string, name string) string {
+	return fmt.Sprintf("%s-%s-%s", networkNamePrefix, contextName, name)
+}
+
+func (p *PackageInstallStepNetwork) install(cfg Config) error {
+	networkName := dockerNetworkName(cfg.contextName, p.Name)
+	created, err := createDockerNetwork(
+		cfg.ctx(),
+		cfg.DockerHost,
+		networkName,
+		p.Driver,
+		p.Subnet,
+	)
+	if err != nil {
+		return err
+	}
+	if !created {
+		cfg.Logger.Debug(
+			fmt.Sprintf("using existing network %s", networkName),
+		)
+		return nil
+	}
+	cfg.Logger.Debug(
+		fmt.Sprintf("created network %s", networkName),
+	)
+	return nil
+}
+
+// uninstall removes the network when this is the last package using it. Networks that are
+// declared by other installed packages or that still have containers connected are kept
+func (p *PackageInstallStepNetwork) uninstall(cfg Config) error {
+	networkName := dockerNetworkName(cfg.contextName, p.Name)
+	if cfg.sharedNetworks[p.Name] {
+		cfg.Logger.Debug(
+			fmt.Sprintf(
+				"keeping network %s, which is used by other installed packages",
+				networkName,
+			),
+		)
+		return nil
+	}
+	connected, err := removeDockerNetwork(cfg.ctx(), cfg.DockerHost, networkName)
+	if err != nil {
+		return err
+	}
+	if len(connected) > 0 {
+		cfg.Logger.Info(
+			fmt.Sprintf(
+				"keeping network %s, which still has containers connected: %s",
+				networkName,
+				strings.Join(connected, ", "),
+			),
+		)
+		return nil
+	}
+	cfg.Logger.Debug(
+		fmt.Sprintf("removed network %s", networkName),
+	)
+	return nil
+}
+
+// usesNetwork returns whether the package declares or joins the named network in any of its
+// install steps. Conditions aren't evaluated, so that networks are kept if in doubt
+func (p Package) usesNetwork(name string) bool {
+	for _, installStep := range p.InstallSteps {
+		if installStep.Network != nil && installStep.Network.Name == name {
+			return true
+		}
+		if installStep.Docker != nil {
+			for _, tmpName := range installStep.Docker.Networks {
+				if tmpName == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// sharedNetworks returns the networks declared by the package that are also used by other
+// installed packages in the same context, which must be kept when the package is uninstalled or
+// its install is rolled back
+func (p *PackageManager) sharedNetworks(installedPkg InstalledPackage) map[string]bool {
+	ret := make(map[string]bool)
+	for _, installStep := range installedPkg.Package.InstallSteps {
+		if installStep.Network == nil {
+			continue
+		}
+		for _, tmpInstalledPkg := range p.state.InstalledPackages {
+			if tmpInstalledPkg.Context != installedPkg.Context ||
+				(tmpInstalledPkg.InstanceName() == installedPkg.InstanceName() &&
+					tmpInstalledPkg.Package.Version == installedPkg.Package.Version) {
+				continue
+			}
+			if tmpInstalledPkg.Package.usesNetwork(installStep.Network.Name) {
+				ret[installStep.Network.Name] = true
+				break
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageInstallStepNetworkValidate(t *testing.T) {
+	testDefs := []struct {
+		Network PackageInstallStepNetwork
+		Error   bool
+	}{
+		{
+			Network: PackageInstallStepNetwork{Name: "cardano"},
+		},
+		{
+			Network: PackageInstallStepNetwork{
+				Name:   "cardano",
+				Driver: "bridge",
+				Subnet: "172.30.0.0/16",
+			},
+		},
+		{
+			Network: PackageInstallStepNetwork{},
+			Error:   true,
+		},
+		{
+			Network: PackageInstallStepNetwork{Name: "-cardano"},
+			Error:   true,
+		},
+		{
+			Network: PackageInstallStepNetwork{Name: "cardano", Subnet: "172.30.0.0"},
+			Error:   true,
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.Network.validate(Config{})
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for network %#v", testDef.Network)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestPackageInstallStepDockerRenderNetworks(t *testing.T) {
+	cfg := Config{
+		Template:    NewTemplate(nil),
+		contextName: "preview",
+	}
+	step := PackageInstallStepDocker{
+		ContainerName: "bar",
+		Image:         "example/foo",
+		Networks:      []string{"cardano", "db"},
+	}
+	svc, err := step.render(cfg, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedNetworks := []string{"cardano-up-preview-cardano", "cardano-up-preview-db"}
+	if !reflect.DeepEqual(svc.Networks, expectedNetworks) {
+		t.Fatalf(
+			"did not get expected networks\n  got: %v\n  expected: %v",
+			svc.Networks,
+			expectedNetworks,
+		)
+	}
+}
+
+func TestSharedNetworks(t *testing.T) {
+	networkPkg := Package{
+		Name:    "network",
+		Version: "1.0.0",
+		InstallSteps: []PackageInstallStep{
+			{Network: &PackageInstallStepNetwork{Name: "cardano"}},
+			{Network: &PackageInstallStepNetwork{Name: "db"}},
+		},
+	}
+	nodePkg := Package{
+		Name:    "node",
+		Version: "1.0.0",
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "node",
+					Networks:      []string{"cardano"},
+				},
+			},
+		},
+	}
+	pm := &PackageManager{
+		state: &State{
+			InstalledPackages: []InstalledPackage{
+				{Package: networkPkg, Context: "preview"},
+				{Package: networkPkg, Context: "mainnet"},
+				{Package: nodePkg, Context: "mainnet"},
+			},
+		},
+	}
+	// Packages in other contexts and the package itself don't count
+	shared := pm.sharedNetworks(InstalledPackage{Package: networkPkg, Context: "preview"})
+	if len(shared) != 0 {
+		t.Fatalf("got unexpected shared networks: %v", shared)
+	}
+	shared = pm.sharedNetworks(InstalledPackage{Package: networkPkg, Context: "mainnet"})
+	if !reflect.DeepEqual(shared, map[string]bool{"cardano": true}) {
+		t.Fatalf("did not get expected shared networks: %v", shared)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Severities for package notes
+const (
+	NoteSeverityInfo     = "info"
+	NoteSeverityWarning  = "warning"
+	NoteSeverityCritical = "critical"
+)
+
+// PackageNote is a note shown to the user after the package is installed or upgraded. Notes
+// that require action are kept as action items until they're acknowledged
+type PackageNote struct {
+	// Message is the text of the note, which is evaluated as a template
+	Message string `yaml:"message" jsonschema:"required"`
+	// Severity is one of info, warning, or critical, and defaults to info
+	Severity string `yaml:"severity,omitempty"`
+	// RequiresAction marks the note as an action item that the user must acknowledge
+	RequiresAction bool `yaml:"requiresAction,omitempty"`
+	// Condition is an optional template expression that decides whether the note applies
+	Condition string `yaml:"condition,omitempty"`
+}
+
+func (n PackageNote) validate() error {
+	if n.Message == "" {
+		return fmt.Errorf("note message cannot be empty")
+	}
+	switch n.Severity {
+	case "", NoteSeverityInfo, NoteSeverityWarning, NoteSeverityCritical:
+	default:
+		return fmt.Errorf(
+			"invalid note severity %q, expected one of: %s, %s, %s",
+			n.Severity,
+			NoteSeverityInfo,
+			NoteSeverityWarning,
+			NoteSeverityCritical,
+		)
+	}
+	return nil
+}
+
+// InstalledPackageNote is a rendered note for an installed package
+type InstalledPackageNote struct {
+	Message        string
+	Severity       string
+	RequiresAction bool
+	// Acknowledged is set once the user has acknowledged a note that requires action
+	Acknowledged bool
+}
+
+// Pending returns whether the note requires action and hasn't been acknowledged
+func (n InstalledPackageNote) Pending() bool {
+	return n.RequiresAction && !n.Acknowledged
+}
+
+// String returns the note message prefixed with its severity and whether it requires action
+func (n InstalledPackageNote) String() string {
+	var labels []string
+	if n.Severity != NoteSeverityInfo {
+		labels = append(labels, strings.ToUpper(n.Severity))
+	}
+	if n.Pending() {
+		labels = append(labels, "ACTION REQUIRED")
+	}
+	if len(labels) == 0 {
+		return n.Message
+	}
+	return fmt.Sprintf("[%s] %s", strings.Join(labels, ", "), n.Message)
+}
+
+// PendingNotes returns the notes for the installed package that require action and haven't been
+// acknowledged
+func (i InstalledPackage) PendingNotes() []InstalledPackageNote {
+	var ret []InstalledPackageNote
+	for _, note := range i.Notes {
+		if note.Pending() {
+			ret = append(ret, note)
+		}
+	}
+	return ret
+}
+
+// renderNotes renders the notes for the package whose conditions are met
+func (p Package) renderNotes(cfg Config) ([]InstalledPackageNote, error) {
+	var ret []InstalledPackageNote
+	for _, note := range p.Notes {
+		if note.Condition != "" {
+			ok, err := cfg.Template.EvaluateCondition(note.Condition, nil)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		message, err := cfg.Template.Render(note.Message, nil)
+		if err != nil {
+			return nil, err
+		}
+		severity := note.Severity
+		if severity == "" {
+			severity = NoteSeverityInfo
+		}
+		ret = append(
+			ret,
+			InstalledPackageNote{
+				Message:        strings.TrimSpace(message),
+				Severity:       severity,
+				RequiresAction: note.RequiresAction,
+			},
+		)
+	}
+	return ret, nil
+}
+
+// notesOutput formats the post-install notes and structured notes of a package for display
+func notesOutput(postInstallNotes string, notes []InstalledPackageNote) string {
+	var ret []string
+	if postInstallNotes != "" {
+		ret = append(ret, postInstallNotes)
+	}
+	for _, note := range notes {
+		ret = append(ret, note.String())
+	}
+	return strings.Join(ret, "\n\n")
+}
+
+// keepAcknowledgedNotes marks the notes that were already acknowledged for a previous install of
+// the package as acknowledged, so that they aren't raised again on upgrade
+func keepAcknowledgedNotes(
+	notes []InstalledPackageNote,
+	prevNotes []InstalledPackageNote,
+) {
+	for idx, note := range notes {
+		for _, prevNote := range prevNotes {
+			if prevNote.Acknowledged && prevNote.Message == note.Message {
+				notes[idx].Acknowledged = true
+				break
+			}
+		}
+	}
+}
+
+// PackageNotes lists the notes for an installed package
+type PackageNotes struct {
+	Package          InstalledPackage
+	PostInstallNotes string
+	Notes            []InstalledPackageNote
+}
+
+// Notes returns the notes for the specified installed packages in the active context, or for all
+// installed packages in the active context with notes if none are specified
+func (p *PackageManager) Notes(pkgNames ...string) ([]PackageNotes, error) {
+	installedPkgs, err := p.installedPackagesByName(pkgNames)
+	if err != nil {
+		return nil, err
+	}
+	var ret []PackageNotes
+	for _, installedPkg := range installedPkgs {
+		if len(pkgNames) == 0 && installedPkg.PostInstallNotes == "" &&
+			len(installedPkg.Notes) == 0 {
+			continue
+		}
+		ret = append(
+			ret,
+			PackageNotes{
+				Package:          installedPkg,
+				PostInstallNotes: installedPkg.PostInstallNotes,
+				Notes:            installedPkg.Notes,
+			},
+		)
+	}
+	return ret, nil
+}
+
+// PendingNotes returns the installed packages in the active context with notes that require
+// action and haven't been acknowledged
+func (p *PackageManager) PendingNotes() []InstalledPackage {
+	var ret []InstalledPackage
+	for _, installedPkg := range p.InstalledPackages() {
+		if len(installedPkg.PendingNotes()) > 0 {
+			ret = append(ret, installedPkg)
+		}
+	}
+	return ret
+}
+
+// AcknowledgeNotes acknowledges the notes that require action for an installed package in the
+// active context. The notes are specified by their number, starting at 1, and all of the notes
+// for the package are acknowledged if none are specified. It returns the number of notes that
+// were acknowledged
+func (p *PackageManager) AcknowledgeNotes(pkgName string, noteNums ...int) (int, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	for idx, installedPkg := range p.state.InstalledPackages {
+		if installedPkg.Context != activeContextName || installedPkg.InstanceName() != pkgName {
+			continue
+		}
+		notes := installedPkg.Notes
+		for _, noteNum := range noteNums {
+			if noteNum < 1 || noteNum > len(notes) {
+				return 0, NewNoteNotFoundError(pkgName, noteNum)
+			}
+			if !notes[noteNum-1].RequiresAction {
+				return 0, NewNoteNotActionError(pkgName, noteNum)
+			}
+		}
+		count := 0
+		for noteIdx := range notes {
+			if !notes[noteIdx].Pending() {
+				continue
+			}
+			if len(noteNums) > 0 && !containsInt(noteNums, noteIdx+1) {
+				continue
+			}
+			notes[noteIdx].Acknowledged = true
+			count++
+		}
+		p.state.InstalledPackages[idx].Notes = notes
+		if err := p.state.Save(); err != nil {
+			return 0, err
+		}
+		return count, nil
+	}
+	return 0, NewPackageNotInstalledError(pkgName, activeContextName)
+}
+
+// installedPackagesByName returns the installed packages in the active context with the provided
+// names, or all installed packages in the active context if no names are provided
+func (p *PackageManager) installedPackagesByName(pkgNames []string) ([]InstalledPackage, error) {
+	installedPkgs := p.InstalledPackages()
+	if len(pkgNames) == 0 {
+		return installedPkgs, nil
+	}
+	activeContextName, _ := p.CurrentContext()
+	var ret []InstalledPackage
+	for _, pkgName := range pkgNames {
+		found := false
+		for _, installedPkg := range installedPkgs {
+			if installedPkg.InstanceName() == pkgName {
+				ret = append(ret, installedPkg)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, NewPackageNotInstalledError(pkgName, activeContextName)
+		}
+	}
+	return ret, nil
+}
+
+// installedPackagesBySpec returns the installed packages in the active context matching the
+// provided package specs. A spec is a package name with an optional version spec, such as
+// "cardano-node = 10.1.4", which selects one of the versions that are tracked for a package after a
+// partially failed upgrade. A spec matching more than one version is an error, unless all is set
+func (p *PackageManager) installedPackagesBySpec(
+	pkgSpecs []string,
+	all bool,
+) ([]InstalledPackage, error) {
+	installedPkgs := p.InstalledPackages()
+	activeContextName, _ := p.CurrentContext()
+	resolver := &Resolver{}
+	var ret []InstalledPackage
+	for _, pkgSpec := range pkgSpecs {
+		pkgName, pkgVersionSpec, _ := resolver.splitPackage(pkgSpec)
+		var constraints version.Constraints
+		if pkgVersionSpec != "" {
+			tmpConstraints, err := version.NewConstraint(pkgVersionSpec)
+			if err != nil {
+				return nil, err
+			}
+			constraints = tmpConstraints
+		}
+		var matches []InstalledPackage
+		for _, installedPkg := range installedPkgs {
+			if installedPkg.InstanceName() != pkgName {
+				continue
+			}
+			if constraints != nil {
+				installedPkgVer, err := version.NewVersion(installedPkg.Package.Version)
+				if err != nil {
+					return nil, err
+				}
+				if !constraints.Check(installedPkgVer) {
+					continue
+				}
+			}
+			matches = append(matches, installedPkg)
+		}
+		if len(matches) == 0 {
+			return nil, NewPackageNotInstalledError(pkgSpec, activeContextName)
+		}
+		if len(matches) > 1 && !all {
+			versions := make([]string, 0, len(matches))
+			for _, match := range matches {
+				versions = append(versions, match.Package.Version)
+			}
+			return nil, NewPackageVersionAmbiguousError(pkgName, versions)
+		}
+		ret = append(ret, matches...)
+	}
+	return ret, nil
+}
+
+func containsInt(vals []int, val int) bool {
+	for _, tmpVal := range vals {
+		if tmpVal == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackageNoteValidate(t *testing.T) {
+	testDefs := []struct {
+		Note  PackageNote
+		Error bool
+	}{
+		{Note: PackageNote{Message: "foo"}},
+		{Note: PackageNote{Message: "foo", Severity: NoteSeverityCritical, RequiresAction: true}},
+		{Note: PackageNote{Message: ""}, Error: true},
+		{Note: PackageNote{Message: "foo", Severity: "urgent"}, Error: true},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.Note.validate()
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for note: %#v", testDef.Note)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestPackageRenderNotes(t *testing.T) {
+	cfg := Config{
+		Template: NewTemplate(map[string]any{"Enabled": true, "Name": "foo"}),
+	}
+	pkg := Package{
+		Notes: []PackageNote{
+			{Message: "Installed {{ .Name }}\n"},
+			{Message: "Skipped", Condition: "not .Enabled"},
+			{
+				Message:        "Back up your keys",
+				Severity:       NoteSeverityCritical,
+				RequiresAction: true,
+				Condition:      ".Enabled",
+			},
+		},
+	}
+	notes, err := pkg.renderNotes(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedNotes := []InstalledPackageNote{
+		{Message: "Installed foo", Severity: NoteSeverityInfo},
+		{Message: "Back up your keys", Severity: NoteSeverityCritical, RequiresAction: true},
+	}
+	if !reflect.DeepEqual(notes, expectedNotes) {
+		t.Fatalf(
+			"did not get expected notes\n  got: %#v\n  expected: %#v",
+			notes,
+			expectedNotes,
+		)
+	}
+}
+
+func TestInstalledPackageNoteString(t *testing.T) {
+	testDefs := []struct {
+		Note     InstalledPackageNote
+		Expected string
+	}{
+		{
+			Note:     InstalledPackageNote{Message: "foo", Severity: NoteSeverityInfo},
+			Expected: "foo",
+		},
+		{
+			Note:     InstalledPackageNote{Message: "foo", Severity: NoteSeverityWarning},
+			Expected: "[WARNING] foo",
+		},
+		{
+			Note: InstalledPackageNote{
+				Message:        "foo",
+				Severity:       NoteSeverityInfo,
+				RequiresAction: true,
+			},
+			Expected: "[ACTION REQUIRED] foo",
+		},
+		{
+			Note: InstalledPackageNote{
+				Message:        "foo",
+				Severity:       NoteSeverityCritical,
+				RequiresAction: true,
+			},
+			Expected: "[CRITICAL, ACTION REQUIRED] foo",
+		},
+		{
+			Note: InstalledPackageNote{
+				Message:        "foo",
+				Severity:       NoteSeverityCritical,
+				RequiresAction: true,
+				Acknowledged:   true,
+			},
+			Expected: "[CRITICAL] foo",
+		},
+	}
+	for _, testDef := range testDefs {
+		if ret := testDef.Note.String(); ret != testDef.Expected {
+			t.Fatalf("did not get expected output: got %q, expected %q", ret, testDef.Expected)
+		}
+	}
+}
+
+func TestKeepAcknowledgedNotes(t *testing.T) {
+	notes := []InstalledPackageNote{
+		{Message: "unchanged", RequiresAction: true},
+		{Message: "changed", RequiresAction: true},
+	}
+	prevNotes := []InstalledPackageNote{
+		{Message: "unchanged", RequiresAction: true, Acknowledged: true},
+		{Message: "old", RequiresAction: true, Acknowledged: true},
+	}
+	keepAcknowledgedNotes(notes, prevNotes)
+	if !notes[0].Acknowledged || notes[1].Acknowledged {
+		t.Fatalf("did not get expected notes: %#v", notes)
+	}
+}
+
+func TestAcknowledgeNotes(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{Name: "foo", Version: "1.0.0"},
+			Context: activeContextName,
+			Notes: []InstalledPackageNote{
+				{Message: "info", Severity: NoteSeverityInfo},
+				{Message: "first", Severity: NoteSeverityWarning, RequiresAction: true},
+				{Message: "second", Severity: NoteSeverityCritical, RequiresAction: true},
+			},
+		},
+	}
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pending := pm.PendingNotes(); len(pending) != 1 {
+		t.Fatalf("did not get expected packages with pending notes: %#v", pending)
+	}
+	// Notes that don't require action can't be acknowledged
+	if _, err := pm.AcknowledgeNotes("foo", 1); err == nil {
+		t.Fatalf("did not get expected error for note that doesn't require action")
+	}
+	if _, err := pm.AcknowledgeNotes("foo", 4); err == nil {
+		t.Fatalf("did not get expected error for missing note")
+	}
+	if _, err := pm.AcknowledgeNotes("bar"); err == nil {
+		t.Fatalf("did not get expected error for package that isn't installed")
+	}
+	count, err := pm.AcknowledgeNotes("foo", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if count != 1 {
+		t.Fatalf("did not get expected count: %d", count)
+	}
+	pendingNotes := pm.InstalledPackages()[0].PendingNotes()
+	if len(pendingNotes) != 1 || pendingNotes[0].Message != "second" {
+		t.Fatalf("did not get expected pending notes: %#v", pendingNotes)
+	}
+	count, err = pm.AcknowledgeNotes("foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if count != 1 {
+		t.Fatalf("did not get expected count: %d", count)
+	}
+	if pending := pm.PendingNotes(); len(pending) != 0 {
+		t.Fatalf("did not get expected packages with pending notes: %#v", pending)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	PackageOptionTypeBool   = "bool"
+	PackageOptionTypeString = "string"
+	PackageOptionTypeInt    = "int"
+	PackageOptionTypeEnum   = "enum"
+)
+
+// optionType returns the type of the option, which defaults to a boolean
+func (o PackageOption) optionType() string {
+	if o.Type == "" {
+		return PackageOptionTypeBool
+	}
+	return o.Type
+}
+
+func (o PackageOption) validate() error {
+	switch o.optionType() {
+	case PackageOptionTypeBool, PackageOptionTypeString:
+	case PackageOptionTypeInt:
+		if o.Min != nil && o.Max != nil && *o.Min > *o.Max {
+			return fmt.Errorf("option %s: min cannot be greater than max", o.Name)
+		}
+	case PackageOptionTypeEnum:
+		if len(o.Values) == 0 {
+			return fmt.Errorf("option %s: enum option must have values", o.Name)
+		}
+	default:
+		return fmt.Errorf("option %s: unknown option type %q", o.Name, o.Type)
+	}
+	if o.optionType() != PackageOptionTypeEnum && len(o.Values) > 0 {
+		return fmt.Errorf("option %s: values can only be used with enum options", o.Name)
+	}
+	if o.optionType() != PackageOptionTypeInt && (o.Min != nil || o.Max != nil) {
+		return fmt.Errorf("option %s: min and max can only be used with int options", o.Name)
+	}
+	if o.optionType() != PackageOptionTypeBool && len(o.Dependencies) > 0 {
+		return fmt.Errorf("option %s: dependencies can only be used with bool options", o.Name)
+	}
+	if o.Default != nil {
+		if _, err := o.parseValue(o.Default); err != nil {
+			return fmt.Errorf("option %s: invalid default: %w", o.Name, err)
+		}
+	}
+	return nil
+}
+
+// defaultValue returns the default value of the option, or the zero value for its type when no
+// default is specified. The first value is the default for an enum option
+func (o PackageOption) defaultValue() any {
+	if o.Default != nil {
+		if ret, err := o.parseValue(o.Default); err == nil {
+			return ret
+		}
+	}
+	switch o.optionType() {
+	case PackageOptionTypeString:
+		return ""
+	case PackageOptionTypeInt:
+		if o.Min != nil {
+			return *o.Min
+		}
+		return 0
+	case PackageOptionTypeEnum:
+		if len(o.Values) > 0 {
+			return o.Values[0]
+		}
+		return ""
+	}
+	return false
+}
+
+// parseValue converts a value for the option to its type. Values are provided as strings from the
+// command line and as the YAML or JSON types when loaded from a file
+func (o PackageOption) parseValue(val any) (any, error) {
+	switch o.optionType() {
+	case PackageOptionTypeBool:
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case string:
+			ret, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected a boolean, got %q", v)
+			}
+			return ret, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", val)
+	case PackageOptionTypeString:
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case bool, int, int64, uint64, float64:
+			return fmt.Sprint(v), nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", val)
+	case PackageOptionTypeInt:
+		var ret int
+		switch v := val.(type) {
+		case int:
+			ret = v
+		case int64:
+			ret = int(v)
+		case uint64:
+			ret = int(v)
+		case float64:
+			// JSON numbers are decoded as floats
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("expected an integer, got %v", v)
+			}
+			ret = int(v)
+		case string:
+			tmpVal, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected an integer, got %q", v)
+			}
+			ret = tmpVal
+		default:
+			return nil, fmt.Errorf("expected an integer, got %v", val)
+		}
+		if o.Min != nil && ret < *o.Min {
+			return nil, fmt.Errorf("%d is less than the minimum of %d", ret, *o.Min)
+		}
+		if o.Max != nil && ret > *o.Max {
+			return nil, fmt.Errorf("%d is greater than the maximum of %d", ret, *o.Max)
+		}
+		return ret, nil
+	case PackageOptionTypeEnum:
+		tmpVal := fmt.Sprint(val)
+		for _, value := range o.Values {
+			if value == tmpVal {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf(
+			"expected one of %s, got %q",
+			strings.Join(o.Values, ", "),
+			tmpVal,
+		)
+	}
+	return nil, fmt.Errorf("unknown option type %q", o.Type)
+}
+
+// parseOpts converts the provided option values to the types of the package options. Values for
+// options that the package doesn't declare are kept as-is
+func (p Package) parseOpts(opts map[string]any) (map[string]any, error) {
+	ret := make(map[string]any, len(opts))
+	for k, v := range opts {
+		ret[k] = v
+		for _, opt := range p.Options {
+			if opt.Name != k {
+				continue
+			}
+			tmpVal, err := opt.parseValue(v)
+			if err != nil {
+				return nil, NewPackageOptionInvalidValueError(p.Name, k, err)
+			}
+			ret[k] = tmpVal
+		}
+	}
+	return ret, nil
+}
+
+// resolveOpts returns the values for all package options, using the default value for options
+// that aren't provided
+func (p Package) resolveOpts(opts map[string]any) (map[string]any, error) {
+	tmpOpts, err := p.parseOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	ret := p.defaultOpts()
+	for k, v := range tmpOpts {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// optEnabled returns whether a boolean option is enabled
+func optEnabled(opts map[string]any, name string) bool {
+	enabled, _ := opts[name].(bool)
+	return enabled
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageOptionValidate(t *testing.T) {
+	minPort := 1024
+	maxPort := 65535
+	testDefs := []struct {
+		option  PackageOption
+		isError bool
+	}{
+		{
+			option: PackageOption{Name: "foo", Default: true},
+		},
+		{
+			option: PackageOption{
+				Name:    "port",
+				Type:    PackageOptionTypeInt,
+				Default: 6000,
+				Min:     &minPort,
+				Max:     &maxPort,
+			},
+		},
+		{
+			option: PackageOption{
+				Name:    "pruning",
+				Type:    PackageOptionTypeEnum,
+				Default: "conservative",
+				Values:  []string{"none", "conservative", "aggressive"},
+			},
+		},
+		{
+			option:  PackageOption{Name: "foo", Type: "float"},
+			isError: true,
+		},
+		{
+			option:  PackageOption{Name: "pruning", Type: PackageOptionTypeEnum},
+			isError: true,
+		},
+		{
+			option: PackageOption{
+				Name:    "pruning",
+				Type:    PackageOptionTypeEnum,
+				Default: "sometimes",
+				Values:  []string{"none", "conservative"},
+			},
+			isError: true,
+		},
+		{
+			option: PackageOption{
+				Name:    "port",
+				Type:    PackageOptionTypeInt,
+				Default: 80,
+				Min:     &minPort,
+			},
+			isError: true,
+		},
+		{
+			option:  PackageOption{Name: "port", Min: &minPort},
+			isError: true,
+		},
+		{
+			option: PackageOption{
+				Name:         "name",
+				Type:         PackageOptionTypeString,
+				Dependencies: []PackageDependency{{Name: "foo"}},
+			},
+			isError: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.option.validate()
+		if testDef.isError && err == nil {
+			t.Fatalf("did not get expected error for option: %#v", testDef.option)
+		}
+		if !testDef.isError && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestPackageResolveOpts(t *testing.T) {
+	maxPort := 65535
+	pkg := Package{
+		Name: "node",
+		Options: []PackageOption{
+			{Name: "fast", Default: true},
+			{Name: "debug"},
+			{Name: "port", Type: PackageOptionTypeInt, Default: 6000, Max: &maxPort},
+			{
+				Name:   "pruning",
+				Type:   PackageOptionTypeEnum,
+				Values: []string{"none", "conservative"},
+			},
+			{Name: "label", Type: PackageOptionTypeString},
+		},
+	}
+	testDefs := []struct {
+		opts     map[string]any
+		expected map[string]any
+		isError  bool
+	}{
+		{
+			expected: map[string]any{
+				"fast":    true,
+				"debug":   false,
+				"port":    6000,
+				"pruning": "none",
+				"label":   "",
+			},
+		},
+		{
+			// Values from the command line are strings, and JSON numbers are floats
+			opts: map[string]any{
+				"fast":    "false",
+				"port":    "3001",
+				"pruning": "conservative",
+				"label":   "relay",
+				"other":   "kept",
+			},
+			expected: map[string]any{
+				"fast":    false,
+				"debug":   false,
+				"port":    3001,
+				"pruning": "conservative",
+				"label":   "relay",
+				"other":   "kept",
+			},
+		},
+		{
+			opts: map[string]any{"port": float64(3001)},
+			expected: map[string]any{
+				"fast":    true,
+				"debug":   false,
+				"port":    3001,
+				"pruning": "none",
+				"label":   "",
+			},
+		},
+		{
+			opts:    map[string]any{"port": "lots"},
+			isError: true,
+		},
+		{
+			opts:    map[string]any{"port": "70000"},
+			isError: true,
+		},
+		{
+			opts:    map[string]any{"pruning": "aggressive"},
+			isError: true,
+		},
+		{
+			opts:    map[string]any{"fast": "maybe"},
+			isError: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		opts, err := pkg.resolveOpts(testDef.opts)
+		if testDef.isError {
+			if err == nil {
+				t.Fatalf("did not get expected error for options: %#v", testDef.opts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(opts, testDef.expected) {
+			t.Fatalf(
+				"did not get expected options\n  got: %#v\n  expected: %#v",
+				opts,
+				testDef.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// outputReadyInterval is the amount of time between readiness checks for outputs
+	outputReadyInterval = 2 * time.Second
+
+	// outputReadyCheckTimeout is the amount of time that a single readiness check may take
+	outputReadyCheckTimeout = 5 * time.Second
+)
+
+// PackageOutputReady is a readiness check for a package output, such as for the URL of a service
+// that takes some time to start. Exactly one check must be specified. The check is evaluated as a
+// template each time it's run, and is run on the machine running cardano-up
+type PackageOutputReady struct {
+	// Http is a URL that must respond with a 200 status
+	Http string `yaml:"http,omitempty"`
+	// Tcp is an address in HOST:PORT format that must accept connections
+	Tcp string `yaml:"tcp,omitempty"`
+	// Socket is the path to a Unix socket that must exist
+	Socket string `yaml:"socket,omitempty"`
+}
+
+func (r PackageOutputReady) validate() error {
+	checks := 0
+	for _, check := range []string{r.Http, r.Tcp, r.Socket} {
+		if check != "" {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return ErrOutputReadyCheckInvalid
+	}
+	return nil
+}
+
+// render returns the readiness check with its templates rendered
+func (r PackageOutputReady) render(tmpl *Template) (PackageOutputReady, error) {
+	var ret PackageOutputReady
+	for _, field := range []struct {
+		src  string
+		dest *string
+	}{
+		{r.Http, &ret.Http},
+		{r.Tcp, &ret.Tcp},
+		{r.Socket, &ret.Socket},
+	} {
+		if field.src == "" {
+			continue
+		}
+		val, err := tmpl.Render(field.src, nil)
+		if err != nil {
+			return PackageOutputReady{}, err
+		}
+		*field.dest = val
+	}
+	return ret, nil
+}
+
+// check returns an error if the rendered readiness check doesn't pass
+func (r PackageOutputReady) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, outputReadyCheckTimeout)
+	defer cancel()
+	switch {
+	case r.Http != "":
+		client, err := newHttpClient(HttpConfig{Timeout: outputReadyCheckTimeout})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Http, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s", r.Http, resp.Status)
+		}
+	case r.Tcp != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", r.Tcp)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case r.Socket != "":
+		info, err := os.Stat(r.Socket)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSocket == 0 {
+			return fmt.Errorf("%s is not a socket", r.Socket)
+		}
+	}
+	return nil
+}
+
+// OutputStatus is the readiness of an output with a readiness check
+type OutputStatus struct {
+	// Name is the env var name of the output
+	Name string
+	// Error is the reason that the output isn't ready, or nil if it's ready
+	Error error
+}
+
+// OutputStatuses returns the readiness of the outputs with a readiness check for the installed
+// packages in the active context, sorted by name
+func (p *PackageManager) OutputStatuses() []OutputStatus {
+	var ret []OutputStatus
+	for _, installedPkg := range p.InstalledPackages() {
+		tmpl := p.installedPackageTemplate(installedPkg)
+		for _, output := range installedPkg.Package.Outputs {
+			if output.Ready == nil {
+				continue
+			}
+			status := OutputStatus{
+				Name: outputEnvName(installedPkg.InstanceName(), output.Name),
+			}
+			ready, err := output.Ready.render(tmpl)
+			if err == nil {
+				err = ready.check(p.config.ctx())
+			}
+			status.Error = err
+			ret = append(ret, status)
+		}
+	}
+	sort.Slice(
+		ret,
+		func(i, j int) bool {
+			return ret[i].Name < ret[j].Name
+		},
+	)
+	return ret
+}
+
+// WaitForOutputs waits for the outputs with a readiness check for the installed packages in the
+// active context to become ready, indefinitely if no timeout is provided. The progress func, if
+// provided, is called with the statuses after each round of checks
+func (p *PackageManager) WaitForOutputs(
+	timeout time.Duration,
+	progress func([]OutputStatus),
+) error {
+	ctx := p.config.ctx()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		statuses := p.OutputStatuses()
+		if progress != nil {
+			progress(statuses)
+		}
+		var pending []string
+		for _, status := range statuses {
+			if status.Error != nil {
+				pending = append(pending, status.Name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err := p.config.ctx().Err(); err != nil {
+				return err
+			}
+			return NewOutputsNotReadyError(pending, timeout)
+		case <-time.After(outputReadyInterval):
+		}
+	}
+}
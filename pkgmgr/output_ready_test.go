@@ -0,0 +1,150 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackageOutputReadyValidate(t *testing.T) {
+	testDefs := []struct {
+		ready   PackageOutputReady
+		invalid bool
+	}{
+		{ready: PackageOutputReady{Http: "http://localhost:1337/health"}},
+		{ready: PackageOutputReady{Tcp: "localhost:1337"}},
+		{ready: PackageOutputReady{Socket: "/tmp/node.socket"}},
+		{ready: PackageOutputReady{}, invalid: true},
+		{
+			ready:   PackageOutputReady{Http: "http://localhost:1337", Tcp: "localhost:1337"},
+			invalid: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.ready.validate()
+		if testDef.invalid && !errors.Is(err, ErrOutputReadyCheckInvalid) {
+			t.Fatalf(
+				"did not get expected error for readiness check %#v: got %v",
+				testDef.ready,
+				err,
+			)
+		}
+		if !testDef.invalid && err != nil {
+			t.Fatalf("unexpected error for readiness check %#v: %s", testDef.ready, err)
+		}
+	}
+}
+
+func TestPackageOutputReadyCheck(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}),
+	)
+	defer server.Close()
+	httpReady := PackageOutputReady{Http: server.URL}
+	if err := httpReady.check(context.Background()); err == nil {
+		t.Fatalf("did not get expected error for unavailable HTTP service")
+	}
+	status = http.StatusOK
+	if err := httpReady.check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tcpReady := PackageOutputReady{Tcp: listener.Addr().String()}
+	if err := tcpReady.check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	listener.Close()
+	if err := tcpReady.check(context.Background()); err == nil {
+		t.Fatalf("did not get expected error for closed TCP port")
+	}
+	socketReady := PackageOutputReady{Socket: filepath.Join(t.TempDir(), "node.socket")}
+	if err := socketReady.check(context.Background()); err == nil {
+		t.Fatalf("did not get expected error for missing socket")
+	}
+}
+
+func TestWaitForOutputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: filepath.Join(tmpDir, "config"),
+			DataDir:   filepath.Join(tmpDir, "data"),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	defer server.Close()
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "ogmios",
+				Version: "1.0.0",
+				Outputs: []PackageOutput{
+					{
+						Name:  "url",
+						Value: server.URL,
+						Ready: &PackageOutputReady{Http: `{{ "` + server.URL + `" }}`},
+					},
+					{
+						Name:  "host",
+						Value: "localhost",
+					},
+				},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	var statuses []OutputStatus
+	err = pm.WaitForOutputs(
+		time.Second,
+		func(tmpStatuses []OutputStatus) {
+			statuses = tmpStatuses
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "OGMIOS_URL" || statuses[0].Error != nil {
+		t.Fatalf("did not get expected output statuses: %#v", statuses)
+	}
+	// An output that never becomes ready times out
+	server.Close()
+	if err := pm.WaitForOutputs(time.Second, nil); err == nil {
+		t.Fatalf("did not get expected error for output that isn't ready")
+	}
+}
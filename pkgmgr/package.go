@@ -15,48 +15,146 @@
 package pkgmgr
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-version"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	// rollbackTimeout is the base amount of time to spend rolling back a failed install, in
+	// addition to the stop timeouts for any containers
+	rollbackTimeout = 2 * time.Minute
+)
+
 type Package struct {
-	Name                string               `yaml:"name,omitempty"`
-	Version             string               `yaml:"version,omitempty"`
-	Description         string               `yaml:"description,omitempty"`
-	InstallSteps        []PackageInstallStep `yaml:"installSteps,omitempty"`
-	Dependencies        []string             `yaml:"dependencies,omitempty"`
-	Tags                []string             `yaml:"tags,omitempty"`
-	PreInstallScript    string               `yaml:"preInstallScript,omitempty"`
-	PostInstallScript   string               `yaml:"postInstallScript,omitempty"`
-	PreUninstallScript  string               `yaml:"preUninstallScript,omitempty"`
-	PostUninstallScript string               `yaml:"postUninstallScript,omitempty"`
-	PostInstallNotes    string               `yaml:"postInstallNotes,omitempty"`
-	Options             []PackageOption      `yaml:"options,omitempty"`
-	Outputs             []PackageOutput      `yaml:"outputs,omitempty"`
+	SpecVersion         int                   `yaml:"specVersion,omitempty"`
+	Name                string                `yaml:"name,omitempty" jsonschema:"required"`
+	Version             string                `yaml:"version,omitempty" jsonschema:"required"`
+	Description         string                `yaml:"description,omitempty"`
+	InstallSteps        []PackageInstallStep  `yaml:"installSteps,omitempty"`
+	Dependencies        []PackageDependency   `yaml:"dependencies,omitempty"`
+	Tags                []string              `yaml:"tags,omitempty"`
+	PreInstallScript    string                `yaml:"preInstallScript,omitempty"`
+	PostInstallScript   string                `yaml:"postInstallScript,omitempty"`
+	PreUninstallScript  string                `yaml:"preUninstallScript,omitempty"`
+	PostUninstallScript string                `yaml:"postUninstallScript,omitempty"`
+	PostInstallNotes    string                `yaml:"postInstallNotes,omitempty"`
+	Notes               []PackageNote         `yaml:"notes,omitempty"`
+	Options             []PackageOption       `yaml:"options,omitempty"`
+	Outputs             []PackageOutput       `yaml:"outputs,omitempty"`
+	Topology            *PackageTopology      `yaml:"topology,omitempty"`
+	Secrets             []PackageSecret       `yaml:"secrets,omitempty"`
+	Sockets             []PackageSocket       `yaml:"sockets,omitempty"`
+	BlockProducer       *PackageBlockProducer `yaml:"blockProducer,omitempty"`
+	Wallet              *PackageWallet        `yaml:"wallet,omitempty"`
+	Database            *PackageDatabase      `yaml:"database,omitempty"`
+	CliCommands         []PackageCliCommand   `yaml:"cliCommands,omitempty"`
+	Deprecated          bool                  `yaml:"deprecated,omitempty"`
+	SupersededBy        string                `yaml:"supersededBy,omitempty"`
+	EolDate             string                `yaml:"eolDate,omitempty"`
+	Stateful            bool                  `yaml:"stateful,omitempty"`
+	Changelog           string                `yaml:"changelog,omitempty"`
+	ReleaseNotesUrl     string                `yaml:"releaseNotesUrl,omitempty"`
+	DataSchemaVersion   int                   `yaml:"dataSchemaVersion,omitempty"`
+	MinDiskSpace        string                `yaml:"minDiskSpace,omitempty"`
+	Migrations          []PackageMigration    `yaml:"migrations,omitempty"`
+	Tests               []PackageTest         `yaml:"tests,omitempty"`
 	filePath            string
+	// origin is the local path that the package was loaded from, if not from the registry
+	origin string
+	// instance is the instance name for additional installs of the package in a context
+	instance string
+	// configProfile is the built-in config profile for the installed package
+	configProfile string
 }
 
 type PackageOption struct {
-	Name        string `yaml:"name"`
+	Name        string `yaml:"name" jsonschema:"required"`
 	Description string `yaml:"description"`
-	Default     bool   `yaml:"default"`
+	// Type is the type of the option value: bool (the default), string, int, or enum
+	Type    string `yaml:"type,omitempty"`
+	Default any    `yaml:"default"`
+	// Values are the allowed values for an enum option
+	Values []string `yaml:"values,omitempty"`
+	// Min and Max limit the value of an int option
+	Min *int `yaml:"min,omitempty"`
+	Max *int `yaml:"max,omitempty"`
+	// Dependencies are additional packages installed along with the package when the option is
+	// enabled, which allows for optional members of a meta-package
+	Dependencies []PackageDependency `yaml:"dependencies,omitempty"`
+}
+
+// PackageDependency is a dependency on another package, using the same package spec format as
+// for Install. The condition is an optional template expression, which is evaluated against the
+// package options and the active context to decide whether the dependency is needed
+type PackageDependency struct {
+	Name      string `yaml:"name" jsonschema:"required"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// UnmarshalYAML allows a dependency to be specified as a plain package spec string or as a
+// mapping with a condition
+func (d *PackageDependency) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&d.Name)
+	}
+	type rawPackageDependency PackageDependency
+	var tmpDep rawPackageDependency
+	if err := value.Decode(&tmpDep); err != nil {
+		return err
+	}
+	*d = PackageDependency(tmpDep)
+	return nil
+}
+
+// MarshalYAML writes dependencies without a condition as a plain package spec string, so that they
+// can be read by older versions of cardano-up
+func (d PackageDependency) MarshalYAML() (any, error) {
+	if d.Condition == "" {
+		return d.Name, nil
+	}
+	type rawPackageDependency PackageDependency
+	return rawPackageDependency(d), nil
+}
+
+// jsonSchema describes both forms accepted by UnmarshalYAML
+func (d PackageDependency) jsonSchema() *JSONSchema {
+	type rawPackageDependency PackageDependency
+	return &JSONSchema{
+		OneOf: []*JSONSchema{
+			{Type: "string"},
+			schemaForType(reflect.TypeOf(rawPackageDependency{})),
+		},
+	}
+}
+
+// String returns the dependency package spec along with the condition, if any
+func (d PackageDependency) String() string {
+	if d.Condition == "" {
+		return d.Name
+	}
+	return fmt.Sprintf("%s (if %s)", d.Name, d.Condition)
 }
 
 type PackageOutput struct {
-	Name        string `yaml:"name"`
+	Name        string `yaml:"name" jsonschema:"required"`
 	Description string `yaml:"description"`
-	Value       string `yaml:"value"`
+	Value       string `yaml:"value" jsonschema:"required"`
+	// Ready is a check for when the service behind the output is available
+	Ready *PackageOutputReady `yaml:"ready,omitempty"`
 }
 
 func NewPackageFromFile(path string) (Package, error) {
@@ -70,7 +168,16 @@ func NewPackageFromFile(path string) (Package, error) {
 
 func NewPackageFromReader(r io.Reader) (Package, error) {
 	var ret Package
-	dec := yaml.NewDecoder(r)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Package{}, err
+	}
+	// Upgrade older package specs to the current version
+	data, err = convertPackageSpec(data)
+	if err != nil {
+		return Package{}, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
 	dec.KnownFields(true)
 	if err := dec.Decode(&ret); err != nil {
 		return Package{}, err
@@ -82,10 +189,91 @@ func (p Package) IsEmpty() bool {
 	return p.Name == "" && p.Version == ""
 }
 
-func (p Package) defaultOpts() map[string]bool {
-	ret := make(map[string]bool)
+// instanceName returns the package name with the instance name suffix, if any. This is used in
+// place of the package name for anything that must be unique within a context
+func (p Package) instanceName() string {
+	return packageInstanceName(p.Name, p.instance)
+}
+
+func packageInstanceName(pkgName string, instance string) string {
+	if instance == "" {
+		return pkgName
+	}
+	return fmt.Sprintf("%s-%s", pkgName, instance)
+}
+
+// validateInstanceName checks that an instance name is usable as a suffix for the package name
+func validateInstanceName(instance string) error {
+	reInstance := regexp.MustCompile(`^[a-zA-Z0-9][-a-zA-Z0-9]*$`)
+	if !reInstance.Match([]byte(instance)) {
+		return NewInvalidInstanceNameError(instance)
+	}
+	return nil
+}
+
+func (p Package) defaultOpts() map[string]any {
+	ret := make(map[string]any)
 	for _, opt := range p.Options {
-		ret[opt.Name] = opt.Default
+		ret[opt.Name] = opt.defaultValue()
+	}
+	return ret
+}
+
+// dependencies returns the package specs for the dependencies of the package with the provided
+// options, including the dependencies for enabled options. Options that aren't provided use their
+// default value. Dependencies with a condition are only included when the condition evaluates to
+// true using the provided template, with the package options available as .Package.Options
+func (p Package) dependencies(tmpl *Template, opts map[string]any) ([]string, error) {
+	tmpOpts, err := p.resolveOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	deps := append([]PackageDependency{}, p.Dependencies...)
+	for _, opt := range p.Options {
+		if optEnabled(tmpOpts, opt.Name) {
+			deps = append(deps, opt.Dependencies...)
+		}
+	}
+	extraVars := map[string]any{
+		"Package": map[string]any{
+			"Name":     p.Name,
+			"Instance": p.instance,
+			"Version":  p.Version,
+			"Options":  tmpOpts,
+		},
+	}
+	var ret []string
+	for _, dep := range deps {
+		if dep.Condition != "" {
+			if tmpl == nil {
+				tmpl = NewTemplate(nil)
+			}
+			ok, err := tmpl.EvaluateCondition(dep.Condition, extraVars)
+			if err != nil {
+				return nil, NewDependencyConditionError(dep.Name, dep.Condition, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		ret = append(ret, dep.Name)
+	}
+	return ret, nil
+}
+
+// IsMetaPackage returns whether the package only installs other packages as dependencies
+func (p Package) IsMetaPackage() bool {
+	return len(p.InstallSteps) == 0 &&
+		(len(p.Dependencies) > 0 || len(p.GroupOptions()) > 0)
+}
+
+// GroupOptions returns the options that install additional packages when enabled
+func (p Package) GroupOptions() []PackageOption {
+	var ret []PackageOption
+	for _, opt := range p.Options {
+		if len(opt.Dependencies) > 0 {
+			ret = append(ret, opt)
+		}
 	}
 	return ret
 }
@@ -106,14 +294,76 @@ func (p Package) hasTags(tags []string) bool {
 	return true
 }
 
+// MatchesTags returns whether the package has all of the specified tags, or any of them when
+// matchAny is set. Every package matches an empty list of tags
+func (p Package) MatchesTags(tags []string, matchAny bool) bool {
+	if !matchAny || len(tags) == 0 {
+		return p.hasTags(tags)
+	}
+	for _, tag := range tags {
+		for _, pkgTag := range p.Tags {
+			if tag == pkgTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parsePortMapping returns the container and host ports from a port mapping in
+// the Docker -p flag format
+func parsePortMapping(port string) (string, string) {
+	var containerPort, hostPort string
+	portParts := strings.Split(port, ":")
+	switch len(portParts) {
+	case 1:
+		containerPort = portParts[0]
+		hostPort = portParts[0]
+	case 2:
+		containerPort = portParts[1]
+		hostPort = portParts[0]
+	case 3:
+		containerPort = portParts[2]
+		hostPort = portParts[1]
+	}
+	return containerPort, hostPort
+}
+
+// templateVars returns the package-specific template vars for the package in
+// the specified context
+func (p Package) templateVars(
+	cfg Config,
+	context string,
+	opts map[string]any,
+) map[string]any {
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
+	return map[string]any{
+		"Package": map[string]any{
+			"Name":      pkgName,
+			"ShortName": p.instanceName(),
+			"Instance":  p.instance,
+			"Version":   p.Version,
+			"Options":   opts,
+		},
+		"Profile": configProfileTemplateVars(p.configProfile),
+		"Paths": map[string]string{
+			"CacheDir":   filepath.Join(cfg.CacheDir, pkgName),
+			"ContextDir": filepath.Join(cfg.DataDir, context),
+			"DataDir":    cfg.packageDataDir(pkgName),
+			"ScratchDir": packageScratchDir(cfg, pkgName),
+		},
+	}
+}
+
 func (p Package) install(
 	cfg Config,
 	context string,
-	opts map[string]bool,
+	opts map[string]any,
 	runHooks bool,
-) (string, map[string]string, error) {
+) (_ string, _ []InstalledPackageNote, _ map[string]string, retErr error) {
 	// Update template vars
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
+	cfg.contextName = context
 	pkgCacheDir := filepath.Join(
 		cfg.CacheDir,
 		pkgName,
@@ -122,60 +372,172 @@ func (p Package) install(
 		cfg.DataDir,
 		context,
 	)
-	pkgDataDir := filepath.Join(
-		cfg.DataDir,
-		pkgName,
-	)
+	pkgDataDir := cfg.packageDataDir(pkgName)
 	cfg.Template = cfg.Template.WithVars(
-		map[string]any{
-			"Package": map[string]any{
-				"Name":      pkgName,
-				"ShortName": p.Name,
-				"Version":   p.Version,
-				"Options":   opts,
-			},
-			"Paths": map[string]string{
-				"CacheDir":   pkgCacheDir,
-				"ContextDir": pkgContextDir,
-				"DataDir":    pkgDataDir,
-			},
-		},
+		p.templateVars(cfg, context, opts),
 	)
+	containerBindOverrides, err := p.resolveBindOverrides(cfg, pkgName, cfg.bindOverrides)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	cfg.containerBindOverrides = containerBindOverrides
 	// Run pre-flight checks
 	for _, installStep := range p.InstallSteps {
 		// Make sure only one install method is specified per install step
-		if installStep.Docker != nil &&
-			installStep.File != nil {
-			return "", nil, ErrMultipleInstallMethods
+		if installStep.multipleInstallMethods() {
+			return "", nil, nil, ErrMultipleInstallMethods
+		}
+		if _, err := installStep.customStep(); err != nil {
+			return "", nil, nil, err
 		}
 		if installStep.Docker != nil {
+			// Steps that will be skipped don't need their container or image checked
+			if installStep.Condition != "" {
+				ok, err := cfg.Template.EvaluateCondition(installStep.Condition, nil)
+				if err != nil {
+					return "", nil, nil, NewInstallStepConditionError(installStep.Condition, err)
+				}
+				if !ok {
+					continue
+				}
+			}
 			if err := installStep.Docker.preflight(cfg, pkgName); err != nil {
-				return "", nil, fmt.Errorf("pre-flight check failed: %s", err)
+				return "", nil, nil, fmt.Errorf("pre-flight check failed: %s", err)
 			}
 		}
 	}
 	// Pre-create dirs
 	if err := os.MkdirAll(pkgCacheDir, fs.ModePerm); err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	if err := os.MkdirAll(pkgContextDir, fs.ModePerm); err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	if err := os.MkdirAll(pkgDataDir, fs.ModePerm); err != nil {
-		return "", nil, err
+		return "", nil, nil, err
+	}
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		return "", nil, nil, err
 	}
 	// Run pre-install script
 	if runHooks && p.PreInstallScript != "" {
-		if err := p.runHookScript(cfg, p.PreInstallScript); err != nil {
-			return "", nil, err
+		if err := p.runHookScript(cfg, pkgName, HookPreInstall, p.PreInstallScript); err != nil {
+			return "", nil, nil, err
 		}
 	}
 	// Perform install
-	for _, installStep := range p.InstallSteps {
+	startedSteps, err := p.installSteps(cfg, pkgName)
+	// Roll back the install steps if anything fails from here on (including due to
+	// cancellation), so that we don't leave behind containers for a package that isn't recorded
+	// as installed
+	defer func() {
+		if retErr != nil && len(startedSteps) > 0 {
+			p.rollbackInstallSteps(cfg, pkgName, startedSteps)
+		}
+	}()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// Capture port details for output templates
+	portVars, err := p.portTemplateVars(cfg, pkgName, context)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	cfg.Template = cfg.Template.WithVars(portVars)
+	// Generate outputs
+	retOutputs, err := p.renderOutputs(cfg, context)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// Run post-install script
+	if runHooks && p.PostInstallScript != "" {
+		if err := p.runHookScript(cfg, pkgName, HookPostInstall, p.PostInstallScript); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	// Render notes and return
+	var retNotes string
+	if p.PostInstallNotes != "" {
+		tmpNotes, err := cfg.Template.Render(p.PostInstallNotes, nil)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		retNotes = tmpNotes
+	}
+	retPkgNotes, err := p.renderNotes(cfg)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return retNotes, retPkgNotes, retOutputs, nil
+}
+
+// portTemplateVars returns the template vars with the port mappings for each container of the
+// package, keyed on the short container name and then the container port
+func (p Package) portTemplateVars(
+	cfg Config,
+	pkgName string,
+	context string,
+) (map[string]any, error) {
+	tmpPorts := map[string]map[string]string{}
+	tmpServices, err := p.services(cfg, context)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range tmpServices {
+		shortContainerName := strings.TrimPrefix(svc.ContainerName, pkgName+`-`)
+		tmpPortsContainer := make(map[string]string)
+		for _, port := range svc.Ports {
+			containerPort, hostPort := parsePortMapping(port)
+			tmpPortsContainer[containerPort] = hostPort
+		}
+		tmpPorts[shortContainerName] = tmpPortsContainer
+	}
+	return map[string]any{
+		"Ports": tmpPorts,
+	}, nil
+}
+
+// renderOutputs returns the rendered package outputs, keyed on the env var name for each
+func (p Package) renderOutputs(cfg Config, context string) (map[string]string, error) {
+	retOutputs := make(map[string]string)
+	for _, output := range p.Outputs {
+		// Render value template
+		val, err := cfg.Template.Render(output.Value, nil)
+		if err != nil {
+			return nil, err
+		}
+		retOutputs[outputEnvName(p.instanceName(), output.Name)] = val
+	}
+	for key, val := range p.socketEnv(cfg, context) {
+		retOutputs[key] = val
+	}
+	return retOutputs, nil
+}
+
+// outputEnvName returns the env var name for a package output, made from the package instance name
+// and output name
+func outputEnvName(instanceName string, outputName string) string {
+	key := fmt.Sprintf(
+		"%s_%s",
+		instanceName,
+		outputName,
+	)
+	// Replace all characters that won't work in an env var
+	envRe := regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	key = string(envRe.ReplaceAll([]byte(key), []byte(`_`)))
+	// Make uppercase
+	return strings.ToUpper(key)
+}
+
+// installSteps performs the package install steps in order. The steps that were started are
+// returned, including on failure, so that they can be rolled back
+func (p Package) installSteps(cfg Config, pkgName string) ([]PackageInstallStep, error) {
+	var startedSteps []PackageInstallStep
+	for stepIdx, installStep := range p.InstallSteps {
 		// Evaluate condition if defined
 		if installStep.Condition != "" {
 			if ok, err := cfg.Template.EvaluateCondition(installStep.Condition, nil); err != nil {
-				return "", nil, NewInstallStepConditionError(
+				return startedSteps, NewInstallStepConditionError(
 					installStep.Condition,
 					err,
 				)
@@ -189,99 +551,128 @@ func (p Package) install(
 				continue
 			}
 		}
+		if err := cfg.ctx().Err(); err != nil {
+			return startedSteps, err
+		}
+		startedSteps = append(startedSteps, installStep)
 		if installStep.Docker != nil {
-			if err := installStep.Docker.install(cfg, pkgName); err != nil {
-				return "", nil, err
+			if err := installStep.Docker.install(
+				cfg,
+				pkgName,
+				fmt.Sprintf("installSteps[%d].docker", stepIdx),
+			); err != nil {
+				return startedSteps, err
 			}
 		} else if installStep.File != nil {
 			if err := installStep.File.install(cfg, pkgName, p.filePath); err != nil {
-				return "", nil, err
+				return startedSteps, err
+			}
+		} else if installStep.Network != nil {
+			if err := installStep.Network.install(cfg); err != nil {
+				return startedSteps, err
+			}
+		} else if installStep.Compose != nil {
+			if err := installStep.Compose.install(
+				cfg,
+				pkgName,
+				fmt.Sprintf("installSteps[%d].compose", stepIdx),
+			); err != nil {
+				return startedSteps, err
+			}
+		} else if len(installStep.Custom) > 0 {
+			customStep, err := installStep.customStep()
+			if err != nil {
+				return startedSteps, err
+			}
+			if err := customStep.Install(installStepEnv(cfg, pkgName)); err != nil {
+				return startedSteps, err
 			}
 		} else {
-			return "", nil, ErrNoInstallMethods
+			return startedSteps, ErrNoInstallMethods
 		}
 	}
-	// Capture port details for output templates
-	tmpPorts := map[string]map[string]string{}
-	tmpServices, err := p.services(cfg, context)
-	if err != nil {
-		return "", nil, err
-	}
-	for _, svc := range tmpServices {
-		shortContainerName := strings.TrimPrefix(svc.ContainerName, pkgName+`-`)
-		tmpPortsContainer := make(map[string]string)
-		for _, port := range svc.Ports {
-			var containerPort, hostPort string
-			portParts := strings.Split(port, ":")
-			switch len(portParts) {
-			case 1:
-				containerPort = portParts[0]
-				hostPort = portParts[0]
-			case 2:
-				containerPort = portParts[1]
-				hostPort = portParts[0]
-			case 3:
-				containerPort = portParts[2]
-				hostPort = portParts[1]
+	return startedSteps, nil
+}
+
+// rollbackInstallSteps undoes the provided install steps in reverse order. The rollback uses a
+// context that is detached from cancellation of the original, since that may be why we're here
+func (p Package) rollbackInstallSteps(
+	cfg Config,
+	pkgName string,
+	installSteps []PackageInstallStep,
+) {
+	ctx, cancel := context.WithTimeout(
+		context.WithoutCancel(cfg.ctx()),
+		rollbackTimeoutForSteps(cfg, installSteps),
+	)
+	defer cancel()
+	cfg.Context = ctx
+	cfg.Logger.Warn(
+		fmt.Sprintf(
+			"rolling back partial install of package %s",
+			pkgName,
+		),
+	)
+	for idx := len(installSteps) - 1; idx >= 0; idx-- {
+		installStep := installSteps[idx]
+		var err error
+		if installStep.Docker != nil {
+			// Keep the image around, since it's likely to be needed again
+			err = installStep.Docker.uninstall(cfg, pkgName, "", true)
+		} else if installStep.File != nil {
+			err = installStep.File.uninstall(cfg, pkgName)
+		} else if installStep.Network != nil {
+			err = installStep.Network.uninstall(cfg)
+		} else if installStep.Compose != nil {
+			err = installStep.Compose.uninstall(cfg, pkgName, "", true)
+		} else if len(installStep.Custom) > 0 {
+			var customStep InstallStep
+			customStep, err = installStep.customStep()
+			if err == nil {
+				err = customStep.Uninstall(installStepEnv(cfg, pkgName))
 			}
-			tmpPortsContainer[containerPort] = hostPort
 		}
-		tmpPorts[shortContainerName] = tmpPortsContainer
-	}
-	cfg.Template = cfg.Template.WithVars(
-		map[string]any{
-			"Ports": tmpPorts,
-		},
-	)
-	// Generate outputs
-	retOutputs := make(map[string]string)
-	for _, output := range p.Outputs {
-		// Create key from package name and output name
-		key := fmt.Sprintf(
-			"%s_%s",
-			p.Name,
-			output.Name,
-		)
-		// Replace all characters that won't work in an env var
-		envRe := regexp.MustCompile(`[^A-Za-z0-9_]+`)
-		key = string(envRe.ReplaceAll([]byte(key), []byte(`_`)))
-		// Make uppercase
-		key = strings.ToUpper(key)
-		// Render value template
-		val, err := cfg.Template.Render(output.Value, nil)
 		if err != nil {
-			return "", nil, err
+			cfg.Logger.Warn(
+				fmt.Sprintf("failed to roll back install step: %s", err),
+			)
 		}
-		retOutputs[key] = val
 	}
-	// Run post-install script
-	if runHooks && p.PostInstallScript != "" {
-		if err := p.runHookScript(cfg, p.PostInstallScript); err != nil {
-			return "", nil, err
+}
+
+// rollbackTimeoutForSteps returns the maximum amount of time to spend rolling back the provided
+// install steps. Containers are stopped one at a time, so this allows for each container using its
+// full stop timeout on top of the base rollback timeout
+func rollbackTimeoutForSteps(cfg Config, installSteps []PackageInstallStep) time.Duration {
+	ret := rollbackTimeout
+	for _, installStep := range installSteps {
+		if installStep.Docker == nil {
+			continue
 		}
-	}
-	// Render notes and return
-	var retNotes string
-	if p.PostInstallNotes != "" {
-		tmpNotes, err := cfg.Template.Render(p.PostInstallNotes, nil)
-		if err != nil {
-			return "", nil, err
+		stopTimeout := time.Duration(defaultStopTimeout) * time.Second
+		if installStep.Docker.StopTimeout != nil {
+			stopTimeout = time.Duration(*installStep.Docker.StopTimeout) * time.Second
+		} else if cfg.StopTimeout > 0 {
+			stopTimeout = cfg.StopTimeout
 		}
-		retNotes = tmpNotes
+		ret += stopTimeout
 	}
-	return retNotes, retOutputs, nil
+	return ret
 }
 
 func (p Package) uninstall(
 	cfg Config,
 	context string,
 	keepData bool,
+	keepImages bool,
 	runHooks bool,
 ) error {
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
+	cfg.contextName = context
+	logsDir := containerLogsDir(cfg, context, p.instanceName())
 	// Run pre-uninstall script
 	if runHooks && p.PreUninstallScript != "" {
-		if err := p.runHookScript(cfg, p.PreUninstallScript); err != nil {
+		if err := p.runHookScript(cfg, pkgName, HookPreUninstall, p.PreUninstallScript); err != nil {
 			return err
 		}
 	}
@@ -303,18 +694,49 @@ func (p Package) uninstall(
 			}
 		}
 		// Make sure only one install method is specified per install step
-		if installStep.Docker != nil &&
-			installStep.File != nil {
+		if installStep.multipleInstallMethods() {
 			return ErrMultipleInstallMethods
 		}
 		if installStep.Docker != nil {
-			if err := installStep.Docker.uninstall(cfg, pkgName, keepData); err != nil {
+			err := installStep.Docker.uninstall(
+				cfg,
+				pkgName,
+				logsDir,
+				keepImages,
+			)
+			if err != nil {
 				return err
 			}
 		} else if installStep.File != nil {
 			if err := installStep.File.uninstall(cfg, pkgName); err != nil {
 				return err
 			}
+		} else if installStep.Network != nil {
+			// The networks are shared with the other version of the package
+			if cfg.otherVersionInstalled {
+				continue
+			}
+			if err := installStep.Network.uninstall(cfg); err != nil {
+				return err
+			}
+		} else if installStep.Compose != nil {
+			err := installStep.Compose.uninstall(
+				cfg,
+				pkgName,
+				logsDir,
+				keepImages,
+			)
+			if err != nil {
+				return err
+			}
+		} else if len(installStep.Custom) > 0 {
+			customStep, err := installStep.customStep()
+			if err != nil {
+				return err
+			}
+			if err := customStep.Uninstall(installStepEnv(cfg, pkgName)); err != nil {
+				return err
+			}
 		} else {
 			return ErrNoInstallMethods
 		}
@@ -323,6 +745,12 @@ func (p Package) uninstall(
 		cfg.Logger.Debug(
 			"skipping cleanup of package data/cache directories",
 		)
+		// The scratch dir is wiped even when keeping the package data
+		if err := os.RemoveAll(packageScratchDir(cfg, pkgName)); err != nil {
+			cfg.Logger.Warn(
+				fmt.Sprintf("failed to remove package scratch directory: %s", err),
+			)
+		}
 	} else {
 		// Remove package cache dir
 		pkgCacheDir := filepath.Join(
@@ -345,11 +773,26 @@ func (p Package) uninstall(
 				),
 			)
 		}
+		// Remove persisted container logs, unless they're shared with the other version of the
+		// package
+		if cfg.otherVersionInstalled {
+			cfg.Logger.Debug(
+				fmt.Sprintf(
+					"keeping package logs directory %q, which is used by another installed version",
+					logsDir,
+				),
+			)
+		} else if err := os.RemoveAll(logsDir); err != nil {
+			cfg.Logger.Warn(
+				fmt.Sprintf(
+					"failed to remove package logs directory %q: %s",
+					logsDir,
+					err,
+				),
+			)
+		}
 		// Remove package data dir
-		pkgDataDir := filepath.Join(
-			cfg.DataDir,
-			pkgName,
-		)
+		pkgDataDir := cfg.packageDataDir(pkgName)
 		if err := os.RemoveAll(pkgDataDir); err != nil {
 			cfg.Logger.Warn(
 				fmt.Sprintf(
@@ -366,18 +809,76 @@ func (p Package) uninstall(
 				),
 			)
 		}
+		p.removeRemoteData(cfg, pkgName, pkgDataDir, pkgCacheDir)
 	}
 	// Run post-uninstall script
 	if runHooks && p.PostUninstallScript != "" {
-		if err := p.runHookScript(cfg, p.PostUninstallScript); err != nil {
+		if err := p.runHookScript(cfg, pkgName, HookPostUninstall, p.PostUninstallScript); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// removeRemoteData removes the package data and cache dirs, or the named volumes used in their
+// place, from a remote Docker host. Failures are logged but not returned, the same as for the
+// local dirs
+func (p Package) removeRemoteData(
+	cfg Config,
+	pkgName string,
+	pkgDataDir string,
+	pkgCacheDir string,
+) {
+	remote, err := cfg.remoteHost()
+	if err != nil || remote == nil {
+		return
+	}
+	if cfg.RemoteDataDir == "" {
+		volumes, err := removeDockerVolumes(
+			cfg.ctx(),
+			cfg.DockerHost,
+			volumePackageLabel,
+			pkgName,
+		)
+		if err != nil {
+			cfg.Logger.Warn(
+				fmt.Sprintf("failed to remove package volumes: %s", err),
+			)
+		}
+		for _, volume := range volumes {
+			cfg.Logger.Debug(fmt.Sprintf("removed package volume %q", volume))
+		}
+		return
+	}
+	var remoteDirs []string
+	for _, localDir := range []string{pkgDataDir, pkgCacheDir} {
+		if remoteDir, ok := remotePath(cfg, localDir); ok {
+			remoteDirs = append(remoteDirs, remoteDir)
+		}
+	}
+	if err := remote.removeAll(cfg.ctx(), remoteDirs...); err != nil {
+		cfg.Logger.Warn(
+			fmt.Sprintf(
+				"failed to remove package directories on remote host: %s",
+				err,
+			),
+		)
+		return
+	}
+	cfg.Logger.Debug(
+		fmt.Sprintf(
+			"removed package directories %q on remote host",
+			remoteDirs,
+		),
+	)
+}
+
 func (p Package) activate(cfg Config, context string) error {
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	// Binaries are only linked for the primary instance of a package
+	if p.instance != "" {
+		return nil
+	}
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
 	for _, installStep := range p.InstallSteps {
 		// Evaluate condition if defined
 		if installStep.Condition != "" {
@@ -401,7 +902,15 @@ func (p Package) activate(cfg Config, context string) error {
 			if err := installStep.File.activate(cfg, pkgName); err != nil {
 				return err
 			}
-		} else {
+		} else if len(installStep.Custom) > 0 {
+			customStep, err := installStep.customStep()
+			if err != nil {
+				return err
+			}
+			if err := customStep.Activate(installStepEnv(cfg, pkgName)); err != nil {
+				return err
+			}
+		} else if installStep.Network == nil && installStep.Compose == nil {
 			return ErrNoInstallMethods
 		}
 	}
@@ -409,7 +918,11 @@ func (p Package) activate(cfg Config, context string) error {
 }
 
 func (p Package) deactivate(cfg Config, context string) error {
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	// Binaries are only linked for the primary instance of a package
+	if p.instance != "" {
+		return nil
+	}
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
 	for _, installStep := range p.InstallSteps {
 		// Evaluate condition if defined
 		if installStep.Condition != "" {
@@ -433,7 +946,15 @@ func (p Package) deactivate(cfg Config, context string) error {
 			if err := installStep.File.deactivate(cfg, pkgName); err != nil {
 				return err
 			}
-		} else {
+		} else if len(installStep.Custom) > 0 {
+			customStep, err := installStep.customStep()
+			if err != nil {
+				return err
+			}
+			if err := customStep.Deactivate(installStepEnv(cfg, pkgName)); err != nil {
+				return err
+			}
+		} else if installStep.Network == nil && installStep.Compose == nil {
 			return ErrNoInstallMethods
 		}
 	}
@@ -473,6 +994,119 @@ func (p Package) validate(cfg Config) error {
 			expectedFilePath,
 		)
 	}
+	// Validate secrets
+	secretNames := make(map[string]bool)
+	for _, secret := range p.Secrets {
+		if err := validateSecretName(secret.Name); err != nil {
+			return err
+		}
+		if secretNames[secret.Name] {
+			return fmt.Errorf("duplicate secret: %s", secret.Name)
+		}
+		secretNames[secret.Name] = true
+	}
+	for _, installStep := range p.InstallSteps {
+		if installStep.Docker == nil {
+			continue
+		}
+		for envName, secretName := range installStep.Docker.SecretEnv {
+			if !secretNames[secretName] {
+				return fmt.Errorf(
+					"env var %s references undeclared secret: %s",
+					envName,
+					secretName,
+				)
+			}
+		}
+	}
+	// Validate sockets
+	socketNames := make(map[string]bool)
+	for _, socket := range p.Sockets {
+		if err := socket.validate(); err != nil {
+			return err
+		}
+		if socketNames[socket.Name] {
+			return fmt.Errorf("duplicate socket: %s", socket.Name)
+		}
+		socketNames[socket.Name] = true
+	}
+	// Validate topology
+	if p.Topology != nil {
+		if err := p.Topology.validate(p.InstallSteps); err != nil {
+			return err
+		}
+	}
+	// Validate block producer
+	if p.BlockProducer != nil {
+		if err := p.BlockProducer.validate(p.InstallSteps); err != nil {
+			return err
+		}
+	}
+	// Validate deprecation
+	if err := p.validateDeprecation(); err != nil {
+		return err
+	}
+	// Validate release notes URL
+	if err := p.validateChangelog(); err != nil {
+		return err
+	}
+	if p.DataSchemaVersion < 0 {
+		return fmt.Errorf("data schema version cannot be negative")
+	}
+	if _, err := p.minDiskSpace(); err != nil {
+		return err
+	}
+	// Validate migrations
+	if err := p.validateMigrations(); err != nil {
+		return err
+	}
+	// Validate notes
+	for _, note := range p.Notes {
+		if err := note.validate(); err != nil {
+			return err
+		}
+	}
+	// Validate options
+	for _, opt := range p.Options {
+		if err := opt.validate(); err != nil {
+			return err
+		}
+	}
+	// Validate outputs
+	for _, output := range p.Outputs {
+		if output.Ready != nil {
+			if err := output.Ready.validate(); err != nil {
+				return fmt.Errorf("output %s: %w", output.Name, err)
+			}
+		}
+	}
+	// Validate wallet
+	if p.Wallet != nil {
+		if err := p.Wallet.validate(); err != nil {
+			return err
+		}
+	}
+	// Validate database
+	if p.Database != nil {
+		if err := p.Database.validate(p); err != nil {
+			return err
+		}
+	}
+	// Validate CLI commands
+	cliCommandNames := make(map[string]bool)
+	for _, cliCommand := range p.CliCommands {
+		if err := cliCommand.validate(p); err != nil {
+			return err
+		}
+		if cliCommandNames[cliCommand.Name] {
+			return fmt.Errorf("duplicate CLI command: %s", cliCommand.Name)
+		}
+		cliCommandNames[cliCommand.Name] = true
+	}
+	// Validate tests
+	if err := p.validateTests(); err != nil {
+		return err
+	}
 	// Validate install steps
 	for _, installStep := range p.InstallSteps {
 		// Evaluate condition if defined
@@ -489,6 +1123,22 @@ func (p Package) validate(cfg Config) error {
 			if err := installStep.File.validate(cfg); err != nil {
 				return err
 			}
+		} else if installStep.Network != nil {
+			if err := installStep.Network.validate(cfg); err != nil {
+				return err
+			}
+		} else if installStep.Compose != nil {
+			if err := installStep.Compose.validate(cfg); err != nil {
+				return err
+			}
+		} else if len(installStep.Custom) > 0 {
+			customStep, err := installStep.customStep()
+			if err != nil {
+				return err
+			}
+			if err := customStep.Validate(cfg); err != nil {
+				return err
+			}
 		} else {
 			return ErrNoInstallMethods
 		}
@@ -497,106 +1147,107 @@ func (p Package) validate(cfg Config) error {
 }
 
 func (p Package) startService(cfg Config, context string) error {
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
+	// Start with an empty scratch dir
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		cfg.Logger.Warn(
+			fmt.Sprintf("failed to reset package scratch directory: %s", err),
+		)
+	}
 
 	var startErrors []string
-	for _, step := range p.InstallSteps {
-		if step.Docker != nil {
-			if step.Docker.PullOnly {
-				continue
-			}
-			containerName := fmt.Sprintf(
-				"%s-%s",
-				pkgName,
-				step.Docker.ContainerName,
-			)
-			dockerService, err := NewDockerServiceFromContainerName(
-				containerName,
-				cfg.Logger,
+	for _, step := range p.containerSteps(cfg, pkgName) {
+		if step.PullOnly {
+			continue
+		}
+		containerName := fmt.Sprintf(
+			"%s-%s",
+			pkgName,
+			step.ContainerName,
+		)
+		dockerService, err := newDockerService(cfg, containerName)
+		if err != nil {
+			startErrors = append(
+				startErrors,
+				fmt.Sprintf(
+					"error initializing Docker service for container %s: %v",
+					containerName,
+					err,
+				),
 			)
-			if err != nil {
-				startErrors = append(
-					startErrors,
-					fmt.Sprintf(
-						"error initializing Docker service for container %s: %v",
-						containerName,
-						err,
-					),
-				)
-				continue
-			}
-			// Start the Docker container if it's not running
-			slog.Info(
-				fmt.Sprintf("Starting Docker container %s", containerName),
+			continue
+		}
+		// Start the Docker container if it's not running
+		slog.Info(
+			fmt.Sprintf("Starting Docker container %s", containerName),
+		)
+		if err := dockerService.Start(); err != nil {
+			startErrors = append(
+				startErrors,
+				fmt.Sprintf(
+					"failed to start Docker container %s: %v",
+					containerName,
+					err,
+				),
 			)
-			if err := dockerService.Start(); err != nil {
-				startErrors = append(
-					startErrors,
-					fmt.Sprintf(
-						"failed to start Docker container %s: %v",
-						containerName,
-						err,
-					),
-				)
-			}
 		}
 	}
 
 	if len(startErrors) > 0 {
-		slog.Error(strings.Join(startErrors, "\n"))
-		return ErrOperationFailed
+		return fmt.Errorf("%w: %s", ErrOperationFailed, strings.Join(startErrors, "; "))
 	}
 
 	return nil
 }
 
 func (p Package) stopService(cfg Config, context string) error {
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
 
 	var stopErrors []string
-	for _, step := range p.InstallSteps {
-		if step.Docker != nil {
-			if step.Docker.PullOnly {
-				continue
-			}
-			containerName := fmt.Sprintf(
-				"%s-%s",
-				pkgName,
-				step.Docker.ContainerName,
+	for _, step := range p.containerSteps(cfg, pkgName) {
+		if step.PullOnly {
+			continue
+		}
+		containerName := fmt.Sprintf(
+			"%s-%s",
+			pkgName,
+			step.ContainerName,
+		)
+		dockerService, err := newDockerService(cfg, containerName)
+		if err != nil {
+			stopErrors = append(
+				stopErrors,
+				fmt.Sprintf(
+					"error initializing Docker service for container %s: %v",
+					containerName,
+					err,
+				),
 			)
-			dockerService, err := NewDockerServiceFromContainerName(
-				containerName,
-				cfg.Logger,
+			continue
+		}
+		applyStopTimeoutDefault(cfg, dockerService)
+		// Stop the Docker container
+		slog.Info(fmt.Sprintf("Stopping container %s", containerName))
+		if err := dockerService.Stop(); err != nil {
+			stopErrors = append(
+				stopErrors,
+				fmt.Sprintf(
+					"failed to stop Docker container %s: %v",
+					containerName,
+					err,
+				),
 			)
-			if err != nil {
-				stopErrors = append(
-					stopErrors,
-					fmt.Sprintf(
-						"error initializing Docker service for container %s: %v",
-						containerName,
-						err,
-					),
-				)
-				continue
-			}
-			// Stop the Docker container
-			slog.Info(fmt.Sprintf("Stopping container %s", containerName))
-			if err := dockerService.Stop(); err != nil {
-				stopErrors = append(
-					stopErrors,
-					fmt.Sprintf(
-						"failed to stop Docker container %s: %v",
-						containerName,
-						err,
-					),
-				)
-			}
 		}
 	}
 
 	if len(stopErrors) > 0 {
-		slog.Error(strings.Join(stopErrors, "\n"))
-		return ErrOperationFailed
+		return fmt.Errorf("%w: %s", ErrOperationFailed, strings.Join(stopErrors, "; "))
+	}
+	// Wipe the scratch dir once the containers using it have stopped
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		cfg.Logger.Warn(
+			fmt.Sprintf("failed to reset package scratch directory: %s", err),
+		)
 	}
 
 	return nil
@@ -607,88 +1258,208 @@ func (p Package) services(
 	context string,
 ) ([]*DockerService, error) {
 	var ret []*DockerService
-	pkgName := fmt.Sprintf("%s-%s-%s", p.Name, p.Version, context)
-	for _, step := range p.InstallSteps {
-		if step.Docker != nil {
-			if step.Docker.PullOnly {
-				continue
-			}
-			containerName := fmt.Sprintf(
-				"%s-%s",
-				pkgName,
-				step.Docker.ContainerName,
-			)
-			dockerService, err := NewDockerServiceFromContainerName(
-				containerName,
-				cfg.Logger,
+	pkgName := fmt.Sprintf("%s-%s-%s", p.instanceName(), p.Version, context)
+	for _, step := range p.containerSteps(cfg, pkgName) {
+		if step.PullOnly {
+			continue
+		}
+		containerName := fmt.Sprintf(
+			"%s-%s",
+			pkgName,
+			step.ContainerName,
+		)
+		dockerService, err := newDockerService(cfg, containerName)
+		if err != nil {
+			cfg.Logger.Error(
+				fmt.Sprintf(
+					"error initializing Docker service for container %s: %v",
+					containerName,
+					err,
+				),
 			)
-			if err != nil {
-				cfg.Logger.Error(
-					fmt.Sprintf(
-						"error initializing Docker service for container %s: %v",
-						containerName,
-						err,
-					),
-				)
-				continue
-			}
-			ret = append(ret, dockerService)
+			continue
+		}
+		ret = append(ret, dockerService)
+	}
+	return ret, nil
+}
+
+type PackageInstallStep struct {
+	Condition string                     `yaml:"condition,omitempty"`
+	Docker    *PackageInstallStepDocker  `yaml:"docker,omitempty"`
+	File      *PackageInstallStepFile    `yaml:"file,omitempty"`
+	Network   *PackageInstallStepNetwork `yaml:"network,omitempty"`
+	Compose   *PackageInstallStepCompose `yaml:"compose,omitempty"`
+	// Custom holds the install steps for types registered with RegisterInstallStep, by key
+	Custom map[string]yaml.Node `yaml:",inline"`
+}
+
+// multipleInstallMethods returns whether more than one install method is specified
+func (s PackageInstallStep) multipleInstallMethods() bool {
+	count := 0
+	if s.Docker != nil {
+		count++
+	}
+	if s.File != nil {
+		count++
+	}
+	if s.Network != nil {
+		count++
+	}
+	if s.Compose != nil {
+		count++
+	}
+	count += len(s.Custom)
+	return count > 1
+}
+
+type PackageInstallStepDocker struct {
+	ContainerName string                        `yaml:"containerName" jsonschema:"required"`
+	Image         string                        `yaml:"image,omitempty" jsonschema:"required"`
+	Env           map[string]string             `yaml:"env,omitempty"`
+	Command       []string                      `yaml:"command,omitempty"`
+	Args          []string                      `yaml:"args,omitempty"`
+	Binds         []string                      `yaml:"binds,omitempty"`
+	Ports         []string                      `yaml:"ports,omitempty"`
+	PullOnly      bool                          `yaml:"pullOnly"`
+	StopSignal    string                        `yaml:"stopSignal,omitempty"`
+	StopTimeout   *int                          `yaml:"stopTimeout,omitempty"`
+	Devices       []string                      `yaml:"devices,omitempty"`
+	Gpus          string                        `yaml:"gpus,omitempty"`
+	Logs          *PackageInstallStepDockerLogs `yaml:"logs,omitempty"`
+	// Platform selects the image platform in the os/arch[/variant] format (e.g. linux/amd64),
+	// rather than the native platform of the Docker host
+	Platform string `yaml:"platform,omitempty"`
+	// User is the user that the container runs as in the Docker --user flag format, or "image"
+	// for the default user for the image. This overrides the user for the context
+	User string `yaml:"user,omitempty"`
+	// ExtraHosts adds entries to /etc/hosts in the Docker --add-host flag format (host:ip)
+	ExtraHosts []string `yaml:"extraHosts,omitempty"`
+	// Dns lists the DNS servers for the container, rather than those of the Docker host
+	Dns []string `yaml:"dns,omitempty"`
+	// Sysctls sets namespaced kernel parameters for the container
+	Sysctls map[string]string `yaml:"sysctls,omitempty"`
+	// Ulimits sets resource limits in the Docker --ulimit flag format (name=soft[:hard])
+	Ulimits []string `yaml:"ulimits,omitempty"`
+	// CapAdd and CapDrop add and remove kernel capabilities for the container
+	CapAdd  []string `yaml:"capAdd,omitempty"`
+	CapDrop []string `yaml:"capDrop,omitempty"`
+	// ShmSize is the size of /dev/shm (e.g. 256m), rather than the Docker default of 64m
+	ShmSize string `yaml:"shmSize,omitempty"`
+	// ReadOnly mounts the root filesystem of the container as read-only
+	ReadOnly bool `yaml:"readOnly,omitempty"`
+	// Tmpfs mounts in-memory filesystems in the Docker --tmpfs flag format
+	// (CONTAINER_PATH[:OPTIONS]), for fast ephemeral storage
+	Tmpfs []string `yaml:"tmpfs,omitempty"`
+	// Interactive allocates a TTY for the container and keeps its stdin open, the same as
+	// 'docker run -it', so that it can be used with the attach command
+	Interactive bool `yaml:"interactive,omitempty"`
+	// SecretEnv maps env var names to the names of secrets declared by the package
+	SecretEnv map[string]string `yaml:"secretEnv,omitempty"`
+	// Sockets lists the names of sockets, declared by the package or an installed package, that
+	// are mounted into the container
+	Sockets []string `yaml:"sockets,omitempty"`
+	// Networks lists the names of networks, declared by a network install step in the package or
+	// an installed package, that the container is connected to
+	Networks []string `yaml:"networks,omitempty"`
+	// rendered is set for install steps generated from already rendered content, such as Compose
+	// files, which must not be rendered again
+	rendered bool
+	// dockerNetworks lists Docker networks to connect the container to by their full name
+	dockerNetworks []string
+	// networkAliases lists extra names for the container on its networks
+	networkAliases []string
+}
+
+func (p *PackageInstallStepDocker) validate(cfg Config) error {
+	if p.Image == "" {
+		return fmt.Errorf("docker image must be provided")
+	}
+	if p.StopTimeout != nil && *p.StopTimeout < 0 {
+		return fmt.Errorf("docker stop timeout cannot be negative")
+	}
+	if _, err := parseDeviceMappings(p.Devices); err != nil {
+		return err
+	}
+	if err := p.Logs.validate(); err != nil {
+		return err
+	}
+	if _, err := parseGpuRequest(p.Gpus); err != nil {
+		return err
+	}
+	// Templated platforms and users are checked when rendered
+	if !strings.Contains(p.Platform, "{{") {
+		if _, err := parsePlatform(p.Platform); err != nil {
+			return err
+		}
+	}
+	if !strings.Contains(p.User, "{{") {
+		if err := validateContainerUser(p.User); err != nil {
+			return err
+		}
+	}
+	if err := p.runtimeOptions().validate(); err != nil {
+		return err
+	}
+	for _, networkName := range p.Networks {
+		if err := validateNetworkName(networkName); err != nil {
+			return err
 		}
 	}
-	return ret, nil
+	// TODO: add more checks
+	return nil
 }
 
-func (p Package) runHookScript(cfg Config, hookScript string) error {
-	renderedScript, err := cfg.Template.Render(hookScript, nil)
-	if err != nil {
-		return fmt.Errorf("failed to render hook script template: %s", err)
+func (p *PackageInstallStepDocker) preflight(cfg Config, pkgName string) error {
+	if err := checkDockerConnectivity(cfg.DockerHost); err != nil {
+		return err
 	}
-	cmd := exec.Command("/bin/sh", "-c", renderedScript)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	// We won't be reading or writing, so throw away the PTY file
-	err = cmd.Start()
+	// Check that requested devices are available on the host
+	devices, err := parseDeviceMappings(p.Devices)
 	if err != nil {
-		return fmt.Errorf("failed to run hook script: %s", err)
+		return err
 	}
-	err = cmd.Wait()
+	remote, err := cfg.remoteHost()
 	if err != nil {
-		return fmt.Errorf("run hook script exited with error: %s", err)
+		return err
 	}
-	return nil
-}
-
-type PackageInstallStep struct {
-	Condition string                    `yaml:"condition,omitempty"`
-	Docker    *PackageInstallStepDocker `yaml:"docker,omitempty"`
-	File      *PackageInstallStepFile   `yaml:"file,omitempty"`
-}
-
-type PackageInstallStepDocker struct {
-	ContainerName string            `yaml:"containerName"`
-	Image         string            `yaml:"image,omitempty"`
-	Env           map[string]string `yaml:"env,omitempty"`
-	Command       []string          `yaml:"command,omitempty"`
-	Args          []string          `yaml:"args,omitempty"`
-	Binds         []string          `yaml:"binds,omitempty"`
-	Ports         []string          `yaml:"ports,omitempty"`
-	PullOnly      bool              `yaml:"pullOnly"`
-}
-
-func (p *PackageInstallStepDocker) validate(cfg Config) error {
-	if p.Image == "" {
-		return fmt.Errorf("docker image must be provided")
+	for _, device := range devices {
+		if remote != nil {
+			exists, err := remote.pathExists(cfg.ctx(), device.PathOnHost)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return NewDeviceNotFoundError(device.PathOnHost)
+			}
+			continue
+		}
+		if _, err := os.Stat(device.PathOnHost); err != nil {
+			return NewDeviceNotFoundError(device.PathOnHost)
+		}
 	}
-	// TODO: add more checks
-	return nil
-}
-
-func (p *PackageInstallStepDocker) preflight(cfg Config, pkgName string) error {
-	if err := CheckDockerConnectivity(); err != nil {
+	if p.Gpus != "" {
+		if err := checkDockerGpuSupport(cfg.ctx(), cfg.DockerHost); err != nil {
+			return err
+		}
+	}
+	svc, err := p.render(cfg, pkgName)
+	if err != nil {
 		return err
 	}
-	containerName := fmt.Sprintf("%s-%s", pkgName, p.ContainerName)
-	if _, err := NewDockerServiceFromContainerName(containerName, cfg.Logger); err != nil {
+	// Check that the image can be pulled for the platform, rather than failing partway through
+	// the install
+	if err := checkImageAvailable(
+		cfg.ctx(),
+		cfg.Logger,
+		cfg.DockerHost,
+		svc.Image,
+		svc.Platform,
+	); err != nil {
+		return err
+	}
+	existing, err := newDockerService(cfg, svc.ContainerName)
+	if err != nil {
 		if err == ErrContainerNotExists {
 			// Container does not exist (we want this)
 			return nil
@@ -696,49 +1467,60 @@ func (p *PackageInstallStepDocker) preflight(cfg Config, pkgName string) error {
 			return err
 		}
 	}
-	return ErrContainerAlreadyExists
+	if !cfg.AdoptContainers || p.PullOnly {
+		return ErrContainerAlreadyExists
+	}
+	// Make sure that an existing container can be adopted before changing anything
+	return p.checkAdoptable(cfg, pkgName, existing, svc)
 }
 
-func (p *PackageInstallStepDocker) install(cfg Config, pkgName string) error {
-	containerName := fmt.Sprintf("%s-%s", pkgName, p.ContainerName)
-	extraVars := map[string]any{
-		"Container": map[string]any{
-			"Name": containerName,
-		},
-	}
-	tmpImage, err := cfg.Template.Render(p.Image, extraVars)
+// install creates and starts the container for the install step. The field is the path to the
+// install step in the package manifest, which is used in errors for invalid rendered values
+func (p *PackageInstallStepDocker) install(cfg Config, pkgName string, field string) error {
+	svc, err := p.render(cfg, pkgName)
 	if err != nil {
 		return err
 	}
-	tmpEnv := make(map[string]string)
-	for k, v := range p.Env {
-		tmplVal, err := cfg.Template.Render(v, extraVars)
-		if err != nil {
-			return err
-		}
-		tmpEnv[k] = tmplVal
+	if err := p.validateRendered(svc, pkgName, field); err != nil {
+		return err
 	}
-	var tmpCommand []string
-	for _, cmd := range p.Command {
-		tmpCmd, err := cfg.Template.Render(cmd, extraVars)
+	if cfg.AdoptContainers && !p.PullOnly {
+		adopted, err := p.adopt(cfg, pkgName, svc)
 		if err != nil {
 			return err
 		}
-		tmpCommand = append(tmpCommand, tmpCmd)
-	}
-	var tmpArgs []string
-	for _, arg := range p.Args {
-		tmpArg, err := cfg.Template.Render(arg, extraVars)
-		if err != nil {
-			return err
+		if adopted {
+			return nil
 		}
-		tmpArgs = append(tmpArgs, tmpArg)
+	}
+	remote, err := cfg.remoteHost()
+	if err != nil {
+		return err
 	}
 	var tmpBinds []string
-	for _, bind := range p.Binds {
-		tmpBind, err := cfg.Template.Render(bind, extraVars)
-		if err != nil {
-			return err
+	var remoteDirs []string
+	for idx, tmpBind := range svc.Binds {
+		if remote != nil {
+			// Bind mounts refer to paths on the remote host, so local data paths are translated
+			tmpBind, bindSource := remoteBind(cfg, pkgName, tmpBind)
+			tmpBinds = append(tmpBinds, tmpBind)
+			if bindSource.path != "" {
+				remoteDirs = append(remoteDirs, bindSource.path)
+			} else if bindSource.volume != "" {
+				labels := map[string]string{}
+				if bindSource.pkgName != "" {
+					labels[volumePackageLabel] = bindSource.pkgName
+				}
+				if err := createDockerVolume(
+					cfg.ctx(),
+					cfg.DockerHost,
+					bindSource.volume,
+					labels,
+				); err != nil {
+					return err
+				}
+			}
+			continue
 		}
 		tmpBinds = append(tmpBinds, tmpBind)
 		// Precreate any host paths for container bind mounts. This is necessary to retain non-root ownership
@@ -746,6 +1528,14 @@ func (p *PackageInstallStepDocker) install(cfg Config, pkgName string) error {
 		if bindParts != nil {
 			hostPath := bindParts[0]
 			if err := os.MkdirAll(hostPath, fs.ModePerm); err != nil {
+				if idx < len(p.Binds) {
+					return NewInvalidInstallStepValueError(
+						pkgName,
+						fmt.Sprintf("%s.binds[%d]", field, idx),
+						tmpBind,
+						fmt.Errorf("failed to create host path: %w", err),
+					)
+				}
 				return err
 			}
 			cfg.Logger.Debug(
@@ -756,23 +1546,34 @@ func (p *PackageInstallStepDocker) install(cfg Config, pkgName string) error {
 			)
 		}
 	}
-	var tmpPorts []string
-	for _, port := range p.Ports {
-		tmpPort, err := cfg.Template.Render(port, extraVars)
+	svc.Binds = tmpBinds
+	if remote != nil {
+		// Precreate host paths on the remote host, so that they're owned by the remote user
+		if err := remote.mkdirAll(cfg.ctx(), remoteDirs...); err != nil {
+			return err
+		}
+		if svc.user == "" {
+			svc.user, err = remote.userAndGroup(cfg.ctx())
+			if err != nil {
+				return err
+			}
+		}
+	} else if svc.user == "" && !p.PullOnly {
+		// Container users are mapped to other host users with user namespace remapping, so the
+		// local user gives no benefit for bind mount ownership and may break the image
+		usernsRemap, err := checkDockerUsernsRemap(cfg.ctx(), cfg.DockerHost)
 		if err != nil {
 			return err
 		}
-		tmpPorts = append(tmpPorts, tmpPort)
-	}
-	svc := DockerService{
-		logger:        cfg.Logger,
-		ContainerName: containerName,
-		Image:         tmpImage,
-		Env:           tmpEnv,
-		Command:       tmpCommand,
-		Args:          tmpArgs,
-		Binds:         tmpBinds,
-		Ports:         tmpPorts,
+		if usernsRemap {
+			cfg.Logger.Info(
+				fmt.Sprintf(
+					"Docker user namespace remapping is enabled, running container %s as the default user for the image",
+					svc.ContainerName,
+				),
+			)
+			svc.user = containerUserImage
+		}
 	}
 	if p.PullOnly {
 		if err := svc.pullImage(); err != nil {
@@ -789,14 +1590,302 @@ func (p *PackageInstallStepDocker) install(cfg Config, pkgName string) error {
 	return nil
 }
 
+// validateRendered checks the rendered port specs and bind mounts for the install step before the
+// container is created, so that an invalid value is reported against the field in the package
+// manifest that it came from. Bind mounts after those from the install step, such as for
+// sockets, are generated and aren't checked
+func (p *PackageInstallStepDocker) validateRendered(
+	svc *DockerService,
+	pkgName string,
+	field string,
+) error {
+	for idx, port := range svc.Ports {
+		if err := validatePortSpec(port); err != nil {
+			return NewInvalidInstallStepValueError(
+				pkgName,
+				fmt.Sprintf("%s.ports[%d]", field, idx),
+				port,
+				err,
+			)
+		}
+	}
+	for idx, bind := range svc.Binds {
+		if idx >= len(p.Binds) {
+			break
+		}
+		if err := validateBind(bind); err != nil {
+			return NewInvalidInstallStepValueError(
+				pkgName,
+				fmt.Sprintf("%s.binds[%d]", field, idx),
+				bind,
+				err,
+			)
+		}
+	}
+	return nil
+}
+
+// render returns the service for the container with the templates in the install step rendered.
+// Bind mounts are returned as specified in the package, without translation for remote hosts
+func (p *PackageInstallStepDocker) render(cfg Config, pkgName string) (*DockerService, error) {
+	containerName := fmt.Sprintf("%s-%s", pkgName, p.ContainerName)
+	extraVars := containerTemplateVars(containerName)
+	renderVal := func(val string) (string, error) {
+		if p.rendered {
+			return val, nil
+		}
+		return cfg.Template.Render(val, extraVars)
+	}
+	tmpImage, err := renderVal(p.Image)
+	if err != nil {
+		return nil, err
+	}
+	tmpEnv := make(map[string]string)
+	for k, v := range p.Env {
+		tmplVal, err := renderVal(v)
+		if err != nil {
+			return nil, err
+		}
+		tmpEnv[k] = tmplVal
+	}
+	// Secrets are injected as-is and never rendered as templates, so that they can't end up
+	// in outputs or files
+	for k, secretName := range p.SecretEnv {
+		if val, ok := cfg.secrets[secretName]; ok {
+			tmpEnv[k] = val
+		}
+	}
+	// User-provided env overrides aren't rendered as templates either
+	for k, v := range envOverridesMap(cfg.envOverrides) {
+		tmpEnv[k] = v
+	}
+	var tmpCommand []string
+	for _, cmd := range p.Command {
+		tmpCmd, err := renderVal(cmd)
+		if err != nil {
+			return nil, err
+		}
+		tmpCommand = append(tmpCommand, tmpCmd)
+	}
+	var tmpArgs []string
+	for _, arg := range p.Args {
+		tmpArg, err := renderVal(arg)
+		if err != nil {
+			return nil, err
+		}
+		tmpArgs = append(tmpArgs, tmpArg)
+	}
+	var tmpBinds []string
+	for _, bind := range p.Binds {
+		tmpBind, err := renderVal(bind)
+		if err != nil {
+			return nil, err
+		}
+		tmpBinds = append(tmpBinds, tmpBind)
+	}
+	tmpBinds = applyBindOverrides(tmpBinds, cfg.containerBindOverrides[p.ContainerName])
+	// Mount the dir for each socket used by the container
+	for _, socketName := range p.Sockets {
+		socket, ok := cfg.sockets[socketName]
+		if !ok {
+			return nil, NewSocketNotFoundError(socketName, pkgName)
+		}
+		tmpBinds = append(tmpBinds, socket.bind())
+		if _, ok := tmpEnv[socket.Env]; socket.Env != "" && !ok {
+			tmpEnv[socket.Env] = socket.ContainerPath
+		}
+	}
+	var tmpPorts []string
+	for _, port := range p.Ports {
+		tmpPort, err := renderVal(port)
+		if err != nil {
+			return nil, err
+		}
+		tmpPorts = append(tmpPorts, tmpPort)
+	}
+	tmpUser := cfg.ContainerUser
+	if p.User != "" {
+		tmpUser, err = renderVal(p.User)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateContainerUser(tmpUser); err != nil {
+			return nil, err
+		}
+	}
+	var tmpPlatform string
+	if p.Platform != "" {
+		tmpPlatform, err = renderVal(p.Platform)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parsePlatform(tmpPlatform); err != nil {
+			return nil, err
+		}
+	}
+	tmpNetworks := append([]string{}, p.dockerNetworks...)
+	for _, networkName := range p.Networks {
+		tmpNetworks = append(tmpNetworks, dockerNetworkName(cfg.contextName, networkName))
+	}
+	svc := &DockerService{
+		logger:         cfg.Logger,
+		ctx:            cfg.ctx(),
+		host:           cfg.DockerHost,
+		retryCfg:       cfg.DockerRetry,
+		user:           tmpUser,
+		ContainerName:  containerName,
+		Image:          tmpImage,
+		Env:            tmpEnv,
+		Command:        tmpCommand,
+		Args:           tmpArgs,
+		Binds:          tmpBinds,
+		Ports:          tmpPorts,
+		StopSignal:     p.StopSignal,
+		StopTimeout:    p.StopTimeout,
+		Devices:        p.Devices,
+		Gpus:           p.Gpus,
+		Platform:       tmpPlatform,
+		Networks:       tmpNetworks,
+		Runtime:        p.runtimeOptions(),
+		Interactive:    p.Interactive,
+		networkAliases: p.networkAliases,
+	}
+	return svc, nil
+}
+
+// runtimeOptions returns the extra container runtime options for the install step
+func (p *PackageInstallStepDocker) runtimeOptions() DockerRuntimeOptions {
+	return DockerRuntimeOptions{
+		ExtraHosts: p.ExtraHosts,
+		Dns:        p.Dns,
+		Sysctls:    p.Sysctls,
+		Ulimits:    p.Ulimits,
+		CapAdd:     p.CapAdd,
+		CapDrop:    p.CapDrop,
+		ShmSize:    p.ShmSize,
+		ReadOnly:   p.ReadOnly,
+		Tmpfs:      p.Tmpfs,
+	}
+}
+
+// checkAdoptable returns an error if the existing container doesn't match the rendered service
+// from the install step
+func (p *PackageInstallStepDocker) checkAdoptable(
+	cfg Config,
+	pkgName string,
+	existing *DockerService,
+	svc *DockerService,
+) error {
+	mismatches, err := p.mismatches(cfg, pkgName, existing, svc)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		return NewContainerMismatchError(existing.ContainerName, mismatches)
+	}
+	return nil
+}
+
+// mismatches compares the existing container with the rendered service from the install step,
+// and returns a description of each difference
+func (p *PackageInstallStepDocker) mismatches(
+	cfg Config,
+	pkgName string,
+	existing *DockerService,
+	svc *DockerService,
+) ([]string, error) {
+	expectedBinds := svc.Binds
+	remote, err := cfg.remoteHost()
+	if err != nil {
+		return nil, err
+	}
+	if remote != nil {
+		expectedBinds = nil
+		for _, bind := range svc.Binds {
+			tmpBind, _ := remoteBind(cfg, pkgName, bind)
+			expectedBinds = append(expectedBinds, tmpBind)
+		}
+	}
+	return existing.mismatches(svc.Image, svc.Ports, expectedBinds)
+}
+
+// adopt takes over an existing container with the expected name that matches the install step,
+// starting it if necessary. It returns false if there is no existing container
+func (p *PackageInstallStepDocker) adopt(
+	cfg Config,
+	pkgName string,
+	svc *DockerService,
+) (bool, error) {
+	existing, err := newDockerService(cfg, svc.ContainerName)
+	if err != nil {
+		if err == ErrContainerNotExists {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := p.checkAdoptable(cfg, pkgName, existing, svc); err != nil {
+		return false, err
+	}
+	cfg.Logger.Info(
+		fmt.Sprintf("adopting existing container %s", existing.ContainerName),
+	)
+	running, err := existing.Running()
+	if err != nil {
+		return false, err
+	}
+	if !running {
+		if err := existing.Start(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// persistLogs saves any container logs not already collected to a rotating log file, if
+// enabled. Failures are logged but not returned, since they shouldn't block removing the container
+func (p *PackageInstallStepDocker) persistLogs(
+	cfg Config,
+	svc *DockerService,
+	logsDir string,
+) {
+	logsCfg, err := p.Logs.apply(cfg.ContainerLogs)
+	if err != nil {
+		cfg.Logger.Warn(
+			fmt.Sprintf("failed to persist container logs: %s", err),
+		)
+		return
+	}
+	if !logsCfg.Persist {
+		return
+	}
+	logPath := filepath.Join(logsDir, p.ContainerName+".log")
+	if err := persistContainerLogs(logsCfg, svc, logPath, false); err != nil {
+		cfg.Logger.Warn(
+			fmt.Sprintf("failed to persist container logs: %s", err),
+		)
+		return
+	}
+	cfg.Logger.Debug(
+		fmt.Sprintf(
+			"saved logs for container %s to %s",
+			svc.ContainerName,
+			logPath,
+		),
+	)
+}
+
+// uninstall stops and removes the container, and deletes the image unless keepImage is true. If
+// a logs dir is provided and log persistence is enabled, the container logs are saved there before
+// the container is removed
 func (p *PackageInstallStepDocker) uninstall(
 	cfg Config,
 	pkgName string,
-	keepData bool,
+	logsDir string,
+	keepImage bool,
 ) error {
 	if !p.PullOnly {
 		containerName := fmt.Sprintf("%s-%s", pkgName, p.ContainerName)
-		svc, err := NewDockerServiceFromContainerName(containerName, cfg.Logger)
+		svc, err := newDockerService(cfg, containerName)
 		if err != nil {
 			if err == ErrContainerNotExists {
 				cfg.Logger.Debug(
@@ -809,17 +1898,21 @@ func (p *PackageInstallStepDocker) uninstall(
 				return err
 			}
 		} else {
+			applyStopTimeoutDefault(cfg, svc)
 			if running, _ := svc.Running(); running {
 				if err := svc.Stop(); err != nil {
 					return err
 				}
 			}
+			if logsDir != "" {
+				p.persistLogs(cfg, svc, logsDir)
+			}
 			if err := svc.Remove(); err != nil {
 				return err
 			}
 		}
 	}
-	if keepData {
+	if keepImage {
 		cfg.Logger.Debug(
 			fmt.Sprintf(
 				"skipping deletion of docker image %q",
@@ -827,7 +1920,7 @@ func (p *PackageInstallStepDocker) uninstall(
 			),
 		)
 	} else {
-		if err := RemoveDockerImage(p.Image); err != nil {
+		if err := removeDockerImage(cfg.ctx(), cfg.DockerHost, p.Image); err != nil {
 			cfg.Logger.Debug(
 				fmt.Sprintf(
 					"failed to delete image %q: %s",
@@ -860,16 +1953,44 @@ func (p *PackageInstallStepDocker) deactivate(
 	return nil
 }
 
+// applyStopTimeoutDefault sets the stop timeout for the service from the config if the
+// container doesn't have its own
+func applyStopTimeoutDefault(cfg Config, svc *DockerService) {
+	if svc.StopTimeout != nil || cfg.StopTimeout <= 0 {
+		return
+	}
+	stopTimeout := int(cfg.StopTimeout.Seconds())
+	svc.StopTimeout = &stopTimeout
+}
+
 type PackageInstallStepFile struct {
 	Binary   bool        `yaml:"binary"`
-	Filename string      `yaml:"filename"`
+	Filename string      `yaml:"filename" jsonschema:"required"`
 	Source   string      `yaml:"source"`
 	Content  string      `yaml:"content"`
 	Mode     fs.FileMode `yaml:"mode,omitempty"`
+	// SourceDir is a dir in the package that's copied to the dir for Filename, with the dir name
+	// and each file rendered as a template
+	SourceDir string `yaml:"sourceDir,omitempty"`
+	// Extract extracts the tar.gz or zip archive in Source to the dir for Filename
+	Extract bool `yaml:"extract,omitempty"`
+	// Foreach applies the install step once for each item, which is available to templates as
+	// .Item
+	Foreach []string `yaml:"foreach,omitempty"`
 }
 
 func (p *PackageInstallStepFile) validate(cfg Config) error {
-	// TODO: add checks
+	for idx, item := range p.Foreach {
+		if strings.TrimSpace(item) == "" {
+			return fmt.Errorf("file foreach item %d cannot be empty", idx)
+		}
+	}
+	if len(p.Foreach) > 0 && !strings.Contains(p.Filename, "{{") {
+		return errors.New("file filename must use .Item with foreach")
+	}
+	if p.isDir() {
+		return p.validateDir()
+	}
 	return nil
 }
 
@@ -878,15 +1999,25 @@ func (p *PackageInstallStepFile) install(
 	pkgName string,
 	packagePath string,
 ) error {
+	if len(p.Foreach) > 0 {
+		return p.forEach(cfg, func(itemCfg Config, itemStep *PackageInstallStepFile) error {
+			return itemStep.install(itemCfg, pkgName, packagePath)
+		})
+	}
 	tmpFilePath, err := cfg.Template.Render(p.Filename, nil)
 	if err != nil {
 		return err
 	}
 	filePath := filepath.Join(
-		cfg.DataDir,
-		pkgName,
+		cfg.packageDataDir(pkgName),
 		tmpFilePath,
 	)
+	if p.isDir() {
+		if err := validateFileStepDir(tmpFilePath); err != nil {
+			return err
+		}
+		return p.installDir(cfg, filePath, packagePath)
+	}
 	parentDir := filepath.Dir(filePath)
 	if err := os.MkdirAll(parentDir, fs.ModePerm); err != nil {
 		return err
@@ -897,10 +2028,10 @@ func (p *PackageInstallStepFile) install(
 	}
 	fileContent := p.Content
 	if p.Source != "" {
-		fullSourcePath := filepath.Join(
-			filepath.Dir(packagePath),
-			p.Source,
-		)
+		fullSourcePath, err := fileStepSourcePath(cfg, packagePath, p.Source)
+		if err != nil {
+			return err
+		}
 		tmpContent, err := os.ReadFile(fullSourcePath)
 		if err != nil {
 			return err
@@ -915,34 +2046,89 @@ func (p *PackageInstallStepFile) install(
 		return err
 	}
 	cfg.Logger.Debug(fmt.Sprintf("wrote file %s", filePath))
+	// Copy the file to a remote Docker host, so that it's available to bind mounts there
+	remote, err := cfg.remoteHost()
+	if err != nil {
+		return err
+	}
+	if remote != nil {
+		if remoteFilePath, ok := remotePath(cfg, filePath); ok {
+			if err := remote.copyFile(cfg.ctx(), filePath, remoteFilePath, fileMode); err != nil {
+				return err
+			}
+			cfg.Logger.Debug(
+				fmt.Sprintf(
+					"copied file %s to %s on remote host",
+					filePath,
+					remoteFilePath,
+				),
+			)
+		}
+	}
 	return nil
 }
 
 func (p *PackageInstallStepFile) uninstall(cfg Config, pkgName string) error {
+	if len(p.Foreach) > 0 {
+		return p.forEach(cfg, func(itemCfg Config, itemStep *PackageInstallStepFile) error {
+			return itemStep.uninstall(itemCfg, pkgName)
+		})
+	}
+	tmpFilePath, err := cfg.Template.Render(p.Filename, nil)
+	if err != nil {
+		return err
+	}
 	filePath := filepath.Join(
-		cfg.DataDir,
-		pkgName,
-		p.Filename,
+		cfg.packageDataDir(pkgName),
+		tmpFilePath,
 	)
 	cfg.Logger.Debug(fmt.Sprintf("deleting file %s", filePath))
-	if err := os.Remove(filePath); err != nil {
+	removeFunc := os.Remove
+	if p.isDir() {
+		if err := validateFileStepDir(tmpFilePath); err != nil {
+			return err
+		}
+		removeFunc = os.RemoveAll
+	}
+	if err := removeFunc(filePath); err != nil {
 		if !errors.Is(err, fs.ErrNotExist) {
 			cfg.Logger.Warn(fmt.Sprintf("failed to remove file %s", filePath))
 		}
 	}
+	remote, err := cfg.remoteHost()
+	if err != nil {
+		return err
+	}
+	if remote != nil {
+		if remoteFilePath, ok := remotePath(cfg, filePath); ok {
+			if err := remote.removeAll(cfg.ctx(), remoteFilePath); err != nil {
+				cfg.Logger.Warn(
+					fmt.Sprintf(
+						"failed to remove file %s on remote host: %s",
+						remoteFilePath,
+						err,
+					),
+				)
+			}
+		}
+	}
 	return nil
 }
 
 func (p *PackageInstallStepFile) activate(cfg Config, pkgName string) error {
+	if len(p.Foreach) > 0 {
+		return p.forEach(cfg, func(itemCfg Config, itemStep *PackageInstallStepFile) error {
+			return itemStep.activate(itemCfg, pkgName)
+		})
+	}
 	if p.Binary {
 		tmpFilePath, err := cfg.Template.Render(p.Filename, nil)
 		if err != nil {
 			return err
 		}
 		filePath := filepath.Join(
-			cfg.DataDir,
-			pkgName,
-			p.Filename,
+			cfg.packageDataDir(pkgName),
+			tmpFilePath,
 		)
 		binPath := filepath.Join(
 			cfg.BinDir,
@@ -983,6 +2169,11 @@ func (p *PackageInstallStepFile) activate(cfg Config, pkgName string) error {
 }
 
 func (p *PackageInstallStepFile) deactivate(cfg Config, pkgName string) error {
+	if len(p.Foreach) > 0 {
+		return p.forEach(cfg, func(itemCfg Config, itemStep *PackageInstallStepFile) error {
+			return itemStep.deactivate(itemCfg, pkgName)
+		})
+	}
 	if p.Binary {
 		tmpFilePath, err := cfg.Template.Render(p.Filename, nil)
 		if err != nil {
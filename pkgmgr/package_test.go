@@ -15,9 +15,15 @@
 package pkgmgr
 
 import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -33,6 +39,39 @@ var packageTestDefs = []struct {
 			Version: "1.2.3",
 		},
 	},
+	{
+		yaml: "name: foo\nversion: 1.2.3\ninstallSteps:\n    - docker:\n        containerName: bar\n        image: baz\n        pullOnly: false\n        stopSignal: SIGINT\n        stopTimeout: 300",
+		packageObj: Package{
+			Name:    "foo",
+			Version: "1.2.3",
+			InstallSteps: []PackageInstallStep{
+				{
+					Docker: &PackageInstallStepDocker{
+						ContainerName: "bar",
+						Image:         "baz",
+						StopSignal:    "SIGINT",
+						StopTimeout:   intPtr(300),
+					},
+				},
+			},
+		},
+	},
+	{
+		yaml: "specVersion: 2\nname: foo\nversion: 1.2.3\ndependencies:\n    - bar >= 1.0.0\n    - name: baz\n      condition: eq .Context.Network \"mainnet\"",
+		packageObj: Package{
+			SpecVersion: 2,
+			Name:        "foo",
+			Version:     "1.2.3",
+			Dependencies: []PackageDependency{
+				{Name: "bar >= 1.0.0"},
+				{Name: "baz", Condition: `eq .Context.Network "mainnet"`},
+			},
+		},
+	},
+}
+
+func intPtr(v int) *int {
+	return &v
 }
 
 func TestNewPackageFromReader(t *testing.T) {
@@ -68,3 +107,223 @@ func TestPackageToYaml(t *testing.T) {
 		}
 	}
 }
+
+func TestNewPackageFromReaderSpecVersion(t *testing.T) {
+	testDefs := []struct {
+		yaml        string
+		expectedErr error
+	}{
+		{
+			yaml: "specVersion: 1\nname: foo\nversion: 1.2.3",
+		},
+		{
+			yaml:        "specVersion: 999\nname: foo\nversion: 1.2.3",
+			expectedErr: ErrPackageSpecVersionUnsupported,
+		},
+	}
+	for _, testDef := range testDefs {
+		_, err := NewPackageFromReader(strings.NewReader(testDef.yaml))
+		if testDef.expectedErr == nil {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			continue
+		}
+		if !errors.Is(err, testDef.expectedErr) {
+			t.Fatalf(
+				"did not get expected error: got %v, expected %v",
+				err,
+				testDef.expectedErr,
+			)
+		}
+	}
+}
+
+func TestPackageInstallRollbackPostInstallScript(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		CacheDir: filepath.Join(tmpDir, "cache"),
+		DataDir:  filepath.Join(tmpDir, "data"),
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template: NewTemplate(nil),
+	}
+	pkg := Package{
+		Name:    "foo",
+		Version: "1.2.3",
+		InstallSteps: []PackageInstallStep{
+			{
+				File: &PackageInstallStepFile{
+					Filename: "foo.txt",
+					Content:  "foo",
+				},
+			},
+		},
+		PostInstallScript: "exit 1",
+	}
+	if _, _, _, err := pkg.install(cfg, "default", nil, true); err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	// The file from the install step should have been rolled back
+	filePath := filepath.Join(cfg.DataDir, "foo-1.2.3-default", "foo.txt")
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("install step was not rolled back: %v", err)
+	}
+}
+
+func TestRollbackTimeoutForSteps(t *testing.T) {
+	stopTimeout := 300
+	installSteps := []PackageInstallStep{
+		{Docker: &PackageInstallStepDocker{StopTimeout: &stopTimeout}},
+		{File: &PackageInstallStepFile{}},
+	}
+	timeout := rollbackTimeoutForSteps(Config{}, installSteps)
+	if timeout <= time.Duration(stopTimeout)*time.Second {
+		t.Fatalf("rollback timeout %s does not allow for container stop timeout", timeout)
+	}
+}
+
+func TestPackageMatchesTags(t *testing.T) {
+	pkg := Package{Tags: []string{"docker", "linux", "indexer"}}
+	testDefs := []struct {
+		tags     []string
+		matchAny bool
+		expected bool
+	}{
+		{tags: nil, expected: true},
+		{tags: nil, matchAny: true, expected: true},
+		{tags: []string{"docker", "indexer"}, expected: true},
+		{tags: []string{"docker", "wallet"}, expected: false},
+		{tags: []string{"wallet", "indexer"}, matchAny: true, expected: true},
+		{tags: []string{"wallet", "spo"}, matchAny: true, expected: false},
+	}
+	for _, testDef := range testDefs {
+		if res := pkg.MatchesTags(testDef.tags, testDef.matchAny); res != testDef.expected {
+			t.Fatalf(
+				"did not get expected result for tags %v (any: %v): got %v, expected %v",
+				testDef.tags,
+				testDef.matchAny,
+				res,
+				testDef.expected,
+			)
+		}
+	}
+}
+
+func TestPackageInstallStepDockerRender(t *testing.T) {
+	cfg := Config{
+		Template: NewTemplate(map[string]any{"Version": "1.2.3"}),
+		secrets:  map[string]string{"api-key": "secret"},
+	}
+	step := PackageInstallStepDocker{
+		ContainerName: "bar",
+		Image:         "example/foo:{{ .Version }}",
+		Binds:         []string{"/data/{{ .Container.Name }}:/data"},
+		Ports:         []string{"3000"},
+		SecretEnv:     map[string]string{"API_KEY": "api-key"},
+		Platform:      `linux/{{ if eq .Version "1.2.3" }}amd64{{ end }}`,
+	}
+	svc, err := step.render(cfg, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if svc.ContainerName != "foo-bar" {
+		t.Fatalf("did not get expected container name: got %s", svc.ContainerName)
+	}
+	if svc.Image != "example/foo:1.2.3" {
+		t.Fatalf("did not get expected image: got %s", svc.Image)
+	}
+	if len(svc.Binds) != 1 || svc.Binds[0] != "/data/foo-bar:/data" {
+		t.Fatalf("did not get expected binds: got %v", svc.Binds)
+	}
+	if svc.Env["API_KEY"] != "secret" {
+		t.Fatalf("secret was not provided in container env")
+	}
+	if svc.Platform != "linux/amd64" {
+		t.Fatalf("did not get expected platform: got %s", svc.Platform)
+	}
+	step.Platform = "linux"
+	if _, err := step.render(cfg, "foo"); err == nil {
+		t.Fatalf("did not get expected error for invalid platform")
+	}
+}
+
+func TestPackageInstallStepDockerValidateRendered(t *testing.T) {
+	testDefs := []struct {
+		ports       []string
+		binds       []string
+		expectedErr string
+	}{
+		{
+			ports: []string{"3001:3000", "127.0.0.1:12798:12798/tcp"},
+			binds: []string{"/data/foo:/data", "foo-db:/db:ro"},
+		},
+		{
+			ports:       []string{"3001:3000", "3001:abc"},
+			expectedErr: `invalid value "3001:abc" for installSteps[1].docker.ports[1] in package foo`,
+		},
+		{
+			binds:       []string{"/data/foo:/data", "data/foo:/data"},
+			expectedErr: `invalid value "data/foo:/data" for installSteps[1].docker.binds[1] in package foo`,
+		},
+		{
+			binds:       []string{"/data/foo:/data:ro:z"},
+			expectedErr: `invalid value "/data/foo:/data:ro:z" for installSteps[1].docker.binds[0] in package foo`,
+		},
+	}
+	for _, testDef := range testDefs {
+		step := PackageInstallStepDocker{
+			ContainerName: "bar",
+			Binds:         testDef.binds,
+			Ports:         testDef.ports,
+		}
+		svc := &DockerService{
+			Binds: testDef.binds,
+			Ports: testDef.ports,
+		}
+		err := step.validateRendered(svc, "foo", "installSteps[1].docker")
+		if testDef.expectedErr == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), testDef.expectedErr) {
+			t.Fatalf(
+				"did not get expected error, got %v, expected prefix %q",
+				err,
+				testDef.expectedErr,
+			)
+		}
+	}
+}
+
+func TestPackageInstallStepDockerRenderUser(t *testing.T) {
+	cfg := Config{
+		Template:      NewTemplate(nil),
+		ContainerUser: "1000:1000",
+	}
+	step := PackageInstallStepDocker{
+		ContainerName: "bar",
+		Image:         "example/foo",
+	}
+	// The context user is used for steps without a user
+	svc, err := step.render(cfg, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if svc.user != "1000:1000" {
+		t.Fatalf("did not get expected user: got %q", svc.user)
+	}
+	step.User = "image"
+	svc, err = step.render(cfg, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if svc.user != containerUserImage {
+		t.Fatalf("did not get expected user: got %q", svc.user)
+	}
+	step.User = "root:"
+	if _, err := step.render(cfg, "foo"); err == nil {
+		t.Fatalf("did not get expected error for invalid user")
+	}
+}
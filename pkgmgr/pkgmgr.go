@@ -15,13 +15,19 @@
 package pkgmgr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/blinklabs-io/cardano-up/internal/table"
 	ouroboros "github.com/blinklabs-io/gouroboros"
 )
 
@@ -29,6 +35,10 @@ type PackageManager struct {
 	config            Config
 	state             *State
 	availablePackages []Package
+	// lockFile is the operation lock file, while the lock is held
+	lockFile *os.File
+	// contextName is the context that operations apply to, if not the active context
+	contextName string
 }
 
 func NewPackageManager(cfg Config) (*PackageManager, error) {
@@ -58,20 +68,27 @@ func (p *PackageManager) init() error {
 	if err := p.state.Load(); err != nil {
 		return fmt.Errorf("failed to load state: %s", err)
 	}
-	// Setup templating
+	// Setup Docker host and templating, which uses the Docker host for .System
+	p.initDockerHost()
 	p.initTemplate()
 	return nil
 }
 
+// initDockerHost sets the Docker host and package data dir in the config from the active context
+func (p *PackageManager) initDockerHost() {
+	_, activeContext := p.CurrentContext()
+	p.config.DockerHost = activeContext.DockerHost
+	p.config.RemoteDataDir = activeContext.RemoteDataDir
+	p.config.PackageDataDir = activeContext.DataRoot
+	p.config.ContainerUser = activeContext.ContainerUser
+}
+
 func (p *PackageManager) initTemplate() {
-	activeContextName, activeContext := p.ActiveContext()
+	activeContextName, activeContext := p.CurrentContext()
 	tmplVars := map[string]any{
-		"Context": map[string]any{
-			"Name":         activeContextName,
-			"Network":      activeContext.Network,
-			"NetworkMagic": activeContext.NetworkMagic,
-		},
-		"Env": p.ContextEnv(),
+		"Context": activeContext.templateVars(activeContextName),
+		"Env":     p.ContextEnv(),
+		"System":  newSystemInfo(p.config),
 	}
 	tmpConfig := p.config
 	if tmpConfig.Template == nil {
@@ -97,8 +114,9 @@ func (p *PackageManager) loadPackageRegistry(validate bool) error {
 	return retErr
 }
 
+// AvailablePackages returns the packages in the package registry that have the required package
+// tags. Packages are sorted by name, and then by version with the newest version first
 func (p *PackageManager) AvailablePackages() []Package {
-	var ret []Package
 	if p.availablePackages == nil {
 		if err := p.loadPackageRegistry(false); err != nil {
 			p.config.Logger.Warn(
@@ -106,43 +124,126 @@ func (p *PackageManager) AvailablePackages() []Package {
 			)
 		}
 	}
+	return p.filterAvailablePackages()
+}
+
+// cachedAvailablePackages returns the available packages like AvailablePackages, but only loads
+// the registry from the existing cache when it hasn't been loaded yet. It's used by commands that
+// only show extra information from the registry, which shouldn't need network access
+func (p *PackageManager) cachedAvailablePackages() []Package {
+	if p.availablePackages == nil {
+		tmpConfig := p.config
+		tmpConfig.Offline = true
+		registryPkgs, err := registryPackages(tmpConfig, false)
+		if err != nil {
+			p.config.Logger.Debug(
+				fmt.Sprintf("failed to load cached packages: %s", err),
+			)
+			return nil
+		}
+		p.availablePackages = registryPkgs
+	}
+	return p.filterAvailablePackages()
+}
+
+// filterAvailablePackages returns the loaded registry packages that have the required package
+// tags, in the order described for AvailablePackages
+func (p *PackageManager) filterAvailablePackages() []Package {
+	var ret []Package
 	for _, pkg := range p.availablePackages {
 		if pkg.hasTags(p.config.RequiredPackageTags) {
 			ret = append(ret, pkg)
 		}
 	}
+	sortPackages(ret)
 	return ret
 }
 
-func (p *PackageManager) Up() error {
-	// Find installed packages
-	installedPackages := p.InstalledPackages()
-	for _, tmpPackage := range installedPackages {
-		err := tmpPackage.Package.startService(p.config, tmpPackage.Context)
-		if err != nil {
-			return err
-		}
+// AvailablePackagesPage returns up to limit available packages starting at offset, in the same
+// order as AvailablePackages, along with the total number of available packages. All packages
+// after offset are returned when limit is 0
+func (p *PackageManager) AvailablePackagesPage(offset int, limit int) ([]Package, int, error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, NewInvalidPageError(offset, limit)
+	}
+	pkgs := p.AvailablePackages()
+	if offset >= len(pkgs) {
+		return []Package{}, len(pkgs), nil
+	}
+	end := len(pkgs)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return pkgs[offset:end], len(pkgs), nil
+}
 
+// AvailablePackage returns the latest available package matching the package spec, which may
+// include a version spec and options in the same format as for Install
+func (p *PackageManager) AvailablePackage(pkgSpec string) (Package, error) {
+	activeContextName, _ := p.CurrentContext()
+	resolver, err := NewResolver(
+		p.InstalledPackages(),
+		p.availablePackagesWithLocal(),
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return Package{}, err
 	}
-	return nil
+	pkgName, pkgVersionSpec, _ := resolver.splitPackage(pkgSpec)
+	ret, err := resolver.latestAvailablePackage(pkgName, pkgVersionSpec, nil)
+	if err != nil {
+		return Package{}, err
+	}
+	if ret.IsEmpty() {
+		return Package{}, NewResolverNoAvailablePackage(pkgSpec)
+	}
+	return ret, nil
 }
 
-func (p *PackageManager) Down() error {
-	// Find installed packages
-	installedPackages := p.InstalledPackages()
-	for _, tmpPackage := range installedPackages {
-		err := tmpPackage.Package.stopService(p.config, tmpPackage.Context)
+// availablePackagesWithLocal returns the available packages, with packages that
+// were installed from a local path replaced by the packages currently at that path
+func (p *PackageManager) availablePackagesWithLocal() []Package {
+	ret := p.AvailablePackages()
+	for _, installedPkg := range p.InstalledPackages() {
+		if installedPkg.Origin == "" {
+			continue
+		}
+		localPkgs, err := localPackages(p.config, installedPkg.Origin)
 		if err != nil {
-			return err
+			p.config.Logger.Warn(
+				fmt.Sprintf(
+					"failed to load local package %s from %s: %s",
+					installedPkg.Package.Name,
+					installedPkg.Origin,
+					err,
+				),
+			)
+			continue
+		}
+		var tmpPkgs []Package
+		for _, localPkg := range localPkgs {
+			if localPkg.Name == installedPkg.Package.Name {
+				tmpPkgs = append(tmpPkgs, localPkg)
+			}
 		}
+		ret = overlayPackages(ret, tmpPkgs)
 	}
-	return nil
+	sortPackages(ret)
+	return ret
 }
 
 func (p *PackageManager) InstalledPackages() []InstalledPackage {
+	contextName, _ := p.CurrentContext()
+	return p.InstalledPackagesInContext(contextName)
+}
+
+// InstalledPackagesInContext returns the installed packages in the specified context
+func (p *PackageManager) InstalledPackagesInContext(context string) []InstalledPackage {
 	var ret []InstalledPackage
 	for _, pkg := range p.state.InstalledPackages {
-		if pkg.Context == p.state.ActiveContext {
+		if pkg.Context == context {
 			ret = append(ret, pkg)
 		}
 	}
@@ -154,47 +255,186 @@ func (p *PackageManager) InstalledPackagesAllContexts() []InstalledPackage {
 }
 
 func (p *PackageManager) Install(pkgs ...string) error {
+	return p.installPackages(p.availablePackagesWithLocal(), "", pkgs...)
+}
+
+// InstallInContext installs packages in the specified context, rather than the active context
+func (p *PackageManager) InstallInContext(context string, pkgs ...string) error {
+	return p.inContext(
+		context,
+		func(ctxPm *PackageManager) error {
+			return ctxPm.Install(pkgs...)
+		},
+	)
+}
+
+// InstallInstance installs an additional instance of a package in the active context. The
+// instance name is appended to the package name to refer to the instance in other commands
+func (p *PackageManager) InstallInstance(pkg string, instance string) error {
+	return p.installPackages(p.availablePackagesWithLocal(), instance, pkg)
+}
+
+// InstallLocal installs a package directly from a package file or a directory
+// containing package files, without requiring it to be in the registry. If an
+// instance name is provided, an additional instance of the package is installed
+func (p *PackageManager) InstallLocal(path string, instance string) error {
+	availablePkgs, pkgName, err := p.localInstallPackages(path)
+	if err != nil {
+		return err
+	}
+	return p.installPackages(availablePkgs, instance, pkgName)
+}
+
+// localInstallPackages returns the available packages with the packages from a local package file
+// or directory added, along with the name of the local package. The latest version of the local
+// package will be selected by the resolver
+func (p *PackageManager) localInstallPackages(path string) ([]Package, string, error) {
+	localPkgs, err := localPackages(p.config, path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(localPkgs) == 0 {
+		return nil, "", NewNoLocalPackagesError(path)
+	}
+	pkgNames := localPackageNames(localPkgs)
+	if len(pkgNames) > 1 {
+		return nil, "", NewLocalPackageAmbiguousError(path, pkgNames)
+	}
+	return overlayPackages(p.availablePackagesWithLocal(), localPkgs), pkgNames[0], nil
+}
+
+// resolveInstall returns the packages to install in the active context for the requested packages,
+// including any dependencies that aren't installed yet
+func (p *PackageManager) resolveInstall(
+	availablePkgs []Package,
+	instance string,
+	pkgs ...string,
+) ([]ResolverInstallSet, error) {
+	if instance != "" {
+		if err := validateInstanceName(instance); err != nil {
+			return nil, err
+		}
+	}
+	for _, bind := range p.config.BindOverrides {
+		if err := validateBindOverride(bind); err != nil {
+			return nil, err
+		}
+	}
+	for _, env := range p.config.EnvOverrides {
+		if err := validateEnvOverride(env); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateConfigProfile(p.config.ConfigProfile); err != nil {
+		return nil, err
+	}
 	// Check context for network
-	activeContextName, activeContext := p.ActiveContext()
+	activeContextName, activeContext := p.CurrentContext()
 	if activeContext.Network == "" {
-		return ErrContextInstallNoNetwork
+		return nil, ErrContextInstallNoNetwork
 	}
 	resolver, err := NewResolver(
 		p.InstalledPackages(),
-		p.AvailablePackages(),
+		availablePkgs,
 		activeContextName,
+		p.config.Template,
 		p.config.Logger,
 	)
+	if err != nil {
+		return nil, err
+	}
+	if instance == "" {
+		return resolver.Install(pkgs...)
+	}
+	var ret []ResolverInstallSet
+	for _, pkg := range pkgs {
+		tmpInstallPkgs, err := resolver.InstallInstance(pkg, instance)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, tmpInstallPkgs...)
+	}
+	return ret, nil
+}
+
+func (p *PackageManager) installPackages(
+	availablePkgs []Package,
+	instance string,
+	pkgs ...string,
+) error {
+	unlock, err := p.lock()
 	if err != nil {
 		return err
 	}
-	installPkgs, err := resolver.Install(pkgs...)
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	installPkgs, err := p.resolveInstall(availablePkgs, instance, pkgs...)
 	if err != nil {
 		return err
 	}
+	// Show the combined plan when installing more than one package
+	if len(installPkgs) > 1 {
+		var planPkgs []string
+		for _, installPkg := range installPkgs {
+			planPkg := fmt.Sprintf(
+				"%s (= %s)",
+				installPkg.Install.instanceName(),
+				installPkg.Install.Version,
+			)
+			if !installPkg.Selected {
+				planPkg += " [dependency]"
+			}
+			planPkgs = append(planPkgs, planPkg)
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf("Packages to install: %s", strings.Join(planPkgs, ", ")),
+		)
+	}
+	if err := p.checkInstallDiskSpace(installPkgs); err != nil {
+		return err
+	}
 	var installedPkgs []string
-	var notesOutput string
+	var testPkgs []InstalledPackage
+	var allNotesOutput string
 	for _, installPkg := range installPkgs {
 		p.config.Logger.Info(
 			fmt.Sprintf(
 				"Installing package %s (= %s)",
-				installPkg.Install.Name,
+				installPkg.Install.instanceName(),
 				installPkg.Install.Version,
 			),
 		)
+		if warning := installPkg.Install.DeprecationWarning(); warning != "" {
+			p.config.Logger.Warn(warning)
+		}
 		// Build package options
-		tmpPkgOpts := installPkg.Install.defaultOpts()
-		for k, v := range installPkg.Options {
-			tmpPkgOpts[k] = v
+		tmpPkgOpts, err := installPkg.Install.resolveOpts(installPkg.Options)
+		if err != nil {
+			return err
+		}
+		// Bind and env overrides and the config profile only apply to the requested packages, not
+		// their dependencies
+		var binds, env []string
+		if installPkg.Selected {
+			binds = p.config.BindOverrides
+			env = p.config.EnvOverrides
+			installPkg.Install.configProfile = p.config.ConfigProfile
 		}
 		// Install package
-		notes, outputs, err := installPkg.Install.install(
-			p.config,
+		installCfg, err := p.installConfig(installPkg.Install, activeContextName, binds, env)
+		if err != nil {
+			return err
+		}
+		var hookResults []HookResult
+		installCfg.hookResults = &hookResults
+		notes, pkgNotes, outputs, err := installPkg.Install.install(
+			installCfg,
 			activeContextName,
 			tmpPkgOpts,
 			true,
 		)
 		if err != nil {
+			p.telemetry().recordPackageFailure(installPkg.Install)
 			return err
 		}
 		installedPkg := NewInstalledPackage(
@@ -204,6 +444,12 @@ func (p *PackageManager) Install(pkgs ...string) error {
 			outputs,
 			tmpPkgOpts,
 		)
+		installedPkg.Notes = pkgNotes
+		installedPkg.Binds = binds
+		installedPkg.Env = env
+		installedPkg.ConfigProfile = installPkg.Install.configProfile
+		installedPkg.Hooks = hookResults
+		installedPkg.Explicit = installPkg.Selected
 		p.state.InstalledPackages = append(
 			p.state.InstalledPackages,
 			installedPkg,
@@ -211,25 +457,41 @@ func (p *PackageManager) Install(pkgs ...string) error {
 		if err := p.state.Save(); err != nil {
 			return err
 		}
-		installedPkgs = append(installedPkgs, installPkg.Install.Name)
-		if notes != "" {
-			notesOutput += fmt.Sprintf(
+		installedPkgs = append(installedPkgs, installPkg.Install.instanceName())
+		testPkgs = append(testPkgs, installedPkg)
+		if tmpNotes := notesOutput(notes, pkgNotes); tmpNotes != "" {
+			allNotesOutput += fmt.Sprintf(
 				"\nPost-install notes for %s (= %s):\n\n%s\n",
-				installPkg.Install.Name,
+				installPkg.Install.instanceName(),
 				installPkg.Install.Version,
-				notes,
+				tmpNotes,
 			)
 		}
 		// Activate package
-		if err := installPkg.Install.activate(p.config, activeContextName); err != nil {
+		if err := p.activatePackage(p.config, installPkg.Install, activeContextName); err != nil {
 			p.config.Logger.Warn(
 				fmt.Sprintf("failed to activate package: %s", err),
 			)
 		}
+		// Warn about binaries that won't be found when run from a shell
+		for _, warning := range p.unresolvableBinaries(installPkg.Install, activeContextName) {
+			p.config.Logger.Warn(warning)
+		}
+		// Restore managed topology
+		p.reapplyTopology(installedPkg)
+	}
+	// Update env files
+	if err := p.refreshEnvFiles(activeContextName); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to update env files: %s", err),
+		)
 	}
 	// Display post-install notes
-	if notesOutput != "" {
-		p.config.Logger.Info(notesOutput)
+	if allNotesOutput != "" {
+		p.config.Logger.Info(
+			allNotesOutput,
+			EventAttr(EventPackageNotes),
+		)
 	}
 	p.config.Logger.Info(
 		fmt.Sprintf(
@@ -237,16 +499,25 @@ func (p *PackageManager) Install(pkgs ...string) error {
 			activeContextName,
 			strings.Join(installedPkgs, ", "),
 		),
+		EventAttr(EventPackageInstalled),
+		slog.String("context", activeContextName),
+		slog.Any("packages", installedPkgs),
 	)
-	return nil
+	return p.testInstalledPackages(testPkgs)
 }
 
 func (p *PackageManager) Upgrade(pkgs ...string) error {
-	activeContextName, _ := p.ActiveContext()
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
 	resolver, err := NewResolver(
 		p.InstalledPackages(),
-		p.AvailablePackages(),
+		p.availablePackagesWithLocal(),
 		activeContextName,
+		p.config.Template,
 		p.config.Logger,
 	)
 	if err != nil {
@@ -256,39 +527,129 @@ func (p *PackageManager) Upgrade(pkgs ...string) error {
 	if err != nil {
 		return err
 	}
+	return p.upgradePackages(activeContextName, upgradePkgs, "upgraded/installed")
+}
+
+// upgradePackages replaces the installed versions of packages with the resolved versions, and
+// installs any new dependencies. The action is used in the final log message
+func (p *PackageManager) upgradePackages(
+	activeContextName string,
+	upgradePkgs []ResolverUpgradeSet,
+	action string,
+) error {
+	// Show the combined plan when upgrading more than one package
+	if len(upgradePkgs) > 1 {
+		var planPkgs []string
+		for _, upgradePkg := range upgradePkgs {
+			// Dependencies that aren't installed yet are installed along with the upgrade
+			if upgradePkg.Installed.IsEmpty() {
+				planPkgs = append(
+					planPkgs,
+					fmt.Sprintf(
+						"%s (= %s) [dependency]",
+						upgradePkg.Upgrade.instanceName(),
+						upgradePkg.Upgrade.Version,
+					),
+				)
+				continue
+			}
+			planPkgs = append(
+				planPkgs,
+				fmt.Sprintf(
+					"%s (%s => %s)",
+					upgradePkg.Upgrade.instanceName(),
+					upgradePkg.Installed.Package.Version,
+					upgradePkg.Upgrade.Version,
+				),
+			)
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf("Packages to upgrade: %s", strings.Join(planPkgs, ", ")),
+		)
+	}
 	var installedPkgs []string
-	var notesOutput string
+	var testPkgs []InstalledPackage
+	var allNotesOutput string
 	for _, upgradePkg := range upgradePkgs {
+		verb := "Upgrading"
+		if versionNewer(upgradePkg.Installed.Package.Version, upgradePkg.Upgrade.Version) {
+			verb = "Downgrading"
+		}
 		p.config.Logger.Info(
 			fmt.Sprintf(
-				"Upgrading package %s (%s => %s)",
-				upgradePkg.Installed.Package.Name,
+				"%s package %s (%s => %s)",
+				verb,
+				upgradePkg.Installed.InstanceName(),
 				upgradePkg.Installed.Package.Version,
 				upgradePkg.Upgrade.Version,
 			),
 		)
+		if warning := upgradePkg.Upgrade.DeprecationWarning(); warning != "" {
+			p.config.Logger.Warn(warning)
+		}
 		// Capture options from existing package
 		pkgOpts := upgradePkg.Installed.Options
-		// Deactivate old package
-		if err := upgradePkg.Installed.Package.deactivate(p.config, activeContextName); err != nil {
-			p.config.Logger.Warn(
-				fmt.Sprintf("failed to deactivate package: %s", err),
-			)
-		}
-		// Uninstall old version
-		if err := p.uninstallPackage(upgradePkg.Installed, true, false); err != nil {
-			return err
-		}
-		// Install new version
-		notes, outputs, err := upgradePkg.Upgrade.install(
-			p.config,
+		// Prepare config for the new version before removing the old one, since this fails
+		// when required secrets aren't set
+		installCfg, err := p.installConfig(
+			upgradePkg.Upgrade,
 			activeContextName,
-			pkgOpts,
-			false,
+			upgradePkg.Installed.Binds,
+			upgradePkg.Installed.Env,
 		)
 		if err != nil {
 			return err
 		}
+		var notes string
+		var pkgNotes []InstalledPackageNote
+		var outputs map[string]string
+		if p.useBlueGreenUpgrade(upgradePkg, installCfg) {
+			// Install the new version alongside the old one, which is only removed once the new
+			// version is healthy
+			notes, pkgNotes, outputs, err = p.upgradeBlueGreen(
+				upgradePkg,
+				installCfg,
+				activeContextName,
+				pkgOpts,
+			)
+			if err != nil {
+				p.telemetry().recordPackageFailure(upgradePkg.Upgrade)
+				return err
+			}
+		} else {
+			// Deactivate old package
+			if err := p.deactivatePackage(p.config, upgradePkg.Installed.Package, activeContextName); err != nil {
+				p.config.Logger.Warn(
+					fmt.Sprintf("failed to deactivate package: %s", err),
+				)
+			}
+			// Uninstall old version
+			if err := p.uninstallPackage(upgradePkg.Installed, true, true, false); err != nil {
+				return err
+			}
+			// Migrate the package data. The progress is kept on failure, so that the next
+			// attempt resumes with the migration that failed
+			if err := p.runMigrations(upgradePkg, installCfg, activeContextName); err != nil {
+				p.telemetry().recordPackageFailure(upgradePkg.Upgrade)
+				p.restorePackage(upgradePkg.Installed)
+				return err
+			}
+			// Install new version
+			notes, pkgNotes, outputs, err = upgradePkg.Upgrade.install(
+				installCfg,
+				activeContextName,
+				pkgOpts,
+				false,
+			)
+			if err != nil {
+				p.telemetry().recordPackageFailure(upgradePkg.Upgrade)
+				// Reinstall the old version, so that a failed or cancelled upgrade doesn't leave
+				// the package uninstalled
+				p.restorePackage(upgradePkg.Installed)
+				return err
+			}
+		}
+		p.clearMigrations(upgradePkg.Upgrade, activeContextName)
 		installedPkg := NewInstalledPackage(
 			upgradePkg.Upgrade,
 			activeContextName,
@@ -296,6 +657,13 @@ func (p *PackageManager) Upgrade(pkgs ...string) error {
 			outputs,
 			pkgOpts,
 		)
+		installedPkg.Notes = pkgNotes
+		keepAcknowledgedNotes(installedPkg.Notes, upgradePkg.Installed.Notes)
+		installedPkg.Binds = upgradePkg.Installed.Binds
+		installedPkg.Env = upgradePkg.Installed.Env
+		installedPkg.ConfigProfile = upgradePkg.Installed.ConfigProfile
+		// New dependencies installed by the upgrade aren't explicit
+		installedPkg.Explicit = upgradePkg.Installed.Explicit
 		p.state.InstalledPackages = append(
 			p.state.InstalledPackages,
 			installedPkg,
@@ -303,61 +671,154 @@ func (p *PackageManager) Upgrade(pkgs ...string) error {
 		if err := p.state.Save(); err != nil {
 			return err
 		}
-		installedPkgs = append(installedPkgs, upgradePkg.Upgrade.Name)
-		if notes != "" {
-			notesOutput += fmt.Sprintf(
+		installedPkgs = append(installedPkgs, upgradePkg.Upgrade.instanceName())
+		testPkgs = append(testPkgs, installedPkg)
+		if tmpNotes := notesOutput(notes, installedPkg.Notes); tmpNotes != "" {
+			allNotesOutput += fmt.Sprintf(
 				"\nPost-install notes for %s (= %s):\n\n%s\n",
-				upgradePkg.Upgrade.Name,
+				upgradePkg.Upgrade.instanceName(),
 				upgradePkg.Upgrade.Version,
-				notes,
+				tmpNotes,
 			)
 		}
 		if err := p.state.Save(); err != nil {
 			return err
 		}
 		// Activate new package
-		if err := upgradePkg.Upgrade.activate(p.config, activeContextName); err != nil {
+		if err := p.activatePackage(p.config, upgradePkg.Upgrade, activeContextName); err != nil {
 			p.config.Logger.Warn(
 				fmt.Sprintf("failed to activate package: %s", err),
 			)
 		}
+		// Restore managed topology
+		p.reapplyTopology(installedPkg)
+	}
+	// Update env files
+	if err := p.refreshEnvFiles(activeContextName); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to update env files: %s", err),
+		)
 	}
 	// Display post-install notes
-	if notesOutput != "" {
-		p.config.Logger.Info(notesOutput)
+	if allNotesOutput != "" {
+		p.config.Logger.Info(
+			allNotesOutput,
+			EventAttr(EventPackageNotes),
+		)
 	}
 	p.config.Logger.Info(
 		fmt.Sprintf(
-			"Successfully upgraded/installed package(s) in context %q: %s",
+			"Successfully %s package(s) in context %q: %s",
+			action,
 			activeContextName,
 			strings.Join(installedPkgs, ", "),
 		),
+		EventAttr(EventPackageUpgraded),
+		slog.String("context", activeContextName),
+		slog.Any("packages", installedPkgs),
 	)
+	return p.testInstalledPackages(testPkgs)
+}
+
+// reloadState reloads the state from disk, to pick up changes made by other cardano-up processes
+// while a long-running operation is active
+func (p *PackageManager) reloadState() error {
+	state := NewState(p.config)
+	if err := state.Load(); err != nil {
+		return err
+	}
+	p.state = state
 	return nil
 }
 
+// restorePackage reinstalls a package that was uninstalled as part of a failed upgrade. This
+// ignores cancellation of the original operation, since that may be why the upgrade failed
+func (p *PackageManager) restorePackage(installedPkg InstalledPackage) {
+	p.config.Logger.Warn(
+		fmt.Sprintf(
+			"restoring package %s (= %s) after failed upgrade",
+			installedPkg.InstanceName(),
+			installedPkg.Package.Version,
+		),
+	)
+	cfg, err := p.installConfig(
+		installedPkg.Package,
+		installedPkg.Context,
+		installedPkg.Binds,
+		installedPkg.Env,
+	)
+	if err != nil {
+		p.config.Logger.Error(
+			fmt.Sprintf("failed to restore package: %s", err),
+		)
+		return
+	}
+	cfg.Context = context.WithoutCancel(cfg.ctx())
+	if _, _, _, err := installedPkg.Package.install(
+		cfg,
+		installedPkg.Context,
+		installedPkg.Options,
+		false,
+	); err != nil {
+		p.config.Logger.Error(
+			fmt.Sprintf("failed to restore package: %s", err),
+		)
+		return
+	}
+	p.state.InstalledPackages = append(
+		p.state.InstalledPackages,
+		installedPkg,
+	)
+	if err := p.state.Save(); err != nil {
+		p.config.Logger.Error(
+			fmt.Sprintf("failed to save state: %s", err),
+		)
+		return
+	}
+	if err := p.activatePackage(cfg, installedPkg.Package, installedPkg.Context); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to activate package: %s", err),
+		)
+	}
+	p.reapplyTopology(installedPkg)
+}
+
+// UninstallInContext uninstalls the specified packages from the specified context, rather than the
+// active context. See Uninstall
+func (p *PackageManager) UninstallInContext(
+	context string,
+	pkgNames []string,
+	keepData bool,
+	keepImages bool,
+	force bool,
+) error {
+	return p.inContext(
+		context,
+		func(ctxPm *PackageManager) error {
+			return ctxPm.Uninstall(pkgNames, keepData, keepImages, force)
+		},
+	)
+}
+
+// Uninstall uninstalls the specified packages from the active context. The package data, cache,
+// and logs dirs are kept with keepData, and the Docker images are kept with keepImages. Unless force
+// is set, this fails if any other installed package depends on one of them
 func (p *PackageManager) Uninstall(
-	pkgName string,
+	pkgNames []string,
 	keepData bool,
+	keepImages bool,
 	force bool,
 ) error {
-	// Find installed packages
-	activeContextName, _ := p.ActiveContext()
-	installedPackages := p.InstalledPackages()
-	var uninstallPkgs []InstalledPackage
-	foundPackage := false
-	for _, tmpPackage := range installedPackages {
-		if tmpPackage.Package.Name == pkgName {
-			foundPackage = true
-			uninstallPkgs = append(
-				uninstallPkgs,
-				tmpPackage,
-			)
-			break
-		}
+	unlock, err := p.lock()
+	if err != nil {
+		return err
 	}
-	if !foundPackage {
-		return NewPackageNotInstalledError(pkgName, activeContextName)
+	defer unlock()
+	// Find installed packages
+	activeContextName, _ := p.CurrentContext()
+	uninstallPkgs, err := p.installedPackagesBySpec(pkgNames, false)
+	if err != nil {
+		return err
 	}
 	if !force {
 		// Resolve dependencies
@@ -365,6 +826,7 @@ func (p *PackageManager) Uninstall(
 			p.InstalledPackages(),
 			p.AvailablePackages(),
 			activeContextName,
+			p.config.Template,
 			p.config.Logger,
 		)
 		if err != nil {
@@ -376,24 +838,71 @@ func (p *PackageManager) Uninstall(
 	}
 	for _, uninstallPkg := range uninstallPkgs {
 		// Deactivate package
-		if err := uninstallPkg.Package.deactivate(p.config, activeContextName); err != nil {
+		if err := p.deactivatePackage(p.config, uninstallPkg.Package, activeContextName); err != nil {
 			p.config.Logger.Warn(
 				fmt.Sprintf("failed to deactivate package: %s", err),
 			)
 		}
-		if err := p.uninstallPackage(uninstallPkg, keepData, true); err != nil {
+		if err := p.uninstallPackage(uninstallPkg, keepData, keepImages, true); err != nil {
 			return err
 		}
-		if err := p.state.Save(); err != nil {
-			return err
+		if otherVersionInstalled(p.state.InstalledPackages, uninstallPkg, nil) {
+			// The host ports, managed topology, and env file are shared with the other version
+			// of the package that's still installed, which gets its binaries back
+			if err := p.state.Save(); err != nil {
+				return err
+			}
+			for _, tmpPkg := range p.InstalledPackages() {
+				if tmpPkg.InstanceName() != uninstallPkg.InstanceName() {
+					continue
+				}
+				if err := p.activatePackage(p.config, tmpPkg.Package, activeContextName); err != nil {
+					p.config.Logger.Warn(
+						fmt.Sprintf("failed to activate package: %s", err),
+					)
+				}
+			}
+		} else {
+			// Release any host ports allocated to the package and its managed topology
+			p.state.Ports.Release(
+				portOwner(uninstallPkg.Package, uninstallPkg.Context),
+			)
+			delete(
+				p.state.Topologies,
+				portOwner(uninstallPkg.Package, uninstallPkg.Context),
+			)
+			if err := p.state.Save(); err != nil {
+				return err
+			}
+			// Remove package env file
+			pkgEnvFile := packageEnvFilePath(
+				p.config,
+				uninstallPkg.Context,
+				uninstallPkg.InstanceName(),
+			)
+			if err := removeEnvFile(pkgEnvFile); err != nil {
+				p.config.Logger.Warn(
+					fmt.Sprintf("failed to remove package env file: %s", err),
+				)
+			}
 		}
 		p.config.Logger.Info(
 			fmt.Sprintf(
 				"Successfully uninstalled package %s (= %s) from context %q",
-				uninstallPkg.Package.Name,
+				uninstallPkg.InstanceName(),
 				uninstallPkg.Package.Version,
 				activeContextName,
 			),
+			EventAttr(EventPackageUninstalled),
+			slog.String("context", activeContextName),
+			slog.String("package", uninstallPkg.InstanceName()),
+			slog.String("version", uninstallPkg.Package.Version),
+		)
+	}
+	// Update env files
+	if err := p.refreshEnvFiles(activeContextName); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to update env files: %s", err),
 		)
 	}
 	return nil
@@ -401,18 +910,17 @@ func (p *PackageManager) Uninstall(
 
 func (p *PackageManager) Logs(
 	pkgName string,
-	follow bool,
-	tail string,
+	opts LogsOptions,
 	stdoutWriter io.Writer,
 	stderrWriter io.Writer,
 ) error {
 	// Find installed packages
-	activeContextName, _ := p.ActiveContext()
+	activeContextName, _ := p.CurrentContext()
 	installedPackages := p.InstalledPackages()
 	var logsPkg InstalledPackage
 	foundPackage := false
 	for _, tmpPackage := range installedPackages {
-		if tmpPackage.Package.Name == pkgName {
+		if tmpPackage.InstanceName() == pkgName {
 			foundPackage = true
 			logsPkg = tmpPackage
 			break
@@ -428,35 +936,99 @@ func (p *PackageManager) Logs(
 	if len(services) == 0 {
 		return NewNoServicesFoundError(pkgName)
 	}
+	// Only output the lines matching the grep pattern, if provided
+	grepRegexp, err := opts.grepRegexp()
+	if err != nil {
+		return err
+	}
+	if grepRegexp != nil {
+		stdoutGrep := newLogGrepWriter(stdoutWriter, grepRegexp)
+		stderrGrep := newLogGrepWriter(stderrWriter, grepRegexp)
+		defer func() {
+			_ = stdoutGrep.Flush()
+			_ = stderrGrep.Flush()
+		}()
+		stdoutWriter = stdoutGrep
+		stderrWriter = stderrGrep
+	}
 	// TODO: account for more than one service in a package
 	tmpSvc := services[0]
-	if err := tmpSvc.Logs(follow, tail, stdoutWriter, stderrWriter); err != nil {
+	if err := tmpSvc.Logs(opts, stdoutWriter, stderrWriter); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *PackageManager) Info(pkgs ...string) error {
-	// Find installed packages
-	activeContextName, _ := p.ActiveContext()
-	installedPackages := p.InstalledPackages()
-	var infoPkgs []InstalledPackage
-	for _, pkg := range pkgs {
-		foundPackage := false
-		for _, tmpPackage := range installedPackages {
-			if tmpPackage.Package.Name == pkg {
-				foundPackage = true
-				infoPkgs = append(
-					infoPkgs,
-					tmpPackage,
-				)
-				break
-			}
+// packageService returns the service for a container of an installed package in the active
+// context. The container name is the name from the package, and is required for packages with more
+// than one container
+func (p *PackageManager) packageService(
+	pkgName string,
+	containerName string,
+) (*DockerService, error) {
+	activeContextName, _ := p.CurrentContext()
+	var svcPkg InstalledPackage
+	for _, tmpPackage := range p.InstalledPackages() {
+		if tmpPackage.InstanceName() == pkgName {
+			svcPkg = tmpPackage
+			break
 		}
-		if !foundPackage {
-			return NewPackageNotInstalledError(pkg, activeContextName)
+	}
+	if svcPkg.IsEmpty() {
+		return nil, NewPackageNotInstalledError(pkgName, activeContextName)
+	}
+	services, err := svcPkg.Package.services(p.config, activeContextName)
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, NewNoServicesFoundError(pkgName)
+	}
+	return selectPackageService(
+		services,
+		fmt.Sprintf(
+			"%s-%s-%s-",
+			svcPkg.Package.instanceName(),
+			svcPkg.Package.Version,
+			activeContextName,
+		),
+		pkgName,
+		containerName,
+	)
+}
+
+// selectPackageService returns the service with the provided container name, or the only service
+// if no container name is provided. The container names of the services start with the prefix
+func selectPackageService(
+	services []*DockerService,
+	prefix string,
+	pkgName string,
+	containerName string,
+) (*DockerService, error) {
+	var containerNames []string
+	for _, svc := range services {
+		shortContainerName := strings.TrimPrefix(svc.ContainerName, prefix)
+		if shortContainerName == containerName {
+			return svc, nil
 		}
+		containerNames = append(containerNames, shortContainerName)
+	}
+	if containerName == "" && len(services) == 1 {
+		return services[0], nil
+	}
+	return nil, NewPackageContainerError(pkgName, containerName, containerNames)
+}
+
+func (p *PackageManager) Info(pkgs ...string) error {
+	// Find installed packages. All tracked versions of a package are shown unless a version is
+	// specified
+	activeContextName, _ := p.CurrentContext()
+	infoPkgs, err := p.installedPackagesBySpec(pkgs, true)
+	if err != nil {
+		return err
 	}
+	dockerErr := checkDockerAvailable(p.config.ctx(), p.config.DockerHost)
+	statuses := make(map[string]bool)
 	var infoOutput string
 	for idx, infoPkg := range infoPkgs {
 		infoOutput += fmt.Sprintf(
@@ -465,11 +1037,52 @@ func (p *PackageManager) Info(pkgs ...string) error {
 			infoPkg.Package.Version,
 			activeContextName,
 		)
-		if infoPkg.PostInstallNotes != "" {
+		if infoPkg.Instance != "" {
+			infoOutput += fmt.Sprintf("\nInstance: %s", infoPkg.Instance)
+		}
+		if infoPkg.ConfigProfile != "" {
+			infoOutput += fmt.Sprintf("\nConfig profile: %s", infoPkg.ConfigProfile)
+		}
+		if infoPkg.Package.ReleaseNotesUrl != "" {
+			infoOutput += fmt.Sprintf("\nRelease notes: %s", infoPkg.Package.ReleaseNotesUrl)
+		}
+		if tmpNotes := notesOutput(infoPkg.PostInstallNotes, infoPkg.Notes); tmpNotes != "" {
 			infoOutput += fmt.Sprintf(
 				"\n\nPost-install notes:\n\n%s",
-				infoPkg.PostInstallNotes,
+				tmpNotes,
+			)
+		}
+		if len(infoPkg.Hooks) > 0 {
+			hookTable := p.newTable("HOOK", "EXIT STATUS", "DURATION")
+			hookTable.SetColumnColor(1, exitStatusColor)
+			for _, hookResult := range infoPkg.Hooks {
+				hookTable.AddRow(
+					hookResult.Hook,
+					strconv.Itoa(hookResult.ExitCode),
+					hookResult.Duration.Round(time.Millisecond).String(),
+				)
+			}
+			infoOutput += "\n\nHook scripts:\n\n" + hookTable.String()
+		}
+		statusTable := p.newTable("CONTAINER", "STATUS")
+		statusTable.SetColumnColor(1, serviceStatusColor)
+		// Show the last known status of the containers when Docker is unavailable, rather than
+		// failing
+		if dockerErr != nil {
+			for _, containerName := range infoPkg.containerNames(p.config) {
+				statusTable.AddRow(containerName, p.unknownServiceStatus(containerName))
+			}
+			if statusTable.Len() > 0 {
+				infoOutput += "\n\nServices:\n\n" + statusTable.String()
+			}
+			infoOutput += fmt.Sprintf(
+				"\n\nDocker is unavailable, so the container status, mapped ports, and resource usage are unknown: %s",
+				dockerErr,
 			)
+			if idx < len(infoPkgs)-1 {
+				infoOutput += "\n\n---\n\n"
+			}
+			continue
 		}
 		// Gather package services
 		services, err := infoPkg.Package.services(p.config, infoPkg.Context)
@@ -477,23 +1090,19 @@ func (p *PackageManager) Info(pkgs ...string) error {
 			return err
 		}
 		// Build service status and port output
-		var statusOutput string
-		var portOutput string
+		portTable := p.newTable("HOST", "CONTAINER")
+		var runningServices []*DockerService
 		for _, svc := range services {
 			running, err := svc.Running()
 			if err != nil {
 				return err
 			}
+			statuses[svc.ContainerName] = running
 			if running {
-				statusOutput += fmt.Sprintf(
-					"%-60s RUNNING\n",
-					svc.ContainerName,
-				)
+				runningServices = append(runningServices, svc)
+				statusTable.AddRow(svc.ContainerName, serviceStatusRunning)
 			} else {
-				statusOutput += fmt.Sprintf(
-					"%-60s NOT RUNNING\n",
-					svc.ContainerName,
-				)
+				statusTable.AddRow(svc.ContainerName, serviceStatusNotRunning)
 			}
 			for _, port := range svc.Ports {
 				var containerPort, hostPort string
@@ -509,47 +1118,126 @@ func (p *PackageManager) Info(pkgs ...string) error {
 					containerPort = portParts[2]
 					hostPort = portParts[1]
 				}
-				portOutput += fmt.Sprintf(
-					"%-5s (host) => %-5s (container)\n",
-					hostPort,
-					containerPort,
-				)
+				portTable.AddRow(hostPort, containerPort)
 			}
 		}
-		if statusOutput != "" {
-			infoOutput += fmt.Sprintf(
-				"\n\nServices:\n\n%s",
-				strings.TrimSuffix(statusOutput, "\n"),
-			)
+		if statusTable.Len() > 0 {
+			infoOutput += "\n\nServices:\n\n" + statusTable.String()
 		}
-		if portOutput != "" {
-			infoOutput += fmt.Sprintf(
-				"\n\nMapped ports:\n\n%s",
-				strings.TrimSuffix(portOutput, "\n"),
-			)
+		if portTable.Len() > 0 {
+			infoOutput += "\n\nMapped ports:\n\n" + portTable.String()
+		}
+		if statsOutput := p.serviceStatsOutput(runningServices); statsOutput != "" {
+			infoOutput += "\n\nResource usage:\n\n" + statsOutput
 		}
 		if idx < len(infoPkgs)-1 {
 			infoOutput += "\n\n---\n\n"
 		}
 	}
-	p.config.Logger.Info(infoOutput)
+	p.recordServiceStatuses(statuses)
+	p.config.Logger.Info(
+		infoOutput,
+		EventAttr(EventPackageInfo),
+	)
 	return nil
 }
 
+// serviceStatsOutput returns a table with the resource usage for the provided services. Stats are
+// gathered in parallel, since each takes a second or two, and services that fail are skipped
+func (p *PackageManager) serviceStatsOutput(services []*DockerService) string {
+	if len(services) == 0 {
+		return ""
+	}
+	stats := make([]*ContainerStats, len(services))
+	var wg sync.WaitGroup
+	for idx, svc := range services {
+		wg.Add(1)
+		go func(idx int, svc *DockerService) {
+			defer wg.Done()
+			tmpStats, err := svc.Stats()
+			if err != nil {
+				p.config.Logger.Warn(
+					fmt.Sprintf(
+						"failed to get stats for container %s: %s",
+						svc.ContainerName,
+						err,
+					),
+				)
+				return
+			}
+			stats[idx] = &tmpStats
+		}(idx, svc)
+	}
+	wg.Wait()
+	statsTable := p.newTable("CONTAINER", "CPU %", "MEM USAGE / LIMIT", "NET I/O", "BLOCK I/O")
+	for idx, svc := range services {
+		if stats[idx] == nil {
+			continue
+		}
+		statsTable.AddRow(
+			svc.ContainerName,
+			fmt.Sprintf("%.2f%%", stats[idx].CPUPercent),
+			FormatBytes(stats[idx].MemoryUsage)+" / "+FormatBytes(stats[idx].MemoryLimit),
+			FormatBytes(stats[idx].NetRxBytes)+" / "+FormatBytes(stats[idx].NetTxBytes),
+			FormatBytes(stats[idx].BlockReadBytes)+" / "+FormatBytes(stats[idx].BlockWriteBytes),
+		)
+	}
+	if statsTable.Len() == 0 {
+		return ""
+	}
+	return statsTable.String()
+}
+
+const (
+	serviceStatusRunning    = "RUNNING"
+	serviceStatusNotRunning = "NOT RUNNING"
+)
+
+// newTable returns a table for output, with color enabled when configured
+func (p *PackageManager) newTable(headers ...string) *table.Table {
+	ret := table.New(headers...)
+	ret.Color = p.config.Color
+	return ret
+}
+
+func serviceStatusColor(status string) table.Color {
+	if status == serviceStatusRunning {
+		return table.ColorGreen
+	}
+	if strings.HasPrefix(status, serviceStatusUnknown) {
+		return table.ColorYellow
+	}
+	return table.ColorRed
+}
+
+func exitStatusColor(exitStatus string) table.Color {
+	if exitStatus == "0" {
+		return table.ColorGreen
+	}
+	return table.ColorRed
+}
+
 func (p *PackageManager) uninstallPackage(
 	uninstallPkg InstalledPackage,
 	keepData bool,
+	keepImages bool,
 	runHooks bool,
 ) error {
 	// Uninstall package
-	if err := uninstallPkg.Package.uninstall(p.config, uninstallPkg.Context, keepData, runHooks); err != nil {
+	cfg := p.config
+	cfg.sharedNetworks = p.sharedNetworks(uninstallPkg)
+	cfg.otherVersionInstalled = otherVersionInstalled(p.state.InstalledPackages, uninstallPkg, nil)
+	// The origin decides whether hook scripts are trusted
+	tmpPkg := uninstallPkg.Package
+	tmpPkg.origin = uninstallPkg.Origin
+	if err := tmpPkg.uninstall(cfg, uninstallPkg.Context, keepData, keepImages, runHooks); err != nil {
 		return err
 	}
 	// Remove package from installed packages
 	var tmpInstalledPackages []InstalledPackage
 	for _, tmpInstalledPkg := range p.state.InstalledPackages {
 		if tmpInstalledPkg.Context == uninstallPkg.Context &&
-			tmpInstalledPkg.Package.Name == uninstallPkg.Package.Name &&
+			tmpInstalledPkg.InstanceName() == uninstallPkg.InstanceName() &&
 			tmpInstalledPkg.Package.Version == uninstallPkg.Package.Version {
 			continue
 		}
@@ -559,6 +1247,115 @@ func (p *PackageManager) uninstallPackage(
 	return nil
 }
 
+// installConfig returns a copy of the config with the package-specific template functions and
+// secrets added
+func (p *PackageManager) installConfig(
+	pkg Package,
+	context string,
+	binds []string,
+	env []string,
+) (Config, error) {
+	cfg := p.config
+	cfg.bindOverrides = binds
+	cfg.envOverrides = env
+	cfg.contextName = context
+	cfg.sharedNetworks = p.sharedNetworks(
+		InstalledPackage{Package: pkg, Instance: pkg.instance, Context: context},
+	)
+	secrets, err := packageSecrets(cfg, pkg)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.secrets = secrets
+	cfg.sockets = p.packageSockets(pkg, context)
+	cfg.Template = cfg.Template.WithVars(socketTemplateVars(cfg.sockets))
+	owner := portOwner(pkg, context)
+	cfg.Template = cfg.Template.WithFuncs(
+		template.FuncMap{
+			"freePort": func(port int) (int, error) {
+				hostPort, err := p.state.Ports.allocate(
+					owner,
+					port,
+					isLocalDockerHost(cfg.DockerHost),
+				)
+				if err != nil {
+					return 0, err
+				}
+				if hostPort != port {
+					p.config.Logger.Debug(
+						fmt.Sprintf(
+							"allocated host port %d for requested port %d",
+							hostPort,
+							port,
+						),
+					)
+				}
+				return hostPort, nil
+			},
+		},
+	)
+	return cfg, nil
+}
+
+// restartPackageContainers restarts the running containers for an installed package to pick up
+// changes to its files. Only the named container is restarted if a container name is provided
+func (p *PackageManager) restartPackageContainers(
+	installedPkg InstalledPackage,
+	containerName string,
+	reason string,
+) error {
+	services, err := installedPkg.Package.services(p.config, installedPkg.Context)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if containerName != "" &&
+			!strings.HasSuffix(svc.ContainerName, "-"+containerName) {
+			continue
+		}
+		running, err := svc.Running()
+		if err != nil {
+			return err
+		}
+		if !running {
+			continue
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf(
+				"Restarting container %s to apply %s",
+				svc.ContainerName,
+				reason,
+			),
+		)
+		applyStopTimeoutDefault(p.config, svc)
+		if err := svc.Stop(); err != nil {
+			return err
+		}
+		if err := svc.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// portOwner returns the key used for a package in the port and topology registries. Package and
+// instance names can't contain a '/', so the key is unambiguous for any context name
+func portOwner(pkg Package, context string) string {
+	return context + "/" + pkg.instanceName()
+}
+
+// legacyPortOwner returns the registry key used by older versions, which is ambiguous between
+// package and context names containing a '-'
+func legacyPortOwner(pkg Package, context string) string {
+	return fmt.Sprintf("%s-%s", pkg.instanceName(), context)
+}
+
+// usesActiveDockerHost returns whether the named context uses the same Docker host as the active
+// context, for operations that cover containers in all contexts
+func (p *PackageManager) usesActiveDockerHost(contextName string) bool {
+	return p.state.Contexts[contextName].DockerHost == p.config.DockerHost
+}
+
 func (p *PackageManager) Contexts() map[string]Context {
 	return p.state.Contexts
 }
@@ -567,7 +1364,76 @@ func (p *PackageManager) ActiveContext() (string, Context) {
 	return p.state.ActiveContext, p.state.Contexts[p.state.ActiveContext]
 }
 
+// CurrentContext returns the context that operations apply to. This is the active context, unless
+// the package manager was returned by ForContext
+func (p *PackageManager) CurrentContext() (string, Context) {
+	if p.contextName == "" {
+		return p.ActiveContext()
+	}
+	return p.contextName, p.state.Contexts[p.contextName]
+}
+
+// ForContext returns a package manager whose operations apply to the specified context, rather
+// than the active context. The active context isn't changed, and binaries for packages installed
+// in another context aren't linked until that context is selected
+func (p *PackageManager) ForContext(name string) (*PackageManager, error) {
+	if _, ok := p.state.Contexts[name]; !ok {
+		return nil, ErrContextNotExist
+	}
+	ret := *p
+	ret.contextName = name
+	ret.initDockerHost()
+	ret.initTemplate()
+	return &ret, nil
+}
+
+// inContext runs an operation with a package manager for the specified context, and picks up the
+// resulting state changes
+func (p *PackageManager) inContext(name string, fn func(*PackageManager) error) error {
+	ctxPm, err := p.ForContext(name)
+	if err != nil {
+		return err
+	}
+	err = fn(ctxPm)
+	p.state = ctxPm.state
+	return err
+}
+
+// activatePackage links the binaries for an installed package into the bin dir for its context,
+// and into BinDir if it's in the active context. Packages in other contexts are linked into BinDir
+// when their context is selected
+func (p *PackageManager) activatePackage(cfg Config, pkg Package, context string) error {
+	ctxCfg := cfg
+	ctxCfg.BinDir = contextBinDir(cfg, context)
+	if err := pkg.activate(ctxCfg, context); err != nil {
+		return err
+	}
+	if context != p.state.ActiveContext {
+		return nil
+	}
+	return pkg.activate(cfg, context)
+}
+
+// deactivatePackage removes the binaries for an installed package from the bin dir for its
+// context, and from BinDir if it's in the active context
+func (p *PackageManager) deactivatePackage(cfg Config, pkg Package, context string) error {
+	ctxCfg := cfg
+	ctxCfg.BinDir = contextBinDir(cfg, context)
+	if err := pkg.deactivate(ctxCfg, context); err != nil {
+		return err
+	}
+	if context != p.state.ActiveContext {
+		return nil
+	}
+	return pkg.deactivate(cfg, context)
+}
+
 func (p *PackageManager) AddContext(name string, context Context) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if _, ok := p.state.Contexts[name]; ok {
 		return ErrContextAlreadyExists
 	}
@@ -581,6 +1447,11 @@ func (p *PackageManager) AddContext(name string, context Context) error {
 }
 
 func (p *PackageManager) DeleteContext(name string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if name == p.state.ActiveContext {
 		return ErrContextNoDeleteActive
 	}
@@ -595,12 +1466,17 @@ func (p *PackageManager) DeleteContext(name string) error {
 }
 
 func (p *PackageManager) SetActiveContext(name string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if _, ok := p.state.Contexts[name]; !ok {
 		return ErrContextNotExist
 	}
 	// Deactivate packages in current context
 	activeContextName, _ := p.ActiveContext()
-	for _, pkg := range p.InstalledPackages() {
+	for _, pkg := range p.InstalledPackagesInContext(activeContextName) {
 		if err := pkg.Package.deactivate(p.config, activeContextName); err != nil {
 			p.config.Logger.Warn(
 				fmt.Sprintf("failed to deactivate package: %s", err),
@@ -612,19 +1488,42 @@ func (p *PackageManager) SetActiveContext(name string) error {
 		return err
 	}
 	// Update templating values
+	p.initDockerHost()
 	p.initTemplate()
 	// Activate packages in new context
-	for _, pkg := range p.InstalledPackages() {
+	for _, pkg := range p.InstalledPackagesInContext(name) {
 		if err := pkg.Package.activate(p.config, name); err != nil {
 			p.config.Logger.Warn(
 				fmt.Sprintf("failed to activate package: %s", err),
 			)
 		}
 	}
+	if name != activeContextName &&
+		(len(p.InstalledPackagesInContext(name)) > 0 ||
+			len(p.InstalledPackagesInContext(activeContextName)) > 0) {
+		p.config.Logger.Info(
+			fmt.Sprintf(
+				"The binaries in %s now run the packages in context %q. Shells that loaded the env vars from `context env` keep running the packages in their own context",
+				p.config.BinDir,
+				name,
+			),
+		)
+	}
+	// Update env files
+	if err := p.refreshEnvFiles(name); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to update env files: %s", err),
+		)
+	}
 	return nil
 }
 
 func (p *PackageManager) UpdateContext(name string, context Context) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if err := p.updateContext(name, context); err != nil {
 		return err
 	}
@@ -637,26 +1536,87 @@ func (p *PackageManager) updateContext(name string, newContext Context) error {
 	if !ok {
 		return ErrContextNotExist
 	}
+	var networkConfigSrcDir string
 	if curContext.Network != "" {
 		// Check that we're not changing the network once configured
 		if newContext.Network != curContext.Network {
 			return ErrContextNoChangeNetwork
 		}
-	} else {
+		if newContext.NetworkMagic != 0 &&
+			newContext.NetworkMagic != curContext.NetworkMagic {
+			return ErrContextNoChangeNetwork
+		}
+		if newContext.NetworkConfigDir != "" &&
+			newContext.NetworkConfigDir != curContext.NetworkConfigDir {
+			return ErrContextNoChangeNetwork
+		}
+		newContext.NetworkMagic = curContext.NetworkMagic
+		newContext.CustomNetwork = curContext.CustomNetwork
+		newContext.NetworkConfigDir = curContext.NetworkConfigDir
+		newContext.Devnet = curContext.Devnet
+	} else if newContext.Network != "" {
 		// Check network name if setting it for new/empty context
-		if newContext.Network != "" {
-			tmpNetwork, ok := ouroboros.NetworkByName(newContext.Network)
-			if !ok {
-				return NewUnknownNetworkError(newContext.Network)
+		tmpNetwork, ok := ouroboros.NetworkByName(newContext.Network)
+		if ok {
+			if newContext.NetworkMagic != 0 && newContext.NetworkMagic != tmpNetwork.NetworkMagic {
+				return NewNetworkMagicMismatchError(newContext.Network, tmpNetwork.NetworkMagic)
+			}
+			if newContext.NetworkConfigDir != "" {
+				return NewNetworkConfigKnownNetworkError(newContext.Network)
 			}
 			newContext.NetworkMagic = tmpNetwork.NetworkMagic
+			newContext.CustomNetwork = false
+		} else {
+			// Networks that aren't known are custom networks, which require a network magic
+			if err := newContext.validateCustomNetwork(); err != nil {
+				return err
+			}
+			newContext.CustomNetwork = true
+			networkConfigSrcDir = newContext.NetworkConfigDir
+		}
+	} else if newContext.NetworkMagic != 0 || newContext.NetworkConfigDir != "" {
+		return ErrCustomNetworkNoName
+	}
+	if err := newContext.validateDockerHost(); err != nil {
+		return err
+	}
+	if err := newContext.validateDataRoot(); err != nil {
+		return err
+	}
+	if err := validateContainerUser(newContext.ContainerUser); err != nil {
+		return err
+	}
+	if newContext.DataRoot != curContext.DataRoot {
+		// Existing package data would be left behind in the old data root
+		for _, installedPkg := range p.state.InstalledPackages {
+			if installedPkg.Context == name {
+				return ErrContextNoChangeDataRoot
+			}
 		}
 	}
+	if newContext.DockerHost != curContext.DockerHost ||
+		newContext.RemoteDataDir != curContext.RemoteDataDir {
+		// Existing containers would be left behind on the old Docker host
+		for _, installedPkg := range p.state.InstalledPackages {
+			if installedPkg.Context == name {
+				return ErrContextNoChangeDockerHost
+			}
+		}
+	}
+	// Copy the config and genesis files for a custom network into the context dir
+	if networkConfigSrcDir != "" {
+		networkConfigDir, err := importNetworkConfig(p.config, name, networkConfigSrcDir)
+		if err != nil {
+			return err
+		}
+		newContext.NetworkConfigDir = networkConfigDir
+	}
 	p.state.Contexts[name] = newContext
 	if err := p.state.Save(); err != nil {
 		return err
 	}
 	// Update templating values
+	p.initDockerHost()
 	p.initTemplate()
 	return nil
 }
@@ -671,20 +1631,104 @@ func (p *PackageManager) ContextEnv() map[string]string {
 	return ret
 }
 
-func (p *PackageManager) UpdatePackages() error {
-	// Clear out existing cache files
-	cachePath := filepath.Join(
-		p.config.CacheDir,
-		"registry",
-	)
-	if err := os.RemoveAll(cachePath); err != nil {
+// ContextEnvFile returns the path to the combined env file for the active context
+func (p *PackageManager) ContextEnvFile() string {
+	activeContextName, _ := p.CurrentContext()
+	return contextEnvFilePath(p.config, activeContextName)
+}
+
+// ContextBinDir returns the dir with the binaries for the packages in the active context. Unlike
+// BinDir, it keeps pointing at the binaries for the same context when another one is selected
+func (p *PackageManager) ContextBinDir() string {
+	activeContextName, _ := p.CurrentContext()
+	return contextBinDir(p.config, activeContextName)
+}
+
+// ActiveEnvFile returns the path to the env file that always reflects the active context. This
+// is used by the shell hooks to pick up changes when switching contexts
+func (p *PackageManager) ActiveEnvFile() string {
+	return activeEnvFilePath(p.config)
+}
+
+// refreshEnvFiles (re)writes the per-package env files and the combined env file for the given context
+func (p *PackageManager) refreshEnvFiles(context string) error {
+	contextEnv := make(map[string]string)
+	for _, pkg := range p.state.InstalledPackages {
+		if pkg.Context != context {
+			continue
+		}
+		pkgEnvFile := packageEnvFilePath(p.config, context, pkg.InstanceName())
+		if err := writeEnvFile(pkgEnvFile, pkg.Outputs); err != nil {
+			return err
+		}
+		for k, v := range pkg.Outputs {
+			contextEnv[k] = v
+		}
+	}
+	if err := writeEnvFile(contextEnvFilePath(p.config, context), contextEnv); err != nil {
 		return err
 	}
+	if context == p.state.ActiveContext {
+		if err := writeEnvFile(activeEnvFilePath(p.config), contextEnv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdatePackages refreshes the package registry cache, and returns the changes to the available
+// packages since the registry was last fetched
+func (p *PackageManager) UpdatePackages() (RegistryChanges, error) {
+	// Record the packages as of the last update for comparison, including any that were
+	// replaced by a background refresh since then
+	prevPkgs, err := cachedRegistryPackages(p.config)
+	if err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to load cached packages: %s", err),
+		)
+	}
+	// Fetch the registry, replacing the existing cache files
+	if p.config.RegistryDir == "" && p.config.RegistryUrl != "" {
+		if err := fetchRegistry(p.config); err != nil {
+			return RegistryChanges{}, err
+		}
+	}
 	// (Re)load the package registry
 	if err := p.loadPackageRegistry(false); err != nil {
-		return err
+		return RegistryChanges{}, err
 	}
-	return nil
+	// The changes since the registry snapshot are reported below, so the next update compares
+	// against the current registry
+	if p.config.RegistryDir == "" {
+		if err := removeRegistrySnapshot(p.config); err != nil {
+			p.config.Logger.Warn(
+				fmt.Sprintf("failed to remove registry snapshot: %s", err),
+			)
+		}
+	}
+	if prevPkgs == nil {
+		return RegistryChanges{Initial: true}, nil
+	}
+	var tmpPrevPkgs []Package
+	for _, pkg := range prevPkgs {
+		if pkg.hasTags(p.config.RequiredPackageTags) {
+			tmpPrevPkgs = append(tmpPrevPkgs, pkg)
+		}
+	}
+	ret := RegistryChanges{
+		Packages: registryChanges(tmpPrevPkgs, p.AvailablePackages()),
+	}
+	return ret, nil
+}
+
+// RefreshRegistry fetches the registry into the cache without loading it, such as to refresh a
+// stale cache in the background. Unlike UpdatePackages, the registry snapshot is kept so that the
+// next update still reports the changes since the last one
+func (p *PackageManager) RefreshRegistry() error {
+	if p.config.RegistryDir != "" || p.config.RegistryUrl == "" {
+		return nil
+	}
+	return fetchRegistry(p.config)
 }
 
 func (p *PackageManager) ValidatePackages() error {
@@ -710,15 +1754,21 @@ func (p *PackageManager) ValidatePackages() error {
 				pkg.filePath,
 			),
 		)
-		if err := pkg.validate(p.config); err != nil {
-			foundError = true
-			p.config.Logger.Warn(
-				fmt.Sprintf(
-					"validation failed: %s: %s",
-					pkg.filePath,
-					err.Error(),
-				),
+		for _, finding := range pkg.lint(p.config, p.availablePackages) {
+			msg := fmt.Sprintf(
+				"%s: %s",
+				pkg.filePath,
+				finding.String(),
 			)
+			switch finding.Severity {
+			case LintSeverityError:
+				foundError = true
+				p.config.Logger.Error(msg)
+			case LintSeverityWarning:
+				p.config.Logger.Warn(msg)
+			default:
+				p.config.Logger.Info(msg)
+			}
 		}
 	}
 	if foundError {
@@ -0,0 +1,586 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"runtime"
+	"text/template"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PlanVersion is the version of the plan document format
+const PlanVersion = 1
+
+const (
+	PlanCommandInstall   = "install"
+	PlanCommandUpgrade   = "upgrade"
+	PlanCommandUninstall = "uninstall"
+)
+
+const (
+	PlanActionInstall   = "install"
+	PlanActionUpgrade   = "upgrade"
+	PlanActionDowngrade = "downgrade"
+	PlanActionUninstall = "uninstall"
+)
+
+// Plan describes what an install, upgrade, or uninstall will do in a context, so that it can be
+// reviewed before being applied
+type Plan struct {
+	Version     int         `json:"version"`
+	Command     string      `json:"command"`
+	Context     string      `json:"context"`
+	CreatedTime time.Time   `json:"createdTime"`
+	Request     PlanRequest `json:"request"`
+	// Actions are the package changes, in the order that they will be made
+	Actions []PlanAction `json:"actions"`
+	// DownloadSize is the estimated total size of the images that need to be pulled
+	DownloadSize uint64 `json:"downloadSize"`
+	// DiskSpace is the total free disk space that the packages to install require for their data
+	DiskSpace uint64 `json:"diskSpace,omitempty"`
+}
+
+// PlanRequest holds the arguments of the command that the plan is for
+type PlanRequest struct {
+	Packages []string `json:"packages,omitempty"`
+	// Instance is the instance name when installing an additional instance of a package
+	Instance string `json:"instance,omitempty"`
+	// Path is the local package file or directory to install from
+	Path string `json:"path,omitempty"`
+	// Binds are the bind overrides for the requested packages
+	Binds []string `json:"binds,omitempty"`
+	// Env are the env overrides for the requested packages
+	Env []string `json:"env,omitempty"`
+	// ConfigProfile is the built-in config profile for the requested packages
+	ConfigProfile string `json:"configProfile,omitempty"`
+	KeepData      bool   `json:"keepData,omitempty"`
+	KeepImages    bool   `json:"keepImages,omitempty"`
+	Cascade       bool   `json:"cascade,omitempty"`
+}
+
+// PlanAction is a change to a single package
+type PlanAction struct {
+	Action string `json:"action"`
+	// Package is the instance name of the package
+	Package string `json:"package"`
+	Version string `json:"version"`
+	// InstalledVersion is the currently installed version for an upgrade or downgrade
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	// Dependency is true for packages that are only changed because of a requested package, such
+	// as new dependencies, or dependent packages that are uninstalled when cascading
+	Dependency bool `json:"dependency,omitempty"`
+	// Images are the images used by the package containers, or the images that will be removed
+	// for an uninstall
+	Images []PlanImage `json:"images,omitempty"`
+	// Ports are the container port mappings in the Docker -p flag format
+	Ports []string `json:"ports,omitempty"`
+	// DiskSpace is the free disk space that the package requires for its data
+	DiskSpace uint64 `json:"diskSpace,omitempty"`
+}
+
+// PlanImage is an image used by a package
+type PlanImage struct {
+	Image string `json:"image"`
+	// Present is whether the image is already present on the Docker host
+	Present bool `json:"present"`
+	// DownloadSize is the compressed size of the image in its registry, or 0 if the image is
+	// present or its size couldn't be determined
+	DownloadSize uint64 `json:"downloadSize,omitempty"`
+}
+
+// Plan returns what running the command with the request will do in the active context. No
+// changes are made, and host ports are not allocated
+func (p *PackageManager) Plan(command string, req PlanRequest) (Plan, error) {
+	activeContextName, _ := p.CurrentContext()
+	ret := Plan{
+		Version:     PlanVersion,
+		Command:     command,
+		Context:     activeContextName,
+		CreatedTime: time.Now(),
+		Request:     req,
+		Actions:     []PlanAction{},
+	}
+	images := newPlanImages(p.config)
+	var err error
+	switch command {
+	case PlanCommandInstall:
+		ret.Actions, err = p.planInstall(req, images)
+	case PlanCommandUpgrade:
+		ret.Actions, err = p.planUpgrade(req, images)
+	case PlanCommandUninstall:
+		ret.Actions, err = p.planUninstall(req, images)
+	default:
+		return Plan{}, NewPlanCommandUnknownError(command)
+	}
+	if err != nil {
+		return Plan{}, err
+	}
+	if command != PlanCommandUninstall {
+		ret.DownloadSize = images.downloadSize()
+		for _, action := range ret.Actions {
+			ret.DiskSpace += action.DiskSpace
+		}
+	}
+	return ret, nil
+}
+
+// ApplyPlan runs the command from a plan after checking that the plan was created for the active
+// context and still matches what the command will do
+func (p *PackageManager) ApplyPlan(plan Plan) error {
+	if plan.Version != PlanVersion {
+		return NewPlanVersionError(plan.Version)
+	}
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	activeContextName, _ := p.CurrentContext()
+	if plan.Context != activeContextName {
+		return NewPlanContextMismatchError(plan.Context, activeContextName)
+	}
+	currentPlan, err := p.Plan(plan.Command, plan.Request)
+	if err != nil {
+		return err
+	}
+	if err := plan.matches(currentPlan); err != nil {
+		return err
+	}
+	switch plan.Command {
+	case PlanCommandInstall:
+		p.config.BindOverrides = plan.Request.Binds
+		p.config.EnvOverrides = plan.Request.Env
+		p.config.ConfigProfile = plan.Request.ConfigProfile
+		if plan.Request.Path != "" {
+			return p.InstallLocal(plan.Request.Path, plan.Request.Instance)
+		}
+		return p.installPackages(
+			p.availablePackagesWithLocal(),
+			plan.Request.Instance,
+			plan.Request.Packages...,
+		)
+	case PlanCommandUpgrade:
+		return p.Upgrade(plan.Request.Packages...)
+	case PlanCommandUninstall:
+		// Dependent packages are uninstalled first, as listed in the plan
+		pkgNames := make([]string, 0, len(plan.Actions))
+		for _, action := range plan.Actions {
+			pkgNames = append(pkgNames, fmt.Sprintf("%s = %s", action.Package, action.Version))
+		}
+		return p.Uninstall(pkgNames, plan.Request.KeepData, plan.Request.KeepImages, false)
+	}
+	return NewPlanCommandUnknownError(plan.Command)
+}
+
+// matches checks that the actions of a plan match the actions of a newly created plan for the same
+// command. Image presence, download sizes, and host ports aren't compared, since they don't change
+// what the command will do
+func (p Plan) matches(current Plan) error {
+	if len(p.Actions) != len(current.Actions) {
+		return NewPlanOutdatedError(
+			fmt.Sprintf(
+				"expected %d package change(s), now %d",
+				len(p.Actions),
+				len(current.Actions),
+			),
+		)
+	}
+	for idx, action := range p.Actions {
+		currentAction := current.Actions[idx]
+		if action.Action != currentAction.Action || action.Package != currentAction.Package ||
+			action.Version != currentAction.Version ||
+			action.InstalledVersion != currentAction.InstalledVersion {
+			return NewPlanOutdatedError(
+				fmt.Sprintf(
+					"expected %s, now %s",
+					action.String(),
+					currentAction.String(),
+				),
+			)
+		}
+		if len(action.Images) != len(currentAction.Images) {
+			return NewPlanOutdatedError(
+				fmt.Sprintf("images for package %s have changed", action.Package),
+			)
+		}
+		for imageIdx, image := range action.Images {
+			if image.Image != currentAction.Images[imageIdx].Image {
+				return NewPlanOutdatedError(
+					fmt.Sprintf(
+						"expected image %s for package %s, now %s",
+						image.Image,
+						action.Package,
+						currentAction.Images[imageIdx].Image,
+					),
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// String returns a short description of the action, such as "upgrade cardano-node (8.7.3 =>
+// 8.9.0)"
+func (a PlanAction) String() string {
+	if a.InstalledVersion != "" {
+		return fmt.Sprintf(
+			"%s %s (%s => %s)",
+			a.Action,
+			a.Package,
+			a.InstalledVersion,
+			a.Version,
+		)
+	}
+	return fmt.Sprintf("%s %s (= %s)", a.Action, a.Package, a.Version)
+}
+
+func (p *PackageManager) planInstall(req PlanRequest, images *planImages) ([]PlanAction, error) {
+	for _, bind := range req.Binds {
+		if err := validateBindOverride(bind); err != nil {
+			return nil, err
+		}
+	}
+	for _, env := range req.Env {
+		if err := validateEnvOverride(env); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateConfigProfile(req.ConfigProfile); err != nil {
+		return nil, err
+	}
+	availablePkgs := p.availablePackagesWithLocal()
+	pkgs := req.Packages
+	if req.Path != "" {
+		var pkgName string
+		var err error
+		availablePkgs, pkgName, err = p.localInstallPackages(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = []string{pkgName}
+	}
+	installPkgs, err := p.resolveInstall(availablePkgs, req.Instance, pkgs...)
+	if err != nil {
+		return nil, err
+	}
+	return p.planInstallSets(installPkgs, req.Binds, images)
+}
+
+// planInstallSets returns the actions for installing the resolved packages in the active context.
+// The bind overrides only apply to the requested packages
+func (p *PackageManager) planInstallSets(
+	installPkgs []ResolverInstallSet,
+	binds []string,
+	images *planImages,
+) ([]PlanAction, error) {
+	activeContextName, _ := p.CurrentContext()
+	// Use a copy of the port registry so that no ports are actually allocated
+	ports := p.state.Ports.clone()
+	ret := make([]PlanAction, 0, len(installPkgs))
+	for _, installPkg := range installPkgs {
+		pkgOpts, err := installPkg.Install.resolveOpts(installPkg.Options)
+		if err != nil {
+			return nil, err
+		}
+		var pkgBinds []string
+		if installPkg.Selected {
+			pkgBinds = binds
+		}
+		action := PlanAction{
+			Action:     PlanActionInstall,
+			Package:    installPkg.Install.instanceName(),
+			Version:    installPkg.Install.Version,
+			Dependency: !installPkg.Selected,
+		}
+		if err := p.planContainers(
+			&action,
+			installPkg.Install,
+			activeContextName,
+			pkgOpts,
+			pkgBinds,
+			ports,
+			images,
+		); err != nil {
+			return nil, err
+		}
+		ret = append(ret, action)
+	}
+	return ret, nil
+}
+
+func (p *PackageManager) planUpgrade(req PlanRequest, images *planImages) ([]PlanAction, error) {
+	activeContextName, _ := p.CurrentContext()
+	resolver, err := NewResolver(
+		p.InstalledPackages(),
+		p.availablePackagesWithLocal(),
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	upgradePkgs, err := resolver.Upgrade(req.Packages...)
+	if err != nil {
+		return nil, err
+	}
+	// Use a copy of the port registry so that no ports are actually allocated
+	ports := p.state.Ports.clone()
+	ret := make([]PlanAction, 0, len(upgradePkgs))
+	for _, upgradePkg := range upgradePkgs {
+		action := PlanAction{
+			Action:  PlanActionInstall,
+			Package: upgradePkg.Upgrade.instanceName(),
+			Version: upgradePkg.Upgrade.Version,
+		}
+		if upgradePkg.Installed.IsEmpty() {
+			action.Dependency = true
+		} else {
+			action.Action = PlanActionUpgrade
+			action.InstalledVersion = upgradePkg.Installed.Package.Version
+			if versionNewer(action.InstalledVersion, action.Version) {
+				action.Action = PlanActionDowngrade
+			}
+			// The new version of a stateful package is installed alongside the old one, so it
+			// gets different host ports
+			if p.useBlueGreenUpgrade(upgradePkg, p.config) {
+				owner := portOwner(upgradePkg.Upgrade, activeContextName)
+				ports.move(owner, owner+upgradeOldPortsOwnerSuffix)
+			}
+		}
+		if err := p.planContainers(
+			&action,
+			upgradePkg.Upgrade,
+			activeContextName,
+			upgradePkg.Installed.Options,
+			upgradePkg.Installed.Binds,
+			ports,
+			images,
+		); err != nil {
+			return nil, err
+		}
+		ret = append(ret, action)
+	}
+	return ret, nil
+}
+
+func (p *PackageManager) planUninstall(req PlanRequest, images *planImages) ([]PlanAction, error) {
+	uninstallPlan, err := p.UninstallPlan(
+		req.Packages,
+		req.KeepData,
+		req.KeepImages,
+		req.Cascade,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(uninstallPlan.Broken) > 0 {
+		var brokenPkgs []string
+		for _, pkg := range uninstallPlan.Broken {
+			brokenPkgs = append(brokenPkgs, pkg.InstanceName())
+		}
+		return nil, NewPlanUninstallBreaksError(brokenPkgs)
+	}
+	ret := make([]PlanAction, 0, len(uninstallPlan.Packages))
+	for _, pkg := range uninstallPlan.Packages {
+		action := PlanAction{
+			Action:     PlanActionUninstall,
+			Package:    pkg.Package.InstanceName(),
+			Version:    pkg.Package.Package.Version,
+			Dependency: pkg.Dependent,
+		}
+		for _, imageName := range pkg.Images {
+			action.Images = append(
+				action.Images,
+				PlanImage{
+					Image:   imageName,
+					Present: images.present(imageName),
+				},
+			)
+		}
+		ret = append(ret, action)
+	}
+	return ret, nil
+}
+
+// planContainers renders the containers that installing a package will create, and adds their
+// images and ports, along with the disk space that the package requires, to the action. Host ports
+// are allocated from the provided port registry
+func (p *PackageManager) planContainers(
+	action *PlanAction,
+	pkg Package,
+	context string,
+	opts map[string]any,
+	binds []string,
+	ports PortRegistry,
+	images *planImages,
+) error {
+	diskSpace, err := pkg.minDiskSpace()
+	if err != nil {
+		return err
+	}
+	action.DiskSpace = diskSpace
+	// Env overrides don't change the images or ports of the containers
+	cfg, err := p.installConfig(pkg, context, binds, nil)
+	if err != nil {
+		return err
+	}
+	owner := portOwner(pkg, context)
+	cfg.Template = cfg.Template.WithVars(
+		pkg.templateVars(cfg, context, opts),
+	).WithFuncs(
+		template.FuncMap{
+			"freePort": func(port int) (int, error) {
+				return ports.allocate(owner, port, isLocalDockerHost(cfg.DockerHost))
+			},
+		},
+	)
+	pkgName := fmt.Sprintf("%s-%s-%s", pkg.instanceName(), pkg.Version, context)
+	var svcs []*DockerService
+	for _, installStep := range pkg.InstallSteps {
+		if installStep.Condition != "" {
+			ok, err := cfg.Template.EvaluateCondition(installStep.Condition, nil)
+			if err != nil {
+				return NewInstallStepConditionError(installStep.Condition, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		var dockerSteps []*PackageInstallStepDocker
+		if installStep.Docker != nil {
+			dockerSteps = append(dockerSteps, installStep.Docker)
+		}
+		if installStep.Compose != nil {
+			composeSteps, err := installStep.Compose.dockerSteps(cfg, pkgName)
+			if err != nil {
+				return err
+			}
+			dockerSteps = append(dockerSteps, composeSteps...)
+		}
+		for _, dockerStep := range dockerSteps {
+			svc, err := dockerStep.render(cfg, pkgName)
+			if err != nil {
+				return err
+			}
+			svcs = append(svcs, svc)
+		}
+	}
+	for _, svc := range svcs {
+		action.Images = append(action.Images, images.image(svc.Image, svc.Platform))
+		action.Ports = append(action.Ports, svc.Ports...)
+	}
+	return nil
+}
+
+// planImages looks up and caches whether images are present on the Docker host and their download
+// sizes
+type planImages struct {
+	cfg      Config
+	images   map[string]PlanImage
+	platform *ocispec.Platform
+}
+
+func newPlanImages(cfg Config) *planImages {
+	return &planImages{
+		cfg:    cfg,
+		images: make(map[string]PlanImage),
+	}
+}
+
+// image returns the details for an image, looking up its download size for the platform, or the
+// platform of the Docker host, if it isn't present
+func (i *planImages) image(imageName string, platform string) PlanImage {
+	if ret, ok := i.images[imageName]; ok {
+		return ret
+	}
+	ret := PlanImage{
+		Image:   imageName,
+		Present: i.present(imageName),
+	}
+	if !ret.Present {
+		size, err := i.downloadSizeForPlatform(imageName, platform)
+		if err != nil {
+			i.cfg.Logger.Debug(
+				fmt.Sprintf("failed to get download size for image %s: %s", imageName, err),
+			)
+		}
+		ret.DownloadSize = size
+	}
+	i.images[imageName] = ret
+	return ret
+}
+
+// present returns whether an image is present on the Docker host. Failures to reach the Docker
+// host are treated as the image not being present
+func (i *planImages) present(imageName string) bool {
+	client, err := NewDockerClientForHost(i.cfg.DockerHost)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	_, _, err = client.ImageInspectWithRaw(i.cfg.ctx(), imageName)
+	return err == nil
+}
+
+func (i *planImages) downloadSizeForPlatform(imageName string, platform string) (uint64, error) {
+	targetPlatform, err := parsePlatform(platform)
+	if err != nil {
+		return 0, err
+	}
+	if targetPlatform == nil {
+		targetPlatform = i.hostPlatform()
+	}
+	return imageDownloadSize(i.cfg, imageName, *targetPlatform)
+}
+
+// hostPlatform returns the platform of the Docker host, or Linux on the local architecture if the
+// Docker host can't be reached
+func (i *planImages) hostPlatform() *ocispec.Platform {
+	if i.platform != nil {
+		return i.platform
+	}
+	i.platform = &ocispec.Platform{
+		OS:           "linux",
+		Architecture: runtime.GOARCH,
+	}
+	client, err := NewDockerClientForHost(i.cfg.DockerHost)
+	if err != nil {
+		return i.platform
+	}
+	defer client.Close()
+	version, err := client.ServerVersion(i.cfg.ctx())
+	if err != nil {
+		i.cfg.Logger.Debug(fmt.Sprintf("failed to get Docker server version: %s", err))
+		return i.platform
+	}
+	i.platform = &ocispec.Platform{
+		OS:           version.Os,
+		Architecture: version.Arch,
+	}
+	return i.platform
+}
+
+// downloadSize returns the total download size of the images that aren't present
+func (i *planImages) downloadSize() uint64 {
+	var ret uint64
+	for _, image := range i.images {
+		ret += image.DownloadSize
+	}
+	return ret
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	server := newTestRegistry(t)
+	registryHost := strings.TrimPrefix(server.URL, "http://")
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		// Use a Docker host that can't be reached, so that no images are present
+		DockerHost: "unix://" + filepath.Join(tmpDir, "docker.sock"),
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:   NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, activeContext := pm.ActiveContext()
+	activeContext.Network = "preview"
+	pm.state.Contexts[activeContextName] = activeContext
+	nodePkg := func(version string) Package {
+		return Package{
+			Name:    "node",
+			Version: version,
+			InstallSteps: []PackageInstallStep{
+				{
+					Docker: &PackageInstallStepDocker{
+						ContainerName: "node",
+						Image:         registryHost + "/example/node:{{ .Package.Version }}",
+						Platform:      "linux/amd64",
+						Ports:         []string{"{{ freePort 39001 }}:3001"},
+					},
+				},
+			},
+		}
+	}
+	pm.availablePackages = []Package{
+		nodePkg("1.0.0"),
+		{
+			Name:         "ogmios",
+			Version:      "1.0.0",
+			Dependencies: []PackageDependency{{Name: "node"}},
+			MinDiskSpace: "1g",
+		},
+	}
+	// Installing a package also installs its dependencies
+	plan, err := pm.Plan(PlanCommandInstall, PlanRequest{Packages: []string{"ogmios"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if plan.Version != PlanVersion || plan.Context != activeContextName ||
+		len(plan.Actions) != 2 {
+		t.Fatalf("did not get expected plan: %#v", plan)
+	}
+	nodeAction := plan.Actions[0]
+	if nodeAction.String() != "install node (= 1.0.0)" || !nodeAction.Dependency ||
+		plan.Actions[1].String() != "install ogmios (= 1.0.0)" || plan.Actions[1].Dependency {
+		t.Fatalf("did not get expected actions: %#v", plan.Actions)
+	}
+	expectedImages := []PlanImage{
+		{
+			Image:        registryHost + "/example/node:1.0.0",
+			DownloadSize: 3100,
+		},
+	}
+	if !reflect.DeepEqual(nodeAction.Images, expectedImages) ||
+		len(nodeAction.Ports) != 1 || !strings.HasSuffix(nodeAction.Ports[0], ":3001") {
+		t.Fatalf("did not get expected images and ports: %#v", nodeAction)
+	}
+	if plan.DownloadSize != 3100 || plan.DiskSpace != 1024*1024*1024 {
+		t.Fatalf(
+			"did not get expected download size and disk space: %d, %d",
+			plan.DownloadSize,
+			plan.DiskSpace,
+		)
+	}
+	// No host ports are allocated
+	if len(pm.state.Ports) > 0 {
+		t.Fatalf("did not expect ports to be allocated: %#v", pm.state.Ports)
+	}
+	// Upgrades list the installed version
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       nodePkg("0.9.0"),
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	plan, err = pm.Plan(PlanCommandUpgrade, PlanRequest{Packages: []string{"node"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].String() != "upgrade node (0.9.0 => 1.0.0)" {
+		t.Fatalf("did not get expected actions: %#v", plan.Actions)
+	}
+	// Uninstalls list the images to remove
+	plan, err = pm.Plan(PlanCommandUninstall, PlanRequest{Packages: []string{"node"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].String() != "uninstall node (= 0.9.0)" ||
+		len(plan.Actions[0].Images) != 1 || plan.DownloadSize != 0 {
+		t.Fatalf("did not get expected plan: %#v", plan)
+	}
+	if _, err := pm.Plan("reinstall", PlanRequest{}); err == nil {
+		t.Fatalf("did not get expected error for unknown command")
+	}
+}
+
+func TestApplyPlanChecks(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	plan, err := pm.Plan(PlanCommandUninstall, PlanRequest{Packages: []string{"node"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testDefs := []struct {
+		modify        func(*Plan)
+		expectedError string
+	}{
+		{
+			modify:        func(p *Plan) { p.Version = PlanVersion + 1 },
+			expectedError: "unsupported plan version",
+		},
+		{
+			modify:        func(p *Plan) { p.Context = "other" },
+			expectedError: `plan was created for context "other"`,
+		},
+		{
+			modify:        func(p *Plan) { p.Actions[0].Version = "0.9.0" },
+			expectedError: "plan no longer matches",
+		},
+		{
+			modify:        func(p *Plan) { p.Actions = append(p.Actions, p.Actions[0]) },
+			expectedError: "plan no longer matches",
+		},
+	}
+	for _, testDef := range testDefs {
+		tmpPlan := plan
+		tmpPlan.Actions = append([]PlanAction{}, plan.Actions...)
+		testDef.modify(&tmpPlan)
+		err := pm.ApplyPlan(tmpPlan)
+		if err == nil || !strings.Contains(err.Error(), testDef.expectedError) {
+			t.Fatalf("did not get expected error: got %v, expected %q", err, testDef.expectedError)
+		}
+	}
+	if len(pm.InstalledPackages()) != 1 {
+		t.Fatalf("did not expect package to be uninstalled")
+	}
+}
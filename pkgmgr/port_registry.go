@@ -0,0 +1,136 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	maxPort = 65535
+)
+
+// PortRegistry tracks host ports that have been allocated to installed packages. The outer
+// map is keyed on the owner (context and package instance name) and the inner map maps the requested
+// port to the allocated host port
+type PortRegistry map[string]map[int]int
+
+// Allocate returns a host port for the given owner and requested port. An existing allocation
+// is returned as-is. Otherwise, the first port at or above the requested port that is not
+// allocated to another owner and is not currently bound on the host is recorded and returned
+func (r PortRegistry) Allocate(owner string, port int) (int, error) {
+	return r.allocate(owner, port, true)
+}
+
+// allocate is like Allocate, but only skips ports bound on the local host with probeHost. Ports
+// can't be probed for a remote Docker host, where they're published instead
+func (r PortRegistry) allocate(owner string, port int, probeHost bool) (int, error) {
+	if port <= 0 || port > maxPort {
+		return 0, NewInvalidPortError(port)
+	}
+	if ownerPorts, ok := r[owner]; ok {
+		if hostPort, ok := ownerPorts[port]; ok {
+			return hostPort, nil
+		}
+	}
+	for hostPort := port; hostPort <= maxPort; hostPort++ {
+		if r.isAllocated(hostPort) {
+			continue
+		}
+		if probeHost && !hostPortAvailable(hostPort) {
+			continue
+		}
+		if _, ok := r[owner]; !ok {
+			r[owner] = make(map[int]int)
+		}
+		r[owner][port] = hostPort
+		return hostPort, nil
+	}
+	return 0, NewNoFreePortError(port)
+}
+
+// Release removes all port allocations for the given owner
+func (r PortRegistry) Release(owner string) {
+	delete(r, owner)
+}
+
+// move transfers the port allocations for an owner to another owner, replacing any allocations
+// for that owner
+func (r PortRegistry) move(fromOwner string, toOwner string) {
+	ownerPorts, ok := r[fromOwner]
+	delete(r, toOwner)
+	if !ok {
+		return
+	}
+	r[toOwner] = ownerPorts
+	delete(r, fromOwner)
+}
+
+// claim records host ports that are already in use by the given owner, such as those published
+// by an imported container. The map is keyed on the requested port
+func (r PortRegistry) claim(owner string, ports map[int]int) {
+	if len(ports) == 0 {
+		return
+	}
+	if _, ok := r[owner]; !ok {
+		r[owner] = make(map[int]int)
+	}
+	for port, hostPort := range ports {
+		r[owner][port] = hostPort
+	}
+}
+
+func (r PortRegistry) isAllocated(hostPort int) bool {
+	for _, ownerPorts := range r {
+		for _, tmpHostPort := range ownerPorts {
+			if tmpHostPort == hostPort {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validatePortSpec checks a rendered port spec in the Docker -p flag format
+func validatePortSpec(port string) error {
+	if _, _, err := nat.ParsePortSpecs([]string{port}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func hostPortAvailable(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// clone returns a deep copy of the port registry
+func (r PortRegistry) clone() PortRegistry {
+	ret := make(PortRegistry, len(r))
+	for owner, ownerPorts := range r {
+		ret[owner] = make(map[int]int, len(ownerPorts))
+		for port, hostPort := range ownerPorts {
+			ret[owner][port] = hostPort
+		}
+	}
+	return ret
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortRegistryAllocate(t *testing.T) {
+	// Grab a port from the OS and keep it bound so it looks in use
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer l.Close()
+	boundPort := l.Addr().(*net.TCPAddr).Port
+	if boundPort == maxPort {
+		t.Skip("OS assigned the highest port number")
+	}
+	r := PortRegistry{}
+	hostPort, err := r.Allocate("foo-ctxA", boundPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hostPort <= boundPort {
+		t.Fatalf(
+			"expected allocated port above bound port %d, got %d",
+			boundPort,
+			hostPort,
+		)
+	}
+	// Same owner and requested port should give back the same allocation
+	tmpHostPort, err := r.Allocate("foo-ctxA", boundPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tmpHostPort != hostPort {
+		t.Fatalf(
+			"did not get stable allocation: got %d, expected %d",
+			tmpHostPort,
+			hostPort,
+		)
+	}
+	// A different owner should not get a port that's already allocated
+	otherHostPort, err := r.Allocate("foo-ctxB", boundPort)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if otherHostPort == hostPort {
+		t.Fatalf("got duplicate port allocation %d", otherHostPort)
+	}
+	// Released ports should be available again
+	r.Release("foo-ctxA")
+	if r.isAllocated(hostPort) {
+		t.Fatalf("port %d still allocated after release", hostPort)
+	}
+}
+
+func TestPortRegistryAllocateRemote(t *testing.T) {
+	// Ports bound on the local host aren't in use on a remote Docker host
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer l.Close()
+	boundPort := l.Addr().(*net.TCPAddr).Port
+	if boundPort == maxPort {
+		t.Skip("OS assigned the highest port number")
+	}
+	r := PortRegistry{}
+	hostPort, err := r.allocate("foo-ctxA", boundPort, isLocalDockerHost("ssh://user@node"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hostPort != boundPort {
+		t.Fatalf("did not get expected port: got %d, expected %d", hostPort, boundPort)
+	}
+	// Ports allocated to another owner are still skipped
+	otherHostPort, err := r.allocate("foo-ctxB", boundPort, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if otherHostPort != boundPort+1 {
+		t.Fatalf("did not get expected port: got %d, expected %d", otherHostPort, boundPort+1)
+	}
+}
+
+func TestPortRegistryAllocateInvalid(t *testing.T) {
+	r := PortRegistry{}
+	for _, port := range []int{0, -1, maxPort + 1} {
+		if _, err := r.Allocate("foo-ctxA", port); err == nil {
+			t.Fatalf("did not get expected error for port %d", port)
+		}
+	}
+}
+
+func TestValidatePortSpec(t *testing.T) {
+	testDefs := []struct {
+		port    string
+		wantErr bool
+	}{
+		{port: "3000"},
+		{port: "3001:3000"},
+		{port: "3001:3000/udp"},
+		{port: "127.0.0.1:3001:3000"},
+		{port: "3001-3002:3000-3001"},
+		{port: "", wantErr: true},
+		{port: "abc:3000", wantErr: true},
+		{port: "3001:3000:", wantErr: true},
+		{port: "3001:3000/foo", wantErr: true},
+		{port: "1.2.3.4.5:3001:3000", wantErr: true},
+	}
+	for _, testDef := range testDefs {
+		err := validatePortSpec(testDef.port)
+		if testDef.wantErr && err == nil {
+			t.Fatalf("did not get expected error for %q", testDef.port)
+		}
+		if !testDef.wantErr && err != nil {
+			t.Fatalf("unexpected error for %q: %s", testDef.port, err)
+		}
+	}
+}
+
+func TestPortRegistryMove(t *testing.T) {
+	r := PortRegistry{
+		"ctx/foo": {3001: 3001},
+	}
+	r.move("ctx/foo", "ctx/foo#old")
+	if _, ok := r["ctx/foo"]; ok {
+		t.Fatalf("did not expect allocations for the old owner: %v", r)
+	}
+	// Moved allocations are still taken
+	if !r.isAllocated(3001) {
+		t.Fatalf("expected moved port to still be allocated: %v", r)
+	}
+	r.move("ctx/foo#old", "ctx/foo")
+	if r["ctx/foo"][3001] != 3001 || len(r) != 1 {
+		t.Fatalf("did not get expected allocations after moving back: %v", r)
+	}
+}
+
+func TestPortRegistryClaim(t *testing.T) {
+	r := PortRegistry{}
+	r.claim("ctx/foo", map[int]int{3001: 3002})
+	// Claimed ports are returned for the owner and taken for other owners
+	hostPort, err := r.Allocate("ctx/foo", 3001)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if hostPort != 3002 {
+		t.Fatalf("did not get claimed port: got %d, expected 3002", hostPort)
+	}
+	if !r.isAllocated(3002) {
+		t.Fatalf("expected claimed port to be allocated: %v", r)
+	}
+	r.claim("ctx/bar", nil)
+	if _, ok := r["ctx/bar"]; ok {
+		t.Fatalf("did not expect allocations for owner without ports: %v", r)
+	}
+}
+
+func TestPortOwnerUnambiguous(t *testing.T) {
+	pkgA := Package{Name: "cardano-node"}
+	pkgB := Package{Name: "cardano"}
+	if portOwner(pkgA, "x") == portOwner(pkgB, "node-x") {
+		t.Fatalf("got same port owner for different packages and contexts")
+	}
+}
+
+func TestStateMigrateOwnerKeys(t *testing.T) {
+	s := NewState(Config{})
+	s.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{Name: "cardano-node"},
+			Context: "default",
+		},
+	}
+	s.Ports["cardano-node-default"] = map[int]int{3001: 3001}
+	s.Topologies["cardano-node-default"] = Topology{P2P: true}
+	s.migrateOwnerKeys()
+	if _, ok := s.Ports["default/cardano-node"]; !ok {
+		t.Fatalf("port allocations were not migrated: %v", s.Ports)
+	}
+	if _, ok := s.Ports["cardano-node-default"]; ok {
+		t.Fatalf("legacy port allocations were not removed: %v", s.Ports)
+	}
+	if _, ok := s.Topologies["default/cardano-node"]; !ok {
+		t.Fatalf("topology was not migrated: %v", s.Topologies)
+	}
+}
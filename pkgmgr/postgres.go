@@ -0,0 +1,681 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultDatabaseUser is the PostgreSQL user used when a package doesn't declare one
+	defaultDatabaseUser = "postgres"
+
+	// databaseSnapshotsDir is the dir under the context dir where database snapshots are stored
+	databaseSnapshotsDir = "db-snapshots"
+
+	// databaseSnapshotExt is the extension of database snapshot files, which use the custom
+	// pg_dump format
+	databaseSnapshotExt = ".dump"
+
+	// databaseSnapshotMetaExt is the extension of the metadata file stored next to each database
+	// snapshot
+	databaseSnapshotMetaExt = ".yaml"
+
+	// dbSyncTipQuery returns the block number and slot of the newest block in a db-sync database
+	dbSyncTipQuery = "SELECT block_no, slot_no FROM block WHERE block_no IS NOT NULL ORDER BY id DESC LIMIT 1"
+)
+
+// databaseSnapshotNameRe matches valid database snapshot names
+var databaseSnapshotNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// PackageDatabase declares the PostgreSQL database of a package, such as the database used by
+// cardano-db-sync, which allows managing it with cardano-up
+type PackageDatabase struct {
+	// ContainerName is the container running PostgreSQL
+	ContainerName string `yaml:"containerName" jsonschema:"required"`
+	// Name is the name of the database
+	Name string `yaml:"name" jsonschema:"required"`
+	// User is the PostgreSQL user to connect as, which defaults to postgres
+	User string `yaml:"user,omitempty"`
+	// PasswordSecret is the package secret with the password for the user
+	PasswordSecret string `yaml:"passwordSecret,omitempty"`
+	// DbSync marks a database using the cardano-db-sync schema, which allows showing its sync
+	// progress
+	DbSync bool `yaml:"dbSync,omitempty"`
+}
+
+func (p *PackageDatabase) validate(pkg Package) error {
+	if p.ContainerName == "" {
+		return fmt.Errorf("database container name cannot be empty")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("database name cannot be empty")
+	}
+	if !pkg.declaresContainer(p.ContainerName) {
+		return fmt.Errorf(
+			"database container %q does not match any docker install step",
+			p.ContainerName,
+		)
+	}
+	if p.PasswordSecret != "" {
+		secretFound := false
+		for _, secret := range pkg.Secrets {
+			if secret.Name == p.PasswordSecret {
+				secretFound = true
+				break
+			}
+		}
+		if !secretFound {
+			return fmt.Errorf(
+				"database password secret %q is not declared by the package",
+				p.PasswordSecret,
+			)
+		}
+	}
+	return nil
+}
+
+// DatabaseSyncStatus describes how far a db-sync database has synced compared to the node
+type DatabaseSyncStatus struct {
+	Package InstalledPackage
+	// Block and Slot are the block number and slot of the newest block in the database
+	Block uint64
+	Slot  uint64
+	// TipBlock and TipSlot are the block number and slot of the node tip
+	TipBlock uint64
+	TipSlot  uint64
+	// NodeError is the error from querying the node tip, if it failed
+	NodeError error
+}
+
+// Progress returns the sync progress of the database as a percentage of the slot of the node tip
+func (s DatabaseSyncStatus) Progress() float64 {
+	if s.NodeError != nil || s.TipSlot == 0 {
+		return 0
+	}
+	if s.Slot >= s.TipSlot {
+		return 100
+	}
+	return float64(s.Slot) / float64(s.TipSlot) * 100
+}
+
+// BlocksBehind returns the number of blocks that the database is behind the node tip
+func (s DatabaseSyncStatus) BlocksBehind() uint64 {
+	if s.NodeError != nil || s.Block >= s.TipBlock {
+		return 0
+	}
+	return s.TipBlock - s.Block
+}
+
+// DatabaseSnapshot is a snapshot of the database of a package, which can be restored instead of
+// syncing the database from scratch
+type DatabaseSnapshot struct {
+	Name string
+	Path string
+	Size int64
+	// Created is when the snapshot was created
+	Created time.Time
+	// PackageVersion is the version of the package that the snapshot was created with
+	PackageVersion string
+	// Block is the newest block in the database when the snapshot was created, for db-sync
+	// databases
+	Block uint64
+}
+
+// databaseSnapshotMeta is the metadata stored next to a database snapshot
+type databaseSnapshotMeta struct {
+	Created        time.Time `yaml:"created"`
+	PackageVersion string    `yaml:"packageVersion"`
+	Block          uint64    `yaml:"block,omitempty"`
+}
+
+// Psql runs psql with the provided args in the database container of a database package. The
+// user, database and password are provided via the PGUSER, PGDATABASE and PGPASSWORD env vars,
+// so they don't need to be passed as flags. The exit code of psql is returned
+func (p *PackageManager) Psql(pkgName string, args []string, opts CliOptions) (int, error) {
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return 0, err
+	}
+	svc, env, err := p.databaseService(installedPkg)
+	if err != nil {
+		return 0, err
+	}
+	return svc.Exec(
+		append([]string{"psql"}, args...),
+		env,
+		opts.Tty,
+		opts.Stdin,
+		opts.Stdout,
+		opts.Stderr,
+	)
+}
+
+// DatabaseSyncStatus returns the newest block in the database of a db-sync package along with
+// the node tip for its context
+func (p *PackageManager) DatabaseSyncStatus(pkgName string) (DatabaseSyncStatus, error) {
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return DatabaseSyncStatus{}, err
+	}
+	if !installedPkg.Package.Database.DbSync {
+		return DatabaseSyncStatus{}, NewDatabaseNotDbSyncError(installedPkg.InstanceName())
+	}
+	ret := DatabaseSyncStatus{
+		Package: installedPkg,
+	}
+	ret.Block, ret.Slot, err = p.dbSyncTip(installedPkg)
+	if err != nil {
+		return DatabaseSyncStatus{}, err
+	}
+	tip, err := p.nodeTip(installedPkg.Context)
+	switch {
+	case err != nil:
+		ret.NodeError = err
+	case tip.Slot == nil || tip.Block == nil:
+		ret.NodeError = ErrNodeTipNotSynced
+	default:
+		ret.TipSlot = *tip.Slot
+		ret.TipBlock = *tip.Block
+	}
+	return ret, nil
+}
+
+// DatabaseSnapshots returns the snapshots of the database of a database package, oldest first
+func (p *PackageManager) DatabaseSnapshots(pkgName string) ([]DatabaseSnapshot, error) {
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	return listDatabaseSnapshots(p.databaseSnapshotsDir(installedPkg))
+}
+
+// CreateDatabaseSnapshot dumps the database of a database package to a snapshot with pg_dump. A
+// name based on the current time is used if no name is provided
+func (p *PackageManager) CreateDatabaseSnapshot(
+	pkgName string,
+	name string,
+) (DatabaseSnapshot, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	defer unlock()
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	if name == "" {
+		name = time.Now().UTC().Format("20060102-150405")
+	}
+	if err := validateDatabaseSnapshotName(name); err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	snapshotsDir := p.databaseSnapshotsDir(installedPkg)
+	snapshotPath := filepath.Join(snapshotsDir, name+databaseSnapshotExt)
+	if _, err := os.Stat(snapshotPath); err == nil {
+		return DatabaseSnapshot{}, NewDatabaseSnapshotExistsError(name)
+	}
+	svc, env, err := p.databaseService(installedPkg)
+	if err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	meta := databaseSnapshotMeta{
+		Created:        time.Now().UTC(),
+		PackageVersion: installedPkg.Package.Version,
+	}
+	if installedPkg.Package.Database.DbSync {
+		// The block is only informational, so an empty or unreadable database isn't an error
+		if block, _, err := p.dbSyncTip(installedPkg); err == nil {
+			meta.Block = block
+		}
+	}
+	if err := os.MkdirAll(snapshotsDir, fs.ModePerm); err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf(
+			"Creating snapshot %s of database for package %s",
+			name,
+			installedPkg.InstanceName(),
+		),
+	)
+	tmpPath := snapshotPath + ".tmp"
+	if err := dumpDatabase(svc, env, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return DatabaseSnapshot{}, err
+	}
+	if err := os.Rename(tmpPath, snapshotPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return DatabaseSnapshot{}, err
+	}
+	metaContent, err := yaml.Marshal(&meta)
+	if err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	if err := os.WriteFile(
+		filepath.Join(snapshotsDir, name+databaseSnapshotMetaExt),
+		metaContent,
+		0o600,
+	); err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	return readDatabaseSnapshot(snapshotsDir, name)
+}
+
+// RestoreDatabaseSnapshot restores a snapshot into the database of a database package with
+// pg_restore. The other containers for the package are stopped while restoring, so that they
+// don't write to the database. This fails when the snapshot was created with a different package
+// version unless force is set
+func (p *PackageManager) RestoreDatabaseSnapshot(pkgName string, name string, force bool) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return err
+	}
+	snapshot, err := readDatabaseSnapshot(p.databaseSnapshotsDir(installedPkg), name)
+	if err != nil {
+		return err
+	}
+	if snapshot.PackageVersion != "" &&
+		snapshot.PackageVersion != installedPkg.Package.Version {
+		if !force {
+			return NewDatabaseSnapshotVersionError(
+				name,
+				snapshot.PackageVersion,
+				installedPkg.Package.Version,
+			)
+		}
+		p.config.Logger.Warn(
+			fmt.Sprintf(
+				"restoring snapshot created with package version %s into version %s, which may not be able to use it",
+				snapshot.PackageVersion,
+				installedPkg.Package.Version,
+			),
+		)
+	}
+	svc, env, err := p.databaseService(installedPkg)
+	if err != nil {
+		return err
+	}
+	stoppedSvcs, err := p.stopDatabaseClients(installedPkg, svc)
+	// Start any containers that were stopped, including after a failure
+	defer func() {
+		for _, stoppedSvc := range stoppedSvcs {
+			p.config.Logger.Info(
+				fmt.Sprintf("Starting container %s", stoppedSvc.ContainerName),
+			)
+			if err := stoppedSvc.Start(); err != nil {
+				p.config.Logger.Warn(
+					fmt.Sprintf(
+						"failed to start container %s: %s",
+						stoppedSvc.ContainerName,
+						err,
+					),
+				)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf(
+			"Restoring snapshot %s into database for package %s",
+			name,
+			installedPkg.InstanceName(),
+		),
+	)
+	snapshotFile, err := os.Open(snapshot.Path)
+	if err != nil {
+		return err
+	}
+	defer snapshotFile.Close()
+	cmd := []string{
+		"pg_restore",
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--exit-on-error",
+		"--dbname",
+		installedPkg.Package.Database.Name,
+	}
+	var output bytes.Buffer
+	exitCode, err := svc.Exec(cmd, env, false, snapshotFile, &output, &output)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return NewDatabaseCommandError(cmd[0], exitCode, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// DeleteDatabaseSnapshot removes a snapshot of the database of a database package
+func (p *PackageManager) DeleteDatabaseSnapshot(pkgName string, name string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	installedPkg, err := p.databasePackage(pkgName)
+	if err != nil {
+		return err
+	}
+	snapshotsDir := p.databaseSnapshotsDir(installedPkg)
+	if _, err := readDatabaseSnapshot(snapshotsDir, name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(snapshotsDir, name+databaseSnapshotExt)); err != nil {
+		return err
+	}
+	if err := os.Remove(
+		filepath.Join(snapshotsDir, name+databaseSnapshotMetaExt),
+	); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// databasePackage returns the installed package with the provided name in the active context,
+// which must declare a database, or the only installed database package if no name is provided
+func (p *PackageManager) databasePackage(pkgName string) (InstalledPackage, error) {
+	activeContextName, _ := p.CurrentContext()
+	var databasePkgs []InstalledPackage
+	for _, installedPkg := range p.InstalledPackages() {
+		if pkgName != "" && installedPkg.InstanceName() == pkgName {
+			if installedPkg.Package.Database == nil {
+				return InstalledPackage{}, NewPackageNotDatabaseError(pkgName)
+			}
+			return installedPkg, nil
+		}
+		if installedPkg.Package.Database != nil {
+			databasePkgs = append(databasePkgs, installedPkg)
+		}
+	}
+	if pkgName != "" {
+		return InstalledPackage{}, NewPackageNotInstalledError(
+			pkgName,
+			activeContextName,
+		)
+	}
+	if len(databasePkgs) == 0 {
+		return InstalledPackage{}, ErrNoDatabasePackages
+	}
+	if len(databasePkgs) > 1 {
+		var pkgNames []string
+		for _, databasePkg := range databasePkgs {
+			pkgNames = append(pkgNames, databasePkg.InstanceName())
+		}
+		return InstalledPackage{}, NewDatabasePackageAmbiguousError(pkgNames)
+	}
+	return databasePkgs[0], nil
+}
+
+// databaseService returns the running database container for a database package, along with the
+// env vars used to connect to the database
+func (p *PackageManager) databaseService(
+	installedPkg InstalledPackage,
+) (*DockerService, []string, error) {
+	database := installedPkg.Package.Database
+	svc, err := p.packageService(installedPkg.InstanceName(), database.ContainerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !running {
+		return nil, nil, NewContainerNotRunningError(svc.ContainerName)
+	}
+	user := database.User
+	if user == "" {
+		user = defaultDatabaseUser
+	}
+	env := []string{
+		"PGUSER=" + user,
+		"PGDATABASE=" + database.Name,
+	}
+	if database.PasswordSecret != "" {
+		secrets, err := packageSecrets(p.config, installedPkg.Package)
+		if err != nil {
+			return nil, nil, err
+		}
+		if password, ok := secrets[database.PasswordSecret]; ok {
+			env = append(env, "PGPASSWORD="+password)
+		}
+	}
+	return svc, env, nil
+}
+
+// dbSyncTip returns the block number and slot of the newest block in the database of a db-sync
+// package
+func (p *PackageManager) dbSyncTip(installedPkg InstalledPackage) (uint64, uint64, error) {
+	svc, env, err := p.databaseService(installedPkg)
+	if err != nil {
+		return 0, 0, err
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode, err := svc.Exec(
+		[]string{"psql", "--no-align", "--tuples-only", "--command", dbSyncTipQuery},
+		env,
+		false,
+		nil,
+		&stdout,
+		&stderr,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	if exitCode != 0 {
+		return 0, 0, NewDatabaseCommandError(
+			"psql",
+			exitCode,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	return parseDbSyncTip(stdout.String())
+}
+
+// parseDbSyncTip parses the output of dbSyncTipQuery from psql in unaligned mode. An empty
+// database has no output
+func parseDbSyncTip(output string) (uint64, uint64, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return 0, 0, nil
+	}
+	block, slot, ok := strings.Cut(output, "|")
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected database tip: %s", output)
+	}
+	blockNo, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected database tip block: %s", block)
+	}
+	slotNo, err := strconv.ParseUint(slot, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected database tip slot: %s", slot)
+	}
+	return blockNo, slotNo, nil
+}
+
+// stopDatabaseClients stops the running containers for a database package other than the
+// database container, and returns the containers that were stopped
+func (p *PackageManager) stopDatabaseClients(
+	installedPkg InstalledPackage,
+	databaseSvc *DockerService,
+) ([]*DockerService, error) {
+	services, err := installedPkg.Package.services(p.config, installedPkg.Context)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*DockerService
+	for _, svc := range services {
+		if svc.ContainerName == databaseSvc.ContainerName {
+			continue
+		}
+		running, err := svc.Running()
+		if err != nil {
+			return ret, err
+		}
+		if !running {
+			continue
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf("Stopping container %s", svc.ContainerName),
+		)
+		applyStopTimeoutDefault(p.config, svc)
+		if err := svc.Stop(); err != nil {
+			return ret, err
+		}
+		ret = append(ret, svc)
+	}
+	return ret, nil
+}
+
+// databaseSnapshotsDir returns the dir where snapshots of the database of a package are stored
+func (p *PackageManager) databaseSnapshotsDir(installedPkg InstalledPackage) string {
+	return filepath.Join(
+		p.config.DataDir,
+		installedPkg.Context,
+		databaseSnapshotsDir,
+		installedPkg.InstanceName(),
+	)
+}
+
+// dumpDatabase writes a dump of the database in the custom pg_dump format to the provided path
+func dumpDatabase(svc *DockerService, env []string, path string) (retErr error) {
+	dumpFile, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = errors.Join(retErr, dumpFile.Close())
+	}()
+	var stderr bytes.Buffer
+	exitCode, err := svc.Exec(
+		[]string{"pg_dump", "--format", "custom"},
+		env,
+		false,
+		nil,
+		dumpFile,
+		&stderr,
+	)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return NewDatabaseCommandError("pg_dump", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func validateDatabaseSnapshotName(name string) error {
+	if !databaseSnapshotNameRe.MatchString(name) {
+		return NewInvalidDatabaseSnapshotNameError(name)
+	}
+	return nil
+}
+
+// readDatabaseSnapshot returns the snapshot with the provided name from the snapshots dir.
+// Snapshots without metadata use the modification time of the snapshot file
+func readDatabaseSnapshot(snapshotsDir string, name string) (DatabaseSnapshot, error) {
+	if err := validateDatabaseSnapshotName(name); err != nil {
+		return DatabaseSnapshot{}, err
+	}
+	snapshotPath := filepath.Join(snapshotsDir, name+databaseSnapshotExt)
+	info, err := os.Stat(snapshotPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return DatabaseSnapshot{}, NewDatabaseSnapshotNotFoundError(name)
+		}
+		return DatabaseSnapshot{}, err
+	}
+	ret := DatabaseSnapshot{
+		Name:    name,
+		Path:    snapshotPath,
+		Size:    info.Size(),
+		Created: info.ModTime(),
+	}
+	metaContent, err := os.ReadFile(filepath.Join(snapshotsDir, name+databaseSnapshotMetaExt))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ret, nil
+		}
+		return DatabaseSnapshot{}, err
+	}
+	var meta databaseSnapshotMeta
+	if err := yaml.Unmarshal(metaContent, &meta); err != nil {
+		return DatabaseSnapshot{}, fmt.Errorf(
+			"failed to parse metadata for snapshot %s: %w",
+			name,
+			err,
+		)
+	}
+	if !meta.Created.IsZero() {
+		ret.Created = meta.Created
+	}
+	ret.PackageVersion = meta.PackageVersion
+	ret.Block = meta.Block
+	return ret, nil
+}
+
+// listDatabaseSnapshots returns the snapshots in the snapshots dir, oldest first. A missing dir
+// has no snapshots
+func listDatabaseSnapshots(snapshotsDir string) ([]DatabaseSnapshot, error) {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ret []DatabaseSnapshot
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), databaseSnapshotExt)
+		if !ok || entry.IsDir() || validateDatabaseSnapshotName(name) != nil {
+			continue
+		}
+		snapshot, err := readDatabaseSnapshot(snapshotsDir, name)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, snapshot)
+	}
+	sort.Slice(
+		ret,
+		func(i, j int) bool {
+			return ret[i].Created.Before(ret[j].Created)
+		},
+	)
+	return ret, nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackageDatabaseValidate(t *testing.T) {
+	pkg := Package{
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "postgres",
+					Image:         "postgres:17.2",
+				},
+			},
+		},
+		Secrets: []PackageSecret{
+			{Name: "postgres-password"},
+		},
+	}
+	testDefs := []struct {
+		database PackageDatabase
+		valid    bool
+	}{
+		{
+			database: PackageDatabase{ContainerName: "postgres", Name: "dbsync"},
+			valid:    true,
+		},
+		{
+			database: PackageDatabase{
+				ContainerName:  "postgres",
+				Name:           "dbsync",
+				PasswordSecret: "postgres-password",
+				DbSync:         true,
+			},
+			valid: true,
+		},
+		{
+			database: PackageDatabase{Name: "dbsync"},
+		},
+		{
+			database: PackageDatabase{ContainerName: "postgres"},
+		},
+		{
+			database: PackageDatabase{ContainerName: "missing", Name: "dbsync"},
+		},
+		{
+			database: PackageDatabase{
+				ContainerName:  "postgres",
+				Name:           "dbsync",
+				PasswordSecret: "missing",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.database.validate(pkg)
+		if testDef.valid && err != nil {
+			t.Fatalf("unexpected error for %+v: %s", testDef.database, err)
+		}
+		if !testDef.valid && err == nil {
+			t.Fatalf("did not get expected error for %+v", testDef.database)
+		}
+	}
+}
+
+func TestParseDbSyncTip(t *testing.T) {
+	testDefs := []struct {
+		output        string
+		expectedBlock uint64
+		expectedSlot  uint64
+		error         bool
+	}{
+		{output: "11094318|141786443\n", expectedBlock: 11094318, expectedSlot: 141786443},
+		{output: ""},
+		{output: "11094318", error: true},
+		{output: "abc|141786443", error: true},
+		{output: "11094318|", error: true},
+	}
+	for _, testDef := range testDefs {
+		block, slot, err := parseDbSyncTip(testDef.output)
+		if testDef.error {
+			if err == nil {
+				t.Fatalf("did not get expected error for output %q", testDef.output)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if block != testDef.expectedBlock || slot != testDef.expectedSlot {
+			t.Fatalf(
+				"did not get expected tip for output %q: got %d/%d, expected %d/%d",
+				testDef.output,
+				block,
+				slot,
+				testDef.expectedBlock,
+				testDef.expectedSlot,
+			)
+		}
+	}
+}
+
+func TestDatabaseSyncStatusProgress(t *testing.T) {
+	testDefs := []struct {
+		status           DatabaseSyncStatus
+		expectedProgress float64
+		expectedBehind   uint64
+	}{
+		{
+			status: DatabaseSyncStatus{
+				Block:    500,
+				Slot:     2500,
+				TipBlock: 1000,
+				TipSlot:  10000,
+			},
+			expectedProgress: 25,
+			expectedBehind:   500,
+		},
+		{
+			status: DatabaseSyncStatus{
+				Block:    1001,
+				Slot:     10020,
+				TipBlock: 1000,
+				TipSlot:  10000,
+			},
+			expectedProgress: 100,
+		},
+		{
+			status: DatabaseSyncStatus{
+				Block:     500,
+				Slot:      2500,
+				NodeError: ErrNodeTipNotSynced,
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		if progress := testDef.status.Progress(); progress != testDef.expectedProgress {
+			t.Fatalf(
+				"did not get expected progress: got %f, expected %f",
+				progress,
+				testDef.expectedProgress,
+			)
+		}
+		if behind := testDef.status.BlocksBehind(); behind != testDef.expectedBehind {
+			t.Fatalf(
+				"did not get expected blocks behind: got %d, expected %d",
+				behind,
+				testDef.expectedBehind,
+			)
+		}
+	}
+}
+
+func TestValidateDatabaseSnapshotName(t *testing.T) {
+	testDefs := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "20241215-103000", valid: true},
+		{name: "epoch-520.pre_upgrade", valid: true},
+		{name: ""},
+		{name: ".hidden"},
+		{name: "../escape"},
+		{name: "with space"},
+	}
+	for _, testDef := range testDefs {
+		err := validateDatabaseSnapshotName(testDef.name)
+		if testDef.valid && err != nil {
+			t.Fatalf("unexpected error for name %q: %s", testDef.name, err)
+		}
+		if !testDef.valid && err == nil {
+			t.Fatalf("did not get expected error for name %q", testDef.name)
+		}
+	}
+}
+
+func TestListDatabaseSnapshots(t *testing.T) {
+	snapshotsDir := t.TempDir()
+	snapshots, err := listDatabaseSnapshots(filepath.Join(snapshotsDir, "missing"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(snapshots) != 0 {
+		t.Fatalf("did not get expected empty snapshot list: %+v", snapshots)
+	}
+	files := map[string]string{
+		"newer.dump":       "newer",
+		"newer.yaml":       "created: 2024-12-15T10:30:00Z\npackageVersion: 13.6.0.4\nblock: 11094318\n",
+		"older.dump":       "older",
+		"older.yaml":       "created: 2024-11-01T08:00:00Z\npackageVersion: 13.5.0.2\n",
+		"partial.dump.tmp": "partial",
+	}
+	for filename, content := range files {
+		if err := os.WriteFile(
+			filepath.Join(snapshotsDir, filename),
+			[]byte(content),
+			0o600,
+		); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	snapshots, err = listDatabaseSnapshots(snapshotsDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("did not get expected snapshots: %+v", snapshots)
+	}
+	if snapshots[0].Name != "older" || snapshots[1].Name != "newer" {
+		t.Fatalf(
+			"did not get expected snapshot order: %s, %s",
+			snapshots[0].Name,
+			snapshots[1].Name,
+		)
+	}
+	newer := snapshots[1]
+	if newer.PackageVersion != "13.6.0.4" || newer.Block != 11094318 || newer.Size != 5 ||
+		!newer.Created.Equal(time.Date(2024, 12, 15, 10, 30, 0, 0, time.UTC)) {
+		t.Fatalf("did not get expected snapshot: %+v", newer)
+	}
+	if _, err := readDatabaseSnapshot(snapshotsDir, "missing"); err == nil {
+		t.Fatalf("did not get expected error for missing snapshot")
+	}
+	if _, err := readDatabaseSnapshot(snapshotsDir, "../older"); err == nil {
+		t.Fatalf("did not get expected error for invalid snapshot name")
+	}
+}
@@ -17,6 +17,7 @@ package pkgmgr
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -24,13 +25,80 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
+const (
+	// registryCacheMaxAge is how long the registry cache is used before it's refreshed
+	registryCacheMaxAge = 24 * time.Hour
+
+	// registryRefreshInterval is how long to wait before starting another background refresh of
+	// the stale registry cache
+	registryRefreshInterval = 5 * time.Minute
+
+	// registryRefreshMarker is the file in the cache dir that records when a background refresh
+	// of the registry cache was last started
+	registryRefreshMarker = "registry-refresh"
+
+	// registryCacheMetadataFile is the file in the cache dir with the metadata for the fetched
+	// registry, which is used for conditional requests
+	registryCacheMetadataFile = "registry.json"
+
+	// registryCacheLockFile is the file in the cache dir that's locked while the registry cache is
+	// read or replaced
+	registryCacheLockFile = "registry.lock"
+
+	// registrySnapshotDirname is the dir in the cache dir with the registry as of the last update
+	// command, which is kept when the registry is fetched by anything else so that the next update
+	// command can show the changes since then
+	registrySnapshotDirname = "registry-previous"
+)
+
+// registryCacheMetadata holds the validators from the response for the fetched registry, which
+// allow skipping the download when the registry hasn't changed
+type registryCacheMetadata struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// loadRegistryCacheMetadata returns the metadata for the fetched registry, if it exists and
+// matches the configured registry URL
+func loadRegistryCacheMetadata(cfg Config) *registryCacheMetadata {
+	data, err := os.ReadFile(filepath.Join(cfg.CacheDir, registryCacheMetadataFile))
+	if err != nil {
+		return nil
+	}
+	var ret registryCacheMetadata
+	if err := json.Unmarshal(data, &ret); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to load registry cache metadata: %s", err),
+		)
+		return nil
+	}
+	if ret.Url != cfg.RegistryUrl {
+		return nil
+	}
+	return &ret
+}
+
+func saveRegistryCacheMetadata(cfg Config, metadata registryCacheMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(
+		filepath.Join(cfg.CacheDir, registryCacheMetadataFile),
+		data,
+		0o644,
+	)
+}
+
 func registryPackages(cfg Config, validate bool) ([]Package, error) {
 	if cfg.RegistryDir != "" {
-		return registryPackagesDir(cfg, validate)
+		return registryPackagesIndexed(cfg, validate)
 	} else if cfg.RegistryUrl != "" {
 		return registryPackagesUrl(cfg, validate)
 	} else {
@@ -83,11 +151,37 @@ func registryPackagesFs(
 			if err != nil {
 				return err
 			}
+			defer fileReader.Close()
 			tmpPkg, err := NewPackageFromReader(fileReader)
+			if err != nil && !validate &&
+				errors.Is(err, ErrPackageSpecVersionUnsupported) {
+				// Quietly skip packages intended for newer versions of cardano-up
+				cfg.Logger.Debug(
+					fmt.Sprintf(
+						"skipping package %q: %s",
+						fullPath,
+						err,
+					),
+				)
+				return nil
+			}
 			if err != nil {
 				if validate {
 					// Record error for deferred failure
 					retErr = ErrValidationFailed
+					// Check against the package schema for more helpful errors
+					if problems := registryPackageSchemaProblems(filesystem, path); len(problems) > 0 {
+						for _, problem := range problems {
+							cfg.Logger.Warn(
+								fmt.Sprintf(
+									"failed to load %q as package: %s",
+									fullPath,
+									problem,
+								),
+							)
+						}
+						return nil
+					}
 				}
 				cfg.Logger.Warn(
 					fmt.Sprintf(
@@ -105,6 +199,16 @@ func registryPackagesFs(
 			// Record on-disk path for package file
 			// This is used for relative paths for external file references
 			tmpPkg.filePath = fullPath
+			if err := tmpPkg.loadComposeSources(); err != nil {
+				cfg.Logger.Warn(
+					fmt.Sprintf(
+						"failed to load %q as package: %s",
+						fullPath,
+						err,
+					),
+				)
+				return nil
+			}
 			// Add package to results
 			ret = append(ret, tmpPkg)
 			return nil
@@ -116,11 +220,23 @@ func registryPackagesFs(
 	return ret, retErr
 }
 
+func registryPackageSchemaProblems(
+	filesystem fs.ReadFileFS,
+	path string,
+) []string {
+	data, err := filesystem.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	problems, err := validatePackageSchema(data)
+	if err != nil {
+		return nil
+	}
+	return problems
+}
+
 func registryPackagesUrl(cfg Config, validate bool) ([]Package, error) {
-	cachePath := filepath.Join(
-		cfg.CacheDir,
-		"registry",
-	)
+	cachePath := registryCachePath(cfg)
 	// Check age of existing cache
 	stat, err := os.Stat(cachePath)
 	if err != nil {
@@ -128,77 +244,403 @@ func registryPackagesUrl(cfg Config, validate bool) ([]Package, error) {
 			return nil, err
 		}
 	}
-	// Fetch and extract registry ZIP into cache if it doesn't exist or is too old
-	if errors.Is(err, fs.ErrNotExist) ||
-		stat == nil ||
-		stat.ModTime().Before(time.Now().Add(-24*time.Hour)) {
-		// Fetch registry ZIP
-		cfg.Logger.Info(
-			fmt.Sprintf("Fetching package registry %s", cfg.RegistryUrl),
-		)
-		resp, err := http.Get(cfg.RegistryUrl)
-		if err != nil {
+	if stat == nil {
+		if cfg.Offline {
+			return nil, ErrRegistryNotCached
+		}
+		// Fetch registry ZIP into cache if it doesn't exist
+		if err := fetchRegistry(cfg); err != nil {
 			return nil, err
 		}
-		if resp == nil {
-			return nil, fmt.Errorf("empty response from %s", cfg.RegistryUrl)
+	} else if !cfg.Offline && stat.ModTime().Before(time.Now().Add(-registryCacheMaxAge)) {
+		// Use the stale cache while it's refreshed in the background, unless strict freshness
+		// was requested
+		if cfg.RegistryStrictFreshness {
+			if err := fetchRegistry(cfg); err != nil {
+				return nil, err
+			}
+		} else {
+			refreshRegistryBackground(cfg)
 		}
+	}
+	// Process cache dir, which isn't replaced while it's being read
+	unlock, err := lockRegistryCache(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	cfg.RegistryDir = cachePath
+	return registryPackagesIndexed(cfg, validate)
+}
 
-		defer resp.Body.Close()
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+// registryCachePath returns the path to the cache dir for the registry fetched from the registry
+// URL
+func registryCachePath(cfg Config) string {
+	return filepath.Join(
+		cfg.CacheDir,
+		"registry",
+	)
+}
+
+// registrySnapshotPath returns the path to the registry as of the last update command
+func registrySnapshotPath(cfg Config) string {
+	return filepath.Join(
+		cfg.CacheDir,
+		registrySnapshotDirname,
+	)
+}
+
+// lockRegistryCache locks the registry cache, shared for reading it or exclusive for replacing
+// it, and returns a func that releases the lock. The lock is only held briefly, so this waits for
+// it rather than failing
+func lockRegistryCache(cfg Config, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(cfg.CacheDir, fs.ModePerm); err != nil {
+		return nil, err
+	}
+	lockPath := filepath.Join(cfg.CacheDir, registryCacheLockFile)
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %s", err)
+	}
+	if err := lockFileWait(lockFile, exclusive); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("failed to lock %s: %s", lockPath, err)
+	}
+	return func() {
+		if err := unlockFile(lockFile); err != nil {
+			cfg.Logger.Debug(
+				fmt.Sprintf("failed to release registry cache lock: %s", err),
+			)
 		}
-		zipData := bytes.NewReader(respBody)
-		zipReader, err := zip.NewReader(
-			zipData,
-			int64(zipData.Len()),
+		lockFile.Close()
+	}, nil
+}
+
+// refreshRegistryBackground starts refreshing the stale registry cache in the background. Another
+// refresh isn't started until registryRefreshInterval has passed, in case a previous refresh is
+// still running or failed
+func refreshRegistryBackground(cfg Config) {
+	markerPath := filepath.Join(cfg.CacheDir, registryRefreshMarker)
+	if stat, err := os.Stat(markerPath); err == nil &&
+		stat.ModTime().After(time.Now().Add(-registryRefreshInterval)) {
+		return
+	}
+	now := time.Now()
+	if err := os.WriteFile(markerPath, nil, 0o600); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to write registry refresh marker: %s", err),
+		)
+	} else if err := os.Chtimes(markerPath, now, now); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to update registry refresh marker: %s", err),
 		)
+	}
+	cfg.Logger.Debug("package registry cache is stale, refreshing it in the background")
+	if cfg.RegistryRefresh != nil {
+		cfg.RegistryRefresh()
+		return
+	}
+	go func() {
+		if err := fetchRegistry(cfg); err != nil {
+			cfg.Logger.Debug(
+				fmt.Sprintf("failed to refresh package registry: %s", err),
+			)
+		}
+	}()
+}
+
+// fetchRegistry fetches the registry ZIP from the registry URL and extracts it into the cache.
+// The files are extracted into a temp dir that then replaces the cache dir while holding the
+// registry cache lock, so that the existing cache can be used until the fetch has completed and
+// is kept if it fails. The replaced cache is kept as the registry snapshot for the next update
+// command, unless there's already one. The download is skipped when the server reports that the
+// registry hasn't changed since it was last fetched
+func fetchRegistry(cfg Config) error {
+	if cfg.Offline {
+		return ErrOffline
+	}
+	cfg.Logger.Info(
+		fmt.Sprintf("Fetching package registry %s", cfg.RegistryUrl),
+	)
+	req, err := http.NewRequestWithContext(
+		cfg.ctx(),
+		http.MethodGet,
+		cfg.RegistryUrl,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	setRegistryAuth(cfg, req)
+	cachePath := registryCachePath(cfg)
+	if _, err := os.Stat(cachePath); err == nil {
+		if metadata := loadRegistryCacheMetadata(cfg); metadata != nil {
+			if metadata.ETag != "" {
+				req.Header.Set("If-None-Match", metadata.ETag)
+			}
+			if metadata.LastModified != "" {
+				req.Header.Set("If-Modified-Since", metadata.LastModified)
+			}
+		}
+	}
+	resp, err := httpDo(cfg, req)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("empty response from %s", cfg.RegistryUrl)
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		cfg.Logger.Debug("package registry has not changed, keeping the existing cache")
+		// Mark the cache as fresh, since the dir modification time is used for its age
+		now := time.Now()
+		return os.Chtimes(cachePath, now, now)
+	}
+	if resp.StatusCode == http.StatusUnauthorized ||
+		resp.StatusCode == http.StatusForbidden {
+		return NewRegistryAuthFailedError(cfg.RegistryUrl, resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return NewRegistryFetchFailedError(cfg.RegistryUrl, resp.Status)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	zipData := bytes.NewReader(respBody)
+	zipReader, err := zip.NewReader(
+		zipData,
+		int64(zipData.Len()),
+	)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.CacheDir, fs.ModePerm); err != nil {
+		return err
+	}
+	tmpPath, err := os.MkdirTemp(cfg.CacheDir, "registry-")
+	if err != nil {
+		return err
+	}
+	// This is a no-op once the temp dir has replaced the cache dir
+	defer os.RemoveAll(tmpPath)
+	if err := os.Chmod(tmpPath, fs.ModePerm); err != nil {
+		return err
+	}
+	// Extract files from ZIP into temp path
+	for _, zipFile := range zipReader.File {
+		// Skip directory entries
+		if (zipFile.Mode() & fs.ModeDir) > 0 {
+			continue
+		}
+		// Ensure there are no parent dir references in path
+		if strings.Contains(zipFile.Name, "..") {
+			continue
+		}
+		outPath := filepath.Join(
+			tmpPath,
+			zipFile.Name,
+		)
+		// Create parent dir(s)
+		if err := os.MkdirAll(filepath.Dir(outPath), fs.ModePerm); err != nil {
+			return err
+		}
+		// Read file bytes
+		zf, err := zipFile.Open()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		// Clear out existing cache files
-		if err := os.RemoveAll(cachePath); err != nil {
-			return nil, err
+		zfData, err := io.ReadAll(zf)
+		if err != nil {
+			return err
 		}
-		if err := os.MkdirAll(cachePath, fs.ModePerm); err != nil {
-			return nil, err
+		zf.Close()
+		// Write file
+		if err := os.WriteFile(outPath, zfData, fs.ModePerm); err != nil {
+			return err
 		}
-		// Extract files from ZIP into cache path
-		for _, zipFile := range zipReader.File {
-			// Skip directory entries
-			if (zipFile.Mode() & fs.ModeDir) > 0 {
-				continue
-			}
-			// Ensure there are no parent dir references in path
-			if strings.Contains(zipFile.Name, "..") {
+	}
+	// Replace existing cache files
+	unlock, err := lockRegistryCache(cfg, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	snapshotPath := registrySnapshotPath(cfg)
+	if _, err := os.Stat(snapshotPath); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(cachePath, snapshotPath); err != nil &&
+			!errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.RemoveAll(cachePath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		return err
+	}
+	// Mark the cache as fresh, since the dir modification time is used for its age
+	now := time.Now()
+	if err := os.Chtimes(cachePath, now, now); err != nil {
+		return err
+	}
+	metadata := registryCacheMetadata{
+		Url:          cfg.RegistryUrl,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := saveRegistryCacheMetadata(cfg, metadata); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to save registry cache metadata: %s", err),
+		)
+	}
+	return nil
+}
+
+// cachedRegistryPackages returns the packages from the registry without fetching it, or nil if a
+// registry URL is configured and hasn't been fetched yet. When the registry was fetched since the
+// last update command, the packages from the registry snapshot are returned instead
+func cachedRegistryPackages(cfg Config) ([]Package, error) {
+	if cfg.RegistryDir != "" {
+		return registryPackagesIndexed(cfg, false)
+	}
+	unlock, err := lockRegistryCache(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for _, registryDir := range []string{registrySnapshotPath(cfg), registryCachePath(cfg)} {
+		if _, err := os.Stat(registryDir); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
-			outPath := filepath.Join(
-				cachePath,
-				zipFile.Name,
-			)
-			// Create parent dir(s)
-			if err := os.MkdirAll(filepath.Dir(outPath), fs.ModePerm); err != nil {
-				return nil, err
-			}
-			// Read file bytes
-			zf, err := zipFile.Open()
-			if err != nil {
-				return nil, err
-			}
-			zfData, err := io.ReadAll(zf)
-			if err != nil {
-				return nil, err
+			return nil, err
+		}
+		// The registry index is only used for the cache, so that loading the snapshot doesn't
+		// replace it
+		cfg.RegistryDir = registryDir
+		return registryPackagesDir(cfg, false)
+	}
+	return nil, nil
+}
+
+// removeRegistrySnapshot removes the registry snapshot once the update command has shown the
+// changes since it
+func removeRegistrySnapshot(cfg Config) error {
+	unlock, err := lockRegistryCache(cfg, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return os.RemoveAll(registrySnapshotPath(cfg))
+}
+
+// RegistryChanges describes the changes to the available packages from updating the registry
+type RegistryChanges struct {
+	// Initial is set when there was no previously fetched registry to compare with
+	Initial bool
+	// Packages lists the packages with added or removed versions, sorted by name
+	Packages []RegistryPackageChange
+}
+
+// RegistryPackageChange describes the changes to the available versions of a package
+type RegistryPackageChange struct {
+	Name string
+	// New is set for packages that weren't previously available
+	New bool
+	// Removed is set for packages that are no longer available
+	Removed bool
+	// AddedVersions lists the newly available versions, sorted oldest first
+	AddedVersions []string
+	// RemovedVersions lists the versions that are no longer available, sorted oldest first
+	RemovedVersions []string
+}
+
+// registryChanges compares the available package versions before and after updating the registry
+func registryChanges(before []Package, after []Package) []RegistryPackageChange {
+	versionsByName := func(pkgs []Package) map[string]map[string]bool {
+		ret := make(map[string]map[string]bool)
+		for _, pkg := range pkgs {
+			if ret[pkg.Name] == nil {
+				ret[pkg.Name] = make(map[string]bool)
 			}
-			zf.Close()
-			// Write file
-			if err := os.WriteFile(outPath, zfData, fs.ModePerm); err != nil {
-				return nil, err
+			ret[pkg.Name][pkg.Version] = true
+		}
+		return ret
+	}
+	// missingVersions returns the versions in a that aren't in b
+	missingVersions := func(a map[string]bool, b map[string]bool) []string {
+		var ret []string
+		for pkgVersion := range a {
+			if !b[pkgVersion] {
+				ret = append(ret, pkgVersion)
 			}
 		}
+		sort.Slice(
+			ret,
+			func(i, j int) bool {
+				return versionNewer(ret[j], ret[i])
+			},
+		)
+		return ret
+	}
+	beforeVersions := versionsByName(before)
+	afterVersions := versionsByName(after)
+	var pkgNames []string
+	for pkgName := range beforeVersions {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	for pkgName := range afterVersions {
+		if _, ok := beforeVersions[pkgName]; !ok {
+			pkgNames = append(pkgNames, pkgName)
+		}
+	}
+	sort.Strings(pkgNames)
+	var ret []RegistryPackageChange
+	for _, pkgName := range pkgNames {
+		tmpChange := RegistryPackageChange{
+			Name:            pkgName,
+			New:             beforeVersions[pkgName] == nil,
+			Removed:         afterVersions[pkgName] == nil,
+			AddedVersions:   missingVersions(afterVersions[pkgName], beforeVersions[pkgName]),
+			RemovedVersions: missingVersions(beforeVersions[pkgName], afterVersions[pkgName]),
+		}
+		if len(tmpChange.AddedVersions) == 0 && len(tmpChange.RemovedVersions) == 0 {
+			continue
+		}
+		ret = append(ret, tmpChange)
+	}
+	return ret
+}
+
+// setRegistryAuth adds an Authorization header to the request based on the configured registry
+// credentials, falling back to the user's netrc file
+func setRegistryAuth(cfg Config, req *http.Request) {
+	auth := cfg.RegistryAuth
+	if !auth.IsEmpty() {
+		if auth.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+auth.Token)
+		} else {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+		return
+	}
+	login, password, err := netrcCredentials(req.URL.Hostname())
+	if err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to read netrc file: %s", err),
+		)
+		return
+	}
+	if login != "" || password != "" {
+		cfg.Logger.Debug(
+			fmt.Sprintf(
+				"using netrc credentials for registry host %s",
+				req.URL.Hostname(),
+			),
+		)
+		req.SetBasicAuth(login, password)
 	}
-	// Process cache dir
-	cfg.RegistryDir = cachePath
-	return registryPackagesDir(cfg, validate)
 }
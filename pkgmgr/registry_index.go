@@ -0,0 +1,223 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// registryIndexFile is the file in the cache dir with the index of the packages in the
+	// registry
+	registryIndexFile = "registry-index.json"
+
+	// registryIndexVersion is the format version of the registry index. This should be bumped
+	// whenever the format changes, so that older indexes are rebuilt
+	registryIndexVersion = 1
+)
+
+// registryIndex is the index of the packages in a registry dir, which is cached so that the
+// package manifests don't need to be parsed again until the registry changes
+type registryIndex struct {
+	Version int `json:"version"`
+	// SpecVersion is the package spec version supported when the index was built, since packages
+	// for newer spec versions are skipped
+	SpecVersion int `json:"specVersion"`
+	// Source is the absolute path to the registry dir
+	Source string `json:"source"`
+	// Files records each file in the registry dir, to check whether the index is out of date
+	Files map[string]registryIndexFileInfo `json:"files"`
+	// Packages maps each package name to its versions, with the newest version first
+	Packages map[string][]registryIndexEntry `json:"packages"`
+}
+
+type registryIndexFileInfo struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"modTime"`
+}
+
+type registryIndexEntry struct {
+	// Path is the path to the package manifest, relative to the registry dir
+	Path    string  `json:"path"`
+	Package Package `json:"package"`
+}
+
+// registryPackagesIndexed returns the packages from the registry dir, using the cached registry
+// index when the files in the registry dir haven't changed since it was built. The registry dir is
+// always loaded in full when validating, so that all problems are reported
+func registryPackagesIndexed(cfg Config, validate bool) ([]Package, error) {
+	if validate || cfg.CacheDir == "" {
+		return registryPackagesDir(cfg, validate)
+	}
+	absRegistryDir, err := filepath.Abs(cfg.RegistryDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := registryDirFiles(absRegistryDir)
+	if err != nil {
+		// Any problem with the registry dir is reported when loading it
+		return registryPackagesDir(cfg, validate)
+	}
+	if pkgs, ok := loadRegistryIndex(cfg, absRegistryDir, files); ok {
+		return pkgs, nil
+	}
+	pkgs, err := registryPackagesDir(cfg, validate)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveRegistryIndex(cfg, absRegistryDir, files, pkgs); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to save registry index: %s", err),
+		)
+	}
+	return pkgs, nil
+}
+
+// registryDirFiles returns the size and modification time of each file in the registry dir, keyed
+// on the path relative to the registry dir. Files in dot-dirs are skipped, as when loading the
+// packages
+func registryDirFiles(registryDir string) (map[string]registryIndexFileInfo, error) {
+	ret := make(map[string]registryIndexFileInfo)
+	err := filepath.WalkDir(
+		registryDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if strings.HasPrefix(d.Name(), `.`) && path != registryDir {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(registryDir, path)
+			if err != nil {
+				return err
+			}
+			ret[filepath.ToSlash(relPath)] = registryIndexFileInfo{
+				Size:    info.Size(),
+				ModTime: info.ModTime().UnixNano(),
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// loadRegistryIndex returns the packages from the cached registry index, if it was built from the
+// same registry dir with the same files
+func loadRegistryIndex(
+	cfg Config,
+	registryDir string,
+	files map[string]registryIndexFileInfo,
+) ([]Package, bool) {
+	data, err := os.ReadFile(filepath.Join(cfg.CacheDir, registryIndexFile))
+	if err != nil {
+		return nil, false
+	}
+	var index registryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		cfg.Logger.Debug(
+			fmt.Sprintf("failed to load registry index: %s", err),
+		)
+		return nil, false
+	}
+	if index.Version != registryIndexVersion || index.SpecVersion != PackageSpecVersion ||
+		index.Source != registryDir || len(index.Files) != len(files) {
+		return nil, false
+	}
+	for path, info := range files {
+		if index.Files[path] != info {
+			return nil, false
+		}
+	}
+	var ret []Package
+	for _, entries := range index.Packages {
+		for _, entry := range entries {
+			pkg := entry.Package
+			pkg.filePath = filepath.Join(registryDir, filepath.FromSlash(entry.Path))
+			ret = append(ret, pkg)
+		}
+	}
+	sortPackages(ret)
+	return ret, true
+}
+
+// saveRegistryIndex writes the registry index for the packages loaded from the registry dir
+func saveRegistryIndex(
+	cfg Config,
+	registryDir string,
+	files map[string]registryIndexFileInfo,
+	pkgs []Package,
+) error {
+	index := registryIndex{
+		Version:     registryIndexVersion,
+		SpecVersion: PackageSpecVersion,
+		Source:      registryDir,
+		Files:       files,
+		Packages:    make(map[string][]registryIndexEntry),
+	}
+	tmpPkgs := make([]Package, len(pkgs))
+	copy(tmpPkgs, pkgs)
+	sortPackages(tmpPkgs)
+	for _, pkg := range tmpPkgs {
+		relPath, err := filepath.Rel(registryDir, pkg.filePath)
+		if err != nil {
+			return err
+		}
+		index.Packages[pkg.Name] = append(
+			index.Packages[pkg.Name],
+			registryIndexEntry{
+				Path:    filepath.ToSlash(relPath),
+				Package: pkg,
+			},
+		)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.CacheDir, fs.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cfg.CacheDir, registryIndexFile), data)
+}
+
+// packageIndex maps each package name to its versions, with the newest version first, for looking
+// up packages by name without scanning all available packages
+type packageIndex map[string][]Package
+
+func newPackageIndex(pkgs []Package) packageIndex {
+	tmpPkgs := make([]Package, len(pkgs))
+	copy(tmpPkgs, pkgs)
+	sortPackages(tmpPkgs)
+	ret := make(packageIndex)
+	for _, pkg := range tmpPkgs {
+		ret[pkg.Name] = append(ret[pkg.Name], pkg)
+	}
+	return ret
+}
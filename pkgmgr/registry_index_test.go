@@ -0,0 +1,138 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryPackagesIndexed(t *testing.T) {
+	registryDir := t.TempDir()
+	testFiles := map[string]string{
+		"node/node-1.0.0.yaml": "name: node\nversion: 1.0.0\ndescription: old\n",
+		"node/node-1.10.0.yaml": `name: node
+version: 1.10.0
+dependencies:
+  - name: mithril
+    condition: .Package.Options.mithril
+options:
+  - name: mithril
+    default: true
+installSteps:
+  - docker:
+      containerName: node
+      image: example/node:1.10.0
+      env:
+        NETWORK: '{{ .Context.Network }}'
+      ports:
+        - '{{ freePort 3001 }}:3001'
+  - compose:
+      source: compose.yaml
+`,
+		"node/compose.yaml":             "services:\n  app:\n    image: example/app:1.0.0\n",
+		"ogmios/ogmios-6.0.0.yaml":      "name: ogmios\nversion: 6.0.0\n",
+		".git/ignored/ignored-1.0.yaml": "name: ignored\nversion: 1.0.0\n",
+	}
+	for path, content := range testFiles {
+		fullPath := filepath.Join(registryDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryDir: registryDir,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	expectedPkgs, err := registryPackagesDir(cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sortPackages(expectedPkgs)
+	// The index is built on the first load and used on the next
+	for i := 0; i < 2; i++ {
+		pkgs, err := registryPackagesIndexed(cfg, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		sortPackages(pkgs)
+		if !reflect.DeepEqual(pkgs, expectedPkgs) {
+			t.Fatalf(
+				"did not get expected packages\n  got: %#v\n  expected: %#v",
+				pkgs,
+				expectedPkgs,
+			)
+		}
+	}
+	files, err := registryDirFiles(registryDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := files[".git/ignored/ignored-1.0.yaml"]; ok || len(files) != 4 {
+		t.Fatalf("did not get expected registry files: %#v", files)
+	}
+	if _, ok := loadRegistryIndex(cfg, registryDir, files); !ok {
+		t.Fatalf("registry index was not used")
+	}
+	// Changing a file in the registry dir makes the index out of date
+	if err := os.WriteFile(
+		filepath.Join(registryDir, "node/node-1.0.0.yaml"),
+		[]byte("name: node\nversion: 1.0.0\ndescription: updated\n"),
+		0o644,
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	files, err = registryDirFiles(registryDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := loadRegistryIndex(cfg, registryDir, files); ok {
+		t.Fatalf("out of date registry index was used")
+	}
+	pkgs, err := registryPackagesIndexed(cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, pkg := range pkgs {
+		if pkg.Version == "1.0.0" && pkg.Description != "updated" {
+			t.Fatalf("did not get updated package: %#v", pkg)
+		}
+	}
+}
+
+func TestNewPackageIndex(t *testing.T) {
+	index := newPackageIndex(
+		[]Package{
+			{Name: "node", Version: "1.2.0"},
+			{Name: "ogmios", Version: "6.0.0"},
+			{Name: "node", Version: "1.10.0"},
+		},
+	)
+	if len(index) != 2 || len(index["ogmios"]) != 1 {
+		t.Fatalf("did not get expected package index: %#v", index)
+	}
+	if len(index["node"]) != 2 || index["node"][0].Version != "1.10.0" ||
+		index["node"][1].Version != "1.2.0" {
+		t.Fatalf("did not get expected versions for node: %#v", index["node"])
+	}
+}
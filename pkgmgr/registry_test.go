@@ -15,10 +15,21 @@
 package pkgmgr
 
 import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 )
 
 func TestRegistryPackagesFs(t *testing.T) {
@@ -75,3 +86,450 @@ func TestRegistryPackagesFs(t *testing.T) {
 		)
 	}
 }
+
+func TestRegistryPackagesUrlNotFound(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}),
+	)
+	defer server.Close()
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryUrl: server.URL,
+		Logger:      slog.Default(),
+	}
+	_, err := registryPackagesUrl(cfg, false)
+	if err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	if !strings.Contains(err.Error(), "404") {
+		t.Fatalf("did not get expected error: %s", err)
+	}
+}
+
+func TestRegistryChanges(t *testing.T) {
+	before := []Package{
+		{Name: "node", Version: "1.2.0"},
+		{Name: "node", Version: "1.9.0"},
+		{Name: "old", Version: "1.0.0"},
+		{Name: "tool", Version: "2.0.0"},
+	}
+	after := []Package{
+		{Name: "node", Version: "1.9.0"},
+		{Name: "node", Version: "1.10.0"},
+		{Name: "new", Version: "0.1.0"},
+		{Name: "tool", Version: "2.0.0"},
+	}
+	expected := []RegistryPackageChange{
+		{Name: "new", New: true, AddedVersions: []string{"0.1.0"}},
+		{
+			Name:            "node",
+			AddedVersions:   []string{"1.10.0"},
+			RemovedVersions: []string{"1.2.0"},
+		},
+		{Name: "old", Removed: true, RemovedVersions: []string{"1.0.0"}},
+	}
+	changes := registryChanges(before, after)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf(
+			"did not get expected changes\n  got: %#v\n  expected: %#v",
+			changes,
+			expected,
+		)
+	}
+	if changes := registryChanges(after, after); len(changes) != 0 {
+		t.Fatalf("got unexpected changes: %#v", changes)
+	}
+}
+
+func TestUpdatePackagesChanges(t *testing.T) {
+	registryFiles := map[string]string{
+		"registry/node/node-1.0.0.yaml": "name: node\nversion: 1.0.0",
+	}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			for name, content := range registryFiles {
+				f, err := zipWriter.Create(name)
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				if _, err := f.Write([]byte(content)); err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	tmpDir := t.TempDir()
+	cfg := Config{
+		CacheDir:    filepath.Join(tmpDir, "cache"),
+		ConfigDir:   filepath.Join(tmpDir, "config"),
+		DataDir:     filepath.Join(tmpDir, "data"),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	changes, err := pm.UpdatePackages()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !changes.Initial {
+		t.Fatalf("initial fetch was not reported")
+	}
+	registryFiles["registry/node/node-1.1.0.yaml"] = "name: node\nversion: 1.1.0"
+	changes, err = pm.UpdatePackages()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []RegistryPackageChange{
+		{Name: "node", AddedVersions: []string{"1.1.0"}},
+	}
+	if changes.Initial || !reflect.DeepEqual(changes.Packages, expected) {
+		t.Fatalf(
+			"did not get expected changes\n  got: %#v\n  expected: %#v",
+			changes,
+			expected,
+		)
+	}
+}
+
+func TestUpdatePackagesAfterRefresh(t *testing.T) {
+	registryFiles := map[string]string{
+		"registry/node/node-1.0.0.yaml": "name: node\nversion: 1.0.0",
+	}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			for name, content := range registryFiles {
+				f, err := zipWriter.Create(name)
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				if _, err := f.Write([]byte(content)); err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	tmpDir := t.TempDir()
+	cfg := Config{
+		CacheDir:    filepath.Join(tmpDir, "cache"),
+		ConfigDir:   filepath.Join(tmpDir, "config"),
+		DataDir:     filepath.Join(tmpDir, "data"),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := pm.UpdatePackages(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// A background refresh keeps the registry from before it
+	registryFiles["registry/node/node-1.1.0.yaml"] = "name: node\nversion: 1.1.0"
+	if err := pm.RefreshRegistry(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(registrySnapshotPath(cfg)); err != nil {
+		t.Fatalf("registry snapshot was not kept: %s", err)
+	}
+	// The next update still reports the changes from the background refresh
+	changes, err := pm.UpdatePackages()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []RegistryPackageChange{
+		{Name: "node", AddedVersions: []string{"1.1.0"}},
+	}
+	if changes.Initial || !reflect.DeepEqual(changes.Packages, expected) {
+		t.Fatalf(
+			"did not get expected changes\n  got: %#v\n  expected: %#v",
+			changes,
+			expected,
+		)
+	}
+	if _, err := os.Stat(registrySnapshotPath(cfg)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("registry snapshot was not removed: %v", err)
+	}
+	// The changes are only reported once
+	changes, err = pm.UpdatePackages()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(changes.Packages) != 0 {
+		t.Fatalf("got unexpected changes: %#v", changes.Packages)
+	}
+}
+
+func TestFetchRegistryLocked(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			f, err := zipWriter.Create("registry/node/node.yaml")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if _, err := f.Write([]byte("name: node\nversion: 1.0.0")); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	// The cache isn't replaced while it's being read
+	unlock, err := lockRegistryCache(cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fetchRegistry(cfg)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("registry was fetched while the cache was locked: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := os.Stat(registryCachePath(cfg)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("registry cache was replaced while it was locked: %v", err)
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(registryCachePath(cfg)); err != nil {
+		t.Fatalf("registry cache was not replaced: %s", err)
+	}
+}
+
+func TestRegistryPackagesUrlStale(t *testing.T) {
+	registryVersion := "1.0.0"
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			f, err := zipWriter.Create("registry/node/node.yaml")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if _, err := f.Write([]byte("name: node\nversion: " + registryVersion)); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	refreshes := 0
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		RegistryRefresh: func() {
+			refreshes++
+		},
+	}
+	pkgVersion := func() string {
+		pkgs, err := registryPackagesUrl(cfg, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(pkgs) != 1 {
+			t.Fatalf("did not get expected packages: %#v", pkgs)
+		}
+		return pkgs[0].Version
+	}
+	// The registry is fetched when there's no cache
+	if version := pkgVersion(); version != "1.0.0" || refreshes != 0 {
+		t.Fatalf("did not get expected initial fetch: %s, %d refreshes", version, refreshes)
+	}
+	// A stale cache is used while it's refreshed in the background
+	registryVersion = "1.1.0"
+	staleTime := time.Now().Add(-2 * registryCacheMaxAge)
+	if err := os.Chtimes(registryCachePath(cfg), staleTime, staleTime); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if version := pkgVersion(); version != "1.0.0" || refreshes != 1 {
+		t.Fatalf("did not get expected stale cache: %s, %d refreshes", version, refreshes)
+	}
+	// Another refresh isn't started right away
+	if version := pkgVersion(); version != "1.0.0" || refreshes != 1 {
+		t.Fatalf("did not get expected stale cache: %s, %d refreshes", version, refreshes)
+	}
+	// Strict freshness fetches the registry before using it
+	cfg.RegistryStrictFreshness = true
+	if version := pkgVersion(); version != "1.1.0" || refreshes != 1 {
+		t.Fatalf("did not get expected fresh cache: %s, %d refreshes", version, refreshes)
+	}
+}
+
+func TestRegistryPackagesUrlOffline(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			f, err := zipWriter.Create("registry/node/node.yaml")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if _, err := f.Write([]byte("name: node\nversion: 1.0.0")); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	refreshes := 0
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		RegistryRefresh: func() {
+			refreshes++
+		},
+		Offline: true,
+	}
+	// The registry isn't fetched when there's no cache
+	if _, err := registryPackagesUrl(cfg, false); !errors.Is(err, ErrRegistryNotCached) {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	if err := fetchRegistry(cfg); !errors.Is(err, ErrOffline) {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("did not expect any requests, got %d", requests)
+	}
+	// A stale cache is used without refreshing it
+	cfg.Offline = false
+	if err := fetchRegistry(cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	staleTime := time.Now().Add(-2 * registryCacheMaxAge)
+	if err := os.Chtimes(registryCachePath(cfg), staleTime, staleTime); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.Offline = true
+	cfg.RegistryStrictFreshness = true
+	pkgs, err := registryPackagesUrl(cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pkgs) != 1 || requests != 1 || refreshes != 0 {
+		t.Fatalf(
+			"did not get expected cached packages: %#v, %d requests, %d refreshes",
+			pkgs,
+			requests,
+			refreshes,
+		)
+	}
+}
+
+func TestFetchRegistryConditional(t *testing.T) {
+	downloads := 0
+	fail := false
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			var buf bytes.Buffer
+			zipWriter := zip.NewWriter(&buf)
+			f, err := zipWriter.Create("registry/node/node.yaml")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if _, err := f.Write([]byte("name: node\nversion: 1.0.0")); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if err := zipWriter.Close(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			downloads++
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write(buf.Bytes())
+		}),
+	)
+	defer server.Close()
+	cfg := Config{
+		CacheDir:    t.TempDir(),
+		RegistryUrl: server.URL,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for i := 0; i < 2; i++ {
+		if err := fetchRegistry(cfg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if downloads != 1 {
+		t.Fatalf("registry was downloaded %d times, expected once", downloads)
+	}
+	// The existing cache is kept when the fetch fails
+	fail = true
+	if err := fetchRegistry(cfg); err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	cfg.RegistryDir = registryCachePath(cfg)
+	pkgs, err := registryPackagesDir(cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("did not get expected packages from existing cache: %#v", pkgs)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// remoteCacheDirName is the dir under the remote data dir used for package cache dirs
+	remoteCacheDirName = ".cache"
+
+	// volumeNamePrefix is the prefix for named volumes used in place of bind mounts from the
+	// data and cache dirs on remote Docker hosts
+	volumeNamePrefix      = "cardano-up"
+	volumeCacheNamePrefix = "cardano-up-cache"
+
+	// volumePackageLabel is the label on named volumes that belong to a single package
+	volumePackageLabel = "io.blinklabs.cardano-up.package"
+)
+
+// remoteHost returns the SSH host for the configured Docker host, or nil if the Docker host is
+// local (or not using SSH)
+func (c Config) remoteHost() (*sshHost, error) {
+	if !isSshDockerHost(c.DockerHost) {
+		return nil, nil
+	}
+	ret, err := parseSshHost(c.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// remoteBindSource describes where the host side of a bind mount lives on a remote Docker host
+type remoteBindSource struct {
+	// path is the path on the remote host, if the bind uses a host path
+	path string
+	// volume is the named volume used in place of a host path
+	volume string
+	// pkgName is the package that owns the volume, if it's inside the package data or cache dir
+	pkgName string
+}
+
+// remoteBind translates the host side of a bind mount in the Docker -v flag format for a remote
+// Docker host. Paths inside the local data and cache dirs are mapped to the remote data dir when
+// configured, or to named volumes otherwise. Other absolute paths are assumed to refer to the
+// remote host and named volumes are left alone
+func remoteBind(cfg Config, pkgName string, bind string) (string, remoteBindSource) {
+	hostPath, containerPart, ok := strings.Cut(bind, ":")
+	if !ok {
+		// Anonymous volume
+		return bind, remoteBindSource{}
+	}
+	if !filepath.IsAbs(hostPath) {
+		return bind, remoteBindSource{volume: hostPath}
+	}
+	relPath, isCache, ok := dataRelPath(cfg, hostPath)
+	if !ok {
+		return bind, remoteBindSource{path: filepath.ToSlash(hostPath)}
+	}
+	if cfg.RemoteDataDir != "" {
+		remotePath := remoteDataPath(cfg, relPath, isCache)
+		return remotePath + ":" + containerPart, remoteBindSource{path: remotePath}
+	}
+	ret := remoteBindSource{
+		volume: bindVolumeName(relPath, isCache),
+	}
+	if strings.SplitN(relPath, "/", 2)[0] == pkgName {
+		ret.pkgName = pkgName
+	}
+	return ret.volume + ":" + containerPart, ret
+}
+
+// remotePath returns the path on the remote host for a path inside the local data or cache dirs,
+// if a remote data dir is configured
+func remotePath(cfg Config, localPath string) (string, bool) {
+	if cfg.RemoteDataDir == "" {
+		return "", false
+	}
+	relPath, isCache, ok := dataRelPath(cfg, localPath)
+	if !ok {
+		return "", false
+	}
+	return remoteDataPath(cfg, relPath, isCache), true
+}
+
+// dataRelPath returns the slash-separated path relative to the local data or cache dir, and
+// whether it's in the cache dir
+func dataRelPath(cfg Config, localPath string) (string, bool, bool) {
+	for _, tmpDir := range []struct {
+		dir     string
+		isCache bool
+	}{
+		{cfg.DataDir, false},
+		{cfg.CacheDir, true},
+	} {
+		if tmpDir.dir == "" {
+			continue
+		}
+		relPath, err := filepath.Rel(tmpDir.dir, localPath)
+		if err != nil {
+			continue
+		}
+		if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.ToSlash(relPath), tmpDir.isCache, true
+	}
+	return "", false, false
+}
+
+func remoteDataPath(cfg Config, relPath string, isCache bool) string {
+	if isCache {
+		return path.Join(cfg.RemoteDataDir, remoteCacheDirName, relPath)
+	}
+	return path.Join(cfg.RemoteDataDir, relPath)
+}
+
+// bindVolumeName returns the named volume used in place of a path in the data or cache dir. Path
+// components are joined with '_', which isn't allowed in package or instance names
+func bindVolumeName(relPath string, isCache bool) string {
+	ret := volumeNamePrefix
+	if isCache {
+		ret = volumeCacheNamePrefix
+	}
+	if relPath == "." {
+		return ret
+	}
+	reInvalid := regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+	for _, part := range strings.Split(relPath, "/") {
+		ret += "_" + reInvalid.ReplaceAllString(part, "-")
+	}
+	return ret
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRemoteBind(t *testing.T) {
+	cfg := Config{
+		DataDir:    "/home/user/.local/share/cardano-up",
+		CacheDir:   "/home/user/.cache/cardano-up",
+		DockerHost: "ssh://cardano@node.example.com",
+	}
+	pkgName := "cardano-node-1.0.0-default"
+	testDefs := []struct {
+		bind          string
+		remoteDataDir string
+		expected      string
+		source        remoteBindSource
+	}{
+		{
+			bind:          "/home/user/.local/share/cardano-up/cardano-node-1.0.0-default/data:/data",
+			remoteDataDir: "/srv/cardano-up",
+			expected:      "/srv/cardano-up/cardano-node-1.0.0-default/data:/data",
+			source: remoteBindSource{
+				path: "/srv/cardano-up/cardano-node-1.0.0-default/data",
+			},
+		},
+		{
+			bind:          "/home/user/.cache/cardano-up/cardano-node-1.0.0-default:/cache:ro",
+			remoteDataDir: "/srv/cardano-up",
+			expected:      "/srv/cardano-up/.cache/cardano-node-1.0.0-default:/cache:ro",
+			source: remoteBindSource{
+				path: "/srv/cardano-up/.cache/cardano-node-1.0.0-default",
+			},
+		},
+		{
+			bind:     "/home/user/.local/share/cardano-up/cardano-node-1.0.0-default/data:/data",
+			expected: "cardano-up_cardano-node-1.0.0-default_data:/data",
+			source: remoteBindSource{
+				volume:  "cardano-up_cardano-node-1.0.0-default_data",
+				pkgName: pkgName,
+			},
+		},
+		{
+			// The context dir is shared between packages
+			bind:     "/home/user/.local/share/cardano-up/default/ipc:/ipc",
+			expected: "cardano-up_default_ipc:/ipc",
+			source: remoteBindSource{
+				volume: "cardano-up_default_ipc",
+			},
+		},
+		{
+			bind:          "/mnt/db:/db",
+			remoteDataDir: "/srv/cardano-up",
+			expected:      "/mnt/db:/db",
+			source: remoteBindSource{
+				path: "/mnt/db",
+			},
+		},
+		{
+			bind:     "node-db:/db",
+			expected: "node-db:/db",
+			source: remoteBindSource{
+				volume: "node-db",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		cfg.RemoteDataDir = testDef.remoteDataDir
+		bind, source := remoteBind(cfg, pkgName, testDef.bind)
+		if bind != testDef.expected {
+			t.Fatalf(
+				"did not get expected bind for %q: got %q, expected %q",
+				testDef.bind,
+				bind,
+				testDef.expected,
+			)
+		}
+		if source != testDef.source {
+			t.Fatalf(
+				"did not get expected bind source for %q: got %#v, expected %#v",
+				testDef.bind,
+				source,
+				testDef.source,
+			)
+		}
+	}
+}
+
+func TestContextValidateDockerHost(t *testing.T) {
+	testDefs := []struct {
+		context Context
+		err     error
+		wantErr bool
+	}{
+		{
+			context: Context{},
+		},
+		{
+			context: Context{DockerHost: "unix:///var/run/docker.sock"},
+		},
+		{
+			context: Context{
+				DockerHost:    "ssh://cardano@node.example.com",
+				RemoteDataDir: "/srv/cardano-up",
+			},
+		},
+		{
+			context: Context{
+				DockerHost:    "ssh://cardano@node.example.com",
+				RemoteDataDir: "srv/cardano-up",
+			},
+			wantErr: true,
+		},
+		{
+			context: Context{RemoteDataDir: "/srv/cardano-up"},
+			err:     ErrRemoteDataDirNoSshHost,
+		},
+		{
+			context: Context{
+				DockerHost:    "tcp://node.example.com:2375",
+				RemoteDataDir: "/srv/cardano-up",
+			},
+			err: ErrRemoteDataDirNoSshHost,
+		},
+		{
+			context: Context{DockerHost: "node.example.com"},
+			wantErr: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.context.validateDockerHost()
+		if testDef.err != nil {
+			if !errors.Is(err, testDef.err) {
+				t.Fatalf("did not get expected error for %#v: %v", testDef.context, err)
+			}
+			continue
+		}
+		if testDef.wantErr {
+			if err == nil {
+				t.Fatalf("did not get expected error for %#v", testDef.context)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %#v: %s", testDef.context, err)
+		}
+	}
+}
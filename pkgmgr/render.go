@@ -0,0 +1,381 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+const (
+	// The context name used when rendering a package against a simulated context
+	simulatedContextName = "simulated"
+)
+
+// packageTemplate is a templated field in a package manifest
+type packageTemplate struct {
+	field string
+	body  string
+	// containerName is set for fields in docker install steps, which have
+	// access to the .Container vars
+	containerName string
+}
+
+// RenderedTemplate is the result of rendering a templated field in a package
+// manifest
+type RenderedTemplate struct {
+	Field string
+	Value string
+	Error error
+}
+
+// RenderedPackage is the result of rendering all templated fields in a package
+// manifest
+type RenderedPackage struct {
+	Package   Package
+	Context   string
+	Simulated bool
+	Templates []RenderedTemplate
+}
+
+// HasErrors returns whether any templates failed to render
+func (r RenderedPackage) HasErrors() bool {
+	for _, tmpl := range r.Templates {
+		if tmpl.Error != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPackage renders all templated fields of a package file or directory on
+// disk. If a context name is provided, the package is rendered against that
+// context, otherwise a simulated context with the specified network is used.
+// Host ports are not allocated
+func (p *PackageManager) RenderPackage(
+	path string,
+	contextName string,
+	network string,
+	opts map[string]any,
+) (RenderedPackage, error) {
+	localPkgs, err := localPackages(p.config, path)
+	if err != nil {
+		return RenderedPackage{}, err
+	}
+	if len(localPkgs) == 0 {
+		return RenderedPackage{}, NewNoLocalPackagesError(path)
+	}
+	pkgNames := localPackageNames(localPkgs)
+	if len(pkgNames) > 1 {
+		return RenderedPackage{}, NewLocalPackageAmbiguousError(path, pkgNames)
+	}
+	resolver := &Resolver{}
+	pkg, err := resolver.latestPackage(localPkgs, nil)
+	if err != nil {
+		return RenderedPackage{}, err
+	}
+	// Build package options
+	defaultOpts := pkg.defaultOpts()
+	for k := range opts {
+		if _, ok := defaultOpts[k]; !ok {
+			return RenderedPackage{}, NewPackageOptionUnknownError(pkg.Name, k)
+		}
+	}
+	pkgOpts, err := pkg.resolveOpts(opts)
+	if err != nil {
+		return RenderedPackage{}, err
+	}
+	// Determine context
+	ret := RenderedPackage{
+		Package: pkg,
+		Context: contextName,
+	}
+	var tmplContext Context
+	tmplEnv := make(map[string]string)
+	if contextName == "" {
+		ret.Context = simulatedContextName
+		ret.Simulated = true
+		tmplContext = Context{
+			Network: network,
+		}
+	} else {
+		tmpContext, ok := p.state.Contexts[contextName]
+		if !ok {
+			return RenderedPackage{}, ErrContextNotExist
+		}
+		tmplContext = tmpContext
+		for _, installedPkg := range p.state.InstalledPackages {
+			if installedPkg.Context != contextName {
+				continue
+			}
+			for k, v := range installedPkg.Outputs {
+				tmplEnv[k] = v
+			}
+		}
+	}
+	// Use a copy of the port registry so that no ports are actually allocated
+	ports := p.state.Ports.clone()
+	owner := portOwner(pkg, ret.Context)
+	cfg := p.config
+	cfg.Template = cfg.Template.WithVars(
+		map[string]any{
+			"Context": tmplContext.templateVars(ret.Context),
+			"Env":     tmplEnv,
+		},
+	).WithVars(
+		pkg.templateVars(cfg, ret.Context, pkgOpts),
+	).WithFuncs(
+		template.FuncMap{
+			"freePort": func(port int) (int, error) {
+				return ports.allocate(owner, port, isLocalDockerHost(cfg.DockerHost))
+			},
+		},
+	)
+	// Determine port mappings from the docker install steps
+	pkgName := fmt.Sprintf("%s-%s-%s", pkg.Name, pkg.Version, ret.Context)
+	tmplPorts := map[string]map[string]string{}
+	for _, installStep := range pkg.InstallSteps {
+		if installStep.Docker == nil {
+			continue
+		}
+		containerName := fmt.Sprintf(
+			"%s-%s",
+			pkgName,
+			installStep.Docker.ContainerName,
+		)
+		tmpPortsContainer := make(map[string]string)
+		for _, port := range installStep.Docker.Ports {
+			tmpPort, err := cfg.Template.Render(
+				port,
+				containerTemplateVars(containerName),
+			)
+			if err != nil {
+				// This will be reported below
+				continue
+			}
+			containerPort, hostPort := parsePortMapping(tmpPort)
+			tmpPortsContainer[containerPort] = hostPort
+		}
+		tmplPorts[installStep.Docker.ContainerName] = tmpPortsContainer
+	}
+	cfg.Template = cfg.Template.WithVars(
+		map[string]any{
+			"Ports": tmplPorts,
+		},
+	)
+	// Render templates
+	for _, tmpl := range pkg.templates(pkgName) {
+		val, err := cfg.Template.Render(
+			tmpl.body,
+			containerTemplateVars(tmpl.containerName),
+		)
+		ret.Templates = append(
+			ret.Templates,
+			RenderedTemplate{
+				Field: tmpl.field,
+				Value: val,
+				Error: err,
+			},
+		)
+	}
+	return ret, nil
+}
+
+// templates returns all templated fields in the package
+func (p Package) templates(pkgName string) []packageTemplate {
+	var ret []packageTemplate
+	add := func(field string, body string, containerName string) {
+		if body == "" {
+			return
+		}
+		ret = append(
+			ret,
+			packageTemplate{
+				field:         field,
+				body:          body,
+				containerName: containerName,
+			},
+		)
+	}
+	addCondition := func(field string, condition string) {
+		if condition == "" {
+			return
+		}
+		add(
+			field,
+			fmt.Sprintf(`{{ if %s }}true{{ else }}false{{ end }}`, condition),
+			"",
+		)
+	}
+	for idx, dep := range p.Dependencies {
+		addCondition(fmt.Sprintf("dependencies[%d].condition", idx), dep.Condition)
+	}
+	for optIdx, opt := range p.Options {
+		for idx, dep := range opt.Dependencies {
+			addCondition(
+				fmt.Sprintf("options[%d].dependencies[%d].condition", optIdx, idx),
+				dep.Condition,
+			)
+		}
+	}
+	for stepIdx, installStep := range p.InstallSteps {
+		stepField := fmt.Sprintf("installSteps[%d]", stepIdx)
+		addCondition(stepField+".condition", installStep.Condition)
+		if installStep.Docker != nil {
+			dockerField := stepField + ".docker"
+			containerName := fmt.Sprintf(
+				"%s-%s",
+				pkgName,
+				installStep.Docker.ContainerName,
+			)
+			add(dockerField+".image", installStep.Docker.Image, containerName)
+			add(dockerField+".platform", installStep.Docker.Platform, containerName)
+			add(dockerField+".user", installStep.Docker.User, containerName)
+			// Iterate over env vars in sorted order for consistent output
+			var envKeys []string
+			for k := range installStep.Docker.Env {
+				envKeys = append(envKeys, k)
+			}
+			sort.Strings(envKeys)
+			for _, k := range envKeys {
+				add(
+					fmt.Sprintf("%s.env.%s", dockerField, k),
+					installStep.Docker.Env[k],
+					containerName,
+				)
+			}
+			for idx, cmd := range installStep.Docker.Command {
+				add(
+					fmt.Sprintf("%s.command[%d]", dockerField, idx),
+					cmd,
+					containerName,
+				)
+			}
+			for idx, arg := range installStep.Docker.Args {
+				add(
+					fmt.Sprintf("%s.args[%d]", dockerField, idx),
+					arg,
+					containerName,
+				)
+			}
+			for idx, bind := range installStep.Docker.Binds {
+				add(
+					fmt.Sprintf("%s.binds[%d]", dockerField, idx),
+					bind,
+					containerName,
+				)
+			}
+			for idx, port := range installStep.Docker.Ports {
+				add(
+					fmt.Sprintf("%s.ports[%d]", dockerField, idx),
+					port,
+					containerName,
+				)
+			}
+		}
+		if installStep.File != nil {
+			fileField := stepField + ".file"
+			add(fileField+".filename", installStep.File.Filename, "")
+			add(fileField+".content", installStep.File.Content, "")
+			for idx, item := range installStep.File.Foreach {
+				add(fmt.Sprintf("%s.foreach[%d]", fileField, idx), item, "")
+			}
+			// Source files are also rendered as templates on install, but archives aren't
+			if installStep.File.Source != "" && !installStep.File.Extract && p.filePath != "" {
+				sourcePath := filepath.Join(
+					filepath.Dir(p.filePath),
+					installStep.File.Source,
+				)
+				if content, err := os.ReadFile(sourcePath); err == nil {
+					add(fileField+".source", string(content), "")
+				}
+			}
+			if installStep.File.SourceDir != "" && p.filePath != "" {
+				sourceDir := filepath.Join(
+					filepath.Dir(p.filePath),
+					installStep.File.SourceDir,
+				)
+				_ = filepath.WalkDir(
+					sourceDir,
+					func(path string, d fs.DirEntry, err error) error {
+						if err != nil || !d.Type().IsRegular() {
+							return nil
+						}
+						relPath, err := filepath.Rel(sourceDir, path)
+						if err != nil {
+							return nil
+						}
+						if content, err := os.ReadFile(path); err == nil {
+							add(
+								fmt.Sprintf(
+									"%s.sourceDir[%s]",
+									fileField,
+									filepath.ToSlash(relPath),
+								),
+								string(content),
+								"",
+							)
+						}
+						return nil
+					},
+				)
+			}
+		}
+	}
+	for idx, output := range p.Outputs {
+		add(fmt.Sprintf("outputs[%d].value", idx), output.Value, "")
+	}
+	if p.Topology != nil {
+		add("topology.filename", p.Topology.Filename, "")
+	}
+	if p.Wallet != nil {
+		add("wallet.url", p.Wallet.Url, "")
+	}
+	add("preInstallScript", p.PreInstallScript, "")
+	add("postInstallScript", p.PostInstallScript, "")
+	add("preUninstallScript", p.PreUninstallScript, "")
+	add("postUninstallScript", p.PostUninstallScript, "")
+	add("postInstallNotes", p.PostInstallNotes, "")
+	for idx, migration := range p.Migrations {
+		migrationField := fmt.Sprintf("migrations[%d]", idx)
+		add(migrationField+".script", migration.Script, "")
+		for argIdx, arg := range migration.Command {
+			add(fmt.Sprintf("%s.command[%d]", migrationField, argIdx), arg, "")
+		}
+	}
+	for idx, note := range p.Notes {
+		noteField := fmt.Sprintf("notes[%d]", idx)
+		addCondition(noteField+".condition", note.Condition)
+		add(noteField+".message", note.Message, "")
+	}
+	return ret
+}
+
+// containerTemplateVars returns the extra template vars for templates in a
+// docker install step
+func containerTemplateVars(containerName string) map[string]any {
+	if containerName == "" {
+		return nil
+	}
+	return map[string]any{
+		"Container": map[string]any{
+			"Name": containerName,
+		},
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRenderPackage(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgDir := filepath.Join(tmpDir, "foo")
+	if err := os.MkdirAll(pkgDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkgYaml := `name: foo
+version: 1.0.0
+options:
+  - name: bar
+    default: false
+installSteps:
+  - condition: .Package.Options.bar
+    docker:
+      containerName: foo
+      image: foo:{{ .Package.Version }}
+      env:
+        NETWORK: '{{ .Context.Network }}'
+        NAME: '{{ .Container.Name }}'
+      ports:
+        - '3001:3000'
+  - file:
+      filename: config
+      source: config.tmpl
+outputs:
+  - name: url
+    value: 'http://localhost:{{ index (index .Ports "foo") "3000" }}'
+postInstallNotes: '{{ fail "boom" }}'
+`
+	pkgFiles := map[string]string{
+		"foo-1.0.0.yaml": pkgYaml,
+		"config.tmpl":    "{{ .Package.ShortName }}",
+	}
+	for filename, content := range pkgFiles {
+		filePath := filepath.Join(pkgDir, filename)
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rendered, err := pm.RenderPackage(
+		pkgDir,
+		"",
+		"preview",
+		map[string]any{"bar": true},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !rendered.Simulated || rendered.Context != simulatedContextName {
+		t.Fatalf("did not get expected simulated context: %#v", rendered)
+	}
+	expected := map[string]string{
+		"installSteps[0].condition":          "true",
+		"installSteps[0].docker.image":       "foo:1.0.0",
+		"installSteps[0].docker.env.NAME":    "foo-1.0.0-simulated-foo",
+		"installSteps[0].docker.env.NETWORK": "preview",
+		"installSteps[0].docker.ports[0]":    "3001:3000",
+		"installSteps[1].file.filename":      "config",
+		"installSteps[1].file.source":        "foo",
+		"outputs[0].value":                   "http://localhost:3001",
+	}
+	got := make(map[string]string)
+	for _, tmpl := range rendered.Templates {
+		if tmpl.Field == "postInstallNotes" {
+			if tmpl.Error == nil {
+				t.Fatalf("did not get expected error rendering postInstallNotes")
+			}
+			continue
+		}
+		if tmpl.Error != nil {
+			t.Fatalf(
+				"unexpected error rendering %s: %s",
+				tmpl.Field,
+				tmpl.Error,
+			)
+		}
+		got[tmpl.Field] = tmpl.Value
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf(
+			"did not get expected rendered templates\n  got: %#v\n  expected: %#v",
+			got,
+			expected,
+		)
+	}
+	if !rendered.HasErrors() {
+		t.Fatalf("did not get expected errors")
+	}
+	// Unknown options and contexts should fail
+	_, err = pm.RenderPackage(
+		pkgDir,
+		"",
+		"preview",
+		map[string]any{"baz": true},
+	)
+	if err == nil {
+		t.Fatalf("did not get expected error for unknown option")
+	}
+	_, err = pm.RenderPackage(pkgDir, "missing", "", nil)
+	if err != ErrContextNotExist {
+		t.Fatalf("did not get expected error for unknown context: %v", err)
+	}
+}
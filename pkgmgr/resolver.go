@@ -24,42 +24,53 @@ import (
 
 type Resolver struct {
 	context              string
+	template             *Template
 	logger               *slog.Logger
 	installedPkgs        []InstalledPackage
-	availablePkgs        []Package
+	availablePkgs        packageIndex
 	installedConstraints map[string]version.Constraints
 }
 
 type ResolverInstallSet struct {
 	Install  Package
-	Options  map[string]bool
+	Options  map[string]any
 	Selected bool
 }
 
 type ResolverUpgradeSet struct {
 	Installed InstalledPackage
 	Upgrade   Package
-	Options   map[string]bool
+	Options   map[string]any
 }
 
 func NewResolver(
 	installedPkgs []InstalledPackage,
 	availablePkgs []Package,
 	context string,
+	template *Template,
 	logger *slog.Logger,
 ) (*Resolver, error) {
 	r := &Resolver{
 		context:              context,
+		template:             template,
 		logger:               logger,
 		installedPkgs:        installedPkgs[:],
-		availablePkgs:        availablePkgs[:],
+		availablePkgs:        newPackageIndex(availablePkgs),
 		installedConstraints: make(map[string]version.Constraints),
 	}
 	// Calculate package constraints from installed packages
 	for _, installedPkg := range installedPkgs {
 		// Add constraint for each explicit dependency
-		for _, dep := range installedPkg.Package.Dependencies {
+		deps, err := installedPkg.Package.dependencies(r.template, installedPkg.Options)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range deps {
 			depPkgName, depPkgVersionSpec, _ := r.splitPackage(dep)
+			// Dependencies without a version spec don't constrain the installed version
+			if depPkgVersionSpec == "" {
+				continue
+			}
 			tmpConstraints, err := version.NewConstraint(depPkgVersionSpec)
 			if err != nil {
 				return nil, err
@@ -81,52 +92,235 @@ func NewResolver(
 	return r, nil
 }
 
+// Install resolves the specified packages and their dependencies. The packages are resolved
+// jointly, so that a dependency shared by several of them is only installed once and satisfies the
+// version constraints from all of them. Requested packages that other requested packages depend on
+// are installed first
 func (r *Resolver) Install(pkgs ...string) ([]ResolverInstallSet, error) {
-	var ret []ResolverInstallSet
+	// Resolve the requested packages
+	selected := make([]ResolverInstallSet, 0, len(pkgs))
+	selectedIdx := make(map[string]int)
+	selectedSpecs := make(map[string][]string)
 	for _, pkg := range pkgs {
-		pkgName, pkgVersionSpec, pkgOpts := r.splitPackage(pkg)
-		if pkg, err := r.findInstalled(pkgName, ""); err != nil {
+		pkgName, pkgVersionSpec, _ := r.splitPackage(pkg)
+		if _, ok := selectedIdx[pkgName]; ok {
+			return nil, NewResolverDuplicatePackageError(pkgName)
+		}
+		installSet, err := r.resolveSelected(pkg, "")
+		if err != nil {
 			return nil, err
-		} else if !pkg.IsEmpty() {
-			return nil, NewResolverPackageAlreadyInstalledError(pkgName)
 		}
-		latestPkg, err := r.latestAvailablePackage(pkgName, pkgVersionSpec, nil)
+		selectedIdx[pkgName] = len(selected)
+		selected = append(selected, installSet)
+		if pkgVersionSpec != "" {
+			selectedSpecs[pkgName] = append(selectedSpecs[pkgName], pkgVersionSpec)
+		}
+	}
+	// Apply the version constraints and options from dependencies on other requested packages
+	selectedDeps := make(map[string][]string)
+	constrained := make(map[string]bool)
+	for _, installSet := range selected {
+		deps, err := installSet.Install.dependencies(r.template, installSet.Options)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range deps {
+			depName, depVersionSpec, depOpts := r.splitPackage(dep)
+			idx, ok := selectedIdx[depName]
+			if !ok {
+				continue
+			}
+			if depVersionSpec != "" {
+				selectedSpecs[depName] = append(selectedSpecs[depName], depVersionSpec)
+				constrained[depName] = true
+			}
+			if err := mergeDependencyOpts(selected[idx].Options, depOpts, depName); err != nil {
+				return nil, err
+			}
+			selectedDeps[installSet.Install.Name] = append(
+				selectedDeps[installSet.Install.Name],
+				depName,
+			)
+		}
+	}
+	for idx, installSet := range selected {
+		if !constrained[installSet.Install.Name] {
+			continue
+		}
+		combinedSpec := strings.Join(selectedSpecs[installSet.Install.Name], ", ")
+		latestPkg, err := r.latestAvailablePackage(installSet.Install.Name, combinedSpec, nil)
 		if err != nil {
 			return nil, err
 		}
 		if latestPkg.IsEmpty() {
-			return nil, NewResolverNoAvailablePackage(pkg)
+			return nil, NewResolverNoAvailablePackage(
+				installSet.Install.Name + " " + combinedSpec,
+			)
 		}
-		// Calculate dependencies
-		neededPkgs, err := r.getNeededDeps(latestPkg)
+		selected[idx].Install = latestPkg
+	}
+	// Combine the dependencies of the requested packages
+	var depNames []string
+	depSpecs := make(map[string][]string)
+	depOpts := make(map[string]map[string]any)
+	depDescs := make(map[string][]string)
+	for _, installSet := range selected {
+		deps, err := installSet.Install.dependencies(r.template, installSet.Options)
 		if err != nil {
 			return nil, err
 		}
-		ret = append(ret, neededPkgs...)
-		// Add selected package
-		ret = append(
-			ret,
-			ResolverInstallSet{
-				Install:  latestPkg,
-				Selected: true,
-				Options:  pkgOpts,
-			},
+		for _, dep := range deps {
+			depName, depVersionSpec, tmpDepOpts := r.splitPackage(dep)
+			if _, ok := selectedIdx[depName]; ok {
+				continue
+			}
+			if _, ok := depOpts[depName]; !ok {
+				depNames = append(depNames, depName)
+				depOpts[depName] = make(map[string]any)
+			}
+			if depVersionSpec != "" {
+				depSpecs[depName] = append(depSpecs[depName], depVersionSpec)
+			}
+			if err := mergeDependencyOpts(depOpts[depName], tmpDepOpts, depName); err != nil {
+				return nil, err
+			}
+			depDescs[depName] = append(depDescs[depName], dep)
+		}
+	}
+	var ret []ResolverInstallSet
+	for _, depName := range depNames {
+		installSet, needed, err := r.resolveDependency(
+			depName,
+			strings.Join(depSpecs[depName], ", "),
+			depOpts[depName],
+			strings.Join(depDescs[depName], ", "),
 		)
+		if err != nil {
+			return nil, err
+		}
+		if needed {
+			ret = append(ret, installSet)
+		}
+	}
+	// Add the requested packages, with any requested packages that they depend on first
+	added := make(map[string]bool)
+	var addSelected func(pkgName string)
+	addSelected = func(pkgName string) {
+		if added[pkgName] {
+			return
+		}
+		added[pkgName] = true
+		for _, depName := range selectedDeps[pkgName] {
+			addSelected(depName)
+		}
+		ret = append(ret, selected[selectedIdx[pkgName]])
+	}
+	for _, installSet := range selected {
+		addSelected(installSet.Install.Name)
 	}
 	return ret, nil
 }
 
+// mergeDependencyOpts adds the options from a dependency spec to the provided options, returning
+// an error if an option was already set to a different value
+func mergeDependencyOpts(opts map[string]any, depOpts map[string]any, depName string) error {
+	for k, v := range depOpts {
+		// Values are compared as strings, since they may not have been converted to the option
+		// type yet
+		if tmpVal, ok := opts[k]; ok && fmt.Sprint(tmpVal) != fmt.Sprint(v) {
+			return NewResolverDependencyOptionConflictError(depName, k)
+		}
+		opts[k] = v
+	}
+	return nil
+}
+
+// InstallInstance resolves an additional instance of a package with the specified instance name.
+// Any dependencies are resolved against the primary instances of installed packages
+func (r *Resolver) InstallInstance(
+	pkg string,
+	instance string,
+) ([]ResolverInstallSet, error) {
+	return r.install(pkg, instance)
+}
+
+func (r *Resolver) install(
+	pkg string,
+	instance string,
+) ([]ResolverInstallSet, error) {
+	var ret []ResolverInstallSet
+	installSet, err := r.resolveSelected(pkg, instance)
+	if err != nil {
+		return nil, err
+	}
+	// Calculate dependencies
+	neededPkgs, err := r.getNeededDeps(installSet.Install, installSet.Options)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, neededPkgs...)
+	// Add selected package
+	ret = append(ret, installSet)
+	return ret, nil
+}
+
+// resolveSelected resolves a requested package, without its dependencies
+func (r *Resolver) resolveSelected(
+	pkg string,
+	instance string,
+) (ResolverInstallSet, error) {
+	pkgName, pkgVersionSpec, pkgOpts := r.splitPackage(pkg)
+	instanceName := packageInstanceName(pkgName, instance)
+	if installedPkg := r.findInstalledInstance(instanceName); !installedPkg.IsEmpty() {
+		// The instance name of another package is the same, such as 'cardano-node --as relay'
+		// and a package named 'cardano-node-relay'
+		if installedPkg.Package.Name != pkgName {
+			return ResolverInstallSet{}, NewInstanceNameConflictError(instanceName)
+		}
+		return ResolverInstallSet{}, NewResolverPackageAlreadyInstalledError(instanceName)
+	}
+	// An additional instance can't use the name of another available package, since they
+	// would share container names, data dirs, and env vars if both were installed
+	if instance != "" {
+		availablePkgs, err := r.findAvailable(instanceName, "", nil)
+		if err != nil {
+			return ResolverInstallSet{}, err
+		}
+		if len(availablePkgs) > 0 {
+			return ResolverInstallSet{}, NewInstanceNameConflictError(instanceName)
+		}
+	}
+	latestPkg, err := r.latestAvailablePackage(pkgName, pkgVersionSpec, nil)
+	if err != nil {
+		return ResolverInstallSet{}, err
+	}
+	if latestPkg.IsEmpty() {
+		return ResolverInstallSet{}, NewResolverNoAvailablePackage(pkg)
+	}
+	latestPkg.instance = instance
+	return ResolverInstallSet{
+		Install:  latestPkg,
+		Selected: true,
+		Options:  pkgOpts,
+	}, nil
+}
+
+// Upgrade resolves upgrades for the specified installed packages and any dependencies that need
+// upgrading. A package is only upgraded once when it's needed by several of the packages
 func (r *Resolver) Upgrade(pkgs ...string) ([]ResolverUpgradeSet, error) {
 	var ret []ResolverUpgradeSet
+	planned := make(map[string]bool)
 	for _, pkg := range pkgs {
 		pkgName, pkgVersionSpec, pkgOpts := r.splitPackage(pkg)
-		installedPkg, err := r.findInstalled(pkgName, "")
-		if err != nil {
-			return nil, err
-		} else if installedPkg.IsEmpty() {
+		installedPkg := r.findInstalledInstance(pkgName)
+		if installedPkg.IsEmpty() {
 			return nil, NewPackageNotInstalledError(pkgName, r.context)
 		}
-		latestPkg, err := r.latestAvailablePackage(pkgName, pkgVersionSpec, nil)
+		latestPkg, err := r.latestAvailablePackage(
+			installedPkg.Package.Name,
+			pkgVersionSpec,
+			nil,
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -134,6 +328,27 @@ func (r *Resolver) Upgrade(pkgs ...string) ([]ResolverUpgradeSet, error) {
 			latestPkg.Version == installedPkg.Package.Version {
 			return nil, NewNoPackageAvailableForUpgradeError(pkg)
 		}
+		// Moving to an older version needs the checks done for a downgrade
+		if versionNewer(installedPkg.Package.Version, latestPkg.Version) {
+			return nil, NewUpgradeToOlderVersionError(
+				installedPkg.InstanceName(),
+				installedPkg.Package.Version,
+				latestPkg.Version,
+			)
+		}
+		latestPkg.instance = installedPkg.Instance
+		latestPkg.configProfile = installedPkg.ConfigProfile
+		if planned[latestPkg.instanceName()] {
+			continue
+		}
+		planned[latestPkg.instanceName()] = true
+		upgradeOpts := make(map[string]any)
+		for k, v := range installedPkg.Options {
+			upgradeOpts[k] = v
+		}
+		for k, v := range pkgOpts {
+			upgradeOpts[k] = v
+		}
 		ret = append(
 			ret,
 			ResolverUpgradeSet{
@@ -143,11 +358,15 @@ func (r *Resolver) Upgrade(pkgs ...string) ([]ResolverUpgradeSet, error) {
 			},
 		)
 		// Calculate dependencies
-		neededPkgs, err := r.getNeededDeps(latestPkg)
+		neededPkgs, err := r.getNeededDeps(latestPkg, upgradeOpts)
 		if err != nil {
 			return nil, err
 		}
 		for _, neededPkg := range neededPkgs {
+			if planned[neededPkg.Install.Name] {
+				continue
+			}
+			planned[neededPkg.Install.Name] = true
 			tmpInstalled, err := r.findInstalled(neededPkg.Install.Name, "")
 			if err != nil {
 				return nil, err
@@ -165,95 +384,261 @@ func (r *Resolver) Upgrade(pkgs ...string) ([]ResolverUpgradeSet, error) {
 	return ret, nil
 }
 
+// Downgrade resolves moving an installed package to an older available version, along with any
+// dependencies of the older version that aren't installed yet. It fails if an installed package
+// that depends on the package isn't satisfied by the older version
+func (r *Resolver) Downgrade(pkg string, targetVersion string) ([]ResolverUpgradeSet, error) {
+	installedPkg := r.findInstalledInstance(pkg)
+	if installedPkg.IsEmpty() {
+		return nil, NewPackageNotInstalledError(pkg, r.context)
+	}
+	// The constraints of installed packages aren't applied, so that dependents that would break
+	// are reported below
+	availablePkgs, err := r.findAvailable(
+		installedPkg.Package.Name,
+		"= "+targetVersion,
+		version.Constraints{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(availablePkgs) == 0 {
+		return nil, NewResolverNoAvailablePackage(
+			fmt.Sprintf("%s = %s", installedPkg.Package.Name, targetVersion),
+		)
+	}
+	targetPkg := availablePkgs[0]
+	if !versionNewer(installedPkg.Package.Version, targetPkg.Version) {
+		return nil, NewPackageNotOlderVersionError(
+			pkg,
+			installedPkg.Package.Version,
+			targetPkg.Version,
+		)
+	}
+	targetPkg.instance = installedPkg.Instance
+	targetPkg.configProfile = installedPkg.ConfigProfile
+	// Check that the packages depending on the installed version are satisfied by the older one
+	dependents, err := r.Dependents(installedPkg)
+	if err != nil {
+		return nil, err
+	}
+	targetInstalledPkg := installedPkg
+	targetInstalledPkg.Package = targetPkg
+	targetDependents, err := r.Dependents(targetInstalledPkg)
+	if err != nil {
+		return nil, err
+	}
+	satisfied := make(map[string]bool)
+	for _, dependent := range targetDependents {
+		satisfied[dependent.InstanceName()] = true
+	}
+	for _, dependent := range dependents {
+		if !satisfied[dependent.InstanceName()] {
+			return nil, NewPackageDowngradeWouldBreakDepsError(
+				installedPkg.Package.Name,
+				targetPkg.Version,
+				dependent.Package.Name,
+				dependent.Package.Version,
+			)
+		}
+	}
+	// Install any dependencies of the older version that aren't installed first
+	var ret []ResolverUpgradeSet
+	neededPkgs, err := r.getNeededDeps(targetPkg, installedPkg.Options)
+	if err != nil {
+		return nil, err
+	}
+	for _, neededPkg := range neededPkgs {
+		ret = append(
+			ret,
+			ResolverUpgradeSet{
+				Upgrade: neededPkg.Install,
+				Options: neededPkg.Options,
+			},
+		)
+	}
+	ret = append(
+		ret,
+		ResolverUpgradeSet{
+			Installed: installedPkg,
+			Upgrade:   targetPkg,
+		},
+	)
+	return ret, nil
+}
+
+// Uninstall checks that uninstalling the specified packages won't break the dependencies of other
+// installed packages. Packages being uninstalled together don't need to satisfy each other
 func (r *Resolver) Uninstall(pkgs ...InstalledPackage) error {
+	uninstalling := make(map[string]bool)
+	removing := make(map[string]bool)
 	for _, pkg := range pkgs {
-		pkgVersion, err := version.NewVersion(pkg.Package.Version)
+		uninstalling[pkg.InstanceName()] = true
+		removing[pkg.Spec()] = true
+	}
+	for _, pkg := range pkgs {
+		// The package stays installed when another tracked version of it is kept
+		if otherVersionInstalled(r.installedPkgs, pkg, removing) {
+			continue
+		}
+		dependents, err := r.Dependents(pkg)
 		if err != nil {
 			return err
 		}
-		for _, installedPkg := range r.installedPkgs {
-			for _, dep := range installedPkg.Package.Dependencies {
-				depPkgName, depPkgVersionSpec, _ := r.splitPackage(dep)
-				// Skip installed package if it doesn't match dep package name
-				if pkg.Package.Name != depPkgName {
-					continue
-				}
-				// Skip installed packages that don't match the specified dep version constraint
-				if depPkgVersionSpec != "" {
-					constraints, err := version.NewConstraint(depPkgVersionSpec)
-					if err != nil {
-						return err
-					}
-					if !constraints.Check(pkgVersion) {
-						continue
-					}
-				}
-				return NewPackageUninstallWouldBreakDepsError(
-					pkg.Package.Name,
-					pkg.Package.Version,
-					installedPkg.Package.Name,
-					installedPkg.Package.Version,
-				)
+		for _, dependent := range dependents {
+			if uninstalling[dependent.InstanceName()] {
+				continue
 			}
+			return NewPackageUninstallWouldBreakDepsError(
+				pkg.Package.Name,
+				pkg.Package.Version,
+				dependent.Package.Name,
+				dependent.Package.Version,
+			)
 		}
 	}
 	return nil
 }
 
-func (r *Resolver) getNeededDeps(pkg Package) ([]ResolverInstallSet, error) {
-	// NOTE: this function is very naive and only works for a single level of dependencies
-	var ret []ResolverInstallSet
-	for _, dep := range pkg.Dependencies {
-		depPkgName, depPkgVersionSpec, depPkgOpts := r.splitPackage(dep)
-		// Check if we already have an installed package that satisfies the dependency
-		if pkg, err := r.findInstalled(depPkgName, depPkgVersionSpec); err != nil {
-			return nil, err
-		} else if !pkg.IsEmpty() {
+// Dependents returns the installed packages that depend on the specified installed package
+func (r *Resolver) Dependents(pkg InstalledPackage) ([]InstalledPackage, error) {
+	// Additional instances of a package are never used to satisfy dependencies
+	if pkg.Instance != "" {
+		return nil, nil
+	}
+	pkgVersion, err := version.NewVersion(pkg.Package.Version)
+	if err != nil {
+		return nil, err
+	}
+	var ret []InstalledPackage
+	for _, installedPkg := range r.installedPkgs {
+		if installedPkg.InstanceName() == pkg.InstanceName() {
 			continue
 		}
-		// Check if we already have any installed version of the package
-		if pkg, err := r.findInstalled(depPkgName, depPkgVersionSpec); err != nil {
+		deps, err := installedPkg.Package.dependencies(r.template, installedPkg.Options)
+		if err != nil {
 			return nil, err
-		} else if !pkg.IsEmpty() {
-			return nil, NewResolverInstalledPackageNoMatchVersionSpecError(pkg.Package.Name, pkg.Package.Version, dep)
 		}
-		availablePkgs, err := r.findAvailable(
+		for _, dep := range deps {
+			depPkgName, depPkgVersionSpec, _ := r.splitPackage(dep)
+			// Skip installed package if it doesn't match dep package name
+			if pkg.Package.Name != depPkgName {
+				continue
+			}
+			// Skip installed packages that don't match the specified dep version constraint
+			if depPkgVersionSpec != "" {
+				constraints, err := version.NewConstraint(depPkgVersionSpec)
+				if err != nil {
+					return nil, err
+				}
+				if !constraints.Check(pkgVersion) {
+					continue
+				}
+			}
+			ret = append(ret, installedPkg)
+			break
+		}
+	}
+	return ret, nil
+}
+
+func (r *Resolver) getNeededDeps(
+	pkg Package,
+	opts map[string]any,
+) ([]ResolverInstallSet, error) {
+	// NOTE: this function is very naive and only works for a single level of dependencies
+	var ret []ResolverInstallSet
+	deps, err := pkg.dependencies(r.template, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range deps {
+		depPkgName, depPkgVersionSpec, depPkgOpts := r.splitPackage(dep)
+		installSet, needed, err := r.resolveDependency(
 			depPkgName,
 			depPkgVersionSpec,
-			nil,
+			depPkgOpts,
+			dep,
 		)
 		if err != nil {
 			return nil, err
 		}
-		if len(availablePkgs) == 0 {
-			return nil, NewResolverNoAvailablePackageDependencyError(dep)
-		}
-		latestPkg, err := r.latestPackage(availablePkgs, nil)
-		if err != nil {
-			return nil, err
+		if needed {
+			ret = append(ret, installSet)
 		}
-		ret = append(
-			ret,
-			ResolverInstallSet{
-				Install: latestPkg,
-				Options: depPkgOpts,
-			},
-		)
 	}
 	return ret, nil
 }
 
-func (r *Resolver) splitPackage(pkg string) (string, string, map[string]bool) {
+// resolveDependency returns the package to install for a dependency, if it's not already
+// satisfied by an installed package. The dependency spec is only used in errors
+func (r *Resolver) resolveDependency(
+	depPkgName string,
+	depPkgVersionSpec string,
+	depPkgOpts map[string]any,
+	dep string,
+) (ResolverInstallSet, bool, error) {
+	// Check if we already have an installed package that satisfies the dependency
+	if pkg, err := r.findInstalled(depPkgName, depPkgVersionSpec); err != nil {
+		return ResolverInstallSet{}, false, err
+	} else if !pkg.IsEmpty() {
+		return ResolverInstallSet{}, false, nil
+	}
+	// Check if an additional instance of another package uses the same name
+	if installedPkg := r.findInstalledInstance(depPkgName); installedPkg.Instance != "" {
+		return ResolverInstallSet{}, false, NewInstanceNameConflictError(depPkgName)
+	}
+	// Check if we already have any installed version of the package
+	if pkg, err := r.findInstalled(depPkgName, depPkgVersionSpec); err != nil {
+		return ResolverInstallSet{}, false, err
+	} else if !pkg.IsEmpty() {
+		return ResolverInstallSet{}, false, NewResolverInstalledPackageNoMatchVersionSpecError(
+			pkg.Package.Name,
+			pkg.Package.Version,
+			dep,
+		)
+	}
+	availablePkgs, err := r.findAvailable(
+		depPkgName,
+		depPkgVersionSpec,
+		nil,
+	)
+	if err != nil {
+		return ResolverInstallSet{}, false, err
+	}
+	if len(availablePkgs) == 0 {
+		return ResolverInstallSet{}, false, NewResolverNoAvailablePackageDependencyError(dep)
+	}
+	latestPkg, err := r.latestPackage(availablePkgs, nil)
+	if err != nil {
+		return ResolverInstallSet{}, false, err
+	}
+	return ResolverInstallSet{
+		Install: latestPkg,
+		Options: depPkgOpts,
+	}, true, nil
+}
+
+func (r *Resolver) splitPackage(pkg string) (string, string, map[string]any) {
 	var pkgName, pkgVersionSpec string
-	pkgOpts := make(map[string]bool)
+	pkgOpts := make(map[string]any)
 	// Extract any package option flags
 	optsOpenIdx := strings.Index(pkg, `[`)
 	optsCloseIdx := strings.Index(pkg, `]`)
+	// The version spec follows the options, which may contain "="
+	versionSpecStart := 0
 	if optsOpenIdx > 0 && optsCloseIdx > optsOpenIdx {
+		versionSpecStart = optsCloseIdx + 1
 		pkgName = pkg[:optsOpenIdx]
 		tmpOpts := pkg[optsOpenIdx+1 : optsCloseIdx]
 		tmpFlags := strings.Split(tmpOpts, `,`)
 		for _, tmpFlag := range tmpFlags {
+			// Options with a value, such as pruning=conservative, are converted to the option
+			// type when the package is resolved
+			if optName, optVal, ok := strings.Cut(tmpFlag, `=`); ok {
+				pkgOpts[optName] = optVal
+				continue
+			}
 			flagVal := true
 			if strings.HasPrefix(tmpFlag, `-`) {
 				flagVal = false
@@ -263,7 +648,10 @@ func (r *Resolver) splitPackage(pkg string) (string, string, map[string]bool) {
 		}
 	}
 	// Extract version spec
-	versionSpecIdx := strings.IndexAny(pkg, ` <>=~!`)
+	versionSpecIdx := strings.IndexAny(pkg[versionSpecStart:], ` <>=~!`)
+	if versionSpecIdx >= 0 {
+		versionSpecIdx += versionSpecStart
+	}
 	if versionSpecIdx > 0 {
 		if pkgName == "" {
 			pkgName = pkg[:versionSpecIdx]
@@ -293,6 +681,10 @@ func (r *Resolver) findInstalled(
 		if installedPkg.Package.Name != pkgName {
 			continue
 		}
+		// Only the primary instance of a package is considered
+		if installedPkg.Instance != "" {
+			continue
+		}
 		if pkgVersionSpec != "" {
 			installedPkgVer, err := version.NewVersion(
 				installedPkg.Package.Version,
@@ -309,6 +701,17 @@ func (r *Resolver) findInstalled(
 	return InstalledPackage{}, nil
 }
 
+// findInstalledInstance returns the installed package with the specified instance name. This is
+// the package name for the primary instance of a package
+func (r *Resolver) findInstalledInstance(instanceName string) InstalledPackage {
+	for _, installedPkg := range r.installedPkgs {
+		if installedPkg.InstanceName() == instanceName {
+			return installedPkg
+		}
+	}
+	return InstalledPackage{}
+}
+
 func (r *Resolver) findAvailable(
 	pkgName string,
 	pkgVersionSpec string,
@@ -339,10 +742,7 @@ func (r *Resolver) findAvailable(
 		)
 	}
 	var ret []Package
-	for _, availablePkg := range r.availablePkgs {
-		if availablePkg.Name != pkgName {
-			continue
-		}
+	for _, availablePkg := range r.availablePkgs[pkgName] {
 		if constraints != nil {
 			availablePkgVer, err := version.NewVersion(availablePkg.Version)
 			if err != nil {
@@ -15,8 +15,13 @@
 package pkgmgr
 
 import (
+	"fmt"
+	"io"
+	"log/slog"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSplitPackage(t *testing.T) {
@@ -24,17 +29,27 @@ func TestSplitPackage(t *testing.T) {
 		Package     string
 		Name        string
 		VersionSpec string
-		Options     map[string]bool
+		Options     map[string]any
 	}{
 		{
 			Package:     "test-packageB[foo,-bar] >= 1.2.3",
 			Name:        "test-packageB",
 			VersionSpec: ">= 1.2.3",
-			Options: map[string]bool{
+			Options: map[string]any{
 				"foo": true,
 				"bar": false,
 			},
 		},
+		{
+			Package:     "test-packageB[pruning=conservative,port=6000,-bar]>=1.2.3",
+			Name:        "test-packageB",
+			VersionSpec: ">=1.2.3",
+			Options: map[string]any{
+				"pruning": "conservative",
+				"port":    "6000",
+				"bar":     false,
+			},
+		},
 		{
 			Package:     "test-package<1.2.4",
 			Name:        "test-package",
@@ -79,3 +94,464 @@ func TestSplitPackage(t *testing.T) {
 		}
 	}
 }
+
+func TestResolverInstallInstance(t *testing.T) {
+	availablePkgs := []Package{
+		{Name: "node", Version: "1.0.0"},
+		{Name: "node", Version: "1.1.0"},
+		{Name: "tool", Version: "1.0.0", Dependencies: []PackageDependency{{Name: "node"}}},
+	}
+	installedPkgs := []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0", instance: "relay2"},
+			Instance:      "relay2",
+			InstalledTime: time.Now(),
+		},
+	}
+	resolver, err := NewResolver(
+		installedPkgs,
+		availablePkgs,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The instance name is already in use
+	if _, err := resolver.InstallInstance("node", "relay2"); err == nil {
+		t.Fatalf("did not get expected error installing duplicate instance")
+	}
+	// Another instance is allowed
+	installSets, err := resolver.InstallInstance("node", "relay3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(installSets) != 1 {
+		t.Fatalf("did not get expected install sets: %#v", installSets)
+	}
+	if installSets[0].Install.instanceName() != "node-relay3" {
+		t.Fatalf(
+			"did not get expected instance name: got %q, expected %q",
+			installSets[0].Install.instanceName(),
+			"node-relay3",
+		)
+	}
+	// An additional instance doesn't satisfy dependencies
+	installSets, err = resolver.Install("tool")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(installSets) != 2 ||
+		installSets[0].Install.Name != "node" ||
+		installSets[0].Install.instance != "" {
+		t.Fatalf("did not get expected install sets: %#v", installSets)
+	}
+	// The instance name can't be the same as another package name
+	conflictResolver, err := NewResolver(
+		installedPkgs,
+		append(
+			availablePkgs,
+			Package{Name: "node-relay2", Version: "1.0.0"},
+			Package{Name: "node-relay4", Version: "1.0.0"},
+			Package{
+				Name:         "other",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node-relay2"}},
+			},
+		),
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, testFunc := range []func() ([]ResolverInstallSet, error){
+		func() ([]ResolverInstallSet, error) { return conflictResolver.Install("node-relay2") },
+		func() ([]ResolverInstallSet, error) { return conflictResolver.Install("other") },
+		func() ([]ResolverInstallSet, error) {
+			return conflictResolver.InstallInstance("node", "relay4")
+		},
+	} {
+		if _, err := testFunc(); err == nil ||
+			!strings.Contains(err.Error(), "additional instance") {
+			t.Fatalf("did not get expected instance name conflict error: %v", err)
+		}
+	}
+	// The instance can be upgraded by its instance name
+	upgradeSets, err := resolver.Upgrade("node-relay2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(upgradeSets) != 1 ||
+		upgradeSets[0].Upgrade.Version != "1.1.0" ||
+		upgradeSets[0].Upgrade.instance != "relay2" {
+		t.Fatalf("did not get expected upgrade sets: %#v", upgradeSets)
+	}
+}
+
+func TestResolverInstallMetaPackage(t *testing.T) {
+	stackPkg := Package{
+		Name:         "stack",
+		Version:      "1.0.0",
+		Dependencies: []PackageDependency{{Name: "node"}, {Name: "ogmios"}},
+		Options: []PackageOption{
+			{Name: "kupo", Default: true, Dependencies: []PackageDependency{{Name: "kupo"}}},
+			{Name: "db-sync", Dependencies: []PackageDependency{{Name: "db-sync"}}},
+		},
+	}
+	availablePkgs := []Package{
+		{Name: "node", Version: "1.0.0"},
+		{Name: "ogmios", Version: "1.0.0"},
+		{Name: "kupo", Version: "1.0.0"},
+		{Name: "db-sync", Version: "1.0.0"},
+		stackPkg,
+	}
+	installedPkgs := []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			InstalledTime: time.Now(),
+		},
+	}
+	resolver, err := NewResolver(
+		installedPkgs,
+		availablePkgs,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !stackPkg.IsMetaPackage() {
+		t.Fatalf("package was not detected as a meta-package")
+	}
+	testDefs := []struct {
+		pkg      string
+		expected []string
+	}{
+		// Installed members are skipped, and optional members use their default
+		{"stack", []string{"ogmios", "kupo", "stack"}},
+		{"stack[-kupo,db-sync]", []string{"ogmios", "db-sync", "stack"}},
+	}
+	for _, testDef := range testDefs {
+		installSets, err := resolver.Install(testDef.pkg)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var got []string
+		for _, installSet := range installSets {
+			got = append(got, installSet.Install.Name)
+		}
+		if !reflect.DeepEqual(got, testDef.expected) {
+			t.Fatalf(
+				"did not get expected packages for %q: got %v, expected %v",
+				testDef.pkg,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+	// Members selected with an option can't be uninstalled while the meta-package is installed
+	installedPkgs = append(
+		installedPkgs,
+		InstalledPackage{
+			Package: Package{Name: "db-sync", Version: "1.0.0"},
+		},
+		InstalledPackage{
+			Package: Package{Name: "kupo", Version: "1.0.0"},
+		},
+		InstalledPackage{
+			Package: stackPkg,
+			Options: map[string]any{"kupo": false, "db-sync": true},
+		},
+	)
+	resolver, err = NewResolver(
+		installedPkgs,
+		availablePkgs,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := resolver.Uninstall(installedPkgs[1]); err == nil {
+		t.Fatalf("did not get expected error uninstalling selected member")
+	}
+	if err := resolver.Uninstall(installedPkgs[2]); err != nil {
+		t.Fatalf("unexpected error uninstalling unselected member: %s", err)
+	}
+}
+
+func TestResolverInstallConditionalDependencies(t *testing.T) {
+	walletPkg := Package{
+		Name:    "wallet",
+		Version: "1.0.0",
+		Dependencies: []PackageDependency{
+			{Name: "node"},
+			{
+				Name:      "mithril-client",
+				Condition: `or .Package.Options.mithril (eq .Context.Network "mainnet")`,
+			},
+		},
+		Options: []PackageOption{
+			{Name: "mithril"},
+		},
+	}
+	availablePkgs := []Package{
+		{Name: "node", Version: "1.0.0"},
+		{Name: "mithril-client", Version: "1.0.0"},
+		walletPkg,
+	}
+	testDefs := []struct {
+		pkg      string
+		network  string
+		expected []string
+	}{
+		{"wallet", "preview", []string{"node", "wallet"}},
+		{"wallet[mithril]", "preview", []string{"node", "mithril-client", "wallet"}},
+		{"wallet", "mainnet", []string{"node", "mithril-client", "wallet"}},
+	}
+	for _, testDef := range testDefs {
+		tmpl := NewTemplate(
+			map[string]any{
+				"Context": map[string]any{
+					"Network": testDef.network,
+				},
+			},
+		)
+		resolver, err := NewResolver(
+			nil,
+			availablePkgs,
+			"default",
+			tmpl,
+			slog.New(slog.NewTextHandler(io.Discard, nil)),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		installSets, err := resolver.Install(testDef.pkg)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var got []string
+		for _, installSet := range installSets {
+			got = append(got, installSet.Install.Name)
+		}
+		if !reflect.DeepEqual(got, testDef.expected) {
+			t.Fatalf(
+				"did not get expected packages for %q on %s: got %v, expected %v",
+				testDef.pkg,
+				testDef.network,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+	// Invalid conditions are reported rather than skipping the dependency
+	badPkg := Package{
+		Name:         "bad",
+		Version:      "1.0.0",
+		Dependencies: []PackageDependency{{Name: "node", Condition: "eq .Foo"}},
+	}
+	resolver, err := NewResolver(
+		nil,
+		append(availablePkgs, badPkg),
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := resolver.Install("bad"); err == nil {
+		t.Fatalf("did not get expected error for invalid dependency condition")
+	}
+}
+
+func TestResolverInstallMultiple(t *testing.T) {
+	availablePkgs := []Package{
+		{Name: "node", Version: "1.0.0"},
+		{Name: "node", Version: "1.1.0"},
+		{Name: "node", Version: "2.0.0"},
+		{
+			Name:         "ogmios",
+			Version:      "1.0.0",
+			Dependencies: []PackageDependency{{Name: "node >= 1.0.0"}},
+		},
+		{
+			Name:         "kupo",
+			Version:      "1.0.0",
+			Dependencies: []PackageDependency{{Name: "node < 2.0.0"}},
+		},
+		{
+			Name:         "wallet",
+			Version:      "1.0.0",
+			Dependencies: []PackageDependency{{Name: "ogmios"}, {Name: "node[fast]"}},
+		},
+		{
+			Name:         "slow-wallet",
+			Version:      "1.0.0",
+			Dependencies: []PackageDependency{{Name: "node[-fast]"}},
+		},
+	}
+	resolver, err := NewResolver(
+		nil,
+		availablePkgs,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testDefs := []struct {
+		pkgs     []string
+		expected []string
+	}{
+		// Shared dependencies are installed once, with a version that satisfies all packages
+		{[]string{"ogmios", "kupo"}, []string{"node = 1.1.0", "ogmios = 1.0.0", "kupo = 1.0.0"}},
+		// Requested packages that other requested packages depend on are installed first, and
+		// the dependency constraints apply to them
+		{[]string{"kupo", "node"}, []string{"node = 1.1.0", "kupo = 1.0.0"}},
+		{[]string{"wallet", "ogmios"}, []string{"node = 2.0.0", "ogmios = 1.0.0", "wallet = 1.0.0"}},
+	}
+	for _, testDef := range testDefs {
+		installSets, err := resolver.Install(testDef.pkgs...)
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %s", testDef.pkgs, err)
+		}
+		var got []string
+		for _, installSet := range installSets {
+			got = append(
+				got,
+				fmt.Sprintf("%s = %s", installSet.Install.Name, installSet.Install.Version),
+			)
+		}
+		if !reflect.DeepEqual(got, testDef.expected) {
+			t.Fatalf(
+				"did not get expected packages for %v: got %v, expected %v",
+				testDef.pkgs,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+	// Options from dependencies are merged into requested packages
+	installSets, err := resolver.Install("wallet", "node")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, installSet := range installSets {
+		if installSet.Install.Name == "node" && installSet.Options["fast"] != true {
+			t.Fatalf("did not get expected options for dependency: %#v", installSet.Options)
+		}
+	}
+	// Errors for conflicting requirements
+	errorDefs := [][]string{
+		{"node", "node"},
+		{"kupo", "node >= 2.0.0"},
+		{"wallet", "slow-wallet"},
+	}
+	for _, pkgs := range errorDefs {
+		if _, err := resolver.Install(pkgs...); err == nil {
+			t.Fatalf("did not get expected error for %v", pkgs)
+		}
+	}
+}
+
+func TestResolverUninstallMultiple(t *testing.T) {
+	installedPkgs := []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "ogmios",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node"}},
+			},
+			InstalledTime: time.Now(),
+		},
+	}
+	resolver, err := NewResolver(
+		installedPkgs,
+		nil,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := resolver.Uninstall(installedPkgs[0]); err == nil {
+		t.Fatalf("did not get expected error uninstalling a dependency")
+	}
+	// A package can be uninstalled along with the packages that depend on it
+	if err := resolver.Uninstall(installedPkgs...); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestResolverDowngrade(t *testing.T) {
+	installedPkgs := []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.2.0"},
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "ogmios",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node >= 1.1.0"}},
+			},
+			InstalledTime: time.Now(),
+		},
+	}
+	availablePkgs := []Package{
+		{Name: "node", Version: "1.0.0"},
+		{
+			Name:         "node",
+			Version:      "1.1.0",
+			Dependencies: []PackageDependency{{Name: "mithril"}},
+		},
+		{Name: "node", Version: "1.2.0"},
+		{Name: "mithril", Version: "1.0.0"},
+	}
+	resolver, err := NewResolver(
+		installedPkgs,
+		availablePkgs,
+		"default",
+		nil,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	downgradeSets, err := resolver.Downgrade("node", "1.1.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// New dependencies of the older version are installed first
+	if len(downgradeSets) != 2 ||
+		downgradeSets[0].Upgrade.Name != "mithril" ||
+		!downgradeSets[0].Installed.IsEmpty() ||
+		downgradeSets[1].Upgrade.Version != "1.1.0" ||
+		downgradeSets[1].Installed.Package.Version != "1.2.0" {
+		t.Fatalf("did not get expected downgrade sets: %#v", downgradeSets)
+	}
+	// Errors for versions that aren't older, aren't available, or would break dependents
+	for _, targetVersion := range []string{"1.2.0", "1.3.0", "1.0.0"} {
+		if _, err := resolver.Downgrade("node", targetVersion); err == nil {
+			t.Fatalf("did not get expected error for downgrade to %s", targetVersion)
+		}
+	}
+	// Upgrades don't move to older versions
+	if _, err := resolver.Upgrade("node = 1.1.0"); err == nil ||
+		!strings.Contains(err.Error(), "downgrade") {
+		t.Fatalf("did not get expected error for upgrade to older version: %v", err)
+	}
+}
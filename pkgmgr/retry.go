@@ -0,0 +1,147 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	defaultDockerRetries      = 3
+	defaultDockerRetryBackoff = 2 * time.Second
+)
+
+// RetryConfig controls retrying operations that fail with transient errors, such as timeouts,
+// dropped connections and an unavailable Docker engine
+type RetryConfig struct {
+	// Retries is the number of times to retry a failed operation
+	Retries int
+	// Backoff is the initial delay between retries, which doubles on each attempt
+	Backoff time.Duration
+}
+
+// transientErrorMessages are substrings of error messages for transient failures that aren't
+// available as typed errors, such as those reported in the Docker image pull progress stream
+var transientErrorMessages = []string{
+	"i/o timeout",
+	"tls handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"unexpected eof",
+	"timeout exceeded while awaiting headers",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"toomanyrequests",
+}
+
+// retryOperation runs the operation, retrying with exponential backoff while it fails with a
+// transient error. Other errors are returned immediately. If all attempts fail, the returned
+// error includes the error from each attempt
+func retryOperation(
+	ctx context.Context,
+	logger *slog.Logger,
+	retryCfg RetryConfig,
+	desc string,
+	op func() error,
+) error {
+	retries := max(retryCfg.Retries, 0)
+	backoff := retryCfg.Backoff
+	if backoff == 0 {
+		backoff = defaultDockerRetryBackoff
+	}
+	var errs []error
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if !isTransientError(err) || ctx.Err() != nil {
+			return err
+		}
+		errs = append(errs, err)
+		if attempt >= retries {
+			break
+		}
+		logger.Warn(
+			fmt.Sprintf(
+				"%s failed, retrying in %s: %s",
+				desc,
+				backoff,
+				err,
+			),
+		)
+		// Wait for the backoff, giving up early if the operation is cancelled
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return NewRetriesExhaustedError(desc, errs)
+}
+
+// isTransientError returns whether an error is likely to be resolved by retrying the operation
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// The Docker engine is unavailable or timed out. Other server-side failures, such as a host
+	// port that's already allocated, won't be resolved by retrying
+	if errdefs.IsUnavailable(err) || errdefs.IsDeadline(err) {
+		return true
+	}
+	errMsg := strings.ToLower(err.Error())
+	for _, msg := range transientErrorMessages {
+		if strings.Contains(errMsg, msg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+)
+
+func TestRetryOperation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	retryCfg := RetryConfig{Retries: 2, Backoff: time.Millisecond}
+	// Transient errors are retried until the operation succeeds
+	var attempts int
+	err := retryOperation(
+		context.Background(),
+		logger,
+		retryCfg,
+		"test operation",
+		func() error {
+			attempts++
+			if attempts < 3 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("did not get expected attempts: got %d, expected %d", attempts, 3)
+	}
+	// Errors from all attempts are reported once retries are exhausted
+	attempts = 0
+	err = retryOperation(
+		context.Background(),
+		logger,
+		retryCfg,
+		"test operation",
+		func() error {
+			attempts++
+			return fmt.Errorf("attempt %d: %w", attempts, syscall.ECONNRESET)
+		},
+	)
+	if err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	if attempts != 3 {
+		t.Fatalf("did not get expected attempts: got %d, expected %d", attempts, 3)
+	}
+	if !errors.Is(err, syscall.ECONNRESET) ||
+		!strings.HasPrefix(err.Error(), "test operation failed after 3 attempts") {
+		t.Fatalf("did not get expected error: %s", err)
+	}
+	// Other errors are returned immediately
+	attempts = 0
+	testErr := errors.New("no such image")
+	err = retryOperation(
+		context.Background(),
+		logger,
+		retryCfg,
+		"test operation",
+		func() error {
+			attempts++
+			return testErr
+		},
+	)
+	if err != testErr || attempts != 1 {
+		t.Fatalf("did not get expected error after %d attempts: %v", attempts, err)
+	}
+	// Cancellation stops retries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = retryOperation(
+		ctx,
+		logger,
+		RetryConfig{Retries: 2, Backoff: time.Hour},
+		"test operation",
+		func() error {
+			return io.EOF
+		},
+	)
+	if err != io.EOF {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	testDefs := []struct {
+		err       error
+		transient bool
+	}{
+		{io.EOF, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{errdefs.Unavailable(errors.New("unavailable")), true},
+		{errdefs.Deadline(errors.New("deadline exceeded")), true},
+		{errdefs.System(errors.New("port is already allocated")), false},
+		{NewImagePullError("foo", "net/http: TLS handshake timeout"), true},
+		{errdefs.NotFound(errors.New("no such container")), false},
+		{errors.New("invalid reference format"), false},
+		{context.Canceled, false},
+	}
+	for _, testDef := range testDefs {
+		if got := isTransientError(testDef.err); got != testDef.transient {
+			t.Fatalf(
+				"did not get expected result for error %q: got %v, expected %v",
+				testDef.err,
+				got,
+				testDef.transient,
+			)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	scaffoldFilesDir   = "files"
+	scaffoldConfigFile = "config.json"
+)
+
+// The package manifest template uses alternate delimiters, since the generated
+// manifest contains templates of its own
+const scaffoldManifestTemplate = `# Package manifest for [[ .Name ]]
+#
+# See the "Package manifest format" section of the cardano-up README for
+# details on the available fields. Run 'cardano-up validate' on the parent
+# directory to check this package for problems, and install it locally with
+# 'cardano-up install ./[[ .Name ]]' while developing.
+specVersion: [[ .SpecVersion ]]
+name: [[ .Name ]]
+version: [[ .Version ]]
+description: [[ printf "%q" .Description ]]
+tags:
+  - docker
+  - linux
+  - darwin
+  - amd64
+  - arm64
+options:
+  - name: config
+    description: Write an example config file, available in the container as /data/[[ .ConfigFile ]]
+    default: true
+installSteps:
+  - condition: .Package.Options.config
+    file:
+      filename: [[ .ConfigFile ]]
+      source: [[ .ConfigSource ]]
+  - docker:
+      containerName: [[ .Name ]]
+      image: [[ .Image ]]
+      env:
+        NETWORK: '{{ .Context.Network }}'
+      binds:
+        - '{{ .Paths.DataDir }}:/data'
+      ports:
+        - '{{ freePort [[ .Port ]] }}:[[ .Port ]]'
+outputs:
+  - name: url
+    description: URL for the [[ .Name ]] service
+    value: 'http://localhost:{{ index (index .Ports "[[ .Name ]]") "[[ .Port ]]" }}'
+postInstallNotes: |
+  [[ .Name ]] is running on network {{ .Context.Network }}
+
+  Service URL: http://localhost:{{ index (index .Ports "[[ .Name ]]") "[[ .Port ]]" }}
+  Data directory: {{ .Paths.DataDir }}
+`
+
+const scaffoldConfigTemplate = `{
+  "network": "{{ .Context.Network }}",
+  "port": [[ .Port ]],
+  "dataDir": "/data"
+}
+`
+
+// PackageScaffold describes a new package to generate for package authors
+type PackageScaffold struct {
+	Name        string
+	Version     string
+	Description string
+	Image       string
+	Port        int
+}
+
+// NewPackageScaffold returns a PackageScaffold with sensible defaults for the
+// specified package name
+func NewPackageScaffold(name string) PackageScaffold {
+	return PackageScaffold{
+		Name:        name,
+		Version:     "0.1.0",
+		Description: fmt.Sprintf("The %s package", name),
+		Image:       fmt.Sprintf("ghcr.io/example/%s:latest", name),
+		Port:        8080,
+	}
+}
+
+func (s PackageScaffold) validate() error {
+	reName := regexp.MustCompile(`^[-a-zA-Z0-9]+$`)
+	if !reName.Match([]byte(s.Name)) {
+		return fmt.Errorf("invalid package name: %s", s.Name)
+	}
+	if _, err := version.NewVersion(s.Version); err != nil {
+		return fmt.Errorf("package version is malformed: %s", err)
+	}
+	if s.Image == "" {
+		return fmt.Errorf("docker image cannot be empty")
+	}
+	if s.Port <= 0 || s.Port > maxPort {
+		return NewInvalidPortError(s.Port)
+	}
+	return nil
+}
+
+// Write generates the package directory in the specified parent directory and
+// returns the path to the generated package manifest
+func (s PackageScaffold) Write(parentDir string) (string, error) {
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+	pkgDir := filepath.Join(parentDir, s.Name)
+	if entries, err := os.ReadDir(pkgDir); err == nil {
+		if len(entries) > 0 {
+			return "", NewPackageDirNotEmptyError(pkgDir)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	filesDir := filepath.Join(pkgDir, scaffoldFilesDir)
+	if err := os.MkdirAll(filesDir, fs.ModePerm); err != nil {
+		return "", err
+	}
+	tmplVars := map[string]any{
+		"SpecVersion":  PackageSpecVersion,
+		"Name":         s.Name,
+		"Version":      s.Version,
+		"Description":  s.Description,
+		"Image":        s.Image,
+		"Port":         s.Port,
+		"ConfigFile":   scaffoldConfigFile,
+		"ConfigSource": scaffoldFilesDir + "/" + scaffoldConfigFile,
+	}
+	manifestPath := filepath.Join(
+		pkgDir,
+		fmt.Sprintf("%s-%s.yaml", s.Name, s.Version),
+	)
+	scaffoldFiles := map[string]string{
+		manifestPath: scaffoldManifestTemplate,
+		filepath.Join(filesDir, scaffoldConfigFile): scaffoldConfigTemplate,
+	}
+	for filePath, fileTmpl := range scaffoldFiles {
+		content, err := scaffoldRender(fileTmpl, tmplVars)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filePath, content, 0o644); err != nil {
+			return "", err
+		}
+	}
+	return manifestPath, nil
+}
+
+func scaffoldRender(tmplBody string, vars map[string]any) ([]byte, error) {
+	tmpl, err := template.New("scaffold").Delims("[[", "]]").Parse(tmplBody)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"testing"
+)
+
+func TestPackageScaffoldLint(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg, err := NewDefaultConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.Template = NewTemplate(nil)
+	cfg.RegistryDir = tmpDir
+	scaffold := NewPackageScaffold("my-pkg")
+	if _, err := scaffold.Write(tmpDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkgs, err := registryPackagesDir(cfg, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf(
+			"did not get expected number of packages: got %d, expected 1",
+			len(pkgs),
+		)
+	}
+	if findings := pkgs[0].lint(cfg, pkgs); len(findings) > 0 {
+		t.Fatalf("unexpected lint findings for scaffolded package: %v", findings)
+	}
+	// Scaffolding into the same directory again should fail
+	if _, err := scaffold.Write(tmpDir); err == nil {
+		t.Fatalf("did not get expected error scaffolding over existing package")
+	}
+}
+
+func TestPackageScaffoldInvalid(t *testing.T) {
+	testDefs := []PackageScaffold{
+		{Name: "my_pkg", Version: "0.1.0", Image: "foo", Port: 8080},
+		{Name: "my-pkg", Version: "abc", Image: "foo", Port: 8080},
+		{Name: "my-pkg", Version: "0.1.0", Image: "", Port: 8080},
+		{Name: "my-pkg", Version: "0.1.0", Image: "foo", Port: 0},
+	}
+	for _, testDef := range testDefs {
+		if _, err := testDef.Write(t.TempDir()); err == nil {
+			t.Fatalf("did not get expected error for scaffold: %#v", testDef)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// JSONSchema is a minimal representation of a JSON Schema document, covering what's needed to describe
+// the package manifest format
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+}
+
+// jsonSchemaProvider is implemented by types that describe their own schema, such as those with
+// custom YAML unmarshaling that accept more than one form
+type jsonSchemaProvider interface {
+	jsonSchema() *JSONSchema
+}
+
+// PackageSchema returns a JSON Schema describing the package manifest format. It's generated from the
+// Package type using the yaml struct tags, with required fields marked by a `jsonschema:"required"` tag
+func PackageSchema() *JSONSchema {
+	ret := schemaForType(reflect.TypeOf(Package{}))
+	ret.Schema = jsonSchemaDraft
+	ret.Title = "cardano-up package"
+	return ret
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if provider, ok := reflect.Zero(t).Interface().(jsonSchemaProvider); ok {
+		return provider.jsonSchema()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{
+			Type:  "array",
+			Items: schemaForType(t.Elem()),
+		}
+	case reflect.Map:
+		return &JSONSchema{
+			Type:                 "object",
+			AdditionalProperties: schemaForType(t.Elem()),
+		}
+	case reflect.Struct:
+		ret := &JSONSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*JSONSchema),
+			AdditionalProperties: false,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tagParts := strings.Split(field.Tag.Get("yaml"), ",")
+			name := tagParts[0]
+			// Inline fields are described by the type that contains them
+			if name == "-" || (len(tagParts) > 1 && tagParts[1] == "inline") {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			ret.Properties[name] = schemaForType(field.Type)
+			if field.Tag.Get("jsonschema") == "required" {
+				ret.Required = append(ret.Required, name)
+			}
+		}
+		return ret
+	default:
+		// Allow anything for types we don't know how to describe
+		return &JSONSchema{}
+	}
+}
+
+// validatePackageSchema checks raw package manifest content against the package schema and returns
+// a list of problems found, each prefixed with the path to the offending value
+func validatePackageSchema(data []byte) ([]string, error) {
+	var rawPkg any
+	if err := yaml.Unmarshal(data, &rawPkg); err != nil {
+		return nil, err
+	}
+	var ret []string
+	PackageSchema().validate("", rawPkg, &ret)
+	return ret, nil
+}
+
+func (s *JSONSchema) validate(path string, value any, problems *[]string) {
+	displayPath := path
+	if displayPath == "" {
+		displayPath = "(root)"
+	}
+	addProblem := func(msg string, args ...any) {
+		*problems = append(
+			*problems,
+			fmt.Sprintf("%s: %s", displayPath, fmt.Sprintf(msg, args...)),
+		)
+	}
+	if value == nil {
+		return
+	}
+	if len(s.OneOf) > 0 {
+		// Report the problems for the alternative with a matching type when none match
+		var altTypes []string
+		for _, alt := range s.OneOf {
+			var altProblems []string
+			alt.validate(path, value, &altProblems)
+			if len(altProblems) == 0 {
+				return
+			}
+			altType := alt.yamlTypeName()
+			if altType == yamlTypeName(value) {
+				*problems = append(*problems, altProblems...)
+				return
+			}
+			altTypes = append(altTypes, altType)
+		}
+		addProblem(
+			"expected one of %s, got %s",
+			strings.Join(altTypes, " or "),
+			yamlTypeName(value),
+		)
+		return
+	}
+	switch s.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			addProblem("expected a string, got %s", yamlTypeName(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			addProblem("expected a boolean, got %s", yamlTypeName(value))
+		}
+	case "integer":
+		switch value.(type) {
+		case int, int64, uint64:
+		default:
+			addProblem("expected an integer, got %s", yamlTypeName(value))
+		}
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+		default:
+			addProblem("expected a number, got %s", yamlTypeName(value))
+		}
+	case "array":
+		tmpList, ok := value.([]any)
+		if !ok {
+			addProblem("expected a list, got %s", yamlTypeName(value))
+			return
+		}
+		if s.Items != nil {
+			for idx, item := range tmpList {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, idx), item, problems)
+			}
+		}
+	case "object":
+		tmpMap, ok := value.(map[string]any)
+		if !ok {
+			addProblem("expected a mapping, got %s", yamlTypeName(value))
+			return
+		}
+		for _, required := range s.Required {
+			if _, ok := tmpMap[required]; !ok {
+				addProblem("missing required field %q", required)
+			}
+		}
+		// Iterate over keys in sorted order for consistent output
+		var tmpKeys []string
+		for k := range tmpMap {
+			tmpKeys = append(tmpKeys, k)
+		}
+		sort.Strings(tmpKeys)
+		for _, k := range tmpKeys {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			if propSchema, ok := s.Properties[k]; ok {
+				propSchema.validate(childPath, tmpMap[k], problems)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					addProblem(
+						"unknown field %q%s",
+						k,
+						s.knownFieldsHint(),
+					)
+				}
+			case *JSONSchema:
+				additional.validate(childPath, tmpMap[k], problems)
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) knownFieldsHint() string {
+	if len(s.Properties) == 0 {
+		return ""
+	}
+	var tmpKeys []string
+	for k := range s.Properties {
+		tmpKeys = append(tmpKeys, k)
+	}
+	sort.Strings(tmpKeys)
+	return fmt.Sprintf(" (expected one of: %s)", strings.Join(tmpKeys, ", "))
+}
+
+// yamlTypeName returns the name of the YAML type described by the schema, using the same names as
+// yamlTypeName
+func (s *JSONSchema) yamlTypeName() string {
+	switch s.Type {
+	case "array":
+		return "list"
+	case "object":
+		return "mapping"
+	default:
+		return s.Type
+	}
+}
+
+func yamlTypeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "mapping"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePackageSchema(t *testing.T) {
+	testDefs := []struct {
+		yaml     string
+		problems []string
+	}{
+		{
+			yaml: "name: foo\nversion: 1.2.3\ninstallSteps:\n  - docker:\n      containerName: foo\n      image: foo\n      env:\n        FOO: bar",
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\nfoo: bar",
+			problems: []string{
+				`(root): unknown field "foo"`,
+			},
+		},
+		{
+			yaml: "name: foo\ninstallSteps:\n  - file:\n      filename: foo\n      binary: yes please\n      mode: 0755",
+			problems: []string{
+				`(root): missing required field "version"`,
+				`installSteps[0].file.binary: expected a boolean, got string`,
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ninstallSteps:\n  - docker:\n      containerName: foo\n      image: foo\n      env:\n        FOO: [bar]",
+			problems: []string{
+				`installSteps[0].docker.env.FOO: expected a string, got list`,
+			},
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndependencies:\n  - bar\n  - name: baz\n    condition: .Package.Options.baz",
+		},
+		{
+			yaml: "name: foo\nversion: 1.2.3\ndependencies:\n  - [bar]\n  - condition: .Package.Options.baz",
+			problems: []string{
+				`dependencies[0]: expected one of string or mapping, got list`,
+				`dependencies[1]: missing required field "name"`,
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		problems, err := validatePackageSchema([]byte(testDef.yaml))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		// Only the start of each problem is compared, so that the list of expected fields
+		// included with unknown field problems doesn't need updating as fields are added
+		matched := len(problems) == len(testDef.problems)
+		for idx := 0; matched && idx < len(problems); idx++ {
+			matched = strings.HasPrefix(problems[idx], testDef.problems[idx])
+		}
+		if !matched {
+			t.Fatalf(
+				"did not get expected problems\n  got: %#v\n  expected: %#v",
+				problems,
+				testDef.problems,
+			)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// packageScratchDirName is the name of the per-package scratch dir inside the package cache dir
+const packageScratchDirName = "scratch"
+
+// packageScratchDir returns the scratch dir for a package. This is for fast ephemeral storage
+// that's wiped whenever the package is stopped, unlike the persistent package data dir
+func packageScratchDir(cfg Config, pkgName string) string {
+	return filepath.Join(cfg.CacheDir, pkgName, packageScratchDirName)
+}
+
+// resetScratchDir removes anything left in the scratch dir for a package and recreates it empty.
+// This does nothing for a remote Docker host, where the local dir isn't used
+func resetScratchDir(cfg Config, pkgName string) error {
+	if remote, err := cfg.remoteHost(); err != nil || remote != nil {
+		return err
+	}
+	scratchDir := packageScratchDir(cfg, pkgName)
+	if err := os.RemoveAll(scratchDir); err != nil {
+		return err
+	}
+	return os.MkdirAll(scratchDir, fs.ModePerm)
+}
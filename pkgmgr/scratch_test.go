@@ -0,0 +1,61 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResetScratchDir(t *testing.T) {
+	cfg := Config{
+		CacheDir: t.TempDir(),
+	}
+	pkgName := "foo-1.0.0-default"
+	scratchDir := packageScratchDir(cfg, pkgName)
+	if scratchDir != filepath.Join(cfg.CacheDir, pkgName, "scratch") {
+		t.Fatalf("did not get expected scratch dir: %s", scratchDir)
+	}
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tmpFile := filepath.Join(scratchDir, "snapshot.tar")
+	if err := os.WriteFile(tmpFile, []byte("foo"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Resetting the scratch dir leaves it empty
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entries, err := os.ReadDir(scratchDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("scratch dir was not emptied: %d entries", len(entries))
+	}
+	// The scratch dir isn't touched for a remote Docker host
+	cfg.DockerHost = "ssh://user@example.com"
+	if err := os.RemoveAll(scratchDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := resetScratchDir(cfg, pkgName); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(scratchDir); !os.IsNotExist(err) {
+		t.Fatalf("scratch dir was created for remote Docker host")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	secretsFilename    = "secrets.enc"
+	secretsKeyFilename = "secrets.key"
+)
+
+// secretsAdditionalData is authenticated along with the encrypted secrets, to tie the file
+// content to its format version
+var secretsAdditionalData = []byte("cardano-up secrets v1")
+
+// PackageSecret declares a secret used by a package. Secret values are set with
+// 'cardano-up secret set' and are only provided to containers via the secretEnv field of
+// docker install steps
+type PackageSecret struct {
+	Name        string `yaml:"name" jsonschema:"required"`
+	Description string `yaml:"description,omitempty"`
+	// Optional allows installing the package without the secret being set
+	Optional bool `yaml:"optional,omitempty"`
+}
+
+func validateSecretName(name string) error {
+	reName := regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+	if !reName.Match([]byte(name)) {
+		return NewInvalidSecretNameError(name)
+	}
+	return nil
+}
+
+// SecretStore stores secret values in a file encrypted with XChaCha20-Poly1305. The encryption
+// key is generated on first use and stored in a separate file that's only readable by the user.
+// The key file must live outside the config dir, so that copying or backing up the config dir
+// doesn't also expose the key needed to decrypt the secrets
+type SecretStore struct {
+	path      string
+	keyPath   string
+	configDir string
+}
+
+// NewSecretStore returns a SecretStore using the secrets file in the config dir and the
+// configured key file, which defaults to a file in the data dir
+func NewSecretStore(cfg Config) *SecretStore {
+	ret := &SecretStore{
+		path:      filepath.Join(cfg.ConfigDir, secretsFilename),
+		keyPath:   cfg.SecretsKeyFile,
+		configDir: cfg.ConfigDir,
+	}
+	if ret.keyPath == "" {
+		ret.keyPath = filepath.Join(cfg.DataDir, secretsKeyFilename)
+	}
+	return ret
+}
+
+// Get returns the value of a secret and whether it's set
+func (s *SecretStore) Get(name string) (string, bool, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return "", false, err
+	}
+	val, ok := secrets[name]
+	return val, ok, nil
+}
+
+// Set stores the value of a secret
+func (s *SecretStore) Set(name string, value string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.save(secrets)
+}
+
+// Delete removes a secret
+func (s *SecretStore) Delete(name string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return NewSecretNotFoundError(name)
+	}
+	delete(secrets, name)
+	return s.save(secrets)
+}
+
+// Names returns the names of all stored secrets in sorted order
+func (s *SecretStore) Names() ([]string, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for name := range secrets {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *SecretStore) load() (map[string]string, error) {
+	ret := make(map[string]string)
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	key, err := s.key(false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < aead.NonceSize() {
+		return nil, ErrSecretsDecryptFailed
+	}
+	nonce, ciphertext := content[:aead.NonceSize()], content[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, secretsAdditionalData)
+	if err != nil {
+		return nil, ErrSecretsDecryptFailed
+	}
+	if err := json.Unmarshal(plaintext, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *SecretStore) save(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	content := aead.Seal(nonce, nonce, plaintext, secretsAdditionalData)
+	if err := os.MkdirAll(filepath.Dir(s.path), fs.ModePerm); err != nil {
+		return err
+	}
+	// Write to a temp file and rename, so that a failed write doesn't lose existing secrets
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// key returns the encryption key, optionally generating it if it doesn't exist
+func (s *SecretStore) key(create bool) ([]byte, error) {
+	if pathWithinDir(s.configDir, s.keyPath) {
+		return nil, NewSecretsKeyInConfigDirError(s.keyPath)
+	}
+	key, err := os.ReadFile(s.keyPath)
+	if err == nil {
+		if len(key) != chacha20poly1305.KeySize {
+			return nil, NewSecretsKeyInvalidError(s.keyPath)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if !create {
+		return nil, NewSecretsKeyMissingError(s.keyPath)
+	}
+	key = make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.keyPath), fs.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.keyPath, key, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// pathWithinDir returns whether the path is inside the specified dir
+func pathWithinDir(dir string, path string) bool {
+	if dir == "" {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	relPath, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// packageSecrets returns the values for the secrets declared by a package. An error is returned
+// if a required secret is not set
+func packageSecrets(cfg Config, pkg Package) (map[string]string, error) {
+	if len(pkg.Secrets) == 0 {
+		return nil, nil
+	}
+	secrets, err := NewSecretStore(cfg).load()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for _, secret := range pkg.Secrets {
+		val, ok := secrets[secret.Name]
+		if !ok {
+			if secret.Optional {
+				continue
+			}
+			return nil, NewSecretNotSetError(secret.Name, pkg.Name)
+		}
+		ret[secret.Name] = val
+	}
+	return ret, nil
+}
+
+// SetSecret stores the value of a secret
+func (p *PackageManager) SetSecret(name string, value string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return NewSecretStore(p.config).Set(name, value)
+}
+
+// DeleteSecret removes a secret
+func (p *PackageManager) DeleteSecret(name string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return NewSecretStore(p.config).Delete(name)
+}
+
+// SecretNames returns the names of all stored secrets
+func (p *PackageManager) SecretNames() ([]string, error) {
+	return NewSecretStore(p.config).Names()
+}
+
+// SecretPackages returns the names of the packages declaring each secret, for installed packages
+// in all contexts
+func (p *PackageManager) SecretPackages() map[string][]string {
+	ret := make(map[string][]string)
+	for _, installedPkg := range p.InstalledPackagesAllContexts() {
+		for _, secret := range installedPkg.Package.Secrets {
+			ret[secret.Name] = append(
+				ret[secret.Name],
+				fmt.Sprintf("%s (%s)", installedPkg.InstanceName(), installedPkg.Context),
+			)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSecretStore(t *testing.T) {
+	cfg := Config{
+		ConfigDir: t.TempDir(),
+		DataDir:   t.TempDir(),
+	}
+	store := NewSecretStore(cfg)
+	if err := store.Set("api-key", "supersecret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Set("other", "value"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Set("bad name", "value"); err == nil {
+		t.Fatalf("did not get expected error for invalid secret name")
+	}
+	val, ok, err := store.Get("api-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ok || val != "supersecret" {
+		t.Fatalf("did not get expected secret value: %q", val)
+	}
+	// The secret value should not be stored in plaintext
+	content, err := os.ReadFile(filepath.Join(cfg.ConfigDir, secretsFilename))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if bytes.Contains(content, []byte("supersecret")) {
+		t.Fatalf("secret value was stored in plaintext")
+	}
+	if err := store.Delete("other"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.Delete("other"); err == nil {
+		t.Fatalf("did not get expected error deleting missing secret")
+	}
+	names, err := store.Names()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"api-key"}) {
+		t.Fatalf("did not get expected secret names: %v", names)
+	}
+}
+
+func TestSecretStoreWrongKey(t *testing.T) {
+	cfg := Config{
+		ConfigDir: t.TempDir(),
+		DataDir:   t.TempDir(),
+	}
+	if err := NewSecretStore(cfg).Set("api-key", "supersecret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.SecretsKeyFile = filepath.Join(t.TempDir(), "other.key")
+	if err := os.WriteFile(cfg.SecretsKeyFile, make([]byte, 32), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, _, err := NewSecretStore(cfg).Get("api-key"); !errors.Is(err, ErrSecretsDecryptFailed) {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+}
+
+func TestSecretStoreKeyInConfigDir(t *testing.T) {
+	cfg := Config{
+		ConfigDir: t.TempDir(),
+		DataDir:   t.TempDir(),
+	}
+	cfg.SecretsKeyFile = filepath.Join(cfg.ConfigDir, "keys", "secrets.key")
+	if err := NewSecretStore(cfg).Set("api-key", "supersecret"); err == nil {
+		t.Fatalf("did not get expected error for key file in config dir")
+	}
+	if _, err := os.Stat(cfg.SecretsKeyFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("key file was created in config dir")
+	}
+}
+
+func TestPackageSecrets(t *testing.T) {
+	cfg := Config{
+		ConfigDir: t.TempDir(),
+		DataDir:   t.TempDir(),
+	}
+	if err := NewSecretStore(cfg).Set("api-key", "supersecret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg := Package{
+		Name: "test",
+		Secrets: []PackageSecret{
+			{Name: "api-key"},
+			{Name: "extra", Optional: true},
+		},
+	}
+	secrets, err := packageSecrets(cfg, pkg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(secrets, map[string]string{"api-key": "supersecret"}) {
+		t.Fatalf("did not get expected secrets: %v", secrets)
+	}
+	pkg.Secrets[1].Optional = false
+	if _, err := packageSecrets(cfg, pkg); err == nil {
+		t.Fatalf("did not get expected error for missing required secret")
+	}
+}
+
+func TestPackageValidateSecretEnv(t *testing.T) {
+	pkg := Package{
+		Name:     "test",
+		Version:  "1.0.0",
+		filePath: "test/test-1.0.0.yaml",
+		Secrets: []PackageSecret{
+			{Name: "api-key"},
+		},
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					ContainerName: "test",
+					Image:         "test:latest",
+					SecretEnv: map[string]string{
+						"API_KEY": "api-key",
+					},
+				},
+			},
+		},
+	}
+	if err := pkg.validate(Config{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg.InstallSteps[0].Docker.SecretEnv["OTHER_KEY"] = "other"
+	if err := pkg.validate(Config{}); err == nil {
+		t.Fatalf("did not get expected error for undeclared secret")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceStatusFilename is the file in the config dir with the last known status of the package
+// containers
+const serviceStatusFilename = "service_status.yaml"
+
+// serviceStatusUnknown is shown for a container when Docker is unavailable
+const serviceStatusUnknown = "UNKNOWN"
+
+// ServiceStatus is the last known status of a package container
+type ServiceStatus struct {
+	Running   bool      `yaml:"running"`
+	CheckedAt time.Time `yaml:"checkedAt"`
+}
+
+// ServiceStatusCache holds the last known status of package containers, keyed by container name.
+// It's only used for display when Docker is unavailable
+type ServiceStatusCache map[string]ServiceStatus
+
+// String returns the status for display along with when it was checked
+func (s ServiceStatus) String() string {
+	status := serviceStatusNotRunning
+	if s.Running {
+		status = serviceStatusRunning
+	}
+	return fmt.Sprintf(
+		"%s (last %s at %s)",
+		serviceStatusUnknown,
+		status,
+		s.CheckedAt.Local().Format(time.DateTime),
+	)
+}
+
+func (s *State) loadServiceStatuses() error {
+	if err := s.loadFile(serviceStatusFilename, &(s.ServiceStatuses)); err != nil {
+		return err
+	}
+	if s.ServiceStatuses == nil {
+		s.ServiceStatuses = make(ServiceStatusCache)
+	}
+	return nil
+}
+
+// saveServiceStatuses writes the last known container status. It's saved separately from the
+// rest of the state, since it's also updated by commands that don't take the lock, and is
+// written atomically so that concurrent writers can only lose an update
+func (s *State) saveServiceStatuses() error {
+	content, err := yaml.Marshal(&(s.ServiceStatuses))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.config.ConfigDir, os.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.config.ConfigDir, serviceStatusFilename), content)
+}
+
+// recordServiceStatuses updates the last known status of the specified containers. Failures are
+// only logged, since the status is only used for display
+func (p *PackageManager) recordServiceStatuses(statuses map[string]bool) {
+	if len(statuses) == 0 {
+		return
+	}
+	now := time.Now()
+	for containerName, running := range statuses {
+		p.state.ServiceStatuses[containerName] = ServiceStatus{
+			Running:   running,
+			CheckedAt: now,
+		}
+	}
+	if err := p.state.saveServiceStatuses(); err != nil {
+		p.config.Logger.Debug(
+			fmt.Sprintf("failed to save container status: %s", err),
+		)
+	}
+}
+
+// recordServiceResults updates the last known status of the containers for the installed packages
+// that were successfully started or stopped
+func (p *PackageManager) recordServiceResults(results []ServiceResult, running bool) {
+	succeeded := make(map[string]bool, len(results))
+	for _, result := range results {
+		if result.Error == nil {
+			succeeded[result.Package] = true
+		}
+	}
+	statuses := make(map[string]bool)
+	for _, installedPkg := range p.InstalledPackages() {
+		if !succeeded[installedPkg.InstanceName()] {
+			continue
+		}
+		for _, containerName := range installedPkg.containerNames(p.config) {
+			statuses[containerName] = running
+		}
+	}
+	p.recordServiceStatuses(statuses)
+}
+
+// containerNames returns the names of the long-running containers for the installed package,
+// without contacting Docker
+func (i InstalledPackage) containerNames(cfg Config) []string {
+	pkgName := fmt.Sprintf("%s-%s-%s", i.Package.instanceName(), i.Package.Version, i.Context)
+	var ret []string
+	for _, step := range i.Package.containerSteps(cfg, pkgName) {
+		if step.PullOnly {
+			continue
+		}
+		ret = append(ret, fmt.Sprintf("%s-%s", pkgName, step.ContainerName))
+	}
+	return ret
+}
+
+// unknownServiceStatus returns the status shown for a container when Docker is unavailable, which
+// includes the last known status when there is one
+func (p *PackageManager) unknownServiceStatus(containerName string) string {
+	if status, ok := p.state.ServiceStatuses[containerName]; ok {
+		return status.String()
+	}
+	return serviceStatusUnknown
+}
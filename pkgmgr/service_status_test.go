@@ -0,0 +1,113 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/cardano-up/internal/table"
+)
+
+func TestRecordServiceResults(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	for _, pkgName := range []string{"cardano-node", "ogmios"} {
+		pm.state.InstalledPackages = append(
+			pm.state.InstalledPackages,
+			InstalledPackage{
+				Package: Package{
+					Name:    pkgName,
+					Version: "1.0.0",
+					InstallSteps: []PackageInstallStep{
+						{
+							Docker: &PackageInstallStepDocker{
+								ContainerName: "main",
+							},
+						},
+						{
+							Docker: &PackageInstallStepDocker{
+								ContainerName: "image",
+								PullOnly:      true,
+							},
+						},
+					},
+				},
+				Context:       activeContextName,
+				InstalledTime: time.Now(),
+			},
+		)
+	}
+	pm.recordServiceResults(
+		[]ServiceResult{
+			{Package: "cardano-node"},
+			{Package: "ogmios", Error: errors.New("failed")},
+		},
+		true,
+	)
+	// The status is loaded along with the rest of the state
+	pm, err = NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nodeContainer := "cardano-node-1.0.0-" + activeContextName + "-main"
+	if len(pm.state.ServiceStatuses) != 1 || !pm.state.ServiceStatuses[nodeContainer].Running {
+		t.Fatalf("did not get expected container status: %#v", pm.state.ServiceStatuses)
+	}
+	if status := pm.unknownServiceStatus(nodeContainer); status == serviceStatusUnknown ||
+		serviceStatusColor(status) != table.ColorYellow {
+		t.Fatalf("did not get expected last known status: %s", status)
+	}
+	ogmiosContainer := "ogmios-1.0.0-" + activeContextName + "-main"
+	if status := pm.unknownServiceStatus(ogmiosContainer); status != serviceStatusUnknown {
+		t.Fatalf("did not get expected unknown status: %s", status)
+	}
+}
+
+func TestServiceStatusString(t *testing.T) {
+	checkedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+	testDefs := []struct {
+		status   ServiceStatus
+		expected string
+	}{
+		{
+			status:   ServiceStatus{Running: true, CheckedAt: checkedAt},
+			expected: "UNKNOWN (last RUNNING at 2024-05-01 12:30:00)",
+		},
+		{
+			status:   ServiceStatus{CheckedAt: checkedAt},
+			expected: "UNKNOWN (last NOT RUNNING at 2024-05-01 12:30:00)",
+		},
+	}
+	for _, testDef := range testDefs {
+		if status := testDef.status.String(); status != testDef.expected {
+			t.Fatalf("did not get expected status: got %q, expected %q", status, testDef.expected)
+		}
+	}
+}
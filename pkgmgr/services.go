@@ -0,0 +1,237 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ServiceResult is the result of starting or stopping the services for an installed package
+type ServiceResult struct {
+	// Package is the instance name of the package
+	Package  string
+	Version  string
+	Duration time.Duration
+	// Error is set when starting or stopping the services failed, or was skipped because a
+	// dependency failed to start
+	Error error
+}
+
+// UpInContext starts the services for the installed packages in the specified context. See Up
+func (p *PackageManager) UpInContext(
+	context string,
+	timeout time.Duration,
+) ([]ServiceResult, error) {
+	var ret []ServiceResult
+	err := p.inContext(
+		context,
+		func(ctxPm *PackageManager) error {
+			var err error
+			ret, err = ctxPm.Up(timeout)
+			return err
+		},
+	)
+	return ret, err
+}
+
+// DownInContext stops the services for the installed packages in the specified context. See Down
+func (p *PackageManager) DownInContext(
+	context string,
+	timeout time.Duration,
+) ([]ServiceResult, error) {
+	var ret []ServiceResult
+	err := p.inContext(
+		context,
+		func(ctxPm *PackageManager) error {
+			var err error
+			ret, err = ctxPm.Down(timeout)
+			return err
+		},
+	)
+	return ret, err
+}
+
+// Up starts the services for the installed packages in the active context. Packages are started
+// concurrently, once the packages that they depend on have started, and packages are skipped when
+// a dependency fails to start. A timeout of 0 means no timeout. The result for each package is
+// returned in the order that they were started, along with an error if any failed
+func (p *PackageManager) Up(timeout time.Duration) ([]ServiceResult, error) {
+	ret, err := p.runServices(
+		timeout,
+		false,
+		func(cfg Config, installedPkg InstalledPackage) error {
+			return installedPkg.Package.startService(cfg, installedPkg.Context)
+		},
+	)
+	p.recordServiceResults(ret, true)
+	return ret, err
+}
+
+// Down stops the services for the installed packages in the active context. Packages are stopped
+// concurrently, once the packages that depend on them have stopped. A timeout of 0 means no
+// timeout. The result for each package is returned in the order that they were stopped, along with
+// an error if any failed
+func (p *PackageManager) Down(timeout time.Duration) ([]ServiceResult, error) {
+	ret, err := p.runServices(
+		timeout,
+		true,
+		func(cfg Config, installedPkg InstalledPackage) error {
+			return installedPkg.Package.stopService(cfg, installedPkg.Context)
+		},
+	)
+	p.recordServiceResults(ret, false)
+	return ret, err
+}
+
+// runServices runs an operation for each installed package concurrently, in dependency order. With
+// reverse, dependents go before the packages that they depend on, and the operation isn't skipped
+// when a dependent fails
+func (p *PackageManager) runServices(
+	timeout time.Duration,
+	reverse bool,
+	fn func(Config, InstalledPackage) error,
+) ([]ServiceResult, error) {
+	installedPkgs := p.InstalledPackages()
+	dependencies, dependents, err := p.serviceDependencies(installedPkgs)
+	if err != nil {
+		return nil, err
+	}
+	waitFor := dependencies
+	if reverse {
+		waitFor = dependents
+	}
+	order, err := serviceOrder(waitFor)
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.config
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(cfg.ctx(), timeout)
+		defer cancel()
+		cfg.Context = ctx
+	}
+	results := make([]ServiceResult, len(installedPkgs))
+	done := make([]chan struct{}, len(installedPkgs))
+	for idx := range done {
+		done[idx] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for idx, installedPkg := range installedPkgs {
+		wg.Add(1)
+		go func(idx int, installedPkg InstalledPackage) {
+			defer wg.Done()
+			defer close(done[idx])
+			results[idx] = ServiceResult{
+				Package: installedPkg.InstanceName(),
+				Version: installedPkg.Package.Version,
+			}
+			for _, waitIdx := range waitFor[idx] {
+				<-done[waitIdx]
+				if !reverse && results[waitIdx].Error != nil {
+					results[idx].Error = NewServiceDependencyFailedError(
+						results[waitIdx].Package,
+					)
+					return
+				}
+			}
+			startTime := time.Now()
+			results[idx].Error = fn(cfg, installedPkg)
+			results[idx].Duration = time.Since(startTime)
+		}(idx, installedPkg)
+	}
+	wg.Wait()
+	ret := make([]ServiceResult, 0, len(results))
+	failed := 0
+	for _, idx := range order {
+		if results[idx].Error != nil {
+			failed++
+		}
+		ret = append(ret, results[idx])
+	}
+	if failed > 0 {
+		return ret, NewServicesFailedError(failed, len(ret))
+	}
+	return ret, nil
+}
+
+// serviceDependencies returns the indexes of the installed packages that each installed package
+// depends on, and the indexes of the installed packages that depend on each installed package
+func (p *PackageManager) serviceDependencies(
+	installedPkgs []InstalledPackage,
+) ([][]int, [][]int, error) {
+	activeContextName, _ := p.CurrentContext()
+	resolver, err := NewResolver(
+		installedPkgs,
+		// Only the installed packages are needed to find dependents, so the registry isn't loaded
+		nil,
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgIdxs := make(map[string]int, len(installedPkgs))
+	for idx, installedPkg := range installedPkgs {
+		pkgIdxs[installedPkg.InstanceName()] = idx
+	}
+	dependencies := make([][]int, len(installedPkgs))
+	dependents := make([][]int, len(installedPkgs))
+	for idx, installedPkg := range installedPkgs {
+		tmpDependents, err := resolver.Dependents(installedPkg)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dependent := range tmpDependents {
+			dependentIdx := pkgIdxs[dependent.InstanceName()]
+			dependencies[dependentIdx] = append(dependencies[dependentIdx], idx)
+			dependents[idx] = append(dependents[idx], dependentIdx)
+		}
+	}
+	return dependencies, dependents, nil
+}
+
+// serviceOrder returns the order to run an operation on each item, where each item comes after
+// the items that it waits for. Items that don't wait for each other keep their original order
+func serviceOrder(waitFor [][]int) ([]int, error) {
+	ret := make([]int, 0, len(waitFor))
+	added := make([]bool, len(waitFor))
+	for len(ret) < len(waitFor) {
+		progress := false
+		for idx, waitIdxs := range waitFor {
+			if added[idx] {
+				continue
+			}
+			ready := true
+			for _, waitIdx := range waitIdxs {
+				if !added[waitIdx] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ret = append(ret, idx)
+				added[idx] = true
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, ErrServiceDependencyCycle
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServiceOrder(t *testing.T) {
+	testDefs := []struct {
+		WaitFor  [][]int
+		Expected []int
+		Error    bool
+	}{
+		{
+			WaitFor:  [][]int{nil, nil, nil},
+			Expected: []int{0, 1, 2},
+		},
+		{
+			WaitFor:  [][]int{{2}, {0}, nil},
+			Expected: []int{2, 0, 1},
+		},
+		{
+			WaitFor:  [][]int{{1, 2}, nil, {1}},
+			Expected: []int{1, 2, 0},
+		},
+		{
+			WaitFor: [][]int{{1}, {0}},
+			Error:   true,
+		},
+	}
+	for _, testDef := range testDefs {
+		order, err := serviceOrder(testDef.WaitFor)
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for %v", testDef.WaitFor)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(order, testDef.Expected) {
+			t.Fatalf("did not get expected order\n  got: %v\n  expected: %v", order, testDef.Expected)
+		}
+	}
+}
+
+func TestRunServices(t *testing.T) {
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: t.TempDir(),
+			DataDir:   t.TempDir(),
+			CacheDir:  t.TempDir(),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:         "kupo",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "cardano-node"}},
+			},
+			Context: activeContextName,
+		},
+		{
+			Package: Package{Name: "cardano-node", Version: "1.0.0"},
+			Context: activeContextName,
+		},
+		{
+			Package: Package{Name: "postgres", Version: "1.0.0"},
+			Context: activeContextName,
+		},
+	}
+	var mu sync.Mutex
+	var ran []string
+	runFn := func(failPkg string) func(Config, InstalledPackage) error {
+		return func(cfg Config, installedPkg InstalledPackage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, installedPkg.InstanceName())
+			if installedPkg.InstanceName() == failPkg {
+				return errors.New("failed")
+			}
+			return nil
+		}
+	}
+	// Dependencies come first
+	results, err := pm.runServices(time.Minute, false, runFn(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var resultPkgs []string
+	for _, result := range results {
+		resultPkgs = append(resultPkgs, result.Package)
+	}
+	if !reflect.DeepEqual(resultPkgs, []string{"cardano-node", "postgres", "kupo"}) {
+		t.Fatalf("did not get expected results order: %v", resultPkgs)
+	}
+	if len(ran) != 3 || ran[2] == "cardano-node" {
+		t.Fatalf("did not get expected run order: %v", ran)
+	}
+	// Dependents are skipped when a dependency fails
+	ran = nil
+	results, err = pm.runServices(0, false, runFn("cardano-node"))
+	if err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	if len(ran) != 2 || results[2].Package != "kupo" || results[2].Error == nil {
+		t.Fatalf("did not get expected results: %v, %#v", ran, results)
+	}
+	// Dependents go first in reverse, and failures don't stop the others
+	ran = nil
+	results, err = pm.runServices(0, true, runFn("kupo"))
+	if err == nil {
+		t.Fatalf("did not get expected error")
+	}
+	resultPkgs = nil
+	for _, result := range results {
+		resultPkgs = append(resultPkgs, result.Package)
+	}
+	if len(ran) != 3 || !reflect.DeepEqual(resultPkgs, []string{"kupo", "cardano-node", "postgres"}) {
+		t.Fatalf("did not get expected results: %v, %v", ran, resultPkgs)
+	}
+}
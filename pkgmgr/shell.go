@@ -0,0 +1,297 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+	ShellSh   = "sh"
+)
+
+// shellPathComment is written before the line that adds BinDir to PATH in a shell rc file
+const shellPathComment = "# Added by cardano-up to run the binaries from installed packages"
+
+// ShellNames returns the names of the supported shells
+func ShellNames() []string {
+	return []string{ShellBash, ShellZsh, ShellFish, ShellSh}
+}
+
+// DetectShell returns the name of the user's login shell from the SHELL env var. Unknown shells
+// are treated as a POSIX shell
+func DetectShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	for _, name := range ShellNames() {
+		if shell == name {
+			return name
+		}
+	}
+	return ShellSh
+}
+
+// ShellPathSetup describes how BinDir is added to PATH for a shell
+type ShellPathSetup struct {
+	Shell  string
+	BinDir string
+	// RcFile is the shell startup file that the PATH setup is added to
+	RcFile string
+	// Line is the shell command that adds BinDir to PATH
+	Line string
+	// InPath is whether BinDir is in PATH for the running cardano-up process
+	InPath bool
+	// Configured is whether RcFile already contains Line
+	Configured bool
+}
+
+// ShellPathSetup returns how BinDir is added to PATH for the specified shell, or the user's
+// login shell if none is specified, and whether it's been done already
+func (p *PackageManager) ShellPathSetup(shell string) (ShellPathSetup, error) {
+	if shell == "" {
+		shell = DetectShell()
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ShellPathSetup{}, fmt.Errorf(
+			"could not determine user home directory: %s",
+			err,
+		)
+	}
+	rcFile, err := shellRcFile(shell, homeDir, runtime.GOOS)
+	if err != nil {
+		return ShellPathSetup{}, err
+	}
+	ret := ShellPathSetup{
+		Shell:  shell,
+		BinDir: p.config.BinDir,
+		RcFile: rcFile,
+		Line:   shellPathLine(shell, p.config.BinDir),
+		InPath: dirInPath(p.config.BinDir, os.Getenv("PATH")),
+	}
+	ret.Configured, err = fileHasLine(rcFile, ret.Line)
+	if err != nil {
+		return ShellPathSetup{}, err
+	}
+	return ret, nil
+}
+
+// AddShellPath appends the line that adds BinDir to PATH to the shell rc file, unless it's
+// already there
+func (p *PackageManager) AddShellPath(setup ShellPathSetup) error {
+	configured, err := fileHasLine(setup.RcFile, setup.Line)
+	if err != nil {
+		return err
+	}
+	if configured {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(setup.RcFile), fs.ModePerm); err != nil {
+		return err
+	}
+	var prefix string
+	if content, err := os.ReadFile(setup.RcFile); err == nil {
+		if len(content) > 0 {
+			prefix = "\n"
+			if content[len(content)-1] != '\n' {
+				prefix = "\n\n"
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	rcFile, err := os.OpenFile(setup.RcFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(rcFile, "%s%s\n%s\n", prefix, shellPathComment, setup.Line); err != nil {
+		_ = rcFile.Close()
+		return err
+	}
+	if err := rcFile.Close(); err != nil {
+		return err
+	}
+	p.config.Logger.Debug(
+		fmt.Sprintf("added %s to PATH in %s", setup.BinDir, setup.RcFile),
+	)
+	return nil
+}
+
+// shellRcFile returns the startup file for a shell that's read by interactive shells
+func shellRcFile(shell string, homeDir string, goos string) (string, error) {
+	switch shell {
+	case ShellBash:
+		// Terminal apps on macOS start login shells, which don't read .bashrc
+		if goos == "darwin" {
+			return filepath.Join(homeDir, ".bash_profile"), nil
+		}
+		return filepath.Join(homeDir, ".bashrc"), nil
+	case ShellZsh:
+		if zdotDir := os.Getenv("ZDOTDIR"); zdotDir != "" {
+			return filepath.Join(zdotDir, ".zshrc"), nil
+		}
+		return filepath.Join(homeDir, ".zshrc"), nil
+	case ShellFish:
+		if configDir := os.Getenv("XDG_CONFIG_HOME"); configDir != "" {
+			return filepath.Join(configDir, "fish", "config.fish"), nil
+		}
+		return filepath.Join(homeDir, ".config", "fish", "config.fish"), nil
+	case ShellSh:
+		return filepath.Join(homeDir, ".profile"), nil
+	}
+	return "", NewUnsupportedShellError(shell)
+}
+
+// shellPathLine returns the shell command that puts a dir first in PATH
+func shellPathLine(shell string, dir string) string {
+	if shell == ShellFish {
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dir)
+		return fmt.Sprintf("set -gx PATH '%s' $PATH", quoted)
+	}
+	return fmt.Sprintf("export PATH=%s:\"$PATH\"", shellQuote(dir))
+}
+
+// dirInPath returns whether a dir is in the given PATH value
+func dirInPath(dir string, pathEnv string) bool {
+	dir = filepath.Clean(dir)
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		realDir = dir
+	}
+	for _, pathDir := range filepath.SplitList(pathEnv) {
+		if pathDir == "" {
+			continue
+		}
+		pathDir = filepath.Clean(pathDir)
+		if pathDir == dir || pathDir == realDir {
+			return true
+		}
+		if realPathDir, err := filepath.EvalSymlinks(pathDir); err == nil &&
+			realPathDir == realDir {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHasLine returns whether a file contains the given line. A missing file doesn't contain any
+// lines
+func fileHasLine(path string, line string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == line {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// unresolvableBinaries returns warnings for the binaries of an installed package in BinDir that
+// won't be run by name from a shell, because BinDir isn't in PATH or another binary with the same
+// name comes first in PATH
+func (p *PackageManager) unresolvableBinaries(pkg Package, context string) []string {
+	pkgName := fmt.Sprintf("%s-%s-%s", pkg.instanceName(), pkg.Version, context)
+	pkgDataDir := p.config.packageDataDir(pkgName) + string(filepath.Separator)
+	entries, err := os.ReadDir(p.config.BinDir)
+	if err != nil {
+		return nil
+	}
+	var binNames []string
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(p.config.BinDir, entry.Name()))
+		if err != nil || !strings.HasPrefix(target, pkgDataDir) {
+			continue
+		}
+		binNames = append(binNames, entry.Name())
+	}
+	if len(binNames) == 0 {
+		return nil
+	}
+	if !dirInPath(p.config.BinDir, os.Getenv("PATH")) {
+		return []string{
+			fmt.Sprintf(
+				"%s is not in PATH, so the binaries from package %s won't be found by your shell: %s. Run 'cardano-up init-shell' to add it",
+				p.config.BinDir,
+				pkg.instanceName(),
+				strings.Join(binNames, ", "),
+			),
+		}
+	}
+	var ret []string
+	for _, binName := range binNames {
+		binPath := filepath.Join(p.config.BinDir, binName)
+		resolvedPath, err := exec.LookPath(binName)
+		if err != nil {
+			ret = append(
+				ret,
+				fmt.Sprintf(
+					"binary %s from package %s can't be run: %s",
+					binPath,
+					pkg.instanceName(),
+					err,
+				),
+			)
+			continue
+		}
+		if sameFile(resolvedPath, binPath) {
+			continue
+		}
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"running %s will run %s, which comes before %s in PATH, rather than the binary from package %s",
+				binName,
+				resolvedPath,
+				p.config.BinDir,
+				pkg.instanceName(),
+			),
+		)
+	}
+	return ret
+}
+
+// sameFile returns whether two paths refer to the same file
+func sameFile(path1 string, path2 string) bool {
+	stat1, err := os.Stat(path1)
+	if err != nil {
+		return false
+	}
+	stat2, err := os.Stat(path2)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(stat1, stat2)
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellRcFile(t *testing.T) {
+	t.Setenv("ZDOTDIR", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	testDefs := []struct {
+		shell    string
+		goos     string
+		expected string
+		invalid  bool
+	}{
+		{shell: ShellBash, goos: "linux", expected: "/home/user/.bashrc"},
+		{shell: ShellBash, goos: "darwin", expected: "/home/user/.bash_profile"},
+		{shell: ShellZsh, goos: "linux", expected: "/home/user/.zshrc"},
+		{shell: ShellFish, goos: "linux", expected: "/home/user/.config/fish/config.fish"},
+		{shell: ShellSh, goos: "linux", expected: "/home/user/.profile"},
+		{shell: "tcsh", goos: "linux", invalid: true},
+	}
+	for _, testDef := range testDefs {
+		rcFile, err := shellRcFile(testDef.shell, "/home/user", testDef.goos)
+		if testDef.invalid {
+			if err == nil {
+				t.Fatalf("did not get expected error for shell %q", testDef.shell)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rcFile != testDef.expected {
+			t.Fatalf(
+				"did not get expected rc file for shell %q: got %q, expected %q",
+				testDef.shell,
+				rcFile,
+				testDef.expected,
+			)
+		}
+	}
+	t.Setenv("ZDOTDIR", "/home/user/.config/zsh")
+	rcFile, err := shellRcFile(ShellZsh, "/home/user", "linux")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rcFile != "/home/user/.config/zsh/.zshrc" {
+		t.Fatalf("did not get expected rc file with ZDOTDIR: got %q", rcFile)
+	}
+}
+
+func TestShellPathLine(t *testing.T) {
+	testDefs := []struct {
+		shell    string
+		dir      string
+		expected string
+	}{
+		{
+			shell:    ShellBash,
+			dir:      "/home/user/.local/bin",
+			expected: `export PATH='/home/user/.local/bin':"$PATH"`,
+		},
+		{
+			shell:    ShellSh,
+			dir:      "/home/o'neil/bin",
+			expected: `export PATH='/home/o'\''neil/bin':"$PATH"`,
+		},
+		{
+			shell:    ShellFish,
+			dir:      "/home/o'neil/bin",
+			expected: `set -gx PATH '/home/o\'neil/bin' $PATH`,
+		},
+	}
+	for _, testDef := range testDefs {
+		line := shellPathLine(testDef.shell, testDef.dir)
+		if line != testDef.expected {
+			t.Fatalf("did not get expected line: got %q, expected %q", line, testDef.expected)
+		}
+	}
+}
+
+func TestDirInPath(t *testing.T) {
+	pathEnv := strings.Join([]string{"/usr/bin", "/home/user/.local/bin/", ""}, ":")
+	if !dirInPath("/home/user/.local/bin", pathEnv) {
+		t.Fatalf("did not find dir in PATH")
+	}
+	if dirInPath("/home/user/bin", pathEnv) {
+		t.Fatalf("found unexpected dir in PATH")
+	}
+}
+
+func TestAddShellPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	homeDir := filepath.Join(tmpDir, "home")
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("PATH", "/usr/bin")
+	cfg := Config{
+		BinDir:    filepath.Join(tmpDir, "bin"),
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, shell := range []string{ShellBash, ShellFish} {
+		setup, err := pm.ShellPathSetup(shell)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if setup.Configured || setup.InPath {
+			t.Fatalf("did not expect bin dir to be set up: %#v", setup)
+		}
+		// Existing content without a trailing newline is kept
+		if shell == ShellBash {
+			if err := os.MkdirAll(homeDir, 0o755); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := os.WriteFile(setup.RcFile, []byte("alias ll='ls -l'"), 0o644); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		// Adding the line twice only adds it once
+		for i := 0; i < 2; i++ {
+			if err := pm.AddShellPath(setup); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		content, err := os.ReadFile(setup.RcFile)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if strings.Count(string(content), setup.Line) != 1 {
+			t.Fatalf("did not find line once in rc file:\n%s", content)
+		}
+		if shell == ShellBash && !strings.HasPrefix(string(content), "alias ll='ls -l'\n\n") {
+			t.Fatalf("did not keep existing rc file content:\n%s", content)
+		}
+		setup, err = pm.ShellPathSetup(shell)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !setup.Configured {
+			t.Fatalf("expected bin dir to be set up in %s", setup.RcFile)
+		}
+	}
+}
+
+func TestUnresolvableBinaries(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		BinDir:    filepath.Join(tmpDir, "bin"),
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkg := Package{Name: "foo", Version: "1.0.0"}
+	binPath := filepath.Join(cfg.DataDir, "foo-1.0.0-default", "bin", "foo")
+	if err := os.MkdirAll(filepath.Dir(binPath), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.MkdirAll(cfg.BinDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.Symlink(binPath, filepath.Join(cfg.BinDir, "foo")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Binaries from other packages are ignored
+	if err := os.Symlink("/usr/bin/env", filepath.Join(cfg.BinDir, "other")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	otherDir := filepath.Join(tmpDir, "other")
+	if err := os.MkdirAll(otherDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "foo"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testDefs := []struct {
+		path     []string
+		expected string
+	}{
+		{path: []string{otherDir}, expected: "is not in PATH"},
+		{path: []string{cfg.BinDir, otherDir}},
+		{path: []string{otherDir, cfg.BinDir}, expected: "comes before"},
+	}
+	for _, testDef := range testDefs {
+		t.Setenv("PATH", strings.Join(testDef.path, string(os.PathListSeparator)))
+		warnings := pm.unresolvableBinaries(pkg, "default")
+		if testDef.expected == "" {
+			if len(warnings) > 0 {
+				t.Fatalf("unexpected warnings with PATH %v: %v", testDef.path, warnings)
+			}
+			continue
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], testDef.expected) {
+			t.Fatalf("did not get expected warning with PATH %v: %v", testDef.path, warnings)
+		}
+	}
+}
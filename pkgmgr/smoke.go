@@ -0,0 +1,354 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPackageTestTimeout is the amount of time that a package test is retried after
+	// install when no timeout is specified, since the service may still be starting
+	defaultPackageTestTimeout = 1 * time.Minute
+
+	// packageTestInterval is the amount of time between attempts of a failed package test
+	packageTestInterval = 2 * time.Second
+
+	// packageTestCheckTimeout is the amount of time that a single attempt of a package test may
+	// take
+	packageTestCheckTimeout = 30 * time.Second
+
+	// packageTestMaxBody is the maximum amount of an HTTP response body that's matched against
+	packageTestMaxBody = 1024 * 1024
+)
+
+// packageTestNameRe matches valid names for package tests
+var packageTestNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// PackageTest is a smoke test that checks that an installed package works. Exactly one check
+// must be specified. Tests are run after the package is installed or upgraded, and with
+// cardano-up test
+type PackageTest struct {
+	Name        string           `yaml:"name" jsonschema:"required"`
+	Description string           `yaml:"description,omitempty"`
+	Http        *PackageTestHttp `yaml:"http,omitempty"`
+	Exec        *PackageTestExec `yaml:"exec,omitempty"`
+	// Timeout is how long the test is retried after install until it passes, such as 2m. It
+	// defaults to 1 minute
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// PackageTestHttp is a test that requests a URL, which is evaluated as a template, from the
+// machine running cardano-up
+type PackageTestHttp struct {
+	Url string `yaml:"url" jsonschema:"required"`
+	// Status is the expected response status, which defaults to 200
+	Status int `yaml:"status,omitempty"`
+	// Body is a regex that the response body must match
+	Body string `yaml:"body,omitempty"`
+}
+
+// PackageTestExec is a test that runs a command in a package container, with each element
+// evaluated as a template
+type PackageTestExec struct {
+	ContainerName string   `yaml:"containerName" jsonschema:"required"`
+	Command       []string `yaml:"command" jsonschema:"required"`
+	// ExitCode is the expected exit code of the command
+	ExitCode int `yaml:"exitCode,omitempty"`
+	// Output is a regex that the combined stdout and stderr of the command must match
+	Output string `yaml:"output,omitempty"`
+}
+
+func (t PackageTest) validate(pkg Package) error {
+	if !packageTestNameRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid test name: %q", t.Name)
+	}
+	if (t.Http == nil) == (t.Exec == nil) {
+		return fmt.Errorf("test %s must specify exactly one of http or exec", t.Name)
+	}
+	if t.Timeout != "" {
+		if _, err := time.ParseDuration(t.Timeout); err != nil {
+			return fmt.Errorf("test %s: invalid timeout: %s", t.Name, err)
+		}
+	}
+	if t.Http != nil {
+		if t.Http.Url == "" {
+			return fmt.Errorf("test %s must specify a URL", t.Name)
+		}
+		if _, err := regexp.Compile(t.Http.Body); err != nil {
+			return fmt.Errorf("test %s: invalid body regex: %s", t.Name, err)
+		}
+	}
+	if t.Exec != nil {
+		if len(t.Exec.Command) == 0 || t.Exec.Command[0] == "" {
+			return fmt.Errorf("test %s must specify a command to run", t.Name)
+		}
+		if !pkg.declaresContainer(t.Exec.ContainerName) {
+			return fmt.Errorf(
+				"container %q for test %s does not match any docker install step",
+				t.Exec.ContainerName,
+				t.Name,
+			)
+		}
+		if _, err := regexp.Compile(t.Exec.Output); err != nil {
+			return fmt.Errorf("test %s: invalid output regex: %s", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p Package) validateTests() error {
+	testNames := make(map[string]bool)
+	for _, test := range p.Tests {
+		if err := test.validate(p); err != nil {
+			return err
+		}
+		if testNames[test.Name] {
+			return fmt.Errorf("duplicate test: %s", test.Name)
+		}
+		testNames[test.Name] = true
+	}
+	return nil
+}
+
+// timeout returns how long the test is retried after install
+func (t PackageTest) timeout() time.Duration {
+	if t.Timeout == "" {
+		return defaultPackageTestTimeout
+	}
+	ret, err := time.ParseDuration(t.Timeout)
+	if err != nil {
+		return defaultPackageTestTimeout
+	}
+	return ret
+}
+
+// PackageTestResult is the result of a package test
+type PackageTestResult struct {
+	// Package is the instance name of the package
+	Package string
+	Name    string
+	Passed  bool
+	// Message describes why the test failed
+	Message string
+}
+
+// TestPackages runs the tests for the specified installed packages in the active context, or
+// for all installed packages in the active context when none are specified. Each test is run
+// once
+func (p *PackageManager) TestPackages(pkgNames ...string) ([]PackageTestResult, error) {
+	var installedPkgs []InstalledPackage
+	if len(pkgNames) == 0 {
+		installedPkgs = p.InstalledPackages()
+	}
+	for _, pkgName := range pkgNames {
+		installedPkg, err := p.cliCommandPackage(pkgName)
+		if err != nil {
+			return nil, err
+		}
+		installedPkgs = append(installedPkgs, installedPkg)
+	}
+	var ret []PackageTestResult
+	for _, installedPkg := range installedPkgs {
+		ret = append(ret, p.runPackageTests(installedPkg, false)...)
+	}
+	return ret, nil
+}
+
+// testInstalledPackages runs the tests for packages that were just installed or upgraded, which
+// are retried until they pass or time out. Each result is logged, and an error is returned if
+// any tests failed
+func (p *PackageManager) testInstalledPackages(installedPkgs []InstalledPackage) error {
+	if p.config.SkipTests {
+		return nil
+	}
+	var failed []string
+	for _, installedPkg := range installedPkgs {
+		if len(installedPkg.Package.Tests) == 0 {
+			continue
+		}
+		p.config.Logger.Info(
+			fmt.Sprintf("Running tests for package %s", installedPkg.InstanceName()),
+		)
+		for _, result := range p.runPackageTests(installedPkg, true) {
+			if result.Passed {
+				p.config.Logger.Info(
+					fmt.Sprintf("PASS  %s/%s", result.Package, result.Name),
+				)
+				continue
+			}
+			p.config.Logger.Error(
+				fmt.Sprintf("FAIL  %s/%s: %s", result.Package, result.Name, result.Message),
+			)
+			failed = append(failed, result.Package+"/"+result.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return NewPackageTestsFailedError(failed)
+	}
+	return nil
+}
+
+// runPackageTests runs the tests for an installed package. When retry is set, failed tests are
+// retried until they pass or their timeout is reached
+func (p *PackageManager) runPackageTests(
+	installedPkg InstalledPackage,
+	retry bool,
+) []PackageTestResult {
+	tmpl := p.installedPackageTemplate(installedPkg)
+	ret := make([]PackageTestResult, 0, len(installedPkg.Package.Tests))
+	for _, test := range installedPkg.Package.Tests {
+		result := PackageTestResult{
+			Package: installedPkg.InstanceName(),
+			Name:    test.Name,
+		}
+		deadline := time.Now().Add(test.timeout())
+		for {
+			err := p.runPackageTest(installedPkg, test, tmpl)
+			if err == nil {
+				result.Passed = true
+				break
+			}
+			result.Message = err.Error()
+			if !retry || time.Now().After(deadline) || p.config.ctx().Err() != nil {
+				break
+			}
+			select {
+			case <-p.config.ctx().Done():
+			case <-time.After(packageTestInterval):
+			}
+		}
+		ret = append(ret, result)
+	}
+	return ret
+}
+
+// runPackageTest runs a single attempt of a package test, returning an error if it fails
+func (p *PackageManager) runPackageTest(
+	installedPkg InstalledPackage,
+	test PackageTest,
+	tmpl *Template,
+) error {
+	ctx, cancel := context.WithTimeout(p.config.ctx(), packageTestCheckTimeout)
+	defer cancel()
+	if test.Http != nil {
+		url, err := tmpl.Render(test.Http.Url, nil)
+		if err != nil {
+			return err
+		}
+		return test.Http.check(ctx, p.config.Http, url)
+	}
+	cmd := make([]string, 0, len(test.Exec.Command))
+	for _, value := range test.Exec.Command {
+		rendered, err := tmpl.Render(value, nil)
+		if err != nil {
+			return err
+		}
+		cmd = append(cmd, rendered)
+	}
+	svc, err := p.packageService(installedPkg.InstanceName(), test.Exec.ContainerName)
+	if err != nil {
+		return err
+	}
+	svc.ctx = ctx
+	running, err := svc.Running()
+	if err != nil {
+		return err
+	}
+	if !running {
+		return NewContainerNotRunningError(svc.ContainerName)
+	}
+	var output bytes.Buffer
+	exitCode, err := svc.Exec(cmd, nil, false, nil, &output, &output)
+	if err != nil {
+		return err
+	}
+	return test.Exec.check(exitCode, output.String())
+}
+
+// check requests the rendered URL and checks the response. The request uses the configured proxy
+// and CA bundle with the timeout for a single attempt
+func (t PackageTestHttp) check(ctx context.Context, httpCfg HttpConfig, url string) error {
+	httpCfg.Timeout = packageTestCheckTimeout
+	client, err := newHttpClient(httpCfg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	expectedStatus := t.Status
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("%s returned %s, expected %d", url, resp.Status, expectedStatus)
+	}
+	if t.Body == "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, packageTestMaxBody))
+	if err != nil {
+		return err
+	}
+	bodyRe, err := regexp.Compile(t.Body)
+	if err != nil {
+		return fmt.Errorf("invalid body pattern: %s", err)
+	}
+	if !bodyRe.Match(body) {
+		return fmt.Errorf("response body from %s does not match %q", url, t.Body)
+	}
+	return nil
+}
+
+// check checks the exit code and output of the command
+func (t PackageTestExec) check(exitCode int, output string) error {
+	if exitCode != t.ExitCode {
+		return fmt.Errorf(
+			"command exited with status %d, expected %d: %s",
+			exitCode,
+			t.ExitCode,
+			strings.TrimSpace(output),
+		)
+	}
+	if t.Output == "" {
+		return nil
+	}
+	outputRe, err := regexp.Compile(t.Output)
+	if err != nil {
+		return fmt.Errorf("invalid output pattern: %s", err)
+	}
+	if !outputRe.MatchString(output) {
+		return fmt.Errorf(
+			"command output does not match %q: %s",
+			t.Output,
+			strings.TrimSpace(output),
+		)
+	}
+	return nil
+}
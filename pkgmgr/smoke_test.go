@@ -0,0 +1,266 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageValidateTests(t *testing.T) {
+	testDefs := []struct {
+		tests   []PackageTest
+		invalid bool
+	}{
+		{
+			tests: []PackageTest{
+				{Name: "health", Http: &PackageTestHttp{Url: "http://localhost:1337"}},
+				{
+					Name: "tip",
+					Exec: &PackageTestExec{
+						ContainerName: "node",
+						Command:       []string{"cardano-cli", "query", "tip"},
+						Output:        `"block": \d+`,
+					},
+					Timeout: "2m",
+				},
+			},
+		},
+		{
+			tests:   []PackageTest{{Name: "Health", Http: &PackageTestHttp{Url: "http://a"}}},
+			invalid: true,
+		},
+		{
+			tests:   []PackageTest{{Name: "health"}},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{
+					Name: "health",
+					Http: &PackageTestHttp{Url: "http://a"},
+					Exec: &PackageTestExec{ContainerName: "node", Command: []string{"true"}},
+				},
+			},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{Name: "health", Http: &PackageTestHttp{Url: "http://a"}, Timeout: "soon"},
+			},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{Name: "health", Http: &PackageTestHttp{Url: "http://a", Body: "("}},
+			},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{
+					Name: "tip",
+					Exec: &PackageTestExec{ContainerName: "other", Command: []string{"true"}},
+				},
+			},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{Name: "tip", Exec: &PackageTestExec{ContainerName: "node"}},
+			},
+			invalid: true,
+		},
+		{
+			tests: []PackageTest{
+				{Name: "health", Http: &PackageTestHttp{Url: "http://a"}},
+				{Name: "health", Http: &PackageTestHttp{Url: "http://b"}},
+			},
+			invalid: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		pkg := Package{
+			Name:    "foo",
+			Version: "1.0.0",
+			InstallSteps: []PackageInstallStep{
+				{Docker: &PackageInstallStepDocker{ContainerName: "node", Image: "foo"}},
+			},
+			Tests: testDef.tests,
+		}
+		err := pkg.validateTests()
+		if testDef.invalid && err == nil {
+			t.Fatalf("did not get expected error for tests %#v", testDef.tests)
+		}
+		if !testDef.invalid && err != nil {
+			t.Fatalf("unexpected error for tests %#v: %s", testDef.tests, err)
+		}
+	}
+}
+
+func TestPackageTestHttpCheck(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		}),
+	)
+	defer server.Close()
+	testDefs := []struct {
+		test PackageTestHttp
+		path string
+		fail bool
+	}{
+		{test: PackageTestHttp{}, path: "/"},
+		{test: PackageTestHttp{Body: `"status":"ok"`}, path: "/"},
+		{test: PackageTestHttp{Body: `"status":"error"`}, path: "/", fail: true},
+		{test: PackageTestHttp{}, path: "/missing", fail: true},
+		{test: PackageTestHttp{Status: http.StatusNotFound}, path: "/missing"},
+		{test: PackageTestHttp{Body: `"status":(`}, path: "/", fail: true},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.test.check(
+			context.Background(),
+			HttpConfig{},
+			server.URL+testDef.path,
+		)
+		if testDef.fail && err == nil {
+			t.Fatalf("did not get expected failure for test %#v", testDef.test)
+		}
+		if !testDef.fail && err != nil {
+			t.Fatalf("unexpected failure for test %#v: %s", testDef.test, err)
+		}
+	}
+}
+
+func TestPackageTestHttpCheckProxy(t *testing.T) {
+	// The proxy answers requests for a host that doesn't resolve
+	proxy := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Host != "node.invalid" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		}),
+	)
+	defer proxy.Close()
+	test := PackageTestHttp{Body: `"status":"ok"`}
+	err := test.check(
+		context.Background(),
+		HttpConfig{ProxyUrl: proxy.URL},
+		"http://node.invalid/health",
+	)
+	if err != nil {
+		t.Fatalf("unexpected failure: %s", err)
+	}
+}
+
+func TestPackageTestExecCheck(t *testing.T) {
+	testDefs := []struct {
+		test     PackageTestExec
+		exitCode int
+		output   string
+		fail     bool
+	}{
+		{test: PackageTestExec{}, exitCode: 0},
+		{test: PackageTestExec{}, exitCode: 1, fail: true},
+		{test: PackageTestExec{ExitCode: 1}, exitCode: 1},
+		{test: PackageTestExec{Output: `"block": \d+`}, output: `{"block": 1234}`},
+		{test: PackageTestExec{Output: `"block": \d+`}, output: `{}`, fail: true},
+		{test: PackageTestExec{Output: `"block": (`}, output: `{"block": 1234}`, fail: true},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.test.check(testDef.exitCode, testDef.output)
+		if testDef.fail && err == nil {
+			t.Fatalf("did not get expected failure for test %#v", testDef.test)
+		}
+		if !testDef.fail && err != nil {
+			t.Fatalf("unexpected failure for test %#v: %s", testDef.test, err)
+		}
+	}
+}
+
+func TestTestPackages(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+	)
+	defer server.Close()
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	installedPkg := InstalledPackage{
+		Package: Package{
+			Name:    "foo",
+			Version: "1.0.0",
+			Tests: []PackageTest{
+				{Name: "health", Http: &PackageTestHttp{Url: server.URL}},
+				{
+					Name:    "missing",
+					Http:    &PackageTestHttp{Url: server.URL + "/missing"},
+					Timeout: "1ns",
+				},
+			},
+		},
+		Context: activeContextName,
+	}
+	pm.state.InstalledPackages = []InstalledPackage{installedPkg}
+	results, err := pm.TestPackages("foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("did not get expected number of results: %#v", results)
+	}
+	if !results[0].Passed || results[0].Name != "health" || results[0].Package != "foo" {
+		t.Fatalf("did not get expected result: %#v", results[0])
+	}
+	if results[1].Passed || results[1].Message == "" {
+		t.Fatalf("did not get expected result: %#v", results[1])
+	}
+	if _, err := pm.TestPackages("bar"); err == nil {
+		t.Fatalf("did not get expected error for package that isn't installed")
+	}
+	err = pm.testInstalledPackages([]InstalledPackage{installedPkg})
+	if !errors.Is(err, ErrPackageTestsFailed) {
+		t.Fatalf("did not get expected error: got %v", err)
+	}
+	// Tests aren't run after install when they're skipped
+	pm.config.SkipTests = true
+	if err := pm.testInstalledPackages([]InstalledPackage{installedPkg}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// socketsDirName is the dir in the context dir that contains the dir for each package's sockets
+const socketsDirName = "sockets"
+
+// PackageSocket declares a Unix socket exposed by a package, such as the node socket. The dir
+// containing the socket is bind mounted at the same path in each container that uses the socket
+// via the sockets field of docker install steps, including the container that creates it
+type PackageSocket struct {
+	Name        string `yaml:"name" jsonschema:"required"`
+	Description string `yaml:"description,omitempty"`
+	// ContainerPath is the path to the socket inside containers
+	ContainerPath string `yaml:"containerPath" jsonschema:"required"`
+	// Env is the name of an env var set to the path of the socket. It's set to the path inside
+	// the container for containers using the socket, and to the path on the host in the context
+	// env for the primary instance of the package
+	Env string `yaml:"env,omitempty"`
+}
+
+func (s PackageSocket) validate() error {
+	reName := regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*$`)
+	if !reName.Match([]byte(s.Name)) {
+		return fmt.Errorf("invalid socket name: %s", s.Name)
+	}
+	if !path.IsAbs(s.ContainerPath) || path.Base(s.ContainerPath) == "/" {
+		return fmt.Errorf(
+			"socket %s must have an absolute container path: %s",
+			s.Name,
+			s.ContainerPath,
+		)
+	}
+	reEnv := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	if s.Env != "" && !reEnv.Match([]byte(s.Env)) {
+		return fmt.Errorf("invalid env var name for socket %s: %s", s.Name, s.Env)
+	}
+	return nil
+}
+
+// socketMount is a socket available to a package being installed, along with the dir on the host
+// that contains it
+type socketMount struct {
+	PackageSocket
+	hostDir string
+}
+
+// hostPath returns the path to the socket on the host
+func (s socketMount) hostPath() string {
+	return filepath.Join(s.hostDir, path.Base(s.ContainerPath))
+}
+
+// bind returns the container bind mount for the dir containing the socket
+func (s socketMount) bind() string {
+	return fmt.Sprintf("%s:%s", s.hostDir, path.Dir(s.ContainerPath))
+}
+
+// usesSocket returns whether the socket is mounted into the container
+func (p *PackageInstallStepDocker) usesSocket(socketName string) bool {
+	for _, tmpSocketName := range p.Sockets {
+		if tmpSocketName == socketName {
+			return true
+		}
+	}
+	return false
+}
+
+// socketHostDir returns the dir on the host for the sockets of a package instance in a context
+func socketHostDir(cfg Config, context string, instanceName string) string {
+	return filepath.Join(cfg.DataDir, context, socketsDirName, instanceName)
+}
+
+// socketMounts returns the sockets declared by the package
+func (p Package) socketMounts(cfg Config, context string) map[string]socketMount {
+	ret := make(map[string]socketMount)
+	for _, socket := range p.Sockets {
+		ret[socket.Name] = socketMount{
+			PackageSocket: socket,
+			hostDir:       socketHostDir(cfg, context, p.instanceName()),
+		}
+	}
+	return ret
+}
+
+// socketEnv returns the context env vars for the sockets declared by the package. Only the primary
+// instance of a package provides these, so that additional instances don't override them
+func (p Package) socketEnv(cfg Config, context string) map[string]string {
+	ret := make(map[string]string)
+	if p.instance != "" {
+		return ret
+	}
+	for _, socket := range p.socketMounts(cfg, context) {
+		if socket.Env == "" {
+			continue
+		}
+		ret[socket.Env] = socket.hostPath()
+	}
+	return ret
+}
+
+// packageSockets returns the sockets available to a package being installed. These are the
+// sockets declared by the package itself and by the primary instances of packages installed in
+// the context
+func (p *PackageManager) packageSockets(pkg Package, context string) map[string]socketMount {
+	ret := make(map[string]socketMount)
+	for _, installedPkg := range p.state.InstalledPackages {
+		if installedPkg.Context != context || installedPkg.Instance != "" {
+			continue
+		}
+		for name, socket := range installedPkg.Package.socketMounts(p.config, context) {
+			ret[name] = socket
+		}
+	}
+	for name, socket := range pkg.socketMounts(p.config, context) {
+		ret[name] = socket
+	}
+	return ret
+}
+
+// socketTemplateVars returns the template vars for the available sockets
+func socketTemplateVars(sockets map[string]socketMount) map[string]any {
+	tmpSockets := make(map[string]any)
+	for name, socket := range sockets {
+		tmpSockets[name] = map[string]string{
+			"Path":          socket.hostPath(),
+			"ContainerPath": socket.ContainerPath,
+		}
+	}
+	return map[string]any{
+		"Sockets": tmpSockets,
+	}
+}
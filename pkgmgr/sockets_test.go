@@ -0,0 +1,102 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPackageSockets(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	nodePkg := Package{
+		Name:    "cardano-node",
+		Version: "1.0.0",
+		Sockets: []PackageSocket{
+			{
+				Name:          "node",
+				ContainerPath: "/ipc/node.socket",
+				Env:           "CARDANO_NODE_SOCKET_PATH",
+			},
+		},
+	}
+	relayPkg := nodePkg
+	relayPkg.instance = "relay"
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       nodePkg,
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       relayPkg,
+			Context:       "default",
+			Instance:      "relay",
+			InstalledTime: time.Now(),
+		},
+	}
+	expectedHostPath := filepath.Join(
+		cfg.DataDir,
+		"default",
+		"sockets",
+		"cardano-node",
+		"node.socket",
+	)
+	// The context env uses the socket for the primary instance
+	if env := nodePkg.socketEnv(cfg, "default"); env["CARDANO_NODE_SOCKET_PATH"] != expectedHostPath {
+		t.Fatalf("did not get expected socket env: %v", env)
+	}
+	if env := relayPkg.socketEnv(cfg, "default"); len(env) != 0 {
+		t.Fatalf("additional instance should not provide socket env: %v", env)
+	}
+	// Dependent packages get the dir containing the socket mounted, along with the env var
+	cliPkg := Package{Name: "cardano-cli", Version: "1.0.0"}
+	installCfg := cfg
+	installCfg.sockets = pm.packageSockets(cliPkg, "default")
+	step := PackageInstallStepDocker{
+		ContainerName: "cli",
+		Image:         "example/cardano-cli:1.0.0",
+		Sockets:       []string{"node"},
+	}
+	svc, err := step.render(installCfg, "cardano-cli-1.0.0-default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedBind := filepath.Dir(expectedHostPath) + ":/ipc"
+	if len(svc.Binds) != 1 || svc.Binds[0] != expectedBind {
+		t.Fatalf("did not get expected binds: got %v, expected %s", svc.Binds, expectedBind)
+	}
+	if svc.Env["CARDANO_NODE_SOCKET_PATH"] != "/ipc/node.socket" {
+		t.Fatalf("did not get expected socket env in container: %v", svc.Env)
+	}
+	// Sockets that aren't available are an error
+	step.Sockets = []string{"missing"}
+	if _, err := step.render(installCfg, "cardano-cli-1.0.0-default"); err == nil {
+		t.Fatalf("did not get expected error for unknown socket")
+	}
+}
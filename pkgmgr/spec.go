@@ -0,0 +1,517 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// PackageSpecVersion is the newest package spec version supported by this version of cardano-up.
+	// This should be bumped once for each release that adds new fields to the package spec, along
+	// with adding a converter from the previous version in specConverters
+	PackageSpecVersion = 2
+
+	// defaultPackageSpecVersion is used for packages that don't specify a spec version
+	defaultPackageSpecVersion = 1
+)
+
+// specConverter upgrades the raw content of a package manifest from one spec version to the next
+type specConverter func(map[string]any) error
+
+// specConverters maps a spec version to the converter that upgrades a package manifest from that
+// version to the next
+var specConverters = map[int]specConverter{
+	1: convertSpecAddedFields,
+}
+
+// convertSpecAddedFields is used for spec versions that only add optional fields, which don't
+// require any changes to older package manifests
+func convertSpecAddedFields(rawPkg map[string]any) error {
+	return nil
+}
+
+// specField is a package spec field that was added after the initial spec version
+type specField struct {
+	// field is the path to the field in the package manifest
+	field string
+	// version is the spec version that added the field
+	version int
+	// used returns whether the package uses the field
+	used func(Package) bool
+}
+
+// specFields lists the package spec fields added after the initial spec version. Packages using
+// these fields must declare at least the spec version that added them, so that older versions of
+// cardano-up skip the package rather than failing to load it
+var specFields = []specField{
+	{
+		field:   "installSteps[].docker.logs",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Docker != nil && installStep.Docker.Logs != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "topology",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Topology != nil
+		},
+	},
+	{
+		field:   "secrets",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.Secrets) > 0
+		},
+	},
+	{
+		field:   "installSteps[].docker.secretEnv",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Docker != nil && len(installStep.Docker.SecretEnv) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "options[].dependencies",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.GroupOptions()) > 0
+		},
+	},
+	{
+		field:   "sockets",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.Sockets) > 0
+		},
+	},
+	{
+		field:   "installSteps[].docker.sockets",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Docker != nil && len(installStep.Docker.Sockets) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "blockProducer",
+		version: 2,
+		used: func(p Package) bool {
+			return p.BlockProducer != nil
+		},
+	},
+	{
+		field:   "dependencies[].condition",
+		version: 2,
+		used: func(p Package) bool {
+			for _, dep := range p.Dependencies {
+				if dep.Condition != "" {
+					return true
+				}
+			}
+			for _, opt := range p.Options {
+				for _, dep := range opt.Dependencies {
+					if dep.Condition != "" {
+						return true
+					}
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "installSteps[].docker.platform",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Docker != nil && installStep.Docker.Platform != "" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "installSteps[].docker.user",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Docker != nil && installStep.Docker.User != "" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "installSteps[].docker.extraHosts",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.ExtraHosts) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.dns",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.Dns) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.sysctls",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.Sysctls) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.ulimits",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.Ulimits) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.capAdd",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.CapAdd) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.capDrop",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.CapDrop) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.shmSize",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return d.ShmSize != ""
+		}),
+	},
+	{
+		field:   "installSteps[].docker.readOnly",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return d.ReadOnly
+		}),
+	},
+	{
+		field:   "installSteps[].network",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Network != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "installSteps[].docker.networks",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.Networks) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].compose",
+		version: 2,
+		used: func(p Package) bool {
+			for _, installStep := range p.InstallSteps {
+				if installStep.Compose != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "wallet",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Wallet != nil
+		},
+	},
+	{
+		field:   "notes",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.Notes) > 0
+		},
+	},
+	{
+		field:   "deprecated",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Deprecated
+		},
+	},
+	{
+		field:   "supersededBy",
+		version: 2,
+		used: func(p Package) bool {
+			return p.SupersededBy != ""
+		},
+	},
+	{
+		field:   "eolDate",
+		version: 2,
+		used: func(p Package) bool {
+			return p.EolDate != ""
+		},
+	},
+	{
+		field:   "stateful",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Stateful
+		},
+	},
+	{
+		field:   "changelog",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Changelog != ""
+		},
+	},
+	{
+		field:   "releaseNotesUrl",
+		version: 2,
+		used: func(p Package) bool {
+			return p.ReleaseNotesUrl != ""
+		},
+	},
+	{
+		field:   "dataSchemaVersion",
+		version: 2,
+		used: func(p Package) bool {
+			return p.DataSchemaVersion != 0
+		},
+	},
+	{
+		field:   "minDiskSpace",
+		version: 2,
+		used: func(p Package) bool {
+			return p.MinDiskSpace != ""
+		},
+	},
+	{
+		field:   "installSteps[].docker.tmpfs",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return len(d.Tmpfs) > 0
+		}),
+	},
+	{
+		field:   "installSteps[].docker.interactive",
+		version: 2,
+		used: dockerStepsUse(func(d *PackageInstallStepDocker) bool {
+			return d.Interactive
+		}),
+	},
+	{
+		field:   "database",
+		version: 2,
+		used: func(p Package) bool {
+			return p.Database != nil
+		},
+	},
+	{
+		field:   "cliCommands",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.CliCommands) > 0
+		},
+	},
+	{
+		field:   "installSteps[].file.sourceDir",
+		version: 2,
+		used: fileStepsUse(func(f *PackageInstallStepFile) bool {
+			return f.SourceDir != ""
+		}),
+	},
+	{
+		field:   "installSteps[].file.extract",
+		version: 2,
+		used: fileStepsUse(func(f *PackageInstallStepFile) bool {
+			return f.Extract
+		}),
+	},
+	{
+		field:   "installSteps[].file.foreach",
+		version: 2,
+		used: fileStepsUse(func(f *PackageInstallStepFile) bool {
+			return len(f.Foreach) > 0
+		}),
+	},
+	{
+		field:   "outputs[].ready",
+		version: 2,
+		used: func(p Package) bool {
+			for _, output := range p.Outputs {
+				if output.Ready != nil {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "migrations",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.Migrations) > 0
+		},
+	},
+	{
+		field:   "options[].type",
+		version: 2,
+		used: func(p Package) bool {
+			for _, opt := range p.Options {
+				if opt.Type != "" {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		field:   "tests",
+		version: 2,
+		used: func(p Package) bool {
+			return len(p.Tests) > 0
+		},
+	},
+}
+
+// dockerStepsUse returns whether any docker install step of a package uses a field
+func dockerStepsUse(used func(*PackageInstallStepDocker) bool) func(Package) bool {
+	return func(p Package) bool {
+		for _, installStep := range p.InstallSteps {
+			if installStep.Docker != nil && used(installStep.Docker) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// fileStepsUse returns whether any file install step of a package uses a field
+func fileStepsUse(used func(*PackageInstallStepFile) bool) func(Package) bool {
+	return func(p Package) bool {
+		for _, installStep := range p.InstallSteps {
+			if installStep.File != nil && used(installStep.File) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// specVersionProblems returns a problem for each field used by the package that requires a newer
+// spec version than the package declares
+func (p Package) specVersionProblems() []string {
+	specVersion := p.SpecVersion
+	if specVersion == 0 {
+		specVersion = defaultPackageSpecVersion
+	}
+	var ret []string
+	for _, tmpField := range specFields {
+		if tmpField.version <= specVersion || !tmpField.used(p) {
+			continue
+		}
+		ret = append(
+			ret,
+			fmt.Sprintf(
+				"field %s requires specVersion %d or newer",
+				tmpField.field,
+				tmpField.version,
+			),
+		)
+	}
+	return ret
+}
+
+// convertPackageSpec upgrades raw package manifest content from an older spec version to the current
+// spec version. The returned content can be decoded directly into a Package
+func convertPackageSpec(data []byte) ([]byte, error) {
+	return convertPackageSpecTo(data, PackageSpecVersion, specConverters)
+}
+
+// convertPackageSpecTo upgrades raw package manifest content to the target spec version using the
+// provided converters. The declared spec version is left as-is in the returned content, so that
+// it can be checked against the fields used by the package
+func convertPackageSpecTo(
+	data []byte,
+	targetVersion int,
+	converters map[int]specConverter,
+) ([]byte, error) {
+	var header struct {
+		SpecVersion int `yaml:"specVersion"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	specVersion := header.SpecVersion
+	if specVersion == 0 {
+		specVersion = defaultPackageSpecVersion
+	}
+	if specVersion > targetVersion {
+		return nil, NewPackageSpecVersionUnsupportedError(specVersion)
+	}
+	if specVersion < 0 {
+		return nil, NewPackageSpecVersionInvalidError(specVersion)
+	}
+	if specVersion == targetVersion {
+		return data, nil
+	}
+	var rawPkg map[string]any
+	if err := yaml.Unmarshal(data, &rawPkg); err != nil {
+		return nil, err
+	}
+	for ; specVersion < targetVersion; specVersion++ {
+		converter, ok := converters[specVersion]
+		if !ok {
+			return nil, NewPackageSpecVersionNoConverterError(specVersion)
+		}
+		if err := converter(rawPkg); err != nil {
+			return nil, err
+		}
+	}
+	return yaml.Marshal(rawPkg)
+}
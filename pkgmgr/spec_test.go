@@ -0,0 +1,140 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestConvertPackageSpecTo(t *testing.T) {
+	// Test converters that rename a field in each version
+	testConverters := map[int]specConverter{
+		1: func(rawPkg map[string]any) error {
+			rawPkg["summary"] = rawPkg["blurb"]
+			delete(rawPkg, "blurb")
+			return nil
+		},
+		2: func(rawPkg map[string]any) error {
+			rawPkg["description"] = rawPkg["summary"]
+			delete(rawPkg, "summary")
+			return nil
+		},
+	}
+	testDefs := []struct {
+		yaml        string
+		expectedErr error
+	}{
+		{
+			yaml: "name: foo\nversion: 1.2.3\nblurb: foo package",
+		},
+		{
+			yaml: "specVersion: 2\nname: foo\nversion: 1.2.3\nsummary: foo package",
+		},
+		{
+			yaml: "specVersion: 3\nname: foo\nversion: 1.2.3\ndescription: foo package",
+		},
+		{
+			yaml:        "specVersion: 4\nname: foo\nversion: 1.2.3",
+			expectedErr: ErrPackageSpecVersionUnsupported,
+		},
+	}
+	for _, testDef := range testDefs {
+		data, err := convertPackageSpecTo([]byte(testDef.yaml), 3, testConverters)
+		if testDef.expectedErr != nil {
+			if !errors.Is(err, testDef.expectedErr) {
+				t.Fatalf(
+					"did not get expected error: got %v, expected %v",
+					err,
+					testDef.expectedErr,
+				)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var pkg Package
+		if err := yaml.Unmarshal(data, &pkg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pkg.Description != "foo package" {
+			t.Fatalf("did not get expected description: %q", pkg.Description)
+		}
+	}
+}
+
+func TestConvertPackageSpecToMissingConverter(t *testing.T) {
+	_, err := convertPackageSpecTo([]byte("name: foo"), 2, map[int]specConverter{})
+	if err == nil {
+		t.Fatalf("did not get expected error")
+	}
+}
+
+func TestConvertPackageSpecInvalidYaml(t *testing.T) {
+	if _, err := convertPackageSpec([]byte("specVersion: [")); err == nil {
+		t.Fatalf("did not get expected error")
+	}
+}
+
+func TestPackageSpecVersionProblems(t *testing.T) {
+	pkg := Package{
+		Name:    "foo",
+		Version: "1.2.3",
+		InstallSteps: []PackageInstallStep{
+			{
+				Docker: &PackageInstallStepDocker{
+					Logs: &PackageInstallStepDockerLogs{},
+				},
+			},
+		},
+	}
+	if problems := pkg.specVersionProblems(); len(problems) != 1 {
+		t.Fatalf("did not get expected problems: %v", problems)
+	}
+	pkg.SpecVersion = 2
+	if problems := pkg.specVersionProblems(); len(problems) != 0 {
+		t.Fatalf("got unexpected problems: %v", problems)
+	}
+	// Each field that requires a newer spec version is reported
+	pkg.SpecVersion = 1
+	pkg.Topology = &PackageTopology{Filename: "topology.json"}
+	pkg.Secrets = []PackageSecret{{Name: "api-key"}}
+	pkg.InstallSteps[0].Docker.SecretEnv = map[string]string{"API_KEY": "api-key"}
+	pkg.InstallSteps[0].Docker.Ulimits = []string{"nofile=65536"}
+	if problems := pkg.specVersionProblems(); len(problems) != 5 {
+		t.Fatalf("did not get expected problems: %v", problems)
+	}
+	pkg.SpecVersion = 2
+	if problems := pkg.specVersionProblems(); len(problems) != 0 {
+		t.Fatalf("got unexpected problems: %v", problems)
+	}
+}
+
+func TestConvertPackageSpecOlderVersion(t *testing.T) {
+	pkg, err := NewPackageFromReader(
+		strings.NewReader("specVersion: 1\nname: foo\nversion: 1.2.3"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The declared spec version is kept
+	if pkg.SpecVersion != 1 {
+		t.Fatalf("did not get expected spec version: %d", pkg.SpecVersion)
+	}
+}
@@ -0,0 +1,681 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+)
+
+const (
+	// Filenames for the KES key pair and operational certificate in the block producer keys dir
+	kesSigningKeyFilename      = "kes.skey"
+	kesVerificationKeyFilename = "kes.vkey"
+	opCertFilename             = "opcert.cert"
+
+	// KES parameters for the public networks, which are used unless the context provides a
+	// Shelley genesis file
+	defaultSlotsPerKESPeriod = 129600
+	defaultMaxKESEvolutions  = 62
+	defaultSlotLength        = time.Second
+
+	// spoColdSigningKeyPath and spoCounterFilename are where the cold signing key and the
+	// operational certificate issue counter are made available to cardano-cli
+	spoColdSigningKeyPath = "/cold/cold.skey"
+	spoCounterFilename    = "cold.counter"
+)
+
+// PackageBlockProducer declares where a block producer package expects its KES key and
+// operational certificate, which allows managing them with cardano-up
+type PackageBlockProducer struct {
+	// KeysDir is the dir containing the KES key pair and operational certificate, relative to
+	// the package data dir
+	KeysDir string `yaml:"keysDir" jsonschema:"required"`
+	// ContainerName is the container to restart when the keys change. All containers for the
+	// package are restarted if not specified
+	ContainerName string `yaml:"containerName,omitempty"`
+}
+
+func (p *PackageBlockProducer) validate(installSteps []PackageInstallStep) error {
+	if p.KeysDir == "" {
+		return fmt.Errorf("block producer keys dir cannot be empty")
+	}
+	if filepath.IsAbs(p.KeysDir) ||
+		strings.HasPrefix(filepath.Clean(p.KeysDir), "..") {
+		return fmt.Errorf(
+			"block producer keys dir must be relative to the package data dir: %s",
+			p.KeysDir,
+		)
+	}
+	if p.ContainerName != "" {
+		if p.dockerStep(installSteps) == nil {
+			return fmt.Errorf(
+				"block producer container %q does not match any docker install step",
+				p.ContainerName,
+			)
+		}
+	}
+	return nil
+}
+
+// dockerStep returns the docker install step for the block producer container, which defaults
+// to the first docker install step
+func (p *PackageBlockProducer) dockerStep(
+	installSteps []PackageInstallStep,
+) *PackageInstallStepDocker {
+	for _, installStep := range installSteps {
+		if installStep.Docker == nil {
+			continue
+		}
+		if p.ContainerName == "" || installStep.Docker.ContainerName == p.ContainerName {
+			return installStep.Docker
+		}
+	}
+	return nil
+}
+
+// SPOKeyStatus describes the operational certificate for a block producer package
+type SPOKeyStatus struct {
+	Package InstalledPackage
+	// OpCertCounter is the issue counter of the operational certificate
+	OpCertCounter uint64
+	// OpCertKESPeriod is the KES period that the operational certificate starts at
+	OpCertKESPeriod uint64
+	// CurrentKESPeriod is the KES period for the current tip of the node
+	CurrentKESPeriod uint64
+	// ExpiryKESPeriod is the first KES period that the KES key can no longer be used for
+	ExpiryKESPeriod uint64
+	// Expires is the estimated time that the KES key expires
+	Expires time.Time
+}
+
+// ExpiresWithin returns whether the KES key expires within the provided duration, or has
+// already expired
+func (s SPOKeyStatus) ExpiresWithin(d time.Duration) bool {
+	return time.Until(s.Expires) < d
+}
+
+// SPOIssueOptions controls issuing an operational certificate
+type SPOIssueOptions struct {
+	// ColdSigningKey is the path to the pool cold signing key
+	ColdSigningKey string
+	// OpCertCounter is the path to the operational certificate issue counter for the cold key,
+	// which is updated when the certificate is issued
+	OpCertCounter string
+	// KESPeriod is the KES period that the certificate starts at. The current KES period is
+	// queried from the node if not provided
+	KESPeriod *uint64
+}
+
+// kesParams holds the KES parameters for a network
+type kesParams struct {
+	slotsPerKESPeriod uint64
+	maxKESEvolutions  uint64
+	slotLength        time.Duration
+}
+
+// SPOStatus returns the operational certificate status for the specified block producer package
+// in the active context. If no package is specified, the only installed package that declares a
+// block producer is used
+func (p *PackageManager) SPOStatus(pkgName string) (SPOKeyStatus, error) {
+	installedPkg, err := p.blockProducerPackage(pkgName)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	keysDir, err := p.blockProducerKeysDir(installedPkg)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	return p.spoKeyStatus(installedPkg, keysDir)
+}
+
+// RotateKES generates a new KES key pair for a block producer package and issues an operational
+// certificate for it. The new key and certificate replace the current ones in the package's keys
+// dir, and the block producer container is restarted to pick them up
+func (p *PackageManager) RotateKES(pkgName string, opts SPOIssueOptions) (SPOKeyStatus, error) {
+	return p.issueOpCert(pkgName, opts, true)
+}
+
+// IssueOpCert issues a new operational certificate for the current KES key of a block producer
+// package, and restarts the block producer container to pick it up
+func (p *PackageManager) IssueOpCert(pkgName string, opts SPOIssueOptions) (SPOKeyStatus, error) {
+	return p.issueOpCert(pkgName, opts, false)
+}
+
+// ImportSPOKeys copies key files, such as the VRF signing key, into the keys dir for a block
+// producer package and restarts the block producer container to pick them up. Signing keys are
+// only readable by the current user, which cardano-node requires
+func (p *PackageManager) ImportSPOKeys(pkgName string, paths []string) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	installedPkg, err := p.blockProducerPackage(pkgName)
+	if err != nil {
+		return err
+	}
+	keysDir, err := p.blockProducerKeysDir(installedPkg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(keysDir, 0o700); err != nil {
+		return err
+	}
+	for _, tmpPath := range paths {
+		if err := copyKeyFile(tmpPath, filepath.Join(keysDir, filepath.Base(tmpPath))); err != nil {
+			return err
+		}
+		p.config.Logger.Debug(
+			fmt.Sprintf("imported key file %s into %s", tmpPath, keysDir),
+		)
+	}
+	return p.restartPackageContainers(
+		installedPkg,
+		installedPkg.Package.BlockProducer.ContainerName,
+		"key changes",
+	)
+}
+
+func (p *PackageManager) issueOpCert(
+	pkgName string,
+	opts SPOIssueOptions,
+	rotateKES bool,
+) (SPOKeyStatus, error) {
+	unlock, err := p.lock()
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	defer unlock()
+	installedPkg, err := p.blockProducerPackage(pkgName)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	keysDir, err := p.blockProducerKeysDir(installedPkg)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	for _, tmpPath := range []string{opts.ColdSigningKey, opts.OpCertCounter} {
+		if _, err := os.Stat(tmpPath); err != nil {
+			return SPOKeyStatus{}, err
+		}
+	}
+	coldSigningKey, err := filepath.Abs(opts.ColdSigningKey)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	if !rotateKES {
+		if _, err := os.Stat(filepath.Join(keysDir, kesVerificationKeyFilename)); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return SPOKeyStatus{}, NewSPOKeyNotFoundError(
+					kesVerificationKeyFilename,
+					keysDir,
+				)
+			}
+			return SPOKeyStatus{}, err
+		}
+	}
+	params, err := p.kesParams(installedPkg.Context)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	var slot, kesPeriod uint64
+	if opts.KESPeriod != nil {
+		// Assume the start of the provided KES period, since the node may not be running
+		kesPeriod = *opts.KESPeriod
+		slot = kesPeriod * params.slotsPerKESPeriod
+	} else {
+		slot, err = p.currentSlot(installedPkg.Context)
+		if err != nil {
+			return SPOKeyStatus{}, err
+		}
+		kesPeriod = slot / params.slotsPerKESPeriod
+	}
+	image, err := p.blockProducerImage(installedPkg)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	// Generate the new files in a work dir, so that the current keys are only replaced once
+	// everything has succeeded
+	if err := os.MkdirAll(keysDir, 0o700); err != nil {
+		return SPOKeyStatus{}, err
+	}
+	workDir, err := os.MkdirTemp(keysDir, ".work-")
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	defer os.RemoveAll(workDir)
+	if err := copyKeyFile(opts.OpCertCounter, filepath.Join(workDir, spoCounterFilename)); err != nil {
+		return SPOKeyStatus{}, err
+	}
+	kesVkeyPath := "/keys/" + kesVerificationKeyFilename
+	newFiles := []string{opCertFilename}
+	if rotateKES {
+		p.config.Logger.Info("Generating KES key pair")
+		if err := p.runSpoCli(
+			image,
+			installedPkg,
+			keysDir,
+			workDir,
+			"",
+			"conway", "node", "key-gen-KES",
+			"--verification-key-file", "/work/"+kesVerificationKeyFilename,
+			"--signing-key-file", "/work/"+kesSigningKeyFilename,
+		); err != nil {
+			return SPOKeyStatus{}, err
+		}
+		kesVkeyPath = "/work/" + kesVerificationKeyFilename
+		newFiles = append(newFiles, kesSigningKeyFilename, kesVerificationKeyFilename)
+	}
+	p.config.Logger.Info(
+		fmt.Sprintf("Issuing operational certificate starting at KES period %d", kesPeriod),
+	)
+	if err := p.runSpoCli(
+		image,
+		installedPkg,
+		keysDir,
+		workDir,
+		coldSigningKey,
+		"conway", "node", "issue-op-cert",
+		"--kes-verification-key-file", kesVkeyPath,
+		"--cold-signing-key-file", spoColdSigningKeyPath,
+		"--operational-certificate-issue-counter-file", "/work/"+spoCounterFilename,
+		"--kes-period", strconv.FormatUint(kesPeriod, 10),
+		"--out-file", "/work/"+opCertFilename,
+	); err != nil {
+		return SPOKeyStatus{}, err
+	}
+	// Update the issue counter, and move the new files into place
+	if err := copyKeyFile(filepath.Join(workDir, spoCounterFilename), opts.OpCertCounter); err != nil {
+		return SPOKeyStatus{}, err
+	}
+	for _, filename := range newFiles {
+		mode := fs.FileMode(0o644)
+		if strings.HasSuffix(filename, ".skey") {
+			mode = 0o600
+		}
+		tmpPath := filepath.Join(workDir, filename)
+		if err := os.Chmod(tmpPath, mode); err != nil {
+			return SPOKeyStatus{}, err
+		}
+		if err := os.Rename(tmpPath, filepath.Join(keysDir, filename)); err != nil {
+			return SPOKeyStatus{}, err
+		}
+	}
+	if err := p.restartPackageContainers(
+		installedPkg,
+		installedPkg.Package.BlockProducer.ContainerName,
+		"key changes",
+	); err != nil {
+		return SPOKeyStatus{}, err
+	}
+	counter, startPeriod, err := readOpCert(filepath.Join(keysDir, opCertFilename))
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	return newSPOKeyStatus(installedPkg, counter, startPeriod, slot, params, time.Now()), nil
+}
+
+// runSpoCli runs cardano-cli in a one-shot container with the keys dir mounted read-only at /keys
+// and the work dir mounted at /work. The cold signing key is mounted read-only if provided
+func (p *PackageManager) runSpoCli(
+	image string,
+	installedPkg InstalledPackage,
+	keysDir string,
+	workDir string,
+	coldSigningKey string,
+	args ...string,
+) error {
+	svc := DockerService{
+		logger:   p.config.Logger,
+		ctx:      p.config.ctx(),
+		retryCfg: p.config.DockerRetry,
+		oneShot:  true,
+		ContainerName: fmt.Sprintf(
+			"cardano-up-spo-%s-%s",
+			installedPkg.InstanceName(),
+			installedPkg.Context,
+		),
+		Image:   image,
+		Command: []string{cardanoCliCommand},
+		Args:    args,
+		Binds: []string{
+			keysDir + ":/keys:ro",
+			workDir + ":/work",
+		},
+	}
+	if coldSigningKey != "" {
+		svc.Binds = append(svc.Binds, coldSigningKey+":"+spoColdSigningKeyPath+":ro")
+	}
+	exitCode, output, err := svc.runOneShot()
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return NewSPOCliError(exitCode, output)
+	}
+	return nil
+}
+
+// spoKeyStatus returns the status of the operational certificate in the keys dir
+func (p *PackageManager) spoKeyStatus(
+	installedPkg InstalledPackage,
+	keysDir string,
+) (SPOKeyStatus, error) {
+	counter, startPeriod, err := readOpCert(filepath.Join(keysDir, opCertFilename))
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	params, err := p.kesParams(installedPkg.Context)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	slot, err := p.currentSlot(installedPkg.Context)
+	if err != nil {
+		return SPOKeyStatus{}, err
+	}
+	return newSPOKeyStatus(installedPkg, counter, startPeriod, slot, params, time.Now()), nil
+}
+
+// newSPOKeyStatus calculates the status of an operational certificate at the provided slot
+func newSPOKeyStatus(
+	installedPkg InstalledPackage,
+	counter uint64,
+	startPeriod uint64,
+	slot uint64,
+	params kesParams,
+	now time.Time,
+) SPOKeyStatus {
+	expiryPeriod := startPeriod + params.maxKESEvolutions
+	expirySlot := expiryPeriod * params.slotsPerKESPeriod
+	remaining := time.Duration(0)
+	if expirySlot > slot {
+		remaining = time.Duration(expirySlot-slot) * params.slotLength
+	}
+	return SPOKeyStatus{
+		Package:          installedPkg,
+		OpCertCounter:    counter,
+		OpCertKESPeriod:  startPeriod,
+		CurrentKESPeriod: slot / params.slotsPerKESPeriod,
+		ExpiryKESPeriod:  expiryPeriod,
+		Expires:          now.Add(remaining),
+	}
+}
+
+// blockProducerPackage returns the installed package in the active context with the specified
+// instance name, or the only installed package that declares a block producer if no name is
+// provided
+func (p *PackageManager) blockProducerPackage(pkgName string) (InstalledPackage, error) {
+	activeContextName, activeContext := p.CurrentContext()
+	// Keys are placed in the local data dir and mounted into containers from there
+	if activeContext.DockerHost != "" {
+		return InstalledPackage{}, ErrSPORemoteDockerHost
+	}
+	var bpPkgs []InstalledPackage
+	for _, installedPkg := range p.InstalledPackages() {
+		if pkgName != "" && installedPkg.InstanceName() == pkgName {
+			if installedPkg.Package.BlockProducer == nil {
+				return InstalledPackage{}, NewPackageNotBlockProducerError(pkgName)
+			}
+			return installedPkg, nil
+		}
+		if installedPkg.Package.BlockProducer != nil {
+			bpPkgs = append(bpPkgs, installedPkg)
+		}
+	}
+	if pkgName != "" {
+		return InstalledPackage{}, NewPackageNotInstalledError(
+			pkgName,
+			activeContextName,
+		)
+	}
+	if len(bpPkgs) == 0 {
+		return InstalledPackage{}, ErrNoBlockProducerPackages
+	}
+	if len(bpPkgs) > 1 {
+		var pkgNames []string
+		for _, bpPkg := range bpPkgs {
+			pkgNames = append(pkgNames, bpPkg.InstanceName())
+		}
+		return InstalledPackage{}, NewBlockProducerPackageAmbiguousError(pkgNames)
+	}
+	return bpPkgs[0], nil
+}
+
+// blockProducerKeysDir returns the path to the keys dir for an installed block producer package
+func (p *PackageManager) blockProducerKeysDir(installedPkg InstalledPackage) (string, error) {
+	pkg := installedPkg.Package
+	keysDir, err := p.renderInstalledPackageTemplate(installedPkg, pkg.BlockProducer.KeysDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(
+		p.config.packageDataDir(
+			fmt.Sprintf("%s-%s-%s", pkg.instanceName(), pkg.Version, installedPkg.Context),
+		),
+		keysDir,
+	), nil
+}
+
+// blockProducerImage returns the image of the block producer container, which is used to run
+// cardano-cli so that it matches the node version
+func (p *PackageManager) blockProducerImage(installedPkg InstalledPackage) (string, error) {
+	dockerStep := installedPkg.Package.BlockProducer.dockerStep(
+		installedPkg.Package.InstallSteps,
+	)
+	if dockerStep == nil {
+		return "", NewPackageNotBlockProducerError(installedPkg.InstanceName())
+	}
+	return p.renderInstalledPackageTemplate(installedPkg, dockerStep.Image)
+}
+
+// renderInstalledPackageTemplate renders a template from the manifest of an installed package
+func (p *PackageManager) renderInstalledPackageTemplate(
+	installedPkg InstalledPackage,
+	value string,
+) (string, error) {
+	pkg := installedPkg.Package
+	tmpl := p.config.Template.WithVars(
+		pkg.templateVars(p.config, installedPkg.Context, installedPkg.Options),
+	)
+	return tmpl.Render(value, nil)
+}
+
+// kesParams returns the KES parameters for a context. Contexts with a network config dir use the
+// values from the Shelley genesis file, and other contexts use the values for the public networks
+func (p *PackageManager) kesParams(contextName string) (kesParams, error) {
+	ret := kesParams{
+		slotsPerKESPeriod: defaultSlotsPerKESPeriod,
+		maxKESEvolutions:  defaultMaxKESEvolutions,
+		slotLength:        defaultSlotLength,
+	}
+	networkConfigDir := p.state.Contexts[contextName].NetworkConfigDir
+	if networkConfigDir == "" {
+		return ret, nil
+	}
+	genesisPath := filepath.Join(networkConfigDir, "shelley-genesis.json")
+	content, err := os.ReadFile(genesisPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ret, nil
+		}
+		return kesParams{}, err
+	}
+	var genesis struct {
+		SlotsPerKESPeriod uint64  `json:"slotsPerKESPeriod"`
+		MaxKESEvolutions  uint64  `json:"maxKESEvolutions"`
+		SlotLength        float64 `json:"slotLength"`
+	}
+	if err := json.Unmarshal(content, &genesis); err != nil {
+		return kesParams{}, fmt.Errorf("failed to parse genesis file %s: %w", genesisPath, err)
+	}
+	if genesis.SlotsPerKESPeriod > 0 {
+		ret.slotsPerKESPeriod = genesis.SlotsPerKESPeriod
+	}
+	if genesis.MaxKESEvolutions > 0 {
+		ret.maxKESEvolutions = genesis.MaxKESEvolutions
+	}
+	if genesis.SlotLength > 0 {
+		ret.slotLength = time.Duration(genesis.SlotLength * float64(time.Second))
+	}
+	return ret, nil
+}
+
+// nodeTip is the tip of the node as reported by cardano-cli. The fields are missing before the
+// node has synced
+type nodeTip struct {
+	Slot  *uint64 `json:"slot"`
+	Block *uint64 `json:"block"`
+}
+
+// currentSlot returns the slot of the node tip for a context
+func (p *PackageManager) currentSlot(contextName string) (uint64, error) {
+	tip, err := p.nodeTip(contextName)
+	if err != nil {
+		return 0, err
+	}
+	if tip.Slot == nil {
+		return 0, ErrNodeTipUnknown
+	}
+	return *tip.Slot, nil
+}
+
+// nodeTip queries the tip of the node for a context with cardano-cli
+func (p *PackageManager) nodeTip(contextName string) (nodeTip, error) {
+	svc, socket, err := p.nodeService(contextName)
+	if err != nil {
+		return nodeTip{}, err
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return nodeTip{}, err
+	}
+	if !running {
+		return nodeTip{}, NewContainerNotRunningError(svc.ContainerName)
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode, err := svc.Exec(
+		[]string{cardanoCliCommand, "conway", "query", "tip"},
+		cliEnv(p.state.Contexts[contextName], socket),
+		false,
+		nil,
+		&stdout,
+		&stderr,
+	)
+	if err != nil {
+		return nodeTip{}, err
+	}
+	if exitCode != 0 {
+		return nodeTip{}, NewSPOCliError(int64(exitCode), strings.TrimSpace(stderr.String()))
+	}
+	var tip nodeTip
+	if err := json.Unmarshal(stdout.Bytes(), &tip); err != nil {
+		return nodeTip{}, fmt.Errorf("failed to parse node tip: %w", err)
+	}
+	return tip, nil
+}
+
+// readOpCert returns the issue counter and starting KES period of an operational certificate
+func readOpCert(path string) (uint64, uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, 0, NewSPOKeyNotFoundError(filepath.Base(path), filepath.Dir(path))
+		}
+		return 0, 0, err
+	}
+	counter, startPeriod, err := parseOpCert(content)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse operational certificate %s: %w", path, err)
+	}
+	return counter, startPeriod, nil
+}
+
+// parseOpCert parses an operational certificate in the text envelope format used by cardano-cli
+func parseOpCert(content []byte) (uint64, uint64, error) {
+	var envelope struct {
+		Type    string `json:"type"`
+		CborHex string `json:"cborHex"`
+	}
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return 0, 0, err
+	}
+	if envelope.Type != "NodeOperationalCertificate" {
+		return 0, 0, fmt.Errorf("unexpected type %q", envelope.Type)
+	}
+	cborData, err := hex.DecodeString(envelope.CborHex)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The certificate is [[hot vkey, counter, KES period, signature], cold vkey]
+	var opCert []any
+	if _, err := cbor.Decode(cborData, &opCert); err != nil {
+		return 0, 0, err
+	}
+	if len(opCert) != 2 {
+		return 0, 0, errors.New("unexpected certificate structure")
+	}
+	body, ok := opCert[0].([]any)
+	if !ok || len(body) != 4 {
+		return 0, 0, errors.New("unexpected certificate structure")
+	}
+	counter, ok := body[1].(uint64)
+	if !ok {
+		return 0, 0, errors.New("unexpected certificate counter")
+	}
+	startPeriod, ok := body[2].(uint64)
+	if !ok {
+		return 0, 0, errors.New("unexpected certificate KES period")
+	}
+	return counter, startPeriod, nil
+}
+
+// copyKeyFile copies a key file, keeping signing keys only readable by the current user
+func copyKeyFile(srcPath string, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	mode := fs.FileMode(0o644)
+	if strings.HasSuffix(destPath, ".skey") {
+		mode = 0o600
+	}
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	// The mode is only applied by OpenFile for new files
+	return os.Chmod(destPath, mode)
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+)
+
+func TestParseOpCert(t *testing.T) {
+	opCert := []any{
+		[]any{make([]byte, 32), uint64(3), uint64(850), make([]byte, 64)},
+		make([]byte, 32),
+	}
+	cborData, err := cbor.Encode(opCert)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content := fmt.Sprintf(
+		`{"type": "NodeOperationalCertificate", "description": "", "cborHex": "%s"}`,
+		hex.EncodeToString(cborData),
+	)
+	counter, startPeriod, err := parseOpCert([]byte(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if counter != 3 || startPeriod != 850 {
+		t.Fatalf(
+			"did not get expected values: got counter %d and KES period %d, expected 3 and 850",
+			counter,
+			startPeriod,
+		)
+	}
+	// Other key types are rejected
+	content = fmt.Sprintf(
+		`{"type": "KesSigningKey_ed25519_kes_2^6", "description": "", "cborHex": "%s"}`,
+		hex.EncodeToString(cborData),
+	)
+	if _, _, err := parseOpCert([]byte(content)); err == nil {
+		t.Fatalf("did not get expected error for wrong envelope type")
+	}
+}
+
+func TestNewSPOKeyStatus(t *testing.T) {
+	params := kesParams{
+		slotsPerKESPeriod: 129600,
+		maxKESEvolutions:  62,
+		slotLength:        time.Second,
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	// Certificate issued at KES period 800, with the tip at the start of KES period 850
+	status := newSPOKeyStatus(InstalledPackage{}, 1, 800, 850*129600, params, now)
+	if status.CurrentKESPeriod != 850 || status.ExpiryKESPeriod != 862 {
+		t.Fatalf(
+			"did not get expected KES periods: got current %d and expiry %d",
+			status.CurrentKESPeriod,
+			status.ExpiryKESPeriod,
+		)
+	}
+	expectedExpires := now.Add(12 * 129600 * time.Second)
+	if !status.Expires.Equal(expectedExpires) {
+		t.Fatalf(
+			"did not get expected expiry: got %s, expected %s",
+			status.Expires,
+			expectedExpires,
+		)
+	}
+	// Expired keys don't report an expiry in the future
+	status = newSPOKeyStatus(InstalledPackage{}, 1, 700, 850*129600, params, now)
+	if !status.Expires.Equal(now) || !status.ExpiresWithin(0) {
+		t.Fatalf("expected key to be expired, got expiry %s", status.Expires)
+	}
+}
+
+func TestKesParams(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Public networks use the default values
+	params, err := pm.kesParams("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if params.slotsPerKESPeriod != defaultSlotsPerKESPeriod ||
+		params.maxKESEvolutions != defaultMaxKESEvolutions ||
+		params.slotLength != defaultSlotLength {
+		t.Fatalf("did not get expected default KES params: %+v", params)
+	}
+	// Custom networks use the values from the Shelley genesis
+	networkDir := filepath.Join(tmpDir, "network")
+	if err := os.MkdirAll(networkDir, 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(
+		filepath.Join(networkDir, "shelley-genesis.json"),
+		[]byte(`{"slotsPerKESPeriod": 500, "maxKESEvolutions": 10, "slotLength": 0.1}`),
+		0o644,
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.Contexts["devnet"] = Context{
+		Network:          "devnet",
+		NetworkMagic:     42,
+		CustomNetwork:    true,
+		NetworkConfigDir: networkDir,
+	}
+	params, err = pm.kesParams("devnet")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedParams := kesParams{
+		slotsPerKESPeriod: 500,
+		maxKESEvolutions:  10,
+		slotLength:        100 * time.Millisecond,
+	}
+	if params != expectedParams {
+		t.Fatalf(
+			"did not get expected KES params: got %+v, expected %+v",
+			params,
+			expectedParams,
+		)
+	}
+}
+
+func TestPackageBlockProducerValidate(t *testing.T) {
+	installSteps := []PackageInstallStep{
+		{
+			Docker: &PackageInstallStepDocker{
+				ContainerName: "cardano-node",
+				Image:         "example/cardano-node:1.0.0",
+			},
+		},
+	}
+	testDefs := []struct {
+		blockProducer PackageBlockProducer
+		valid         bool
+	}{
+		{
+			blockProducer: PackageBlockProducer{KeysDir: "keys"},
+			valid:         true,
+		},
+		{
+			blockProducer: PackageBlockProducer{
+				KeysDir:       "keys",
+				ContainerName: "cardano-node",
+			},
+			valid: true,
+		},
+		{
+			blockProducer: PackageBlockProducer{},
+		},
+		{
+			blockProducer: PackageBlockProducer{KeysDir: "/keys"},
+		},
+		{
+			blockProducer: PackageBlockProducer{KeysDir: "../keys"},
+		},
+		{
+			blockProducer: PackageBlockProducer{
+				KeysDir:       "keys",
+				ContainerName: "missing",
+			},
+		},
+	}
+	for _, testDef := range testDefs {
+		err := testDef.blockProducer.validate(installSteps)
+		if testDef.valid && err != nil {
+			t.Fatalf("unexpected error for %+v: %s", testDef.blockProducer, err)
+		}
+		if !testDef.valid && err == nil {
+			t.Fatalf("did not get expected error for %+v", testDef.blockProducer)
+		}
+	}
+}
+
+func TestCopyKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testDefs := []struct {
+		filename     string
+		expectedMode os.FileMode
+	}{
+		{filename: "vrf.skey", expectedMode: 0o600},
+		{filename: "vrf.vkey", expectedMode: 0o644},
+	}
+	for _, testDef := range testDefs {
+		srcPath := filepath.Join(tmpDir, "src-"+testDef.filename)
+		if err := os.WriteFile(srcPath, []byte("key"), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		destPath := filepath.Join(tmpDir, testDef.filename)
+		// Existing files get their mode updated
+		if err := os.WriteFile(destPath, []byte("old key"), 0o666); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := copyKeyFile(srcPath, destPath); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		info, err := os.Stat(destPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if info.Mode().Perm() != testDef.expectedMode {
+			t.Fatalf(
+				"did not get expected mode for %s: got %o, expected %o",
+				testDef.filename,
+				info.Mode().Perm(),
+				testDef.expectedMode,
+			)
+		}
+		content, err := os.ReadFile(destPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != "key" {
+			t.Fatalf("did not get expected content for %s: %s", testDef.filename, content)
+		}
+	}
+}
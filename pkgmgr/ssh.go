@@ -0,0 +1,296 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshHost is a remote host reached with the system ssh client, parsed from an
+// ssh://[user@]host[:port] Docker host URL. Using the system client means that the user's SSH
+// config, agent and known hosts are honored, the same as with the Docker CLI
+type sshHost struct {
+	user string
+	host string
+	port string
+}
+
+// parseSshHost parses a Docker host URL with the ssh scheme
+func parseSshHost(dockerHost string) (sshHost, error) {
+	hostUrl, err := url.Parse(dockerHost)
+	if err != nil {
+		return sshHost{}, NewInvalidDockerHostError(dockerHost, err.Error())
+	}
+	if hostUrl.Scheme != "ssh" {
+		return sshHost{}, NewInvalidDockerHostError(dockerHost, "scheme must be ssh")
+	}
+	if hostUrl.Hostname() == "" {
+		return sshHost{}, NewInvalidDockerHostError(dockerHost, "no host specified")
+	}
+	if hostUrl.Path != "" && hostUrl.Path != "/" {
+		return sshHost{}, NewInvalidDockerHostError(dockerHost, "path is not supported")
+	}
+	if hostUrl.RawQuery != "" {
+		return sshHost{}, NewInvalidDockerHostError(dockerHost, "query is not supported")
+	}
+	if _, ok := hostUrl.User.Password(); ok {
+		return sshHost{}, NewInvalidDockerHostError(
+			dockerHost,
+			"passwords are not supported, use an SSH key or agent",
+		)
+	}
+	return sshHost{
+		user: hostUrl.User.Username(),
+		host: hostUrl.Hostname(),
+		port: hostUrl.Port(),
+	}, nil
+}
+
+// isSshDockerHost returns whether the Docker host URL uses the ssh scheme
+func isSshDockerHost(dockerHost string) bool {
+	return strings.HasPrefix(dockerHost, "ssh://")
+}
+
+// destination returns the destination in the format used by ssh and sftp
+func (h sshHost) destination() string {
+	if h.user != "" {
+		return h.user + "@" + h.host
+	}
+	return h.host
+}
+
+// sshArgs returns the args for running a command on the remote host
+func (h sshHost) sshArgs(remoteCmd ...string) []string {
+	ret := []string{"-o", "ConnectTimeout=30"}
+	if h.port != "" {
+		ret = append(ret, "-p", h.port)
+	}
+	ret = append(ret, "--", h.destination())
+	return append(ret, remoteCmd...)
+}
+
+// run runs a shell command on the remote host and returns its output
+func (h sshHost) run(ctx context.Context, remoteCmd string, stdin io.Reader) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "ssh", h.sshArgs(remoteCmd)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, NewSshCommandError(h.destination(), err, stderr.String())
+	}
+	return output, nil
+}
+
+// mkdirAll creates the specified dirs on the remote host
+func (h sshHost) mkdirAll(ctx context.Context, dirs ...string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	_, err := h.run(ctx, "mkdir -p -- "+shellQuote(dirs...), nil)
+	return err
+}
+
+// removeAll removes the specified paths on the remote host
+func (h sshHost) removeAll(ctx context.Context, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	_, err := h.run(ctx, "rm -rf -- "+shellQuote(paths...), nil)
+	return err
+}
+
+// pathExists returns whether the path exists on the remote host
+func (h sshHost) pathExists(ctx context.Context, path string) (bool, error) {
+	output, err := h.run(
+		ctx,
+		"if [ -e "+shellQuote(path)+" ]; then echo yes; fi",
+		nil,
+	)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) == "yes", nil
+}
+
+// userAndGroup returns the numeric user and group IDs of the remote user, in the format used for
+// the container user
+func (h sshHost) userAndGroup(ctx context.Context) (string, error) {
+	output, err := h.run(ctx, "echo $(id -u):$(id -g)", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// copyFile copies file content to the remote host over SFTP, creating the parent dir if needed
+func (h sshHost) copyFile(
+	ctx context.Context,
+	localPath string,
+	remotePath string,
+	mode fs.FileMode,
+) error {
+	if err := h.mkdirAll(ctx, remoteParentDir(remotePath)); err != nil {
+		return err
+	}
+	args := []string{"-q", "-b", "-", "-o", "ConnectTimeout=30"}
+	if h.port != "" {
+		args = append(args, "-P", h.port)
+	}
+	args = append(args, "--", h.destination())
+	batch := fmt.Sprintf(
+		"put %s %s\nchmod %o %s\n",
+		sftpQuote(localPath),
+		sftpQuote(remotePath),
+		mode.Perm(),
+		sftpQuote(remotePath),
+	)
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(batch)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return NewSshCommandError(h.destination(), err, stderr.String())
+	}
+	return nil
+}
+
+// dialDocker returns a connection to the Docker engine on the remote host, using the remote Docker
+// CLI to proxy the API socket over the SSH session
+func (h sshHost) dialDocker(ctx context.Context, network, addr string) (net.Conn, error) {
+	// The connection outlives the dial, so the command isn't tied to the dial context
+	cmd := exec.Command(
+		"ssh",
+		h.sshArgs("docker", "system", "dial-stdio")...,
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, NewSshCommandError(h.destination(), err, "")
+	}
+	return &sshConn{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: &stderr,
+		dest:   h.destination(),
+	}, nil
+}
+
+// sshConn is a net.Conn over the stdin/stdout of an ssh process
+type sshConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.Reader
+	stderr    *bytes.Buffer
+	dest      string
+	closeOnce sync.Once
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if err == io.EOF && c.stderr.Len() > 0 {
+		return n, NewSshCommandError(c.dest, err, c.stderr.String())
+	}
+	return n, err
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *sshConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		if c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+		}
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr {
+	return sshAddr{}
+}
+
+func (c *sshConn) RemoteAddr() net.Addr {
+	return sshAddr{dest: c.dest}
+}
+
+// Deadlines aren't supported on the process pipes, and the Docker client relies on context
+// cancellation instead
+func (c *sshConn) SetDeadline(t time.Time) error      { return nil }
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type sshAddr struct {
+	dest string
+}
+
+func (a sshAddr) Network() string {
+	return "ssh"
+}
+
+func (a sshAddr) String() string {
+	return a.dest
+}
+
+// remoteParentDir returns the parent dir of a path on the remote host, which always uses
+// forward slashes
+func remoteParentDir(remotePath string) string {
+	idx := strings.LastIndex(remotePath, "/")
+	if idx <= 0 {
+		return "/"
+	}
+	return remotePath[:idx]
+}
+
+// shellQuote quotes values for use as arguments in a POSIX shell command
+func shellQuote(vals ...string) string {
+	quoted := make([]string, 0, len(vals))
+	for _, val := range vals {
+		quoted = append(
+			quoted,
+			"'"+strings.ReplaceAll(val, "'", `'\''`)+"'",
+		)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sftpQuote quotes a path for use in an sftp batch command
+func sftpQuote(val string) string {
+	val = strings.ReplaceAll(val, `\`, `\\`)
+	val = strings.ReplaceAll(val, `"`, `\"`)
+	return `"` + val + `"`
+}
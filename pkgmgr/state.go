@@ -15,8 +15,14 @@
 package pkgmgr
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -25,19 +31,36 @@ const (
 	contextsFilename          = "contexts.yaml"
 	activeContextFilename     = "active_context.yaml"
 	installedPackagesFilename = "installed_packages.yaml"
+	portsFilename             = "ports.yaml"
+	topologiesFilename        = "topologies.yaml"
 )
 
+// installedPackagesDir is the dir in the config dir with a file for each installed package, so
+// that a failed save can only affect the records being changed
+var installedPackagesDir = filepath.Join("state", "installed")
+
 type State struct {
 	config            Config
 	ActiveContext     string
 	Contexts          map[string]Context
 	InstalledPackages []InstalledPackage
+	Ports             PortRegistry
+	Topologies        TopologyRegistry
+	ServiceStatuses   ServiceStatusCache
+	Migrations        MigrationRegistry
+	// installedFiles has the content of the installed package files as last loaded or saved,
+	// keyed by the path relative to the installed packages dir
+	installedFiles map[string][]byte
 }
 
 func NewState(cfg Config) *State {
 	return &State{
-		config:   cfg,
-		Contexts: make(map[string]Context),
+		config:          cfg,
+		Contexts:        make(map[string]Context),
+		Ports:           make(PortRegistry),
+		Topologies:      make(TopologyRegistry),
+		ServiceStatuses: make(ServiceStatusCache),
+		Migrations:      make(MigrationRegistry),
 	}
 }
 
@@ -51,6 +74,19 @@ func (s *State) Load() error {
 	if err := s.loadInstalledPackages(); err != nil {
 		return err
 	}
+	if err := s.loadPorts(); err != nil {
+		return err
+	}
+	if err := s.loadTopologies(); err != nil {
+		return err
+	}
+	if err := s.loadServiceStatuses(); err != nil {
+		return err
+	}
+	if err := s.loadMigrations(); err != nil {
+		return err
+	}
+	s.migrateOwnerKeys()
 	return nil
 }
 
@@ -64,6 +100,12 @@ func (s *State) Save() error {
 	if err := s.saveInstalledPackages(); err != nil {
 		return err
 	}
+	if err := s.savePorts(); err != nil {
+		return err
+	}
+	if err := s.saveTopologies(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -142,9 +184,219 @@ func (s *State) saveActiveContext() error {
 }
 
 func (s *State) loadInstalledPackages() error {
-	return s.loadFile(installedPackagesFilename, &(s.InstalledPackages))
+	installedDir := filepath.Join(s.config.ConfigDir, installedPackagesDir)
+	if _, err := os.Stat(installedDir); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Use the legacy file with all installed packages, which is migrated on the next save
+		s.installedFiles = nil
+		if err := s.loadFile(installedPackagesFilename, &(s.InstalledPackages)); err != nil {
+			return err
+		}
+	} else {
+		installedPkgs, err := s.loadInstalledPackageFiles(installedDir)
+		if err != nil {
+			return err
+		}
+		s.InstalledPackages = installedPkgs
+	}
+	// Restore the instance name and config profile on the package, since they're not part of the
+	// package manifest
+	for idx := range s.InstalledPackages {
+		s.InstalledPackages[idx].Package.instance = s.InstalledPackages[idx].Instance
+		s.InstalledPackages[idx].Package.configProfile = s.InstalledPackages[idx].ConfigProfile
+	}
+	return nil
 }
 
+// loadInstalledPackageFiles loads the installed package files, in the order that the packages
+// were installed. Files that can't be parsed are skipped with a warning and left in place, so
+// that the other installed packages can still be managed
+func (s *State) loadInstalledPackageFiles(installedDir string) ([]InstalledPackage, error) {
+	var ret []InstalledPackage
+	s.installedFiles = make(map[string][]byte)
+	err := filepath.WalkDir(
+		installedDir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) != ".yaml" {
+				return nil
+			}
+			relPath, err := filepath.Rel(installedDir, path)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var installedPkg InstalledPackage
+			if err := yaml.Unmarshal(content, &installedPkg); err != nil ||
+				installedPkg.Package.Name == "" {
+				if err == nil {
+					err = errors.New("no package name")
+				}
+				s.config.Logger.Warn(
+					fmt.Sprintf(
+						"skipping installed package file %s that can't be loaded: %s",
+						path,
+						err,
+					),
+				)
+				return nil
+			}
+			s.installedFiles[relPath] = content
+			ret = append(ret, installedPkg)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(
+		ret,
+		func(i, j int) bool {
+			return ret[i].InstalledTime.Before(ret[j].InstalledTime)
+		},
+	)
+	return ret, nil
+}
+
+// saveInstalledPackages writes the file for each installed package that changed and removes the
+// files for packages that are no longer installed. The legacy file with all installed packages is
+// kept as a backup once it has been migrated
 func (s *State) saveInstalledPackages() error {
-	return s.saveFile(installedPackagesFilename, &(s.InstalledPackages))
+	installedDir := filepath.Join(s.config.ConfigDir, installedPackagesDir)
+	installedFiles := make(map[string][]byte, len(s.InstalledPackages))
+	for _, installedPkg := range s.InstalledPackages {
+		content, err := yaml.Marshal(&installedPkg)
+		if err != nil {
+			return err
+		}
+		installedFiles[installedPackageFile(installedPkg)] = content
+	}
+	for relPath, content := range installedFiles {
+		if oldContent, ok := s.installedFiles[relPath]; ok && bytes.Equal(oldContent, content) {
+			continue
+		}
+		path := filepath.Join(installedDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, content); err != nil {
+			return err
+		}
+	}
+	for relPath := range s.installedFiles {
+		if _, ok := installedFiles[relPath]; ok {
+			continue
+		}
+		path := filepath.Join(installedDir, relPath)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Remove the context dir once it's empty, which fails harmlessly otherwise
+		_ = os.Remove(filepath.Dir(path))
+	}
+	s.installedFiles = installedFiles
+	// Create the dir even without installed packages, so that the legacy file isn't loaded again
+	if err := os.MkdirAll(installedDir, os.ModePerm); err != nil {
+		return err
+	}
+	legacyPath := filepath.Join(s.config.ConfigDir, installedPackagesFilename)
+	if _, err := os.Stat(legacyPath); err == nil {
+		if err := os.Rename(legacyPath, legacyPath+".bak"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installedPackageFile returns the path of the file for an installed package, relative to the
+// installed packages dir. Instance names can't contain a '_', so the name is unambiguous
+func installedPackageFile(installedPkg InstalledPackage) string {
+	return filepath.Join(
+		installedPkg.Context,
+		fmt.Sprintf(
+			"%s_%s.yaml",
+			installedPkg.InstanceName(),
+			strings.ReplaceAll(installedPkg.Package.Version, string(filepath.Separator), "_"),
+		),
+	)
+}
+
+// writeFileAtomic writes a file via a temp file in the same dir, so that a crash can't leave a
+// partially written file
+func writeFileAtomic(path string, content []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func (s *State) loadPorts() error {
+	if err := s.loadFile(portsFilename, &(s.Ports)); err != nil {
+		return err
+	}
+	if s.Ports == nil {
+		s.Ports = make(PortRegistry)
+	}
+	return nil
+}
+
+func (s *State) savePorts() error {
+	return s.saveFile(portsFilename, &(s.Ports))
+}
+
+func (s *State) loadTopologies() error {
+	if err := s.loadFile(topologiesFilename, &(s.Topologies)); err != nil {
+		return err
+	}
+	if s.Topologies == nil {
+		s.Topologies = make(TopologyRegistry)
+	}
+	return nil
+}
+
+func (s *State) saveTopologies() error {
+	return s.saveFile(topologiesFilename, &(s.Topologies))
+}
+
+// migrateOwnerKeys renames port and topology registry entries for installed packages from the
+// legacy owner key format. The new keys are written on the next save
+func (s *State) migrateOwnerKeys() {
+	for _, installedPkg := range s.InstalledPackages {
+		oldOwner := legacyPortOwner(installedPkg.Package, installedPkg.Context)
+		newOwner := portOwner(installedPkg.Package, installedPkg.Context)
+		if ports, ok := s.Ports[oldOwner]; ok {
+			if _, ok := s.Ports[newOwner]; !ok {
+				s.Ports[newOwner] = ports
+				delete(s.Ports, oldOwner)
+			}
+		}
+		if topology, ok := s.Topologies[oldOwner]; ok {
+			if _, ok := s.Topologies[newOwner]; !ok {
+				s.Topologies[newOwner] = topology
+				delete(s.Topologies, oldOwner)
+			}
+		}
+	}
 }
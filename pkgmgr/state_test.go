@@ -0,0 +1,191 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStateConfig(t *testing.T) Config {
+	return Config{
+		ConfigDir: t.TempDir(),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func testInstalledPackage(name string, version string, context string) InstalledPackage {
+	return InstalledPackage{
+		Package: Package{
+			Name:    name,
+			Version: version,
+		},
+		Context:       context,
+		InstalledTime: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func TestStateInstalledPackagesRoundTrip(t *testing.T) {
+	cfg := testStateConfig(t)
+	state := NewState(cfg)
+	state.InstalledPackages = []InstalledPackage{
+		testInstalledPackage("cardano-node", "1.0.0", "default"),
+		testInstalledPackage("mithril-client", "2.0.0", "preview"),
+	}
+	state.InstalledPackages[1].InstalledTime = state.InstalledPackages[0].InstalledTime.Add(
+		time.Minute,
+	)
+	if err := state.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	for _, relPath := range []string{
+		filepath.Join("default", "cardano-node_1.0.0.yaml"),
+		filepath.Join("preview", "mithril-client_2.0.0.yaml"),
+	} {
+		if _, err := os.Stat(filepath.Join(cfg.ConfigDir, installedPackagesDir, relPath)); err != nil {
+			t.Fatalf("expected installed package file %s: %s", relPath, err)
+		}
+	}
+	newState := NewState(cfg)
+	if err := newState.Load(); err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if len(newState.InstalledPackages) != 2 {
+		t.Fatalf(
+			"did not get expected installed packages count: got %d, expected 2",
+			len(newState.InstalledPackages),
+		)
+	}
+	if newState.InstalledPackages[0].Package.Name != "cardano-node" ||
+		newState.InstalledPackages[1].Package.Name != "mithril-client" {
+		t.Fatalf(
+			"did not get installed packages in install order: got %s, %s",
+			newState.InstalledPackages[0].Package.Name,
+			newState.InstalledPackages[1].Package.Name,
+		)
+	}
+}
+
+func TestStateInstalledPackagesRemove(t *testing.T) {
+	cfg := testStateConfig(t)
+	state := NewState(cfg)
+	state.InstalledPackages = []InstalledPackage{
+		testInstalledPackage("cardano-node", "1.0.0", "default"),
+		testInstalledPackage("mithril-client", "2.0.0", "preview"),
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	state.InstalledPackages = state.InstalledPackages[:1]
+	if err := state.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ConfigDir, installedPackagesDir, "preview")); err == nil {
+		t.Fatalf("expected context dir for removed package to be removed")
+	}
+	newState := NewState(cfg)
+	if err := newState.Load(); err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if len(newState.InstalledPackages) != 1 {
+		t.Fatalf(
+			"did not get expected installed packages count: got %d, expected 1",
+			len(newState.InstalledPackages),
+		)
+	}
+}
+
+func TestStateInstalledPackagesCorruptFile(t *testing.T) {
+	cfg := testStateConfig(t)
+	state := NewState(cfg)
+	state.InstalledPackages = []InstalledPackage{
+		testInstalledPackage("cardano-node", "1.0.0", "default"),
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	corruptPath := filepath.Join(
+		cfg.ConfigDir,
+		installedPackagesDir,
+		"default",
+		"mithril-client_2.0.0.yaml",
+	)
+	if err := os.WriteFile(corruptPath, []byte("package: [\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error writing file: %s", err)
+	}
+	newState := NewState(cfg)
+	if err := newState.Load(); err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if len(newState.InstalledPackages) != 1 {
+		t.Fatalf(
+			"did not get expected installed packages count: got %d, expected 1",
+			len(newState.InstalledPackages),
+		)
+	}
+	// The corrupt file is left in place for the user to fix
+	if err := newState.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	if _, err := os.Stat(corruptPath); err != nil {
+		t.Fatalf("expected corrupt file to be kept: %s", err)
+	}
+}
+
+func TestStateInstalledPackagesMigrate(t *testing.T) {
+	cfg := testStateConfig(t)
+	legacyState := NewState(cfg)
+	legacyState.InstalledPackages = []InstalledPackage{
+		testInstalledPackage("cardano-node", "1.0.0", "default"),
+	}
+	if err := legacyState.saveFile(
+		installedPackagesFilename,
+		&(legacyState.InstalledPackages),
+	); err != nil {
+		t.Fatalf("unexpected error saving legacy file: %s", err)
+	}
+	state := NewState(cfg)
+	if err := state.Load(); err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if len(state.InstalledPackages) != 1 {
+		t.Fatalf(
+			"did not get expected installed packages count: got %d, expected 1",
+			len(state.InstalledPackages),
+		)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	legacyPath := filepath.Join(cfg.ConfigDir, installedPackagesFilename)
+	if _, err := os.Stat(legacyPath); err == nil {
+		t.Fatalf("expected legacy file to be moved aside")
+	}
+	if _, err := os.Stat(legacyPath + ".bak"); err != nil {
+		t.Fatalf("expected legacy file backup: %s", err)
+	}
+	newState := NewState(cfg)
+	if err := newState.Load(); err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if len(newState.InstalledPackages) != 1 ||
+		newState.InstalledPackages[0].Package.Name != "cardano-node" {
+		t.Fatalf("did not get expected installed packages after migration")
+	}
+}
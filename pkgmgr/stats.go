@@ -0,0 +1,123 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerStats is a snapshot of the resource usage for a container
+type ContainerStats struct {
+	// CPUPercent is the CPU usage since the previous sample, where 100% is one full CPU
+	CPUPercent float64
+	// MemoryUsage is the memory used by the container, excluding inactive page cache
+	MemoryUsage uint64
+	MemoryLimit uint64
+	NetRxBytes  uint64
+	NetTxBytes  uint64
+	// BlockReadBytes and BlockWriteBytes are the total bytes read from and written to block
+	// devices since the container was started
+	BlockReadBytes  uint64
+	BlockWriteBytes uint64
+}
+
+// Stats returns a snapshot of the resource usage for the container. The Docker engine takes two
+// samples to calculate CPU usage, so this takes a second or two to return
+func (d *DockerService) Stats() (ContainerStats, error) {
+	client, err := d.getClient()
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	resp, err := client.ContainerStats(d.getContext(), d.ContainerId, false)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer resp.Body.Close()
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to decode container stats: %s", err)
+	}
+	return newContainerStats(stats), nil
+}
+
+// newContainerStats calculates container resource usage from the raw stats in the same way as
+// the 'docker stats' command
+func newContainerStats(stats container.StatsResponse) ContainerStats {
+	ret := ContainerStats{
+		MemoryUsage: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+	}
+	// Page cache that could be reclaimed isn't counted as used. The stat name depends on
+	// whether the host uses cgroup v1 or v2
+	for _, statName := range []string{"total_inactive_file", "inactive_file"} {
+		if inactive, ok := stats.MemoryStats.Stats[statName]; ok {
+			if inactive < ret.MemoryUsage {
+				ret.MemoryUsage -= inactive
+			}
+			break
+		}
+	}
+	// Windows reports private working set rather than usage
+	if ret.MemoryUsage == 0 {
+		ret.MemoryUsage = stats.MemoryStats.PrivateWorkingSet
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) -
+		float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) -
+		float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		ret.CPUPercent = (cpuDelta / systemDelta) * onlineCPUs * 100
+	}
+	for _, netStats := range stats.Networks {
+		ret.NetRxBytes += netStats.RxBytes
+		ret.NetTxBytes += netStats.TxBytes
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			ret.BlockReadBytes += entry.Value
+		case "write":
+			ret.BlockWriteBytes += entry.Value
+		}
+	}
+	// Windows reports storage stats instead of block I/O
+	if ret.BlockReadBytes == 0 && ret.BlockWriteBytes == 0 {
+		ret.BlockReadBytes = stats.StorageStats.ReadSizeBytes
+		ret.BlockWriteBytes = stats.StorageStats.WriteSizeBytes
+	}
+	return ret
+}
+
+// FormatBytes returns a human-readable size using binary units, such as 1.5GiB
+func FormatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
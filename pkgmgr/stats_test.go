@@ -0,0 +1,91 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestNewContainerStats(t *testing.T) {
+	var stats container.StatsResponse
+	stats.CPUStats = container.CPUStats{
+		CPUUsage:    container.CPUUsage{TotalUsage: 3_000_000_000},
+		SystemUsage: 20_000_000_000,
+		OnlineCPUs:  4,
+	}
+	stats.PreCPUStats = container.CPUStats{
+		CPUUsage:    container.CPUUsage{TotalUsage: 2_000_000_000},
+		SystemUsage: 10_000_000_000,
+	}
+	stats.MemoryStats = container.MemoryStats{
+		Usage: 600 * 1024 * 1024,
+		Limit: 8 * 1024 * 1024 * 1024,
+		Stats: map[string]uint64{"inactive_file": 100 * 1024 * 1024},
+	}
+	stats.BlkioStats = container.BlkioStats{
+		IoServiceBytesRecursive: []container.BlkioStatEntry{
+			{Op: "read", Value: 1000},
+			{Op: "Write", Value: 500},
+			{Op: "Read", Value: 24},
+		},
+	}
+	stats.Networks = map[string]container.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 50},
+		"eth1": {RxBytes: 20, TxBytes: 5},
+	}
+	expected := ContainerStats{
+		CPUPercent:      40,
+		MemoryUsage:     500 * 1024 * 1024,
+		MemoryLimit:     8 * 1024 * 1024 * 1024,
+		NetRxBytes:      120,
+		NetTxBytes:      55,
+		BlockReadBytes:  1024,
+		BlockWriteBytes: 500,
+	}
+	if got := newContainerStats(stats); got != expected {
+		t.Fatalf("did not get expected stats\n  got: %#v\n  expected: %#v", got, expected)
+	}
+	// No previous sample, such as for a container that just started
+	stats.PreCPUStats = container.CPUStats{}
+	stats.CPUStats.SystemUsage = 0
+	if got := newContainerStats(stats); got.CPUPercent != 0 {
+		t.Fatalf("did not get expected CPU percent without a previous sample: %f", got.CPUPercent)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	testDefs := []struct {
+		size     uint64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536 * 1024, "1.5MiB"},
+		{5 * 1024 * 1024 * 1024, "5.0GiB"},
+	}
+	for _, testDef := range testDefs {
+		if got := FormatBytes(testDef.size); got != testDef.expected {
+			t.Fatalf(
+				"did not get expected output for %d: got %s, expected %s",
+				testDef.size,
+				got,
+				testDef.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// systemInfo provides the System template variable with facts about the host, which allows
+// packages to adapt to it, such as using smaller memory settings on low-memory hosts. Facts that
+// are slower to gather, such as the Docker server version, are only looked up when used by a
+// template. Facts that can't be determined are zero values
+type systemInfo struct {
+	OS   string
+	Arch string
+	CPUs int
+	// ARMMac is set on Apple Silicon Macs, where amd64 images run under emulation
+	ARMMac bool
+
+	ctx        context.Context
+	logger     *slog.Logger
+	dataDir    string
+	dockerHost string
+
+	memoryOnce    sync.Once
+	memoryMB      uint64
+	diskOnce      sync.Once
+	diskFreeMB    uint64
+	dockerOnce    sync.Once
+	dockerVersion string
+}
+
+func newSystemInfo(cfg Config) *systemInfo {
+	return &systemInfo{
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		ARMMac:     isARMMac(),
+		ctx:        cfg.ctx(),
+		logger:     cfg.Logger,
+		dataDir:    cfg.packageDataDir(""),
+		dockerHost: cfg.DockerHost,
+	}
+}
+
+// MemoryMB returns the total memory of the host in MiB
+func (s *systemInfo) MemoryMB() uint64 {
+	s.memoryOnce.Do(func() {
+		totalMemory, err := systemTotalMemory()
+		if err != nil {
+			s.logger.Debug(fmt.Sprintf("failed to get total memory: %s", err))
+			return
+		}
+		s.memoryMB = totalMemory / 1024 / 1024
+	})
+	return s.memoryMB
+}
+
+// DiskFreeMB returns the free disk space in MiB on the filesystem containing the data dir
+func (s *systemInfo) DiskFreeMB() uint64 {
+	s.diskOnce.Do(func() {
+		diskFree, err := diskFree(s.dataDir)
+		if err != nil {
+			s.logger.Debug(fmt.Sprintf("failed to get free disk space: %s", err))
+			return
+		}
+		s.diskFreeMB = diskFree / 1024 / 1024
+	})
+	return s.diskFreeMB
+}
+
+// diskFree returns the free disk space in bytes on the filesystem containing the path. The nearest
+// existing parent is used, since the path may not exist yet
+func diskFree(path string) (uint64, error) {
+	tmpPath := path
+	for {
+		_, err := os.Stat(tmpPath)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		parentPath := filepath.Dir(tmpPath)
+		if parentPath == tmpPath {
+			break
+		}
+		tmpPath = parentPath
+	}
+	return systemDiskFree(tmpPath)
+}
+
+// DockerVersion returns the version of the Docker server for the active context
+func (s *systemInfo) DockerVersion() string {
+	s.dockerOnce.Do(func() {
+		client, err := NewDockerClientForHost(s.dockerHost)
+		if err != nil {
+			s.logger.Debug(fmt.Sprintf("failed to create Docker client: %s", err))
+			return
+		}
+		defer client.Close()
+		version, err := client.ServerVersion(s.ctx)
+		if err != nil {
+			s.logger.Debug(fmt.Sprintf("failed to get Docker server version: %s", err))
+			return
+		}
+		s.dockerVersion = version.Version
+	})
+	return s.dockerVersion
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+func systemTotalMemory() (uint64, error) {
+	return unix.SysctlUint64("hw.memsize")
+}
+
+func systemDiskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// isARMMac returns whether the host is an Apple Silicon Mac, including when running an amd64
+// build of cardano-up under Rosetta
+func isARMMac() bool {
+	if runtime.GOARCH == "arm64" {
+		return true
+	}
+	translated, err := unix.SysctlUint32("sysctl.proc_translated")
+	return err == nil && translated == 1
+}
@@ -0,0 +1,35 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !windows
+
+package pkgmgr
+
+import (
+	"errors"
+)
+
+var errSystemInfoUnsupported = errors.New("not supported on this platform")
+
+func systemTotalMemory() (uint64, error) {
+	return 0, errSystemInfoUnsupported
+}
+
+func systemDiskFree(path string) (uint64, error) {
+	return 0, errSystemInfoUnsupported
+}
+
+func isARMMac() bool {
+	return false
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestSystemInfo(t *testing.T) {
+	cfg := Config{
+		// The data dir doesn't need to exist yet
+		DataDir: filepath.Join(t.TempDir(), "data", "cardano-up"),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	system := newSystemInfo(cfg)
+	if system.OS != runtime.GOOS || system.Arch != runtime.GOARCH {
+		t.Fatalf("did not get expected OS and arch: %s/%s", system.OS, system.Arch)
+	}
+	if system.CPUs < 1 {
+		t.Fatalf("did not get expected CPU count: %d", system.CPUs)
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		if system.MemoryMB() == 0 {
+			t.Fatalf("did not get total memory")
+		}
+		if system.DiskFreeMB() == 0 {
+			t.Fatalf("did not get free disk space")
+		}
+	}
+	// Facts are available as template vars, including in conditions
+	tmpl := NewTemplate(map[string]any{"System": system})
+	out, err := tmpl.Render("{{ .System.CPUs }}", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != strconv.Itoa(system.CPUs) {
+		t.Fatalf("did not get expected output: got %s, expected %d", out, system.CPUs)
+	}
+	ok, err := tmpl.EvaluateCondition("gt .System.MemoryMB 0", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ok != (system.MemoryMB() > 0) {
+		t.Fatalf("did not get expected condition result")
+	}
+}
+
+func TestSystemInfoContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	dataRoot := filepath.Join(tmpDir, "bigdisk")
+	dockerHost := "unix://" + filepath.Join(tmpDir, "docker.sock")
+	if err := pm.AddContext(
+		"big",
+		Context{DockerHost: dockerHost, DataRoot: dataRoot},
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkSystem := func(pm *PackageManager, expectedDataDir string, expectedDockerHost string) {
+		t.Helper()
+		system, ok := pm.config.Template.baseVars["System"].(*systemInfo)
+		if !ok {
+			t.Fatalf("did not find System template var")
+		}
+		if system.dataDir != expectedDataDir || system.dockerHost != expectedDockerHost {
+			t.Fatalf(
+				"did not get expected System data dir and Docker host: got %q and %q, expected %q and %q",
+				system.dataDir,
+				system.dockerHost,
+				expectedDataDir,
+				expectedDockerHost,
+			)
+		}
+	}
+	checkSystem(pm, cfg.DataDir, "")
+	// The System template var uses the Docker host and data root of the context that operations
+	// apply to
+	ctxPm, err := pm.ForContext("big")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkSystem(ctxPm, dataRoot, dockerHost)
+	checkSystem(pm, cfg.DataDir, "")
+	if err := pm.SetActiveContext("big"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkSystem(pm, dataRoot, dockerHost)
+	if err := pm.SetActiveContext("default"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkSystem(pm, cfg.DataDir, "")
+}
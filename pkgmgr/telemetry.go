@@ -0,0 +1,438 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// telemetryFilename is the file in the config dir with the telemetry settings and the usage
+	// stats collected since they were last submitted
+	telemetryFilename = "telemetry.yaml"
+
+	// telemetrySubmitInterval is how often collected usage stats are submitted automatically
+	telemetrySubmitInterval = 7 * 24 * time.Hour
+
+	// telemetrySubmitTimeout is the timeout for submitting usage stats automatically, so that a
+	// slow endpoint doesn't hold up commands
+	telemetrySubmitTimeout = 5 * time.Second
+
+	// TelemetryErrorOther is the error category for errors that don't match any other category
+	TelemetryErrorOther = "other"
+)
+
+// telemetryErrorCategories maps error categories to the text in error messages that identifies
+// them, in order of precedence. Only the category is recorded, never the message
+var telemetryErrorCategories = []struct {
+	category string
+	patterns []string
+}{
+	{category: "canceled", patterns: []string{"context canceled"}},
+	{
+		category: "network",
+		patterns: []string{
+			"connection refused",
+			"connection reset",
+			"no such host",
+			"network is unreachable",
+			"i/o timeout",
+			"tls:",
+			"certificate",
+		},
+	},
+	{category: "timeout", patterns: []string{"timeout", "timed out", "deadline exceeded"}},
+	{category: "lock", patterns: []string{"operation in progress"}},
+	{category: "disk_space", patterns: []string{"disk space", "no space left"}},
+	{category: "permission", patterns: []string{"permission denied", "access is denied"}},
+	{category: "docker", patterns: []string{"docker", "container", "image"}},
+	{category: "registry", patterns: []string{"registry"}},
+	{category: "dependency", patterns: []string{"dependenc", "conflict"}},
+	{
+		category: "not_found",
+		patterns: []string{"not found", "not installed", "does not exist", "no such"},
+	},
+	{category: "invalid_input", patterns: []string{"invalid", "unknown", "must ", "cannot "}},
+}
+
+// TelemetryCommandStats counts the runs of a command
+type TelemetryCommandStats struct {
+	Count    uint64 `yaml:"count" json:"count"`
+	Failures uint64 `yaml:"failures" json:"failures"`
+}
+
+// TelemetryStats are the anonymous usage stats collected since they were last submitted. They only
+// contain counts, without any package options, paths, hostnames or error messages
+type TelemetryStats struct {
+	// Since is when collecting the stats started
+	Since time.Time `yaml:"since" json:"since"`
+	// Commands counts the runs and failures of each command
+	Commands map[string]TelemetryCommandStats `yaml:"commands,omitempty" json:"commands,omitempty"`
+	// Errors counts the failures in each error category
+	Errors map[string]uint64 `yaml:"errors,omitempty" json:"errors,omitempty"`
+	// PackageFailures counts the failed installs and upgrades of each package from the package
+	// registry. Packages installed from a local path aren't counted
+	PackageFailures map[string]uint64 `yaml:"packageFailures,omitempty" json:"packageFailures,omitempty"`
+}
+
+// TelemetryStatus is the telemetry settings along with the usage stats that haven't been
+// submitted yet
+type TelemetryStatus struct {
+	Enabled bool
+	// DisabledByEnv is set when telemetry is disabled via the DO_NOT_TRACK env var, regardless of the
+	// settings
+	DisabledByEnv bool
+	// Url is the URL that usage stats are submitted to. Usage stats are only kept locally when
+	// it's empty
+	Url           string
+	LastSubmitted time.Time
+	Stats         TelemetryStats
+}
+
+// telemetryState is the content of the telemetry file
+type telemetryState struct {
+	Enabled       bool           `yaml:"enabled"`
+	Url           string         `yaml:"url,omitempty"`
+	LastSubmitted time.Time      `yaml:"lastSubmitted,omitempty"`
+	Stats         TelemetryStats `yaml:"stats"`
+}
+
+// telemetryPayload is the usage stats submitted to the telemetry URL
+type telemetryPayload struct {
+	Version string         `json:"version"`
+	Os      string         `json:"os"`
+	Arch    string         `json:"arch"`
+	Until   time.Time      `json:"until"`
+	Stats   TelemetryStats `json:"stats"`
+}
+
+// Telemetry collects anonymous usage stats locally and submits them, but only once it has been
+// explicitly enabled. It's disabled by default
+type Telemetry struct {
+	config Config
+}
+
+func NewTelemetry(cfg Config) *Telemetry {
+	return &Telemetry{
+		config: cfg,
+	}
+}
+
+// Status returns the telemetry settings and the usage stats that haven't been submitted yet
+func (t *Telemetry) Status() (TelemetryStatus, error) {
+	state, err := t.load()
+	if err != nil {
+		return TelemetryStatus{}, err
+	}
+	return TelemetryStatus{
+		Enabled:       state.Enabled,
+		DisabledByEnv: telemetryDisabledByEnv(),
+		Url:           state.Url,
+		LastSubmitted: state.LastSubmitted,
+		Stats:         state.Stats,
+	}, nil
+}
+
+// Enable starts collecting usage stats. Usage stats are submitted to the URL, if provided, and
+// otherwise only kept locally. Providing an empty URL keeps any previously configured URL
+func (t *Telemetry) Enable(submitUrl string) error {
+	if submitUrl != "" {
+		if err := validateTelemetryUrl(submitUrl); err != nil {
+			return err
+		}
+	}
+	state, err := t.load()
+	if err != nil {
+		return err
+	}
+	if !state.Enabled {
+		state.Enabled = true
+		state.Stats = TelemetryStats{Since: time.Now().UTC()}
+	}
+	if submitUrl != "" {
+		state.Url = submitUrl
+	}
+	return t.save(state)
+}
+
+// Disable stops collecting usage stats and removes the usage stats that haven't been submitted
+func (t *Telemetry) Disable() error {
+	state, err := t.load()
+	if err != nil {
+		return err
+	}
+	state.Enabled = false
+	state.Stats = TelemetryStats{}
+	return t.save(state)
+}
+
+// RecordCommand counts a run of a command, if telemetry is enabled
+func (t *Telemetry) RecordCommand(command string) {
+	t.update(
+		func(stats *TelemetryStats) {
+			cmdStats := stats.Commands[command]
+			cmdStats.Count++
+			stats.Commands[command] = cmdStats
+		},
+	)
+}
+
+// RecordFailure counts a failure of a command in the category for the error message, if
+// telemetry is enabled. The error message itself isn't recorded
+func (t *Telemetry) RecordFailure(command string, message string) {
+	t.update(
+		func(stats *TelemetryStats) {
+			cmdStats := stats.Commands[command]
+			cmdStats.Failures++
+			stats.Commands[command] = cmdStats
+			stats.Errors[telemetryErrorCategory(message)]++
+		},
+	)
+}
+
+// recordPackageFailure counts a failed install or upgrade of a package, if telemetry is enabled.
+// Only packages from the package registry are counted, so that the names of private packages
+// aren't recorded
+func (t *Telemetry) recordPackageFailure(pkg Package) {
+	if pkg.origin != "" {
+		return
+	}
+	t.update(
+		func(stats *TelemetryStats) {
+			stats.PackageFailures[pkg.Name]++
+		},
+	)
+}
+
+// Submit sends the collected usage stats to the telemetry URL and starts collecting them again
+func (t *Telemetry) Submit(version string) error {
+	state, err := t.load()
+	if err != nil {
+		return err
+	}
+	if !state.Enabled || telemetryDisabledByEnv() {
+		return ErrTelemetryDisabled
+	}
+	if state.Url == "" {
+		return ErrTelemetryNoUrl
+	}
+	if t.config.Offline {
+		return ErrOffline
+	}
+	return t.submit(t.config, state, version)
+}
+
+// SubmitIfDue sends the collected usage stats to the telemetry URL when they were last submitted
+// more than a week ago. Failures are only logged, since they shouldn't affect the command that
+// was run
+func (t *Telemetry) SubmitIfDue(version string) {
+	state, err := t.load()
+	if err != nil || !state.Enabled || state.Url == "" || telemetryDisabledByEnv() ||
+		t.config.Offline {
+		return
+	}
+	if time.Since(state.Stats.Since) < telemetrySubmitInterval {
+		return
+	}
+	submitCfg := t.config
+	submitCfg.Http.Timeout = telemetrySubmitTimeout
+	submitCfg.Http.Retries = 0
+	if err := t.submit(submitCfg, state, version); err != nil {
+		t.config.Logger.Debug(
+			fmt.Sprintf("failed to submit usage stats: %s", err),
+		)
+	}
+}
+
+func (t *Telemetry) submit(cfg Config, state telemetryState, version string) error {
+	now := time.Now().UTC()
+	payload, err := json.Marshal(
+		telemetryPayload{
+			Version: version,
+			Os:      runtime.GOOS,
+			Arch:    runtime.GOARCH,
+			Until:   now,
+			Stats:   state.Stats,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		cfg.ctx(),
+		http.MethodPost,
+		state.Url,
+		bytes.NewReader(payload),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpDo(cfg, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return NewTelemetrySubmitError(resp.Status)
+	}
+	// Stats recorded while submitting are kept, and only the submitted counts are removed
+	latestState, err := t.load()
+	if err != nil {
+		return err
+	}
+	latestState.LastSubmitted = now
+	latestState.Stats = subtractTelemetryStats(latestState.Stats, state.Stats)
+	latestState.Stats.Since = now
+	return t.save(latestState)
+}
+
+// update applies a change to the usage stats, if telemetry is enabled. Failures are only logged,
+// since they shouldn't affect the command that was run
+func (t *Telemetry) update(updateFunc func(*TelemetryStats)) {
+	if telemetryDisabledByEnv() {
+		return
+	}
+	state, err := t.load()
+	if err != nil || !state.Enabled {
+		return
+	}
+	if state.Stats.Since.IsZero() {
+		state.Stats.Since = time.Now().UTC()
+	}
+	if state.Stats.Commands == nil {
+		state.Stats.Commands = make(map[string]TelemetryCommandStats)
+	}
+	if state.Stats.Errors == nil {
+		state.Stats.Errors = make(map[string]uint64)
+	}
+	if state.Stats.PackageFailures == nil {
+		state.Stats.PackageFailures = make(map[string]uint64)
+	}
+	updateFunc(&state.Stats)
+	if err := t.save(state); err != nil {
+		t.config.Logger.Debug(
+			fmt.Sprintf("failed to save usage stats: %s", err),
+		)
+	}
+}
+
+func (t *Telemetry) load() (telemetryState, error) {
+	var ret telemetryState
+	content, err := os.ReadFile(filepath.Join(t.config.ConfigDir, telemetryFilename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ret, nil
+		}
+		return ret, err
+	}
+	if err := yaml.Unmarshal(content, &ret); err != nil {
+		return telemetryState{}, fmt.Errorf("failed to parse telemetry settings: %w", err)
+	}
+	return ret, nil
+}
+
+// save writes the telemetry file, which other cardano-up processes never see partially written
+func (t *Telemetry) save(state telemetryState) error {
+	if err := os.MkdirAll(t.config.ConfigDir, fs.ModePerm); err != nil {
+		return err
+	}
+	content, err := yaml.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(t.config.ConfigDir, telemetryFilename), content)
+}
+
+// telemetry returns the telemetry for the package manager
+func (p *PackageManager) telemetry() *Telemetry {
+	return NewTelemetry(p.config)
+}
+
+// telemetryDisabledByEnv returns whether telemetry is disabled via the DO_NOT_TRACK env var
+func telemetryDisabledByEnv() bool {
+	val := strings.TrimSpace(os.Getenv("DO_NOT_TRACK"))
+	return val != "" && val != "0" && !strings.EqualFold(val, "false")
+}
+
+func validateTelemetryUrl(submitUrl string) error {
+	tmpUrl, err := url.Parse(submitUrl)
+	if err != nil || tmpUrl.Scheme != "https" || tmpUrl.Host == "" {
+		return fmt.Errorf("invalid telemetry URL, it must be an https URL: %s", submitUrl)
+	}
+	return nil
+}
+
+// telemetryErrorCategory returns the category for an error message
+func telemetryErrorCategory(message string) string {
+	message = strings.ToLower(message)
+	for _, tmpCategory := range telemetryErrorCategories {
+		for _, pattern := range tmpCategory.patterns {
+			if strings.Contains(message, pattern) {
+				return tmpCategory.category
+			}
+		}
+	}
+	return TelemetryErrorOther
+}
+
+// subtractTelemetryStats returns the stats with the submitted counts removed
+func subtractTelemetryStats(stats TelemetryStats, submitted TelemetryStats) TelemetryStats {
+	ret := TelemetryStats{
+		Since: stats.Since,
+	}
+	for command, cmdStats := range stats.Commands {
+		submittedStats := submitted.Commands[command]
+		cmdStats.Count -= min(cmdStats.Count, submittedStats.Count)
+		cmdStats.Failures -= min(cmdStats.Failures, submittedStats.Failures)
+		if cmdStats.Count > 0 || cmdStats.Failures > 0 {
+			if ret.Commands == nil {
+				ret.Commands = make(map[string]TelemetryCommandStats)
+			}
+			ret.Commands[command] = cmdStats
+		}
+	}
+	ret.Errors = subtractCounts(stats.Errors, submitted.Errors)
+	ret.PackageFailures = subtractCounts(stats.PackageFailures, submitted.PackageFailures)
+	return ret
+}
+
+func subtractCounts(counts map[string]uint64, submitted map[string]uint64) map[string]uint64 {
+	var ret map[string]uint64
+	for key, count := range counts {
+		count -= min(count, submitted[key])
+		if count == 0 {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]uint64)
+		}
+		ret[key] = count
+	}
+	return ret
+}
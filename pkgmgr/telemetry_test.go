@@ -0,0 +1,188 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTelemetryErrorCategory(t *testing.T) {
+	testDefs := []struct {
+		message  string
+		expected string
+	}{
+		{
+			message:  "failed to fetch registry: dial tcp 1.2.3.4:443: connect: connection refused",
+			expected: "network",
+		},
+		{
+			message:  "timed out waiting for containers to become healthy",
+			expected: "timeout",
+		},
+		{
+			message:  "package cardano-node is not installed in context mainnet",
+			expected: "not_found",
+		},
+		{
+			message:  "Error response from daemon: Conflict. The container name is already in use",
+			expected: "docker",
+		},
+		{
+			message:  "another cardano-up operation in progress, try again later",
+			expected: "lock",
+		},
+		{
+			message:  "something unexpected happened",
+			expected: TelemetryErrorOther,
+		},
+	}
+	for _, testDef := range testDefs {
+		if category := telemetryErrorCategory(testDef.message); category != testDef.expected {
+			t.Fatalf(
+				"did not get expected category for %q: got %s, expected %s",
+				testDef.message,
+				category,
+				testDef.expected,
+			)
+		}
+	}
+}
+
+func newTestTelemetry(t *testing.T) *Telemetry {
+	t.Setenv("DO_NOT_TRACK", "")
+	return NewTelemetry(
+		Config{
+			ConfigDir: t.TempDir(),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+	)
+}
+
+func TestTelemetryDisabledByDefault(t *testing.T) {
+	telemetry := newTestTelemetry(t)
+	telemetry.RecordCommand("install")
+	telemetry.RecordFailure("install", "connection refused")
+	telemetry.recordPackageFailure(Package{Name: "cardano-node"})
+	if _, err := os.Stat(filepath.Join(telemetry.config.ConfigDir, telemetryFilename)); err == nil {
+		t.Fatalf("telemetry file was written while telemetry was disabled")
+	}
+	if err := telemetry.Submit("1.0.0"); err != ErrTelemetryDisabled {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+}
+
+func TestTelemetryRecord(t *testing.T) {
+	telemetry := newTestTelemetry(t)
+	if err := telemetry.Enable(""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	telemetry.RecordCommand("install")
+	telemetry.RecordCommand("install")
+	telemetry.RecordFailure("install", "dial tcp: i/o timeout")
+	telemetry.recordPackageFailure(Package{Name: "cardano-node"})
+	// Packages installed from a local path aren't counted
+	telemetry.recordPackageFailure(Package{Name: "private-pkg", origin: "/tmp/private-pkg"})
+	status, err := telemetry.Status()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedCommands := map[string]TelemetryCommandStats{
+		"install": {Count: 2, Failures: 1},
+	}
+	if !reflect.DeepEqual(status.Stats.Commands, expectedCommands) {
+		t.Fatalf("did not get expected command stats: %+v", status.Stats.Commands)
+	}
+	if !reflect.DeepEqual(status.Stats.Errors, map[string]uint64{"network": 1}) {
+		t.Fatalf("did not get expected error stats: %+v", status.Stats.Errors)
+	}
+	if !reflect.DeepEqual(status.Stats.PackageFailures, map[string]uint64{"cardano-node": 1}) {
+		t.Fatalf("did not get expected package failures: %+v", status.Stats.PackageFailures)
+	}
+	if err := telemetry.Submit("1.0.0"); err != ErrTelemetryNoUrl {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	// Disabling removes the collected stats
+	if err := telemetry.Disable(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	status, err = telemetry.Status()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.Enabled || len(status.Stats.Commands) > 0 {
+		t.Fatalf("did not get expected status after disabling: %+v", status)
+	}
+}
+
+func TestTelemetrySubmit(t *testing.T) {
+	var payload telemetryPayload
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			},
+		),
+	)
+	defer server.Close()
+	telemetry := newTestTelemetry(t)
+	if err := telemetry.Enable("http://localhost:8080"); err == nil {
+		t.Fatalf("did not get expected error for non-https URL")
+	}
+	if err := telemetry.Enable(""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Point the telemetry at the test server, which doesn't use https
+	state, err := telemetry.load()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	state.Url = server.URL
+	if err := telemetry.save(state); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	telemetry.RecordCommand("upgrade")
+	telemetry.RecordFailure("upgrade", "no space left on device")
+	if err := telemetry.Submit("1.2.3"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if payload.Version != "1.2.3" ||
+		!reflect.DeepEqual(
+			payload.Stats.Commands,
+			map[string]TelemetryCommandStats{"upgrade": {Count: 1, Failures: 1}},
+		) ||
+		!reflect.DeepEqual(payload.Stats.Errors, map[string]uint64{"disk_space": 1}) {
+		t.Fatalf("did not get expected payload: %+v", payload)
+	}
+	status, err := telemetry.Status()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.LastSubmitted.IsZero() || len(status.Stats.Commands) > 0 ||
+		len(status.Stats.Errors) > 0 {
+		t.Fatalf("did not get expected status after submitting: %+v", status)
+	}
+}
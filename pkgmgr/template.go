@@ -18,22 +18,53 @@ import (
 	"bytes"
 	"fmt"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/Masterminds/sprig/v3"
 )
 
+// Template renders template bodies with a set of base variables and functions. A Template isn't
+// modified after it's created, and each body is parsed into its own template.Template, so a
+// Template can be shared between packages and used for concurrent renders
 type Template struct {
-	tmpl     *template.Template
 	baseVars map[string]any
+	// funcs are the extra functions on top of the sprig functions
+	funcs template.FuncMap
+	// funcMap has the sprig functions along with funcs, and is only read after it's created
+	funcMap template.FuncMap
 }
 
 func NewTemplate(baseVars map[string]any) *Template {
+	return newTemplate(baseVars, nil)
+}
+
+func newTemplate(baseVars map[string]any, funcs template.FuncMap) *Template {
+	funcMap := sprig.FuncMap()
+	for k, v := range funcs {
+		funcMap[k] = v
+	}
 	return &Template{
-		tmpl:     template.New("main").Funcs(sprig.FuncMap()),
 		baseVars: baseVars,
+		funcs:    funcs,
+		funcMap:  funcMap,
 	}
 }
 
+// newParseTemplate returns a new template.Template with the template functions, which a single
+// template body is parsed into
+func (t *Template) newParseTemplate(name string) *template.Template {
+	return template.New(name).Funcs(t.funcMap)
+}
+
+// parse parses the template body without rendering it
+func (t *Template) parse(tmplBody string) (*parse.Tree, error) {
+	tmpl, err := t.newParseTemplate("parse").Parse(tmplBody)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Tree, nil
+}
+
 func (t *Template) Render(
 	tmplBody string,
 	extraVars map[string]any,
@@ -46,8 +77,9 @@ func (t *Template) Render(
 	for k, v := range extraVars {
 		tmpVars[k] = v
 	}
-	// Parse template body
-	tmpl, err := t.tmpl.Parse(tmplBody)
+	// Parse template body into a new template, so that definitions from other template bodies
+	// aren't visible and concurrent renders don't share any state
+	tmpl, err := t.newParseTemplate("main").Parse(tmplBody)
 	if err != nil {
 		return "", err
 	}
@@ -68,7 +100,23 @@ func (t *Template) WithVars(extraVars map[string]any) *Template {
 	for k, v := range extraVars {
 		tmpVars[k] = v
 	}
-	tmpl := NewTemplate(tmpVars)
+	return &Template{
+		baseVars: tmpVars,
+		funcs:    t.funcs,
+		funcMap:  t.funcMap,
+	}
+}
+
+// WithFuncs creates a copy of the Template with the extra functions added to the original functions
+func (t *Template) WithFuncs(extraFuncs template.FuncMap) *Template {
+	tmpFuncs := template.FuncMap{}
+	for k, v := range t.funcs {
+		tmpFuncs[k] = v
+	}
+	for k, v := range extraFuncs {
+		tmpFuncs[k] = v
+	}
+	tmpl := newTemplate(t.baseVars, tmpFuncs)
 	return tmpl
 }
 
@@ -0,0 +1,129 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateRender(t *testing.T) {
+	tmpl := NewTemplate(map[string]any{"Name": "foo"})
+	rendered, err := tmpl.Render(
+		`{{ .Name }}-{{ .Version }}-{{ upper "x" }}`,
+		map[string]any{"Version": "1.0.0"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rendered != "foo-1.0.0-X" {
+		t.Fatalf("did not get expected output: got %q", rendered)
+	}
+	// Extra vars aren't kept between renders
+	rendered, err = tmpl.Render(`{{ .Version }}`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rendered != "<no value>" {
+		t.Fatalf("did not get expected output: got %q", rendered)
+	}
+}
+
+func TestTemplateRenderIsolated(t *testing.T) {
+	tmpl := NewTemplate(nil)
+	if _, err := tmpl.Render(`{{ define "extra" }}foo{{ end }}bar`, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Definitions from a previous render aren't available
+	if _, err := tmpl.Render(`{{ template "extra" }}`, nil); err == nil {
+		t.Fatalf("did not get expected error for template defined by another render")
+	}
+	// A failed parse doesn't affect later renders
+	if _, err := tmpl.Render(`{{ .Foo `, nil); err == nil {
+		t.Fatalf("did not get expected error for invalid template")
+	}
+	rendered, err := tmpl.Render(`baz`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rendered != "baz" {
+		t.Fatalf("did not get expected output: got %q", rendered)
+	}
+}
+
+func TestTemplateWithVarsAndFuncs(t *testing.T) {
+	base := NewTemplate(map[string]any{"Name": "foo"}).WithFuncs(
+		template.FuncMap{
+			"greet": func(name string) string { return "hello " + name },
+		},
+	)
+	tmpl := base.WithVars(map[string]any{"Name": "bar"})
+	// Copies keep the functions of the original
+	rendered, err := tmpl.Render(`{{ greet .Name }}`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rendered != "hello bar" {
+		t.Fatalf("did not get expected output: got %q", rendered)
+	}
+	// The original isn't changed by copies
+	rendered, err = base.Render(`{{ greet .Name }}`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if rendered != "hello foo" {
+		t.Fatalf("did not get expected output: got %q", rendered)
+	}
+	if _, err := NewTemplate(nil).Render(`{{ greet "baz" }}`, nil); err == nil {
+		t.Fatalf("did not get expected error for function from another template")
+	}
+}
+
+func TestTemplateConcurrentRender(t *testing.T) {
+	tmpl := NewTemplate(map[string]any{"Prefix": "pkg"})
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			pkgTmpl := tmpl.WithVars(map[string]any{"Idx": idx})
+			for j := 0; j < 50; j++ {
+				expected := fmt.Sprintf("pkg-%d-%d", idx, j)
+				rendered, err := pkgTmpl.Render(
+					`{{ define "name" }}{{ .Prefix }}-{{ .Idx }}{{ end }}`+
+						fmt.Sprintf(`{{ template "name" . }}-%d`, j),
+					nil,
+				)
+				if err != nil {
+					errs[idx] = err
+					return
+				}
+				if rendered != expected {
+					errs[idx] = fmt.Errorf("got %q, expected %q", rendered, expected)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
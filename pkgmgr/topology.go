@@ -0,0 +1,502 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// topologyBaseSuffix is appended to the topology file path for the copy of the topology file
+	// originally provided by the package, which is used as the base when regenerating it
+	topologyBaseSuffix = ".base"
+)
+
+// PackageTopology declares the cardano-node topology file for a package, which allows managing
+// the topology with cardano-up
+type PackageTopology struct {
+	// Filename is the path to the topology file, relative to the package data dir
+	Filename string `yaml:"filename" jsonschema:"required"`
+	// ContainerName is the container to restart when the topology changes. All containers for
+	// the package are restarted if not specified
+	ContainerName string `yaml:"containerName,omitempty"`
+}
+
+func (p *PackageTopology) validate(installSteps []PackageInstallStep) error {
+	if p.Filename == "" {
+		return fmt.Errorf("topology filename cannot be empty")
+	}
+	if filepath.IsAbs(p.Filename) ||
+		strings.HasPrefix(filepath.Clean(p.Filename), "..") {
+		return fmt.Errorf(
+			"topology filename must be relative to the package data dir: %s",
+			p.Filename,
+		)
+	}
+	if p.ContainerName != "" {
+		for _, installStep := range installSteps {
+			if installStep.Docker != nil &&
+				installStep.Docker.ContainerName == p.ContainerName {
+				return nil
+			}
+		}
+		return fmt.Errorf(
+			"topology container %q does not match any docker install step",
+			p.ContainerName,
+		)
+	}
+	return nil
+}
+
+// Topology is the managed topology for an installed package
+type Topology struct {
+	// P2P controls whether the topology file uses the P2P format (local/public roots) or the
+	// legacy format (producers)
+	P2P bool `yaml:"p2p"`
+	// Peers are the upstream peers added with cardano-up. These are added as local roots when
+	// using P2P
+	Peers []TopologyPeer `yaml:"peers,omitempty"`
+}
+
+// TopologyPeer is an upstream peer in a topology
+type TopologyPeer struct {
+	Address string `yaml:"address"`
+	Port    uint   `yaml:"port"`
+}
+
+// NewTopologyPeer parses a peer in the ADDRESS:PORT format
+func NewTopologyPeer(peer string) (TopologyPeer, error) {
+	host, port, err := net.SplitHostPort(peer)
+	if err != nil {
+		return TopologyPeer{}, NewInvalidTopologyPeerError(peer)
+	}
+	tmpPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || host == "" || tmpPort == 0 {
+		return TopologyPeer{}, NewInvalidTopologyPeerError(peer)
+	}
+	return TopologyPeer{
+		Address: host,
+		Port:    uint(tmpPort),
+	}, nil
+}
+
+func (t TopologyPeer) String() string {
+	return net.JoinHostPort(t.Address, strconv.FormatUint(uint64(t.Port), 10))
+}
+
+// TopologyRegistry tracks the managed topology for installed packages. It's keyed on the context
+// and package instance name, like the port registry
+type TopologyRegistry map[string]Topology
+
+// Topology returns the managed topology for the specified installed package in the active
+// context. If no package is specified, the only installed package that declares a topology
+// file is used. The returned package is the one that the topology belongs to
+func (p *PackageManager) Topology(pkgName string) (InstalledPackage, Topology, error) {
+	installedPkg, err := p.topologyPackage(pkgName)
+	if err != nil {
+		return InstalledPackage{}, Topology{}, err
+	}
+	topology, err := p.packageTopology(installedPkg)
+	if err != nil {
+		return InstalledPackage{}, Topology{}, err
+	}
+	return installedPkg, topology, nil
+}
+
+// AddTopologyPeer adds an upstream peer to the topology for an installed package
+func (p *PackageManager) AddTopologyPeer(pkgName string, peer TopologyPeer) error {
+	return p.updateTopology(
+		pkgName,
+		func(topology *Topology) error {
+			for _, tmpPeer := range topology.Peers {
+				if tmpPeer == peer {
+					return NewTopologyPeerExistsError(peer.String())
+				}
+			}
+			topology.Peers = append(topology.Peers, peer)
+			return nil
+		},
+	)
+}
+
+// RemoveTopologyPeer removes an upstream peer from the topology for an installed package
+func (p *PackageManager) RemoveTopologyPeer(pkgName string, peer TopologyPeer) error {
+	return p.updateTopology(
+		pkgName,
+		func(topology *Topology) error {
+			var tmpPeers []TopologyPeer
+			for _, tmpPeer := range topology.Peers {
+				if tmpPeer != peer {
+					tmpPeers = append(tmpPeers, tmpPeer)
+				}
+			}
+			if len(tmpPeers) == len(topology.Peers) {
+				return NewTopologyPeerNotFoundError(peer.String())
+			}
+			topology.Peers = tmpPeers
+			return nil
+		},
+	)
+}
+
+// SetTopologyP2P enables or disables the P2P topology format for an installed package
+func (p *PackageManager) SetTopologyP2P(pkgName string, enabled bool) error {
+	return p.updateTopology(
+		pkgName,
+		func(topology *Topology) error {
+			topology.P2P = enabled
+			return nil
+		},
+	)
+}
+
+func (p *PackageManager) updateTopology(
+	pkgName string,
+	updateFunc func(*Topology) error,
+) error {
+	unlock, err := p.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	installedPkg, err := p.topologyPackage(pkgName)
+	if err != nil {
+		return err
+	}
+	topology, err := p.packageTopology(installedPkg)
+	if err != nil {
+		return err
+	}
+	if err := updateFunc(&topology); err != nil {
+		return err
+	}
+	p.state.Topologies[portOwner(installedPkg.Package, installedPkg.Context)] = topology
+	if err := p.state.Save(); err != nil {
+		return err
+	}
+	return p.applyTopology(installedPkg, topology)
+}
+
+// topologyPackage returns the installed package in the active context with the specified
+// instance name, or the only installed package with a topology file if no name is provided
+func (p *PackageManager) topologyPackage(pkgName string) (InstalledPackage, error) {
+	activeContextName, _ := p.CurrentContext()
+	var topologyPkgs []InstalledPackage
+	for _, installedPkg := range p.InstalledPackages() {
+		if pkgName != "" && installedPkg.InstanceName() == pkgName {
+			if installedPkg.Package.Topology == nil {
+				return InstalledPackage{}, NewPackageNoTopologyError(pkgName)
+			}
+			return installedPkg, nil
+		}
+		if installedPkg.Package.Topology != nil {
+			topologyPkgs = append(topologyPkgs, installedPkg)
+		}
+	}
+	if pkgName != "" {
+		return InstalledPackage{}, NewPackageNotInstalledError(
+			pkgName,
+			activeContextName,
+		)
+	}
+	if len(topologyPkgs) == 0 {
+		return InstalledPackage{}, ErrNoTopologyPackages
+	}
+	if len(topologyPkgs) > 1 {
+		var pkgNames []string
+		for _, topologyPkg := range topologyPkgs {
+			pkgNames = append(pkgNames, topologyPkg.InstanceName())
+		}
+		return InstalledPackage{}, NewTopologyPackageAmbiguousError(pkgNames)
+	}
+	return topologyPkgs[0], nil
+}
+
+// packageTopology returns the managed topology for an installed package. A default is generated
+// from the package's topology file if the topology isn't managed yet
+func (p *PackageManager) packageTopology(installedPkg InstalledPackage) (Topology, error) {
+	owner := portOwner(installedPkg.Package, installedPkg.Context)
+	if topology, ok := p.state.Topologies[owner]; ok {
+		return topology, nil
+	}
+	topologyPath, err := p.topologyPath(installedPkg)
+	if err != nil {
+		return Topology{}, err
+	}
+	base, err := readTopologyBase(topologyPath)
+	if err != nil {
+		return Topology{}, err
+	}
+	return Topology{
+		P2P: topologyIsP2P(base),
+	}, nil
+}
+
+// applyTopology regenerates the topology file for an installed package and restarts its
+// containers if the file changed
+func (p *PackageManager) applyTopology(
+	installedPkg InstalledPackage,
+	topology Topology,
+) error {
+	topologyPath, err := p.topologyPath(installedPkg)
+	if err != nil {
+		return err
+	}
+	base, err := readTopologyBase(topologyPath)
+	if err != nil {
+		return err
+	}
+	content, err := renderTopology(base, topology)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(topologyPath); err == nil &&
+		bytes.Equal(existing, content) {
+		p.config.Logger.Debug(
+			fmt.Sprintf("topology file %s is unchanged", topologyPath),
+		)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(topologyPath), fs.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(topologyPath, content, 0o644); err != nil {
+		return err
+	}
+	p.config.Logger.Debug(fmt.Sprintf("wrote topology file %s", topologyPath))
+	return p.restartPackageContainers(
+		installedPkg,
+		installedPkg.Package.Topology.ContainerName,
+		"topology changes",
+	)
+}
+
+// reapplyTopology regenerates the topology file for a freshly installed package if its topology
+// is already managed, such as after an upgrade
+func (p *PackageManager) reapplyTopology(installedPkg InstalledPackage) {
+	if installedPkg.Package.Topology == nil {
+		return
+	}
+	owner := portOwner(installedPkg.Package, installedPkg.Context)
+	topology, ok := p.state.Topologies[owner]
+	if !ok {
+		return
+	}
+	if err := p.applyTopology(installedPkg, topology); err != nil {
+		p.config.Logger.Warn(
+			fmt.Sprintf("failed to apply topology: %s", err),
+		)
+	}
+}
+
+// topologyPath returns the path to the topology file for an installed package
+func (p *PackageManager) topologyPath(installedPkg InstalledPackage) (string, error) {
+	pkg := installedPkg.Package
+	cfg := p.config
+	cfg.Template = cfg.Template.WithVars(
+		pkg.templateVars(cfg, installedPkg.Context, installedPkg.Options),
+	)
+	filename, err := cfg.Template.Render(pkg.Topology.Filename, nil)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(
+		cfg.packageDataDir(
+			fmt.Sprintf("%s-%s-%s", pkg.instanceName(), pkg.Version, installedPkg.Context),
+		),
+		filename,
+	), nil
+}
+
+// readTopologyBase returns the topology file originally provided by the package. A copy of the
+// current topology file is saved as the base the first time it's needed
+func readTopologyBase(topologyPath string) ([]byte, error) {
+	basePath := topologyPath + topologyBaseSuffix
+	base, err := os.ReadFile(basePath)
+	if err == nil {
+		return base, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	base, err = os.ReadFile(topologyPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		// Record an empty base when the package doesn't provide a topology file, so that the
+		// generated topology file isn't mistaken for the base on the next call
+		base = nil
+		if err := os.MkdirAll(filepath.Dir(basePath), fs.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(basePath, base, 0o644); err != nil {
+		return nil, err
+	}
+	return base, nil
+}
+
+// topologyIsP2P returns whether topology file content uses the P2P format. An empty topology
+// defaults to P2P
+func topologyIsP2P(content []byte) bool {
+	var raw map[string]any
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return true
+	}
+	_, hasProducers := raw["Producers"]
+	return !hasProducers
+}
+
+// renderTopology generates topology file content from the base topology file provided by the
+// package and the managed topology. Fields in the base that aren't managed are preserved
+func renderTopology(base []byte, topology Topology) ([]byte, error) {
+	raw := make(map[string]any)
+	if len(bytes.TrimSpace(base)) > 0 {
+		if err := json.Unmarshal(base, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse topology file: %s", err)
+		}
+	}
+	// Peers from the legacy format
+	var producerPeers []TopologyPeer
+	if producers, ok := raw["Producers"].([]any); ok {
+		for _, producer := range producers {
+			if tmpPeer, ok := topologyPeerFromJson(producer, "addr"); ok {
+				producerPeers = append(producerPeers, tmpPeer)
+			}
+		}
+	}
+	if topology.P2P {
+		localRoots, _ := raw["localRoots"].([]any)
+		if len(topology.Peers) > 0 {
+			localRoots = append(
+				localRoots,
+				map[string]any{
+					"accessPoints": topologyAccessPoints(topology.Peers),
+					"advertise":    false,
+					"trustable":    true,
+					"valency":      len(topology.Peers),
+				},
+			)
+		}
+		if localRoots == nil {
+			localRoots = []any{}
+		}
+		raw["localRoots"] = localRoots
+		if _, ok := raw["publicRoots"]; !ok {
+			// Use the legacy producers as public roots
+			raw["publicRoots"] = []any{
+				map[string]any{
+					"accessPoints": topologyAccessPoints(producerPeers),
+					"advertise":    false,
+				},
+			}
+		}
+		delete(raw, "Producers")
+	} else {
+		// Gather peers from the P2P format
+		peers := producerPeers
+		for _, key := range []string{"localRoots", "publicRoots"} {
+			roots, _ := raw[key].([]any)
+			for _, root := range roots {
+				tmpRoot, _ := root.(map[string]any)
+				accessPoints, _ := tmpRoot["accessPoints"].([]any)
+				for _, accessPoint := range accessPoints {
+					if tmpPeer, ok := topologyPeerFromJson(accessPoint, "address"); ok {
+						peers = append(peers, tmpPeer)
+					}
+				}
+			}
+		}
+		bootstrapPeers, _ := raw["bootstrapPeers"].([]any)
+		for _, bootstrapPeer := range bootstrapPeers {
+			if tmpPeer, ok := topologyPeerFromJson(bootstrapPeer, "address"); ok {
+				peers = append(peers, tmpPeer)
+			}
+		}
+		peers = append(peers, topology.Peers...)
+		producers := []any{}
+		seenPeers := make(map[TopologyPeer]bool)
+		for _, peer := range peers {
+			if seenPeers[peer] {
+				continue
+			}
+			seenPeers[peer] = true
+			producers = append(
+				producers,
+				map[string]any{
+					"addr":    peer.Address,
+					"port":    peer.Port,
+					"valency": 1,
+				},
+			)
+		}
+		raw["Producers"] = producers
+		p2pKeys := []string{
+			"localRoots",
+			"publicRoots",
+			"bootstrapPeers",
+			"useLedgerAfterSlot",
+		}
+		for _, key := range p2pKeys {
+			delete(raw, key)
+		}
+	}
+	ret, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, '\n'), nil
+}
+
+func topologyAccessPoints(peers []TopologyPeer) []any {
+	ret := []any{}
+	for _, peer := range peers {
+		ret = append(
+			ret,
+			map[string]any{
+				"address": peer.Address,
+				"port":    peer.Port,
+			},
+		)
+	}
+	return ret
+}
+
+// topologyPeerFromJson returns a peer from a decoded JSON object with the specified address key
+func topologyPeerFromJson(val any, addressKey string) (TopologyPeer, bool) {
+	tmpVal, ok := val.(map[string]any)
+	if !ok {
+		return TopologyPeer{}, false
+	}
+	address, _ := tmpVal[addressKey].(string)
+	port, _ := tmpVal["port"].(float64)
+	if address == "" || port <= 0 {
+		return TopologyPeer{}, false
+	}
+	return TopologyPeer{
+		Address: address,
+		Port:    uint(port),
+	}, true
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewTopologyPeer(t *testing.T) {
+	testDefs := []struct {
+		peer        string
+		expected    TopologyPeer
+		expectError bool
+	}{
+		{
+			peer:     "relay1.example.com:3001",
+			expected: TopologyPeer{Address: "relay1.example.com", Port: 3001},
+		},
+		{
+			peer:     "[2001:db8::1]:6000",
+			expected: TopologyPeer{Address: "2001:db8::1", Port: 6000},
+		},
+		{
+			peer:        "relay1.example.com",
+			expectError: true,
+		},
+		{
+			peer:        "relay1.example.com:70000",
+			expectError: true,
+		},
+		{
+			peer:        ":3001",
+			expectError: true,
+		},
+	}
+	for _, testDef := range testDefs {
+		peer, err := NewTopologyPeer(testDef.peer)
+		if testDef.expectError {
+			if err == nil {
+				t.Fatalf("did not get expected error for peer %q", testDef.peer)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for peer %q: %s", testDef.peer, err)
+		}
+		if peer != testDef.expected {
+			t.Fatalf(
+				"did not get expected peer: got %#v, expected %#v",
+				peer,
+				testDef.expected,
+			)
+		}
+		if peer.String() != testDef.peer {
+			t.Fatalf(
+				"did not get expected peer string: got %q, expected %q",
+				peer.String(),
+				testDef.peer,
+			)
+		}
+	}
+}
+
+func TestRenderTopology(t *testing.T) {
+	p2pBase := `{
+  "bootstrapPeers": [{"address": "backbone.example.com", "port": 3001}],
+  "localRoots": [],
+  "publicRoots": [{"accessPoints": [{"address": "public.example.com", "port": 3001}], "advertise": false}],
+  "useLedgerAfterSlot": 1000
+}`
+	legacyBase := `{
+  "Producers": [{"addr": "public.example.com", "port": 3001, "valency": 1}]
+}`
+	peers := []TopologyPeer{
+		{Address: "relay1.example.com", Port: 3001},
+	}
+	testDefs := []struct {
+		name     string
+		base     string
+		topology Topology
+		expected string
+	}{
+		{
+			name:     "p2p",
+			base:     p2pBase,
+			topology: Topology{P2P: true, Peers: peers},
+			expected: `{
+  "bootstrapPeers": [{"address": "backbone.example.com", "port": 3001}],
+  "localRoots": [{"accessPoints": [{"address": "relay1.example.com", "port": 3001}], "advertise": false, "trustable": true, "valency": 1}],
+  "publicRoots": [{"accessPoints": [{"address": "public.example.com", "port": 3001}], "advertise": false}],
+  "useLedgerAfterSlot": 1000
+}`,
+		},
+		{
+			name:     "p2p to legacy",
+			base:     p2pBase,
+			topology: Topology{P2P: false, Peers: peers},
+			expected: `{
+  "Producers": [
+    {"addr": "public.example.com", "port": 3001, "valency": 1},
+    {"addr": "backbone.example.com", "port": 3001, "valency": 1},
+    {"addr": "relay1.example.com", "port": 3001, "valency": 1}
+  ]
+}`,
+		},
+		{
+			name:     "legacy to p2p",
+			base:     legacyBase,
+			topology: Topology{P2P: true, Peers: peers},
+			expected: `{
+  "localRoots": [{"accessPoints": [{"address": "relay1.example.com", "port": 3001}], "advertise": false, "trustable": true, "valency": 1}],
+  "publicRoots": [{"accessPoints": [{"address": "public.example.com", "port": 3001}], "advertise": false}]
+}`,
+		},
+		{
+			name:     "empty",
+			base:     "",
+			topology: Topology{P2P: true},
+			expected: `{
+  "localRoots": [],
+  "publicRoots": [{"accessPoints": [], "advertise": false}]
+}`,
+		},
+	}
+	for _, testDef := range testDefs {
+		content, err := renderTopology([]byte(testDef.base), testDef.topology)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testDef.name, err)
+		}
+		var got, expected any
+		if err := json.Unmarshal(content, &got); err != nil {
+			t.Fatalf("%s: failed to parse rendered topology: %s", testDef.name, err)
+		}
+		if err := json.Unmarshal([]byte(testDef.expected), &expected); err != nil {
+			t.Fatalf("%s: failed to parse expected topology: %s", testDef.name, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf(
+				"%s: did not get expected topology\n  got: %s\n  expected: %s",
+				testDef.name,
+				content,
+				testDef.expected,
+			)
+		}
+	}
+}
+
+func TestReadTopologyBase(t *testing.T) {
+	topologyPath := filepath.Join(t.TempDir(), "topology.json")
+	// No topology file
+	base, err := readTopologyBase(topologyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(base) != 0 {
+		t.Fatalf("did not get expected empty base: %s", base)
+	}
+	// A generated topology file should not be used as the base later
+	if err := os.WriteFile(topologyPath, []byte(`{"localRoots": []}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	base, err = readTopologyBase(topologyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(base) != 0 {
+		t.Fatalf("did not get expected empty base: %s", base)
+	}
+	// The base is saved from the topology file provided by the package
+	topologyPath = filepath.Join(t.TempDir(), "topology.json")
+	if err := os.WriteFile(topologyPath, []byte(`{"Producers": []}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := readTopologyBase(topologyPath); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(topologyPath, []byte(`{"localRoots": []}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	base, err = readTopologyBase(topologyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(base) != `{"Producers": []}` {
+		t.Fatalf("did not get expected base: %s", base)
+	}
+	if topologyIsP2P(base) {
+		t.Fatalf("legacy topology was detected as P2P")
+	}
+}
+
+func TestAddTopologyPeer(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "node",
+				Version: "1.0.0",
+				Topology: &PackageTopology{
+					Filename: "config/topology.json",
+				},
+			},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+	}
+	// Topology changes reload the state from disk
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	topologyPath := filepath.Join(
+		cfg.DataDir,
+		"node-1.0.0-default",
+		"config",
+		"topology.json",
+	)
+	if err := os.MkdirAll(filepath.Dir(topologyPath), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(topologyPath, []byte(`{"localRoots": [], "publicRoots": []}`), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	peer := TopologyPeer{Address: "relay1.example.com", Port: 3001}
+	if err := pm.AddTopologyPeer("", peer); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.AddTopologyPeer("node", peer); err == nil {
+		t.Fatalf("did not get expected error adding duplicate peer")
+	}
+	installedPkg, topology, err := pm.Topology("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if installedPkg.InstanceName() != "node" {
+		t.Fatalf("did not get expected package: %s", installedPkg.InstanceName())
+	}
+	expectedTopology := Topology{P2P: true, Peers: []TopologyPeer{peer}}
+	if !reflect.DeepEqual(topology, expectedTopology) {
+		t.Fatalf(
+			"did not get expected topology: got %#v, expected %#v",
+			topology,
+			expectedTopology,
+		)
+	}
+	content, err := os.ReadFile(topologyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var rawTopology struct {
+		LocalRoots []struct {
+			AccessPoints []TopologyPeer `json:"accessPoints"`
+		} `json:"localRoots"`
+	}
+	if err := json.Unmarshal(content, &rawTopology); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rawTopology.LocalRoots) != 1 ||
+		!reflect.DeepEqual(rawTopology.LocalRoots[0].AccessPoints, []TopologyPeer{peer}) {
+		t.Fatalf("did not get expected topology file content: %s", content)
+	}
+	// The topology should be persisted in the state
+	if _, ok := pm.state.Topologies["default/node"]; !ok {
+		t.Fatalf("topology was not recorded in state")
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// UninstallPlan describes what uninstalling packages will remove
+type UninstallPlan struct {
+	// Packages are the packages to uninstall, in the order that they will be uninstalled
+	Packages []UninstallPlanPackage
+	// Broken are the installed packages that depend on the packages to uninstall and would break.
+	// Dependent packages are uninstalled rather than broken when cascading
+	Broken []InstalledPackage
+}
+
+// UninstallPlanPackage describes what uninstalling a single package will remove
+type UninstallPlanPackage struct {
+	Package InstalledPackage
+	// Dependent is true for packages that are only uninstalled because they depend on a requested
+	// package
+	Dependent  bool
+	Containers []string
+	// Images are the Docker images to delete
+	Images []string
+	Dirs   []UninstallPlanDir
+}
+
+// UninstallPlanDir is a package dir that will be deleted
+type UninstallPlanDir struct {
+	Path string
+	Size uint64
+}
+
+// PackageNames returns the names of the packages to uninstall, in order
+func (p UninstallPlan) PackageNames() []string {
+	ret := make([]string, 0, len(p.Packages))
+	for _, pkg := range p.Packages {
+		ret = append(ret, pkg.Package.InstanceName())
+	}
+	return ret
+}
+
+// PackageSpecs returns the specs of the packages to uninstall, in order. Each spec includes the
+// version, so that only that version is uninstalled when more than one is tracked
+func (p UninstallPlan) PackageSpecs() []string {
+	ret := make([]string, 0, len(p.Packages))
+	for _, pkg := range p.Packages {
+		ret = append(ret, pkg.Package.Spec())
+	}
+	return ret
+}
+
+// DataSize returns the total size of the dirs that will be deleted
+func (p UninstallPlan) DataSize() uint64 {
+	var ret uint64
+	for _, pkg := range p.Packages {
+		for _, dir := range pkg.Dirs {
+			ret += dir.Size
+		}
+	}
+	return ret
+}
+
+// UninstallPlan returns what uninstalling the specified packages in the active context will remove.
+// When cascade is true, the installed packages that depend on them are also uninstalled, before
+// the packages that they depend on
+func (p *PackageManager) UninstallPlan(
+	pkgNames []string,
+	keepData bool,
+	keepImages bool,
+	cascade bool,
+) (UninstallPlan, error) {
+	uninstallPkgs, err := p.installedPackagesBySpec(pkgNames, false)
+	if err != nil {
+		return UninstallPlan{}, err
+	}
+	activeContextName, _ := p.CurrentContext()
+	resolver, err := NewResolver(
+		p.InstalledPackages(),
+		// Only the installed packages are needed to find dependents, so the registry isn't loaded
+		nil,
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return UninstallPlan{}, err
+	}
+	requested := make(map[string]bool)
+	removing := make(map[string]bool)
+	for _, pkg := range uninstallPkgs {
+		requested[pkg.InstanceName()] = true
+		removing[pkg.Spec()] = true
+	}
+	// Order the packages so that dependent packages are uninstalled before their dependencies
+	var ordered []InstalledPackage
+	visited := make(map[string]bool)
+	var visit func(InstalledPackage) error
+	visit = func(pkg InstalledPackage) error {
+		if visited[pkg.Spec()] {
+			return nil
+		}
+		visited[pkg.Spec()] = true
+		// Dependents are left alone when another tracked version of the package is kept
+		if otherVersionInstalled(p.InstalledPackages(), pkg, removing) {
+			ordered = append(ordered, pkg)
+			return nil
+		}
+		dependents, err := resolver.Dependents(pkg)
+		if err != nil {
+			return err
+		}
+		for _, dependent := range dependents {
+			if !cascade && !requested[dependent.InstanceName()] {
+				continue
+			}
+			if err := visit(dependent); err != nil {
+				return err
+			}
+		}
+		ordered = append(ordered, pkg)
+		return nil
+	}
+	for _, pkg := range uninstallPkgs {
+		if err := visit(pkg); err != nil {
+			return UninstallPlan{}, err
+		}
+	}
+	var ret UninstallPlan
+	broken := make(map[string]bool)
+	for _, pkg := range ordered {
+		ret.Packages = append(
+			ret.Packages,
+			p.uninstallPlanPackage(pkg, keepData, keepImages, !requested[pkg.InstanceName()]),
+		)
+		if cascade || otherVersionInstalled(p.InstalledPackages(), pkg, removing) {
+			continue
+		}
+		dependents, err := resolver.Dependents(pkg)
+		if err != nil {
+			return UninstallPlan{}, err
+		}
+		for _, dependent := range dependents {
+			if requested[dependent.InstanceName()] || broken[dependent.InstanceName()] {
+				continue
+			}
+			broken[dependent.InstanceName()] = true
+			ret.Broken = append(ret.Broken, dependent)
+		}
+	}
+	return ret, nil
+}
+
+func (p *PackageManager) uninstallPlanPackage(
+	pkg InstalledPackage,
+	keepData bool,
+	keepImages bool,
+	dependent bool,
+) UninstallPlanPackage {
+	ret := UninstallPlanPackage{
+		Package:   pkg,
+		Dependent: dependent,
+	}
+	cfg := p.config
+	cfg.contextName = pkg.Context
+	pkgName := fmt.Sprintf(
+		"%s-%s-%s",
+		pkg.Package.instanceName(),
+		pkg.Package.Version,
+		pkg.Context,
+	)
+	for _, step := range pkg.Package.containerSteps(cfg, pkgName) {
+		if !step.PullOnly {
+			ret.Containers = append(
+				ret.Containers,
+				fmt.Sprintf("%s-%s", pkgName, step.ContainerName),
+			)
+		}
+		if !keepImages && step.Image != "" {
+			ret.Images = append(ret.Images, step.Image)
+		}
+	}
+	if keepData {
+		return ret
+	}
+	for _, tmpDir := range []string{
+		cfg.packageDataDir(pkgName),
+		filepath.Join(cfg.CacheDir, pkgName),
+		containerLogsDir(cfg, pkg.Context, pkg.Package.instanceName()),
+	} {
+		if _, err := os.Stat(tmpDir); err != nil {
+			continue
+		}
+		size, err := dirSize(tmpDir)
+		if err != nil {
+			p.config.Logger.Debug(
+				fmt.Sprintf("failed to get size of directory %q: %s", tmpDir, err),
+			)
+		}
+		ret.Dirs = append(ret.Dirs, UninstallPlanDir{Path: tmpDir, Size: size})
+	}
+	return ret
+}
+
+// dirSize returns the total size of the regular files under a dir
+func dirSize(dir string) (uint64, error) {
+	var ret uint64
+	err := filepath.WalkDir(
+		dir,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			ret += uint64(info.Size())
+			return nil
+		},
+	)
+	return ret, err
+}
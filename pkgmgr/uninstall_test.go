@@ -0,0 +1,264 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUninstallPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "node",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{
+						Docker: &PackageInstallStepDocker{
+							ContainerName: "node",
+							Image:         "example/node:1.0.0",
+						},
+					},
+				},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "ogmios",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node"}},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "kupo",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "ogmios"}},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	pkgDataDir := cfg.packageDataDir("node-1.0.0-" + activeContextName)
+	if err := os.MkdirAll(pkgDataDir, fs.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDataDir, "db"), make([]byte, 2048), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Dependent packages that aren't uninstalled would break
+	plan, err := pm.UninstallPlan([]string{"node"}, false, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if names := plan.PackageNames(); !reflect.DeepEqual(names, []string{"node"}) {
+		t.Fatalf("did not get expected packages: %v", names)
+	}
+	if len(plan.Broken) != 1 || plan.Broken[0].Package.Name != "ogmios" {
+		t.Fatalf("did not get expected broken packages: %#v", plan.Broken)
+	}
+	nodePlan := plan.Packages[0]
+	if !reflect.DeepEqual(nodePlan.Containers, []string{"node-1.0.0-default-node"}) ||
+		!reflect.DeepEqual(nodePlan.Images, []string{"example/node:1.0.0"}) {
+		t.Fatalf("did not get expected package plan: %#v", nodePlan)
+	}
+	if plan.DataSize() != 2048 {
+		t.Fatalf("did not get expected data size: %d", plan.DataSize())
+	}
+	// Dependent packages are uninstalled first when cascading
+	plan, err = pm.UninstallPlan([]string{"node"}, false, false, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedNames := []string{"kupo", "ogmios", "node"}
+	if names := plan.PackageNames(); !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("did not get expected packages: got %v, expected %v", names, expectedNames)
+	}
+	if len(plan.Broken) > 0 || !plan.Packages[0].Dependent || plan.Packages[2].Dependent {
+		t.Fatalf("did not get expected plan: %#v", plan)
+	}
+	// Requested packages are ordered after the packages that depend on them
+	plan, err = pm.UninstallPlan([]string{"node", "ogmios", "kupo"}, true, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if names := plan.PackageNames(); !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("did not get expected packages: got %v, expected %v", names, expectedNames)
+	}
+	// Data is kept with keepData, and images with keepImages
+	if len(plan.Packages[2].Images) != 1 || plan.DataSize() > 0 {
+		t.Fatalf("did not expect data to be removed: %#v", plan.Packages[2])
+	}
+	plan, err = pm.UninstallPlan([]string{"node"}, false, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(plan.Packages[0].Images) > 0 || plan.DataSize() != 2048 {
+		t.Fatalf("did not expect images to be removed: %#v", plan.Packages[0])
+	}
+}
+
+func TestUninstallPlanVersionSpec(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	// Both versions of a package are tracked after a partially failed upgrade
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       Package{Name: "node", Version: "2.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "ogmios",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node"}},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	if _, err := pm.UninstallPlan([]string{"node"}, false, false, false); err == nil {
+		t.Fatalf("did not get expected error for package with more than one version installed")
+	}
+	if _, err := pm.UninstallPlan([]string{"node = 3.0.0"}, false, false, false); err == nil {
+		t.Fatalf("did not get expected error for version that isn't installed")
+	}
+	// Dependent packages don't break when another version of the package is kept
+	plan, err := pm.UninstallPlan([]string{"node = 1.0.0"}, false, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if specs := plan.PackageSpecs(); !reflect.DeepEqual(specs, []string{"node = 1.0.0"}) {
+		t.Fatalf("did not get expected packages: %v", specs)
+	}
+	if len(plan.Broken) > 0 {
+		t.Fatalf("did not expect broken packages: %#v", plan.Broken)
+	}
+	// Removing all versions breaks the dependent packages
+	plan, err = pm.UninstallPlan([]string{"node=1.0.0", "node=2.0.0"}, false, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedSpecs := []string{"node = 1.0.0", "node = 2.0.0"}
+	if specs := plan.PackageSpecs(); !reflect.DeepEqual(specs, expectedSpecs) {
+		t.Fatalf("did not get expected packages: got %v, expected %v", specs, expectedSpecs)
+	}
+	if len(plan.Broken) != 1 || plan.Broken[0].Package.Name != "ogmios" {
+		t.Fatalf("did not get expected broken packages: %#v", plan.Broken)
+	}
+}
+
+func TestUninstallOtherVersionInstalled(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	// The network step would need Docker to remove the network
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "node",
+				Version: "1.0.0",
+				InstallSteps: []PackageInstallStep{
+					{Network: &PackageInstallStepNetwork{Name: "cardano"}},
+				},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       Package{Name: "node", Version: "2.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	if err := pm.state.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logsDir := containerLogsDir(pm.config, activeContextName, "node")
+	if err := os.MkdirAll(logsDir, fs.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pkgDataDir := pm.config.packageDataDir("node-1.0.0-" + activeContextName)
+	if err := os.MkdirAll(pkgDataDir, fs.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := pm.Uninstall([]string{"node = 1.0.0"}, false, false, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The logs and networks are kept for the remaining version, but not the data of the
+	// uninstalled version
+	if _, err := os.Stat(logsDir); err != nil {
+		t.Fatalf("logs dir was not kept: %s", err)
+	}
+	if _, err := os.Stat(pkgDataDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("data dir was not removed: %v", err)
+	}
+	installedPkgs := pm.InstalledPackages()
+	if len(installedPkgs) != 1 || installedPkgs[0].Package.Version != "2.0.0" {
+		t.Fatalf("did not get expected installed packages: %#v", installedPkgs)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-version"
+)
+
+// InstalledPackageStatus is an installed package along with the newest available version of it
+type InstalledPackageStatus struct {
+	Installed InstalledPackage
+	// LatestVersion is the newest available version of the package, or empty if the package is
+	// no longer available
+	LatestVersion string
+}
+
+// UpgradeAvailable returns whether a newer version of the package is available
+func (s InstalledPackageStatus) UpgradeAvailable() bool {
+	return versionNewer(s.LatestVersion, s.Installed.Package.Version)
+}
+
+// AvailablePackageStatus is an available package along with the version of it installed in the
+// active context, if any
+type AvailablePackageStatus struct {
+	Package Package
+	// InstalledVersion is the version of the primary instance of the package installed in the
+	// active context, or empty if the package isn't installed
+	InstalledVersion string
+}
+
+// Installed returns whether this version of the package is installed
+func (s AvailablePackageStatus) Installed() bool {
+	return s.InstalledVersion != "" && s.InstalledVersion == s.Package.Version
+}
+
+// IsUpgrade returns whether this version of the package is newer than the installed version
+func (s AvailablePackageStatus) IsUpgrade() bool {
+	return s.InstalledVersion != "" && versionNewer(s.Package.Version, s.InstalledVersion)
+}
+
+// InstalledPackageStatuses returns the installed packages in the active context, or in all
+// contexts, along with the newest available version of each
+func (p *PackageManager) InstalledPackageStatuses(allContexts bool) []InstalledPackageStatus {
+	installedPkgs := p.InstalledPackages()
+	if allContexts {
+		installedPkgs = p.InstalledPackagesAllContexts()
+	}
+	if len(installedPkgs) == 0 {
+		return nil
+	}
+	// The registry isn't fetched just to look for newer versions
+	availablePkgs := p.cachedAvailablePackages()
+	ret := make([]InstalledPackageStatus, 0, len(installedPkgs))
+	for _, installedPkg := range installedPkgs {
+		tmpAvailablePkgs := availablePkgs
+		// Packages installed from a local path are upgraded from that path
+		if installedPkg.Origin != "" {
+			localPkgs, err := localPackages(p.config, installedPkg.Origin)
+			if err != nil {
+				p.config.Logger.Warn(
+					fmt.Sprintf(
+						"failed to load local package %s from %s: %s",
+						installedPkg.Package.Name,
+						installedPkg.Origin,
+						err,
+					),
+				)
+			}
+			tmpAvailablePkgs = overlayPackages(availablePkgs, localPkgs)
+		}
+		ret = append(
+			ret,
+			InstalledPackageStatus{
+				Installed: installedPkg,
+				LatestVersion: latestPackageVersion(
+					tmpAvailablePkgs,
+					installedPkg.Package.Name,
+				),
+			},
+		)
+	}
+	return ret
+}
+
+// OutdatedPackages returns the installed packages in the active context, or in all contexts,
+// that have a newer version available
+func (p *PackageManager) OutdatedPackages(allContexts bool) []InstalledPackageStatus {
+	var ret []InstalledPackageStatus
+	for _, status := range p.InstalledPackageStatuses(allContexts) {
+		if status.UpgradeAvailable() {
+			ret = append(ret, status)
+		}
+	}
+	return ret
+}
+
+// AvailablePackageStatuses returns the available packages along with the version of each that's
+// installed in the active context
+func (p *PackageManager) AvailablePackageStatuses() []AvailablePackageStatus {
+	installedVersions := make(map[string]string)
+	for _, installedPkg := range p.InstalledPackages() {
+		// Only the primary instance of a package is considered
+		if installedPkg.Instance != "" {
+			continue
+		}
+		installedVersions[installedPkg.Package.Name] = installedPkg.Package.Version
+	}
+	availablePkgs := p.AvailablePackages()
+	ret := make([]AvailablePackageStatus, 0, len(availablePkgs))
+	for _, availablePkg := range availablePkgs {
+		ret = append(
+			ret,
+			AvailablePackageStatus{
+				Package:          availablePkg,
+				InstalledVersion: installedVersions[availablePkg.Name],
+			},
+		)
+	}
+	return ret
+}
+
+// latestPackageVersion returns the newest version of the named package, or empty if there are no
+// versions of the package
+func latestPackageVersion(pkgs []Package, pkgName string) string {
+	var ret string
+	for _, pkg := range pkgs {
+		if pkg.Name != pkgName {
+			continue
+		}
+		if ret == "" || versionNewer(pkg.Version, ret) {
+			ret = pkg.Version
+		}
+	}
+	return ret
+}
+
+// versionNewer returns whether version a is newer than version b. Invalid versions are never newer
+// sortPackages sorts packages by name, and then by version with the newest version first, so that
+// the order doesn't depend on the order the package registry was read in. Versions that can't be
+// parsed come after the others, in reverse string order
+func sortPackages(pkgs []Package) {
+	sort.SliceStable(
+		pkgs,
+		func(i, j int) bool {
+			if pkgs[i].Name != pkgs[j].Name {
+				return pkgs[i].Name < pkgs[j].Name
+			}
+			iVer, iErr := version.NewVersion(pkgs[i].Version)
+			jVer, jErr := version.NewVersion(pkgs[j].Version)
+			switch {
+			case iErr == nil && jErr == nil:
+				return iVer.GreaterThan(jVer)
+			case iErr == nil || jErr == nil:
+				return iErr == nil
+			}
+			return pkgs[i].Version > pkgs[j].Version
+		},
+	)
+}
+
+func versionNewer(a string, b string) bool {
+	aVer, err := version.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	bVer, err := version.NewVersion(b)
+	if err != nil {
+		return false
+	}
+	return aVer.GreaterThan(bVer)
+}
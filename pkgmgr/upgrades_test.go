@@ -0,0 +1,182 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageStatuses(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.availablePackages = []Package{
+		{Name: "node", Version: "1.0.0"},
+		{Name: "node", Version: "1.10.0"},
+		{Name: "node", Version: "1.2.0"},
+		{Name: "tool", Version: "2.0.0"},
+		{Name: "other", Version: "1.0.0"},
+	}
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.2.0"},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       Package{Name: "tool", Version: "2.0.0"},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       Package{Name: "gone", Version: "1.0.0"},
+			Context:       "default",
+			InstalledTime: time.Now(),
+		},
+		{
+			Package:       Package{Name: "other", Version: "0.9.0"},
+			Context:       "other",
+			InstalledTime: time.Now(),
+		},
+	}
+	expectedLatest := map[string]string{
+		"node": "1.10.0",
+		"tool": "2.0.0",
+		"gone": "",
+	}
+	statuses := pm.InstalledPackageStatuses(false)
+	if len(statuses) != len(expectedLatest) {
+		t.Fatalf("did not get expected statuses: %#v", statuses)
+	}
+	for _, status := range statuses {
+		pkgName := status.Installed.Package.Name
+		if status.LatestVersion != expectedLatest[pkgName] {
+			t.Fatalf(
+				"did not get expected latest version for %s: got %q, expected %q",
+				pkgName,
+				status.LatestVersion,
+				expectedLatest[pkgName],
+			)
+		}
+	}
+	outdated := pm.OutdatedPackages(false)
+	if len(outdated) != 1 || outdated[0].Installed.Package.Name != "node" {
+		t.Fatalf("did not get expected outdated packages: %#v", outdated)
+	}
+	if outdated := pm.OutdatedPackages(true); len(outdated) != 2 {
+		t.Fatalf("did not get expected outdated packages for all contexts: %#v", outdated)
+	}
+	expectedMarkers := map[string][2]bool{
+		"node-1.0.0":  {false, false},
+		"node-1.10.0": {false, true},
+		"node-1.2.0":  {true, false},
+		"tool-2.0.0":  {true, false},
+		"other-1.0.0": {false, false},
+	}
+	for _, status := range pm.AvailablePackageStatuses() {
+		key := status.Package.Name + "-" + status.Package.Version
+		got := [2]bool{status.Installed(), status.IsUpgrade()}
+		if got != expectedMarkers[key] {
+			t.Fatalf(
+				"did not get expected markers for %s: got %v, expected %v",
+				key,
+				got,
+				expectedMarkers[key],
+			)
+		}
+	}
+}
+
+func TestAvailablePackagesOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pm.availablePackages = []Package{
+		{Name: "tool", Version: "2.0.0"},
+		{Name: "node", Version: "1.2.0"},
+		{Name: "node", Version: "bad"},
+		{Name: "node", Version: "1.10.0"},
+		{Name: "other", Version: "1.0.0"},
+		{Name: "node", Version: "1.0.0"},
+	}
+	expected := []string{
+		"node-1.10.0",
+		"node-1.2.0",
+		"node-1.0.0",
+		"node-bad",
+		"other-1.0.0",
+		"tool-2.0.0",
+	}
+	pkgNames := func(pkgs []Package) []string {
+		var ret []string
+		for _, pkg := range pkgs {
+			ret = append(ret, pkg.Name+"-"+pkg.Version)
+		}
+		return ret
+	}
+	if res := pkgNames(pm.AvailablePackages()); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("did not get expected package order: got %v, expected %v", res, expected)
+	}
+	testDefs := []struct {
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{offset: 0, limit: 0, expected: expected},
+		{offset: 1, limit: 2, expected: expected[1:3]},
+		{offset: 4, limit: 10, expected: expected[4:]},
+		{offset: 6, limit: 1, expected: nil},
+	}
+	for _, testDef := range testDefs {
+		page, total, err := pm.AvailablePackagesPage(testDef.offset, testDef.limit)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if total != len(expected) {
+			t.Fatalf("did not get expected total: got %d, expected %d", total, len(expected))
+		}
+		if res := pkgNames(page); !reflect.DeepEqual(res, testDef.expected) {
+			t.Fatalf(
+				"did not get expected page for offset %d and limit %d: got %v, expected %v",
+				testDef.offset,
+				testDef.limit,
+				res,
+				testDef.expected,
+			)
+		}
+	}
+	if _, _, err := pm.AvailablePackagesPage(-1, 0); err == nil {
+		t.Fatalf("did not get expected error for negative offset")
+	}
+}
@@ -0,0 +1,429 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// walletSyncStatusReady is the sync status reported by the wallet API once it has caught up
+	// with the node
+	walletSyncStatusReady = "ready"
+
+	// walletPollInterval is how often the wallet API is checked while waiting for it
+	walletPollInterval = 5 * time.Second
+
+	// walletRequestTimeout is the timeout for a single request to the wallet API
+	walletRequestTimeout = 30 * time.Second
+
+	// walletMinPassphraseLength is the minimum passphrase length accepted by the wallet API
+	walletMinPassphraseLength = 10
+)
+
+// PackageWallet declares the REST API of a wallet package, such as cardano-wallet, which allows
+// managing wallets with cardano-up
+type PackageWallet struct {
+	// Url is the base URL of the wallet API, such as http://localhost:8090/v2
+	Url string `yaml:"url" jsonschema:"required"`
+}
+
+func (p *PackageWallet) validate() error {
+	if p.Url == "" {
+		return fmt.Errorf("wallet URL cannot be empty")
+	}
+	// Templated URLs are checked when rendered
+	if strings.Contains(p.Url, "{{") {
+		return nil
+	}
+	return validateWalletUrl(p.Url)
+}
+
+func validateWalletUrl(walletUrl string) error {
+	tmpUrl, err := url.Parse(walletUrl)
+	if err != nil || (tmpUrl.Scheme != "http" && tmpUrl.Scheme != "https") ||
+		tmpUrl.Host == "" {
+		return fmt.Errorf("invalid wallet URL: %s", walletUrl)
+	}
+	return nil
+}
+
+// WalletStatus describes the readiness of the wallet API for a wallet package
+type WalletStatus struct {
+	Package InstalledPackage
+	// Url is the base URL of the wallet API
+	Url string
+	// SyncStatus is the sync status reported by the wallet API, or empty if the API isn't
+	// responding yet
+	SyncStatus string
+	// SyncProgress is the sync progress as a percentage, while the wallet is syncing
+	SyncProgress float64
+	// Error is the error from the last request to the wallet API, if it failed
+	Error error
+}
+
+// Ready returns whether the wallet API is responding and has caught up with the node
+func (s WalletStatus) Ready() bool {
+	return s.Error == nil && s.SyncStatus == walletSyncStatusReady
+}
+
+// Wallet is a wallet managed by the wallet API
+type Wallet struct {
+	Id   string
+	Name string
+	// SyncStatus is the restoration status of the wallet, which is ready once it has been
+	// restored
+	SyncStatus string
+	// SyncProgress is the restoration progress as a percentage, while the wallet is syncing
+	SyncProgress float64
+	// Balance is the total balance in lovelace
+	Balance uint64
+	// AvailableBalance is the balance in lovelace that's available to spend
+	AvailableBalance uint64
+}
+
+// WalletCreateOptions controls creating or restoring a wallet with CreateWallet
+type WalletCreateOptions struct {
+	Name string
+	// Mnemonic is the recovery phrase for the wallet
+	Mnemonic []string
+	// Passphrase is the spending passphrase for the wallet
+	Passphrase string
+}
+
+// walletApiQuantity is a quantity with a unit in the wallet API
+type walletApiQuantity struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// walletApiSyncProgress is the sync progress of the wallet API or a wallet
+type walletApiSyncProgress struct {
+	Status   string            `json:"status"`
+	Progress walletApiQuantity `json:"progress"`
+}
+
+type walletApiNetworkInformation struct {
+	SyncProgress walletApiSyncProgress `json:"sync_progress"`
+}
+
+type walletApiWallet struct {
+	Id      string                `json:"id"`
+	Name    string                `json:"name"`
+	State   walletApiSyncProgress `json:"state"`
+	Balance struct {
+		Total     walletApiQuantity `json:"total"`
+		Available walletApiQuantity `json:"available"`
+	} `json:"balance"`
+}
+
+func (w walletApiWallet) wallet() Wallet {
+	return Wallet{
+		Id:               w.Id,
+		Name:             w.Name,
+		SyncStatus:       w.State.Status,
+		SyncProgress:     w.State.Progress.Quantity,
+		Balance:          uint64(w.Balance.Total.Quantity),
+		AvailableBalance: uint64(w.Balance.Available.Quantity),
+	}
+}
+
+type walletApiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WalletStatus returns the readiness of the wallet API for the specified wallet package in the
+// active context. If no package is specified, the only installed package that declares a wallet
+// is used. A wallet API that isn't responding is reported in the status rather than as an error
+func (p *PackageManager) WalletStatus(pkgName string) (WalletStatus, error) {
+	installedPkg, err := p.walletPackage(pkgName)
+	if err != nil {
+		return WalletStatus{}, err
+	}
+	walletUrl, err := p.walletUrl(installedPkg)
+	if err != nil {
+		return WalletStatus{}, err
+	}
+	return p.walletStatus(installedPkg, walletUrl), nil
+}
+
+// WaitForWallet waits for the wallet API for a wallet package to respond and catch up with the
+// node. The progress func, if provided, is called with the status after each check
+func (p *PackageManager) WaitForWallet(
+	pkgName string,
+	timeout time.Duration,
+	progress func(WalletStatus),
+) (WalletStatus, error) {
+	installedPkg, err := p.walletPackage(pkgName)
+	if err != nil {
+		return WalletStatus{}, err
+	}
+	walletUrl, err := p.walletUrl(installedPkg)
+	if err != nil {
+		return WalletStatus{}, err
+	}
+	ctx := p.config.ctx()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		status := p.walletStatus(installedPkg, walletUrl)
+		if progress != nil {
+			progress(status)
+		}
+		if status.Ready() {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			if p.config.ctx().Err() != nil {
+				return status, p.config.ctx().Err()
+			}
+			return status, NewWalletNotReadyError(installedPkg.InstanceName(), timeout)
+		case <-time.After(walletPollInterval):
+		}
+	}
+}
+
+// Wallets returns the wallets managed by the wallet API for a wallet package
+func (p *PackageManager) Wallets(pkgName string) ([]Wallet, error) {
+	installedPkg, err := p.walletPackage(pkgName)
+	if err != nil {
+		return nil, err
+	}
+	walletUrl, err := p.walletUrl(installedPkg)
+	if err != nil {
+		return nil, err
+	}
+	var apiWallets []walletApiWallet
+	if err := p.walletRequest(http.MethodGet, walletUrl, "wallets", nil, &apiWallets); err != nil {
+		return nil, err
+	}
+	ret := make([]Wallet, 0, len(apiWallets))
+	for _, apiWallet := range apiWallets {
+		ret = append(ret, apiWallet.wallet())
+	}
+	return ret, nil
+}
+
+// CreateWallet creates a wallet from a recovery phrase with the wallet API for a wallet package.
+// The same is used to restore an existing wallet, whose history is then restored from the chain
+func (p *PackageManager) CreateWallet(pkgName string, opts WalletCreateOptions) (Wallet, error) {
+	if opts.Name == "" {
+		return Wallet{}, fmt.Errorf("wallet name cannot be empty")
+	}
+	if len(opts.Mnemonic) == 0 {
+		return Wallet{}, fmt.Errorf("wallet recovery phrase cannot be empty")
+	}
+	if len(opts.Passphrase) < walletMinPassphraseLength {
+		return Wallet{}, fmt.Errorf(
+			"wallet passphrase must be at least %d characters",
+			walletMinPassphraseLength,
+		)
+	}
+	installedPkg, err := p.walletPackage(pkgName)
+	if err != nil {
+		return Wallet{}, err
+	}
+	walletUrl, err := p.walletUrl(installedPkg)
+	if err != nil {
+		return Wallet{}, err
+	}
+	reqBody := map[string]any{
+		"name":              opts.Name,
+		"mnemonic_sentence": opts.Mnemonic,
+		"passphrase":        opts.Passphrase,
+	}
+	var apiWallet walletApiWallet
+	if err := p.walletRequest(
+		http.MethodPost,
+		walletUrl,
+		"wallets",
+		reqBody,
+		&apiWallet,
+	); err != nil {
+		return Wallet{}, err
+	}
+	return apiWallet.wallet(), nil
+}
+
+// walletPackage returns the installed wallet package with the provided name in the active
+// context, or the only installed wallet package if no name is provided
+func (p *PackageManager) walletPackage(pkgName string) (InstalledPackage, error) {
+	activeContextName, _ := p.CurrentContext()
+	var walletPkgs []InstalledPackage
+	for _, installedPkg := range p.InstalledPackages() {
+		if pkgName != "" && installedPkg.InstanceName() == pkgName {
+			if installedPkg.Package.Wallet == nil {
+				return InstalledPackage{}, NewPackageNotWalletError(pkgName)
+			}
+			return installedPkg, nil
+		}
+		if installedPkg.Package.Wallet != nil {
+			walletPkgs = append(walletPkgs, installedPkg)
+		}
+	}
+	if pkgName != "" {
+		return InstalledPackage{}, NewPackageNotInstalledError(
+			pkgName,
+			activeContextName,
+		)
+	}
+	if len(walletPkgs) == 0 {
+		return InstalledPackage{}, ErrNoWalletPackages
+	}
+	if len(walletPkgs) > 1 {
+		var pkgNames []string
+		for _, walletPkg := range walletPkgs {
+			pkgNames = append(pkgNames, walletPkg.InstanceName())
+		}
+		return InstalledPackage{}, NewWalletPackageAmbiguousError(pkgNames)
+	}
+	return walletPkgs[0], nil
+}
+
+// walletUrl returns the base URL of the wallet API for an installed wallet package. Host ports
+// use the existing allocations for the package, and a local host in the URL is replaced with the
+// Docker host for contexts with a remote Docker host
+func (p *PackageManager) walletUrl(installedPkg InstalledPackage) (string, error) {
+	walletUrl, err := p.installedPackageTemplate(installedPkg).Render(
+		installedPkg.Package.Wallet.Url,
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := validateWalletUrl(walletUrl); err != nil {
+		return "", err
+	}
+	dockerHost := p.state.Contexts[installedPkg.Context].DockerHost
+	return walletHostUrl(walletUrl, dockerHost), nil
+}
+
+// walletHostUrl replaces a local host in the wallet URL with the host running the containers for
+// the Docker host
+func walletHostUrl(walletUrl string, dockerHost string) string {
+	tmpUrl, err := url.Parse(walletUrl)
+	if err != nil {
+		return walletUrl
+	}
+	switch tmpUrl.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+	default:
+		return walletUrl
+	}
+	hostAddress := dockerHostAddress(dockerHost)
+	if port := tmpUrl.Port(); port != "" {
+		tmpUrl.Host = net.JoinHostPort(hostAddress, port)
+	} else {
+		tmpUrl.Host = hostAddress
+	}
+	return tmpUrl.String()
+}
+
+func (p *PackageManager) walletStatus(
+	installedPkg InstalledPackage,
+	walletUrl string,
+) WalletStatus {
+	ret := WalletStatus{
+		Package: installedPkg,
+		Url:     walletUrl,
+	}
+	var networkInfo walletApiNetworkInformation
+	if err := p.walletRequest(
+		http.MethodGet,
+		walletUrl,
+		"network/information",
+		nil,
+		&networkInfo,
+	); err != nil {
+		ret.Error = err
+		return ret
+	}
+	ret.SyncStatus = networkInfo.SyncProgress.Status
+	ret.SyncProgress = networkInfo.SyncProgress.Progress.Quantity
+	return ret
+}
+
+// walletRequest makes a request to the wallet API and decodes the JSON response. Requests aren't
+// retried, since creating a wallet isn't idempotent
+func (p *PackageManager) walletRequest(
+	method string,
+	walletUrl string,
+	path string,
+	reqBody any,
+	respBody any,
+) error {
+	client, err := newHttpClient(HttpConfig{Timeout: walletRequestTimeout})
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if reqBody != nil {
+		reqData, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(reqData)
+	}
+	req, err := http.NewRequestWithContext(
+		p.config.ctx(),
+		method,
+		strings.TrimRight(walletUrl, "/")+"/"+path,
+		body,
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr walletApiError
+		if err := json.Unmarshal(respData, &apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return NewWalletApiError(apiErr.Code, apiErr.Message)
+	}
+	if respBody == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respData, respBody); err != nil {
+		return fmt.Errorf("failed to decode wallet API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackageWalletValidate(t *testing.T) {
+	testDefs := []struct {
+		Url   string
+		Error bool
+	}{
+		{Url: "http://localhost:8090/v2"},
+		{Url: "http://localhost:{{ freePort 8090 }}/v2"},
+		{Url: "", Error: true},
+		{Url: "localhost:8090", Error: true},
+		{Url: "ftp://localhost:8090", Error: true},
+	}
+	for _, testDef := range testDefs {
+		wallet := PackageWallet{Url: testDef.Url}
+		err := wallet.validate()
+		if testDef.Error {
+			if err == nil {
+				t.Fatalf("did not get expected error for URL %q", testDef.Url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestWalletHostUrl(t *testing.T) {
+	testDefs := []struct {
+		Url        string
+		DockerHost string
+		Expected   string
+	}{
+		{
+			Url:      "http://localhost:8090/v2",
+			Expected: "http://127.0.0.1:8090/v2",
+		},
+		{
+			Url:        "http://localhost:8090/v2",
+			DockerHost: "ssh://cardano@node.example.com",
+			Expected:   "http://node.example.com:8090/v2",
+		},
+		{
+			Url:        "https://wallet.example.com/v2",
+			DockerHost: "ssh://cardano@node.example.com",
+			Expected:   "https://wallet.example.com/v2",
+		},
+	}
+	for _, testDef := range testDefs {
+		if ret := walletHostUrl(testDef.Url, testDef.DockerHost); ret != testDef.Expected {
+			t.Fatalf(
+				"did not get expected URL for %q: got %q, expected %q",
+				testDef.Url,
+				ret,
+				testDef.Expected,
+			)
+		}
+	}
+}
+
+func TestWalletApi(t *testing.T) {
+	var createReq map[string]any
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/network/information":
+				_, _ = w.Write(
+					[]byte(`{"sync_progress": {"status": "syncing", "progress": {"quantity": 42.5, "unit": "percent"}}}`),
+				)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/wallets":
+				_, _ = w.Write(
+					[]byte(`[{"id": "abc123", "name": "test", "state": {"status": "ready"}, "balance": {"total": {"quantity": 1500000, "unit": "lovelace"}, "available": {"quantity": 1000000, "unit": "lovelace"}}}]`),
+				)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/wallets":
+				if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if createReq["name"] == "existing" {
+					w.WriteHeader(http.StatusConflict)
+					_, _ = w.Write(
+						[]byte(`{"code": "wallet_already_exists", "message": "This operation would yield a wallet with the following id: abc123"}`),
+					)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write(
+					[]byte(`{"id": "def456", "name": "new", "state": {"status": "syncing", "progress": {"quantity": 0, "unit": "percent"}}}`),
+				)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+	)
+	defer server.Close()
+	tmpDir := t.TempDir()
+	cfg := Config{
+		ConfigDir: filepath.Join(tmpDir, "config"),
+		DataDir:   filepath.Join(tmpDir, "data"),
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Template:  NewTemplate(nil),
+	}
+	pm, err := NewPackageManager(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package: Package{
+				Name:    "cardano-wallet",
+				Version: "1.0.0",
+				Wallet:  &PackageWallet{Url: server.URL + "/v2"},
+			},
+			Context: activeContextName,
+		},
+	}
+	status, err := pm.WalletStatus("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.Ready() || status.SyncStatus != "syncing" || status.SyncProgress != 42.5 {
+		t.Fatalf("did not get expected status: %#v", status)
+	}
+	wallets, err := pm.Wallets("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedWallets := []Wallet{
+		{
+			Id:               "abc123",
+			Name:             "test",
+			SyncStatus:       "ready",
+			Balance:          1500000,
+			AvailableBalance: 1000000,
+		},
+	}
+	if !reflect.DeepEqual(wallets, expectedWallets) {
+		t.Fatalf("did not get expected wallets: %#v", wallets)
+	}
+	opts := WalletCreateOptions{
+		Name:       "new",
+		Mnemonic:   strings.Fields("word1 word2 word3"),
+		Passphrase: "short",
+	}
+	if _, err := pm.CreateWallet("", opts); err == nil {
+		t.Fatalf("did not get expected error for short passphrase")
+	}
+	opts.Passphrase = "long enough passphrase"
+	wallet, err := pm.CreateWallet("", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if wallet.Id != "def456" || createReq["passphrase"] != opts.Passphrase ||
+		len(createReq["mnemonic_sentence"].([]any)) != 3 {
+		t.Fatalf("did not get expected wallet: %#v (request: %#v)", wallet, createReq)
+	}
+	opts.Name = "existing"
+	_, err = pm.CreateWallet("", opts)
+	if err == nil || !strings.Contains(err.Error(), "wallet_already_exists") {
+		t.Fatalf("did not get expected error: %v", err)
+	}
+	// Packages that don't declare a wallet can't be used
+	if _, err := pm.Wallets("cardano-node"); err == nil {
+		t.Fatalf("did not get expected error for package that isn't installed")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// watchHistoryFilename is the file in the config dir with the incidents recorded by the
+	// watchdog, one JSON object per line
+	watchHistoryFilename = "watch_history.jsonl"
+
+	defaultWatchMaxRestarts   = 5
+	defaultWatchRestartWindow = time.Hour
+	defaultWatchBackoff       = 10 * time.Second
+	defaultWatchMaxBackoff    = 5 * time.Minute
+)
+
+// Watchdog incident actions
+const (
+	WatchActionRestarted     = "restarted"
+	WatchActionRestartFailed = "restart_failed"
+	WatchActionGaveUp        = "gave_up"
+)
+
+// watchEventActions are the Docker container event actions used by the watchdog. Kill and start
+// events are used to tell intentional stops apart from failures
+var watchEventActions = []string{
+	"start",
+	"kill",
+	"die",
+}
+
+// WatchConfig holds the restart limits for the watchdog. Zero values use the defaults
+type WatchConfig struct {
+	// MaxRestarts is the number of times a container is restarted within RestartWindow, after
+	// which it's left stopped
+	MaxRestarts   int
+	RestartWindow time.Duration
+	// Backoff is the delay before the first restart of a container, which doubles for each
+	// further restart within RestartWindow, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (c WatchConfig) withDefaults() WatchConfig {
+	if c.MaxRestarts <= 0 {
+		c.MaxRestarts = defaultWatchMaxRestarts
+	}
+	if c.RestartWindow <= 0 {
+		c.RestartWindow = defaultWatchRestartWindow
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultWatchBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultWatchMaxBackoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = c.Backoff
+	}
+	return c
+}
+
+// restartBackoff returns the delay before the specified restart attempt, starting at 1
+func (c WatchConfig) restartBackoff(attempt int) time.Duration {
+	ret := c.Backoff
+	for i := 1; i < attempt; i++ {
+		ret *= 2
+		if ret >= c.MaxBackoff {
+			return c.MaxBackoff
+		}
+	}
+	return ret
+}
+
+// WatchIncident records an unexpected container exit handled by the watchdog
+type WatchIncident struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Package   string    `json:"package"`
+	Version   string    `json:"version"`
+	Context   string    `json:"context"`
+	Container string    `json:"container"`
+	ExitCode  string    `json:"exitCode,omitempty"`
+	// Attempt is the number of the restart within the restart window
+	Attempt int           `json:"attempt,omitempty"`
+	Backoff time.Duration `json:"backoff,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Watch watches containers for installed packages and restarts containers that exit unexpectedly,
+// with an increasing delay between restarts of the same container. A container is left stopped
+// once it has been restarted too many times within the restart window. Incidents are logged and
+// recorded to the watchdog history. It runs until the config context is cancelled
+func (p *PackageManager) Watch(watchCfg WatchConfig) error {
+	watchCfg = watchCfg.withDefaults()
+	p.config.Logger.Info(
+		fmt.Sprintf(
+			"Watching containers for installed packages (up to %d restarts per %s)",
+			watchCfg.MaxRestarts,
+			watchCfg.RestartWindow,
+		),
+	)
+	w := &watchdog{
+		pm:          p,
+		cfg:         watchCfg,
+		pendingKill: make(map[string]bool),
+		restarts:    make(map[string][]time.Time),
+		scheduled:   make(map[string]bool),
+		restart:     p.restartContainer,
+	}
+	err := p.ContainerEvents(
+		watchEventActions,
+		time.Now(),
+		true,
+		w.handleEvent,
+	)
+	// Wait for pending restarts, which stop waiting once the context is cancelled
+	w.wg.Wait()
+	return err
+}
+
+type watchdog struct {
+	pm  *PackageManager
+	cfg WatchConfig
+	// restart restarts the container with the specified name
+	restart func(string) error
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	// pendingKill tracks containers that were sent a stop signal, so that the resulting die event
+	// isn't treated as a failure
+	pendingKill map[string]bool
+	// restarts has the times of the restarts of each container within the restart window
+	restarts map[string][]time.Time
+	// scheduled tracks containers with a restart waiting for its backoff
+	scheduled map[string]bool
+}
+
+func (w *watchdog) handleEvent(evt ContainerEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch evt.Action {
+	case "start":
+		delete(w.pendingKill, evt.ContainerName)
+	case "kill":
+		// Other signals, such as SIGHUP to reload the topology, don't stop the container
+		if evt.isStopSignal() {
+			w.pendingKill[evt.ContainerName] = true
+		}
+	case "die":
+		if w.pendingKill[evt.ContainerName] {
+			delete(w.pendingKill, evt.ContainerName)
+			w.pm.config.Logger.Debug(
+				fmt.Sprintf(
+					"ignoring intentional stop of container %s",
+					evt.ContainerName,
+				),
+			)
+			return
+		}
+		w.scheduleRestart(evt)
+	}
+}
+
+// scheduleRestart restarts a container that exited unexpectedly after its backoff, unless it has
+// used up its restart budget. The caller must hold the lock
+func (w *watchdog) scheduleRestart(evt ContainerEvent) {
+	if w.scheduled[evt.ContainerName] {
+		return
+	}
+	now := time.Now()
+	var recent []time.Time
+	for _, restartTime := range w.restarts[evt.ContainerName] {
+		if now.Sub(restartTime) < w.cfg.RestartWindow {
+			recent = append(recent, restartTime)
+		}
+	}
+	w.restarts[evt.ContainerName] = recent
+	incident := WatchIncident{
+		Time:      now,
+		Package:   evt.Package,
+		Version:   evt.Version,
+		Context:   evt.Context,
+		Container: evt.Container,
+		ExitCode:  evt.ExitCode,
+	}
+	if len(recent) >= w.cfg.MaxRestarts {
+		incident.Action = WatchActionGaveUp
+		w.pm.recordWatchIncident(incident)
+		return
+	}
+	incident.Attempt = len(recent) + 1
+	incident.Backoff = w.cfg.restartBackoff(incident.Attempt)
+	w.restarts[evt.ContainerName] = append(recent, now)
+	w.scheduled[evt.ContainerName] = true
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() {
+			w.mu.Lock()
+			delete(w.scheduled, evt.ContainerName)
+			w.mu.Unlock()
+		}()
+		select {
+		case <-w.pm.config.ctx().Done():
+			return
+		case <-time.After(incident.Backoff):
+		}
+		incident.Time = time.Now()
+		incident.Action = WatchActionRestarted
+		if err := w.restart(evt.ContainerName); err != nil {
+			incident.Action = WatchActionRestartFailed
+			incident.Error = err.Error()
+		}
+		w.pm.recordWatchIncident(incident)
+	}()
+}
+
+// restartContainer starts a stopped container for an installed package
+func (p *PackageManager) restartContainer(containerName string) error {
+	svc, err := newDockerService(p.config, containerName)
+	if err != nil {
+		return err
+	}
+	return svc.Start()
+}
+
+// recordWatchIncident logs a watchdog incident and appends it to the watchdog history
+func (p *PackageManager) recordWatchIncident(incident WatchIncident) {
+	msg := fmt.Sprintf(
+		"container %s for package %s (= %s) in context %q exited unexpectedly",
+		incident.Container,
+		incident.Package,
+		incident.Version,
+		incident.Context,
+	)
+	if incident.ExitCode != "" {
+		msg += fmt.Sprintf(" (exit code %s)", incident.ExitCode)
+	}
+	switch incident.Action {
+	case WatchActionRestarted:
+		msg += fmt.Sprintf(
+			", restarted it after %s (attempt %d)",
+			incident.Backoff,
+			incident.Attempt,
+		)
+	case WatchActionRestartFailed:
+		msg += fmt.Sprintf(", failed to restart it: %s", incident.Error)
+	case WatchActionGaveUp:
+		msg += ", leaving it stopped since it was restarted too many times"
+	}
+	p.config.Logger.Warn(
+		msg,
+		EventAttr(EventWatchIncident),
+		slog.String("action", incident.Action),
+		slog.String("package", incident.Package),
+		slog.String("context", incident.Context),
+		slog.String("container", incident.Container),
+	)
+	if err := p.appendWatchHistory(incident); err != nil {
+		p.config.Logger.Error(
+			fmt.Sprintf("failed to record watchdog incident: %s", err),
+		)
+	}
+}
+
+func (p *PackageManager) appendWatchHistory(incident WatchIncident) (retErr error) {
+	content, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.config.ConfigDir, fs.ModePerm); err != nil {
+		return err
+	}
+	historyFile, err := os.OpenFile(
+		filepath.Join(p.config.ConfigDir, watchHistoryFilename),
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0o644,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		retErr = errors.Join(retErr, historyFile.Close())
+	}()
+	_, err = historyFile.Write(append(content, '\n'))
+	return err
+}
+
+// WatchHistory returns the incidents recorded by the watchdog since the specified time, oldest
+// first. A zero time returns all incidents, and an empty package name returns the incidents for
+// all packages
+func (p *PackageManager) WatchHistory(since time.Time, pkgName string) ([]WatchIncident, error) {
+	historyFile, err := os.Open(filepath.Join(p.config.ConfigDir, watchHistoryFilename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer historyFile.Close()
+	var ret []WatchIncident
+	scanner := bufio.NewScanner(historyFile)
+	for scanner.Scan() {
+		var incident WatchIncident
+		if err := json.Unmarshal(scanner.Bytes(), &incident); err != nil {
+			// Skip a partially written line
+			p.config.Logger.Debug(
+				fmt.Sprintf("skipping invalid watchdog history entry: %s", err),
+			)
+			continue
+		}
+		if incident.Time.Before(since) {
+			continue
+		}
+		if pkgName != "" && incident.Package != pkgName {
+			continue
+		}
+		ret = append(ret, incident)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchConfigRestartBackoff(t *testing.T) {
+	cfg := WatchConfig{
+		Backoff:    10 * time.Second,
+		MaxBackoff: time.Minute,
+	}.withDefaults()
+	testDefs := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: 10 * time.Second},
+		{attempt: 2, expected: 20 * time.Second},
+		{attempt: 3, expected: 40 * time.Second},
+		{attempt: 4, expected: time.Minute},
+		{attempt: 10, expected: time.Minute},
+	}
+	for _, testDef := range testDefs {
+		if backoff := cfg.restartBackoff(testDef.attempt); backoff != testDef.expected {
+			t.Fatalf(
+				"did not get expected backoff for attempt %d: got %s, expected %s",
+				testDef.attempt,
+				backoff,
+				testDef.expected,
+			)
+		}
+	}
+}
+
+func TestWatchdogHandleEvent(t *testing.T) {
+	tmpDir := t.TempDir()
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: filepath.Join(tmpDir, "config"),
+			DataDir:   filepath.Join(tmpDir, "data"),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var restarted []string
+	w := &watchdog{
+		pm: pm,
+		cfg: WatchConfig{
+			MaxRestarts: 2,
+			Backoff:     time.Millisecond,
+		}.withDefaults(),
+		pendingKill: make(map[string]bool),
+		restarts:    make(map[string][]time.Time),
+		scheduled:   make(map[string]bool),
+		restart: func(containerName string) error {
+			restarted = append(restarted, containerName)
+			if containerName == "ogmios-1.0.0-default-ogmios" {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	}
+	nodeEvt := ContainerEvent{
+		Package:       "cardano-node",
+		Version:       "1.0.0",
+		Context:       "default",
+		Container:     "node",
+		ContainerName: "cardano-node-1.0.0-default-node",
+		ExitCode:      "1",
+	}
+	handle := func(evt ContainerEvent, action string) {
+		evt.Action = action
+		w.handleEvent(evt)
+		w.wg.Wait()
+	}
+	// Intentional stops don't restart the container
+	handle(nodeEvt, "kill")
+	handle(nodeEvt, "die")
+	if len(restarted) != 0 {
+		t.Fatalf("did not expect restart after intentional stop: %v", restarted)
+	}
+	// Unexpected exits restart the container until the restart budget is used up
+	handle(nodeEvt, "start")
+	for i := 0; i < 3; i++ {
+		handle(nodeEvt, "die")
+	}
+	if len(restarted) != 2 {
+		t.Fatalf("did not get expected restarts: %v", restarted)
+	}
+	ogmiosEvt := ContainerEvent{
+		Package:       "ogmios",
+		Version:       "1.0.0",
+		Context:       "default",
+		Container:     "ogmios",
+		ContainerName: "ogmios-1.0.0-default-ogmios",
+	}
+	handle(ogmiosEvt, "die")
+	// The incidents are recorded to the history
+	incidents, err := pm.WatchHistory(time.Time{}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var actions []string
+	for _, incident := range incidents {
+		actions = append(actions, incident.Action)
+	}
+	expectedActions := []string{
+		WatchActionRestarted,
+		WatchActionRestarted,
+		WatchActionGaveUp,
+		WatchActionRestartFailed,
+	}
+	if len(actions) != len(expectedActions) {
+		t.Fatalf("did not get expected incidents: %v", actions)
+	}
+	for idx, action := range expectedActions {
+		if actions[idx] != action {
+			t.Fatalf("did not get expected incidents: %v", actions)
+		}
+	}
+	if incidents[1].Attempt != 2 || incidents[1].Backoff != 2*time.Millisecond {
+		t.Fatalf("did not get expected second restart: %#v", incidents[1])
+	}
+	incidents, err = pm.WatchHistory(time.Time{}, "ogmios")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(incidents) != 1 || incidents[0].Error != "failed" {
+		t.Fatalf("did not get expected incidents for package: %#v", incidents)
+	}
+	incidents, err = pm.WatchHistory(time.Now(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(incidents) != 0 {
+		t.Fatalf("did not expect any incidents: %#v", incidents)
+	}
+}
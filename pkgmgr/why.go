@@ -0,0 +1,61 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+// PackageReason describes why a package is installed
+type PackageReason struct {
+	Package InstalledPackage
+	// Dependents are the installed packages that depend on the package
+	Dependents []InstalledPackage
+}
+
+// Unneeded returns whether the package was installed as a dependency and no installed package
+// depends on it anymore, so that it can be uninstalled
+func (r PackageReason) Unneeded() bool {
+	return !r.Package.Explicit && len(r.Dependents) == 0
+}
+
+// Why returns whether an installed package in the active context was explicitly installed or
+// installed as a dependency, along with the installed packages that depend on it
+func (p *PackageManager) Why(pkgName string) (PackageReason, error) {
+	activeContextName, _ := p.CurrentContext()
+	installedPkgs := p.InstalledPackages()
+	var ret PackageReason
+	for _, installedPkg := range installedPkgs {
+		if installedPkg.InstanceName() == pkgName {
+			ret.Package = installedPkg
+			break
+		}
+	}
+	if ret.Package.IsEmpty() {
+		return PackageReason{}, NewPackageNotInstalledError(pkgName, activeContextName)
+	}
+	resolver, err := NewResolver(
+		installedPkgs,
+		// Only the installed packages are needed to find dependents, so the registry isn't loaded
+		nil,
+		activeContextName,
+		p.config.Template,
+		p.config.Logger,
+	)
+	if err != nil {
+		return PackageReason{}, err
+	}
+	ret.Dependents, err = resolver.Dependents(ret.Package)
+	if err != nil {
+		return PackageReason{}, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Blink Labs Software
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkgmgr
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWhy(t *testing.T) {
+	tmpDir := t.TempDir()
+	pm, err := NewPackageManager(
+		Config{
+			ConfigDir: filepath.Join(tmpDir, "config"),
+			DataDir:   filepath.Join(tmpDir, "data"),
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Template:  NewTemplate(nil),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	activeContextName, _ := pm.ActiveContext()
+	pm.state.InstalledPackages = []InstalledPackage{
+		{
+			Package:       Package{Name: "node", Version: "1.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+		{
+			Package: Package{
+				Name:         "ogmios",
+				Version:      "1.0.0",
+				Dependencies: []PackageDependency{{Name: "node"}},
+			},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+			Explicit:      true,
+		},
+		{
+			Package:       Package{Name: "kupo", Version: "1.0.0"},
+			Context:       activeContextName,
+			InstalledTime: time.Now(),
+		},
+	}
+	reason, err := pm.Why("node")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if reason.Package.Explicit || len(reason.Dependents) != 1 ||
+		reason.Dependents[0].InstanceName() != "ogmios" || reason.Unneeded() {
+		t.Fatalf("did not get expected reason for node: %#v", reason)
+	}
+	reason, err = pm.Why("ogmios")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reason.Package.Explicit || len(reason.Dependents) != 0 || reason.Unneeded() {
+		t.Fatalf("did not get expected reason for ogmios: %#v", reason)
+	}
+	reason, err = pm.Why("kupo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reason.Unneeded() {
+		t.Fatalf("expected kupo to be unneeded: %#v", reason)
+	}
+	if _, err := pm.Why("foo"); err == nil {
+		t.Fatalf("did not get expected error for package that isn't installed")
+	}
+}